@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+
+// Approval is the decision of a suspended step in the WorkflowRun, the step is resumed if it's approved,
+// otherwise the WorkflowRun is terminated.
+// +kubebuilder:resource:categories={oam},shortName={apv}
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="RUN",type=string,JSONPath=`.spec.workflowRun`
+// +kubebuilder:printcolumn:name="STEP",type=string,JSONPath=`.spec.step`
+// +kubebuilder:printcolumn:name="GATE",type=string,JSONPath=`.spec.gate`
+// +kubebuilder:printcolumn:name="DECISION",type=string,JSONPath=`.spec.decision`
+// +kubebuilder:printcolumn:name="PHASE",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="AGE",type=date,JSONPath=".metadata.creationTimestamp"
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type Approval struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ApprovalSpec   `json:"spec,omitempty"`
+	Status            ApprovalStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ApprovalList contains a list of Approval
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ApprovalList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Approval `json:"items"`
+}
+
+// ApprovalDecision is the decision of an approval
+type ApprovalDecision string
+
+const (
+	// ApprovalDecisionApproved resumes the suspended step
+	ApprovalDecisionApproved ApprovalDecision = "Approved"
+	// ApprovalDecisionRejected terminates the workflow run
+	ApprovalDecisionRejected ApprovalDecision = "Rejected"
+)
+
+// ApprovalSpec is the spec of the Approval
+type ApprovalSpec struct {
+	// WorkflowRun is the name of the workflow run in the same namespace of the approval
+	WorkflowRun string `json:"workflowRun"`
+	// Step is the name of the suspended step or sub step to approve
+	Step string `json:"step"`
+	// Gate is the approval gate of the step that the decision is made for, it's required if the step has approval
+	// gates and the approver must be one of the approvers of the gate
+	Gate string `json:"gate,omitempty"`
+	// Decision is the decision of the approval, Approved or Rejected
+	// +kubebuilder:validation:Enum=Approved;Rejected
+	Decision ApprovalDecision `json:"decision,omitempty"`
+	// Reason is the reason of the decision
+	Reason string `json:"reason,omitempty"`
+	// Approver is the user who makes the decision, it's set to the user of the request by the admission webhook, and
+	// the request that sets it to another user is rejected
+	Approver string `json:"approver,omitempty"`
+	// ApproverGroups are the groups of the approver, they're set by the admission webhook with the approver
+	ApproverGroups []string `json:"approverGroups,omitempty"`
+}
+
+// ApprovalPhase is the phase of an approval
+type ApprovalPhase string
+
+const (
+	// ApprovalPhasePending means the decision is not made or the step is not suspended yet
+	ApprovalPhasePending ApprovalPhase = "pending"
+	// ApprovalPhaseApplied means the decision is applied to the workflow run
+	ApprovalPhaseApplied ApprovalPhase = "applied"
+	// ApprovalPhaseFailed means the decision can not be applied, e.g. the workflow run is finished
+	ApprovalPhaseFailed ApprovalPhase = "failed"
+)
+
+// ApprovalStatus is the status of the Approval
+type ApprovalStatus struct {
+	Phase   ApprovalPhase `json:"phase,omitempty"`
+	Message string        `json:"message,omitempty"`
+	// AppliedTime is the time when the decision is applied to the workflow run
+	AppliedTime metav1.Time `json:"appliedTime,omitempty"`
+}
@@ -21,6 +21,26 @@ const (
 	ReasonExecute = "Execute"
 	// ReasonGenerate is the reason for generating a workflow
 	ReasonGenerate = "Generate"
+	// ReasonApprove is the reason for applying an approval to a workflow
+	ReasonApprove = "Approve"
+	// ReasonWatch is the reason for suspending or terminating a workflow by the breached watcher
+	ReasonWatch = "Watch"
+	// ReasonCompletionWebhook is the reason for delivering the summary of a workflow to the completion webhook
+	ReasonCompletionWebhook = "CompletionWebhook"
+	// ReasonStepSubPhase is the reason for changing the sub phase of a running step
+	ReasonStepSubPhase = "StepSubPhase"
+	// ReasonStepMetadata is the reason for changing the metadata reported by the provider of a step
+	ReasonStepMetadata = "StepMetadata"
+	// ReasonStepFailed is the reason for a failed step of a finished workflow
+	ReasonStepFailed = "StepFailed"
+	// ReasonAudit is the reason for the audit entries of a workflow recorded in the events
+	ReasonAudit = "Audit"
+	// ReasonTeardown is the reason for tearing down the resources applied by a finished workflow
+	ReasonTeardown = "Teardown"
+	// ReasonStage is the reason for starting or finishing a stage of a workflow
+	ReasonStage = "Stage"
+	// ReasonUnknownStepType is the reason for skipping, failing or pending a step whose type can't be resolved
+	ReasonUnknownStepType = "UnknownStepType"
 )
 
 const (
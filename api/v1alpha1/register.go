@@ -50,7 +50,14 @@ var (
 	WorkflowRunGroupVersionKind = SchemeGroupVersion.WithKind(WorkflowRunKind)
 )
 
+// Approval meta
+var (
+	ApprovalKind             = "Approval"
+	ApprovalGroupVersionKind = SchemeGroupVersion.WithKind(ApprovalKind)
+)
+
 func init() {
 	SchemeBuilder.Register(&Workflow{}, &WorkflowList{})
 	SchemeBuilder.Register(&WorkflowRun{}, &WorkflowRunList{})
+	SchemeBuilder.Register(&Approval{}, &ApprovalList{})
 }
@@ -18,8 +18,10 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/kubevela/workflow/api/condition"
 )
@@ -72,19 +74,158 @@ func (w WorkflowRunList) Less(i, j int) bool {
 // WorkflowRunSpec is the spec for the WorkflowRun
 type WorkflowRunSpec struct {
 	// +kubebuilder:pruning:PreserveUnknownFields
-	Context      *runtime.RawExtension `json:"context,omitempty"`
+	Context *runtime.RawExtension `json:"context,omitempty"`
+	// InitVars is the initial variables of the context backend, which are set once before any step runs
+	// and can be used as the inputs of the steps
+	// +kubebuilder:pruning:PreserveUnknownFields
+	InitVars     *runtime.RawExtension `json:"initVars,omitempty"`
 	Mode         *WorkflowExecuteMode  `json:"mode,omitempty"`
 	WorkflowSpec *WorkflowSpec         `json:"workflowSpec,omitempty"`
 	WorkflowRef  string                `json:"workflowRef,omitempty"`
+	// IncludeSteps selects the steps to execute, the other steps are skipped. All the steps are executed if it's not set
+	IncludeSteps *StepSelector `json:"includeSteps,omitempty"`
+	// ExcludeSteps selects the steps to skip, the steps depending on the excluded steps are executed as if the
+	// excluded steps are succeeded
+	ExcludeSteps *StepSelector `json:"excludeSteps,omitempty"`
+	// FailurePolicy decides whether the failure of a step cancels the other branches in DAG mode, the default is
+	// ContinueOnFailure. The onComplete and onFailure steps are executed after the cancellation with FailFast.
+	// +kubebuilder:validation:Enum=FailFast;ContinueOnFailure
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+	// UnknownStepTypePolicy decides how the step is handled if its type can't be resolved, i.e. there's no builtin
+	// step type, template or WorkflowStepDefinition for it. The default is Fail, which fails the step, Skip skips
+	// the step, and Pending keeps the step pending until its type is registered, e.g. during the rollout of a new
+	// step type.
+	// +kubebuilder:validation:Enum=Fail;Skip;Pending
+	UnknownStepTypePolicy UnknownStepTypePolicy `json:"unknownStepTypePolicy,omitempty"`
+	// MaxRetries is the budget of the retries of all the steps in the run, the run stops retrying and fails once
+	// the cumulative retries exceed it. The default of the controller is used if it's not set, no limit if it's
+	// not positive.
+	MaxRetries *int `json:"maxRetries,omitempty"`
+	// Watchers check the signals periodically during the run, e.g. the error rate of the rollout, the run is
+	// suspended or terminated once a signal is breached
+	Watchers []RunWatcher `json:"watchers,omitempty"`
+	// CompletionWebhook is called with the summary of the run once the run is finished
+	CompletionWebhook *CompletionWebhook `json:"completionWebhook,omitempty"`
+	// Shared are the inputs shared by the steps, they're resolved once when the run is initialized and the steps
+	// read them from `shared.<name>` in their inputs. The later changes of the sources are not seen by the run, and
+	// the run fails if any of them can't be resolved.
+	Shared []SharedInput `json:"shared,omitempty"`
+	// Stages split the run into the sequential stages, each stage is executed as a WorkflowRun owned by the run
+	// once the previous stage is succeeded, and the outputs of the stage are handed off to the following stages as
+	// their init vars. The run with stages has no steps of its own, so the workflowSpec and workflowRef can't be set.
+	Stages []RunStage `json:"stages,omitempty"`
+}
+
+// RunStage is a stage of the workflow run, it's executed as a WorkflowRun named <run>-<stage>
+type RunStage struct {
+	// Name is the unique name of the stage
+	Name string `json:"name"`
+	// WorkflowRef is the workflow executed by the stage
+	WorkflowRef string `json:"workflowRef"`
+	// Outputs are the names of the outputs of the stage handed off to the following stages, the following stages
+	// read them from their init vars. The run fails if any of them is not set once the stage is succeeded.
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// SharedInput is an input shared by the steps of the workflow run
+type SharedInput struct {
+	// Name is the name of the input, the steps read it from `shared.<name>`
+	Name string `json:"name"`
+	// ConfigMapRef is the config map in the namespace of the run that the input is read from
+	ConfigMapRef *SharedInputSource `json:"configMapRef,omitempty"`
+}
+
+// SharedInputSource is the object that the shared input is read from
+type SharedInputSource struct {
+	// Name is the name of the object
+	Name string `json:"name"`
+	// Key is the key of the data to read, the whole data is read as an object if it's empty
+	Key string `json:"key,omitempty"`
+}
+
+// CompletionWebhook is the callback of the finished run, the summary of the run is posted to the url once the run
+// reaches a terminal phase. The failed deliveries are retried with backoff, and the summary is dead-lettered into
+// a config map once the retries are exhausted.
+type CompletionWebhook struct {
+	// URL is the url that the summary is posted to, the private and link-local addresses are denied unless the controller allows them
+	URL string `json:"url"`
+	// Headers are the additional headers of the request
+	Headers map[string]string `json:"headers,omitempty"`
+	// SecretRef refers to the key of the secret in the namespace of the run, the body of the request is signed
+	// with it by HMAC-SHA256 in the header X-Workflow-Signature if it's set
+	SecretRef *corev1.SecretKeySelector `json:"secretRef,omitempty"`
+	// MaxAttempts is the number of the attempts before the summary is dead-lettered, the default is 5
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+}
+
+// RunWatcher checks a signal periodically during the run and takes the action once it's breached
+type RunWatcher struct {
+	// Name is the unique name of the watcher
+	Name string `json:"name"`
+	// Type is the backend of the check, e.g. prometheus or http
+	Type string `json:"type"`
+	// Interval is the interval between the checks, the default is 30s
+	Interval string `json:"interval,omitempty"`
+	// Threshold is the number of the consecutive breaches before the action is taken, the default is 1
+	Threshold int `json:"threshold,omitempty"`
+	// Action is the action taken once the signal is breached, the default is Suspend
+	// +kubebuilder:validation:Enum=Suspend;Terminate
+	Action WatcherAction `json:"action,omitempty"`
+	// Properties is the properties of the check, which are decided by the type
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Properties *runtime.RawExtension `json:"properties,omitempty"`
+}
+
+// WatcherAction is the action taken once the signal of the watcher is breached
+type WatcherAction string
+
+const (
+	// WatcherActionSuspend suspends the run, the run can be resumed once the signal is recovered
+	WatcherActionSuspend WatcherAction = "Suspend"
+	// WatcherActionTerminate terminates the run
+	WatcherActionTerminate WatcherAction = "Terminate"
+)
+
+// FailurePolicy is the policy of the other steps when a step is failed in DAG mode
+type FailurePolicy string
+
+const (
+	// FailurePolicyFailFast cancels the unfinished steps once a step is failed after retries, the steps with
+	// `if: always` are still executed
+	FailurePolicyFailFast FailurePolicy = "FailFast"
+	// FailurePolicyContinueOnFailure executes the steps not depending on the failed step to completion
+	FailurePolicyContinueOnFailure FailurePolicy = "ContinueOnFailure"
+)
+
+// UnknownStepTypePolicy is the policy of the step whose type can't be resolved
+type UnknownStepTypePolicy string
+
+const (
+	// UnknownStepTypePolicyFail fails the step with the unknown type
+	UnknownStepTypePolicyFail UnknownStepTypePolicy = "Fail"
+	// UnknownStepTypePolicySkip skips the step with the unknown type
+	UnknownStepTypePolicySkip UnknownStepTypePolicy = "Skip"
+	// UnknownStepTypePolicyPending keeps the step with the unknown type pending until its type is registered
+	UnknownStepTypePolicyPending UnknownStepTypePolicy = "Pending"
+)
+
+// StepSelector selects the steps or sub steps by names or labels, a step is selected if it matches either of them
+type StepSelector struct {
+	// Names are the names of the selected steps
+	Names []string `json:"names,omitempty"`
+	// LabelSelector selects the steps by their labels
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
 }
 
 // WorkflowRunStatus record the status of workflow run
 type WorkflowRunStatus struct {
 	condition.ConditionedStatus `json:",inline"`
 
-	Mode    WorkflowExecuteMode `json:"mode"`
-	Phase   WorkflowRunPhase    `json:"status"`
-	Message string              `json:"message,omitempty"`
+	Mode WorkflowExecuteMode `json:"mode"`
+	// ModeOverridden indicates the mode is overridden by the annotation instead of the spec
+	ModeOverridden bool             `json:"modeOverridden,omitempty"`
+	Phase          WorkflowRunPhase `json:"status"`
+	Message        string           `json:"message,omitempty"`
 
 	Suspend      bool   `json:"suspend"`
 	SuspendState string `json:"suspendState,omitempty"`
@@ -93,20 +234,60 @@ type WorkflowRunStatus struct {
 	Finished   bool `json:"finished"`
 
 	ContextBackend *corev1.ObjectReference `json:"contextBackend,omitempty"`
-	Steps          []WorkflowStepStatus    `json:"steps,omitempty"`
-
+	// Context is the context of the run with the defaults of the workflow parameters applied, it's frozen when the
+	// run is initialized, so the changes of the parameters and the context during the run are ignored
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Context *runtime.RawExtension `json:"context,omitempty"`
+	// Metadata is the snapshot of the labels and annotations of the run taken when the run is initialized, the
+	// steps refer to it by `context.metadata`, so the changes of the labels and annotations during the run are ignored
+	Metadata *RunMetadata         `json:"metadata,omitempty"`
+	Steps    []WorkflowStepStatus `json:"steps,omitempty"`
+	// Failures is the aggregation of all the failed steps in the workflow run
+	Failures []StepFailure `json:"failures,omitempty"`
+	// Watchers is the status of the watchers of the run
+	Watchers []WatcherStatus `json:"watchers,omitempty"`
+	// CompletionWebhook is the delivery status of the completion webhook
+	CompletionWebhook *CompletionWebhookStatus `json:"completionWebhook,omitempty"`
+	// Retries is the cumulative retries of the failed steps in the run, i.e. the re-executions of the steps that have
+	// failed before, it's counted in the budget of MaxRetries
+	Retries int `json:"retries,omitempty"`
+	// Teardown is the progress of tearing down the resources applied by the run, it's set once the teardown of the
+	// finished run is requested
+	Teardown *TeardownStatus `json:"teardown,omitempty"`
+	// ExecutionOrder is the waves of the steps in the order that they're started, the steps started in the same
+	// scheduling pass are in the same wave. It's only recorded if the annotation
+	// `workflowrun.oam.dev/record-execution-order` of the run is "true".
+	ExecutionOrder []ExecutionWave `json:"executionOrder,omitempty"`
+	// Stages is the progress of the stages of the run, a stage is listed once its WorkflowRun is created
+	Stages []StageStatus `json:"stages,omitempty"`
+
+	// Custom is the custom status set by the steps, the engine-managed fields can not be changed by the steps
+	Custom map[string]apiextensionsv1.JSON `json:"custom,omitempty"`
+
+	// StartTime is the time when the run starts executing, it's set once and kept across the reconciles
 	StartTime metav1.Time `json:"startTime,omitempty"`
-	EndTime   metav1.Time `json:"endTime,omitempty"`
+	// EndTime is the time when the run is finished, it's set once and kept across the reconciles
+	EndTime metav1.Time `json:"endTime,omitempty"`
+	// Duration is the duration from the start to the end of the run, it's set when the run is finished
+	Duration *metav1.Duration `json:"duration,omitempty"`
 }
 
 // WorkflowSpec defines workflow steps and other attributes
 type WorkflowSpec struct {
 	Steps []WorkflowStep `json:"steps,omitempty"`
+	// OnComplete are the steps executed after the main steps are finished, regardless of the outcome
+	OnComplete []WorkflowStep `json:"onComplete,omitempty"`
+	// OnSuccess are the steps executed after all the main steps are succeeded or skipped
+	OnSuccess []WorkflowStep `json:"onSuccess,omitempty"`
+	// OnFailure are the steps executed after the main steps are failed or the workflow run is terminated
+	OnFailure []WorkflowStep `json:"onFailure,omitempty"`
 }
 
 // WorkflowExecuteMode defines the mode of workflow execution
 type WorkflowExecuteMode struct {
-	// Steps is the mode of workflow steps execution
+	// Steps is the mode of workflow steps execution. In StepByStep mode, a step begins only after the previous
+	// step is finished, and a step group is finished only after all of its sub steps are finished in the mode of
+	// the sub steps, so the sub steps of a group never interleave with the following steps
 	Steps WorkflowMode `json:"steps,omitempty"`
 	// SubSteps is the mode of workflow sub steps execution
 	SubSteps WorkflowMode `json:"subSteps,omitempty"`
@@ -143,10 +324,58 @@ type Workflow struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Mode         *WorkflowExecuteMode `json:"mode,omitempty"`
+	Mode *WorkflowExecuteMode `json:"mode,omitempty"`
+	// Parameters are the parameters that the runs of the workflow pass in their context, the runs with the invalid
+	// parameters are rejected when they're created, and the defaults are applied for the omitted parameters
+	Parameters   []WorkflowParameter `json:"parameters,omitempty"`
 	WorkflowSpec `json:",inline"`
 }
 
+// WorkflowParameter declares a parameter of the workflow, which is passed in the context of the run with its name as
+// the key, e.g. `context.env` in the templates
+type WorkflowParameter struct {
+	// Name is the name of the parameter
+	Name string `json:"name"`
+	// Description is the description of the parameter
+	Description string `json:"description,omitempty"`
+	// Type is the type of the parameter, the value of any type is accepted if it's empty
+	// +kubebuilder:validation:Enum=string;number;integer;boolean;object;array
+	Type ParameterType `json:"type,omitempty"`
+	// Required rejects the runs that omit the parameter
+	Required bool `json:"required,omitempty"`
+	// Default is the value applied if the parameter is omitted
+	Default *apiextensionsv1.JSON `json:"default,omitempty"`
+	// Enum is the allowed values of the parameter
+	Enum []apiextensionsv1.JSON `json:"enum,omitempty"`
+	// Pattern is the regular expression that the string value must match
+	Pattern string `json:"pattern,omitempty"`
+	// Minimum is the inclusive minimum of the number value, or the minimum length of the string and the array value
+	Minimum *int64 `json:"minimum,omitempty"`
+	// Maximum is the inclusive maximum of the number value, or the maximum length of the string and the array value
+	Maximum *int64 `json:"maximum,omitempty"`
+	// If is the CUE expression evaluated with the context of the run, e.g. `context.env == "prod"`. The parameter is
+	// only required, defaulted and validated if it's true, otherwise the parameter is ignored.
+	If string `json:"if,omitempty"`
+}
+
+// ParameterType is the type of the workflow parameter
+type ParameterType string
+
+const (
+	// ParameterTypeString is the type of the string parameter
+	ParameterTypeString ParameterType = "string"
+	// ParameterTypeNumber is the type of the number parameter
+	ParameterTypeNumber ParameterType = "number"
+	// ParameterTypeInteger is the type of the integer parameter
+	ParameterTypeInteger ParameterType = "integer"
+	// ParameterTypeBoolean is the type of the boolean parameter
+	ParameterTypeBoolean ParameterType = "boolean"
+	// ParameterTypeObject is the type of the object parameter
+	ParameterTypeObject ParameterType = "object"
+	// ParameterTypeArray is the type of the array parameter
+	ParameterTypeArray ParameterType = "array"
+)
+
 // +kubebuilder:object:root=true
 
 // WorkflowList contains a list of Workflow
@@ -162,33 +391,212 @@ type WorkflowStep struct {
 	WorkflowStepBase `json:",inline"`
 	// Mode is only valid for sub steps, it defines the mode of the sub steps
 	// +nullable
-	Mode     WorkflowMode       `json:"mode,omitempty"`
+	Mode WorkflowMode `json:"mode,omitempty"`
+	// SubSteps is the sub steps of the step group, once the group is finished, the name, phase and outputs of
+	// the sub steps are aggregated in their order into the array `<group name>.results`, which can be referenced
+	// by the inputs of the other steps
 	SubSteps []WorkflowStepBase `json:"subSteps,omitempty"`
+	// SubStepsTimeout is only valid for step groups, the group fails if the total execution time of its sub steps exceeds it.
+	// It works together with the timeouts of the group and the sub steps, and the first reached one takes effect:
+	// the timeout of a sub step only fails the sub step itself, while the timeout and the sub steps timeout of the group
+	// fail the group and all of its unfinished sub steps.
+	SubStepsTimeout string `json:"subStepsTimeout,omitempty"`
+	// Generator is only valid for step groups without sub steps, it generates the sub steps of the group from the
+	// items of an output array once the group starts
+	Generator *StepGenerator `json:"generator,omitempty"`
+	// Switch is only valid for step groups with sub steps, it executes the sub steps of the case matching its value
+	// and skips the other sub steps
+	Switch *StepSwitch `json:"switch,omitempty"`
+	// Atomic is only valid for step groups, if any sub step of the group fails, the resources applied by the sub
+	// steps are rolled back to the state captured before they were applied, the created resources are deleted
+	Atomic bool `json:"atomic,omitempty"`
+	// Periodic makes the step be executed again in every interval while the workflow run is executing
+	Periodic *StepPeriodic `json:"periodic,omitempty"`
+}
+
+// StepGenerator generates the sub steps of a step group from the items of an array
+type StepGenerator struct {
+	// From is the name of the output array, e.g. `check.failures`, a sub step is generated for each item
+	From string `json:"from"`
+	// ParameterKey is the key of the properties to fill the item in, defaults to `item`
+	ParameterKey string `json:"parameterKey,omitempty"`
+	// Template is the template of the generated sub steps, which are named `<template name>-<index of the item>`
+	Template WorkflowStepBase `json:"template"`
+	// Tolerance is the number or the percentage of the generated sub steps that are allowed to fail, the group fails
+	// once its failed sub steps exceed it. The percentage is rounded down, e.g. `10%` of 15 sub steps tolerates 1
+	// failure. The group fails on any failed sub step if it's not set.
+	Tolerance *intstr.IntOrString `json:"tolerance,omitempty"`
+}
+
+// StepSwitch selects the sub steps of a step group to execute by a value
+type StepSwitch struct {
+	// Value is the expression to select the case by, it's evaluated with the inputs, the context and the status of
+	// the steps like `if` once the group starts, e.g. `inputs.env`
+	Value string `json:"value"`
+	// Cases are the sub steps to execute for each value
+	Cases []SwitchCase `json:"cases"`
+	// Default is the names of the sub steps to execute if no case matches the value, the group fails if no case
+	// matches and there's no default
+	Default []string `json:"default,omitempty"`
+}
+
+// SwitchCase is the sub steps to execute if the value of the switch matches
+type SwitchCase struct {
+	// Value is the value to match, the value of the switch that is not a string is matched in JSON, e.g. `1`, `true`
+	Value string `json:"value"`
+	// Steps are the names of the sub steps to execute
+	Steps []string `json:"steps"`
+}
+
+// StepPeriodic defines the periodic execution of a workflow step
+type StepPeriodic struct {
+	// Interval is the interval between two executions of the step, e.g. 30s, 5m
+	Interval string `json:"interval"`
+}
+
+// ExecutionWindow defines the time ranges that a workflow step is allowed to start in
+type ExecutionWindow struct {
+	// Timezone is the IANA name of the time zone of the ranges, e.g. Asia/Shanghai, UTC is used by default
+	Timezone string `json:"timezone,omitempty"`
+	// Ranges are the allowed time ranges, the step is allowed to start if the time is in any of them
+	Ranges []TimeRange `json:"ranges"`
+}
+
+// ApprovalGate is a named gate of the suspend step that must be approved by its approvers
+type ApprovalGate struct {
+	// Name is the name of the gate, e.g. security, which is referenced by the gate of the Approval
+	Name string `json:"name"`
+	// Approvers are the identities that are allowed to approve the gate, which are matched against the user and the
+	// groups of the approver of the Approval, e.g. the members of a team, the group of a team or
+	// system:serviceaccount:<namespace>:<name>. Anyone can approve the gate if it's empty. The approvers can only be
+	// verified with the admission webhook enabled, which sets the approver from the user of the request.
+	Approvers []string `json:"approvers,omitempty"`
+	// Quorum is the number of the distinct approvers that are required to approve the gate, default is 1
+	Quorum int `json:"quorum,omitempty"`
+}
+
+// TimeRange is a range of the time of the day
+type TimeRange struct {
+	// Days are the days of the week that the range starts on, e.g. Mon, Tue, the range applies to every day if empty
+	Days []string `json:"days,omitempty"`
+	// Start is the start of the range in the format of HH:MM, e.g. 22:00
+	Start string `json:"start"`
+	// End is the end of the range in the format of HH:MM, the range ends on the next day if it's not after the start,
+	// e.g. 22:00-02:00
+	End string `json:"end"`
 }
 
 // WorkflowStepMeta contains the meta data of a workflow step
 type WorkflowStepMeta struct {
 	Alias string `json:"alias,omitempty"`
+	// Description describes what the step does, it's shown in the status and the events of the step
+	Description string `json:"description,omitempty"`
+	// Docs is the url of the documentation of the step, e.g. the runbook of the shared step
+	Docs string `json:"docs,omitempty"`
+}
+
+// DependsOnCondition defines the grouped dependency of a workflow step,
+// only one of Step, AllOf and AnyOf can be set.
+type DependsOnCondition struct {
+	// Step is the name of the step depended on
+	Step string `json:"step,omitempty"`
+	// AllOf is satisfied when all of the conditions are satisfied
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	AllOf []DependsOnCondition `json:"allOf,omitempty"`
+	// AnyOf is satisfied when any of the conditions is satisfied
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	AnyOf []DependsOnCondition `json:"anyOf,omitempty"`
+	// IgnoreFailure makes the condition of Step satisfied once the step is finished in any phase instead of succeeded,
+	// it's used to order the steps without depending on their success, e.g. run the cleanup after the deploy
+	IgnoreFailure bool `json:"ignoreFailure,omitempty"`
+}
+
+// StepNames returns the names of all the steps referred in the condition
+func (c *DependsOnCondition) StepNames() []string {
+	if c == nil {
+		return nil
+	}
+	var names []string
+	if c.Step != "" {
+		names = append(names, c.Step)
+	}
+	for i := range c.AllOf {
+		names = append(names, c.AllOf[i].StepNames()...)
+	}
+	for i := range c.AnyOf {
+		names = append(names, c.AnyOf[i].StepNames()...)
+	}
+	return names
 }
 
 // WorkflowStepBase defines the workflow step base
 type WorkflowStepBase struct {
 	// Name is the unique name of the workflow step.
+	// The name, type and dependsOn can be rendered by the cue string interpolation before the steps are generated,
+	// e.g. `deploy-\(context.env)`, the context of the workflow run and the properties of the step can be referenced
+	// by `context` and `parameter`.
 	Name string `json:"name,omitempty"`
 	// Type is the type of the workflow step.
 	Type string `json:"type"`
 	// Meta is the meta data of the workflow step.
 	Meta *WorkflowStepMeta `json:"meta,omitempty"`
+	// Labels is the labels of the step, which can be used to select the steps in operations
+	Labels map[string]string `json:"labels,omitempty"`
 	// If is the if condition of the step
 	If string `json:"if,omitempty"`
+	// PreCondition is the condition that must be met before the step starts. Unlike the If condition that skips
+	// the step which is not applicable, the step is failed if its precondition is not met.
+	PreCondition string `json:"preCondition,omitempty"`
 	// Timeout is the timeout of the step
 	Timeout string `json:"timeout,omitempty"`
+	// OperationTimeout is the timeout of each execution of the step, which bounds the calls of the providers such as the
+	// http requests. The timed out execution fails and is retried in the next reconcile, until the step is failed
+	// after retries or the step timeout is reached, so it should be shorter than the step timeout.
+	OperationTimeout string `json:"operationTimeout,omitempty"`
 	// DependsOn is the dependency of the step
 	DependsOn []string `json:"dependsOn,omitempty"`
+	// DependsOnCondition is the grouped dependency of the step, it's required together with DependsOn
+	DependsOnCondition *DependsOnCondition `json:"dependsOnCondition,omitempty"`
 	// Inputs is the inputs of the step
 	Inputs StepInputs `json:"inputs,omitempty"`
+	// RerenderOnRetry re-resolves the inputs and re-renders the properties of the step against the current context on
+	// each retry after the failure, and the retry fails if an input is from a step that has failed since it was
+	// resolved. Otherwise the retries reuse the inputs resolved by the attempt that failed first.
+	RerenderOnRetry bool `json:"rerenderOnRetry,omitempty"`
 	// Outputs is the outputs of the step
 	Outputs StepOutputs `json:"outputs,omitempty"`
+	// StatusMessage is the message of the step when it's succeeded, the template expressions in it are rendered
+	// by the outputs of the step, e.g. `Deployed version {{ output.version }}`
+	StatusMessage string `json:"statusMessage,omitempty"`
+	// ServiceAccount is the name of the service account in the namespace of the workflow run, the providers of the step
+	// impersonate it to operate the resources instead of using the identity of the controller
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Cluster is the cluster that the providers of the step operate the resources in if the cluster is not set in
+	// their parameters. The sub steps inherit the cluster of the step group unless they set their own, so the
+	// precedence is sub step > step group > the default cluster of the workflow run, i.e. the local cluster.
+	Cluster string `json:"cluster,omitempty"`
+	// Lock is the name of the run-scoped lock held by the step while it's running, the steps declaring the same
+	// lock never run concurrently even in DAG mode, and the waiting step is pending until the lock is released.
+	// The lock of a step group is held until its sub steps are finished, so the sub steps of a locked step group
+	// can't declare any lock, otherwise two groups holding each other's locks would deadlock. Every step holds at
+	// most one lock at a time, so the locks can't deadlock each other.
+	Lock string `json:"lock,omitempty"`
+	// ExecutionWindow is the time of the day that the step is allowed to start in, e.g. the maintenance window of the
+	// production changes. The step is pending outside the window until the window opens, while the started step is
+	// not interrupted when the window closes.
+	ExecutionWindow *ExecutionWindow `json:"executionWindow,omitempty"`
+	// ApprovalGates is only valid for the suspend steps, the step is resumed by the Approvals only after all of its
+	// gates are approved, e.g. a high-risk change is signed off by both the security and the platform teams.
+	// The step keeps suspending while some gates are still waiting for their approvals.
+	ApprovalGates []ApprovalGate `json:"approvalGates,omitempty"`
+	// DetectChanges compares the outputs of the step with the outputs of the same names of the step in the last
+	// finished succeeded run of the same workflow once the step is succeeded. The result is set in the metadata of the
+	// step as `changed` and `diff`, so the downstream steps can be gated by `status.<step>.changed`, e.g. only notify
+	// when the rendered config is changed. The outputs are changed if there's no previous succeeded run or the run has
+	// no workflowRef.
+	DetectChanges bool `json:"detectChanges,omitempty"`
 
 	// Properties is the properties of the step
 	// +kubebuilder:pruning:PreserveUnknownFields
@@ -211,22 +619,230 @@ type StepStatus struct {
 	Name  string            `json:"name,omitempty"`
 	Type  string            `json:"type,omitempty"`
 	Phase WorkflowStepPhase `json:"phase,omitempty"`
+	// SubPhase is the intermediate state reported by the provider while the step is running, e.g. uploading or
+	// verifying. It's advisory and only shown in the status and events, the scheduling of the steps doesn't
+	// depend on it.
+	SubPhase string `json:"subPhase,omitempty"`
+	// ContinuationToken is issued by the provider of the step for its long operation, e.g. the handle of the async
+	// operation of a cloud API. It's passed back to the provider in the next executions of the step so that the
+	// provider polls the operation instead of starting a new one, and it's cleared once the step is finished.
+	ContinuationToken string `json:"continuationToken,omitempty"`
+	// Attempt is the number of the previous executions of the step in the run, e.g. the periodic step is executed
+	// again in every interval. The retries of a failed execution are in the same attempt, and the attempt is part
+	// of the idempotency token passed to the provider of the step.
+	Attempt int `json:"attempt,omitempty"`
+	// Metadata is the informational data reported by the provider of the step for the operators, e.g. the URL of
+	// the external job or the UID of the created resource. Unlike the outputs, it can't be referenced by the inputs
+	// of the other steps.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// OutputFingerprints are the fingerprints of the outputs of the step with detectChanges keyed by the names of
+	// the outputs, the later runs of the same workflow compare their outputs with them to detect the changes
+	OutputFingerprints map[string]string `json:"outputFingerprints,omitempty"`
+	// Approvals are the decisions applied to the approval gates of the suspend step
+	Approvals []StepApproval `json:"approvals,omitempty"`
+	// FailedSubSteps is only set for the step groups with the failure tolerance, it's the number of their sub steps
+	// that are failed and won't be retried
+	FailedSubSteps int `json:"failedSubSteps,omitempty"`
+	// Rollback is only set for the failed atomic step groups, it's the result of rolling back the resources applied
+	// by their sub steps
+	Rollback *StepRollbackStatus `json:"rollback,omitempty"`
 	// A human readable message indicating details about why the workflowStep is in this state.
 	Message string `json:"message,omitempty"`
 	// A brief CamelCase message indicating details about why the workflowStep is in this state.
 	Reason string `json:"reason,omitempty"`
+	// Description is the description in the meta of the step
+	Description string `json:"description,omitempty"`
+	// Docs is the url of the documentation in the meta of the step
+	Docs string `json:"docs,omitempty"`
 	// FirstExecuteTime is the first time this step execution.
 	FirstExecuteTime metav1.Time `json:"firstExecuteTime,omitempty"`
 	// LastExecuteTime is the last time this step execution.
 	LastExecuteTime metav1.Time `json:"lastExecuteTime,omitempty"`
 }
 
+// DisplayPhase returns the phase of the step with the sub phase if the step is running, e.g. running (verifying)
+func (s StepStatus) DisplayPhase() string {
+	if s.Phase != WorkflowStepPhaseRunning || s.SubPhase == "" {
+		return string(s.Phase)
+	}
+	return string(s.Phase) + " (" + s.SubPhase + ")"
+}
+
+// StepApproval is a decision applied to an approval gate of the suspend step
+type StepApproval struct {
+	// Gate is the name of the approval gate
+	Gate string `json:"gate"`
+	// Approver is the one who makes the decision
+	Approver string `json:"approver"`
+	// Decision is Approved or Rejected
+	Decision ApprovalDecision `json:"decision"`
+	// Time is the time when the decision is applied
+	Time metav1.Time `json:"time,omitempty"`
+}
+
+// StepRollbackStatus is the result of rolling back the resources applied by the sub steps of an atomic step group
+type StepRollbackStatus struct {
+	// Phase is succeeded if all the resources are rolled back, otherwise failed
+	Phase WorkflowStepPhase `json:"phase"`
+	// Resources are the rolled back resources in the reverse order that they were applied
+	Resources []RolledBackResource `json:"resources,omitempty"`
+}
+
+// RolledBackResource is a resource rolled back by an atomic step group
+type RolledBackResource struct {
+	// Step is the name of the sub step that applied the resource
+	Step       string `json:"step,omitempty"`
+	Cluster    string `json:"cluster,omitempty"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Action is Deleted if the resource was created by the group, Reverted if it was restored to its previous state, or Skipped if its previous state was not captured
+	Action string `json:"action"`
+	// Error is the reason why the resource failed to be rolled back
+	Error string `json:"error,omitempty"`
+}
+
+// WatcherStatus is the status of the watcher of the run
+type WatcherStatus struct {
+	// Name is the name of the watcher
+	Name string `json:"name"`
+	// Breaches is the number of the consecutive breaches of the signal
+	Breaches int `json:"breaches,omitempty"`
+	// Message is the result of the last check
+	Message string `json:"message,omitempty"`
+	// LastCheckTime is the time of the last check
+	LastCheckTime metav1.Time `json:"lastCheckTime,omitempty"`
+}
+
+// RunMetadata is the snapshot of the labels and annotations of the run
+type RunMetadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// CompletionWebhookStatus is the delivery status of the completion webhook, the result of the delivery is
+// recorded in the CompletionWebhookDelivered condition
+type CompletionWebhookStatus struct {
+	// Attempts is the number of the failed attempts
+	Attempts int `json:"attempts,omitempty"`
+	// LastAttemptTime is the time of the last attempt
+	LastAttemptTime metav1.Time `json:"lastAttemptTime,omitempty"`
+}
+
+// TeardownResourcePhase is the phase of a resource in the teardown
+type TeardownResourcePhase string
+
+const (
+	// TeardownResourcePending means the resource waits for the resources applied after it to be deleted
+	TeardownResourcePending TeardownResourcePhase = "pending"
+	// TeardownResourceDeleting means the resource is being deleted
+	TeardownResourceDeleting TeardownResourcePhase = "deleting"
+	// TeardownResourceDeleted means the resource is gone
+	TeardownResourceDeleted TeardownResourcePhase = "deleted"
+)
+
+// TeardownStatus is the progress of tearing down the resources applied by the run, the resources are deleted one by
+// one in the reverse order that they were applied
+type TeardownStatus struct {
+	// Phase is running until all the resources are deleted, then succeeded
+	Phase WorkflowStepPhase `json:"phase"`
+	// Resources are the applied resources in the reverse order that they were applied
+	Resources []TeardownResource `json:"resources,omitempty"`
+	// Truncated is true if the inventory of the run reached its max size, the resources applied beyond it are not
+	// torn down
+	Truncated bool `json:"truncated,omitempty"`
+	// StartTime is the time when the teardown starts
+	StartTime metav1.Time `json:"startTime,omitempty"`
+	// EndTime is the time when all the resources are deleted
+	EndTime metav1.Time `json:"endTime,omitempty"`
+}
+
+// StageStatus is the status of a stage of the workflow run
+type StageStatus struct {
+	// Name is the name of the stage
+	Name string `json:"name"`
+	// Run is the name of the WorkflowRun of the stage
+	Run string `json:"run"`
+	// Phase is the phase of the WorkflowRun of the stage
+	Phase WorkflowRunPhase `json:"phase,omitempty"`
+	// Message is the message of the WorkflowRun of the stage
+	Message string `json:"message,omitempty"`
+}
+
+// TeardownResource is a resource applied by the run to tear down
+type TeardownResource struct {
+	// Step is the name of the step that applied the resource
+	Step string `json:"step,omitempty"`
+	// ServiceAccount is the service account of the step that applied the resource, the resource is deleted by it
+	ServiceAccount string                `json:"serviceAccount,omitempty"`
+	Cluster        string                `json:"cluster,omitempty"`
+	APIVersion     string                `json:"apiVersion"`
+	Kind           string                `json:"kind"`
+	Namespace      string                `json:"namespace,omitempty"`
+	Name           string                `json:"name"`
+	Phase          TeardownResourcePhase `json:"phase"`
+	// Message is the reason why the resource can't be deleted yet, e.g. the error of the deletion
+	Message string `json:"message,omitempty"`
+}
+
+// ExecutionWave is the steps started together in a scheduling pass of the run, the steps in a wave of DAG mode run
+// in parallel, while a wave of StepByStep mode has only one step
+type ExecutionWave struct {
+	// StartTime is the time when the wave is started
+	StartTime metav1.Time `json:"startTime,omitempty"`
+	// Parent is the step group of the sub steps in the wave, it's empty for the main steps
+	Parent string              `json:"parent,omitempty"`
+	Steps  []ExecutionWaveStep `json:"steps,omitempty"`
+}
+
+// ExecutionWaveStep is a step started in the wave, the id tells the executions of the restarted or periodic step apart
+type ExecutionWaveStep struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// WorkflowRunSummary is the summary of the finished run posted to the completion webhook
+type WorkflowRunSummary struct {
+	Name      string           `json:"name"`
+	Namespace string           `json:"namespace"`
+	UID       string           `json:"uid"`
+	Phase     WorkflowRunPhase `json:"phase"`
+	Message   string           `json:"message,omitempty"`
+	StartTime metav1.Time      `json:"startTime,omitempty"`
+	EndTime   metav1.Time      `json:"endTime,omitempty"`
+	// Duration is the duration from the start to the end of the run
+	Duration string `json:"duration,omitempty"`
+	// Steps are the final status of the steps, the status of the sub steps are included
+	Steps []WorkflowStepStatus `json:"steps,omitempty"`
+	// Failures are the failed steps of the run
+	Failures []StepFailure `json:"failures,omitempty"`
+	// Custom is the custom status set by the steps
+	Custom map[string]apiextensionsv1.JSON `json:"custom,omitempty"`
+	// CriticalPath are the names of the steps on the critical path of the run, i.e. the chain of the dependent steps
+	// with the longest total duration, which determines the duration of the run
+	CriticalPath []string `json:"criticalPath,omitempty"`
+	// CriticalPathDuration is the total duration of the steps on the critical path
+	CriticalPathDuration string `json:"criticalPathDuration,omitempty"`
+	// CriticalPathInferred is true if the critical path is inferred from the timings of the steps, i.e. the run in
+	// DAG mode refers to a workflow, so it's a heuristic
+	CriticalPathInferred bool `json:"criticalPathInferred,omitempty"`
+}
+
 // WorkflowStepStatus record the status of a workflow step, include step status and subStep status
 type WorkflowStepStatus struct {
 	StepStatus     `json:",inline"`
 	SubStepsStatus []StepStatus `json:"subSteps,omitempty"`
 }
 
+// StepFailure records the failure of a workflow step
+type StepFailure struct {
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
 // SetConditions set condition to workflow run
 func (wr *WorkflowRun) SetConditions(c ...condition.Condition) {
 	wr.Status.SetConditions(c...)
@@ -240,6 +856,72 @@ func (wr *WorkflowRun) GetCondition(t condition.ConditionType) condition.Conditi
 // WorkflowRunConditionType is a valid condition type for a WorkflowRun
 const WorkflowRunConditionType string = "WorkflowRun"
 
+// WorkflowRunContextBackendConditionType is the condition type that indicates the context backend is unavailable, it's
+// True when the workflow context fails to initialize or commit, and False once the context is committed again
+const WorkflowRunContextBackendConditionType string = "ContextBackendUnavailable"
+
+// WorkflowRunPermissionsConditionType is the condition type that indicates whether the controller is allowed to access
+// the resources rendered by the steps, it's checked once before the steps run if the permission check is enabled
+const WorkflowRunPermissionsConditionType string = "PermissionsChecked"
+
+// The lifecycle condition types of a WorkflowRun, users can wait on them, e.g. `kubectl wait --for=condition=Progressing`.
+const (
+	// WorkflowRunValidatedConditionType is True once the workflow and its steps are generated from the spec,
+	// and False with the error as message when the generation fails. It turns True again after the spec is fixed.
+	WorkflowRunValidatedConditionType string = "Validated"
+	// WorkflowRunProgressingConditionType is True while the workflow is executing its steps, and False with the reason
+	// Suspended, Succeeded, Failed or Terminated once the workflow suspends or finishes. It turns True again after resuming.
+	WorkflowRunProgressingConditionType string = "Progressing"
+	// WorkflowRunDegradedConditionType is True while any step is failed, and False once no step is failed,
+	// e.g. the failed steps succeed after retries.
+	WorkflowRunDegradedConditionType string = "Degraded"
+	// WorkflowRunStalledConditionType is True when the workflow can not make progress without intervention, that is,
+	// it's failed or suspended after the failed times of the steps reach the limit. It turns False after resuming.
+	WorkflowRunStalledConditionType string = "Stalled"
+	// WorkflowRunCompletionWebhookConditionType is True once the summary of the finished run is delivered to the
+	// completion webhook, and False with the reason DeliveryFailed while retrying or DeadLettered once the retries
+	// are exhausted.
+	WorkflowRunCompletionWebhookConditionType string = "CompletionWebhookDelivered"
+	// WorkflowRunPausedConditionType is True while the controller is paused for maintenance, the steps that are not
+	// started are held in place and the in-flight steps are allowed to finish. It turns False once the controller is
+	// resumed.
+	WorkflowRunPausedConditionType string = "Paused"
+)
+
+// The reasons of the lifecycle conditions of a WorkflowRun.
+const (
+	// ReasonExecuting is the reason of Progressing when the workflow is executing
+	ReasonExecuting condition.ConditionReason = "Executing"
+	// ReasonSuspended is the reason of Progressing when the workflow is suspended
+	ReasonSuspended condition.ConditionReason = "Suspended"
+	// ReasonSucceeded is the reason of Progressing when the workflow is succeeded
+	ReasonSucceeded condition.ConditionReason = "Succeeded"
+	// ReasonFailed is the reason of Progressing and Stalled when the workflow is failed
+	ReasonFailed condition.ConditionReason = "Failed"
+	// ReasonTerminated is the reason of Progressing when the workflow is terminated
+	ReasonTerminated condition.ConditionReason = "Terminated"
+	// ReasonStepsFailed is the reason of Degraded when some steps are failed
+	ReasonStepsFailed condition.ConditionReason = "StepsFailed"
+	// ReasonStepsHealthy is the reason of Degraded when no step is failed
+	ReasonStepsHealthy condition.ConditionReason = "StepsHealthy"
+	// ReasonSuspendedOnFailure is the reason of Stalled when the workflow is suspended after the failed times of the steps reach the limit
+	ReasonSuspendedOnFailure condition.ConditionReason = "SuspendedOnFailure"
+	// ReasonDelivered is the reason of CompletionWebhookDelivered when the summary is delivered
+	ReasonDelivered condition.ConditionReason = "Delivered"
+	// ReasonDeliveryFailed is the reason of CompletionWebhookDelivered when the delivery failed and will be retried
+	ReasonDeliveryFailed condition.ConditionReason = "DeliveryFailed"
+	// ReasonDeadLettered is the reason of CompletionWebhookDelivered when the summary is dead-lettered
+	ReasonDeadLettered condition.ConditionReason = "DeadLettered"
+	// ReasonPermissionsAllowed is the reason of PermissionsChecked when the controller is allowed to access the resources
+	ReasonPermissionsAllowed condition.ConditionReason = "PermissionsAllowed"
+	// ReasonPermissionsMissing is the reason of PermissionsChecked when the controller is missing the permissions
+	ReasonPermissionsMissing condition.ConditionReason = "PermissionsMissing"
+	// ReasonControllerPaused is the reason of Paused when the controller is paused
+	ReasonControllerPaused condition.ConditionReason = "ControllerPaused"
+	// ReasonControllerResumed is the reason of Paused when the controller is resumed
+	ReasonControllerResumed condition.ConditionReason = "ControllerResumed"
+)
+
 // WorkflowStepPhase describes the phase of a workflow step.
 type WorkflowStepPhase string
 
@@ -267,11 +949,68 @@ type StepInputs []InputItem
 // InputItem defines an input variable of WorkflowStep
 type InputItem struct {
 	ParameterKey string `json:"parameterKey,omitempty"`
-	From         string `json:"from"`
+	// From is the path of the variable to read, `self.previous.<output>` refers to the output
+	// of the last completed execution of the step itself, which is empty on the first run
+	From string `json:"from"`
+	// Lazy doesn't wait for the input to start the step, the input is resolved each time the step is executed.
+	// The parameter of the unresolved input is unavailable rather than its default value, the step waits for it
+	// before any provider runs if the providers read it, and the step fails if it's still unavailable when the
+	// step is about to succeed
+	Lazy bool `json:"lazy,omitempty"`
 }
 
 // OutputItem defines an output variable of WorkflowStep
 type OutputItem struct {
 	ValueFrom string `json:"valueFrom"`
 	Name      string `json:"name"`
+	// Retention is how long the output is kept in the workflow context, defaults to Run
+	// +kubebuilder:validation:Enum=Run;Consumed
+	Retention OutputRetention `json:"retention,omitempty"`
+	// Sensitive redacts the value of the output in the step status and the debug dumps, the value is still
+	// available for the inputs of the other steps and stored in the context backend
+	Sensitive bool `json:"sensitive,omitempty"`
+	// Pipeline is the ordered stages to transform the value read from valueFrom, the result of a stage is the
+	// input of the next one, e.g. decode the base64, parse the JSON and extract a field
+	Pipeline []OutputTransform `json:"pipeline,omitempty"`
 }
+
+// OutputTransform is a stage of the pipeline of an output, either a builtin transform or a CUE expression
+type OutputTransform struct {
+	// Name is the name of the stage shown in the errors, defaults to the transform or `expression`
+	Name string `json:"name,omitempty"`
+	// Transform is the builtin transform of the stage
+	// +kubebuilder:validation:Enum=base64Decode;base64Encode;jsonParse;jsonStringify;yamlParse;trim
+	Transform OutputTransformType `json:"transform,omitempty"`
+	// Expression is the CUE expression of the stage, the input of the stage is referenced as `value`,
+	// e.g. `value.data.token`
+	Expression string `json:"expression,omitempty"`
+}
+
+// OutputTransformType is the builtin transform of a stage of the output pipeline
+type OutputTransformType string
+
+const (
+	// OutputTransformBase64Decode decodes the base64 string
+	OutputTransformBase64Decode OutputTransformType = "base64Decode"
+	// OutputTransformBase64Encode encodes the string in base64
+	OutputTransformBase64Encode OutputTransformType = "base64Encode"
+	// OutputTransformJSONParse parses the JSON string
+	OutputTransformJSONParse OutputTransformType = "jsonParse"
+	// OutputTransformJSONStringify marshals the value to a JSON string
+	OutputTransformJSONStringify OutputTransformType = "jsonStringify"
+	// OutputTransformYAMLParse parses the YAML string
+	OutputTransformYAMLParse OutputTransformType = "yamlParse"
+	// OutputTransformTrim trims the leading and trailing white spaces of the string
+	OutputTransformTrim OutputTransformType = "trim"
+)
+
+// OutputRetention is the retention of an output in the workflow context
+type OutputRetention string
+
+const (
+	// OutputRetentionRun keeps the output in the workflow context for the lifetime of the run
+	OutputRetentionRun OutputRetention = "Run"
+	// OutputRetentionConsumed prunes the output from the workflow context once all the steps that take it as input
+	// are succeeded or skipped
+	OutputRetentionConsumed OutputRetention = "Consumed"
+)
@@ -18,6 +18,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	goflag "flag"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/crossplane/crossplane-runtime/pkg/event"
@@ -36,14 +38,19 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apiserver/pkg/util/feature"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	"k8s.io/klog/v2/klogr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/yaml"
 
 	triggerv1alpha1 "github.com/kubevela/kube-trigger/api/v1alpha1"
 	velaclient "github.com/kubevela/pkg/controller/client"
@@ -51,11 +58,20 @@ import (
 
 	"github.com/kubevela/workflow/api/v1alpha1"
 	"github.com/kubevela/workflow/controllers"
+	"github.com/kubevela/workflow/pkg/audit"
 	"github.com/kubevela/workflow/pkg/backup"
+	"github.com/kubevela/workflow/pkg/callback"
 	"github.com/kubevela/workflow/pkg/common"
+	"github.com/kubevela/workflow/pkg/debug"
 	"github.com/kubevela/workflow/pkg/features"
+	"github.com/kubevela/workflow/pkg/generator"
+	"github.com/kubevela/workflow/pkg/monitor/metrics"
 	"github.com/kubevela/workflow/pkg/monitor/watcher"
+	"github.com/kubevela/workflow/pkg/objectwatch"
 	"github.com/kubevela/workflow/pkg/providers"
+	"github.com/kubevela/workflow/pkg/providers/external"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/tasks"
 	"github.com/kubevela/workflow/pkg/types"
 	"github.com/kubevela/workflow/pkg/utils"
 	"github.com/kubevela/workflow/pkg/webhook"
@@ -69,6 +85,9 @@ var (
 	waitSecretInterval = 2 * time.Second
 )
 
+// queueDepthPath is the path of the check on the depth of the work queue served on the metrics endpoint
+const queueDepthPath = "/queue-depth"
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
@@ -77,17 +96,28 @@ func init() {
 }
 
 func main() {
-	var metricsAddr, logFilePath, probeAddr, pprofAddr, leaderElectionResourceLock, userAgent, certDir string
+	var metricsAddr, logFilePath, probeAddr, pprofAddr, leaderElectionResourceLock, userAgent, certDir, pauseConfigMap, auditSink string
 	var backupStrategy, backupIgnoreStrategy, backupPersistType, groupByLabel, backupConfigSecretName, backupConfigSecretNamespace string
-	var enableLeaderElection, useWebhook, logDebug, backupCleanOnBackup bool
+	var snapshotRun, planRun, criticalPathRun, findRunsResource string
+	var enableLeaderElection, useWebhook, logDebug, backupCleanOnBackup, listStepTypes, completionWebhookAllowPrivate bool
 	var qps float64
 	var logFileMaxSize uint64
 	var burst, webhookPort int
 	var leaseDuration, renewDeadline, retryPeriod, recycleDuration time.Duration
+	var metricsRunLabels, stepMetrics []string
 	var controllerArgs controllers.Args
+	var shardArgs controllers.ShardArgs
+	var queueDepthArgs controllers.QueueDepthArgs
+	var tenantArgs controllers.TenantArgs
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.StringSliceVar(&metricsRunLabels, "metrics-run-labels", nil, fmt.Sprintf("The keys of the workflowrun labels promoted to the labels of the workflowrun phase and finished time metrics, e.g. team,cost-center. At most %d keys are allowed to bound the cardinality of the metrics.", metrics.MaxRunLabelKeys))
+	flag.StringArrayVar(&stepMetrics, "step-metrics", nil, "The custom metric that the steps can emit in the format of name:type[:label,...], e.g. records_processed:counter:source,region. The type is counter or gauge, the metric is exposed with the prefix "+metrics.StepMetricPrefix+" and only the declared labels can be recorded. It can be repeated to register more metrics, the metrics that are not registered are rejected.")
+	flag.IntVar(&metrics.MaxStepMetricSeries, "step-metrics-max-series", 100, "The max number of the label values of each custom step metric, the new label values are rejected once the metric reaches the limit")
+	flag.DurationVar(&metrics.StepMetricSeriesIdleTimeout, "step-metrics-series-idle-timeout", time.Hour, "The duration after which the label values of the custom step metric that are not recorded are released once the metric reaches the max series, default is 1h")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.IntVar(&queueDepthArgs.Threshold, "queue-depth-threshold", 0, "The max number of the pending reconciles of the workflowruns, the check "+queueDepthPath+" on the metrics endpoint fails once the depth of the work queue stays above it for the queue-depth-period. Disabled if it's not positive, default is 0")
+	flag.DurationVar(&queueDepthArgs.Period, "queue-depth-period", time.Minute, "How long the depth of the work queue must stay above the queue-depth-threshold before the check "+queueDepthPath+" fails, default is 1m")
 	flag.StringVar(&logFilePath, "log-file-path", "", "The file to write logs to.")
 	flag.Uint64Var(&logFileMaxSize, "log-file-max-size", 1024, "Defines the maximum size a log file can grow to, Unit is megabytes.")
 	flag.BoolVar(&logDebug, "log-debug", false, "Enable debug logs for development purpose")
@@ -109,6 +139,10 @@ func main() {
 	flag.IntVar(&webhookPort, "webhook-port", 9443, "admission webhook listen address")
 	flag.IntVar(&controllerArgs.ConcurrentReconciles, "concurrent-reconciles", 4, "concurrent-reconciles is the concurrent reconcile number of the controller. The default value is 4")
 	flag.BoolVar(&controllerArgs.IgnoreWorkflowWithoutControllerRequirement, "ignore-workflow-without-controller-requirement", false, "If true, workflow controller will not process the workflowrun without 'workflowrun.oam.dev/controller-version-require' annotation")
+	flag.BoolVar(&controllerArgs.Paused, "paused", false, "If true, workflow controller is paused for maintenance, the steps of the workflowruns that are not started are held and the in-flight steps are allowed to finish")
+	flag.StringVar(&controllerArgs.SystemDefinitionNamespace, "system-definition-namespace", "vela-system", "The namespace of the system step definitions, the admission webhook looks up the step types in it besides the namespace of the workflowrun")
+	flag.StringVar(&auditSink, "audit-sink", "", "The sink to record the audit entries of the executed steps, the finished workflowruns and the applied approvals. Set it to `event` to record the entries in the events of the workflowruns, which are best effort, or `file:<path>` to append the entries in JSON lines to the file, e.g. on a persistent volume. The audit is disabled if it's empty")
+	flag.StringVar(&pauseConfigMap, "pause-config-map", "", "The <namespace>/<name> of the config map to pause the workflow controller at runtime by setting `paused: \"true\"` in its data. If empty, the controller can only be paused by the flag.")
 	flag.Float64Var(&qps, "kube-api-qps", 50, "the qps for reconcile clients. Low qps may lead to low throughput. High qps may give stress to api-server. Raise this value if concurrent-reconciles is set to be high.")
 	flag.IntVar(&burst, "kube-api-burst", 100, "the burst for reconcile clients. Recommend setting it qps*2.")
 	flag.StringVar(&userAgent, "user-agent", "vela-workflow", "the user agent of the client.")
@@ -116,6 +150,17 @@ func main() {
 	flag.IntVar(&types.MaxWorkflowWaitBackoffTime, "max-workflow-wait-backoff-time", 60, "Set the max workflow wait backoff time, default is 60")
 	flag.IntVar(&types.MaxWorkflowFailedBackoffTime, "max-workflow-failed-backoff-time", 300, "Set the max workflow wait backoff time, default is 300")
 	flag.IntVar(&types.MaxWorkflowStepErrorRetryTimes, "max-workflow-step-error-retry-times", 10, "Set the max workflow step error retry times, default is 10")
+	flag.IntVar(&types.MaxWorkflowRunRetries, "max-workflow-run-retries", 0, "Set the default budget of the retries of all the steps in a workflow run, the workflow run fails once it's exceeded. It can be overridden by the maxRetries of the workflow run. No limit if it's not positive, default is 0")
+	flag.IntVar(&types.MaxWorkflowSteps, "max-workflow-steps", 1000, "Set the max number of steps including sub steps in a workflow run, the workflow run fails if it's exceeded. No limit if it's not positive, default is 1000")
+	flag.IntVar(&types.MaxInlineOutputSize, "max-inline-output-size", 65536, "Set the max size in bytes of a step output stored inline in the context vars, the larger output is spilled into a separate ConfigMap owned by the context backend. No limit if it's not positive, default is 65536")
+	flag.IntVar(&types.MaxStepMetadataSize, "max-step-metadata-size", 4096, "Set the max total size in bytes of the metadata reported by the providers of a step, the entries beyond it are dropped. No limit if it's not positive, default is 4096")
+	flag.IntVar(&types.MaxInventorySize, "max-inventory-size", 500, "Set the max number of the resources recorded in the inventory of a workflow run for the teardown, the resources applied beyond it are not torn down. No limit if it's not positive, default is 500")
+	flag.IntVar(&types.MaxProviderTraceCalls, "max-provider-trace-calls", 500, "Set the max number of the calls of the providers recorded by the provider trace of a workflow run, the calls beyond it are not recorded and can not be replayed. No limit if it's not positive, default is 500")
+	flag.IntVar(&objectwatch.MaxWatches, "max-object-watches", 1000, "Set the max number of the resources watched at once for the wait-for steps, the steps waiting for the other resources read them every time the workflow run is reconciled. No limit if it's not positive, default is 1000")
+	flag.BoolVar(&types.PruneFinishedStepStatus, "prune-finished-step-status", false, "Prune the finished steps in the status of the workflow runs to their id, name, phase and reason to reduce the size of the runs. The full status is archived in the workflow context and restored on demand, default is false")
+	flag.DurationVar(&types.StatusUpdateDebounce, "status-update-debounce", 0, "Set the interval to coalesce the status updates of the steps of a workflow run when the status is patched at once by the feature gate EnablePatchStatusAtOnce, the updates are written by a single writer of the run and flushed when the run is finished or suspended. Disabled if it's not positive, default is 0")
+	flag.BoolVar(&completionWebhookAllowPrivate, "completion-webhook-allow-private-addresses", false, "Allow the completion webhooks to connect to the loopback, private and link-local addresses, e.g. the services in the cluster. Denied by default so that the webhooks can't reach the internal endpoints")
+	flag.IntVar(&types.MaxContextBackendRetryTimes, "max-context-backend-retry-times", 10, "Set the max retry times of the workflow step when the context backend is unavailable, default is 10")
 	flag.StringVar(&backupStrategy, "backup-strategy", "BackupFinishedRecord", "Set the strategy for backup workflow records, default is RemainLatestFailedRecord")
 	flag.StringVar(&backupIgnoreStrategy, "backup-ignore-strategy", "", "Set the strategy for ignore backup workflow records, default is IgnoreLatestFailedRecord")
 	flag.StringVar(&backupPersistType, "backup-persist-type", "", "Set the persist type for backup workflow records, default is empty")
@@ -125,9 +170,25 @@ func main() {
 	flag.StringVar(&backupConfigSecretNamespace, "backup-config-secret-namespace", "vela-system", "Set the secret namespace for backup workflow configs, default is backup-config")
 	flag.BoolVar(&providers.EnableExternalPackageForDefaultCompiler, "enable-external-package-for-default-compiler", true, "Enable external package for default compiler")
 	flag.BoolVar(&providers.EnableExternalPackageWatchForDefaultCompiler, "enable-external-package-watch-for-default-compiler", false, "Enable external package watch for default compiler")
+	flag.BoolVar(&providers.EnableConfigMapPackageForDefaultCompiler, "enable-configmap-package-for-default-compiler", false, "Enable loading cue packages from the configmaps labeled with "+types.LabelCUEPackage+" for default compiler")
+	flag.StringVar(&providers.ConfigMapPackageNamespace, "configmap-package-namespace", "vela-system", "The namespace of the configmaps that contain cue packages")
+	flag.DurationVar(&providers.ConfigMapPackageResyncPeriod, "configmap-package-resync-period", time.Minute, "The period to resync the cue packages from configmaps")
+	flag.StringVar(&external.RegistryNamespace, "external-executor-namespace", "vela-system", "The namespace of the configmaps labeled with "+types.LabelExternalExecutor+" that register the external step executors")
+	flag.BoolVar(&listStepTypes, "list-step-types", false, "Print the step types registered in the build and exit")
+	flag.StringVar(&planRun, "plan-workflowrun", "", "Print the execution plan of the workflowrun manifest in the file and exit, use - to read the manifest from stdin. The steps are rendered, validated and selected without executing them")
+	flag.StringVar(&criticalPathRun, "critical-path-workflowrun", "", "Print the critical path of the workflowrun manifest in the file and exit, use - to read the manifest from stdin. The critical path is computed from the status of the run, so the archived runs can be analyzed without the cluster")
+	flag.StringVar(&snapshotRun, "snapshot-workflowrun", "", "Print the snapshot of the workflowrun in the format of namespace/name in JSON and exit, the snapshot contains the spec, the status, the context backend and the debug data of the run with the secrets redacted")
+	flag.StringVar(&findRunsResource, "find-workflowruns-for-resource", "", "Print the workflowruns that applied the resource in the format of [cluster:]apiVersion/kind/namespace/name and exit, the namespace is empty for the cluster-scoped resource. The runs are found by their inventories and the labels of the resource")
 	multicluster.AddClusterGatewayClientFlags(flag.CommandLine)
 	feature.DefaultMutableFeatureGate.AddFlag(flag.CommandLine)
 	sharding.AddControllerFlags(flag.CommandLine)
+	flag.IntVar(&shardArgs.ShardCount, "shard-count", 0, "The total number of shards that workflowruns are distributed across by hashing their namespaced names. Sharding by hash is disabled if it's less than 2.")
+	flag.IntVar(&shardArgs.ShardIndex, "shard-index", 0, "The index of the shard handled by this controller, must be in [0, shard-count). Each shard elects its own leader.")
+	flag.StringVar(&shardArgs.ShardSelector, "shard-selector", "", "The label selector of the workflowruns handled by this controller. If empty, all the workflowruns will be handled.")
+	flag.BoolVar(&shardArgs.ShardPrimary, "shard-primary", false, "Run the cluster-wide jobs in this controller while sharding by the shard-selector, it must be set in exactly one of the shards.")
+	flag.StringVar(&tenantArgs.Label, "tenant-label", "", "The label of the workflowruns whose value is their tenant to limit the concurrent reconciles by. If empty, the namespace is the tenant. The workflowruns without the label are reconciled without the limit.")
+	flag.IntVar(&tenantArgs.ConcurrentReconciles, "tenant-concurrent-reconciles", 0, "The max concurrent reconciles of the workflowruns of every tenant, the throttled workflowruns are requeued so that the other tenants are not starved. No limit if it's not positive, default is 0")
+	flag.StringVar(&tenantArgs.Overrides, "tenant-concurrent-reconciles-overrides", "", "The max concurrent reconciles of the specific tenants in the format of tenant=limit separated by commas, e.g. team-a=8,team-b=1. No limit for the tenant if its limit is not positive")
 
 	// setup logging
 	klog.InitFlags(nil)
@@ -137,6 +198,21 @@ func main() {
 		_ = flag.Set("v", strconv.Itoa(int(common.LogDebug)))
 	}
 
+	callback.DefaultDispatcher = callback.NewDispatcher(callback.NewHTTPClient(completionWebhookAllowPrivate))
+
+	if listStepTypes {
+		printStepTypes(os.Stdout)
+		os.Exit(0)
+	}
+
+	if criticalPathRun != "" {
+		if err := printCriticalPath(criticalPathRun, os.Stdout); err != nil {
+			klog.Error(err, "unable to analyze the critical path of the workflowrun")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	if pprofAddr != "" {
 		// Start pprof server if enabled
 		mux := http.NewServeMux()
@@ -190,12 +266,73 @@ func main() {
 	)
 	restConfig.UserAgent = userAgent
 
+	if snapshotRun != "" {
+		if err := dumpSnapshot(context.Background(), restConfig, snapshotRun, os.Stdout); err != nil {
+			klog.Error(err, "unable to snapshot the workflowrun")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if findRunsResource != "" {
+		if err := printRunsForResource(context.Background(), restConfig, findRunsResource, os.Stdout); err != nil {
+			klog.Error(err, "unable to find the workflowruns for the resource")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if planRun != "" {
+		if err := printPlan(context.Background(), restConfig, planRun, os.Stdout); err != nil {
+			klog.Error(err, "unable to plan the workflowrun")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	if feature.DefaultMutableFeatureGate.Enabled(features.EnableWatchEventListener) {
 		utilruntime.Must(triggerv1alpha1.AddToScheme(scheme))
 	}
 
+	if err := metrics.SetRunLabelKeys(metricsRunLabels); err != nil {
+		klog.Error(err, "unable to setup the run labels of metrics")
+		os.Exit(1)
+	}
+	if err := metrics.SetStepMetrics(stepMetrics); err != nil {
+		klog.Error(err, "unable to setup the custom step metrics")
+		os.Exit(1)
+	}
+
+	pauseConfigMapKey, err := controllers.ParsePauseConfigMap(pauseConfigMap)
+	if err != nil {
+		klog.Error(err, "unable to setup pause config map")
+		os.Exit(1)
+	}
+	controllerArgs.PauseConfigMap = pauseConfigMapKey
+	if controllerArgs.Paused {
+		klog.InfoS("Workflow controller is paused for maintenance")
+	}
+
 	leaderElectionID := fmt.Sprintf("workflow-%s", strings.ToLower(strings.ReplaceAll(version.VelaVersion, ".", "-")))
 	leaderElectionID += sharding.GetShardIDSuffix()
+	if shardArgs.Enabled() {
+		shardPredicate, err := controllers.NewShardPredicate(shardArgs)
+		if err != nil {
+			klog.Error(err, "unable to setup shard")
+			os.Exit(1)
+		}
+		controllerArgs.ShardPredicate = shardPredicate
+		leaderElectionID += shardArgs.LeaderElectionIDSuffix()
+		klog.InfoS("Enable workflowrun sharding", "count", shardArgs.ShardCount, "index", shardArgs.ShardIndex, "selector", shardArgs.ShardSelector)
+	}
+	if tenantArgs.Enabled() {
+		controllerArgs.TenantLimiter, err = controllers.NewTenantLimiter(tenantArgs)
+		if err != nil {
+			klog.Error(err, "unable to setup the tenant concurrent reconciles")
+			os.Exit(1)
+		}
+		klog.InfoS("Enable the tenant concurrent reconciles", "label", tenantArgs.Label, "limit", tenantArgs.ConcurrentReconciles, "overrides", tenantArgs.Overrides)
+	}
 	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                     scheme,
 		MetricsBindAddress:         metricsAddr,
@@ -217,15 +354,27 @@ func main() {
 	}
 
 	kubeClient := mgr.GetClient()
-	if groupByLabel != "" {
+	if groupByLabel != "" && shardArgs.IsPrimary() {
 		if err := mgr.Add(utils.NewRecycleCronJob(kubeClient, recycleDuration, "0 0 * * *", groupByLabel)); err != nil {
 			klog.Error(err, "unable to start recycle cronjob")
 			os.Exit(1)
 		}
 	}
 
+	if providers.EnableConfigMapPackageForDefaultCompiler {
+		reader := mgr.GetAPIReader()
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			providers.ListenConfigMapPackages(ctx, reader)
+			return nil
+		})); err != nil {
+			klog.Error(err, "unable to start cue package loader")
+			os.Exit(1)
+		}
+	}
+
 	if useWebhook {
 		klog.InfoS("Enable webhook", "server port", strconv.Itoa(webhookPort))
+		controllerArgs.ApproverVerified = true
 		webhook.Register(mgr, controllerArgs)
 		if err := waitWebhookSecretVolume(certDir, waitSecretTimeout, waitSecretInterval); err != nil {
 			klog.ErrorS(err, "Unable to get webhook secret")
@@ -233,16 +382,32 @@ func main() {
 		}
 	}
 
+	controllerArgs.AuditSink, err = audit.NewSink(auditSink, event.NewAPIRecorder(mgr.GetEventRecorderFor("Audit")))
+	if err != nil {
+		klog.Error(err, "unable to setup audit sink")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.WorkflowRunReconciler{
 		Client:            kubeClient,
 		Scheme:            mgr.GetScheme(),
 		Recorder:          event.NewAPIRecorder(mgr.GetEventRecorderFor("WorkflowRun")),
 		ControllerVersion: version.VelaVersion,
+		APIReader:         mgr.GetAPIReader(),
 		Args:              controllerArgs,
 	}).SetupWithManager(mgr); err != nil {
 		klog.Error(err, "unable to create controller", "controller", "WorkflowRun")
 		os.Exit(1)
 	}
+	if err = (&controllers.ApprovalReconciler{
+		Client:   kubeClient,
+		Scheme:   mgr.GetScheme(),
+		Recorder: event.NewAPIRecorder(mgr.GetEventRecorderFor("Approval")),
+		Args:     controllerArgs,
+	}).SetupWithManager(mgr); err != nil {
+		klog.Error(err, "unable to create controller", "controller", "Approval")
+		os.Exit(1)
+	}
 
 	if feature.DefaultMutableFeatureGate.Enabled(features.EnableBackupWorkflowRecord) {
 		if backupPersistType == "" {
@@ -288,6 +453,15 @@ func main() {
 		klog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if queueDepthArgs.Enabled() {
+		checker := controllers.NewQueueDepthChecker(ctrlmetrics.Registry, controllers.WorkflowRunQueueName, queueDepthArgs, nil)
+		// the overloaded controller is not taken out of service by the readiness probe, the check is served on the
+		// metrics endpoint for the alerts and the autoscalers instead
+		if err := mgr.AddMetricsExtraHandler(queueDepthPath, healthz.CheckHandler{Checker: checker}); err != nil {
+			klog.Error(err, "unable to set up queue depth check")
+			os.Exit(1)
+		}
+	}
 
 	klog.Info("Start the vela workflow monitor")
 	informer, err := mgr.GetCache().GetInformer(context.Background(), &v1alpha1.WorkflowRun{})
@@ -354,3 +528,141 @@ func waitWebhookSecretVolume(certDir string, timeout, interval time.Duration) er
 		}
 	}
 }
+
+// printStepTypes prints the step types registered in the build
+func printStepTypes(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tSIDE-EFFECTS\tDESCRIPTION")
+	for _, info := range tasks.ListStepTypes() {
+		_, _ = fmt.Fprintf(tw, "%s\t%t\t%s\n", info.Name, info.SideEffects, info.Description)
+	}
+	_ = tw.Flush()
+}
+
+// dumpSnapshot prints the snapshot of the workflowrun in the format of namespace/name in JSON
+func dumpSnapshot(ctx context.Context, restConfig *rest.Config, key string, w io.Writer) error {
+	namespace, name, found := strings.Cut(key, "/")
+	if !found || namespace == "" || name == "" {
+		return fmt.Errorf("invalid workflowrun %s, must be in the format of namespace/name", key)
+	}
+	cli, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	run := &v1alpha1.WorkflowRun{}
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, run); err != nil {
+		return err
+	}
+	snapshot, err := debug.Snapshot(ctx, cli, run)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
+
+// printRunsForResource prints the workflowruns that applied the resource in the format of
+// [cluster:]apiVersion/kind/namespace/name, one run per line
+func printRunsForResource(ctx context.Context, restConfig *rest.Config, resource string, w io.Writer) error {
+	cluster, ref, found := strings.Cut(resource, ":")
+	if !found {
+		cluster, ref = "", resource
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) < 4 || len(parts) > 5 || parts[len(parts)-3] == "" || parts[len(parts)-1] == "" {
+		return fmt.Errorf("invalid resource %s, must be in the format of [cluster:]apiVersion/kind/namespace/name", resource)
+	}
+	n := len(parts)
+	gvk := schema.FromAPIVersionAndKind(strings.Join(parts[:n-3], "/"), parts[n-3])
+	cli, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	runs, err := providertypes.FindRunsForResource(ctx, cli, cluster, gvk, parts[n-2], parts[n-1])
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if _, err := fmt.Fprintln(w, run.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readWorkflowRun reads the workflowrun manifest in the file, the manifest is read from stdin if the file is -
+func readWorkflowRun(file string) (*v1alpha1.WorkflowRun, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filepath.Clean(file))
+	}
+	if err != nil {
+		return nil, err
+	}
+	run := &v1alpha1.WorkflowRun{}
+	if err := yaml.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("failed to parse the workflowrun in %s: %w", file, err)
+	}
+	if run.Namespace == "" {
+		run.Namespace = corev1.NamespaceDefault
+	}
+	return run, nil
+}
+
+// printCriticalPath prints the steps on the critical path of the workflowrun manifest in the file with their
+// durations, the manifest is read from stdin if the file is -
+func printCriticalPath(file string, w io.Writer) error {
+	run, err := readWorkflowRun(file)
+	if err != nil {
+		return err
+	}
+	path, duration := utils.CriticalPath(run)
+	if len(path) == 0 {
+		return fmt.Errorf("the workflowrun %s/%s has no steps executed", run.Namespace, run.Name)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "STEP\tTYPE\tPHASE\tDURATION")
+	for _, step := range path {
+		// the timings of the pruned step are not kept in the status
+		elapsed := "-"
+		if !step.FirstExecuteTime.IsZero() && !step.LastExecuteTime.IsZero() {
+			elapsed = step.LastExecuteTime.Sub(step.FirstExecuteTime.Time).String()
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", step.Name, step.Type, step.Phase, elapsed)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	total := fmt.Sprintf("Critical path of the workflowrun %s/%s: %s", run.Namespace, run.Name, duration)
+	if run.Status.Duration != nil {
+		total += fmt.Sprintf(" of the run duration %s", run.Status.Duration.Duration)
+	}
+	if utils.CriticalPathInferred(run) {
+		total += " (inferred from the timings of the steps of the referenced workflow)"
+	}
+	_, err = fmt.Fprintln(w, total)
+	return err
+}
+
+// printPlan prints the execution plan of the workflowrun manifest in the file, the manifest is read from stdin if
+// the file is -
+func printPlan(ctx context.Context, restConfig *rest.Config, file string, w io.Writer) error {
+	run, err := readWorkflowRun(file)
+	if err != nil {
+		return err
+	}
+	cli, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	plan, err := generator.Plan(ctx, cli, run, types.StepGeneratorOptions{})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, plan.String())
+	return err
+}
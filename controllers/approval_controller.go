@@ -0,0 +1,278 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	ctrlHandler "sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	monitorContext "github.com/kubevela/pkg/monitor/context"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
+)
+
+// ApprovalReconciler reconciles an Approval object, the decision of the approval is applied to the suspended step
+// of the WorkflowRun once the step is suspended
+type ApprovalReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder event.Recorder
+	Clock    types.Clock
+	Args
+}
+
+// Reconcile applies the decision of the approval to the workflow run
+// +kubebuilder:rbac:groups=core.oam.dev,resources=approvals,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core.oam.dev,resources=approvals/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core.oam.dev,resources=workflowruns/status,verbs=get;update;patch
+func (r *ApprovalReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, ReconcileTimeout)
+	defer cancel()
+
+	logCtx := monitorContext.NewTraceContext(ctx, "").AddTag("approval", req.String())
+	logCtx.Info("Start reconcile approval")
+	defer logCtx.Commit("End reconcile approval")
+	approval := new(v1alpha1.Approval)
+	if err := r.Get(ctx, req.NamespacedName, approval); err != nil {
+		if !kerrors.IsNotFound(err) {
+			logCtx.Error(err, "get approval")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+	if approval.Status.Phase == v1alpha1.ApprovalPhaseApplied || approval.Status.Phase == v1alpha1.ApprovalPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+	if approval.Spec.Decision == "" {
+		return r.patchApprovalStatus(logCtx, approval, v1alpha1.ApprovalPhasePending, "the decision is not made")
+	}
+
+	run := new(v1alpha1.WorkflowRun)
+	if err := r.Get(ctx, client.ObjectKey{Name: approval.Spec.WorkflowRun, Namespace: approval.Namespace}, run); err != nil {
+		if !kerrors.IsNotFound(err) {
+			logCtx.Error(err, "get workflowrun")
+			return ctrl.Result{}, err
+		}
+		return r.patchApprovalStatus(logCtx, approval, v1alpha1.ApprovalPhasePending, fmt.Sprintf("workflow run %s is not found", approval.Spec.WorkflowRun))
+	}
+	if run.Status.Finished || run.Status.Terminated {
+		return r.patchApprovalStatus(logCtx, approval, v1alpha1.ApprovalPhaseFailed, fmt.Sprintf("workflow run %s is already finished", run.Name))
+	}
+	if !isStepSuspending(run.Status, approval.Spec.Step) {
+		return r.patchApprovalStatus(logCtx, approval, v1alpha1.ApprovalPhasePending, fmt.Sprintf("step %s is not suspending", approval.Spec.Step))
+	}
+
+	gates, err := utils.GetStepApprovalGates(ctx, r.Client, run, approval.Spec.Step)
+	if err != nil {
+		logCtx.Error(err, "get approval gates")
+		return ctrl.Result{}, err
+	}
+	if msg := validateGateApproval(approval, gates, r.ApproverVerified); msg != "" {
+		return r.patchApprovalStatus(logCtx, approval, v1alpha1.ApprovalPhaseFailed, msg)
+	}
+
+	message := fmt.Sprintf("step %s is %s", approval.Spec.Step, approval.Spec.Decision)
+	if approval.Spec.Gate != "" {
+		message = fmt.Sprintf("gate %s of step %s is %s", approval.Spec.Gate, approval.Spec.Step, approval.Spec.Decision)
+	}
+	if approval.Spec.Approver != "" {
+		message += " by " + approval.Spec.Approver
+	}
+	if approval.Spec.Reason != "" {
+		message += ": " + approval.Spec.Reason
+	}
+	var pending string
+	if len(gates) > 0 {
+		status := utils.RecordStepApproval(run, approval.Spec.Step, v1alpha1.StepApproval{
+			Gate:     approval.Spec.Gate,
+			Approver: approval.Spec.Approver,
+			Decision: approval.Spec.Decision,
+			Time:     metav1.NewTime(r.clock().Now()),
+		})
+		if approval.Spec.Decision == v1alpha1.ApprovalDecisionApproved {
+			pending = utils.ApprovalGatesMessage(gates, status.Approvals)
+			if pending != "" {
+				status.Message = pending
+			}
+		}
+	}
+	switch approval.Spec.Decision {
+	case v1alpha1.ApprovalDecisionApproved:
+		if pending != "" {
+			// the step keeps suspending until all of its gates are approved
+			if err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+				return r.Status().Patch(ctx, run, client.Merge)
+			}); err != nil {
+				logCtx.Error(err, "record approval")
+				return ctrl.Result{}, err
+			}
+			message += ". " + pending
+		} else if err := utils.ResumeWorkflow(ctx, r.Client, run, approval.Spec.Step); err != nil {
+			logCtx.Error(err, "resume workflowrun")
+			return ctrl.Result{}, err
+		}
+	case v1alpha1.ApprovalDecisionRejected:
+		if err := utils.TerminateWorkflow(ctx, r.Client, run); err != nil {
+			logCtx.Error(err, "terminate workflowrun")
+			return ctrl.Result{}, err
+		}
+	default:
+		return r.patchApprovalStatus(logCtx, approval, v1alpha1.ApprovalPhaseFailed, fmt.Sprintf("invalid decision %s", approval.Spec.Decision))
+	}
+	r.Recorder.Event(run, event.Normal(v1alpha1.ReasonApprove, message))
+	r.auditApproval(logCtx, approval, run, message)
+	approval.Status.AppliedTime = metav1.NewTime(r.clock().Now())
+	return r.patchApprovalStatus(logCtx, approval, v1alpha1.ApprovalPhaseApplied, message)
+}
+
+// auditApproval records the applied decision of the approval in the audit sink, the actor is the approver
+func (r *ApprovalReconciler) auditApproval(ctx monitorContext.Context, approval *v1alpha1.Approval, run *v1alpha1.WorkflowRun, message string) {
+	if r.AuditSink == nil {
+		return
+	}
+	entry := types.AuditEntry{
+		Timestamp: r.clock().Now(),
+		Actor:     approval.Spec.Approver,
+		Action:    types.AuditActionApprove,
+		Target:    types.AuditTarget{Namespace: run.Namespace, Name: run.Name, UID: run.UID, Step: approval.Spec.Step},
+		Outcome:   string(approval.Spec.Decision),
+		Message:   message,
+	}
+	if approval.Spec.Decision == v1alpha1.ApprovalDecisionRejected {
+		entry.Action = types.AuditActionReject
+	}
+	if entry.Actor == "" {
+		entry.Actor = "approval/" + approval.Name
+	}
+	if err := r.AuditSink.Record(ctx, entry); err != nil {
+		ctx.Error(err, "record audit entry", "action", entry.Action)
+	}
+}
+
+func (r *ApprovalReconciler) patchApprovalStatus(ctx context.Context, approval *v1alpha1.Approval, phase v1alpha1.ApprovalPhase, message string) (ctrl.Result, error) {
+	if approval.Status.Phase == phase && approval.Status.Message == message {
+		return ctrl.Result{}, nil
+	}
+	approval.Status.Phase = phase
+	approval.Status.Message = message
+	if err := r.Status().Update(ctx, approval); err != nil {
+		return ctrl.Result{}, errors.WithMessage(err, "failed to update approval status")
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *ApprovalReconciler) clock() types.Clock {
+	if r.Clock == nil {
+		return clock.RealClock{}
+	}
+	return r.Clock
+}
+
+// findApprovalsForWorkflowRun enqueues the pending approvals of the workflow run, so the decisions are applied once
+// the steps are suspended
+func (r *ApprovalReconciler) findApprovalsForWorkflowRun(object client.Object) []reconcile.Request {
+	approvals := &v1alpha1.ApprovalList{}
+	if err := r.List(context.Background(), approvals, client.InNamespace(object.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, approval := range approvals.Items {
+		if approval.Spec.WorkflowRun != object.GetName() || approval.Status.Phase == v1alpha1.ApprovalPhaseApplied || approval.Status.Phase == v1alpha1.ApprovalPhaseFailed {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: k8stypes.NamespacedName{Name: approval.Name, Namespace: approval.Namespace},
+		})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ApprovalReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.ConcurrentReconciles,
+		}).
+		For(&v1alpha1.Approval{}).
+		Watches(&source.Kind{Type: &v1alpha1.WorkflowRun{}}, ctrlHandler.EnqueueRequestsFromMapFunc(r.findApprovalsForWorkflowRun)).
+		Complete(r)
+}
+
+// validateGateApproval returns the reason why the approval can't be applied to the approval gates of the step,
+// it's empty if the approval is valid. The approver is only trusted if it's verified by the admission webhook.
+func validateGateApproval(approval *v1alpha1.Approval, gates []v1alpha1.ApprovalGate, verified bool) string {
+	spec := approval.Spec
+	if len(gates) == 0 {
+		if spec.Gate != "" {
+			return fmt.Sprintf("step %s has no approval gates", spec.Step)
+		}
+		return ""
+	}
+	if spec.Gate == "" {
+		names := make([]string, 0, len(gates))
+		for _, gate := range gates {
+			names = append(names, gate.Name)
+		}
+		return fmt.Sprintf("the gate must be set to approve step %s, which has the approval gates %s", spec.Step, strings.Join(names, ", "))
+	}
+	gate := utils.FindApprovalGate(gates, spec.Gate)
+	if gate == nil {
+		return fmt.Sprintf("step %s has no approval gate %s", spec.Step, spec.Gate)
+	}
+	if len(gate.Approvers) > 0 && !verified {
+		return fmt.Sprintf("the approvers of gate %s can only be verified with the admission webhook enabled", spec.Gate)
+	}
+	if !utils.IsGateApprover(*gate, spec.Approver, spec.ApproverGroups) {
+		if spec.Approver == "" {
+			return fmt.Sprintf("the approver must be set to approve gate %s", spec.Gate)
+		}
+		return fmt.Sprintf("%s is not an approver of gate %s", spec.Approver, spec.Gate)
+	}
+	return ""
+}
+
+func isStepSuspending(status v1alpha1.WorkflowRunStatus, name string) bool {
+	for _, step := range status.Steps {
+		if step.Name == name {
+			return step.Phase == v1alpha1.WorkflowStepPhaseSuspending
+		}
+		for _, sub := range step.SubStepsStatus {
+			if sub.Name == name {
+				return sub.Phase == v1alpha1.WorkflowStepPhaseSuspending
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+type fakeAuditSink struct {
+	entries []types.AuditEntry
+}
+
+func (s *fakeAuditSink) Record(_ context.Context, entry types.AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+var _ = Describe("Test Approval", func() {
+	ctx := context.Background()
+	namespace := "approval-ns"
+	var approvalReconciler *ApprovalReconciler
+	var auditSink *fakeAuditSink
+
+	BeforeEach(func() {
+		setupNamespace(ctx, namespace)
+		auditSink = &fakeAuditSink{}
+		approvalReconciler = &ApprovalReconciler{
+			Client:   k8sClient,
+			Scheme:   testScheme,
+			Recorder: event.NewAPIRecorder(recorder),
+			Args:     Args{AuditSink: auditSink, ApproverVerified: true},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.DeleteAllOf(ctx, &v1alpha1.Approval{}, client.InNamespace(namespace))).Should(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &v1alpha1.WorkflowRun{}, client.InNamespace(namespace))).Should(Succeed())
+	})
+
+	newRun := func(name string) *v1alpha1.WorkflowRun {
+		return &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: v1alpha1.WorkflowRunSpec{
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{{
+						WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "approve", Type: "suspend"},
+					}},
+				},
+			},
+		}
+	}
+	reconcileApproval := func(approval *v1alpha1.Approval) *v1alpha1.Approval {
+		_, err := approvalReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(approval)})
+		Expect(err).Should(BeNil())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(approval), approval)).Should(BeNil())
+		return approval
+	}
+
+	It("test approve the suspended step", func() {
+		approval := &v1alpha1.Approval{
+			ObjectMeta: metav1.ObjectMeta{Name: "approve-run", Namespace: namespace},
+			Spec: v1alpha1.ApprovalSpec{
+				WorkflowRun: "approve-run",
+				Step:        "approve",
+				Decision:    v1alpha1.ApprovalDecisionApproved,
+				Reason:      "LGTM",
+				Approver:    "alice",
+			},
+		}
+		Expect(k8sClient.Create(ctx, approval)).Should(BeNil())
+		approval = reconcileApproval(approval)
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhasePending))
+		Expect(approval.Status.Message).Should(Equal("workflow run approve-run is not found"))
+
+		run := newRun("approve-run")
+		Expect(k8sClient.Create(ctx, run)).Should(BeNil())
+		Expect(approvalReconciler.findApprovalsForWorkflowRun(run)).Should(HaveLen(1))
+		approval = reconcileApproval(approval)
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhasePending))
+		Expect(approval.Status.Message).Should(Equal("step approve is not suspending"))
+
+		tryReconcile(reconciler, run.Name, run.Namespace)
+		approval = reconcileApproval(approval)
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhaseApplied))
+		Expect(approval.Status.Message).Should(Equal("step approve is Approved by alice: LGTM"))
+		Expect(approval.Status.AppliedTime.IsZero()).Should(BeFalse())
+		Expect(approvalReconciler.findApprovalsForWorkflowRun(run)).Should(BeEmpty())
+
+		tryReconcile(reconciler, run.Name, run.Namespace)
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(run), run)).Should(BeNil())
+		Expect(run.Status.Phase).Should(Equal(v1alpha1.WorkflowStateSucceeded))
+
+		events, err := recorder.GetEventsWithName(run.Name)
+		Expect(err).Should(BeNil())
+		Expect(events[0].Reason).Should(Equal(v1alpha1.ReasonApprove))
+
+		Expect(auditSink.entries).Should(HaveLen(1))
+		Expect(auditSink.entries[0].Actor).Should(Equal("alice"))
+		Expect(auditSink.entries[0].Action).Should(Equal(types.AuditActionApprove))
+		Expect(auditSink.entries[0].Target).Should(Equal(types.AuditTarget{Namespace: namespace, Name: run.Name, UID: run.UID, Step: "approve"}))
+		Expect(auditSink.entries[0].Outcome).Should(Equal(string(v1alpha1.ApprovalDecisionApproved)))
+	})
+
+	It("test reject the suspended step", func() {
+		run := newRun("reject-run")
+		Expect(k8sClient.Create(ctx, run)).Should(BeNil())
+		tryReconcile(reconciler, run.Name, run.Namespace)
+
+		approval := &v1alpha1.Approval{
+			ObjectMeta: metav1.ObjectMeta{Name: "reject-run", Namespace: namespace},
+			Spec:       v1alpha1.ApprovalSpec{WorkflowRun: "reject-run", Step: "approve"},
+		}
+		Expect(k8sClient.Create(ctx, approval)).Should(BeNil())
+		approval = reconcileApproval(approval)
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhasePending))
+		Expect(approval.Status.Message).Should(Equal("the decision is not made"))
+
+		approval.Spec.Decision = v1alpha1.ApprovalDecisionRejected
+		Expect(k8sClient.Update(ctx, approval)).Should(BeNil())
+		approval = reconcileApproval(approval)
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhaseApplied))
+
+		tryReconcile(reconciler, run.Name, run.Namespace)
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(run), run)).Should(BeNil())
+		Expect(run.Status.Phase).Should(Equal(v1alpha1.WorkflowStateTerminated))
+		Expect(auditSink.entries).Should(HaveLen(1))
+		Expect(auditSink.entries[0].Action).Should(Equal(types.AuditActionReject))
+		Expect(auditSink.entries[0].Actor).Should(Equal("approval/reject-run"))
+
+		By("the approval of the finished run is failed")
+		late := &v1alpha1.Approval{
+			ObjectMeta: metav1.ObjectMeta{Name: "reject-run-late", Namespace: namespace},
+			Spec:       v1alpha1.ApprovalSpec{WorkflowRun: "reject-run", Step: "approve", Decision: v1alpha1.ApprovalDecisionApproved},
+		}
+		Expect(k8sClient.Create(ctx, late)).Should(BeNil())
+		late = reconcileApproval(late)
+		Expect(late.Status.Phase).Should(Equal(v1alpha1.ApprovalPhaseFailed))
+	})
+
+	It("test approve the gates of the suspended step", func() {
+		run := newRun("gate-run")
+		run.Spec.WorkflowSpec.Steps[0].ApprovalGates = []v1alpha1.ApprovalGate{
+			{Name: "security", Approvers: []string{"alice", "bob"}, Quorum: 2},
+			{Name: "platform"},
+		}
+		Expect(k8sClient.Create(ctx, run)).Should(BeNil())
+		tryReconcile(reconciler, run.Name, run.Namespace)
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(run), run)).Should(BeNil())
+		Expect(run.Status.Steps[0].Phase).Should(Equal(v1alpha1.WorkflowStepPhaseSuspending))
+		Expect(run.Status.Steps[0].Message).Should(Equal("Waiting for the approval gates: security (0/2), platform (0/1)"))
+
+		approve := func(name, gate, approver string) *v1alpha1.Approval {
+			approval := &v1alpha1.Approval{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Spec: v1alpha1.ApprovalSpec{
+					WorkflowRun: run.Name,
+					Step:        "approve",
+					Gate:        gate,
+					Decision:    v1alpha1.ApprovalDecisionApproved,
+					Approver:    approver,
+				},
+			}
+			Expect(k8sClient.Create(ctx, approval)).Should(BeNil())
+			return reconcileApproval(approval)
+		}
+		approvalReconciler.ApproverVerified = false
+		approval := approve("gate-run-unverified", "security", "alice")
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhaseFailed))
+		Expect(approval.Status.Message).Should(Equal("the approvers of gate security can only be verified with the admission webhook enabled"))
+		approvalReconciler.ApproverVerified = true
+
+		approval = approve("gate-run-none", "", "alice")
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhaseFailed))
+		Expect(approval.Status.Message).Should(Equal("the gate must be set to approve step approve, which has the approval gates security, platform"))
+		approval = approve("gate-run-unknown", "legal", "alice")
+		Expect(approval.Status.Message).Should(Equal("step approve has no approval gate legal"))
+		approval = approve("gate-run-eve", "security", "eve")
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhaseFailed))
+		Expect(approval.Status.Message).Should(Equal("eve is not an approver of gate security"))
+
+		approval = approve("gate-run-alice", "security", "alice")
+		Expect(approval.Status.Phase).Should(Equal(v1alpha1.ApprovalPhaseApplied))
+		Expect(approval.Status.Message).Should(Equal("gate security of step approve is Approved by alice. Waiting for the approval gates: security (1/2), platform (0/1)"))
+		approve("gate-run-platform", "platform", "carol")
+		// the partial approvals keep the step suspending
+		tryReconcile(reconciler, run.Name, run.Namespace)
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(run), run)).Should(BeNil())
+		Expect(run.Status.Steps[0].Phase).Should(Equal(v1alpha1.WorkflowStepPhaseSuspending))
+		Expect(run.Status.Steps[0].Message).Should(Equal("Waiting for the approval gates: security (1/2)"))
+		Expect(run.Status.Steps[0].Approvals).Should(HaveLen(2))
+		Expect(run.Status.Steps[0].Approvals[0].Gate).Should(Equal("security"))
+		Expect(run.Status.Steps[0].Approvals[0].Approver).Should(Equal("alice"))
+		Expect(run.Status.Steps[0].Approvals[0].Time.IsZero()).Should(BeFalse())
+
+		approval = approve("gate-run-bob", "security", "bob")
+		Expect(approval.Status.Message).Should(Equal("gate security of step approve is Approved by bob"))
+		tryReconcile(reconciler, run.Name, run.Namespace)
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(run), run)).Should(BeNil())
+		Expect(run.Status.Phase).Should(Equal(v1alpha1.WorkflowStateSucceeded))
+		Expect(run.Status.Steps[0].Approvals).Should(HaveLen(3))
+	})
+})
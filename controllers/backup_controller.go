@@ -36,6 +36,7 @@ import (
 	"github.com/kubevela/workflow/api/v1alpha1"
 	"github.com/kubevela/workflow/pkg/backup"
 	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
 )
 
 // BackupReconciler reconciles a WorkflowRun object
@@ -137,6 +138,10 @@ func (r *BackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 
 func (r *BackupReconciler) backup(ctx monitorContext.Context, cli client.Client, run *v1alpha1.WorkflowRun) error {
 	if r.Persister != nil {
+		// the record is backed up with the full status of the steps
+		if err := utils.HydrateStatus(ctx, run); err != nil {
+			return err
+		}
 		if err := r.Persister.Store(ctx, run); err != nil {
 			return err
 		}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/condition"
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+// PauseConfigMapKey is the key in the data of the pause config map, the controller is paused if it's "true"
+const PauseConfigMapKey = "paused"
+
+// PausedRequeueInterval is the max interval to requeue the runs held by the paused controller, so that the runs
+// are resumed in time once the controller is resumed
+var PausedRequeueInterval = 30 * time.Second
+
+// ParsePauseConfigMap parses the pause config map in the format of `<namespace>/<name>`
+func ParsePauseConfigMap(s string) (k8stypes.NamespacedName, error) {
+	if s == "" {
+		return k8stypes.NamespacedName{}, nil
+	}
+	namespace, name, ok := strings.Cut(s, "/")
+	if !ok || namespace == "" || name == "" {
+		return k8stypes.NamespacedName{}, fmt.Errorf("invalid pause config map %q, must be in the format of <namespace>/<name>", s)
+	}
+	return k8stypes.NamespacedName{Namespace: namespace, Name: name}, nil
+}
+
+// isPaused checks if the controller is paused for maintenance by the flag or the pause config map
+func (r *WorkflowRunReconciler) isPaused(ctx context.Context) (bool, error) {
+	if r.Paused {
+		return true, nil
+	}
+	if r.PauseConfigMap.Name == "" {
+		return false, nil
+	}
+	// the pause config map is read from the API server, the cached client would start an informer of all the config maps
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	cm := &corev1.ConfigMap{}
+	if err := reader.Get(ctx, r.PauseConfigMap, cm); err != nil {
+		if kerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return cm.Data[PauseConfigMapKey] == "true", nil
+}
+
+// setPausedCondition sets the Paused condition of the run, the condition is only set to False if the run has been
+// paused before
+func setPausedCondition(run *v1alpha1.WorkflowRun, paused bool, now time.Time) {
+	if paused {
+		run.SetConditions(lifecycleCondition(now, v1alpha1.WorkflowRunPausedConditionType, true, v1alpha1.ReasonControllerPaused,
+			"The controller is paused for maintenance, the steps that are not started are held"))
+		return
+	}
+	if c := run.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunPausedConditionType)); c.Status == corev1.ConditionTrue {
+		run.SetConditions(lifecycleCondition(now, v1alpha1.WorkflowRunPausedConditionType, false, v1alpha1.ReasonControllerResumed, ""))
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+const (
+	// WorkflowRunQueueName is the name of the work queue of the workflowrun controller, which is the lower case
+	// kind of the workflowruns
+	WorkflowRunQueueName = "workflowrun"
+	// queueDepthMetric is the gauge of the depth of the work queues registered by the controller runtime
+	queueDepthMetric = "workqueue_depth"
+)
+
+// QueueDepthArgs is the threshold of the check on the depth of the work queue
+type QueueDepthArgs struct {
+	// Threshold is the max number of the pending reconciles, the check is disabled if it's not positive
+	Threshold int
+	// Period is how long the depth must stay above the threshold before the check fails
+	Period time.Duration
+}
+
+// Enabled returns true if the queue depth is checked
+func (args QueueDepthArgs) Enabled() bool {
+	return args.Threshold > 0
+}
+
+type queueDepthChecker struct {
+	gatherer prometheus.Gatherer
+	queue    string
+	args     QueueDepthArgs
+	clock    types.Clock
+
+	mu sync.Mutex
+	// exceededSince is the time that the depth is above the threshold since, zero if it's not
+	exceededSince time.Time
+}
+
+// NewQueueDepthChecker returns the check that fails once the depth of the work queue stays above the threshold for
+// the period, so that the overloaded controller can be alerted or scaled. It's served on its own endpoint instead of
+// the readiness probe, since the overloaded controller still reconciles the runs and shouldn't be taken out of service.
+// The depth is read from the gauge of the work queue gathered from the metrics, a nil clock uses the real clock.
+func NewQueueDepthChecker(gatherer prometheus.Gatherer, queue string, args QueueDepthArgs, c types.Clock) healthz.Checker {
+	if c == nil {
+		c = clock.RealClock{}
+	}
+	checker := &queueDepthChecker{gatherer: gatherer, queue: queue, args: args, clock: c}
+	return checker.check
+}
+
+func (c *queueDepthChecker) check(_ *http.Request) error {
+	depth, err := c.depth()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if depth <= c.args.Threshold {
+		c.exceededSince = time.Time{}
+		return nil
+	}
+	now := c.clock.Now()
+	if c.exceededSince.IsZero() {
+		c.exceededSince = now
+	}
+	if since := now.Sub(c.exceededSince); since >= c.args.Period {
+		return fmt.Errorf("the depth %d of the work queue %s exceeds the threshold %d for %s", depth, c.queue, c.args.Threshold, since.Round(time.Second))
+	}
+	return nil
+}
+
+func (c *queueDepthChecker) depth() (int, error) {
+	families, err := c.gatherer.Gather()
+	if err != nil {
+		return 0, err
+	}
+	for _, family := range families {
+		if family.GetName() != queueDepthMetric {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "name" && label.GetValue() == c.queue {
+					return int(m.GetGauge().GetValue()), nil
+				}
+			}
+		}
+	}
+	// the gauge is registered once the queue is created, e.g. after the leader is elected
+	return 0, nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+var _ = Describe("Test Queue Depth Check", func() {
+	It("Test the check fails once the depth stays above the threshold for the period", func() {
+		Expect(QueueDepthArgs{}.Enabled()).Should(BeFalse())
+		registry := prometheus.NewRegistry()
+		depth := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "workqueue_depth"}, []string{"name"})
+		registry.MustRegister(depth)
+		fakeClock := clocktesting.NewFakeClock(time.Now())
+		check := NewQueueDepthChecker(registry, WorkflowRunQueueName, QueueDepthArgs{Threshold: 10, Period: time.Minute}, fakeClock)
+
+		By("Test the queue that is not created yet")
+		Expect(check(nil)).Should(BeNil())
+
+		By("Test the depth of the other queues is ignored")
+		depth.WithLabelValues("approval").Set(100)
+		depth.WithLabelValues(WorkflowRunQueueName).Set(10)
+		Expect(check(nil)).Should(BeNil())
+
+		By("Test the depth above the threshold within the period")
+		depth.WithLabelValues(WorkflowRunQueueName).Set(11)
+		Expect(check(nil)).Should(BeNil())
+		fakeClock.Step(30 * time.Second)
+		Expect(check(nil)).Should(BeNil())
+
+		By("Test the depth above the threshold for the period")
+		fakeClock.Step(30 * time.Second)
+		err := check(nil)
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring("the depth 11 of the work queue workflowrun exceeds the threshold 10 for 1m0s"))
+
+		By("Test the check recovers once the depth drops")
+		depth.WithLabelValues(WorkflowRunQueueName).Set(5)
+		Expect(check(nil)).Should(BeNil())
+		depth.WithLabelValues(WorkflowRunQueueName).Set(11)
+		Expect(check(nil)).Should(BeNil())
+	})
+})
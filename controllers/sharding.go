@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ShardArgs is the args for sharding workflowruns across multiple controller replicas
+type ShardArgs struct {
+	// ShardCount is the total number of shards, sharding by hash is disabled if it's less than 2
+	ShardCount int
+	// ShardIndex is the index of the shard handled by this controller, in [0, ShardCount)
+	ShardIndex int
+	// ShardSelector is the label selector of the workflowruns handled by this controller
+	ShardSelector string
+	// ShardPrimary is true if this controller runs the cluster-wide singletons while sharding by the selector, it
+	// must be set in exactly one of the shards since the shards by selector are not ordered
+	ShardPrimary bool
+}
+
+// Enabled returns true if the controller only handles a part of the workflowruns
+func (s ShardArgs) Enabled() bool {
+	return s.ShardCount > 1 || s.ShardSelector != ""
+}
+
+// Validate validates the shard args
+func (s ShardArgs) Validate() error {
+	if s.ShardCount < 0 {
+		return fmt.Errorf("invalid shard count %d, must not be negative", s.ShardCount)
+	}
+	if s.ShardCount > 1 && (s.ShardIndex < 0 || s.ShardIndex >= s.ShardCount) {
+		return fmt.Errorf("invalid shard index %d, must be in [0, %d)", s.ShardIndex, s.ShardCount)
+	}
+	if s.ShardSelector != "" {
+		if _, err := labels.Parse(s.ShardSelector); err != nil {
+			return fmt.Errorf("invalid shard selector %q: %w", s.ShardSelector, err)
+		}
+	}
+	if s.ShardPrimary && s.ShardSelector == "" {
+		return fmt.Errorf("the primary shard can only be set with the shard selector, the shard 0 is the primary one otherwise")
+	}
+	return nil
+}
+
+// LeaderElectionIDSuffix returns the suffix of the leader election id, so that every shard elects its own leader.
+// The shards by selector are distinguished by the hash of their selectors.
+func (s ShardArgs) LeaderElectionIDSuffix() string {
+	var suffix string
+	if s.ShardCount > 1 {
+		suffix = fmt.Sprintf("-shard-%d-of-%d", s.ShardIndex, s.ShardCount)
+	}
+	if s.ShardSelector != "" {
+		// the selector is normalized, so that the equivalent selectors share the same leader
+		selector := s.ShardSelector
+		if parsed, err := labels.Parse(selector); err == nil {
+			selector = parsed.String()
+		}
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(selector))
+		suffix += fmt.Sprintf("-selector-%08x", h.Sum32())
+	}
+	return suffix
+}
+
+// IsPrimary returns true if this controller should run the cluster-wide singletons, like the recycle job. It's the
+// shard 0 while sharding by hash, and the shard set as the primary one while sharding by selector.
+func (s ShardArgs) IsPrimary() bool {
+	if s.ShardSelector != "" {
+		return s.ShardPrimary && (s.ShardCount <= 1 || s.ShardIndex == 0)
+	}
+	return s.ShardCount <= 1 || s.ShardIndex == 0
+}
+
+// NewShardPredicate returns the predicate that filters the workflowruns that not belong to this shard
+func NewShardPredicate(args ShardArgs) (predicate.Predicate, error) {
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	var predicates []predicate.Predicate
+	if args.ShardSelector != "" {
+		selector, err := labels.Parse(args.ShardSelector)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return selector.Matches(labels.Set(obj.GetLabels()))
+		}))
+	}
+	if args.ShardCount > 1 {
+		predicates = append(predicates, predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return ShardOf(obj.GetNamespace(), obj.GetName(), args.ShardCount) == args.ShardIndex
+		}))
+	}
+	return predicate.And(predicates...), nil
+}
+
+// ShardOf returns the shard index of the workflowrun by consistent hashing its namespaced name
+func ShardOf(namespace, name string, shardCount int) int {
+	if shardCount <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(namespace + "/" + name))
+	return int(h.Sum32() % uint32(shardCount))
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlEvent "sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+var _ = Describe("Test Shard", func() {
+	newRun := func(name string, labels map[string]string) *v1alpha1.WorkflowRun {
+		return &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    labels,
+			},
+		}
+	}
+
+	It("Test validate shard args", func() {
+		Expect(ShardArgs{}.Validate()).Should(BeNil())
+		Expect(ShardArgs{}.Enabled()).Should(BeFalse())
+		Expect(ShardArgs{ShardCount: 3, ShardIndex: 2}.Validate()).Should(BeNil())
+		Expect(ShardArgs{ShardCount: 3, ShardIndex: 3}.Validate()).ShouldNot(BeNil())
+		Expect(ShardArgs{ShardCount: -1}.Validate()).ShouldNot(BeNil())
+		Expect(ShardArgs{ShardSelector: "a in (b"}.Validate()).ShouldNot(BeNil())
+		Expect(ShardArgs{ShardCount: 3, ShardIndex: 1}.LeaderElectionIDSuffix()).Should(Equal("-shard-1-of-3"))
+		Expect(ShardArgs{ShardCount: 3, ShardIndex: 1}.IsPrimary()).Should(BeFalse())
+		Expect(ShardArgs{ShardSelector: "a=b"}.IsPrimary()).Should(BeFalse())
+		Expect(ShardArgs{ShardSelector: "a=b", ShardPrimary: true}.IsPrimary()).Should(BeTrue())
+		Expect(ShardArgs{ShardSelector: "a=b", ShardPrimary: true, ShardCount: 2, ShardIndex: 1}.IsPrimary()).Should(BeFalse())
+		Expect(ShardArgs{ShardPrimary: true}.Validate()).ShouldNot(BeNil())
+		Expect(ShardArgs{ShardSelector: "a=b", ShardPrimary: true}.Validate()).Should(BeNil())
+
+		By("every shard by selector elects its own leader")
+		Expect(ShardArgs{ShardSelector: "a=b"}.LeaderElectionIDSuffix()).Should(HavePrefix("-selector-"))
+		Expect(ShardArgs{ShardSelector: "a=b"}.LeaderElectionIDSuffix()).ShouldNot(Equal(ShardArgs{ShardSelector: "a=c"}.LeaderElectionIDSuffix()))
+		Expect(ShardArgs{ShardSelector: "a=b,c=d"}.LeaderElectionIDSuffix()).Should(Equal(ShardArgs{ShardSelector: "c=d, a=b"}.LeaderElectionIDSuffix()))
+		Expect(ShardArgs{ShardCount: 3, ShardIndex: 1, ShardSelector: "a=b"}.LeaderElectionIDSuffix()).Should(HavePrefix("-shard-1-of-3-selector-"))
+		Expect(ShardArgs{}.LeaderElectionIDSuffix()).Should(BeEmpty())
+	})
+
+	It("Test every workflowrun belongs to exactly one shard", func() {
+		count := 3
+		var predicates []func(name string) bool
+		for i := 0; i < count; i++ {
+			p, err := NewShardPredicate(ShardArgs{ShardCount: count, ShardIndex: i})
+			Expect(err).Should(BeNil())
+			predicates = append(predicates, func(name string) bool {
+				return p.Create(ctrlEvent.CreateEvent{Object: newRun(name, nil)})
+			})
+		}
+		for i := 0; i < 50; i++ {
+			name := fmt.Sprintf("run-%d", i)
+			matched := 0
+			for j, p := range predicates {
+				if p(name) {
+					matched++
+					Expect(ShardOf("default", name, count)).Should(Equal(j))
+				}
+			}
+			Expect(matched).Should(Equal(1))
+		}
+	})
+
+	It("Test shard by selector", func() {
+		p, err := NewShardPredicate(ShardArgs{ShardSelector: "tenant=a"})
+		Expect(err).Should(BeNil())
+		Expect(p.Create(ctrlEvent.CreateEvent{Object: newRun("run", map[string]string{"tenant": "a"})})).Should(BeTrue())
+		Expect(p.Create(ctrlEvent.CreateEvent{Object: newRun("run", map[string]string{"tenant": "b"})})).Should(BeFalse())
+		Expect(p.Create(ctrlEvent.CreateEvent{Object: newRun("run", nil)})).Should(BeFalse())
+	})
+})
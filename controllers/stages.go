@@ -0,0 +1,234 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitorContext "github.com/kubevela/pkg/monitor/context"
+
+	"github.com/kubevela/workflow/api/condition"
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
+)
+
+// isStageRun returns whether the run is the run of a stage, which is controlled by its parent run
+func isStageRun(run *v1alpha1.WorkflowRun) bool {
+	owner := metav1.GetControllerOf(run)
+	return owner != nil && owner.Kind == v1alpha1.WorkflowRunKind && strings.HasPrefix(owner.APIVersion, v1alpha1.Group+"/")
+}
+
+// reconcileStages executes the stages of the run one by one, the run of a stage is created once the previous stage
+// is succeeded with the outputs of the previous stages in its init vars. The run is finished once a stage is failed
+// or terminated, or all the stages are succeeded, and it's reconciled again once the run of its current stage is
+// changed.
+func (r *WorkflowRunReconciler) reconcileStages(ctx monitorContext.Context, run *v1alpha1.WorkflowRun) (ctrl.Result, error) {
+	if run.Status.StartTime.IsZero() {
+		run.Status.StartTime = metav1.NewTime(r.clock().Now())
+	}
+	vars := make(map[string]json.RawMessage)
+	if run.Spec.InitVars != nil && len(run.Spec.InitVars.Raw) > 0 {
+		if err := json.Unmarshal(run.Spec.InitVars.Raw, &vars); err != nil {
+			return r.finishStages(ctx, run, v1alpha1.WorkflowStateFailed, fmt.Sprintf("failed to parse the init vars: %v", err))
+		}
+		if vars == nil {
+			vars = make(map[string]json.RawMessage)
+		}
+	}
+
+	total := len(run.Spec.Stages)
+	statuses := make([]v1alpha1.StageStatus, 0, total)
+	finish := func(phase v1alpha1.WorkflowRunPhase, message string) (ctrl.Result, error) {
+		run.Status.Stages = statuses
+		return r.finishStages(ctx, run, phase, message)
+	}
+	for i, stage := range run.Spec.Stages {
+		child := &v1alpha1.WorkflowRun{}
+		name := utils.StageRunName(run.Name, stage.Name)
+		// the run bypassing the webhook can't be created with the invalid name, so that it's failed without retries
+		if msgs := utils.ValidateStageRunName(name); len(msgs) > 0 {
+			statuses = append(statuses, v1alpha1.StageStatus{Name: stage.Name, Run: name})
+			return finish(v1alpha1.WorkflowStateFailed, fmt.Sprintf("invalid name of the stage %s: %s", stage.Name, strings.Join(msgs, "; ")))
+		}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: name}, child); err != nil {
+			if !kerrors.IsNotFound(err) {
+				ctx.Error(err, "[get stage run]", "stage", stage.Name)
+				return ctrl.Result{}, err
+			}
+			if run.Status.Terminated {
+				statuses = append(statuses, v1alpha1.StageStatus{Name: stage.Name, Run: name})
+				return finish(v1alpha1.WorkflowStateTerminated, fmt.Sprintf("Stage %d/%d %s is not started", i+1, total, stage.Name))
+			}
+			child, err = r.createStageRun(ctx, run, stage, vars)
+			if err != nil {
+				ctx.Error(err, "[create stage run]", "stage", stage.Name)
+				r.Recorder.Event(run, event.Warning(v1alpha1.ReasonStage, err))
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Event(run, event.Normal(v1alpha1.ReasonStage, fmt.Sprintf("Stage %s is started as the WorkflowRun %s", stage.Name, name)))
+		}
+		if !metav1.IsControlledBy(child, run) {
+			statuses = append(statuses, v1alpha1.StageStatus{Name: stage.Name, Run: name})
+			return finish(v1alpha1.WorkflowStateFailed, fmt.Sprintf("the WorkflowRun %s of the stage %s is not owned by the run", name, stage.Name))
+		}
+		statuses = append(statuses, v1alpha1.StageStatus{Name: stage.Name, Run: name, Phase: child.Status.Phase, Message: child.Status.Message})
+		progress := fmt.Sprintf("Stage %d/%d %s", i+1, total, stage.Name)
+
+		if !child.Status.Finished {
+			// the parent is terminated by terminating the run of its current stage
+			if run.Status.Terminated {
+				if err := utils.TerminateWorkflowBy(ctx, r.Client, child, r.AuditSink, types.AuditActorController, fmt.Sprintf("the parent WorkflowRun %s is terminated", run.Name)); err != nil {
+					ctx.Error(err, "[terminate stage run]", "stage", stage.Name)
+					return ctrl.Result{}, err
+				}
+				return finish(v1alpha1.WorkflowStateTerminated, progress+" is terminated")
+			}
+			phase := child.Status.Phase
+			if phase == "" {
+				phase = v1alpha1.WorkflowStateInitializing
+			}
+			run.Status.Phase = v1alpha1.WorkflowStateExecuting
+			if phase == v1alpha1.WorkflowStateSuspending {
+				run.Status.Phase = v1alpha1.WorkflowStateSuspending
+			}
+			run.Status.Message = fmt.Sprintf("%s is %s", progress, phase)
+			setLifecycleConditions(run, r.clock().Now())
+			run.Status.Stages = statuses
+			patcher := &workflowRunPatcher{Client: r.Client, run: run}
+			return ctrl.Result{}, patcher.patchStatus(ctx, &run.Status, false)
+		}
+
+		switch child.Status.Phase {
+		case v1alpha1.WorkflowStateSucceeded:
+		case v1alpha1.WorkflowStateTerminated:
+			return finish(v1alpha1.WorkflowStateTerminated, progress+" is terminated")
+		default:
+			message := progress + " is failed"
+			if child.Status.Message != "" {
+				message += ": " + child.Status.Message
+			}
+			return finish(v1alpha1.WorkflowStateFailed, message)
+		}
+
+		// the outputs of the succeeded stage are handed off to the following stages
+		if len(stage.Outputs) == 0 {
+			continue
+		}
+		outputs, err := utils.RunOutputs(ctx, child, stage.Outputs)
+		if err != nil {
+			ctx.Error(err, "[read stage outputs]", "stage", stage.Name)
+			return ctrl.Result{}, err
+		}
+		var missing []string
+		for _, output := range stage.Outputs {
+			v, ok := outputs[output]
+			if !ok {
+				missing = append(missing, output)
+				continue
+			}
+			vars[output] = json.RawMessage(v)
+		}
+		if len(missing) > 0 {
+			return finish(v1alpha1.WorkflowStateFailed, fmt.Sprintf("%s is succeeded without the outputs %s", progress, strings.Join(missing, ", ")))
+		}
+	}
+	return finish(v1alpha1.WorkflowStateSucceeded, fmt.Sprintf("All the %d stages are succeeded", total))
+}
+
+// createStageRun creates the run of the stage owned by the run, the stage run shares the context of the run and the
+// handed off outputs are set in its init vars
+func (r *WorkflowRunReconciler) createStageRun(ctx monitorContext.Context, run *v1alpha1.WorkflowRun, stage v1alpha1.RunStage, vars map[string]json.RawMessage) (*v1alpha1.WorkflowRun, error) {
+	labels := make(map[string]string)
+	for k, v := range run.Labels {
+		// the labels synced by the controller are set by the stage run itself
+		if k == types.LabelWorkflowRunPhase || k == types.LabelWorkflowRunWorkflow {
+			continue
+		}
+		labels[k] = v
+	}
+	// the name of the run is hashed if it's longer than the label value, the stage run is looked up by the owner
+	labels[types.LabelWorkflowRunParent] = utils.LabelValue(run.Name)
+	labels[types.LabelWorkflowRunStage] = stage.Name
+	child := &v1alpha1.WorkflowRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      utils.StageRunName(run.Name, stage.Name),
+			Namespace: run.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       v1alpha1.WorkflowRunKind,
+				Name:       run.Name,
+				UID:        run.UID,
+				Controller: pointer.Bool(true),
+			}},
+		},
+		Spec: v1alpha1.WorkflowRunSpec{
+			Context:     run.Spec.Context.DeepCopy(),
+			WorkflowRef: stage.WorkflowRef,
+		},
+	}
+	// the stage run is handled by the same version of the controller
+	if v, ok := run.Annotations[types.AnnotationControllerRequirement]; ok {
+		child.Annotations = map[string]string{types.AnnotationControllerRequirement: v}
+	}
+	if len(vars) > 0 {
+		raw, err := json.Marshal(vars)
+		if err != nil {
+			return nil, err
+		}
+		child.Spec.InitVars = &runtime.RawExtension{Raw: raw}
+	}
+	if err := r.Create(ctx, child); err != nil {
+		return nil, errors.WithMessagef(err, "failed to create the run of the stage %s", stage.Name)
+	}
+	return child, nil
+}
+
+// finishStages finishes the run with stages in the phase
+func (r *WorkflowRunReconciler) finishStages(ctx monitorContext.Context, run *v1alpha1.WorkflowRun, phase v1alpha1.WorkflowRunPhase, message string) (ctrl.Result, error) {
+	ctx.Info("Workflow stages return state=" + string(phase))
+	run.Status.Phase = phase
+	run.Status.Message = message
+	run.Status.Terminated = run.Status.Terminated || phase == v1alpha1.WorkflowStateTerminated
+	r.doWorkflowFinish(run)
+	setLifecycleConditions(run, r.clock().Now())
+	switch phase {
+	case v1alpha1.WorkflowStateSucceeded:
+		run.Status.SetConditions(condition.ReadyCondition(v1alpha1.WorkflowRunConditionType))
+		r.Recorder.Event(run, event.Normal(v1alpha1.ReasonExecute, v1alpha1.MessageSuccessfully))
+	case v1alpha1.WorkflowStateTerminated:
+		r.Recorder.Event(run, event.Normal(v1alpha1.ReasonExecute, v1alpha1.MessageTerminated))
+	default:
+		r.Recorder.Event(run, event.Warning(v1alpha1.ReasonStage, errors.New(message)))
+		r.Recorder.Event(run, event.Normal(v1alpha1.ReasonExecute, v1alpha1.MessageFailed))
+	}
+	requeueAfter := r.deliverCompletionWebhook(ctx, run)
+	patcher := &workflowRunPatcher{Client: r.Client, run: run}
+	return ctrl.Result{RequeueAfter: requeueAfter}, patcher.patchStatus(ctx, &run.Status, false)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	monitorContext "github.com/kubevela/pkg/monitor/context"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// TeardownRequeueInterval is the interval to requeue the run while its resources are being torn down
+var TeardownRequeueInterval = 5 * time.Second
+
+// teardownRequested checks if the teardown of the resources applied by the finished run is requested and not done
+func teardownRequested(run *v1alpha1.WorkflowRun) bool {
+	if !run.Status.Finished || !run.DeletionTimestamp.IsZero() || run.Annotations[types.AnnotationTeardown] != "true" {
+		return false
+	}
+	return run.Status.Teardown == nil || run.Status.Teardown.Phase != v1alpha1.WorkflowStepPhaseSucceeded
+}
+
+// teardown deletes the resources applied by the finished run in the reverse order that they were applied, a
+// resource is deleted after the resources applied after it are gone
+func (r *WorkflowRunReconciler) teardown(ctx monitorContext.Context, run *v1alpha1.WorkflowRun) (ctrl.Result, error) {
+	if run.Status.Teardown == nil {
+		var wfCtx wfContext.Context
+		if run.Status.ContextBackend != nil {
+			loaded, err := wfContext.LoadContext(ctx, run.Namespace, run.Name, run.Status.ContextBackend.Name)
+			if err != nil && !kerrors.IsNotFound(err) {
+				ctx.Error(err, "[load context for teardown]")
+				return ctrl.Result{}, err
+			}
+			wfCtx = loaded
+		}
+		status, err := providertypes.NewTeardownStatus(wfCtx)
+		if err != nil {
+			ctx.Error(err, "[load inventory for teardown]")
+			return ctrl.Result{}, err
+		}
+		status.StartTime = metav1.NewTime(r.clock().Now())
+		run.Status.Teardown = status
+		r.Recorder.Event(run, event.Normal(v1alpha1.ReasonTeardown, fmt.Sprintf("Tearing down %d resources", len(status.Resources))))
+	}
+	providertypes.TeardownResources(ctx, r.Client, run.Namespace, run.Status.Teardown)
+	patcher := &workflowRunPatcher{Client: r.Client, run: run}
+	if run.Status.Teardown.Phase != v1alpha1.WorkflowStepPhaseSucceeded {
+		return ctrl.Result{RequeueAfter: TeardownRequeueInterval}, patcher.patchStatus(ctx, &run.Status, false)
+	}
+	run.Status.Teardown.EndTime = metav1.NewTime(r.clock().Now())
+	r.Recorder.Event(run, event.Normal(v1alpha1.ReasonTeardown, "All the resources are torn down"))
+	return ctrl.Result{}, patcher.patchStatus(ctx, &run.Status, false)
+}
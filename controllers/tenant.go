@@ -0,0 +1,154 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/pkg/monitor/metrics"
+)
+
+// TenantThrottleRequeueInterval is the interval to requeue the workflowrun whose tenant reaches its concurrent
+// reconciles, the worker is released for the other tenants in the meantime
+var TenantThrottleRequeueInterval = time.Second * 5
+
+// TenantArgs is the args to limit the concurrent reconciles of the workflowruns of every tenant
+type TenantArgs struct {
+	// Label is the label of the workflowruns whose value is their tenant, the namespace is the tenant if it's empty.
+	// The workflowruns without the label are reconciled in the shared pool without the limit.
+	Label string
+	// ConcurrentReconciles is the max concurrent reconciles of every tenant, no limit if it's not positive
+	ConcurrentReconciles int
+	// Overrides are the max concurrent reconciles of the specific tenants in the format of `tenant=limit` separated
+	// by commas, e.g. `team-a=8,team-b=1`, no limit for the tenant if its limit is not positive
+	Overrides string
+}
+
+// Enabled returns true if the concurrent reconciles of any tenant is limited
+func (a TenantArgs) Enabled() bool {
+	return a.ConcurrentReconciles > 0 || a.Overrides != ""
+}
+
+// Validate validates the tenant args
+func (a TenantArgs) Validate() error {
+	if a.Label != "" {
+		if errs := validation.IsQualifiedName(a.Label); len(errs) > 0 {
+			return fmt.Errorf("invalid tenant label %s: %s", a.Label, strings.Join(errs, ", "))
+		}
+	}
+	_, err := a.overrides()
+	return err
+}
+
+func (a TenantArgs) overrides() (map[string]int, error) {
+	overrides := make(map[string]int)
+	for _, item := range strings.Split(a.Overrides, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		tenant, value, found := strings.Cut(item, "=")
+		if !found || tenant == "" {
+			return nil, fmt.Errorf("invalid tenant override %q, must be in the format of tenant=limit", item)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit of the tenant %s: %w", tenant, err)
+		}
+		overrides[tenant] = limit
+	}
+	return overrides, nil
+}
+
+// TenantLimiter limits the concurrent reconciles of the workflowruns of every tenant, so that the runs of one tenant
+// can't occupy all the workers of the controller
+type TenantLimiter struct {
+	label     string
+	limit     int
+	overrides map[string]int
+
+	mu       sync.Mutex
+	inflight map[string]int
+}
+
+// NewTenantLimiter returns the limiter of the concurrent reconciles of the tenants
+func NewTenantLimiter(args TenantArgs) (*TenantLimiter, error) {
+	if err := args.Validate(); err != nil {
+		return nil, err
+	}
+	overrides, err := args.overrides()
+	if err != nil {
+		return nil, err
+	}
+	return &TenantLimiter{
+		label:     args.Label,
+		limit:     args.ConcurrentReconciles,
+		overrides: overrides,
+		inflight:  make(map[string]int),
+	}, nil
+}
+
+// TenantOf returns the tenant of the workflowrun, it's empty if the run is reconciled in the shared pool
+func (l *TenantLimiter) TenantOf(run client.Object) string {
+	if l.label == "" {
+		return run.GetNamespace()
+	}
+	return run.GetLabels()[l.label]
+}
+
+// Acquire reserves a concurrent reconcile of the tenant, it returns false if the tenant reaches its limit. The
+// returned func must be called to release the reconcile once it's finished.
+func (l *TenantLimiter) Acquire(tenant string) (func(), bool) {
+	if tenant == "" {
+		return func() {}, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, ok := l.overrides[tenant]
+	if !ok {
+		limit = l.limit
+	}
+	if limit > 0 && l.inflight[tenant] >= limit {
+		metrics.WorkflowRunTenantThrottledCounter.WithLabelValues(tenant).Inc()
+		return nil, false
+	}
+	l.inflight[tenant]++
+	metrics.WorkflowRunTenantInflightGauge.WithLabelValues(tenant).Set(float64(l.inflight[tenant]))
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.inflight[tenant]--
+		metrics.WorkflowRunTenantInflightGauge.WithLabelValues(tenant).Set(float64(l.inflight[tenant]))
+		if l.inflight[tenant] == 0 {
+			delete(l.inflight, tenant)
+		}
+	}, true
+}
+
+// Inflight returns the number of the in-flight reconciles of the tenant
+func (l *TenantLimiter) Inflight(tenant string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight[tenant]
+}
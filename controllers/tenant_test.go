@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/monitor/metrics"
+)
+
+var _ = Describe("Test Tenant Concurrent Reconciles", func() {
+	It("Test validate tenant args", func() {
+		Expect(TenantArgs{}.Enabled()).Should(BeFalse())
+		Expect(TenantArgs{ConcurrentReconciles: 2}.Enabled()).Should(BeTrue())
+		Expect(TenantArgs{Overrides: "team-a=1"}.Enabled()).Should(BeTrue())
+		Expect(TenantArgs{Label: "tenant", Overrides: "team-a=1, team-b=0,"}.Validate()).Should(BeNil())
+		Expect(TenantArgs{Label: "invalid label"}.Validate()).ShouldNot(BeNil())
+		Expect(TenantArgs{Overrides: "team-a"}.Validate()).ShouldNot(BeNil())
+		Expect(TenantArgs{Overrides: "team-a=one"}.Validate()).ShouldNot(BeNil())
+	})
+
+	It("Test limit the concurrent reconciles of the tenants", func() {
+		limiter, err := NewTenantLimiter(TenantArgs{Label: "tenant", ConcurrentReconciles: 1, Overrides: "team-b=2,team-c=0"})
+		Expect(err).Should(BeNil())
+		run := &v1alpha1.WorkflowRun{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Labels: map[string]string{"tenant": "team-a"}}}
+		Expect(limiter.TenantOf(run)).Should(Equal("team-a"))
+		Expect(limiter.TenantOf(&v1alpha1.WorkflowRun{})).Should(Equal(""))
+
+		throttled := testutil.ToFloat64(metrics.WorkflowRunTenantThrottledCounter.WithLabelValues("team-a"))
+		release, ok := limiter.Acquire("team-a")
+		Expect(ok).Should(BeTrue())
+		Expect(testutil.ToFloat64(metrics.WorkflowRunTenantInflightGauge.WithLabelValues("team-a"))).Should(Equal(float64(1)))
+		_, ok = limiter.Acquire("team-a")
+		Expect(ok).Should(BeFalse())
+		Expect(testutil.ToFloat64(metrics.WorkflowRunTenantThrottledCounter.WithLabelValues("team-a"))).Should(Equal(throttled + 1))
+		// the other tenants are not affected
+		for i := 0; i < 2; i++ {
+			_, ok = limiter.Acquire("team-b")
+			Expect(ok).Should(BeTrue())
+		}
+		_, ok = limiter.Acquire("team-b")
+		Expect(ok).Should(BeFalse())
+		for i := 0; i < 3; i++ {
+			_, ok = limiter.Acquire("team-c")
+			Expect(ok).Should(BeTrue())
+			_, ok = limiter.Acquire("")
+			Expect(ok).Should(BeTrue())
+		}
+		release()
+		Expect(limiter.Inflight("team-a")).Should(Equal(0))
+		Expect(testutil.ToFloat64(metrics.WorkflowRunTenantInflightGauge.WithLabelValues("team-a"))).Should(Equal(float64(0)))
+		_, ok = limiter.Acquire("team-a")
+		Expect(ok).Should(BeTrue())
+
+		limiter, err = NewTenantLimiter(TenantArgs{ConcurrentReconciles: 1})
+		Expect(err).Should(BeNil())
+		Expect(limiter.TenantOf(run)).Should(Equal("default"))
+	})
+
+	It("Test requeue the workflowrun once its tenant reaches the limit", func() {
+		ctx := context.Background()
+		limiter, err := NewTenantLimiter(TenantArgs{Label: "tenant", ConcurrentReconciles: 1})
+		Expect(err).Should(BeNil())
+		reconciler.TenantLimiter = limiter
+		defer func() {
+			reconciler.TenantLimiter = nil
+		}()
+		run := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "wr-tenant", Namespace: "default", Labels: map[string]string{"tenant": "team-a"}},
+			Spec: v1alpha1.WorkflowRunSpec{
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step-1", Type: "suspend"}}},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, run)).Should(BeNil())
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(run)}
+
+		release, ok := limiter.Acquire("team-a")
+		Expect(ok).Should(BeTrue())
+		result, err := reconciler.Reconcile(ctx, req)
+		Expect(err).Should(BeNil())
+		Expect(result).Should(Equal(reconcile.Result{RequeueAfter: TenantThrottleRequeueInterval}))
+		Expect(k8sClient.Get(ctx, req.NamespacedName, run)).Should(BeNil())
+		Expect(run.Status.Steps).Should(BeEmpty())
+
+		release()
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).Should(BeNil())
+		Expect(k8sClient.Get(ctx, req.NamespacedName, run)).Should(BeNil())
+		Expect(run.Status.Steps).ShouldNot(BeEmpty())
+		Expect(limiter.Inflight("team-a")).Should(Equal(0))
+	})
+})
@@ -18,6 +18,7 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
 	sysruntime "runtime"
@@ -27,6 +28,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -34,16 +36,25 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	featuregatetesting "k8s.io/component-base/featuregate/testing"
+	clocktesting "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	monitorContext "github.com/kubevela/pkg/monitor/context"
 	"github.com/kubevela/pkg/util/test/definition"
 
+	"github.com/kubevela/workflow/api/condition"
 	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/debug"
+	"github.com/kubevela/workflow/pkg/executor"
 	"github.com/kubevela/workflow/pkg/features"
+	"github.com/kubevela/workflow/pkg/generator"
+	"github.com/kubevela/workflow/pkg/monitor/metrics"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	wfTypes "github.com/kubevela/workflow/pkg/types"
 	"github.com/kubevela/workflow/pkg/utils"
+	"github.com/kubevela/workflow/pkg/watcher"
 )
 
 var _ = Describe("Test Workflow", func() {
@@ -72,7 +83,7 @@ var _ = Describe("Test Workflow", func() {
 			},
 		},
 	}
-	testDefinitions := []string{"test-apply", "apply-object", "failed-render", "suspend-and-deploy", "multi-suspend", "save-process-context"}
+	testDefinitions := []string{"test-apply", "apply-object", "failed-render", "suspend-and-deploy", "multi-suspend", "save-process-context", "export", "progressive", "rollout"}
 
 	BeforeEach(func() {
 		setupNamespace(ctx, namespace)
@@ -129,6 +140,8 @@ var _ = Describe("Test Workflow", func() {
 		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
 		Expect(wrObj.Status.Mode.Steps).Should(BeEquivalentTo(v1alpha1.WorkflowModeDAG))
 		Expect(wrObj.Status.Mode.SubSteps).Should(BeEquivalentTo(v1alpha1.WorkflowModeDAG))
+		Expect(wrObj.Labels[wfTypes.LabelWorkflowRunPhase]).Should(Equal(string(v1alpha1.WorkflowStateSuspending)))
+		Expect(wrObj.Labels[wfTypes.LabelWorkflowRunWorkflow]).Should(Equal("workflow"))
 
 		wr2 := wrTemplate.DeepCopy()
 		wr2.Name = "wr-template-with-mode"
@@ -176,6 +189,10 @@ var _ = Describe("Test Workflow", func() {
 		Expect(events[0].EventType).Should(Equal(corev1.EventTypeWarning))
 		Expect(events[0].Reason).Should(Equal(v1alpha1.ReasonGenerate))
 		Expect(events[0].Message).Should(ContainSubstring(v1alpha1.MessageFailedGenerate))
+
+		wrObj := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(wr), wrObj)).Should(BeNil())
+		Expect(wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunValidatedConditionType)).Status).Should(Equal(corev1.ConditionFalse))
 	})
 
 	It("should create workflow context ConfigMap", func() {
@@ -191,6 +208,70 @@ var _ = Describe("Test Workflow", func() {
 		}, cm)).Should(BeNil())
 	})
 
+	It("test finished workflow run is not reconciled again", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "finished-run"
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wr.Status.Finished = true
+		wr.Status.Phase = v1alpha1.WorkflowStateSucceeded
+		Expect(k8sClient.Status().Update(ctx, wr)).Should(BeNil())
+
+		before := testutil.ToFloat64(metrics.WorkflowRunTerminalReconcileCounter.WithLabelValues(string(v1alpha1.WorkflowStateSucceeded)))
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(wr)})
+		Expect(err).Should(BeNil())
+		Expect(result).Should(Equal(reconcile.Result{}))
+		Expect(testutil.ToFloat64(metrics.WorkflowRunTerminalReconcileCounter.WithLabelValues(string(v1alpha1.WorkflowStateSucceeded)))).Should(Equal(before + 1))
+
+		wrObj := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(wr), wrObj)).Should(BeNil())
+		Expect(wrObj.Status.Steps).Should(BeEmpty())
+		Expect(wrObj.Status.ContextBackend).Should(BeNil())
+	})
+
+	It("test start and end time are kept across controller restarts", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "test-wr-times"
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wrKey := client.ObjectKeyFromObject(wr)
+
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		wrObj := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
+		startTime := wrObj.Status.StartTime
+		Expect(startTime.IsZero()).Should(BeFalse())
+		Expect(wrObj.Status.EndTime.IsZero()).Should(BeTrue())
+		Expect(wrObj.Status.Duration).Should(BeNil())
+
+		By("restart the controller in the middle of the run")
+		executor.StepStatusCache.Delete(fmt.Sprintf("%s-%s", wr.Name, wr.Namespace))
+		wfContext.CleanupMemoryStore(wr.Name, wr.Namespace)
+		fakeClock := clocktesting.NewFakeClock(startTime.Add(time.Hour))
+		restarted := *reconciler
+		restarted.Clock = fakeClock
+		tryReconcile(&restarted, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(wrObj.Status.StartTime.Equal(&startTime)).Should(BeTrue())
+
+		Expect(utils.ResumeWorkflow(ctx, k8sClient, wrObj, "")).Should(BeNil())
+		tryReconcile(&restarted, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(wrObj.Status.StartTime.Equal(&startTime)).Should(BeTrue())
+		Expect(wrObj.Status.EndTime.Time.Equal(fakeClock.Now())).Should(BeTrue())
+		Expect(wrObj.Status.Duration.Duration).Should(Equal(time.Hour))
+		// the conditions are stamped by the clock of the controller as well
+		progressing := wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunProgressingConditionType))
+		Expect(progressing.LastTransitionTime.Time.Equal(fakeClock.Now())).Should(BeTrue())
+
+		By("the end time is not overwritten by the following reconciles")
+		fakeClock.Step(time.Hour)
+		tryReconcile(&restarted, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(wrObj.Status.EndTime.Time.Equal(startTime.Add(time.Hour))).Should(BeTrue())
+		Expect(wrObj.Status.Duration.Duration).Should(Equal(time.Hour))
+	})
+
 	It("test workflow suspend", func() {
 		wr := wrTemplate.DeepCopy()
 		wr.Name = "test-wr-suspend"
@@ -208,6 +289,13 @@ var _ = Describe("Test Workflow", func() {
 		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
 		Expect(wrObj.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSuspending))
 		Expect(wrObj.Status.Steps[0].ID).ShouldNot(BeEquivalentTo(""))
+		Expect(wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunValidatedConditionType)).Status).Should(Equal(corev1.ConditionTrue))
+		Expect(wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunContextBackendConditionType)).Status).ShouldNot(Equal(corev1.ConditionTrue))
+		progressing := wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunProgressingConditionType))
+		Expect(progressing.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(progressing.Reason).Should(Equal(v1alpha1.ReasonSuspended))
+		Expect(wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunStalledConditionType)).Status).Should(Equal(corev1.ConditionFalse))
+		Expect(wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunDegradedConditionType)).Status).Should(Equal(corev1.ConditionFalse))
 		// resume
 		Expect(utils.ResumeWorkflow(ctx, k8sClient, wrObj, "")).Should(BeNil())
 		Expect(wrObj.Status.Suspend).Should(BeFalse())
@@ -220,6 +308,9 @@ var _ = Describe("Test Workflow", func() {
 		}, wrObj)).Should(BeNil())
 		Expect(wrObj.Status.Suspend).Should(BeFalse())
 		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		progressing = wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunProgressingConditionType))
+		Expect(progressing.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(progressing.Reason).Should(Equal(v1alpha1.ReasonSucceeded))
 	})
 
 	It("test workflow suspend in sub steps", func() {
@@ -590,6 +681,65 @@ var _ = Describe("Test Workflow", func() {
 		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
 	})
 
+	It("test depends on condition in dag mode", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-depends-on-condition"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name:       "step1",
+					Type:       "test-apply",
+					Properties: &runtime.RawExtension{Raw: []byte(`{"cmd":["sleep","1000"],"image":"busybox"}`)},
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name:       "step2",
+					Type:       "test-apply",
+					Properties: &runtime.RawExtension{Raw: []byte(`{"cmd":["sleep","1000"],"image":"busybox"}`)},
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name:       "step3",
+					Type:       "test-apply",
+					Properties: &runtime.RawExtension{Raw: []byte(`{"cmd":["sleep","1000"],"image":"busybox"}`)},
+					DependsOnCondition: &v1alpha1.DependsOnCondition{
+						AnyOf: []v1alpha1.DependsOnCondition{{Step: "step1"}, {Step: "step2"}},
+					},
+				},
+			},
+		}
+		wr.Spec.Mode = &v1alpha1.WorkflowExecuteMode{
+			Steps: v1alpha1.WorkflowModeDAG,
+		}
+
+		Expect(k8sClient.Create(context.Background(), wr)).Should(BeNil())
+		wrKey := types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+
+		expDeployment := &appsv1.Deployment{}
+		step1Key := types.NamespacedName{Namespace: wr.Namespace, Name: "step1"}
+		step3Key := types.NamespacedName{Namespace: wr.Namespace, Name: "step3"}
+		Expect(k8sClient.Get(ctx, step3Key, expDeployment)).Should(utils.NotFoundMatcher{})
+
+		Expect(k8sClient.Get(ctx, step1Key, expDeployment)).Should(BeNil())
+		expDeployment.Status.Replicas = 1
+		expDeployment.Status.ReadyReplicas = 1
+		Expect(k8sClient.Status().Update(ctx, expDeployment)).Should(BeNil())
+
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+
+		// step2 is still running, but step3 only needs one of step1 and step2 to succeed
+		expDeployment = &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, step3Key, expDeployment)).Should(BeNil())
+
+		checkRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+	})
+
 	It("test failed after retries in step mode with suspend on failure", func() {
 		defer featuregatetesting.SetFeatureGateDuringTest(&testing.T{}, utilfeature.DefaultFeatureGate, features.EnableSuspendOnFailure, true)()
 		wr := wrTemplate.DeepCopy()
@@ -633,6 +783,8 @@ var _ = Describe("Test Workflow", func() {
 			Expect(checkRun.Status.Message).Should(BeEquivalentTo(""))
 			Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
 			Expect(checkRun.Status.Steps[1].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+			Expect(checkRun.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunProgressingConditionType)).Status).Should(Equal(corev1.ConditionTrue))
+			Expect(checkRun.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunDegradedConditionType)).Status).Should(Equal(corev1.ConditionTrue))
 		}
 
 		By("workflowrun should be suspended after failed max reconciles")
@@ -642,6 +794,9 @@ var _ = Describe("Test Workflow", func() {
 		Expect(checkRun.Status.Message).Should(BeEquivalentTo(wfTypes.MessageSuspendFailedAfterRetries))
 		Expect(checkRun.Status.Steps[1].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
 		Expect(checkRun.Status.Steps[1].Reason).Should(BeEquivalentTo(wfTypes.StatusReasonFailedAfterRetries))
+		stalled := checkRun.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunStalledConditionType))
+		Expect(stalled.Status).Should(Equal(corev1.ConditionTrue))
+		Expect(stalled.Reason).Should(Equal(v1alpha1.ReasonSuspendedOnFailure))
 
 		By("resume the suspended workflow run")
 		Expect(utils.ResumeWorkflow(ctx, k8sClient, checkRun, "")).Should(BeNil())
@@ -651,6 +806,7 @@ var _ = Describe("Test Workflow", func() {
 		Expect(checkRun.Status.Message).Should(BeEquivalentTo(""))
 		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
 		Expect(checkRun.Status.Steps[1].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(checkRun.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunStalledConditionType)).Status).Should(Equal(corev1.ConditionFalse))
 	})
 
 	It("test reconcile with patch status at once", func() {
@@ -805,6 +961,120 @@ var _ = Describe("Test Workflow", func() {
 		Expect(checkRun.Status.Steps[1].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSkipped))
 	})
 
+	It("test description and docs of the step", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-step-docs"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "step1",
+					Type: "failed-render",
+					Meta: &v1alpha1.WorkflowStepMeta{
+						Description: "Render the manifests",
+						Docs:        "https://example.com/runbooks/render",
+					},
+					Properties: &runtime.RawExtension{Raw: []byte(`{"cmd":["sleep","1000"],"image":"busybox"}`)},
+				},
+			},
+		}
+
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wrKey := types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+		checkRun := &v1alpha1.WorkflowRun{}
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Steps[0].Description).Should(Equal("Render the manifests"))
+		Expect(checkRun.Status.Steps[0].Docs).Should(Equal("https://example.com/runbooks/render"))
+
+		for i := 0; i < wfTypes.MaxWorkflowStepErrorRetryTimes; i++ {
+			tryReconcile(reconciler, wr.Name, wr.Namespace)
+		}
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		events, err := recorder.GetEventsWithName(wr.Name)
+		Expect(err).Should(BeNil())
+		var messages []string
+		for _, e := range events {
+			if e.Reason == v1alpha1.ReasonStepFailed {
+				messages = append(messages, e.Message)
+			}
+		}
+		Expect(messages).Should(HaveLen(1))
+		Expect(messages[0]).Should(HavePrefix("Step step1 (Render the manifests, docs: https://example.com/runbooks/render) is failed: "))
+	})
+
+	It("test prune the status of the finished steps", func() {
+		wfTypes.PruneFinishedStepStatus = true
+		defer func() {
+			wfTypes.PruneFinishedStepStatus = false
+		}()
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-prune-status"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step1", Type: "suspend"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step2", Type: "suspend"}},
+		}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wrKey := types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+		checkRun := &v1alpha1.WorkflowRun{}
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(utils.ResumeWorkflow(ctx, k8sClient, checkRun, "")).Should(BeNil())
+
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
+		Expect(checkRun.Status.Steps[0].StepStatus).Should(Equal(v1alpha1.StepStatus{
+			ID:    checkRun.Status.Steps[0].ID,
+			Name:  "step1",
+			Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+		}))
+		Expect(checkRun.Status.Steps[1].Type).Should(Equal("suspend"))
+		Expect(checkRun.Status.Steps[1].FirstExecuteTime.IsZero()).Should(BeFalse())
+
+		Expect(utils.ResumeWorkflow(ctx, k8sClient, checkRun, "")).Should(BeNil())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		for _, step := range checkRun.Status.Steps {
+			Expect(step.Type).Should(BeEmpty())
+			Expect(step.FirstExecuteTime.IsZero()).Should(BeTrue())
+		}
+
+		// the full status is restored on demand
+		Expect(utils.HydrateStatus(ctx, checkRun)).Should(BeNil())
+		for _, step := range checkRun.Status.Steps {
+			Expect(step.Type).Should(Equal("suspend"))
+			Expect(step.FirstExecuteTime.IsZero()).Should(BeFalse())
+			Expect(step.LastExecuteTime.IsZero()).Should(BeFalse())
+		}
+	})
+
+	It("test keep the status of the finished steps if it's not archived", func() {
+		wfTypes.PruneFinishedStepStatus = true
+		defer func() {
+			wfTypes.PruneFinishedStepStatus = false
+		}()
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-prune-status-not-archived"
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		status := &v1alpha1.WorkflowRunStatus{Steps: []v1alpha1.WorkflowStepStatus{{StepStatus: v1alpha1.StepStatus{
+			ID:    "step1-id",
+			Name:  "step1",
+			Type:  "suspend",
+			Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+		}}}}
+		patcher := &workflowRunPatcher{Client: k8sClient, run: wr}
+		patcher.setArchived(fmt.Errorf("failed to save the context"))
+		Expect(patcher.patchStatus(ctx, status, false)).Should(BeNil())
+		Expect(wr.Status.Steps[0].Type).Should(Equal("suspend"))
+
+		patcher.setArchived(nil)
+		Expect(patcher.patchStatus(ctx, status, false)).Should(BeNil())
+		Expect(wr.Status.Steps[0].Type).Should(BeEmpty())
+		Expect(status.Steps[0].Type).Should(Equal("suspend"))
+	})
+
 	It("test workflow run with mode", func() {
 		wr := wrTemplate.DeepCopy()
 		wr.Name = "wr-mode"
@@ -1082,6 +1352,159 @@ var _ = Describe("Test Workflow", func() {
 		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
 	})
 
+	It("test export outputs to secret and config map", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-export"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "step1",
+					Type: "apply-object",
+					Outputs: v1alpha1.StepOutputs{
+						{
+							Name:      "run-name",
+							ValueFrom: "context.name",
+						},
+						{
+							Name:      "replicas",
+							ValueFrom: "parameter.value.spec.replicas",
+						},
+					},
+					Properties: &runtime.RawExtension{Raw: []byte(`{"value":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"export-source"},"spec":{"replicas":3}}}`)},
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "export-secret",
+					Type: "export",
+					Inputs: v1alpha1.StepInputs{
+						{
+							From:         "run-name",
+							ParameterKey: "data.name",
+						},
+						{
+							From:         "replicas",
+							ParameterKey: "data.replicas",
+						},
+					},
+					Properties: &runtime.RawExtension{Raw: []byte(`{"name":"exported-secret","kind":"Secret","data":{"static":{"a":"b"}}}`)},
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "export-config",
+					Type: "export",
+					Inputs: v1alpha1.StepInputs{
+						{
+							From:         "run-name",
+							ParameterKey: "data.name",
+						},
+					},
+					Properties: &runtime.RawExtension{Raw: []byte(`{"name":"exported-config"}`)},
+				},
+			},
+		}
+		Expect(k8sClient.Create(context.Background(), wr)).Should(BeNil())
+		wrKey := types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+
+		checkRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: wr.Namespace, Name: "exported-secret"}, secret)).Should(BeNil())
+		Expect(string(secret.Data["name"])).Should(Equal("wr-export"))
+		Expect(string(secret.Data["replicas"])).Should(Equal("3"))
+		Expect(string(secret.Data["static"])).Should(Equal(`{"a":"b"}`))
+		Expect(secret.Labels[wfTypes.LabelWorkflowRunName]).Should(Equal(wr.Name))
+		Expect(secret.Labels[wfTypes.LabelWorkflowRunNamespace]).Should(Equal(wr.Namespace))
+
+		cm := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: wr.Namespace, Name: "exported-config"}, cm)).Should(BeNil())
+		Expect(cm.Data["name"]).Should(Equal("wr-export"))
+		Expect(cm.Labels[wfTypes.LabelWorkflowRunName]).Should(Equal(wr.Name))
+	})
+
+	It("test record and replay provider trace", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-provider-trace"
+		wr.Annotations = map[string]string{wfTypes.AnnotationRecordProviderTrace: "true"}
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name:       "step1",
+					Type:       "apply-object",
+					Properties: &runtime.RawExtension{Raw: []byte(fmt.Sprintf(`{"value":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"trace-source","namespace":"%s"},"data":{"a":"b"}}}`, namespace))},
+				},
+			},
+		}
+		Expect(k8sClient.Create(context.Background(), wr)).Should(BeNil())
+		wrKey := types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+
+		checkRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		wfCtx, err := wfContext.LoadContext(ctx, wr.Namespace, wr.Name, checkRun.Status.ContextBackend.Name)
+		Expect(err).Should(BeNil())
+		calls, err := providertypes.LoadProviderCalls(wfCtx)
+		Expect(err).Should(BeNil())
+		Expect(len(calls)).Should(BeEquivalentTo(1))
+		Expect(calls[0].Provider).Should(BeEquivalentTo("kube.apply"))
+
+		By("replay the run without applying the resource")
+		cm := &corev1.ConfigMap{}
+		cmKey := types.NamespacedName{Namespace: wr.Namespace, Name: "trace-source"}
+		Expect(k8sClient.Get(ctx, cmKey, cm)).Should(BeNil())
+		Expect(k8sClient.Delete(ctx, cm)).Should(BeNil())
+		replay := wr.DeepCopy()
+		replay.Name = "wr-provider-trace-replay"
+		replay.Annotations = nil
+		logCtx := monitorContext.NewTraceContext(wfTypes.SetNamespaceInCtx(ctx, namespace), "")
+		instance, err := generator.GenerateWorkflowInstance(logCtx, k8sClient, replay)
+		Expect(err).Should(BeNil())
+		runners, err := generator.GenerateRunners(logCtx, instance, wfTypes.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+		state, err := executor.New(instance, executor.WithProviderTrace(providertypes.NewProviderReplayer(calls))).ExecuteRunners(logCtx, runners)
+		Expect(err).Should(BeNil())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(k8sClient.Get(ctx, cmKey, cm)).Should(utils.NotFoundMatcher{})
+	})
+
+	It("test progressive step", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-progressive"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name:       "step1",
+					Type:       "progressive",
+					Properties: &runtime.RawExtension{Raw: []byte(fmt.Sprintf(`{"stages":[{"value":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"progressive","namespace":"%[1]s"},"data":{"weight":"20"}}},{"value":{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"progressive","namespace":"%[1]s"},"data":{"weight":"100"}}}]}`, namespace))},
+				},
+			},
+		}
+		Expect(k8sClient.Create(context.Background(), wr)).Should(BeNil())
+		wrKey := types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+		cmKey := types.NamespacedName{Namespace: wr.Namespace, Name: "progressive"}
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+
+		checkRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(checkRun.Status.Steps[0].Message).Should(BeEquivalentTo("Progressing to stage 2/2"))
+		cm := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, cmKey, cm)).Should(BeNil())
+		Expect(cm.Data["weight"]).Should(BeEquivalentTo("20"))
+
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(k8sClient.Get(ctx, cmKey, cm)).Should(BeNil())
+		Expect(cm.Data["weight"]).Should(BeEquivalentTo("100"))
+	})
+
 	It("test if always", func() {
 		wr := wrTemplate.DeepCopy()
 		wr.Name = "wr-if-always"
@@ -1500,6 +1923,71 @@ var _ = Describe("Test Workflow", func() {
 		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
 	})
 
+	It("test sub phase of the running step", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-sub-phase"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:       "step-sub-phase",
+				Type:       "rollout",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"cmd":["sleep","1000"],"image":"busybox"}`)},
+			},
+		}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wrKey := types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+
+		checkRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(checkRun.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseRunning))
+		Expect(checkRun.Status.Steps[0].SubPhase).Should(Equal("rolling-out"))
+		events, err := recorder.GetEventsWithName(wr.Name)
+		Expect(err).Should(BeNil())
+		var messages []string
+		for _, e := range events {
+			if e.Reason == v1alpha1.ReasonStepSubPhase {
+				messages = append(messages, e.Message)
+			}
+		}
+		Expect(messages).Should(Equal([]string{"Step step-sub-phase is running (rolling-out)"}))
+		Expect(checkRun.Status.Steps[0].Metadata).Should(Equal(map[string]string{"deployment": "step-sub-phase"}))
+		messages = nil
+		for _, e := range events {
+			if e.Reason == v1alpha1.ReasonStepMetadata {
+				messages = append(messages, e.Message)
+			}
+		}
+		Expect(messages).Should(Equal([]string{"Step step-sub-phase reports the metadata deployment=step-sub-phase"}))
+
+		// the events are not recorded again if the sub phase and the metadata are not changed
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		events, err = recorder.GetEventsWithName(wr.Name)
+		Expect(err).Should(BeNil())
+		count, metadataCount := 0, 0
+		for _, e := range events {
+			switch e.Reason {
+			case v1alpha1.ReasonStepSubPhase:
+				count++
+			case v1alpha1.ReasonStepMetadata:
+				metadataCount++
+			}
+		}
+		Expect(count).Should(Equal(1))
+		Expect(metadataCount).Should(Equal(1))
+
+		expDeployment := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: wr.Namespace, Name: "step-sub-phase"}, expDeployment)).Should(BeNil())
+		expDeployment.Status.Replicas = 1
+		expDeployment.Status.ReadyReplicas = 1
+		Expect(k8sClient.Status().Update(ctx, expDeployment)).Should(BeNil())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(checkRun.Status.Steps[0].SubPhase).Should(BeEmpty())
+	})
+
 	It("test multiple suspend", func() {
 		wr := wrTemplate.DeepCopy()
 		wr.Name = "wr-multi-suspend"
@@ -1861,6 +2349,7 @@ var _ = Describe("Test Workflow", func() {
 				{
 					Name:       "step4",
 					Type:       "save-process-context",
+					DependsOn:  []string{"step3"},
 					Properties: &runtime.RawExtension{Raw: []byte(`{"name":"process-context-step4"}`)},
 				},
 			},
@@ -1915,14 +2404,362 @@ var _ = Describe("Test Workflow", func() {
 		Expect(step4Ctx["stepGroupName"]).Should(Equal("group2"))
 		Expect(step5Ctx["stepGroupName"]).Should(Equal(""))
 
+		By("check context.dependents")
+		Expect(step1Ctx["dependents"]).Should(Equal(""))
+		Expect(step3Ctx["dependents"]).Should(Equal("step4"))
+		Expect(step4Ctx["dependents"]).Should(Equal(""))
+
 		By("check context.spanID")
 		spanID := strings.Split(step1Ctx["spanID"], ".")[0]
 		for _, pCtx := range processCtxMap {
 			Expect(pCtx["spanID"]).Should(ContainSubstring(spanID))
 		}
 	})
+
+	It("test step context metadata", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "test-step-context-metadata"
+		wr.Labels = map[string]string{"tenant": "tenant-a"}
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name: "suspend",
+				Type: "suspend",
+			},
+		}, {
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:       "step1",
+				Type:       "save-process-context",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"name":"process-context-metadata"}`)},
+			},
+		}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wrKey := client.ObjectKeyFromObject(wr)
+
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		wrObj := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
+		Expect(wrObj.Status.Metadata.Labels).Should(Equal(map[string]string{"tenant": "tenant-a"}))
+
+		By("the labels changed during the run are ignored")
+		wrObj.Labels["tenant"] = "tenant-b"
+		Expect(k8sClient.Update(ctx, wrObj)).Should(BeNil())
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(utils.ResumeWorkflow(ctx, k8sClient, wrObj, "")).Should(BeNil())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		cmList := new(corev1.ConfigMapList)
+		Expect(k8sClient.List(ctx, cmList, client.MatchingLabels{"process.context.data": "true"})).Should(BeNil())
+		found := false
+		for _, cm := range cmList.Items {
+			if cm.Name == "process-context-metadata" {
+				found = true
+				metadata := struct {
+					Labels map[string]string `json:"labels"`
+				}{}
+				Expect(json.Unmarshal([]byte(cm.Data["metadata"]), &metadata)).Should(BeNil())
+				Expect(metadata.Labels["tenant"]).Should(Equal("tenant-a"))
+			}
+		}
+		Expect(found).Should(BeTrue())
+	})
+
+	It("test pause the controller by the config map", func() {
+		key, err := ParsePauseConfigMap("vela-system/workflow-pause")
+		Expect(err).Should(BeNil())
+		Expect(key).Should(Equal(types.NamespacedName{Namespace: "vela-system", Name: "workflow-pause"}))
+		_, err = ParsePauseConfigMap("workflow-pause")
+		Expect(err).ShouldNot(BeNil())
+
+		pauseCM := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "workflow-pause", Namespace: namespace},
+			Data:       map[string]string{PauseConfigMapKey: "true"},
+		}
+		Expect(k8sClient.Create(ctx, pauseCM)).Should(BeNil())
+		reconciler.PauseConfigMap = client.ObjectKeyFromObject(pauseCM)
+		reader := &countingReader{Reader: k8sClient}
+		reconciler.APIReader = reader
+		defer func() {
+			reconciler.PauseConfigMap = types.NamespacedName{}
+			reconciler.APIReader = nil
+		}()
+
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "test-pause-controller"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name: "step1",
+				Type: "step-group",
+			},
+		}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wrKey := client.ObjectKeyFromObject(wr)
+
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		wrObj := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(wrObj.Status.Steps).Should(BeEmpty())
+		paused := wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunPausedConditionType))
+		Expect(paused.Status).Should(Equal(corev1.ConditionTrue))
+		Expect(paused.Reason).Should(Equal(v1alpha1.ReasonControllerPaused))
+		// the pause config map is read by the API reader instead of the cached client
+		Expect(reader.gets).ShouldNot(BeZero())
+
+		By("the held steps are started once the controller is resumed")
+		pauseCM.Data[PauseConfigMapKey] = "false"
+		Expect(k8sClient.Update(ctx, pauseCM)).Should(BeNil())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, wrObj)).Should(BeNil())
+		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		paused = wrObj.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunPausedConditionType))
+		Expect(paused.Status).Should(Equal(corev1.ConditionFalse))
+		Expect(paused.Reason).Should(Equal(v1alpha1.ReasonControllerResumed))
+	})
+
+	It("test set custom status", func() {
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "test-set-status"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:       "step1",
+				Type:       "set-status",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"status":{"canary":"50%","replicas":2,"removed":"value"}}`)},
+			},
+		}, {
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:       "step2",
+				Type:       "set-status",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"status":{"canary":"100%","removed":null}}`)},
+			},
+		}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		wrObj := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{
+			Name:      wr.Name,
+			Namespace: wr.Namespace,
+		}, wrObj)).Should(BeNil())
+
+		Expect(wrObj.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(len(wrObj.Status.Custom)).Should(Equal(2))
+		Expect(string(wrObj.Status.Custom["canary"].Raw)).Should(Equal(`"100%"`))
+		Expect(string(wrObj.Status.Custom["replicas"].Raw)).Should(Equal(`2`))
+	})
+
+	It("test stages with outputs handed off", func() {
+		stepOf := func(name string, base v1alpha1.WorkflowStepBase) v1alpha1.WorkflowStep {
+			base.Name = name
+			base.Type = "set-status"
+			base.Properties = &runtime.RawExtension{Raw: []byte(`{"status":{"stage":"` + name + `"}}`)}
+			return v1alpha1.WorkflowStep{WorkflowStepBase: base}
+		}
+		build := &v1alpha1.Workflow{
+			ObjectMeta: metav1.ObjectMeta{Name: "stage-build", Namespace: namespace},
+			WorkflowSpec: v1alpha1.WorkflowSpec{Steps: []v1alpha1.WorkflowStep{
+				stepOf("build", v1alpha1.WorkflowStepBase{Outputs: v1alpha1.StepOutputs{{Name: "image", ValueFrom: "context.name"}}}),
+			}},
+		}
+		deploy := &v1alpha1.Workflow{
+			ObjectMeta: metav1.ObjectMeta{Name: "stage-deploy", Namespace: namespace},
+			WorkflowSpec: v1alpha1.WorkflowSpec{Steps: []v1alpha1.WorkflowStep{
+				stepOf("deploy", v1alpha1.WorkflowStepBase{Inputs: v1alpha1.StepInputs{{From: "image", ParameterKey: "image"}}}),
+			}},
+		}
+		Expect(k8sClient.Create(ctx, build)).Should(BeNil())
+		Expect(k8sClient.Create(ctx, deploy)).Should(BeNil())
+
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-stages"
+		wr.Spec = v1alpha1.WorkflowRunSpec{
+			InitVars: &runtime.RawExtension{Raw: []byte(`{"env":"prod"}`)},
+			Stages: []v1alpha1.RunStage{
+				{Name: "build", WorkflowRef: "stage-build", Outputs: []string{"image"}},
+				{Name: "deploy", WorkflowRef: "stage-deploy"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wrKey := types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+
+		By("the run of the first stage is created and owned by the run")
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		checkRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(checkRun.Status.Message).Should(Equal("Stage 1/2 build is initializing"))
+		Expect(checkRun.Status.Stages).Should(Equal([]v1alpha1.StageStatus{{Name: "build", Run: "wr-stages-build"}}))
+		buildRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "wr-stages-build"}, buildRun)).Should(BeNil())
+		Expect(metav1.IsControlledBy(buildRun, checkRun)).Should(BeTrue())
+		Expect(buildRun.Labels[wfTypes.LabelWorkflowRunStage]).Should(Equal("build"))
+		Expect(string(buildRun.Spec.InitVars.Raw)).Should(Equal(`{"env":"prod"}`))
+
+		By("the outputs of the succeeded stage are handed off to the next stage")
+		tryReconcile(reconciler, buildRun.Name, buildRun.Namespace)
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Message).Should(Equal("Stage 2/2 deploy is initializing"))
+		Expect(checkRun.Status.Stages[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		deployRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "wr-stages-deploy"}, deployRun)).Should(BeNil())
+		Expect(string(deployRun.Spec.InitVars.Raw)).Should(MatchJSON(`{"env":"prod","image":"wr-stages-build"}`))
+
+		By("the run is succeeded once all the stages are succeeded")
+		tryReconcile(reconciler, deployRun.Name, deployRun.Namespace)
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(checkRun.Status.Finished).Should(BeTrue())
+		Expect(checkRun.Status.Message).Should(Equal("All the 2 stages are succeeded"))
+		Expect(len(checkRun.Status.Stages)).Should(Equal(2))
+
+		By("the run is terminated with the run of its current stage")
+		wr = wrTemplate.DeepCopy()
+		wr.Name = "wr-stages-terminate"
+		wr.Spec = v1alpha1.WorkflowRunSpec{Stages: []v1alpha1.RunStage{{Name: "build", WorkflowRef: "stage-build"}}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		wrKey = types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(utils.TerminateWorkflow(ctx, k8sClient, checkRun)).Should(BeNil())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, wrKey, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateTerminated))
+		Expect(checkRun.Status.Message).Should(Equal("Stage 1/1 build is terminated"))
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "wr-stages-terminate-build"}, buildRun)).Should(BeNil())
+		Expect(buildRun.Status.Terminated).Should(BeTrue())
+
+		By("the parent label of the run with the long name is hashed")
+		wr = wrTemplate.DeepCopy()
+		wr.Name = "wr-stages-" + strings.Repeat("long", 20)
+		wr.Spec = v1alpha1.WorkflowRunSpec{Stages: []v1alpha1.RunStage{{Name: "build", WorkflowRef: "stage-build"}}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: wr.Name + "-build"}, buildRun)).Should(BeNil())
+		Expect(buildRun.Labels[wfTypes.LabelWorkflowRunParent]).Should(Equal(utils.LabelValue(wr.Name)))
+		Expect(len(buildRun.Labels[wfTypes.LabelWorkflowRunParent])).Should(Equal(63))
+
+		By("the run is failed if the name of the stage run is too long")
+		wr = wrTemplate.DeepCopy()
+		wr.Name = "wr-stages-" + strings.Repeat("long", 60)
+		wr.Spec = v1alpha1.WorkflowRunSpec{Stages: []v1alpha1.RunStage{{Name: "build", WorkflowRef: "stage-build"}}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(checkRun.Status.Message).Should(ContainSubstring("invalid name of the stage build"))
+	})
+
+	It("test steps with unknown step types", func() {
+		unknownEvents := func(name string) []string {
+			events, err := recorder.GetEventsWithName(name)
+			Expect(err).Should(BeNil())
+			var messages []string
+			for _, e := range events {
+				if e.Reason == v1alpha1.ReasonUnknownStepType {
+					messages = append(messages, e.Message)
+				}
+			}
+			return messages
+		}
+		newRun := func(name string, policy v1alpha1.UnknownStepTypePolicy) *v1alpha1.WorkflowRun {
+			wr := wrTemplate.DeepCopy()
+			wr.Name = name
+			wr.Spec.UnknownStepTypePolicy = policy
+			wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step-1", Type: "not-registered"},
+			}}
+			Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+			return wr
+		}
+
+		By("the step with the unknown type is failed by default")
+		wr := newRun("wr-unknown-fail", "")
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		checkRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(checkRun.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(checkRun.Status.Steps[0].Reason).Should(Equal(wfTypes.StatusReasonUnknownStepType))
+		Expect(unknownEvents(wr.Name)).Should(Equal([]string{`Step step-1 of the unknown type not-registered is failed: unknown step type "not-registered", no builtin step type, template or WorkflowStepDefinition is found for it`}))
+
+		By("the step with the unknown type is skipped")
+		wr = newRun("wr-unknown-skip", v1alpha1.UnknownStepTypePolicySkip)
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(checkRun.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSkipped))
+		Expect(unknownEvents(wr.Name)).Should(Equal([]string{"Step step-1 of the unknown type not-registered is skipped: Skipped since the step type not-registered is not registered"}))
+
+		By("the step with the unknown type is pending until the type is registered")
+		wr = newRun("wr-unknown-pending", v1alpha1.UnknownStepTypePolicyPending)
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: wr.Namespace, Name: wr.Name}, checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(checkRun.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhasePending))
+		Expect(checkRun.Status.Steps[0].Message).Should(Equal("Pending on StepType: not-registered is not registered"))
+		// the event is not recorded again while the step is pending
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(unknownEvents(wr.Name)).Should(Equal([]string{"Step step-1 of the unknown type not-registered is pending: Pending on StepType: not-registered is not registered"}))
+	})
+
+	It("test suspend and terminate by watchers", func() {
+		watcher.RegisterChecker("test-breached", breachedChecker{})
+		wr := wrTemplate.DeepCopy()
+		wr.Name = "wr-watcher-suspend"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:       "step1",
+				Type:       "test-apply",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"cmd":["sleep","1000"],"image":"busybox"}`)},
+			},
+		}}
+		wr.Spec.Watchers = []v1alpha1.RunWatcher{{Name: "error-rate", Type: "test-breached"}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		// the watchers are checked once the run is started
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		checkRun := &v1alpha1.WorkflowRun{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(wr), checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Watchers).Should(BeEmpty())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(wr), checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Suspend).Should(BeTrue())
+		Expect(checkRun.Status.Phase).Should(Equal(v1alpha1.WorkflowStateSuspending))
+		Expect(checkRun.Status.Watchers).Should(HaveLen(1))
+		Expect(checkRun.Status.Watchers[0].Message).Should(Equal("error rate is too high"))
+		events, err := recorder.GetEventsWithName(wr.Name)
+		Expect(err).Should(BeNil())
+		Expect(events[0].Reason).Should(Equal(v1alpha1.ReasonWatch))
+		Expect(events[0].Message).Should(Equal("watcher error-rate is breached 1 times: error rate is too high"))
+
+		wr = wrTemplate.DeepCopy()
+		wr.Name = "wr-watcher-terminate"
+		wr.Spec.WorkflowSpec.Steps = []v1alpha1.WorkflowStep{{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:       "step1",
+				Type:       "test-apply",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"cmd":["sleep","1000"],"image":"busybox"}`)},
+			},
+		}}
+		wr.Spec.Watchers = []v1alpha1.RunWatcher{{Name: "error-rate", Type: "test-breached", Action: v1alpha1.WatcherActionTerminate}}
+		Expect(k8sClient.Create(ctx, wr)).Should(BeNil())
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		tryReconcile(reconciler, wr.Name, wr.Namespace)
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(wr), checkRun)).Should(BeNil())
+		Expect(checkRun.Status.Terminated).Should(BeTrue())
+		Expect(checkRun.Status.Phase).Should(Equal(v1alpha1.WorkflowStateTerminated))
+	})
 })
 
+type breachedChecker struct{}
+
+func (breachedChecker) Check(_ context.Context, _ *runtime.RawExtension) (bool, string, error) {
+	return true, "error rate is too high", nil
+}
+
 func reconcileWithReturn(r *WorkflowRunReconciler, name, ns string) error {
 	wrKey := client.ObjectKey{
 		Name:      name,
@@ -1959,3 +2796,13 @@ func setupTestDefinitions(ctx context.Context, defs []string, namespace string)
 		})).Should(SatisfyAny(BeNil(), &utils.AlreadyExistMatcher{}))
 	}
 }
+
+type countingReader struct {
+	client.Reader
+	gets int
+}
+
+func (r *countingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	r.gets++
+	return r.Reader.Get(ctx, key, obj, opts...)
+}
@@ -20,16 +20,22 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlBuilder "sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	ctrlEvent "sigs.k8s.io/controller-runtime/pkg/event"
@@ -43,13 +49,18 @@ import (
 
 	"github.com/kubevela/workflow/api/condition"
 	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/callback"
 	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/executor"
 	"github.com/kubevela/workflow/pkg/features"
 	"github.com/kubevela/workflow/pkg/generator"
 	"github.com/kubevela/workflow/pkg/monitor/metrics"
+	"github.com/kubevela/workflow/pkg/objectwatch"
+	"github.com/kubevela/workflow/pkg/providers/exec"
 	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
+	"github.com/kubevela/workflow/pkg/watcher"
 )
 
 // Args args used by controller
@@ -58,6 +69,25 @@ type Args struct {
 	ConcurrentReconciles int
 	// IgnoreWorkflowWithoutControllerRequirement indicates that workflow controller will not process the workflowrun without 'workflowrun.oam.dev/controller-version-require' annotation.
 	IgnoreWorkflowWithoutControllerRequirement bool
+	// ShardPredicate filters the workflowruns that should be handled by this controller, nil means all the workflowruns
+	ShardPredicate predicate.Predicate
+	// Paused pauses the controller for maintenance, the steps that are not started are held and the in-flight steps
+	// are allowed to finish
+	Paused bool
+	// PauseConfigMap is the config map to pause the controller at runtime by setting `paused: "true"` in its data,
+	// it's disabled if the name is empty
+	PauseConfigMap k8stypes.NamespacedName
+	// AuditSink records the audit entries of the executed steps, the finished runs and the applied approvals, the
+	// audit is disabled if it's nil
+	AuditSink types.AuditSink
+	// TenantLimiter limits the concurrent reconciles of the workflowruns of every tenant, no limit if it's nil
+	TenantLimiter *TenantLimiter
+	// ApproverVerified indicates the approvers of the approvals are set from the users of the requests by the
+	// admission webhook, the approval gates with approvers can't be approved if it's false
+	ApproverVerified bool
+	// SystemDefinitionNamespace is the namespace of the system step definitions that the admission webhook looks up
+	// the step types in
+	SystemDefinitionNamespace string
 }
 
 // WorkflowRunReconciler reconciles a WorkflowRun object
@@ -66,12 +96,20 @@ type WorkflowRunReconciler struct {
 	Scheme            *runtime.Scheme
 	Recorder          event.Recorder
 	ControllerVersion string
+	// Clock provides the time to execute the workflowrun, the real clock is used if it's nil
+	Clock types.Clock
+	// APIReader reads the objects from the API server without the cache, e.g. the pause config map, so that the
+	// controller doesn't watch all the objects of their kinds. The client is used if it's nil
+	APIReader client.Reader
 	Args
 }
 
 type workflowRunPatcher struct {
 	client.Client
 	run *v1alpha1.WorkflowRun
+	// archived is set once the full status of the finished steps is archived in this reconcile, the status is only
+	// pruned after that
+	archived bool
 }
 
 var (
@@ -83,6 +121,10 @@ var (
 // +kubebuilder:rbac:groups=core.oam.dev,resources=workflowruns,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core.oam.dev,resources=workflowruns/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core.oam.dev,resources=workflowruns/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;create;delete
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update
 func (r *WorkflowRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	ctx, cancel := context.WithTimeout(ctx, ReconcileTimeout)
 	defer cancel()
@@ -92,6 +134,7 @@ func (r *WorkflowRunReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		types.LabelWorkflowRunName:      req.Name,
 		types.LabelWorkflowRunNamespace: req.Namespace,
 	})
+	ctx = providertypes.WithClock(ctx, r.clock())
 
 	logCtx := monitorContext.NewTraceContext(ctx, "").AddTag("workflowrun", req.String())
 	logCtx.Info("Start reconcile workflowrun")
@@ -113,28 +156,86 @@ func (r *WorkflowRunReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
-	timeReporter := timeReconcile(run)
-	defer timeReporter()
-
+	// the finished workflow run won't be executed again unless it's restarted, short-circuit it without requeue
 	if run.Status.Finished {
+		metrics.WorkflowRunTerminalReconcileCounter.WithLabelValues(string(run.Status.Phase)).Inc()
+		if !run.DeletionTimestamp.IsZero() {
+			executor.StepStatusCache.Delete(fmt.Sprintf("%s-%s", run.Name, run.Namespace))
+			wfContext.CleanupMemoryStore(run.Name, run.Namespace)
+			callback.DefaultDispatcher.Forget(run.UID)
+		}
+		// the completion webhook is retried until it's delivered or dead-lettered
+		if run.DeletionTimestamp.IsZero() && callback.Pending(run) {
+			requeueAfter := r.deliverCompletionWebhook(logCtx, run)
+			patcher := &workflowRunPatcher{Client: r.Client, run: run}
+			return ctrl.Result{RequeueAfter: requeueAfter}, patcher.patchStatus(logCtx, &run.Status, false)
+		}
+		// the resources applied by the run are torn down one by one once it's requested
+		if teardownRequested(run) {
+			return r.teardown(logCtx, run)
+		}
 		logCtx.Info("WorkflowRun is finished, skip reconcile")
 		return ctrl.Result{}, nil
 	}
 
+	if r.TenantLimiter != nil {
+		tenant := r.TenantLimiter.TenantOf(run)
+		release, ok := r.TenantLimiter.Acquire(tenant)
+		if !ok {
+			logCtx.Info("requeue workflowrun: the tenant reaches its concurrent reconciles", "tenant", tenant)
+			return ctrl.Result{RequeueAfter: TenantThrottleRequeueInterval}, nil
+		}
+		defer release()
+	}
+
+	paused, err := r.isPaused(ctx)
+	if err != nil {
+		logCtx.Error(err, "[check controller paused]")
+		return ctrl.Result{}, err
+	}
+
+	timeReporter := timeReconcile(run, r.clock())
+	defer timeReporter()
+
+	// the run with stages executes its stages as the runs owned by it instead of the steps
+	if len(run.Spec.Stages) > 0 {
+		return r.reconcileStages(logCtx, run)
+	}
+
+	// the pruned status of the finished steps is restored, so that the steps are executed with the full status
+	if err := utils.HydrateStatus(ctx, run); err != nil {
+		logCtx.Error(err, "[hydrate status]")
+		return ctrl.Result{}, err
+	}
+
+	// the watchers are checked once the run is started and not while it's suspended, so the run can be resumed
+	// once the signal is recovered
+	var watchResult watcher.Result
+	if !run.Status.StartTime.IsZero() && !run.Status.Suspend && !run.Status.Terminated {
+		watchResult = watcher.Watch(logCtx, run, r.clock().Now())
+		if err := r.handleBreachedWatcher(logCtx, run, watchResult); err != nil {
+			logCtx.Error(err, "[watch workflowrun]")
+			return ctrl.Result{}, err
+		}
+	}
+
 	instance, err := generator.GenerateWorkflowInstance(ctx, r.Client, run)
 	if err != nil {
 		logCtx.Error(err, "[generate workflow instance]")
 		r.Recorder.Event(run, event.Warning(v1alpha1.ReasonGenerate, errors.WithMessage(err, v1alpha1.MessageFailedGenerate)))
 		run.Status.Phase = v1alpha1.WorkflowStateInitializing
+		run.SetConditions(condition.ErrorCondition(v1alpha1.WorkflowRunValidatedConditionType, err))
 		return r.endWithNegativeCondition(logCtx, run, condition.ErrorCondition(v1alpha1.WorkflowRunConditionType, err))
 	}
 	isUpdate := instance.Status.Message != ""
+	hasFailures := len(instance.Status.Failures) > 0
 
 	runners, err := generator.GenerateRunners(logCtx, instance, types.StepGeneratorOptions{})
 	if err != nil {
 		logCtx.Error(err, "[generate runners]")
 		r.Recorder.Event(run, event.Warning(v1alpha1.ReasonGenerate, errors.WithMessage(err, v1alpha1.MessageFailedGenerate)))
 		run.Status.Phase = v1alpha1.WorkflowStateInitializing
+		run.SetConditions(condition.ErrorCondition(v1alpha1.WorkflowRunValidatedConditionType, err))
 		return r.endWithNegativeCondition(logCtx, run, condition.ErrorCondition(v1alpha1.WorkflowRunConditionType, err))
 	}
 
@@ -142,17 +243,36 @@ func (r *WorkflowRunReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		Client: r.Client,
 		run:    run,
 	}
-	executor := executor.New(instance, executor.WithStatusPatcher(patcher.patchStatus))
+	subPhases := getSubPhases(run.Status.Steps)
+	metadata := getStepMetadata(run.Status.Steps)
+	reasons := getStepReasons(run.Status.Steps)
+	executor := executor.New(instance, executor.WithStatusPatcher(patcher.patchStatus), executor.WithClock(r.clock()), executor.WithPaused(paused),
+		executor.WithAuditSink(r.AuditSink), executor.WithArchiveHook(patcher.setArchived))
 	state, err := executor.ExecuteRunners(logCtx, runners)
 	if err != nil {
 		logCtx.Error(err, "[execute runners]")
 		r.Recorder.Event(run, event.Warning(v1alpha1.ReasonExecute, errors.WithMessage(err, v1alpha1.MessageFailedExecute)))
 		run.Status.Phase = v1alpha1.WorkflowStateExecuting
+		if state == v1alpha1.WorkflowStateInitializing {
+			run.Status = instance.Status
+			run.Status.Phase = state
+			run.SetConditions(lifecycleCondition(r.clock().Now(), v1alpha1.WorkflowRunContextBackendConditionType, true, condition.ReasonUnavailable, err.Error()))
+		}
+		run.SetConditions(condition.ReadyCondition(v1alpha1.WorkflowRunValidatedConditionType))
 		return r.endWithNegativeCondition(logCtx, run, condition.ErrorCondition(v1alpha1.WorkflowRunConditionType, err))
 	}
-	isUpdate = isUpdate && instance.Status.Message == ""
+	// patch can not clear the message and failures, update the status instead
+	isUpdate = (isUpdate && instance.Status.Message == "") || (hasFailures && len(instance.Status.Failures) == 0)
 	run.Status = instance.Status
 	run.Status.Phase = state
+	r.recordSubPhases(run, subPhases)
+	r.recordMetadata(run, metadata)
+	r.recordUnknownStepTypes(run, reasons)
+	if run.Status.StartTime.IsZero() {
+		run.Status.StartTime = metav1.NewTime(r.clock().Now())
+	}
+	setLifecycleConditions(run, r.clock().Now())
+	setPausedCondition(run, paused, r.clock().Now())
 	switch state {
 	case v1alpha1.WorkflowStateSuspending:
 		logCtx.Info("Workflow return state=Suspend")
@@ -163,22 +283,32 @@ func (r *WorkflowRunReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	case v1alpha1.WorkflowStateFailed:
 		logCtx.Info("Workflow return state=Failed")
 		r.doWorkflowFinish(run)
+		r.cleanupExecPods(logCtx, run)
+		r.recordFailedSteps(run)
 		r.Recorder.Event(run, event.Normal(v1alpha1.ReasonExecute, v1alpha1.MessageFailed))
-		return ctrl.Result{}, patcher.patchStatus(logCtx, &run.Status, isUpdate)
+		return ctrl.Result{RequeueAfter: r.deliverCompletionWebhook(logCtx, run)}, patcher.patchStatus(logCtx, &run.Status, isUpdate)
 	case v1alpha1.WorkflowStateTerminated:
 		logCtx.Info("Workflow return state=Terminated")
 		r.doWorkflowFinish(run)
+		r.cleanupExecPods(logCtx, run)
 		r.Recorder.Event(run, event.Normal(v1alpha1.ReasonExecute, v1alpha1.MessageTerminated))
-		return ctrl.Result{}, patcher.patchStatus(logCtx, &run.Status, isUpdate)
+		return ctrl.Result{RequeueAfter: r.deliverCompletionWebhook(logCtx, run)}, patcher.patchStatus(logCtx, &run.Status, isUpdate)
 	case v1alpha1.WorkflowStateExecuting:
 		logCtx.Info("Workflow return state=Executing")
-		return ctrl.Result{RequeueAfter: executor.GetBackoffWaitTime()}, patcher.patchStatus(logCtx, &run.Status, isUpdate)
+		requeueAfter := executor.GetBackoffWaitTime()
+		if d := watchResult.RequeueAfter; d > 0 && d < requeueAfter {
+			requeueAfter = d
+		}
+		if paused && requeueAfter > PausedRequeueInterval {
+			requeueAfter = PausedRequeueInterval
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, patcher.patchStatus(logCtx, &run.Status, isUpdate)
 	case v1alpha1.WorkflowStateSucceeded:
 		logCtx.Info("Workflow return state=Succeeded")
 		r.doWorkflowFinish(run)
 		run.Status.SetConditions(condition.ReadyCondition(v1alpha1.WorkflowRunConditionType))
 		r.Recorder.Event(run, event.Normal(v1alpha1.ReasonExecute, v1alpha1.MessageSuccessfully))
-		return ctrl.Result{}, patcher.patchStatus(logCtx, &run.Status, isUpdate)
+		return ctrl.Result{RequeueAfter: r.deliverCompletionWebhook(logCtx, run)}, patcher.patchStatus(logCtx, &run.Status, isUpdate)
 	case v1alpha1.WorkflowStateSkipped:
 		logCtx.Info("Skip this reconcile")
 		return ctrl.Result{RequeueAfter: executor.GetBackoffWaitTime()}, nil
@@ -187,6 +317,161 @@ func (r *WorkflowRunReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{}, nil
 }
 
+// handleBreachedWatcher suspends or terminates the run by the action of the breached watcher. The suspended run
+// keeps the phases of its running steps, so the steps continue to run once the run is resumed.
+func (r *WorkflowRunReconciler) handleBreachedWatcher(ctx monitorContext.Context, run *v1alpha1.WorkflowRun, result watcher.Result) error {
+	breached := result.Breached
+	if breached == nil {
+		return nil
+	}
+	ctx.Info("Watcher is breached", "watcher", breached.Name, "action", breached.Action)
+	r.Recorder.Event(run, event.Warning(v1alpha1.ReasonWatch, errors.New(result.Message)))
+	if breached.Action == v1alpha1.WatcherActionTerminate {
+		return utils.TerminateWorkflowBy(ctx, r.Client, run, r.AuditSink, "watcher/"+breached.Name, result.Message)
+	}
+	run.Status.Suspend = true
+	return nil
+}
+
+// describeStep returns the name of the step with its description and docs if they're set in the meta of the step,
+// so that the operators can understand the step from the events
+func describeStep(status v1alpha1.StepStatus) string {
+	var details []string
+	if status.Description != "" {
+		details = append(details, status.Description)
+	}
+	if status.Docs != "" {
+		details = append(details, "docs: "+status.Docs)
+	}
+	if len(details) == 0 {
+		return status.Name
+	}
+	return fmt.Sprintf("%s (%s)", status.Name, strings.Join(details, ", "))
+}
+
+// recordFailedSteps records the events of the failed steps and sub steps of the failed workflow run
+func (r *WorkflowRunReconciler) recordFailedSteps(run *v1alpha1.WorkflowRun) {
+	record := func(status v1alpha1.StepStatus) {
+		if status.Phase == v1alpha1.WorkflowStepPhaseFailed {
+			message := fmt.Sprintf("Step %s is failed: %s", describeStep(status), status.Message)
+			r.Recorder.Event(run, event.Warning(v1alpha1.ReasonStepFailed, errors.New(message)))
+		}
+	}
+	for _, step := range run.Status.Steps {
+		// the failed sub steps take the place of their group
+		if len(step.SubStepsStatus) == 0 {
+			record(step.StepStatus)
+		}
+		for _, sub := range step.SubStepsStatus {
+			record(sub)
+		}
+	}
+}
+
+// getSubPhases returns the sub phases of the running steps and sub steps by their ids
+func getSubPhases(steps []v1alpha1.WorkflowStepStatus) map[string]string {
+	subPhases := make(map[string]string)
+	for _, step := range steps {
+		subPhases[step.ID] = step.SubPhase
+		for _, sub := range step.SubStepsStatus {
+			subPhases[sub.ID] = sub.SubPhase
+		}
+	}
+	return subPhases
+}
+
+// recordSubPhases records the events of the running steps whose sub phases are changed by the providers
+func (r *WorkflowRunReconciler) recordSubPhases(run *v1alpha1.WorkflowRun, previous map[string]string) {
+	record := func(status v1alpha1.StepStatus) {
+		if status.SubPhase != "" && status.SubPhase != previous[status.ID] {
+			r.Recorder.Event(run, event.Normal(v1alpha1.ReasonStepSubPhase, fmt.Sprintf("Step %s is %s", describeStep(status), status.DisplayPhase())))
+		}
+	}
+	for _, step := range run.Status.Steps {
+		record(step.StepStatus)
+		for _, sub := range step.SubStepsStatus {
+			record(sub)
+		}
+	}
+}
+
+// getStepReasons returns the reasons of the steps and sub steps by their ids
+func getStepReasons(steps []v1alpha1.WorkflowStepStatus) map[string]string {
+	reasons := make(map[string]string)
+	for _, step := range steps {
+		reasons[step.ID] = step.Reason
+		for _, sub := range step.SubStepsStatus {
+			reasons[sub.ID] = sub.Reason
+		}
+	}
+	return reasons
+}
+
+// recordUnknownStepTypes records the events of the steps that are skipped, failed or kept pending since their
+// types can't be resolved
+func (r *WorkflowRunReconciler) recordUnknownStepTypes(run *v1alpha1.WorkflowRun, previous map[string]string) {
+	record := func(status v1alpha1.StepStatus) {
+		if status.Reason == types.StatusReasonUnknownStepType && previous[status.ID] != status.Reason {
+			message := fmt.Sprintf("Step %s of the unknown type %s is %s: %s", describeStep(status), status.Type, status.Phase, status.Message)
+			r.Recorder.Event(run, event.Warning(v1alpha1.ReasonUnknownStepType, errors.New(message)))
+		}
+	}
+	for _, step := range run.Status.Steps {
+		record(step.StepStatus)
+		for _, sub := range step.SubStepsStatus {
+			record(sub)
+		}
+	}
+}
+
+// getStepMetadata returns the metadata of the steps and sub steps by their ids
+func getStepMetadata(steps []v1alpha1.WorkflowStepStatus) map[string]map[string]string {
+	metadata := make(map[string]map[string]string)
+	for _, step := range steps {
+		metadata[step.ID] = step.Metadata
+		for _, sub := range step.SubStepsStatus {
+			metadata[sub.ID] = sub.Metadata
+		}
+	}
+	return metadata
+}
+
+// recordMetadata records the events of the steps whose metadata are changed by the providers
+func (r *WorkflowRunReconciler) recordMetadata(run *v1alpha1.WorkflowRun, previous map[string]map[string]string) {
+	record := func(status v1alpha1.StepStatus) {
+		if len(status.Metadata) == 0 || reflect.DeepEqual(status.Metadata, previous[status.ID]) {
+			return
+		}
+		keys := make([]string, 0, len(status.Metadata))
+		for k := range status.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", k, status.Metadata[k]))
+		}
+		r.Recorder.Event(run, event.Normal(v1alpha1.ReasonStepMetadata, fmt.Sprintf("Step %s reports the metadata %s", describeStep(status), strings.Join(pairs, ", "))))
+	}
+	for _, step := range run.Status.Steps {
+		record(step.StepStatus)
+		for _, sub := range step.SubStepsStatus {
+			record(sub)
+		}
+	}
+}
+
+// deliverCompletionWebhook starts the delivery of the summary of the finished run to the completion webhook in the
+// background or records its result, it returns the duration to requeue the run if the delivery is not done
+func (r *WorkflowRunReconciler) deliverCompletionWebhook(ctx monitorContext.Context, run *v1alpha1.WorkflowRun) time.Duration {
+	requeueAfter, err := callback.DefaultDispatcher.Deliver(ctx, r.Client, run, r.clock().Now())
+	if err != nil {
+		ctx.Error(err, "[deliver completion webhook]")
+		r.Recorder.Event(run, event.Warning(v1alpha1.ReasonCompletionWebhook, err))
+	}
+	return requeueAfter
+}
+
 func (r *WorkflowRunReconciler) matchControllerRequirement(wr *v1alpha1.WorkflowRun) bool {
 	if wr.Annotations != nil {
 		if requireVersion, ok := wr.Annotations[types.AnnotationControllerRequirement]; ok {
@@ -199,6 +484,9 @@ func (r *WorkflowRunReconciler) matchControllerRequirement(wr *v1alpha1.Workflow
 	return true
 }
 
+// ObjectWatchEventBuffer is the buffer size of the events of the runs whose watched objects flip the conditions
+var ObjectWatchEventBuffer = 1024
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *WorkflowRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	builder := ctrl.NewControllerManagedBy(mgr)
@@ -207,6 +495,24 @@ func (r *WorkflowRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			Type: &triggerv1alpha1.EventListener{},
 		}, ctrlHandler.EnqueueRequestsFromMapFunc(findObjectForEventListener))
 	}
+	// the runs waiting for the watched objects are reconciled once their conditions flip
+	objectEvents := make(chan ctrlEvent.GenericEvent, ObjectWatchEventBuffer)
+	notify := func(namespace, name string) {
+		run := &v1alpha1.WorkflowRun{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+		select {
+		case objectEvents <- ctrlEvent.GenericEvent{Object: run}:
+		default:
+			// the run is still reconciled by the backoff if the buffer is full
+		}
+	}
+	objectwatch.DefaultManager.SetNotifier(notify)
+	// the finished runs are also reconciled once the attempts to deliver their summaries are done
+	callback.DefaultDispatcher.SetNotifier(notify)
+	builder = builder.Watches(&source.Channel{Source: objectEvents}, &ctrlHandler.EnqueueRequestForObject{})
+	var forOpts []ctrlBuilder.ForOption
+	if r.ShardPredicate != nil {
+		forOpts = append(forOpts, ctrlBuilder.WithPredicates(r.ShardPredicate))
+	}
 	return builder.
 		WithOptions(controller.Options{
 			MaxConcurrentReconciles: r.ConcurrentReconciles,
@@ -223,15 +529,39 @@ func (r *WorkflowRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					return true
 				}
 
-				// if the workflow is finished, skip the reconcile
+				// cancel the in-flight steps of the run once it's terminated or being deleted
+				if (newObj.Status.Terminated && !oldObj.Status.Terminated) || (oldObj.DeletionTimestamp.IsZero() && !newObj.DeletionTimestamp.IsZero()) {
+					executor.CancelRun(newObj.Namespace, newObj.Name)
+				}
+
+				// if the workflow is finished, skip the reconcile unless it's being deleted or torn down
 				if newObj.Status.Finished {
-					return false
+					if oldObj.Annotations[types.AnnotationTeardown] != newObj.Annotations[types.AnnotationTeardown] {
+						return true
+					}
+					// the parent of the finished stage run is reconciled to start the next stage
+					if !oldObj.Status.Finished && isStageRun(newObj) {
+						return true
+					}
+					return oldObj.DeletionTimestamp.IsZero() && !newObj.DeletionTimestamp.IsZero()
 				}
 
 				// filter managedFields changes
 				oldObj.ManagedFields = nil
 				newObj.ManagedFields = nil
 
+				// filter the changes in the labels synced by the controller
+				for _, key := range []string{types.LabelWorkflowRunPhase, types.LabelWorkflowRunWorkflow} {
+					if v, ok := newObj.Labels[key]; ok {
+						if oldObj.Labels == nil {
+							oldObj.Labels = make(map[string]string)
+						}
+						oldObj.Labels[key] = v
+					} else {
+						delete(oldObj.Labels, key)
+					}
+				}
+
 				// filter resourceVersion changes
 				oldObj.ResourceVersion = newObj.ResourceVersion
 
@@ -240,8 +570,9 @@ func (r *WorkflowRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					return true
 				}
 
-				// ignore the changes in step status
+				// ignore the changes in step status and the results of the watchers
 				oldObj.Status.Steps = newObj.Status.Steps
+				oldObj.Status.Watchers = newObj.Status.Watchers
 
 				return !reflect.DeepEqual(oldObj, newObj)
 			},
@@ -249,7 +580,8 @@ func (r *WorkflowRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return true
 			},
 		}).
-		For(&v1alpha1.WorkflowRun{}).
+		For(&v1alpha1.WorkflowRun{}, forOpts...).
+		Owns(&v1alpha1.WorkflowRun{}).
 		Complete(r)
 }
 
@@ -262,36 +594,167 @@ func (r *WorkflowRunReconciler) endWithNegativeCondition(ctx context.Context, wr
 	return ctrl.Result{}, fmt.Errorf("reconcile WorkflowRun error, msg: %s", condition.Message)
 }
 
+func (r *workflowRunPatcher) setArchived(err error) {
+	r.archived = err == nil
+}
+
 func (r *workflowRunPatcher) patchStatus(ctx context.Context, status *v1alpha1.WorkflowRunStatus, isUpdate bool) error {
 	r.run.Status = *status
+	if types.PruneFinishedStepStatus && r.archived {
+		// the status is shared with the executor, prune a copy of it
+		r.run.Status = *status.DeepCopy()
+		utils.PruneStatus(&r.run.Status)
+	}
 	wr := r.run
 	if isUpdate {
 		if err := r.Status().Update(ctx, wr); err != nil {
 			executor.StepStatusCache.Store(fmt.Sprintf("%s-%s", wr.Name, wr.Namespace), -1)
+			countStatusConflict(err, "update")
 			return errors.WithMessage(err, "failed to update workflowrun status")
 		}
-		return nil
+		return r.syncLabels(ctx)
 	}
 	if err := r.Status().Patch(ctx, wr, client.Merge); err != nil {
 		executor.StepStatusCache.Store(fmt.Sprintf("%s-%s", wr.Name, wr.Namespace), -1)
+		countStatusConflict(err, "patch")
 		return errors.WithMessage(err, "failed to patch workflowrun status")
 	}
+	return r.syncLabels(ctx)
+}
+
+func countStatusConflict(err error, method string) {
+	if kerrors.IsConflict(err) {
+		metrics.WorkflowRunStatusUpdateConflictCounter.WithLabelValues(method).Inc()
+	}
+}
+
+// syncLabels syncs the phase and the workflow of the run to its labels, so the runs can be filtered by the label
+// selectors on the server side
+func (r *workflowRunPatcher) syncLabels(ctx context.Context) error {
+	wr := r.run
+	expected := map[string]string{}
+	if wr.Status.Phase != "" {
+		expected[types.LabelWorkflowRunPhase] = string(wr.Status.Phase)
+	}
+	if ref := wr.Spec.WorkflowRef; ref != "" && len(validation.IsValidLabelValue(ref)) == 0 {
+		expected[types.LabelWorkflowRunWorkflow] = ref
+	}
+	synced := true
+	for k, v := range expected {
+		if wr.Labels[k] != v {
+			synced = false
+		}
+	}
+	if synced {
+		return nil
+	}
+	patch := client.MergeFrom(wr.DeepCopy())
+	if wr.Labels == nil {
+		wr.Labels = make(map[string]string)
+	}
+	for k, v := range expected {
+		wr.Labels[k] = v
+	}
+	if err := r.Patch(ctx, wr, patch); err != nil {
+		return errors.WithMessage(err, "failed to patch workflowrun labels")
+	}
 	return nil
 }
 
 func (r *WorkflowRunReconciler) doWorkflowFinish(wr *v1alpha1.WorkflowRun) {
 	wr.Status.Finished = true
-	wr.Status.EndTime = metav1.Now()
-	metrics.WorkflowRunFinishedTimeHistogram.WithLabelValues(string(wr.Status.Phase)).Observe(wr.Status.EndTime.Sub(wr.Status.StartTime.Time).Seconds())
+	// the end time is never overwritten, so the duration is stable if the finish is reconciled again
+	if wr.Status.EndTime.IsZero() {
+		wr.Status.EndTime = metav1.NewTime(r.clock().Now())
+	}
+	wr.Status.Duration = &metav1.Duration{Duration: wr.Status.EndTime.Sub(wr.Status.StartTime.Time)}
+	metrics.WorkflowRunFinishedTimeHistogram.WithLabelValues(append([]string{string(wr.Status.Phase)}, metrics.RunLabelValues(wr.Labels)...)...).Observe(wr.Status.Duration.Seconds())
 	executor.StepStatusCache.Delete(fmt.Sprintf("%s-%s", wr.Name, wr.Namespace))
 	wfContext.CleanupMemoryStore(wr.Name, wr.Namespace)
 }
 
-func timeReconcile(wr *v1alpha1.WorkflowRun) func() {
-	t := time.Now()
+// cleanupExecPods deletes the pods of the exec steps that are still running when the workflow run is failed or terminated
+func (r *WorkflowRunReconciler) cleanupExecPods(ctx monitorContext.Context, wr *v1alpha1.WorkflowRun) {
+	if err := exec.CleanupPods(ctx, r.Client, wr.Name, wr.Namespace); err != nil {
+		ctx.Error(err, "cleanup exec pods")
+	}
+}
+
+// setLifecycleConditions sets the lifecycle conditions of the run by its status after the execution
+func setLifecycleConditions(run *v1alpha1.WorkflowRun, now time.Time) {
+	run.SetConditions(condition.ReadyCondition(v1alpha1.WorkflowRunValidatedConditionType))
+
+	var progressing bool
+	var reason condition.ConditionReason
+	switch run.Status.Phase {
+	case v1alpha1.WorkflowStateExecuting:
+		progressing, reason = true, v1alpha1.ReasonExecuting
+	case v1alpha1.WorkflowStateSuspending:
+		reason = v1alpha1.ReasonSuspended
+	case v1alpha1.WorkflowStateSucceeded:
+		reason = v1alpha1.ReasonSucceeded
+	case v1alpha1.WorkflowStateFailed:
+		reason = v1alpha1.ReasonFailed
+	case v1alpha1.WorkflowStateTerminated:
+		reason = v1alpha1.ReasonTerminated
+	default:
+		return
+	}
+	run.SetConditions(lifecycleCondition(now, v1alpha1.WorkflowRunProgressingConditionType, progressing, reason, run.Status.Message))
+
+	switch {
+	case run.Status.Phase == v1alpha1.WorkflowStateFailed:
+		run.SetConditions(lifecycleCondition(now, v1alpha1.WorkflowRunStalledConditionType, true, v1alpha1.ReasonFailed, run.Status.Message))
+	case run.Status.Phase == v1alpha1.WorkflowStateSuspending && run.Status.Message == types.MessageSuspendFailedAfterRetries:
+		run.SetConditions(lifecycleCondition(now, v1alpha1.WorkflowRunStalledConditionType, true, v1alpha1.ReasonSuspendedOnFailure, run.Status.Message))
+	default:
+		run.SetConditions(lifecycleCondition(now, v1alpha1.WorkflowRunStalledConditionType, false, reason, ""))
+	}
+
+	var failed []string
+	for _, step := range run.Status.Steps {
+		if step.Phase == v1alpha1.WorkflowStepPhaseFailed {
+			failed = append(failed, step.Name)
+		}
+		for _, sub := range step.SubStepsStatus {
+			if sub.Phase == v1alpha1.WorkflowStepPhaseFailed {
+				failed = append(failed, sub.Name)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		run.SetConditions(lifecycleCondition(now, v1alpha1.WorkflowRunDegradedConditionType, true, v1alpha1.ReasonStepsFailed, "failed steps: "+strings.Join(failed, ", ")))
+	} else {
+		run.SetConditions(lifecycleCondition(now, v1alpha1.WorkflowRunDegradedConditionType, false, v1alpha1.ReasonStepsHealthy, ""))
+	}
+}
+
+func lifecycleCondition(now time.Time, tpy string, status bool, reason condition.ConditionReason, message string) condition.Condition {
+	c := condition.Condition{
+		Type:               condition.ConditionType(tpy),
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.NewTime(now),
+		Reason:             reason,
+		Message:            message,
+	}
+	if status {
+		c.Status = corev1.ConditionTrue
+	}
+	return c
+}
+
+func (r *WorkflowRunReconciler) clock() types.Clock {
+	if r.Clock == nil {
+		return clock.RealClock{}
+	}
+	return r.Clock
+}
+
+func timeReconcile(wr *v1alpha1.WorkflowRun, c types.Clock) func() {
+	t := c.Now()
 	beginPhase := string(wr.Status.Phase)
 	return func() {
-		v := time.Since(t).Seconds()
+		v := c.Now().Sub(t).Seconds()
 		metrics.WorkflowRunReconcileTimeHistogram.WithLabelValues(beginPhase, string(wr.Status.Phase)).Observe(v)
 	}
 }
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+const (
+	// SinkEvent records the audit entries in the events of the workflow runs
+	SinkEvent = "event"
+	// SinkFilePrefix is the prefix of the sink that appends the audit entries to the file after the prefix, e.g.
+	// file:/var/log/workflow/audit.log
+	SinkFilePrefix = "file:"
+)
+
+type eventSink struct {
+	recorder event.Recorder
+}
+
+// NewEventSink returns the sink that records the audit entries in the events of the workflow runs with the reason
+// Audit, the message of the event is the entry in JSON so that it can be collected by the event exporters.
+func NewEventSink(recorder event.Recorder) types.AuditSink {
+	return &eventSink{recorder: recorder}
+}
+
+// Record implements types.AuditSink
+func (s *eventSink) Record(_ context.Context, entry types.AuditEntry) error {
+	message, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	run := &v1alpha1.WorkflowRun{
+		TypeMeta: metav1.TypeMeta{Kind: v1alpha1.WorkflowRunKind, APIVersion: v1alpha1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      entry.Target.Name,
+			Namespace: entry.Target.Namespace,
+			UID:       entry.Target.UID,
+		},
+	}
+	s.recorder.Event(run, event.Normal(v1alpha1.ReasonAudit, string(message)))
+	return nil
+}
+
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink returns the sink that appends the audit entries to the file in JSON lines. Unlike the events, which are
+// rate limited and expired by the apiserver, the entries are kept as long as the file, e.g. on a persistent volume,
+// and every entry is synced to the disk before it's returned.
+func NewFileSink(path string) (types.AuditSink, error) {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: file}, nil
+}
+
+// Record implements types.AuditSink
+func (s *fileSink) Record(_ context.Context, entry types.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// NewSink returns the built-in sink by its name, nil is returned if the name is empty
+func NewSink(name string, recorder event.Recorder) (types.AuditSink, error) {
+	switch {
+	case name == "":
+		return nil, nil
+	case name == SinkEvent:
+		return NewEventSink(recorder), nil
+	case strings.HasPrefix(name, SinkFilePrefix) && len(name) > len(SinkFilePrefix):
+		return NewFileSink(strings.TrimPrefix(name, SinkFilePrefix))
+	default:
+		return nil, fmt.Errorf("unknown audit sink %s", name)
+	}
+}
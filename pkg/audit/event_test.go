@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+type fakeRecorder struct {
+	objects []runtime.Object
+	events  []event.Event
+}
+
+func (r *fakeRecorder) Event(obj runtime.Object, e event.Event) {
+	r.objects = append(r.objects, obj)
+	r.events = append(r.events, e)
+}
+
+func (r *fakeRecorder) WithAnnotations(...string) event.Recorder {
+	return r
+}
+
+func TestEventSink(t *testing.T) {
+	r := require.New(t)
+	recorder := &fakeRecorder{}
+	sink, err := NewSink(SinkEvent, recorder)
+	r.NoError(err)
+	entry := types.AuditEntry{
+		Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Actor:     "system:serviceaccount:default:deployer",
+		Action:    types.AuditActionExecuteStep,
+		Target:    types.AuditTarget{Namespace: "default", Name: "run", UID: "uid", Step: "apply", StepType: "apply-deployment"},
+		Outcome:   "succeeded",
+	}
+	r.NoError(sink.Record(context.Background(), entry))
+	r.Len(recorder.events, 1)
+	r.Equal(event.Reason(v1alpha1.ReasonAudit), recorder.events[0].Reason)
+	r.Equal(event.TypeNormal, recorder.events[0].Type)
+	recorded := types.AuditEntry{}
+	r.NoError(json.Unmarshal([]byte(recorder.events[0].Message), &recorded))
+	r.Equal(entry, recorded)
+	run, ok := recorder.objects[0].(*v1alpha1.WorkflowRun)
+	r.True(ok)
+	r.Equal("run", run.Name)
+	r.Equal("default", run.Namespace)
+	r.Equal(v1alpha1.WorkflowRunKind, run.Kind)
+
+	sink, err = NewSink("", recorder)
+	r.NoError(err)
+	r.Nil(sink)
+	_, err = NewSink("unknown", recorder)
+	r.ErrorContains(err, "unknown audit sink unknown")
+}
+
+func TestFileSink(t *testing.T) {
+	r := require.New(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewSink(SinkFilePrefix+path, nil)
+	r.NoError(err)
+	entries := []types.AuditEntry{{
+		Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Actor:     types.AuditActorController,
+		Action:    types.AuditActionExecuteStep,
+		Target:    types.AuditTarget{Namespace: "default", Name: "run", Step: "apply"},
+		Outcome:   "succeeded",
+	}, {
+		Timestamp: time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC),
+		Actor:     types.AuditActorController,
+		Action:    types.AuditActionTerminate,
+		Target:    types.AuditTarget{Namespace: "default", Name: "run"},
+		Outcome:   "terminated",
+	}}
+	for _, entry := range entries {
+		r.NoError(sink.Record(context.Background(), entry))
+	}
+
+	// the entries are appended to the existing file
+	sink, err = NewSink(SinkFilePrefix+path, nil)
+	r.NoError(err)
+	r.NoError(sink.Record(context.Background(), entries[0]))
+	data, err := os.ReadFile(path)
+	r.NoError(err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	r.Len(lines, 3)
+	for i, line := range lines {
+		recorded := types.AuditEntry{}
+		r.NoError(json.Unmarshal([]byte(line), &recorded))
+		r.Equal(entries[i%2], recorded)
+	}
+
+	_, err = NewSink(SinkFilePrefix, nil)
+	r.ErrorContains(err, "unknown audit sink file:")
+}
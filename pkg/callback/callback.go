@@ -0,0 +1,380 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package callback
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/condition"
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
+)
+
+const (
+	// DefaultMaxAttempts is the default number of the attempts before the summary is dead-lettered
+	DefaultMaxAttempts = 5
+	// SignatureHeader is the header of the HMAC-SHA256 signature of the request body
+	SignatureHeader = "X-Workflow-Signature"
+	// DeadLetterKeySummary is the key of the summary in the dead letter config map
+	DeadLetterKeySummary = "summary"
+	// DeadLetterKeyError is the key of the last delivery error in the dead letter config map
+	DeadLetterKeyError = "error"
+)
+
+var (
+	// RetryInterval is the interval before the first retry, it's doubled for every retry
+	RetryInterval = 10 * time.Second
+	// MaxRetryInterval is the max interval between the retries
+	MaxRetryInterval = 5 * time.Minute
+	// RequestTimeout is the timeout of each request
+	RequestTimeout = 10 * time.Second
+	// DialTimeout is the timeout to connect to the completion webhook
+	DialTimeout = 5 * time.Second
+)
+
+// NewSummary returns the summary of the finished run
+func NewSummary(run *v1alpha1.WorkflowRun) v1alpha1.WorkflowRunSummary {
+	summary := v1alpha1.WorkflowRunSummary{
+		Name:      run.Name,
+		Namespace: run.Namespace,
+		UID:       string(run.UID),
+		Phase:     run.Status.Phase,
+		Message:   run.Status.Message,
+		StartTime: run.Status.StartTime,
+		EndTime:   run.Status.EndTime,
+		Steps:     run.Status.Steps,
+		Failures:  run.Status.Failures,
+		Custom:    run.Status.Custom,
+	}
+	if run.Status.Duration != nil {
+		summary.Duration = run.Status.Duration.Duration.String()
+	}
+	if path, duration := utils.CriticalPath(run); len(path) > 0 {
+		for _, step := range path {
+			summary.CriticalPath = append(summary.CriticalPath, step.Name)
+		}
+		summary.CriticalPathDuration = duration.String()
+		summary.CriticalPathInferred = utils.CriticalPathInferred(run)
+	}
+	return summary
+}
+
+// Pending checks if the summary of the finished run should be delivered to the completion webhook
+func Pending(run *v1alpha1.WorkflowRun) bool {
+	if run.Spec.CompletionWebhook == nil || !run.Status.Finished {
+		return false
+	}
+	c := run.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunCompletionWebhookConditionType))
+	return c.Status != corev1.ConditionTrue && c.Reason != v1alpha1.ReasonDeadLettered
+}
+
+// Dispatcher delivers the summaries of the finished runs to the completion webhooks in the background, so that the
+// reconciles are not blocked by the slow webhooks. The result of an attempt is recorded in the run by the next
+// reconcile, which is triggered by the notifier once the attempt is done.
+type Dispatcher struct {
+	client   *http.Client
+	mu       sync.Mutex
+	attempts map[ktypes.UID]*attempt
+	notify   func(namespace, name string)
+}
+
+type attempt struct {
+	done bool
+	err  error
+}
+
+// DefaultDispatcher is the dispatcher used by the controller
+var DefaultDispatcher = NewDispatcher(NewHTTPClient(false))
+
+// NewDispatcher creates a dispatcher that posts the summaries with the client
+func NewDispatcher(httpClient *http.Client) *Dispatcher {
+	return &Dispatcher{client: httpClient, attempts: map[ktypes.UID]*attempt{}}
+}
+
+// SetNotifier sets the function called with the run once an attempt to deliver its summary is done
+func (d *Dispatcher) SetNotifier(notify func(namespace, name string)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notify = notify
+}
+
+// Forget drops the attempt of the run, e.g. once the run is deleted
+func (d *Dispatcher) Forget(uid ktypes.UID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.attempts, uid)
+}
+
+// Deliver starts an attempt to post the summary of the finished run to the completion webhook, or records the
+// result of the attempt in the run once it's done. It returns the duration until the run should be reconciled
+// again, and the error of the attempt if it's failed. The attempt is skipped if the backoff of the last failed
+// attempt is not passed.
+func (d *Dispatcher) Deliver(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, now time.Time) (time.Duration, error) {
+	if !Pending(run) {
+		d.Forget(run.UID)
+		return 0, nil
+	}
+	status := run.Status.CompletionWebhook
+	if status == nil {
+		status = &v1alpha1.CompletionWebhookStatus{}
+		run.Status.CompletionWebhook = status
+	}
+	d.mu.Lock()
+	a, inflight := d.attempts[run.UID]
+	if inflight && a.done {
+		delete(d.attempts, run.UID)
+	}
+	d.mu.Unlock()
+	if inflight {
+		if !a.done {
+			// the run is notified once the attempt is done, the requeue is a fallback
+			return RequestTimeout, nil
+		}
+		return record(ctx, cli, run, a.err, now)
+	}
+	if status.Attempts > 0 {
+		if next := status.LastAttemptTime.Add(backoff(status.Attempts)); now.Before(next) {
+			return next.Sub(now), nil
+		}
+	}
+	status.LastAttemptTime = metav1.NewTime(now)
+	req, err := newRequest(ctx, cli, run)
+	if err != nil {
+		return record(ctx, cli, run, err, now)
+	}
+	a = &attempt{}
+	d.mu.Lock()
+	d.attempts[run.UID] = a
+	d.mu.Unlock()
+	go d.post(req, a, run.Namespace, run.Name)
+	return RequestTimeout, nil
+}
+
+func (d *Dispatcher) post(req *http.Request, a *attempt, namespace, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+	err := do(d.client, req.WithContext(ctx))
+	d.mu.Lock()
+	a.done, a.err = true, err
+	notify := d.notify
+	d.mu.Unlock()
+	if notify != nil {
+		notify(namespace, name)
+	}
+}
+
+// record records the result of the attempt in the run, the summary is dead-lettered once all attempts failed
+func record(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, err error, now time.Time) (time.Duration, error) {
+	status := run.Status.CompletionWebhook
+	webhook := run.Spec.CompletionWebhook
+	if err == nil {
+		run.SetConditions(newCondition(now, true, v1alpha1.ReasonDelivered, fmt.Sprintf("The summary is delivered to %s", webhook.URL)))
+		return 0, nil
+	}
+	status.Attempts++
+	maxAttempts := webhook.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if status.Attempts < maxAttempts {
+		run.SetConditions(newCondition(now, false, v1alpha1.ReasonDeliveryFailed, fmt.Sprintf("Attempt %d/%d failed: %s", status.Attempts, maxAttempts, err.Error())))
+		return backoff(status.Attempts), err
+	}
+	body, mErr := json.Marshal(NewSummary(run))
+	if mErr != nil {
+		return 0, mErr
+	}
+	name, dlErr := deadLetter(ctx, cli, run, body, err)
+	if dlErr != nil {
+		// keep retrying until the summary is dead-lettered
+		run.SetConditions(newCondition(now, false, v1alpha1.ReasonDeliveryFailed, fmt.Sprintf("Attempt %d/%d failed: %s, and failed to dead-letter the summary: %s", status.Attempts, maxAttempts, err.Error(), dlErr.Error())))
+		return backoff(status.Attempts), err
+	}
+	run.SetConditions(newCondition(now, false, v1alpha1.ReasonDeadLettered, fmt.Sprintf("All %d attempts failed, the summary is dead-lettered into the config map %s: %s", maxAttempts, name, err.Error())))
+	return 0, err
+}
+
+// newRequest builds the request to post the summary of the run, it's signed with the key in the secret if any
+func newRequest(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun) (*http.Request, error) {
+	body, err := json.Marshal(NewSummary(run))
+	if err != nil {
+		return nil, err
+	}
+	webhook := run.Spec.CompletionWebhook
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range webhook.Headers {
+		req.Header.Set(k, v)
+	}
+	if ref := webhook.SecretRef; ref != nil {
+		secret := &corev1.Secret{}
+		if err := cli.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: ref.Name}, secret); err != nil {
+			return nil, errors.WithMessagef(err, "failed to get the secret %s", ref.Name)
+		}
+		key, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("the key %s is not found in the secret %s", ref.Key, ref.Name)
+		}
+		req.Header.Set(SignatureHeader, "sha256="+Sign(key, body))
+	}
+	return req, nil
+}
+
+func do(httpClient *http.Client, req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("the status code of %s is %d", req.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// NewHTTPClient returns the client to post the summaries with the timeouts. Unless allowPrivate is set, it refuses
+// to connect to the loopback, private, link-local and unspecified addresses, including the redirected ones, so that
+// the completion webhooks can't be used to reach the endpoints inside the cluster or the metadata of the node.
+func NewHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: DialTimeout}
+	if !allowPrivate {
+		dialer.Control = denyPrivateAddress
+	}
+	return &http.Client{
+		Timeout: RequestTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   DialTimeout,
+			ResponseHeaderTimeout: RequestTimeout,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+		},
+	}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which is commonly used by the pod networks
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func denyPrivateAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("the address %s is not allowed for the completion webhook", host)
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of the body
+func Sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetter stores the summary and the last error into the config map owned by the run
+func deadLetter(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, body []byte, deliverErr error) (string, error) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      run.Name + "-completion-webhook",
+			Namespace: run.Namespace,
+			Labels: map[string]string{
+				types.LabelWorkflowRunName:      run.Name,
+				types.LabelWorkflowRunNamespace: run.Namespace,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       v1alpha1.WorkflowRunKind,
+				Name:       run.Name,
+				UID:        run.UID,
+				Controller: pointer.Bool(true),
+			}},
+		},
+		Data: map[string]string{
+			DeadLetterKeySummary: string(body),
+			DeadLetterKeyError:   deliverErr.Error(),
+		},
+	}
+	if err := cli.Create(ctx, cm); err != nil {
+		if !kerrors.IsAlreadyExists(err) {
+			return "", err
+		}
+		existing := &corev1.ConfigMap{}
+		if err := cli.Get(ctx, client.ObjectKeyFromObject(cm), existing); err != nil {
+			return "", err
+		}
+		existing.Data = cm.Data
+		if err := cli.Update(ctx, existing); err != nil {
+			return "", err
+		}
+	}
+	return cm.Name, nil
+}
+
+// backoff returns the interval before the next attempt after the failed attempts
+func backoff(attempts int) time.Duration {
+	d := RetryInterval
+	for i := 1; i < attempts && d < MaxRetryInterval; i++ {
+		d *= 2
+	}
+	if d > MaxRetryInterval {
+		return MaxRetryInterval
+	}
+	return d
+}
+
+func newCondition(now time.Time, delivered bool, reason condition.ConditionReason, message string) condition.Condition {
+	c := condition.Condition{
+		Type:               condition.ConditionType(v1alpha1.WorkflowRunCompletionWebhookConditionType),
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.NewTime(now),
+		Reason:             reason,
+		Message:            message,
+	}
+	if delivered {
+		c.Status = corev1.ConditionTrue
+	}
+	return c
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubevela/workflow/api/condition"
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func newFinishedRun(url string) *v1alpha1.WorkflowRun {
+	return &v1alpha1.WorkflowRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "default", UID: "run-uid"},
+		Spec: v1alpha1.WorkflowRunSpec{CompletionWebhook: &v1alpha1.CompletionWebhook{
+			URL:         url,
+			Headers:     map[string]string{"X-Source": "workflow"},
+			SecretRef:   &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "webhook"}, Key: "token"},
+			MaxAttempts: 2,
+		}},
+		Status: v1alpha1.WorkflowRunStatus{
+			Phase:    v1alpha1.WorkflowStateFailed,
+			Finished: true,
+			Duration: &metav1.Duration{Duration: time.Minute},
+			Failures: []v1alpha1.StepFailure{{Name: "step1", Reason: "Execute", Message: "mock error"}},
+			Steps: []v1alpha1.WorkflowStepStatus{{StepStatus: v1alpha1.StepStatus{
+				ID:               "step1-id",
+				Name:             "step1",
+				Phase:            v1alpha1.WorkflowStepPhaseFailed,
+				FirstExecuteTime: metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+				LastExecuteTime:  metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 30, 0, time.UTC)),
+			}}},
+		},
+	}
+}
+
+// deliver starts an attempt and records its result once it's done
+func deliver(t *testing.T, d *Dispatcher, cli client.Client, run *v1alpha1.WorkflowRun, now time.Time) (time.Duration, error) {
+	done := make(chan struct{}, 1)
+	d.SetNotifier(func(namespace, name string) {
+		require.Equal(t, run.Name, name)
+		done <- struct{}{}
+	})
+	requeueAfter, err := d.Deliver(context.Background(), cli, run, now)
+	if requeueAfter != RequestTimeout || err != nil {
+		return requeueAfter, err
+	}
+	select {
+	case <-done:
+	case <-time.After(RequestTimeout):
+		t.Fatal("the attempt is not done")
+	}
+	return d.Deliver(context.Background(), cli, run, now)
+}
+
+func TestDeliver(t *testing.T) {
+	r := require.New(t)
+	cli := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("secret")},
+	}).Build()
+	var received *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received = req
+		body, _ = io.ReadAll(req.Body)
+	}))
+	defer srv.Close()
+	run := newFinishedRun(srv.URL)
+	r.True(Pending(run))
+
+	d := NewDispatcher(NewHTTPClient(true))
+	requeueAfter, err := deliver(t, d, cli, run, time.Now())
+	r.NoError(err)
+	r.Equal(time.Duration(0), requeueAfter)
+	r.Equal(http.MethodPost, received.Method)
+	r.Equal("workflow", received.Header.Get("X-Source"))
+	r.Equal("sha256="+Sign([]byte("secret"), body), received.Header.Get(SignatureHeader))
+	summary := v1alpha1.WorkflowRunSummary{}
+	r.NoError(json.Unmarshal(body, &summary))
+	r.Equal("run", summary.Name)
+	r.Equal("run-uid", summary.UID)
+	r.Equal(v1alpha1.WorkflowStateFailed, summary.Phase)
+	r.Equal("1m0s", summary.Duration)
+	r.Equal("step1", summary.Failures[0].Name)
+	r.Equal([]string{"step1"}, summary.CriticalPath)
+	r.Equal("30s", summary.CriticalPathDuration)
+	c := run.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunCompletionWebhookConditionType))
+	r.Equal(corev1.ConditionTrue, c.Status)
+	r.Equal(v1alpha1.ReasonDelivered, c.Reason)
+	r.False(Pending(run))
+
+	// the unfinished run is not delivered
+	run = newFinishedRun(srv.URL)
+	run.Status.Finished = false
+	r.False(Pending(run))
+}
+
+func TestDeliverWithRetries(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	run := newFinishedRun(srv.URL)
+	run.Spec.CompletionWebhook.SecretRef = nil
+	now := time.Now()
+	d := NewDispatcher(NewHTTPClient(true))
+
+	requeueAfter, err := deliver(t, d, cli, run, now)
+	r.Error(err)
+	r.Equal(RetryInterval, requeueAfter)
+	c := run.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunCompletionWebhookConditionType))
+	r.Equal(corev1.ConditionFalse, c.Status)
+	r.Equal(v1alpha1.ReasonDeliveryFailed, c.Reason)
+	r.Contains(c.Message, "Attempt 1/2 failed: the status code of")
+
+	// the attempt is skipped until the backoff is passed
+	requeueAfter, err = deliver(t, d, cli, run, now.Add(4*time.Second))
+	r.NoError(err)
+	r.Equal(6*time.Second, requeueAfter)
+	r.Equal(1, attempts)
+
+	requeueAfter, err = deliver(t, d, cli, run, now.Add(RetryInterval))
+	r.Error(err)
+	r.Equal(time.Duration(0), requeueAfter)
+	r.Equal(2, attempts)
+	c = run.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunCompletionWebhookConditionType))
+	r.Equal(v1alpha1.ReasonDeadLettered, c.Reason)
+	r.Contains(c.Message, "All 2 attempts failed, the summary is dead-lettered into the config map run-completion-webhook")
+	r.False(Pending(run))
+	cm := &corev1.ConfigMap{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "run-completion-webhook"}, cm))
+	r.Contains(cm.Data[DeadLetterKeySummary], `"name":"run"`)
+	r.Contains(cm.Data[DeadLetterKeyError], "the status code of")
+	r.Equal("run", cm.OwnerReferences[0].Name)
+}
+
+func TestDeliverWithoutSecret(t *testing.T) {
+	r := require.New(t)
+	run := newFinishedRun("http://127.0.0.1:0")
+	_, err := deliver(t, NewDispatcher(NewHTTPClient(true)), fake.NewClientBuilder().Build(), run, time.Now())
+	r.Error(err)
+	r.Contains(err.Error(), "failed to get the secret webhook")
+	r.Equal(1, run.Status.CompletionWebhook.Attempts)
+}
+
+func TestDeliverToPrivateAddress(t *testing.T) {
+	r := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Fatal("the private address is reached")
+	}))
+	defer srv.Close()
+	run := newFinishedRun(srv.URL)
+	run.Spec.CompletionWebhook.SecretRef = nil
+	_, err := deliver(t, NewDispatcher(NewHTTPClient(false)), fake.NewClientBuilder().Build(), run, time.Now())
+	r.Error(err)
+	r.Contains(err.Error(), "the address 127.0.0.1 is not allowed for the completion webhook")
+
+	for _, addr := range []string{"10.0.0.1:80", "169.254.169.254:80", "[::1]:443", "100.64.0.1:80", "0.0.0.0:80"} {
+		r.Error(denyPrivateAddress("tcp", addr, nil), addr)
+	}
+	r.NoError(denyPrivateAddress("tcp", "8.8.8.8:443", nil))
+}
+
+func TestBackoff(t *testing.T) {
+	r := require.New(t)
+	r.Equal(10*time.Second, backoff(1))
+	r.Equal(20*time.Second, backoff(2))
+	r.Equal(80*time.Second, backoff(4))
+	r.Equal(MaxRetryInterval, backoff(10))
+}
@@ -18,19 +18,25 @@ package context
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/format"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/kubevela/pkg/cue/util"
@@ -43,6 +49,15 @@ import (
 const (
 	// ConfigMapKeyVars is the key in ConfigMap Data field for containing data of variable
 	ConfigMapKeyVars = "vars"
+	// ConfigMapKeySpilledVarPrefix is the key prefix in ConfigMap Data field for containing data of the spilled variable,
+	// it's only used by the in-memory context and the contexts spilled by the former versions
+	ConfigMapKeySpilledVarPrefix = "spilled."
+	// ConfigMapKeySpilledData is the key in the Data field of the spilled ConfigMap for containing data of the variable
+	ConfigMapKeySpilledData = "data"
+	// LabelSpilledVar is the label key of the ConfigMaps that contain the spilled variables
+	LabelSpilledVar = "workflow.oam.dev/spilled-var"
+	// SpilledVarRef is the field of the variable in vars that refers to the key of the spilled data
+	SpilledVarRef = "$spilled"
 	// AnnotationStartTimestamp is the annotation key of the workflow start  timestamp
 	AnnotationStartTimestamp = "vela.io/startTime"
 )
@@ -57,10 +72,36 @@ type WorkflowContext struct {
 	memoryStore *sync.Map
 	vars        cue.Value
 	modified    bool
+	// spilled caches the data of the spilled ConfigMaps, dirty records the ones to be written (true) or deleted (false)
+	spilled map[string]string
+	dirty   map[string]bool
 }
 
-// GetVar get variable from workflow context.
+// GetVar get variable from workflow context, the spilled variable will be loaded from the store.
 func (wf *WorkflowContext) GetVar(paths ...string) (cue.Value, error) {
+	selectors := value.FieldPath(paths...).Selectors()
+	for i := 1; i <= len(selectors); i++ {
+		ref := wf.vars.LookupPath(cue.MakePath(append(selectors[:i:i], cue.Str(SpilledVarRef))...))
+		if !ref.Exists() {
+			continue
+		}
+		key, err := ref.String()
+		if err != nil {
+			return ref, errors.WithMessagef(err, "invalid reference of spilled var %s", cue.MakePath(selectors[:i]...))
+		}
+		data, ok, err := wf.loadSpilled(key)
+		if err != nil {
+			return ref, errors.WithMessagef(err, "load spilled var %s", cue.MakePath(selectors[:i]...))
+		}
+		if !ok {
+			return ref, fmt.Errorf("spilled var %s not found", cue.MakePath(selectors[:i]...))
+		}
+		v := wf.vars.Context().CompileString(data).LookupPath(cue.MakePath(selectors[i:]...))
+		if !v.Exists() {
+			return v, fmt.Errorf("var %s not found", strings.Join(paths, "."))
+		}
+		return v, nil
+	}
 	v := wf.vars.LookupPath(value.FieldPath(paths...))
 	if !v.Exists() {
 		return v, fmt.Errorf("var %s not found", strings.Join(paths, "."))
@@ -76,17 +117,243 @@ func (wf *WorkflowContext) SetVar(v cue.Value, paths ...string) error {
 		return err
 	}
 
-	wf.vars, err = value.FillRaw(wf.vars, str, paths...)
+	vars, err := value.FillRaw(wf.vars, str, paths...)
+	if err != nil {
+		return err
+	}
+	if err := vars.Err(); err != nil {
+		return err
+	}
+	wf.vars = vars
+	wf.modified = true
+	return nil
+}
+
+// ReplaceVar set variable to workflow context, the existing value of the variable is replaced instead of being unified.
+func (wf *WorkflowContext) ReplaceVar(v cue.Value, paths ...string) error {
+	vars, err := value.SetValueByScript(wf.vars, v, paths...)
+	if err != nil {
+		return err
+	}
+	if err := vars.Err(); err != nil {
+		return err
+	}
+	wf.vars = vars
+	wf.modified = true
+	return nil
+}
+
+// DeleteVar deletes the variable from workflow context, the spilled data of the variable is deleted as well.
+func (wf *WorkflowContext) DeleteVar(paths ...string) error {
+	path := value.FieldPath(paths...)
+	v := wf.vars.LookupPath(path)
+	if !v.Exists() {
+		return nil
+	}
+	if key, err := v.LookupPath(cue.MakePath(cue.Str(SpilledVarRef))).String(); err == nil {
+		wf.deleteSpilled(key)
+	}
+	node, ok := wf.vars.Syntax(cue.ResolveReferences(true)).(*ast.StructLit)
+	if !ok {
+		return fmt.Errorf("vars is not a struct lit")
+	}
+	var labels []string
+	for _, sel := range path.Selectors() {
+		labels = append(labels, sel.Unquoted())
+	}
+	deleteField(node, labels)
+	b, err := format.Node(node)
 	if err != nil {
 		return err
 	}
-	if err := wf.vars.Err(); err != nil {
+	vars := wf.vars.Context().CompileBytes(b)
+	if err := vars.Err(); err != nil {
 		return err
 	}
+	wf.vars = vars
 	wf.modified = true
 	return nil
 }
 
+func deleteField(lit *ast.StructLit, labels []string) {
+	for i, elt := range lit.Elts {
+		field, ok := elt.(*ast.Field)
+		if !ok || strings.Trim(sets.LabelStr(field.Label), `"`) != labels[0] {
+			continue
+		}
+		if len(labels) == 1 {
+			lit.Elts = append(lit.Elts[:i], lit.Elts[i+1:]...)
+		} else if sub, ok := field.Value.(*ast.StructLit); ok {
+			deleteField(sub, labels[1:])
+		}
+		return
+	}
+}
+
+// SpillVar stores the variable apart from the vars, and sets the reference of it in vars. The variable is stored
+// in a ConfigMap owned by the context store, so that it doesn't count towards the size limit of the store.
+// The spilled variable is loaded transparently when getting it.
+func SpillVar(ctx Context, v cue.Value, paths ...string) error {
+	str, err := sets.ToString(v)
+	if err != nil {
+		return err
+	}
+	key := ConfigMapKeySpilledVarPrefix + strings.Join(paths, ".")
+	if wf, ok := ctx.(*WorkflowContext); ok && !EnableInMemoryContext {
+		key = spilledConfigMapName(wf.store.Name, strings.Join(paths, "."))
+		wf.setSpilled(key, str)
+	} else {
+		ctx.SetMutableValue(str, key)
+	}
+	ref := v.Context().CompileString(fmt.Sprintf("%q: %q", SpilledVarRef, key))
+	return ctx.SetVar(ref, paths...)
+}
+
+// spilledConfigMapName returns the name of the ConfigMap that contains the spilled variable of the path
+func spilledConfigMapName(storeName, path string) string {
+	suffix := "-spilled-" + spilledConfigMapHash(path)
+	if maxLen := validation.DNS1123SubdomainMaxLength - len(suffix); len(storeName) > maxLen {
+		storeName = strings.TrimRight(storeName[:maxLen], "-.")
+	}
+	return storeName + suffix
+}
+
+func spilledConfigMapHash(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// isSpilledConfigMap returns whether the key of the spilled variable refers to a ConfigMap instead of a key of the store
+func isSpilledConfigMap(key string) bool {
+	return !strings.HasPrefix(key, ConfigMapKeySpilledVarPrefix)
+}
+
+func (wf *WorkflowContext) setSpilled(name, data string) {
+	if wf.spilled == nil {
+		wf.spilled = map[string]string{}
+		wf.dirty = map[string]bool{}
+	}
+	wf.spilled[name] = data
+	wf.dirty[name] = true
+	wf.modified = true
+}
+
+func (wf *WorkflowContext) deleteSpilled(key string) {
+	if !isSpilledConfigMap(key) {
+		wf.DeleteMutableValue(key)
+		return
+	}
+	if wf.spilled == nil {
+		wf.spilled = map[string]string{}
+		wf.dirty = map[string]bool{}
+	}
+	delete(wf.spilled, key)
+	wf.dirty[key] = false
+	wf.modified = true
+}
+
+func (wf *WorkflowContext) loadSpilled(key string) (string, bool, error) {
+	if !isSpilledConfigMap(key) {
+		data, ok := wf.store.Data[key]
+		return data, ok, nil
+	}
+	if data, ok := wf.spilled[key]; ok {
+		return data, true, nil
+	}
+	if deleted, ok := wf.dirty[key]; ok && !deleted {
+		return "", false, nil
+	}
+	cm := &corev1.ConfigMap{}
+	if err := singleton.KubeClient.Get().Get(context.Background(), client.ObjectKey{Namespace: wf.store.Namespace, Name: key}, cm); err != nil {
+		if kerrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	data, ok := cm.Data[ConfigMapKeySpilledData]
+	if ok {
+		if wf.spilled == nil {
+			wf.spilled = map[string]string{}
+			wf.dirty = map[string]bool{}
+		}
+		wf.spilled[key] = data
+	}
+	return data, ok, nil
+}
+
+// syncSpilled writes the modified spilled ConfigMaps and deletes the ones whose variables are deleted
+func (wf *WorkflowContext) syncSpilled(ctx context.Context) error {
+	cli := singleton.KubeClient.Get()
+	for name, write := range wf.dirty {
+		if !write {
+			if err := cli.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: wf.store.Namespace}}); err != nil && !kerrors.IsNotFound(err) {
+				return errors.WithMessagef(err, "delete spilled configMap(%s/%s)", wf.store.Namespace, name)
+			}
+			delete(wf.dirty, name)
+			continue
+		}
+		cm := &corev1.ConfigMap{}
+		if err := cli.Get(ctx, client.ObjectKey{Namespace: wf.store.Namespace, Name: name}, cm); err != nil {
+			if !kerrors.IsNotFound(err) {
+				return errors.WithMessagef(err, "get spilled configMap(%s/%s)", wf.store.Namespace, name)
+			}
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       wf.store.Namespace,
+				Labels:          map[string]string{LabelSpilledVar: "true"},
+				OwnerReferences: wf.spilledOwner(),
+			}, Data: map[string]string{ConfigMapKeySpilledData: wf.spilled[name]}}
+			if err := cli.Create(ctx, cm); err != nil {
+				return errors.WithMessagef(err, "create spilled configMap(%s/%s)", wf.store.Namespace, name)
+			}
+		} else {
+			cm.Data = map[string]string{ConfigMapKeySpilledData: wf.spilled[name]}
+			if err := cli.Update(ctx, cm); err != nil {
+				return errors.WithMessagef(err, "update spilled configMap(%s/%s)", wf.store.Namespace, name)
+			}
+		}
+		delete(wf.dirty, name)
+	}
+	return nil
+}
+
+// spilledOwner returns the owner of the spilled ConfigMaps, they are owned by the store so that they're garbage
+// collected with it, or by the owners of the store if it has not been persisted yet
+func (wf *WorkflowContext) spilledOwner() []metav1.OwnerReference {
+	if wf.store.UID == "" {
+		return wf.store.OwnerReferences
+	}
+	return []metav1.OwnerReference{{
+		APIVersion: corev1.SchemeGroupVersion.String(),
+		Kind:       reflect.TypeOf(corev1.ConfigMap{}).Name(),
+		Name:       wf.store.Name,
+		UID:        wf.store.UID,
+	}}
+}
+
+// PruneSpilledVars deletes the spilled ConfigMaps of the context store that are no longer referenced by the vars,
+// it's used after the vars of the store are cleared out of the controller, e.g. when restarting steps.
+func PruneSpilledVars(ctx context.Context, cli client.Client, store *corev1.ConfigMap) error {
+	if store == nil || store.Name == "" {
+		return nil
+	}
+	cms := &corev1.ConfigMapList{}
+	if err := cli.List(ctx, cms, client.InNamespace(store.Namespace), client.MatchingLabels{LabelSpilledVar: "true"}); err != nil {
+		return err
+	}
+	vars := store.Data[ConfigMapKeyVars]
+	prefix := strings.TrimSuffix(spilledConfigMapName(store.Name, ""), spilledConfigMapHash(""))
+	for i, cm := range cms.Items {
+		if !strings.HasPrefix(cm.Name, prefix) || strings.Contains(vars, strconv.Quote(cm.Name)) {
+			continue
+		}
+		if err := cli.Delete(ctx, &cms.Items[i]); err != nil && !kerrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetStore get store of workflow context.
 func (wf *WorkflowContext) GetStore() *corev1.ConfigMap {
 	return wf.store
@@ -156,7 +423,7 @@ func (wf *WorkflowContext) Commit(ctx context.Context) error {
 	if err := wf.sync(ctx); err != nil {
 		return errors.WithMessagef(err, "save context to configMap(%s/%s)", wf.store.Namespace, wf.store.Name)
 	}
-	return nil
+	return wf.syncSpilled(ctx)
 }
 
 func (wf *WorkflowContext) writeToStore() error {
@@ -19,6 +19,7 @@ package context
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"cuelang.org/go/cue"
@@ -28,7 +29,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	yamlUtil "sigs.k8s.io/yaml"
 
 	"github.com/kubevela/pkg/cue/util"
@@ -82,6 +86,47 @@ result: 101`,
 	conflictV := cuecontext.New().CompileString(`score: 101`)
 	err := wfCtx.SetVar(conflictV, "football")
 	r.Equal(err.Error(), "football.score: conflicting values 101 and 100")
+
+	r.NoError(wfCtx.ReplaceVar(conflictV, "football"))
+	result, err := wfCtx.GetVar("football")
+	r.NoError(err)
+	rStr, err := util.ToString(result)
+	r.NoError(err)
+	r.Equal("score: 101", rStr)
+	result, err = wfCtx.GetVar("clusterIP")
+	r.NoError(err)
+	rStr, err = util.ToString(result)
+	r.NoError(err)
+	r.Equal(`"1.1.1.1"`, rStr)
+}
+
+func TestDeleteVar(t *testing.T) {
+	r := require.New(t)
+	wfCtx := newContextForTest(t)
+	cuectx := cuecontext.New()
+	r.NoError(wfCtx.SetVar(cuectx.CompileString(`score: 100, team: "blue"`), "football"))
+	r.NoError(wfCtx.SetVar(cuectx.CompileString(`"1.1.1.1"`), "clusterIP"))
+	r.NoError(SpillVar(wfCtx, cuectx.CompileString(`image: "nginx"`), "large"))
+
+	r.NoError(wfCtx.DeleteVar("football", "team"))
+	result, err := wfCtx.GetVar("football")
+	r.NoError(err)
+	rStr, err := util.ToString(result)
+	r.NoError(err)
+	r.Equal("score: 100", rStr)
+
+	r.NoError(wfCtx.DeleteVar("large"))
+	_, err = wfCtx.GetVar("large")
+	r.Equal("var large not found", err.Error())
+	r.Empty(wfCtx.spilled)
+	r.Equal(false, wfCtx.dirty[spilledConfigMapName("app-v1", "large")])
+
+	r.NoError(wfCtx.DeleteVar("clusterIP"))
+	r.NoError(wfCtx.DeleteVar("clusterIP"))
+	_, err = wfCtx.GetVar("clusterIP")
+	r.Equal("var clusterIP not found", err.Error())
+	_, err = wfCtx.GetVar("football", "score")
+	r.NoError(err)
 }
 
 func TestRefObj(t *testing.T) {
@@ -231,6 +276,55 @@ func newCliForTest(t *testing.T, wfCm *corev1.ConfigMap) {
 	singleton.KubeClient.Set(cli)
 }
 
+func TestSpillVar(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	singleton.KubeClient.Set(cli)
+	owner := []metav1.OwnerReference{{APIVersion: "core.oam.dev/v1alpha1", Kind: "WorkflowRun", Name: "app", UID: "run-uid"}}
+	wfCtx, err := newContext(ctx, "default", "app", owner)
+	r.NoError(err)
+	cuectx := cuecontext.New()
+	r.NoError(SpillVar(wfCtx, cuectx.CompileString(`image: "nginx"`), "large"))
+	r.NoError(SpillVar(wfCtx, cuectx.CompileString(`image: "busybox"`), "stale"))
+	r.NoError(wfCtx.Commit(ctx))
+
+	name := spilledConfigMapName(wfCtx.store.Name, "large")
+	cm := &corev1.ConfigMap{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, cm))
+	r.Equal("image: \"nginx\"\n", cm.Data[ConfigMapKeySpilledData])
+	r.Equal("true", cm.Labels[LabelSpilledVar])
+	r.Equal(owner, cm.OwnerReferences)
+	r.NotContains(wfCtx.store.Data[ConfigMapKeyVars], "nginx")
+
+	loaded, err := LoadContext(ctx, "default", "app", wfCtx.store.Name)
+	r.NoError(err)
+	v, err := loaded.GetVar("large", "image")
+	r.NoError(err)
+	image, err := v.String()
+	r.NoError(err)
+	r.Equal("nginx", image)
+
+	r.NoError(loaded.DeleteVar("large"))
+	r.NoError(loaded.Commit(ctx))
+	r.True(kerrors.IsNotFound(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: name}, cm)))
+
+	store := loaded.GetStore()
+	store.Data[ConfigMapKeyVars] = ""
+	r.NoError(PruneSpilledVars(ctx, cli, store))
+	cms := &corev1.ConfigMapList{}
+	r.NoError(cli.List(ctx, cms, client.MatchingLabels{LabelSpilledVar: "true"}))
+	r.Empty(cms.Items)
+}
+
+func TestSpilledConfigMapName(t *testing.T) {
+	r := require.New(t)
+	name := spilledConfigMapName(strings.Repeat("a", 260), "large")
+	r.Len(name, validation.DNS1123SubdomainMaxLength)
+	r.True(strings.HasSuffix(name, "-spilled-"+spilledConfigMapHash("large")))
+	r.NotEqual(spilledConfigMapName("workflow-app-context", "a"), spilledConfigMapName("workflow-app-context", "b"))
+}
+
 func newContextForTest(t *testing.T) *WorkflowContext {
 	r := require.New(t)
 	var cm corev1.ConfigMap
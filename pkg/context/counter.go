@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package context
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// ConfigMapKeyCounterPrefix is the key prefix in ConfigMap Data field for containing the value of the counter
+	ConfigMapKeyCounterPrefix = "counter."
+)
+
+var counterMu sync.Mutex
+
+// GetCounter returns the value of the counter in the workflow context, the counter that is not set is 0.
+func GetCounter(wfCtx Context, name string) (int64, error) {
+	if err := validateCounterName(name); err != nil {
+		return 0, err
+	}
+	return parseCounter(name, wfCtx.GetMutableValue(ConfigMapKeyCounterPrefix+name))
+}
+
+// UpdateCounter updates the counter of the run and returns the updated value. The counter is kept in the workflow
+// context and persisted by the commit of the context. The update is applied once per execution of the caller, the
+// value updated in the execution is returned if the caller updates the counter again in the same execution.
+func UpdateCounter(wfCtx Context, name, caller, execution string, update func(int64) int64) (int64, error) {
+	if err := validateCounterName(name); err != nil {
+		return 0, err
+	}
+	key := ConfigMapKeyCounterPrefix + name
+	counterMu.Lock()
+	defer counterMu.Unlock()
+	if v, ok := wfCtx.GetValueInMemory(key, caller); ok {
+		if updated, ok := v.(counterExecution); ok && updated.execution == execution {
+			return updated.value, nil
+		}
+	}
+	current, err := parseCounter(name, wfCtx.GetMutableValue(key))
+	if err != nil {
+		return 0, err
+	}
+	value := update(current)
+	wfCtx.SetMutableValue(strconv.FormatInt(value, 10), key)
+	wfCtx.SetValueInMemory(counterExecution{execution: execution, value: value}, key, caller)
+	return value, nil
+}
+
+// counterExecution records the value of the counter updated by an execution of the caller
+type counterExecution struct {
+	execution string
+	value     int64
+}
+
+func validateCounterName(name string) error {
+	if name == "" {
+		return fmt.Errorf("the name of the counter can not be empty")
+	}
+	if errs := validation.IsConfigMapKey(ConfigMapKeyCounterPrefix + name); len(errs) > 0 {
+		return fmt.Errorf("invalid name of the counter %s: %s", name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func parseCounter(name, data string) (int64, error) {
+	if data == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return 0, errors.WithMessagef(err, "invalid value of the counter %s", name)
+	}
+	return value, nil
+}
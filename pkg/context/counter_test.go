@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package context
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubevela/pkg/util/singleton"
+)
+
+func TestCounter(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+	singleton.KubeClient.Set(cli)
+
+	wfCtx, err := NewContext(ctx, "default", "counter", nil)
+	r.NoError(err)
+	r.NoError(wfCtx.Commit(ctx))
+	increment := func(v int64) int64 { return v + 1 }
+
+	value, err := GetCounter(wfCtx, "loop")
+	r.NoError(err)
+	r.Equal(int64(0), value)
+	value, err = UpdateCounter(wfCtx, "loop", "step", "1", increment)
+	r.NoError(err)
+	r.Equal(int64(1), value)
+	value, err = UpdateCounter(wfCtx, "loop", "step", "2", increment)
+	r.NoError(err)
+	r.Equal(int64(2), value)
+	// the counter is updated once per execution of the caller
+	value, err = UpdateCounter(wfCtx, "loop", "step", "2", increment)
+	r.NoError(err)
+	r.Equal(int64(2), value)
+	value, err = UpdateCounter(wfCtx, "loop", "other", "2", increment)
+	r.NoError(err)
+	r.Equal(int64(3), value)
+	value, err = GetCounter(wfCtx, "loop")
+	r.NoError(err)
+	r.Equal(int64(3), value)
+
+	// the counter is persisted by the commit of the context
+	cm := &corev1.ConfigMap{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: wfCtx.StoreRef().Name}, cm))
+	r.Equal("", cm.Data[ConfigMapKeyCounterPrefix+"loop"])
+	r.NoError(wfCtx.Commit(ctx))
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: wfCtx.StoreRef().Name}, cm))
+	r.Equal("3", cm.Data[ConfigMapKeyCounterPrefix+"loop"])
+	loaded, err := LoadContext(ctx, "default", "counter", wfCtx.StoreRef().Name)
+	r.NoError(err)
+	value, err = GetCounter(loaded, "loop")
+	r.NoError(err)
+	r.Equal(int64(3), value)
+
+	_, err = UpdateCounter(wfCtx, "", "step", "3", increment)
+	r.ErrorContains(err, "the name of the counter can not be empty")
+	_, err = GetCounter(wfCtx, "invalid/name")
+	r.ErrorContains(err, "invalid name of the counter invalid/name")
+	wfCtx.SetMutableValue("abc", ConfigMapKeyCounterPrefix+"broken")
+	_, err = GetCounter(wfCtx, "broken")
+	r.ErrorContains(err, "invalid value of the counter broken")
+}
@@ -27,6 +27,8 @@ import (
 type Context interface {
 	GetVar(paths ...string) (cue.Value, error)
 	SetVar(v cue.Value, paths ...string) error
+	ReplaceVar(v cue.Value, paths ...string) error
+	DeleteVar(paths ...string) error
 	GetStore() *corev1.ConfigMap
 	GetMutableValue(path ...string) string
 	SetMutableValue(data string, path ...string)
@@ -41,8 +41,21 @@ const (
 	ContextStepName = "stepName"
 	// ContextStepGroupName  is the name of the stepGroup
 	ContextStepGroupName = "stepGroupName"
+	// ContextAtomicGroup is the session id of the atomic step group, it's only set in the sub steps of the atomic groups
+	ContextAtomicGroup = "atomicGroup"
 	// ContextSpanID is name for span id.
 	ContextSpanID = "spanID"
+	// ContextIdempotencyToken is the idempotency token of the execution of the step, it's the same across the retries
+	// of the step
+	ContextIdempotencyToken = "idempotencyToken"
+	// ContextStepTimeout is the timeout of the step, it's only set if the timeout of the step is specified
+	ContextStepTimeout = "stepTimeout"
+	// ContextMetadata is the labels and annotations of the workflow run encoded in JSON, it's the snapshot taken when the
+	// run is initialized
+	ContextMetadata = "metadata"
+	// ContextDependents is the comma separated names of the steps that depend on the step, it's only set if the step
+	// has dependents
+	ContextDependents = "dependents"
 	// OutputSecretName is used to store all secret names which are generated by cloud resource components
 	OutputSecretName = "outputSecretName"
 )
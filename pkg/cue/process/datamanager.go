@@ -1,6 +1,10 @@
 package process
 
-import "github.com/kubevela/workflow/pkg/cue/model"
+import (
+	"strings"
+
+	"github.com/kubevela/workflow/pkg/cue/model"
+)
 
 // DataManager is in charge of injecting and removing runtime context for ContextData
 type DataManager interface {
@@ -41,6 +45,14 @@ func WithGroupName(name string) StepMetaKV {
 	}
 }
 
+// WithAtomicGroup return the session id of the atomic step group of the step
+func WithAtomicGroup(id string) StepMetaKV {
+	return StepMetaKV{
+		Key:   model.ContextAtomicGroup,
+		Value: id,
+	}
+}
+
 // WithSpanID return spanID of the step
 func WithSpanID(id string) StepMetaKV {
 	return StepMetaKV{
@@ -49,6 +61,30 @@ func WithSpanID(id string) StepMetaKV {
 	}
 }
 
+// WithIdempotencyToken return idempotencyToken of the step
+func WithIdempotencyToken(token string) StepMetaKV {
+	return StepMetaKV{
+		Key:   model.ContextIdempotencyToken,
+		Value: token,
+	}
+}
+
+// WithTimeout return stepTimeout of the step
+func WithTimeout(timeout string) StepMetaKV {
+	return StepMetaKV{
+		Key:   model.ContextStepTimeout,
+		Value: timeout,
+	}
+}
+
+// WithDependents return dependents of the step, they're joined by commas to keep the context a map of strings
+func WithDependents(dependents []string) StepMetaKV {
+	return StepMetaKV{
+		Key:   model.ContextDependents,
+		Value: strings.Join(dependents, ","),
+	}
+}
+
 // NewStepRunTimeMeta create step runtime metadata manager
 func NewStepRunTimeMeta() DataManager {
 	return &StepRunTimeMeta{}
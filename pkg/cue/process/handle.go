@@ -85,6 +85,8 @@ type ContextData struct {
 	StepName       string
 	WorkflowName   string
 	PublishVersion string
+	Labels         map[string]string
+	Annotations    map[string]string
 
 	Ctx            context.Context
 	CustomData     map[string]interface{}
@@ -107,6 +109,23 @@ func NewContext(data ContextData) Context {
 	ctx.PushData(model.ContextNamespace, data.Namespace)
 	ctx.PushData(model.ContextWorkflowName, data.WorkflowName)
 	ctx.PushData(model.ContextPublishVersion, data.PublishVersion)
+	if data.Labels != nil || data.Annotations != nil {
+		metadata := map[string]interface{}{
+			"labels":      map[string]string{},
+			"annotations": map[string]string{},
+		}
+		if data.Labels != nil {
+			metadata["labels"] = data.Labels
+		}
+		if data.Annotations != nil {
+			metadata["annotations"] = data.Annotations
+		}
+		// the metadata is encoded in JSON to keep the context a map of strings, so that the templates copying the
+		// whole context into the fields of strings still work
+		if b, err := json.Marshal(metadata); err == nil {
+			ctx.PushData(model.ContextMetadata, string(b))
+		}
+	}
 	return ctx
 }
 
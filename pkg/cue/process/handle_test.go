@@ -81,6 +81,7 @@ image: "myserver"
 		Namespace:      "myns",
 		WorkflowName:   "myworkflow",
 		PublishVersion: "mypublishversion",
+		Labels:         map[string]string{"tenant": "tenant-a"},
 	})
 	err = ctx.SetBase(base)
 	r.NoError(err)
@@ -132,4 +133,8 @@ image: "myserver"
 	arbitraryData, err := ctxInst.LookupPath(value.FieldPath("context", "arbitraryData")).MarshalJSON()
 	r.Equal(nil, err)
 	r.Equal("{\"bool\":false,\"int\":10,\"map\":{\"key\":\"value\"},\"slice\":[\"str1\",\"str2\",\"str3\"],\"string\":\"mytxt\"}", string(arbitraryData))
+
+	metadata, err := ctxInst.LookupPath(value.FieldPath("context", model.ContextMetadata)).String()
+	r.Equal(nil, err)
+	r.Equal(`{"annotations":{},"labels":{"tenant":"tenant-a"}}`, metadata)
 }
@@ -0,0 +1,526 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/pkg/cue/util"
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model/value"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	wfTypes "github.com/kubevela/workflow/pkg/types"
+)
+
+// RunSnapshot is the state of a workflowrun captured at a moment for the offline analysis. The data of the secrets,
+// the known credential fields, e.g. the authorization headers and the passwords in the properties, and the values of
+// the sensitive outputs are redacted.
+type RunSnapshot struct {
+	// CapturedAt is the time that the snapshot is captured
+	CapturedAt metav1.Time `json:"capturedAt"`
+	// Run is the workflowrun with its spec and status
+	Run *v1alpha1.WorkflowRun `json:"run"`
+	// Workflow is the workflow of the run resolved from its spec or the referenced workflow
+	Workflow *v1alpha1.WorkflowSpec `json:"workflow,omitempty"`
+	// Mode is the execute mode of the run, which defaults to the mode of the referenced workflow
+	Mode *v1alpha1.WorkflowExecuteMode `json:"mode,omitempty"`
+	// Context is the data of the context backend except the recorded calls of the providers
+	Context map[string]string `json:"context,omitempty"`
+	// Debug are the rendered values of the steps recorded in debug mode, keyed by the step name
+	Debug map[string]string `json:"debug,omitempty"`
+	// ProviderCalls are the recorded calls of the providers to replay the run
+	ProviderCalls []providertypes.ProviderCall `json:"providerCalls,omitempty"`
+}
+
+// credentialFields are the names of the known credential fields normalized by normalizeField, e.g. the
+// `Authorization` header of the http requests and the `password` of the email senders
+var credentialFields = map[string]bool{
+	"authorization":      true,
+	"proxyauthorization": true,
+	"cookie":             true,
+	"setcookie":          true,
+	"xapikey":            true,
+	"apikey":             true,
+	"password":           true,
+	"passwd":             true,
+	"token":              true,
+	"accesstoken":        true,
+	"refreshtoken":       true,
+	"secret":             true,
+	"clientsecret":       true,
+	"secretkey":          true,
+	"secretaccesskey":    true,
+	"privatekey":         true,
+	"credentials":        true,
+}
+
+// normalizeField normalizes the name of the field to match the credential fields, e.g. `X-Api-Key` is `xapikey`
+func normalizeField(name string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// Snapshot captures the spec, the status, the context backend and the debug data of the workflowrun, the snapshot
+// is stamped by the clock in ctx
+func Snapshot(ctx context.Context, cli client.Client, wr *v1alpha1.WorkflowRun) (*RunSnapshot, error) {
+	snapshot := &RunSnapshot{CapturedAt: metav1.NewTime(providertypes.ClockFrom(ctx).Now()), Run: wr.DeepCopy()}
+	snapshot.Run.ManagedFields = nil
+	delete(snapshot.Run.Annotations, corev1.LastAppliedConfigAnnotation)
+	spec, mode, err := resolveWorkflow(ctx, cli, wr)
+	if err != nil {
+		return nil, errors.WithMessage(err, "resolve the workflow")
+	}
+	sensitive := sensitiveOutputs(spec)
+	snapshot.Workflow, snapshot.Mode = redactSpec(spec), mode
+	snapshot.Run.Spec.WorkflowSpec = redactSpec(snapshot.Run.Spec.WorkflowSpec)
+	snapshot.Run.Spec.Context = redactRaw(snapshot.Run.Spec.Context)
+
+	if ref := wr.Status.ContextBackend; ref != nil {
+		store := &corev1.ConfigMap{}
+		if err := cli.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, store); err != nil {
+			if !kerrors.IsNotFound(err) {
+				return nil, errors.WithMessage(err, "get the context backend")
+			}
+		}
+		if snapshot.Context, snapshot.ProviderCalls, err = redactContext(store.Data, sensitive); err != nil {
+			return nil, err
+		}
+	}
+
+	collect := func(statuses []v1alpha1.StepStatus) error {
+		for _, status := range statuses {
+			cm := &corev1.ConfigMap{}
+			if err := cli.Get(ctx, client.ObjectKey{Namespace: wr.Namespace, Name: GenerateContextName(wr.Name, status.ID, string(wr.UID))}, cm); err != nil {
+				if !kerrors.IsNotFound(err) {
+					return errors.WithMessagef(err, "get the debug data of the step %s", status.Name)
+				}
+			} else if data, ok := cm.Data["debug"]; ok {
+				if snapshot.Debug == nil {
+					snapshot.Debug = make(map[string]string)
+				}
+				snapshot.Debug[status.Name] = redactCUE(data, nil)
+			}
+		}
+		return nil
+	}
+	for _, status := range wr.Status.Steps {
+		if err := collect([]v1alpha1.StepStatus{status.StepStatus}); err != nil {
+			return nil, err
+		}
+		if err := collect(status.SubStepsStatus); err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// LoadSnapshot decodes the snapshot dumped in JSON
+func LoadSnapshot(data []byte) (*RunSnapshot, error) {
+	snapshot := &RunSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Run == nil {
+		return nil, errors.New("the snapshot has no workflowrun")
+	}
+	return snapshot, nil
+}
+
+// ReplayRun returns a new workflowrun with the name that runs the resolved workflow of the snapshot. It should be
+// executed with the Replayer so that the recorded calls of the providers are replayed instead of calling them.
+func (s *RunSnapshot) ReplayRun(name string) *v1alpha1.WorkflowRun {
+	run := &v1alpha1.WorkflowRun{
+		TypeMeta: s.Run.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.Run.Namespace,
+			Labels:    s.Run.Labels,
+		},
+		Spec: *s.Run.Spec.DeepCopy(),
+	}
+	run.Spec.WorkflowRef = ""
+	run.Spec.WorkflowSpec = s.Workflow.DeepCopy()
+	if run.Spec.Mode == nil {
+		run.Spec.Mode = s.Mode.DeepCopy()
+	}
+	return run
+}
+
+// Replayer returns the provider trace that replays the recorded calls of the providers in the snapshot
+func (s *RunSnapshot) Replayer() *providertypes.ProviderTrace {
+	return providertypes.NewProviderReplayer(s.ProviderCalls)
+}
+
+func resolveWorkflow(ctx context.Context, cli client.Client, wr *v1alpha1.WorkflowRun) (*v1alpha1.WorkflowSpec, *v1alpha1.WorkflowExecuteMode, error) {
+	switch {
+	case wr.Spec.WorkflowSpec != nil:
+		return wr.Spec.WorkflowSpec, wr.Spec.Mode, nil
+	case wr.Spec.WorkflowRef != "":
+		template := &v1alpha1.Workflow{}
+		if err := cli.Get(ctx, client.ObjectKey{Namespace: wr.Namespace, Name: wr.Spec.WorkflowRef}, template); err != nil {
+			return nil, nil, err
+		}
+		mode := wr.Spec.Mode
+		if mode == nil {
+			mode = template.Mode
+		}
+		return &template.WorkflowSpec, mode, nil
+	default:
+		return nil, wr.Spec.Mode, nil
+	}
+}
+
+func allSteps(spec *v1alpha1.WorkflowSpec) [][]v1alpha1.WorkflowStep {
+	return [][]v1alpha1.WorkflowStep{spec.Steps, spec.OnComplete, spec.OnSuccess, spec.OnFailure}
+}
+
+func sensitiveOutputs(spec *v1alpha1.WorkflowSpec) map[string]bool {
+	sensitive := make(map[string]bool)
+	if spec == nil {
+		return sensitive
+	}
+	add := func(outputs v1alpha1.StepOutputs) {
+		for _, output := range outputs {
+			if output.Sensitive {
+				sensitive[output.Name] = true
+			}
+		}
+	}
+	for _, steps := range allSteps(spec) {
+		for _, step := range steps {
+			add(step.Outputs)
+			for _, sub := range step.SubSteps {
+				add(sub.Outputs)
+			}
+		}
+	}
+	return sensitive
+}
+
+func redactSpec(spec *v1alpha1.WorkflowSpec) *v1alpha1.WorkflowSpec {
+	if spec == nil {
+		return nil
+	}
+	spec = spec.DeepCopy()
+	for _, steps := range allSteps(spec) {
+		redactSteps(steps)
+	}
+	return spec
+}
+
+func redactSteps(steps []v1alpha1.WorkflowStep) {
+	for i := range steps {
+		steps[i].Properties = redactRaw(steps[i].Properties)
+		for j := range steps[i].SubSteps {
+			steps[i].SubSteps[j].Properties = redactRaw(steps[i].SubSteps[j].Properties)
+		}
+	}
+}
+
+// redactContext redacts the data of the context backend, the variables and the spilled variables are in CUE and
+// the other mutable values are redacted if they are in JSON. The values of the sensitive outputs are also redacted
+// from the params and the returns of the recorded calls of the providers, since they may be passed to the providers.
+func redactContext(data map[string]string, sensitive map[string]bool) (map[string]string, []providertypes.ProviderCall, error) {
+	var calls []providertypes.ProviderCall
+	redacted := make(map[string]string, len(data))
+	for key, s := range data {
+		switch {
+		case key == wfTypes.ContextKeyProviderTrace:
+			if err := json.Unmarshal([]byte(s), &calls); err != nil {
+				return nil, nil, errors.WithMessage(err, "decode the recorded calls of the providers")
+			}
+			values := sensitiveValues(data, sensitive)
+			for i := range calls {
+				calls[i].Params = redactCall(calls[i].Params, values)
+				calls[i].Returns = redactCall(calls[i].Returns, values)
+			}
+		case key == wfContext.ConfigMapKeyVars:
+			redacted[key] = redactCUE(s, sensitive)
+		case strings.HasPrefix(key, wfTypes.ContextPrefixGeneratedValue+"."):
+			redacted[key] = redactGeneratedValue(s)
+		case strings.HasPrefix(key, wfContext.ConfigMapKeySpilledVarPrefix):
+			if sensitive[strings.TrimPrefix(key, wfContext.ConfigMapKeySpilledVarPrefix)] {
+				redacted[key] = wfTypes.RedactedValue
+				continue
+			}
+			redacted[key] = redactCUE(s, nil)
+		default:
+			redacted[key] = string(redactJSON([]byte(s)))
+		}
+	}
+	return redacted, calls, nil
+}
+
+// sensitiveValues returns the string values of the sensitive outputs in the variables and the spilled variables
+func sensitiveValues(data map[string]string, sensitive map[string]bool) []string {
+	var values []string
+	vars := cuecontext.New().CompileString(data[wfContext.ConfigMapKeyVars])
+	for name := range sensitive {
+		v := vars.LookupPath(cue.MakePath(cue.Str(name)))
+		if spilled, ok := data[wfContext.ConfigMapKeySpilledVarPrefix+name]; ok {
+			v = cuecontext.New().CompileString(spilled)
+		}
+		if s, err := v.String(); err == nil && s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// redactCall redacts the params or the returns of a recorded call of the provider, the strings that contain the
+// values of the sensitive outputs are redacted besides the data of the secrets and the credential fields
+func redactCall(data json.RawMessage, values []string) json.RawMessage {
+	if len(data) == 0 {
+		return data
+	}
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return data
+	}
+	redacted := redactSecrets(obj)
+	obj, redactedValues := redactValues(obj, values)
+	if !redacted && !redactedValues {
+		return data
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return json.RawMessage(strconv.Quote(wfTypes.RedactedValue))
+	}
+	return b
+}
+
+// redactValues replaces the strings that contain any of the values in the object
+func redactValues(obj interface{}, values []string) (interface{}, bool) {
+	if len(values) == 0 {
+		return obj, false
+	}
+	redacted := false
+	switch o := obj.(type) {
+	case string:
+		for _, v := range values {
+			if strings.Contains(o, v) {
+				return wfTypes.RedactedValue, true
+			}
+		}
+	case map[string]interface{}:
+		for k, v := range o {
+			var ok bool
+			if o[k], ok = redactValues(v, values); ok {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for i, v := range o {
+			var ok bool
+			if o[i], ok = redactValues(v, values); ok {
+				redacted = true
+			}
+		}
+	}
+	return obj, redacted
+}
+
+// redactGeneratedValue redacts the value generated by the gen step if it's sensitive
+func redactGeneratedValue(s string) string {
+	var generated map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &generated); err != nil {
+		return wfTypes.RedactedValue
+	}
+	if sensitive, _ := generated["sensitive"].(bool); !sensitive {
+		return s
+	}
+	generated["value"] = wfTypes.RedactedValue
+	b, err := json.Marshal(generated)
+	if err != nil {
+		return wfTypes.RedactedValue
+	}
+	return string(b)
+}
+
+func redactRaw(raw *runtime.RawExtension) *runtime.RawExtension {
+	if raw == nil || len(raw.Raw) == 0 {
+		return raw
+	}
+	return &runtime.RawExtension{Raw: redactJSON(raw.Raw)}
+}
+
+// redactJSON redacts the data of the secrets and the credential fields in the JSON, the data is returned as it is if
+// it's not JSON
+func redactJSON(data []byte) []byte {
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return data
+	}
+	if !redactSecrets(obj) {
+		return data
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return b
+}
+
+// redactSecrets redacts the data of the secrets and the credential fields in the object
+func redactSecrets(obj interface{}) bool {
+	redacted := false
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for k, v := range o {
+			if credentialFields[normalizeField(k)] && isCredentialValue(v) {
+				o[k] = wfTypes.RedactedValue
+				redacted = true
+			}
+		}
+		if o["kind"] == "Secret" {
+			for _, field := range []string{"data", "stringData"} {
+				if data, ok := o[field].(map[string]interface{}); ok {
+					for k := range data {
+						data[k] = wfTypes.RedactedValue
+						redacted = true
+					}
+				}
+			}
+		}
+		for _, v := range o {
+			redacted = redactSecrets(v) || redacted
+		}
+	case []interface{}:
+		for _, v := range o {
+			redacted = redactSecrets(v) || redacted
+		}
+	}
+	return redacted
+}
+
+// isCredentialValue checks if the value of a credential field should be redacted, i.e. a string or a list of strings
+// such as the values of a http header, the objects are walked into instead, e.g. the `credentials` of a provider
+func isCredentialValue(v interface{}) bool {
+	switch o := v.(type) {
+	case string:
+		return o != wfTypes.RedactedValue
+	case []interface{}:
+		for _, item := range o {
+			if _, ok := item.(string); !ok {
+				return false
+			}
+		}
+		return len(o) > 0
+	default:
+		return false
+	}
+}
+
+// redactCUE redacts the sensitive fields, the data of the secrets and the credential fields in the CUE, the whole
+// content is redacted if it can't be parsed or the fields can't be replaced
+func redactCUE(s string, sensitive map[string]bool) string {
+	if strings.TrimSpace(s) == "" {
+		return s
+	}
+	v := cuecontext.New().CompileString(s)
+	if v.Err() != nil {
+		return wfTypes.RedactedValue
+	}
+	var paths []cue.Path
+	for name := range sensitive {
+		if path := cue.MakePath(cue.Str(name)); v.LookupPath(path).Exists() {
+			paths = append(paths, path)
+		}
+	}
+	paths = append(paths, secretPaths(v, nil)...)
+	if len(paths) == 0 {
+		return s
+	}
+	redactedValue := v.Context().CompileString(strconv.Quote(wfTypes.RedactedValue))
+	var err error
+	for _, path := range paths {
+		if v, err = value.SetValueByScript(v, redactedValue, path.String()); err != nil {
+			return wfTypes.RedactedValue
+		}
+	}
+	redacted, err := util.ToString(v)
+	if err != nil {
+		return wfTypes.RedactedValue
+	}
+	return redacted
+}
+
+// secretPaths returns the paths of the data of the secrets and the credential fields in the value
+func secretPaths(v cue.Value, selectors []cue.Selector) []cue.Path {
+	var paths []cue.Path
+	child := func(sel cue.Selector) []cue.Selector {
+		return append(append([]cue.Selector{}, selectors...), sel)
+	}
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		if kind, err := v.LookupPath(cue.ParsePath("kind")).String(); err == nil && kind == "Secret" {
+			for _, field := range []string{"data", "stringData"} {
+				it, err := v.LookupPath(cue.ParsePath(field)).Fields()
+				if err != nil {
+					continue
+				}
+				for it.Next() {
+					paths = append(paths, cue.MakePath(append(child(cue.Str(field)), it.Selector())...))
+				}
+			}
+		}
+		it, err := v.Fields()
+		if err != nil {
+			return paths
+		}
+		for it.Next() {
+			if isCredentialField(it.Selector(), it.Value()) {
+				paths = append(paths, cue.MakePath(child(it.Selector())...))
+				continue
+			}
+			paths = append(paths, secretPaths(it.Value(), child(it.Selector()))...)
+		}
+	case cue.ListKind:
+		it, err := v.List()
+		if err != nil {
+			return paths
+		}
+		for i := 0; it.Next(); i++ {
+			paths = append(paths, secretPaths(it.Value(), child(cue.Index(i)))...)
+		}
+	}
+	return paths
+}
+
+// isCredentialField checks if the field is a credential field whose value is a string or a list of strings
+func isCredentialField(sel cue.Selector, v cue.Value) bool {
+	if sel.LabelType() != cue.StringLabel || !credentialFields[normalizeField(sel.Unquoted())] {
+		return false
+	}
+	var value interface{}
+	if err := v.Decode(&value); err != nil {
+		return false
+	}
+	return isCredentialValue(value)
+}
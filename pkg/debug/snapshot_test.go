@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+func TestSnapshot(t *testing.T) {
+	r := require.New(t)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := providertypes.WithClock(context.Background(), clocktesting.NewFakeClock(now))
+	scheme := runtime.NewScheme()
+	r.NoError(clientgoscheme.AddToScheme(scheme))
+	r.NoError(v1alpha1.AddToScheme(scheme))
+	secret := `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"creds"},"stringData":{"password":"p@ss"}}`
+	workflow := &v1alpha1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{Name: "template", Namespace: "default"},
+		Mode:       &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG},
+		WorkflowSpec: v1alpha1.WorkflowSpec{Steps: []v1alpha1.WorkflowStep{{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:       "apply",
+				Type:       "apply-object",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"value":` + secret + `}`)},
+				Outputs:    v1alpha1.StepOutputs{{Name: "token", ValueFrom: "output.token", Sensitive: true}, {Name: "name", ValueFrom: "output.name"}},
+			},
+		}}},
+	}
+	run := &v1alpha1.WorkflowRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "wr", Namespace: "default", UID: "12345678"},
+		Spec:       v1alpha1.WorkflowRunSpec{WorkflowRef: "template"},
+		Status: v1alpha1.WorkflowRunStatus{
+			ContextBackend: &corev1.ObjectReference{Name: "workflow-wr-context", Namespace: "default"},
+			Steps:          []v1alpha1.WorkflowStepStatus{{StepStatus: v1alpha1.StepStatus{ID: "step-id", Name: "apply"}}},
+		},
+	}
+	workflow.Steps = append(workflow.Steps, v1alpha1.WorkflowStep{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+		Name:       "notify",
+		Type:       "webhook",
+		Properties: &runtime.RawExtension{Raw: []byte(`{"url":"https://example.com","header":{"Authorization":"Bearer abc"},"sender":{"address":"a@b.c","password":"pwd"},"secret":{"name":"creds"}}`)},
+	}})
+	calls, err := json.Marshal([]map[string]interface{}{
+		{"provider": "kube.read", "returns": map[string]interface{}{"value": json.RawMessage(secret)}},
+		{
+			"provider": "http.do",
+			"params":   map[string]interface{}{"request": map[string]interface{}{"header": map[string]interface{}{"X-Api-Key": "k3y"}, "body": `{"token":"s3cr3t"}`}},
+			"returns":  map[string]interface{}{"response": map[string]interface{}{"header": map[string]interface{}{"Set-Cookie": []string{"session=1"}}}},
+		},
+	})
+	r.NoError(err)
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(workflow,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "workflow-wr-context", Namespace: "default"},
+			Data: map[string]string{
+				wfContext.ConfigMapKeyVars:                          `token: "s3cr3t", name: "app", creds: {kind: "Secret", data: {password: "cEBzcw=="}}`,
+				wfContext.ConfigMapKeySpilledVarPrefix + "token":    `"s3cr3t"`,
+				types.ContextKeyProviderTrace:                       string(calls),
+				"plain":                                             "value",
+				types.ContextPrefixGeneratedValue + ".gen.password": `{"kind":"randomString","sensitive":true,"value":"g3n3rat3d"}`,
+				types.ContextPrefixGeneratedValue + ".gen.suffix":   `{"kind":"randomString","value":"x1y2"}`,
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: GenerateContextName("wr", "step-id", "12345678"), Namespace: "default"},
+			Data:       map[string]string{"debug": `value: ` + secret + "\nrequest: header: Authorization: \"Bearer abc\""},
+		},
+	).Build()
+
+	snapshot, err := Snapshot(ctx, cli, run)
+	r.NoError(err)
+	r.Equal(now, snapshot.CapturedAt.Time.UTC())
+	r.Equal(workflow.Mode, snapshot.Mode)
+	r.JSONEq(`{"url":"https://example.com","header":{"Authorization":"<redacted>"},"sender":{"address":"a@b.c","password":"<redacted>"},"secret":{"name":"creds"}}`, string(snapshot.Workflow.Steps[1].Properties.Raw))
+	r.JSONEq(`{"value":{"apiVersion":"v1","kind":"Secret","metadata":{"name":"creds"},"stringData":{"password":"<redacted>"}}}`, string(snapshot.Workflow.Steps[0].Properties.Raw))
+	vars := cuecontext.New().CompileString(snapshot.Context[wfContext.ConfigMapKeyVars])
+	r.NoError(vars.Err())
+	for path, expected := range map[string]string{"token": types.RedactedValue, "name": "app", "creds.data.password": types.RedactedValue} {
+		s, err := vars.LookupPath(cue.ParsePath(path)).String()
+		r.NoError(err)
+		r.Equal(expected, s)
+	}
+	r.Equal(types.RedactedValue, snapshot.Context[wfContext.ConfigMapKeySpilledVarPrefix+"token"])
+	r.Equal("value", snapshot.Context["plain"])
+	r.NotContains(snapshot.Context, types.ContextKeyProviderTrace)
+	r.JSONEq(`{"kind":"randomString","sensitive":true,"value":"<redacted>"}`, snapshot.Context[types.ContextPrefixGeneratedValue+".gen.password"])
+	r.JSONEq(`{"kind":"randomString","value":"x1y2"}`, snapshot.Context[types.ContextPrefixGeneratedValue+".gen.suffix"])
+	r.Len(snapshot.ProviderCalls, 2)
+	r.Equal("kube.read", snapshot.ProviderCalls[0].Provider)
+	r.NotContains(string(snapshot.ProviderCalls[0].Returns), "p@ss")
+	r.JSONEq(`{"request":{"header":{"X-Api-Key":"<redacted>"},"body":"<redacted>"}}`, string(snapshot.ProviderCalls[1].Params))
+	r.JSONEq(`{"response":{"header":{"Set-Cookie":"<redacted>"}}}`, string(snapshot.ProviderCalls[1].Returns))
+	r.NotContains(snapshot.Debug["apply"], "p@ss")
+	r.Contains(snapshot.Debug["apply"], types.RedactedValue)
+	r.NotContains(snapshot.Debug["apply"], "Bearer abc")
+
+	// the dumped snapshot can be loaded to replay the run
+	b, err := json.Marshal(snapshot)
+	r.NoError(err)
+	loaded, err := LoadSnapshot(b)
+	r.NoError(err)
+	replay := loaded.ReplayRun("wr-replay")
+	r.Equal("wr-replay", replay.Name)
+	r.Equal("", replay.Spec.WorkflowRef)
+	r.Equal(workflow.Mode, replay.Spec.Mode)
+	r.Equal("apply", replay.Spec.WorkflowSpec.Steps[0].Name)
+	r.NotNil(loaded.Replayer())
+	_, err = LoadSnapshot([]byte(`{}`))
+	r.Error(err)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package executor
 
 import (
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/types"
 )
 
@@ -37,3 +38,83 @@ func (w *withStatusPatcher) ApplyTo(e *workflowExecutor) {
 func WithStatusPatcher(patcher types.StatusPatcher) Option {
 	return &withStatusPatcher{patcher: patcher}
 }
+
+type withProviderTrace struct {
+	trace *providertypes.ProviderTrace
+}
+
+func (w *withProviderTrace) ApplyTo(e *workflowExecutor) {
+	e.providerTrace = w.trace
+}
+
+// WithProviderTrace set the provider trace to record the calls of providers,
+// or replay the recorded calls to re-execute the workflow deterministically
+func WithProviderTrace(trace *providertypes.ProviderTrace) Option {
+	return &withProviderTrace{trace: trace}
+}
+
+type withInitHooks struct {
+	hooks []types.WorkflowInitHook
+}
+
+func (w *withInitHooks) ApplyTo(e *workflowExecutor) {
+	e.initHooks = append(e.initHooks, w.hooks...)
+}
+
+// WithInitHooks set the hooks to prepare the context backend before any step runs
+func WithInitHooks(hooks ...types.WorkflowInitHook) Option {
+	return &withInitHooks{hooks: hooks}
+}
+
+type withClock struct {
+	clock types.Clock
+}
+
+func (w *withClock) ApplyTo(e *workflowExecutor) {
+	e.clock = w.clock
+}
+
+// WithClock set the clock to get the time in execution, the real clock is used by default
+func WithClock(clock types.Clock) Option {
+	return &withClock{clock: clock}
+}
+
+type withPaused struct {
+	paused bool
+}
+
+func (w *withPaused) ApplyTo(e *workflowExecutor) {
+	e.paused = w.paused
+}
+
+// WithPaused holds the steps that are not started if the controller is paused, the started steps are allowed to finish
+func WithPaused(paused bool) Option {
+	return &withPaused{paused: paused}
+}
+
+type withAuditSink struct {
+	sink types.AuditSink
+}
+
+func (w *withAuditSink) ApplyTo(e *workflowExecutor) {
+	e.auditSink = w.sink
+}
+
+// WithAuditSink set the sink to record the audit entries of the executed steps and the finished run
+func WithAuditSink(sink types.AuditSink) Option {
+	return &withAuditSink{sink: sink}
+}
+
+type withArchiveHook struct {
+	hook func(err error)
+}
+
+func (w *withArchiveHook) ApplyTo(e *workflowExecutor) {
+	e.archiveHook = w.hook
+}
+
+// WithArchiveHook set the hook called with the result of archiving the full status of the finished steps if
+// PruneFinishedStepStatus is enabled, the status should only be pruned once the archive succeeds
+func WithArchiveHook(hook func(err error)) Option {
+	return &withArchiveHook{hook: hook}
+}
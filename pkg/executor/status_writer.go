@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+type statusUpdate struct {
+	status   *v1alpha1.WorkflowRunStatus
+	isUpdate bool
+}
+
+// statusWriter serializes the status updates of a run through a single goroutine. The updates are coalesced so that
+// only the latest status is written once in the debounce interval, which reduces the writes and the conflicts of the
+// runs that update the status of many steps in a reconcile.
+type statusWriter struct {
+	patcher  types.StatusPatcher
+	interval time.Duration
+	updates  chan statusUpdate
+	flushes  chan chan error
+	stopped  chan struct{}
+}
+
+func newStatusWriter(ctx context.Context, patcher types.StatusPatcher, interval time.Duration) *statusWriter {
+	w := &statusWriter{
+		patcher:  patcher,
+		interval: interval,
+		updates:  make(chan statusUpdate),
+		flushes:  make(chan chan error),
+		stopped:  make(chan struct{}),
+	}
+	go w.run(ctx)
+	return w
+}
+
+// Write queues the snapshot of the status, it's written after the debounce interval with the later updates
+func (w *statusWriter) Write(status *v1alpha1.WorkflowRunStatus, isUpdate bool) {
+	w.updates <- statusUpdate{status: status.DeepCopy(), isUpdate: isUpdate}
+}
+
+// Flush writes the queued status at once, the error of the writes since the last flush is returned
+func (w *statusWriter) Flush() error {
+	ch := make(chan error)
+	w.flushes <- ch
+	return <-ch
+}
+
+// Close flushes the queued status and stops the writer
+func (w *statusWriter) Close() error {
+	err := w.Flush()
+	close(w.updates)
+	<-w.stopped
+	return err
+}
+
+func (w *statusWriter) run(ctx context.Context) {
+	defer close(w.stopped)
+	var (
+		pending *statusUpdate
+		timer   *time.Timer
+		tick    <-chan time.Time
+		lastErr error
+	)
+	write := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, tick = nil, nil
+		}
+		if pending == nil {
+			return
+		}
+		if err := w.patcher(ctx, pending.status, pending.isUpdate); err != nil {
+			lastErr = err
+		}
+		pending = nil
+	}
+	for {
+		select {
+		case update, ok := <-w.updates:
+			if !ok {
+				return
+			}
+			// the update is required if any of the coalesced updates requires it, e.g. to clear a field
+			if pending != nil {
+				update.isUpdate = update.isUpdate || pending.isUpdate
+			}
+			pending = &update
+			if timer == nil {
+				timer = time.NewTimer(w.interval)
+				tick = timer.C
+			}
+		case <-tick:
+			timer, tick = nil, nil
+			write()
+		case ch := <-w.flushes:
+			write()
+			ch <- lastErr
+			lastErr = nil
+		}
+	}
+}
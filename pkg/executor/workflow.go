@@ -18,28 +18,42 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
 	"k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/utils/clock"
 
 	monitorContext "github.com/kubevela/pkg/monitor/context"
+	"github.com/kubevela/pkg/util/singleton"
 
+	"github.com/kubevela/workflow/api/condition"
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/debug"
 	"github.com/kubevela/workflow/pkg/features"
 	"github.com/kubevela/workflow/pkg/hooks"
 	"github.com/kubevela/workflow/pkg/monitor/metrics"
+	"github.com/kubevela/workflow/pkg/providers/kube"
 	"github.com/kubevela/workflow/pkg/providers/legacy/workspace"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/tasks/custom"
 	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
 )
 
 var (
@@ -47,6 +61,8 @@ var (
 	DisableRecorder = false
 	// StepStatusCache cache the step status
 	StepStatusCache sync.Map
+	// runCancels holds the cancel functions of the workflow runs that are executing their steps
+	runCancels sync.Map
 )
 
 const (
@@ -57,14 +73,20 @@ const (
 )
 
 type workflowExecutor struct {
-	instance *types.WorkflowInstance
-	wfCtx    wfContext.Context
-	patcher  types.StatusPatcher
+	instance      *types.WorkflowInstance
+	wfCtx         wfContext.Context
+	patcher       types.StatusPatcher
+	providerTrace *providertypes.ProviderTrace
+	initHooks     []types.WorkflowInitHook
+	clock         types.Clock
+	paused        bool
+	auditSink     types.AuditSink
+	archiveHook   func(err error)
 }
 
 // New returns a Workflow Executor implementation.
 func New(instance *types.WorkflowInstance, options ...Option) WorkflowExecutor {
-	executor := &workflowExecutor{instance: instance}
+	executor := &workflowExecutor{instance: instance, clock: clock.RealClock{}}
 	for _, opt := range options {
 		opt.ApplyTo(executor)
 	}
@@ -72,7 +94,7 @@ func New(instance *types.WorkflowInstance, options ...Option) WorkflowExecutor {
 }
 
 // InitializeWorkflowInstance init workflow instance
-func InitializeWorkflowInstance(instance *types.WorkflowInstance) {
+func InitializeWorkflowInstance(instance *types.WorkflowInstance, now time.Time) {
 	if instance.Status.StartTime.IsZero() && len(instance.Status.Steps) == 0 {
 		metrics.WorkflowRunInitializedCounter.WithLabelValues().Inc()
 		mode := v1alpha1.WorkflowExecuteMode{
@@ -88,21 +110,58 @@ func InitializeWorkflowInstance(instance *types.WorkflowInstance) {
 			}
 		}
 		instance.Status = v1alpha1.WorkflowRunStatus{
-			Mode:      mode,
-			StartTime: metav1.Now(),
+			Mode: mode,
+			// the context applied with the workflow parameters is frozen once the run is initialized
+			Context:   instance.Status.Context,
+			Metadata:  snapshotMetadata(instance),
+			StartTime: metav1.NewTime(now),
 		}
 		StepStatusCache.Delete(fmt.Sprintf("%s-%s", instance.Name, instance.Namespace))
 		wfContext.CleanupMemoryStore(instance.Name, instance.Namespace)
 	}
 }
 
+// snapshotMetadata returns the snapshot of the labels and annotations of the workflow instance, the last applied
+// configuration of kubectl is excluded. It returns nil if there are no labels and annotations.
+func snapshotMetadata(instance *types.WorkflowInstance) *v1alpha1.RunMetadata {
+	var metadata *v1alpha1.RunMetadata
+	for k, v := range instance.Labels {
+		if metadata == nil {
+			metadata = &v1alpha1.RunMetadata{}
+		}
+		if metadata.Labels == nil {
+			metadata.Labels = make(map[string]string)
+		}
+		metadata.Labels[k] = v
+	}
+	for k, v := range instance.Annotations {
+		if k == corev1.LastAppliedConfigAnnotation {
+			continue
+		}
+		if metadata == nil {
+			metadata = &v1alpha1.RunMetadata{}
+		}
+		if metadata.Annotations == nil {
+			metadata.Annotations = make(map[string]string)
+		}
+		metadata.Annotations[k] = v
+	}
+	return metadata
+}
+
 // ExecuteRunners execute workflow task runners in order.
 func (w *workflowExecutor) ExecuteRunners(ctx monitorContext.Context, taskRunners []types.TaskRunner) (v1alpha1.WorkflowRunPhase, error) {
-	InitializeWorkflowInstance(w.instance)
+	InitializeWorkflowInstance(w.instance, w.clock.Now())
 	status := &w.instance.Status
 	dagMode := status.Mode.Steps == v1alpha1.WorkflowModeDAG
 	cacheKey := fmt.Sprintf("%s-%s", w.instance.Name, w.instance.Namespace)
 
+	if count := countSteps(w.instance); types.MaxWorkflowSteps > 0 && count > types.MaxWorkflowSteps {
+		status.Terminated = true
+		status.Message = fmt.Sprintf(types.MessageExceedMaxWorkflowSteps, count, types.MaxWorkflowSteps)
+		return v1alpha1.WorkflowStateFailed, nil
+	}
+
 	allRunnersDone, allRunnersSucceeded := checkRunners(taskRunners, w.instance.Status)
 	if status.Finished {
 		StepStatusCache.Delete(cacheKey)
@@ -111,6 +170,9 @@ func (w *workflowExecutor) ExecuteRunners(ctx monitorContext.Context, taskRunner
 		if isTerminatedManually(status) {
 			return v1alpha1.WorkflowStateTerminated, nil
 		}
+		if isExitedCleanly(status) {
+			return v1alpha1.WorkflowStateSucceeded, nil
+		}
 		return v1alpha1.WorkflowStateFailed, nil
 	}
 	if checkWorkflowSuspended(status) {
@@ -127,6 +189,46 @@ func (w *workflowExecutor) ExecuteRunners(ctx monitorContext.Context, taskRunner
 	}
 	w.wfCtx = wfCtx
 
+	if err := w.initializeContext(ctx, wfCtx); err != nil {
+		var sharedErr *hooks.SharedInputError
+		if errors.As(err, &sharedErr) {
+			status.Terminated = true
+			status.Message = fmt.Sprintf(types.MessageFailedSharedInputs, sharedErr.Error())
+			return v1alpha1.WorkflowStateFailed, nil
+		}
+		ctx.Error(err, "initialize context")
+		return v1alpha1.WorkflowStateInitializing, errors.WithMessage(err, "initialize context")
+	}
+
+	trace := w.providerTrace
+	if trace == nil && w.instance.Annotations[types.AnnotationRecordProviderTrace] == "true" {
+		trace = providertypes.NewProviderRecorder()
+	}
+	ctx = ctx.Fork("")
+	ctx.SetContext(providertypes.WithClock(ctx.GetContext(), w.clock))
+	signal, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runCancels.Store(cacheKey, cancel)
+	defer runCancels.Delete(cacheKey)
+	ctx.SetContext(providertypes.WithCancelSignal(ctx.GetContext(), signal))
+	ctx.SetContext(providertypes.WithRunUID(ctx.GetContext(), string(w.instance.UID)))
+	if w.instance.Annotations[types.AnnotationPermissionCheck] == "true" {
+		ctx.SetContext(providertypes.WithPermissionCheck(ctx.GetContext()))
+		missing, err := w.checkPermissions(ctx, wfCtx, taskRunners)
+		if err != nil {
+			ctx.Error(err, "check permissions")
+			return v1alpha1.WorkflowStateInitializing, errors.WithMessage(err, "check permissions")
+		}
+		if len(missing) > 0 {
+			status.Terminated = true
+			status.Message = fmt.Sprintf(types.MessageMissingPermissions, strings.Join(missing, ", "))
+			return v1alpha1.WorkflowStateFailed, nil
+		}
+	}
+	if trace != nil {
+		ctx.SetContext(providertypes.WithProviderTrace(ctx.GetContext(), trace))
+	}
+
 	if cacheValue, ok := StepStatusCache.Load(cacheKey); ok {
 		// handle cache resource
 		if len(status.Steps) < cacheValue.(int) {
@@ -135,19 +237,68 @@ func (w *workflowExecutor) ExecuteRunners(ctx monitorContext.Context, taskRunner
 	}
 
 	e := newEngine(ctx, wfCtx, w, status, taskRunners)
+	if types.StatusUpdateDebounce > 0 && e.statusPatcher != nil && feature.DefaultMutableFeatureGate.Enabled(features.EnablePatchStatusAtOnce) {
+		e.statusWriter = newStatusWriter(ctx.GetContext(), e.statusPatcher, types.StatusUpdateDebounce)
+	}
 
 	err = e.Run(ctx, taskRunners, dagMode)
+	if e.recordExecutionOrder {
+		e.trimExecutionOrder()
+	}
+	if e.statusWriter != nil {
+		if writeErr := e.statusWriter.Close(); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
 	if err != nil {
 		ctx.Error(err, "run steps")
 		StepStatusCache.Store(cacheKey, len(status.Steps))
 		return v1alpha1.WorkflowStateExecuting, err
 	}
+	if dagMode {
+		e.failFast()
+	}
+	if err := e.pruneOutputs(ctx); err != nil {
+		ctx.Error(err, "prune outputs")
+	}
+	if types.PruneFinishedStepStatus {
+		err := e.archiveStepStatus(ctx)
+		if err != nil {
+			ctx.Error(err, "archive step status")
+		}
+		// the status is kept in full if it's not archived, otherwise it's lost once pruned
+		if e.archiveHook != nil {
+			e.archiveHook(err)
+		}
+	}
 
 	StepStatusCache.Store(cacheKey, len(status.Steps))
-	if feature.DefaultMutableFeatureGate.Enabled(features.EnablePatchStatusAtOnce) {
-		return e.status.Phase, nil
+	phase := e.status.Phase
+	if !feature.DefaultMutableFeatureGate.Enabled(features.EnablePatchStatusAtOnce) {
+		phase = e.checkWorkflowPhase()
+	}
+	switch phase {
+	case v1alpha1.WorkflowStateSucceeded, v1alpha1.WorkflowStateFailed, v1alpha1.WorkflowStateTerminated:
+		e.audit(ctx, types.AuditEntry{Action: types.AuditActionFinishRun, Outcome: string(phase), Message: status.Message})
+	default:
+	}
+	return phase, nil
+}
+
+// countSteps returns the number of steps including sub steps in the workflow,
+// the sub steps that are generated dynamically are counted from the status.
+func countSteps(instance *types.WorkflowInstance) int {
+	specCount, statusCount := 0, 0
+	for _, step := range instance.Steps {
+		specCount += 1 + len(step.SubSteps)
+	}
+	for _, step := range instance.Status.Steps {
+		statusCount += 1 + len(step.SubStepsStatus)
+	}
+	if statusCount > specCount {
+		return statusCount
 	}
-	return e.checkWorkflowPhase(), nil
+	return specCount
 }
 
 func isTerminatedManually(status *v1alpha1.WorkflowRunStatus) bool {
@@ -164,6 +315,32 @@ func isTerminatedManually(status *v1alpha1.WorkflowRunStatus) bool {
 	return manually
 }
 
+// isExitedCleanly checks if the workflow is terminated by a step that exits it as succeeded, e.g. there's nothing to
+// deploy, and none of the steps is failed
+func isExitedCleanly(status *v1alpha1.WorkflowRunStatus) bool {
+	exited := false
+	check := func(step v1alpha1.StepStatus) bool {
+		if step.Phase == v1alpha1.WorkflowStepPhaseFailed {
+			return false
+		}
+		if step.Phase == v1alpha1.WorkflowStepPhaseSucceeded && step.Reason == types.StatusReasonExit {
+			exited = true
+		}
+		return true
+	}
+	for _, step := range status.Steps {
+		if !check(step.StepStatus) {
+			return false
+		}
+		for _, sub := range step.SubStepsStatus {
+			if !check(sub) {
+				return false
+			}
+		}
+	}
+	return exited
+}
+
 func checkWorkflowTerminated(status *v1alpha1.WorkflowRunStatus, allTasksDone bool) bool {
 	// if all tasks are done, and the terminated is true, then the workflow is terminated
 	return status.Terminated && allTasksDone
@@ -186,28 +363,59 @@ func checkWorkflowSuspended(status *v1alpha1.WorkflowRunStatus) bool {
 	return status.Suspend
 }
 
+// CancelRun cancels the in-flight calls of the providers in the steps that the workflow run is executing, e.g. when
+// the run is terminated or deleted. The cancelled steps are failed by the canceled context and the run is handled in
+// its next execution. It returns false if the run is not executing its steps.
+func CancelRun(namespace, name string) bool {
+	cancel, ok := runCancels.Load(fmt.Sprintf("%s-%s", name, namespace))
+	if ok {
+		cancel.(context.CancelFunc)()
+	}
+	return ok
+}
+
 func newEngine(ctx monitorContext.Context, wfCtx wfContext.Context, w *workflowExecutor, wfStatus *v1alpha1.WorkflowRunStatus, taskRunners []types.TaskRunner) *engine { //nolint:revive,unused
 	stepStatus := make(map[string]v1alpha1.StepStatus)
 	setStepStatus(stepStatus, wfStatus.Steps)
 	stepDependsOn := make(map[string][]string)
+	stepDependsOnCondition := make(map[string]*v1alpha1.DependsOnCondition)
+	stepPeriodic := make(map[string]time.Duration)
 	for _, step := range w.instance.Steps {
+		if step.Periodic != nil {
+			if interval, err := time.ParseDuration(step.Periodic.Interval); err == nil && interval > 0 {
+				stepPeriodic[step.Name] = interval
+			}
+		}
 		hooks.SetAdditionalNameInStatus(stepStatus, step.Name, step.Properties, stepStatus[step.Name])
 		stepDependsOn[step.Name] = append(stepDependsOn[step.Name], step.DependsOn...)
+		if step.DependsOnCondition != nil {
+			stepDependsOnCondition[step.Name] = step.DependsOnCondition
+		}
 		for _, sub := range step.SubSteps {
 			hooks.SetAdditionalNameInStatus(stepStatus, step.Name, step.Properties, stepStatus[step.Name])
 			stepDependsOn[sub.Name] = append(stepDependsOn[sub.Name], sub.DependsOn...)
+			if sub.DependsOnCondition != nil {
+				stepDependsOnCondition[sub.Name] = sub.DependsOnCondition
+			}
 		}
 	}
 	return &engine{
-		status:        wfStatus,
-		instance:      w.instance,
-		wfCtx:         wfCtx,
-		debug:         w.instance.Debug,
-		stepStatus:    stepStatus,
-		stepDependsOn: stepDependsOn,
-		stepTimeout:   make(map[string]time.Time),
-		taskRunners:   taskRunners,
-		statusPatcher: w.patcher,
+		status:                 wfStatus,
+		instance:               w.instance,
+		wfCtx:                  wfCtx,
+		debug:                  w.instance.Debug,
+		stepStatus:             stepStatus,
+		stepDependsOn:          stepDependsOn,
+		stepDependsOnCondition: stepDependsOnCondition,
+		stepPeriodic:           stepPeriodic,
+		stepTimeout:            make(map[string]time.Time),
+		taskRunners:            taskRunners,
+		statusPatcher:          w.patcher,
+		auditSink:              w.auditSink,
+		archiveHook:            w.archiveHook,
+		clock:                  w.clock,
+		paused:                 w.paused,
+		recordExecutionOrder:   w.instance.Annotations[types.AnnotationRecordExecutionOrder] == "true",
 	}
 }
 
@@ -228,8 +436,9 @@ func (w *workflowExecutor) GetSuspendBackoffWaitTime() time.Duration {
 	setStepStatus(stepStatus, w.instance.Status.Steps)
 	max := time.Duration(1<<63 - 1)
 	min := max
+	now := w.clock.Now()
 	for _, step := range w.instance.Steps {
-		min = handleSuspendBackoffTime(w.wfCtx, step, stepStatus[step.Name], min)
+		min = handleSuspendBackoffTime(w.wfCtx, step, stepStatus[step.Name], min, now)
 		for _, sub := range step.SubSteps {
 			min = handleSuspendBackoffTime(w.wfCtx, v1alpha1.WorkflowStep{
 				WorkflowStepBase: v1alpha1.WorkflowStepBase{
@@ -238,7 +447,7 @@ func (w *workflowExecutor) GetSuspendBackoffWaitTime() time.Duration {
 					Timeout:    sub.Timeout,
 					Properties: sub.Properties,
 				},
-			}, stepStatus[sub.Name], min)
+			}, stepStatus[sub.Name], min, now)
 		}
 	}
 	if min == max {
@@ -247,7 +456,7 @@ func (w *workflowExecutor) GetSuspendBackoffWaitTime() time.Duration {
 	return min
 }
 
-func handleSuspendBackoffTime(wfCtx wfContext.Context, step v1alpha1.WorkflowStep, status v1alpha1.StepStatus, min time.Duration) time.Duration {
+func handleSuspendBackoffTime(wfCtx wfContext.Context, step v1alpha1.WorkflowStep, status v1alpha1.StepStatus, min time.Duration, now time.Time) time.Duration {
 	if status.Phase != v1alpha1.WorkflowStepPhaseSuspending {
 		return min
 	}
@@ -257,8 +466,8 @@ func handleSuspendBackoffTime(wfCtx wfContext.Context, step v1alpha1.WorkflowSte
 			return min
 		}
 		timeout := status.FirstExecuteTime.Add(duration)
-		if time.Now().Before(timeout) {
-			d := time.Until(timeout)
+		if now.Before(timeout) {
+			d := timeout.Sub(now)
 			if duration < min {
 				min = d
 			}
@@ -270,7 +479,7 @@ func handleSuspendBackoffTime(wfCtx wfContext.Context, step v1alpha1.WorkflowSte
 		if err != nil {
 			return min
 		}
-		d := time.Until(t)
+		d := t.Sub(now)
 		if d < min {
 			min = d
 		}
@@ -291,8 +500,8 @@ func (w *workflowExecutor) GetBackoffWaitTime() time.Duration {
 		return time.Second
 	}
 	next := time.Unix(unix, 0)
-	if next.After(time.Now()) {
-		return time.Until(next)
+	if now := w.clock.Now(); next.After(now) {
+		return next.Sub(now)
 	}
 
 	return time.Second
@@ -337,6 +546,57 @@ func (w *workflowExecutor) makeContext(ctx context.Context, name string) (wfCont
 	return wfCtx, nil
 }
 
+// initializeContext resolves the shared inputs and runs the init hooks once before any step runs, the run is
+// blocked until the hooks succeed while it fails if the shared inputs can't be resolved
+func (w *workflowExecutor) initializeContext(ctx monitorContext.Context, wfCtx wfContext.Context) error {
+	if wfCtx.GetMutableValue(types.ContextKeyInitialized) != "" || len(w.instance.Status.Steps) > 0 {
+		return nil
+	}
+	if err := hooks.SharedInputs(ctx.GetContext(), singleton.KubeClient.Get(), wfCtx, w.instance); err != nil {
+		return err
+	}
+	for _, hook := range append([]types.WorkflowInitHook{hooks.InitVars}, w.initHooks...) {
+		if err := hook(wfCtx, w.instance); err != nil {
+			return err
+		}
+	}
+	wfCtx.SetMutableValue("true", types.ContextKeyInitialized)
+	return wfCtx.Commit(ctx)
+}
+
+// checkPermissions checks the permissions of the controller to access the resources rendered by the steps once
+// before the steps run, the result is reported as the PermissionsChecked condition of the run. The allowed permissions
+// are cached for the run, so that the providers don't review them again when the resources are accessed.
+func (w *workflowExecutor) checkPermissions(ctx monitorContext.Context, wfCtx wfContext.Context, taskRunners []types.TaskRunner) ([]string, error) {
+	status := &w.instance.Status
+	if c := status.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunPermissionsConditionType)); c.Status != corev1.ConditionUnknown {
+		return nil, nil
+	}
+	var templates []cue.Value
+	for _, runner := range taskRunners {
+		if renderer, ok := runner.(types.TaskTemplateRenderer); ok {
+			templates = append(templates, renderer.RenderTemplates(ctx, wfCtx)...)
+		}
+	}
+	missing, err := kube.CheckTemplatePermissions(ctx.GetContext(), singleton.KubeClient.Get(), wfCtx, templates...)
+	if err != nil {
+		return nil, err
+	}
+	c := condition.Condition{
+		Type:               condition.ConditionType(v1alpha1.WorkflowRunPermissionsConditionType),
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(w.clock.Now()),
+		Reason:             v1alpha1.ReasonPermissionsAllowed,
+	}
+	if len(missing) > 0 {
+		c.Status = corev1.ConditionFalse
+		c.Reason = v1alpha1.ReasonPermissionsMissing
+		c.Message = fmt.Sprintf("missing permissions: %s", strings.Join(missing, ", "))
+	}
+	status.SetConditions(c)
+	return missing, nil
+}
+
 func (e *engine) getBackoffTimes(stepID string) int {
 	if v, ok := e.wfCtx.GetValueInMemory(types.ContextPrefixBackoffTimes, stepID); ok {
 		times, ok := v.(int)
@@ -397,7 +657,7 @@ func (e *engine) getMaxBackoffWaitTime() int {
 func (e *engine) getNextTimeout() int64 {
 	max := time.Duration(1<<63 - 1)
 	min := time.Duration(1<<63 - 1)
-	now := time.Now()
+	now := e.clock.Now()
 	for _, step := range e.status.Steps {
 		if step.Phase == v1alpha1.WorkflowStepPhaseRunning {
 			if timeout, ok := e.stepTimeout[step.Name]; ok {
@@ -407,6 +667,58 @@ func (e *engine) getNextTimeout() int64 {
 				}
 			}
 		}
+		for _, sub := range step.SubStepsStatus {
+			if sub.Phase == v1alpha1.WorkflowStepPhaseRunning {
+				if timeout, ok := e.stepTimeout[sub.Name]; ok {
+					duration := timeout.Sub(now)
+					if duration < min {
+						min = duration
+					}
+				}
+			}
+		}
+	}
+	if min == max {
+		return -1
+	}
+	if min.Seconds() < 1 {
+		return minWorkflowBackoffWaitTime
+	}
+	return int64(math.Ceil(min.Seconds()))
+}
+
+// getSubStepsElapsedTime returns the total execution time of the sub steps in the group and the number of unfinished ones
+func (e *engine) getSubStepsElapsedTime(step v1alpha1.WorkflowStep, now time.Time) (time.Duration, int) {
+	var elapsed time.Duration
+	running := 0
+	for _, sub := range step.SubSteps {
+		status, ok := e.stepStatus[sub.Name]
+		if !ok || status.FirstExecuteTime.IsZero() {
+			continue
+		}
+		if types.IsStepFinish(status.Phase, status.Reason) {
+			elapsed += status.LastExecuteTime.Sub(status.FirstExecuteTime.Time)
+			continue
+		}
+		elapsed += now.Sub(status.FirstExecuteTime.Time)
+		running++
+	}
+	return elapsed, running
+}
+
+func (e *engine) getNextPeriodic() int64 {
+	max := time.Duration(1<<63 - 1)
+	min := time.Duration(1<<63 - 1)
+	now := e.clock.Now()
+	for name, interval := range e.stepPeriodic {
+		status, ok := e.stepStatus[name]
+		if !ok || !types.IsStepFinish(status.Phase, status.Reason) {
+			continue
+		}
+		duration := status.LastExecuteTime.Add(interval).Sub(now)
+		if duration < min {
+			min = duration
+		}
 	}
 	if min == max {
 		return -1
@@ -417,6 +729,16 @@ func (e *engine) getNextTimeout() int64 {
 	return int64(math.Ceil(min.Seconds()))
 }
 
+// isPeriodicDue checks if the finished periodic step should be executed again
+func (e *engine) isPeriodicDue(name string) bool {
+	interval, ok := e.stepPeriodic[name]
+	if !ok || e.status.Terminated {
+		return false
+	}
+	status := e.stepStatus[name]
+	return !status.LastExecuteTime.IsZero() && !e.clock.Now().Before(status.LastExecuteTime.Add(interval))
+}
+
 func (e *engine) setNextExecuteTime(ctx monitorContext.Context) {
 	backoff := e.getBackoffWaitTime()
 	lastExecuteTime, ok := e.wfCtx.GetValueInMemory(types.ContextKeyLastExecuteTime)
@@ -432,6 +754,9 @@ func (e *engine) setNextExecuteTime(ctx monitorContext.Context) {
 	if timeout := e.getNextTimeout(); timeout > 0 && timeout < interval {
 		interval = timeout
 	}
+	if periodic := e.getNextPeriodic(); periodic > 0 && periodic < interval {
+		interval = periodic
+	}
 
 	next := last + interval
 	e.wfCtx.SetValueInMemory(next, types.ContextKeyNextExecuteTime)
@@ -449,10 +774,13 @@ func (e *engine) runAsDAG(ctx monitorContext.Context, taskRunners []types.TaskRu
 		var stepID string
 		if status, ok := e.stepStatus[tRunner.Name()]; ok {
 			stepID = status.ID
-			finish = types.IsStepFinish(status.Phase, status.Reason)
+			finish = types.IsStepFinish(status.Phase, status.Reason) && !e.isPeriodicDue(tRunner.Name())
 		}
 		if !finish {
 			done = false
+			if err := e.setWorkflowStatusVar(tRunner.Name()); err != nil {
+				return err
+			}
 			if pending, status := tRunner.Pending(ctx, wfCtx, e.stepStatus); pending {
 				if pendingRunners {
 					wfCtx.IncreaseCountValueInMemory(types.ContextPrefixBackoffTimes, status.ID)
@@ -502,25 +830,98 @@ func (e *engine) Run(ctx monitorContext.Context, taskRunners []types.TaskRunner,
 
 	e.checkFailedAfterRetries()
 	e.setNextExecuteTime(ctx)
+	if syncErr := e.syncCustomStatus(); syncErr != nil {
+		ctx.Error(syncErr, "sync custom status", "workflow run", e.instance.Name)
+	}
 	return err
 }
 
+// syncCustomStatus sets the custom status written by the steps into the workflow run status
+func (e *engine) syncCustomStatus() error {
+	s := e.wfCtx.GetMutableValue(types.ContextKeyCustomStatus)
+	if s == "" {
+		return nil
+	}
+	custom := make(map[string]apiextensionsv1.JSON)
+	if err := json.Unmarshal([]byte(s), &custom); err != nil {
+		return errors.WithMessage(err, "parse custom status")
+	}
+	e.status.Custom = custom
+	return nil
+}
+
 func (e *engine) checkWorkflowStatusMessage() {
+	e.status.Failures = aggregateFailures(e.status.Steps)
 	switch {
 	case !e.waiting && e.failedAfterRetries && feature.DefaultMutableFeatureGate.Enabled(features.EnableSuspendOnFailure):
 		e.status.Message = types.MessageSuspendFailedAfterRetries
+	case e.status.Terminated && len(e.status.Failures) > 0:
+		names := make([]string, 0, len(e.status.Failures))
+		for _, failure := range e.status.Failures {
+			names = append(names, failure.Name)
+		}
+		e.status.Message = fmt.Sprintf(types.MessageFailedSteps, len(names), strings.Join(names, ", "))
+	case e.status.Terminated && e.exitedMainStep() != "":
+		name := e.exitedMainStep()
+		e.status.Message = fmt.Sprintf(types.MessageExitedStep, name)
+		if message := e.stepStatus[name].Message; message != "" {
+			e.status.Message += ": " + message
+		}
 	default:
 		e.status.Message = ""
 	}
 }
 
+// aggregateFailures collects the failures of all the failed steps, the failed sub steps take the place of their group
+func aggregateFailures(steps []v1alpha1.WorkflowStepStatus) []v1alpha1.StepFailure {
+	var failures []v1alpha1.StepFailure
+	for _, step := range steps {
+		subFailed := false
+		for _, sub := range step.SubStepsStatus {
+			if sub.Phase == v1alpha1.WorkflowStepPhaseFailed {
+				failures = append(failures, newStepFailure(sub))
+				subFailed = true
+			}
+		}
+		if !subFailed && step.Phase == v1alpha1.WorkflowStepPhaseFailed {
+			failures = append(failures, newStepFailure(step.StepStatus))
+		}
+	}
+	return failures
+}
+
+func newStepFailure(status v1alpha1.StepStatus) v1alpha1.StepFailure {
+	return v1alpha1.StepFailure{
+		ID:      status.ID,
+		Name:    status.Name,
+		Reason:  status.Reason,
+		Message: status.Message,
+	}
+}
+
 func (e *engine) steps(ctx monitorContext.Context, taskRunners []types.TaskRunner, dag bool) error {
 	wfCtx := e.wfCtx
+	// wave is the index of the wave of the steps started in this pass in the execution order, the steps that depend
+	// on the steps in the wave start a new one
+	wave := -1
 	for index, runner := range taskRunners {
 		if status, ok := e.stepStatus[runner.Name()]; ok {
 			if types.IsStepFinish(status.Phase, status.Reason) {
+				if !e.isPeriodicDue(runner.Name()) {
+					continue
+				}
+				// reset the failed times so that the periodic step can be retried in this execution
+				wfCtx.DeleteValueInMemory(types.ContextPrefixFailedTimes, status.ID)
+			}
+		}
+		if e.isHeld(runner.Name()) {
+			if dag {
 				continue
 			}
+			return nil
+		}
+		if err := e.setWorkflowStatusVar(runner.Name()); err != nil {
+			return err
 		}
 		if pending, status := runner.Pending(ctx, wfCtx, e.stepStatus); pending {
 			wfCtx.IncreaseCountValueInMemory(types.ContextPrefixBackoffTimes, status.ID)
@@ -534,10 +935,41 @@ func (e *engine) steps(ctx monitorContext.Context, taskRunners []types.TaskRunne
 		}
 		options := e.generateRunOptions(ctx, e.findDependPhase(taskRunners, index, dag))
 
+		// the wave is added before the step runs, so that it's ahead of the waves of the sub steps of a step group
+		started := e.recordExecutionOrder && e.isStarting(runner.Name())
+		if started && (wave < 0 || !dag || e.dependsOnWave(runner.Name(), e.status.ExecutionOrder[wave])) {
+			e.status.ExecutionOrder = append(e.status.ExecutionOrder, v1alpha1.ExecutionWave{
+				StartTime: metav1.NewTime(e.clock.Now()),
+				Parent:    e.parentRunner,
+			})
+			wave = len(e.status.ExecutionOrder) - 1
+		}
+		// the step is started before it runs, the first execute time of a new step is the start of its execution
+		start := metav1.NewTime(e.clock.Now())
+		prev := e.stepStatus[runner.Name()]
 		status, operation, err := runner.Run(wfCtx, options)
 		if err != nil {
 			return err
 		}
+		status.FirstExecuteTime = start
+		if started {
+			e.status.ExecutionOrder[wave].Steps = append(e.status.ExecutionOrder[wave].Steps, v1alpha1.ExecutionWaveStep{ID: status.ID, Name: runner.Name()})
+		}
+		if status.Phase == v1alpha1.WorkflowStepPhaseSucceeded {
+			e.detectChanges(ctx, &status)
+		}
+		if _, ok := e.stepPeriodic[runner.Name()]; ok && operation != nil {
+			// the failure of a periodic step won't fail the workflow run, it will be executed again in the next interval
+			operation.Terminated = false
+			operation.FailedAfterRetries = false
+		} else {
+			e.checkRetryBudget(&status, operation, prev.Phase == v1alpha1.WorkflowStepPhaseFailed)
+			if operation != nil && status.Phase == v1alpha1.WorkflowStepPhaseFailed && e.toleratesFailures() {
+				// the failed sub step is counted against the tolerance of its group, which fails the run on exceeding it
+				operation.Terminated = false
+				operation.FailedAfterRetries = false
+			}
+		}
 		e.finishStep(operation)
 
 		// for the suspend step with duration, there's no need to increase the backoff time in reconcile when it's still running
@@ -546,7 +978,9 @@ func (e *engine) steps(ctx monitorContext.Context, taskRunners []types.TaskRunne
 				return err
 			}
 			if err := handleBackoffTimes(ctx, wfCtx, status, false); err != nil {
-				return err
+				if err := e.handleContextBackendError(ctx, status, err); err != nil {
+					return err
+				}
 			}
 			if dag {
 				continue
@@ -555,22 +989,81 @@ func (e *engine) steps(ctx monitorContext.Context, taskRunners []types.TaskRunne
 		}
 		// clear the backoff time when the step is finished
 		if err := handleBackoffTimes(ctx, wfCtx, status, true); err != nil {
-			return err
+			// the outputs of the step are not persisted, keep the step running to execute it again
+			if err := e.handleContextBackendError(ctx, status, err); err != nil {
+				return err
+			}
+			if dag {
+				continue
+			}
+			return nil
 		}
+		e.recoverContextBackend(status)
+		prev, executed := e.stepStatus[status.Name]
 		if err := e.updateStepStatus(ctx, status); err != nil {
 			return err
 		}
+		// the step is audited once per transition, e.g. the suspending step is not audited on every reconcile
+		if !executed || prev.Phase != status.Phase || prev.Reason != status.Reason {
+			e.auditStep(ctx, status)
+		}
 
 		if dag {
 			continue
 		}
-		if e.needStop() {
+		// in StepByStep mode, the next step begins only after this step is finished, e.g. the suspending step and
+		// the step group with the sub steps still running block the next step even if the run is not suspended
+		if e.needStop() || !types.IsStepFinish(status.Phase, status.Reason) {
 			return nil
 		}
 	}
 	return nil
 }
 
+// isStarting checks if the step is going to start an execution, i.e. it's not started yet or it's a due periodic step
+func (e *engine) isStarting(name string) bool {
+	status, ok := e.stepStatus[name]
+	return !ok || status.Phase == "" || status.Phase == v1alpha1.WorkflowStepPhasePending || types.IsStepFinish(status.Phase, status.Reason)
+}
+
+// dependsOnWave checks if the step depends on any step in the wave, the step starts a new wave if so
+func (e *engine) dependsOnWave(name string, wave v1alpha1.ExecutionWave) bool {
+	for _, step := range wave.Steps {
+		if slices.Contains(e.stepDependsOn[name], step.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimExecutionOrder drops the waves without any started steps, e.g. the step fails to run, and the oldest waves
+// beyond MaxExecutionWaves
+func (e *engine) trimExecutionOrder() {
+	waves := e.status.ExecutionOrder[:0]
+	for _, wave := range e.status.ExecutionOrder {
+		if len(wave.Steps) > 0 {
+			waves = append(waves, wave)
+		}
+	}
+	if types.MaxExecutionWaves > 0 && len(waves) > types.MaxExecutionWaves {
+		waves = waves[len(waves)-types.MaxExecutionWaves:]
+	}
+	if len(waves) == 0 {
+		waves = nil
+	}
+	e.status.ExecutionOrder = waves
+}
+
+// isHeld checks if the step is held by the paused controller, the steps that are not started or are finished are
+// held, while the in-flight steps are allowed to finish
+func (e *engine) isHeld(name string) bool {
+	if !e.paused {
+		return false
+	}
+	status, ok := e.stepStatus[name]
+	return !ok || status.Phase == "" || status.Phase == v1alpha1.WorkflowStepPhasePending || types.IsStepFinish(status.Phase, status.Reason)
+}
+
 func (e *engine) generateRunOptions(ctx monitorContext.Context, dependsOnPhase v1alpha1.WorkflowStepPhase) *types.TaskRunOptions {
 	options := &types.TaskRunOptions{
 		GetTracer: func(id string, stepStatus v1alpha1.WorkflowStep) monitorContext.Context {
@@ -582,6 +1075,13 @@ func (e *engine) generateRunOptions(ctx monitorContext.Context, dependsOnPhase v
 		Engine:     e,
 		PreCheckHooks: []types.TaskPreCheckHook{
 			func(step v1alpha1.WorkflowStep, options *types.PreCheckOptions) (*types.PreCheckResult, error) {
+				kind, finalizer := e.instance.Finalizers[step.Name]
+				finalizer = finalizer && e.parentRunner == ""
+				// the finalizer steps are gated by the outcome of the main steps even if the run suspends on failure,
+				// and their `if` is evaluated as well once they should run
+				if finalizer && !shouldRunFinalizer(kind, e.mainStepsPhase()) {
+					return &types.PreCheckResult{Skip: true}, nil
+				}
 				if feature.DefaultMutableFeatureGate.Enabled(features.EnableSuspendOnFailure) {
 					return &types.PreCheckResult{Skip: false}, nil
 				}
@@ -589,12 +1089,17 @@ func (e *engine) generateRunOptions(ctx monitorContext.Context, dependsOnPhase v
 					if status, ok := e.stepStatus[e.parentRunner]; ok && status.Phase == v1alpha1.WorkflowStepPhaseSkipped {
 						return &types.PreCheckResult{Skip: true}, nil
 					}
+				} else if !finalizer && step.If != "always" && (e.failingFast() || e.exitedEarly(step.Name)) {
+					return &types.PreCheckResult{Skip: true}, nil
 				}
 				switch step.If {
 				case "always":
 					return &types.PreCheckResult{Skip: false}, nil
 				case "":
-					return &types.PreCheckResult{Skip: skipExecutionOfNextStep(dependsOnPhase, len(step.DependsOn) > 0)}, nil
+					if finalizer {
+						return &types.PreCheckResult{Skip: false}, nil
+					}
+					return &types.PreCheckResult{Skip: skipExecutionOfNextStep(dependsOnPhase, len(step.DependsOn) > 0 || step.DependsOnCondition != nil)}, nil
 				default:
 					basicVal := cue.Value{}
 					if options != nil {
@@ -614,6 +1119,8 @@ func (e *engine) generateRunOptions(ctx monitorContext.Context, dependsOnPhase v
 						return &types.PreCheckResult{Timeout: true}, nil
 					}
 				}
+				// the execution of the step is cancelled once the step times out
+				var timeLeft time.Duration
 				if !status.FirstExecuteTime.Time.IsZero() && step.Timeout != "" {
 					duration, err := time.ParseDuration(step.Timeout)
 					if err != nil {
@@ -622,16 +1129,42 @@ func (e *engine) generateRunOptions(ctx monitorContext.Context, dependsOnPhase v
 					}
 					timeout := status.FirstExecuteTime.Add(duration)
 					e.stepTimeout[step.Name] = timeout
-					if time.Now().After(timeout) {
+					now := e.clock.Now()
+					if now.After(timeout) {
 						return &types.PreCheckResult{Timeout: true}, nil
 					}
+					timeLeft = timeout.Sub(now)
+				} else if duration, err := time.ParseDuration(step.Timeout); err == nil {
+					// the step is executed for the first time
+					timeLeft = duration
 				}
-				return &types.PreCheckResult{Timeout: false}, nil
+				if step.Type == types.WorkflowStepTypeStepGroup && step.SubStepsTimeout != "" {
+					duration, err := time.ParseDuration(step.SubStepsTimeout)
+					if err != nil {
+						return &types.PreCheckResult{Timeout: false}, err
+					}
+					now := e.clock.Now()
+					elapsed, running := e.getSubStepsElapsedTime(step, now)
+					if elapsed > duration {
+						return &types.PreCheckResult{Timeout: true}, nil
+					}
+					if running > 0 {
+						// the running sub steps consume the timeout together
+						timeout := now.Add((duration - elapsed) / time.Duration(running))
+						if t, ok := e.stepTimeout[step.Name]; !ok || timeout.Before(t) {
+							e.stepTimeout[step.Name] = timeout
+						}
+					}
+				}
+				return &types.PreCheckResult{Timeout: false, TimeLeft: timeLeft}, nil
 			},
 		},
 		PreStartHooks: []types.TaskPreStartHook{hooks.Input},
 		PostStopHooks: []types.TaskPostStopHook{hooks.Output},
 	}
+	if e.parentRunner != "" {
+		options.PostStopHooks = []types.TaskPostStopHook{hooks.SubStepOutput}
+	}
 	if e.debug {
 		options.Debug = func(id string, v cue.Value) error {
 			debugContext := debug.NewContext(e.instance, id)
@@ -642,19 +1175,30 @@ func (e *engine) generateRunOptions(ctx monitorContext.Context, dependsOnPhase v
 }
 
 type engine struct {
-	failedAfterRetries bool
-	waiting            bool
-	suspending         bool
-	debug              bool
-	status             *v1alpha1.WorkflowRunStatus
-	wfCtx              wfContext.Context
-	instance           *types.WorkflowInstance
-	parentRunner       string
-	stepStatus         map[string]v1alpha1.StepStatus
-	stepTimeout        map[string]time.Time
-	stepDependsOn      map[string][]string
-	taskRunners        []types.TaskRunner
-	statusPatcher      types.StatusPatcher
+	failedAfterRetries     bool
+	waiting                bool
+	suspending             bool
+	debug                  bool
+	status                 *v1alpha1.WorkflowRunStatus
+	wfCtx                  wfContext.Context
+	instance               *types.WorkflowInstance
+	parentRunner           string
+	stepStatus             map[string]v1alpha1.StepStatus
+	stepTimeout            map[string]time.Time
+	stepDependsOn          map[string][]string
+	stepDependsOnCondition map[string]*v1alpha1.DependsOnCondition
+	stepPeriodic           map[string]time.Duration
+	taskRunners            []types.TaskRunner
+	statusPatcher          types.StatusPatcher
+	statusWriter           *statusWriter
+	auditSink              types.AuditSink
+	archiveHook            func(err error)
+	clock                  types.Clock
+	paused                 bool
+	recordExecutionOrder   bool
+	// latestSucceededRun is the previous run to detect the changes of the outputs, it's loaded once in the reconcile
+	latestSucceededRun *v1alpha1.WorkflowRun
+	previousRunLoaded  bool
 }
 
 func (e *engine) finishStep(operation *types.Operation) {
@@ -673,10 +1217,156 @@ func (e *engine) finishStep(operation *types.Operation) {
 	}
 }
 
+// checkRetryBudget counts the retry of the failed step in the budget of the run, the step is failed after retries
+// once the cumulative retries of the run exceed the budget, so that a flaky dependency can't retry the steps endlessly.
+// Only the re-executions of the step that has failed before are retries, the first failure of the step is not counted.
+func (e *engine) checkRetryBudget(status *v1alpha1.StepStatus, operation *types.Operation, retried bool) {
+	// the failure of the step group is aggregated from its sub steps, which are counted instead
+	if !retried || operation == nil || status.Phase != v1alpha1.WorkflowStepPhaseFailed || operation.Terminated || operation.FailedAfterRetries ||
+		status.Type == types.WorkflowStepTypeStepGroup {
+		return
+	}
+	e.status.Retries++
+	if e.instance.MaxRetries <= 0 || e.status.Retries <= e.instance.MaxRetries {
+		return
+	}
+	operation.Waiting = false
+	operation.FailedAfterRetries = true
+	status.Reason = types.StatusReasonFailedAfterRetries
+	message := fmt.Sprintf(types.MessageExceedRetryBudget, e.instance.MaxRetries)
+	if status.Message != "" {
+		message += ": " + status.Message
+	}
+	status.Message = message
+}
+
+// stepMeta returns the meta of the step or the sub step by its name
+func (e *engine) stepMeta(name string) *v1alpha1.WorkflowStepMeta {
+	if step := e.findStep(name); step != nil {
+		return step.Meta
+	}
+	return nil
+}
+
+func (e *engine) findStep(name string) *v1alpha1.WorkflowStepBase {
+	for i, step := range e.instance.Steps {
+		if step.Name == name {
+			return &e.instance.Steps[i].WorkflowStepBase
+		}
+		for j, sub := range step.SubSteps {
+			if sub.Name == name {
+				return &e.instance.Steps[i].SubSteps[j]
+			}
+		}
+	}
+	return nil
+}
+
+// detectChanges compares the outputs of the succeeded step with the fingerprints of the outputs of the same step in
+// the last finished succeeded run of the same workflow, and sets the result in the metadata of the step. The
+// fingerprints of the outputs are kept in the status of the step for the later runs. The outputs are changed if the
+// previous fingerprints can't be read.
+func (e *engine) detectChanges(ctx monitorContext.Context, status *v1alpha1.StepStatus) {
+	step := e.findStep(status.Name)
+	if step == nil || !step.DetectChanges || len(step.Outputs) == 0 {
+		return
+	}
+	names := make([]string, 0, len(step.Outputs))
+	sensitive := make(map[string]bool)
+	for _, output := range step.Outputs {
+		names = append(names, output.Name)
+		sensitive[output.Name] = output.Sensitive
+	}
+	current, err := utils.ContextOutputs(e.wfCtx, names)
+	if err != nil {
+		ctx.Error(err, "read the outputs to detect the changes", "step", status.Name)
+	} else {
+		status.OutputFingerprints = utils.FingerprintOutputs(current)
+	}
+	changed := err != nil
+	var previous map[string]string
+	found := false
+	run, err := e.previousRun(ctx)
+	if err != nil {
+		ctx.Error(err, "find the previous run to detect the changes", "step", status.Name)
+	} else if run != nil {
+		previous, found = utils.StepOutputFingerprints(run, status.Name)
+	}
+	changed = changed || !found
+	diff := strings.Join(utils.DiffOutputs(previous, current, sensitive), "\n")
+	if limit := types.MaxStepMetadataSize / 2; limit > 0 && len(diff) > limit {
+		diff = diff[:limit] + "..."
+	}
+	if status.Metadata == nil {
+		status.Metadata = make(map[string]string, 2)
+	}
+	status.Metadata[types.MetadataKeyChanged] = strconv.FormatBool(changed || diff != "")
+	status.Metadata[types.MetadataKeyDiff] = diff
+}
+
+// previousRun returns the last finished succeeded run of the workflow referred by the run, nil if the run has no
+// workflowRef or there's no such run. The run is found once in the reconcile and shared by the steps.
+func (e *engine) previousRun(ctx context.Context) (*v1alpha1.WorkflowRun, error) {
+	if e.instance.WorkflowRef == "" || e.previousRunLoaded {
+		return e.latestSucceededRun, nil
+	}
+	run, err := utils.LatestSucceededRun(ctx, singleton.KubeClient.Get(), e.instance.Namespace, e.instance.WorkflowRef, e.instance.Name)
+	if err != nil {
+		return nil, err
+	}
+	e.latestSucceededRun, e.previousRunLoaded = run, true
+	return run, nil
+}
+
+// toleratesFailures checks if the sub steps being executed belong to a fan-out group with the failure tolerance
+func (e *engine) toleratesFailures() bool {
+	if e.parentRunner == "" {
+		return false
+	}
+	for _, step := range e.instance.Steps {
+		if step.Name == e.parentRunner {
+			return step.Generator != nil && step.Generator.Tolerance != nil
+		}
+	}
+	return false
+}
+
+// audit records the entry of the action in the audit sink, the failure of the sink doesn't fail the execution
+func (e *engine) audit(ctx monitorContext.Context, entry types.AuditEntry) {
+	if e.auditSink == nil {
+		return
+	}
+	entry.Timestamp = e.clock.Now()
+	entry.Target.Namespace, entry.Target.Name, entry.Target.UID = e.instance.Namespace, e.instance.Name, e.instance.UID
+	if entry.Actor == "" {
+		entry.Actor = types.AuditActorController
+	}
+	if err := e.auditSink.Record(ctx, entry); err != nil {
+		ctx.Error(err, "record audit entry", "action", entry.Action, "step", entry.Target.Step)
+	}
+}
+
+// auditStep records the execution of the finished step, the actor is the service account of the step if it's set
+func (e *engine) auditStep(ctx monitorContext.Context, status v1alpha1.StepStatus) {
+	entry := types.AuditEntry{
+		Action:  types.AuditActionExecuteStep,
+		Target:  types.AuditTarget{Step: status.Name, StepType: status.Type},
+		Outcome: string(status.Phase),
+		Message: status.Message,
+	}
+	if status.Reason != "" {
+		entry.Outcome += "/" + status.Reason
+	}
+	if step := e.findStep(status.Name); step != nil && step.ServiceAccount != "" {
+		entry.Actor = serviceaccount.MakeUsername(e.instance.Namespace, step.ServiceAccount)
+	}
+	e.audit(ctx, entry)
+}
+
 func (e *engine) updateStepStatus(ctx context.Context, status v1alpha1.StepStatus) error {
 	var (
 		conditionUpdated bool
-		now              = metav1.NewTime(time.Now())
+		now              = metav1.NewTime(e.clock.Now())
 	)
 
 	parentRunner := e.parentRunner
@@ -686,6 +1376,16 @@ func (e *engine) updateStepStatus(ctx context.Context, status v1alpha1.StepStatu
 	}
 	e.wfCtx.SetValueInMemory(now.Unix(), types.ContextKeyLastExecuteTime)
 	status.LastExecuteTime = now
+	// the sub phase is only reported while the step is running
+	if status.Phase != v1alpha1.WorkflowStepPhaseRunning {
+		status.SubPhase = ""
+	}
+	if types.IsStepFinish(status.Phase, status.Reason) {
+		status.ContinuationToken = ""
+	}
+	if meta := e.stepMeta(status.Name); meta != nil {
+		status.Description, status.Docs = meta.Description, meta.Docs
+	}
 	index := -1
 	for i, ss := range e.status.Steps {
 		if ss.Name == stepName {
@@ -710,13 +1410,15 @@ func (e *engine) updateStepStatus(ctx context.Context, status v1alpha1.StepStatu
 		}
 	}
 	if !conditionUpdated {
-		status.FirstExecuteTime = now
+		if status.FirstExecuteTime.IsZero() {
+			status.FirstExecuteTime = now
+		}
 		if parentRunner != "" {
 			if index < 0 {
 				e.status.Steps = append(e.status.Steps, v1alpha1.WorkflowStepStatus{
 					StepStatus: v1alpha1.StepStatus{
 						Name:             parentRunner,
-						FirstExecuteTime: now,
+						FirstExecuteTime: status.FirstExecuteTime,
 					}})
 				index = len(e.status.Steps) - 1
 			}
@@ -728,17 +1430,37 @@ func (e *engine) updateStepStatus(ctx context.Context, status v1alpha1.StepStatu
 	e.stepStatus[status.Name] = status
 	if feature.DefaultMutableFeatureGate.Enabled(features.EnablePatchStatusAtOnce) {
 		isUpdate := false
-		orig := e.status.Message
+		orig, origFailures := e.status.Message, len(e.status.Failures)
 		e.status.Phase = e.checkWorkflowPhase()
-		if orig != "" && e.status.Message == "" {
+		if (orig != "" && e.status.Message == "") || (origFailures > 0 && len(e.status.Failures) == 0) {
 			// patch can not set empty string
 			isUpdate = true
 		}
+		if err := e.syncCustomStatus(); err != nil {
+			return err
+		}
+		if e.statusWriter != nil {
+			e.statusWriter.Write(e.status, isUpdate)
+			if isStatusTransitionTerminal(e.status) {
+				return e.statusWriter.Flush()
+			}
+			return nil
+		}
 		return e.statusPatcher(ctx, e.status, isUpdate)
 	}
 	return nil
 }
 
+// isStatusTransitionTerminal checks if the run stops executing with the status, the status is written at once then
+func isStatusTransitionTerminal(status *v1alpha1.WorkflowRunStatus) bool {
+	switch status.Phase {
+	case v1alpha1.WorkflowStateSucceeded, v1alpha1.WorkflowStateFailed, v1alpha1.WorkflowStateTerminated, v1alpha1.WorkflowStateSuspending:
+		return true
+	default:
+		return status.Terminated || status.Suspend
+	}
+}
+
 func (e *engine) checkWorkflowPhase() v1alpha1.WorkflowRunPhase {
 	status := e.status
 	e.checkWorkflowStatusMessage()
@@ -750,6 +1472,9 @@ func (e *engine) checkWorkflowPhase() v1alpha1.WorkflowRunPhase {
 			if isTerminatedManually(status) {
 				return v1alpha1.WorkflowStateTerminated
 			}
+			if isExitedCleanly(status) {
+				return v1alpha1.WorkflowStateSucceeded
+			}
 			return v1alpha1.WorkflowStateFailed
 		}
 	}
@@ -772,29 +1497,266 @@ func (e *engine) checkFailedAfterRetries() {
 	}
 }
 
+// failingFast checks if the unfinished steps should be canceled by the FailFast policy in DAG mode
+func (e *engine) failingFast() bool {
+	return e.failedMainStep() != "" && e.instance.FailurePolicy == v1alpha1.FailurePolicyFailFast &&
+		e.status.Mode.Steps == v1alpha1.WorkflowModeDAG
+}
+
+// failedMainStep returns the name of the main step that is failed and won't be retried, the manually terminated
+// steps are excluded
+func (e *engine) failedMainStep() string {
+	for _, step := range e.instance.Steps {
+		if _, ok := e.instance.Finalizers[step.Name]; ok {
+			continue
+		}
+		status := e.stepStatus[step.Name]
+		if status.Phase == v1alpha1.WorkflowStepPhaseFailed && status.Reason != types.StatusReasonTerminate &&
+			types.IsStepFinish(status.Phase, status.Reason) {
+			return step.Name
+		}
+	}
+	return ""
+}
+
+// exitedMainStep returns the name of the main step or the sub step of a main step group that exits the workflow
+// as succeeded
+func (e *engine) exitedMainStep() string {
+	exited := func(name string) bool {
+		status := e.stepStatus[name]
+		return status.Phase == v1alpha1.WorkflowStepPhaseSucceeded && status.Reason == types.StatusReasonExit
+	}
+	for _, step := range e.instance.Steps {
+		if _, ok := e.instance.Finalizers[step.Name]; ok {
+			continue
+		}
+		for _, sub := range step.SubSteps {
+			if exited(sub.Name) {
+				return sub.Name
+			}
+		}
+		if exited(step.Name) {
+			return step.Name
+		}
+	}
+	return ""
+}
+
+// exitedEarly checks if the step is skipped since the workflow is exited by a main step, the started steps are
+// allowed to finish
+func (e *engine) exitedEarly(name string) bool {
+	phase := e.stepStatus[name].Phase
+	return (phase == "" || phase == v1alpha1.WorkflowStepPhasePending) && e.exitedMainStep() != ""
+}
+
+// failFast cancels the unfinished main steps once a main step is failed with the FailFast policy, the steps with
+// `if: always` and the finalizer steps are not canceled. The failure suspends the run instead with the
+// EnableSuspendOnFailure feature, so nothing is canceled.
+func (e *engine) failFast() {
+	if feature.DefaultMutableFeatureGate.Enabled(features.EnableSuspendOnFailure) || !e.failingFast() {
+		return
+	}
+	message := fmt.Sprintf("Canceled since the step %s is failed", e.failedMainStep())
+	always := make(map[string]bool)
+	for _, step := range e.instance.Steps {
+		always[step.Name] = step.If == "always"
+	}
+	cancel := func(status *v1alpha1.StepStatus) {
+		if !types.IsStepFinish(status.Phase, status.Reason) {
+			status.Phase = v1alpha1.WorkflowStepPhaseFailed
+			status.SubPhase = ""
+			status.ContinuationToken = ""
+			status.Reason = types.StatusReasonTerminate
+			status.Message = message
+		}
+	}
+	canceled := false
+	for i := range e.status.Steps {
+		step := &e.status.Steps[i]
+		if _, ok := e.instance.Finalizers[step.Name]; ok || always[step.Name] || types.IsStepFinish(step.Phase, step.Reason) {
+			continue
+		}
+		for j := range step.SubStepsStatus {
+			cancel(&step.SubStepsStatus[j])
+		}
+		cancel(&step.StepStatus)
+		canceled = true
+	}
+	if canceled {
+		e.status.Suspend = false
+		e.status.Terminated = true
+		setStepStatus(e.stepStatus, e.status.Steps)
+	}
+}
+
+// pruneOutputs prunes the outputs with the Consumed retention from the workflow context once the steps that take
+// them as inputs are all succeeded or skipped. The step that is restarted later reads the pruned output from the
+// previous output of the step that generates it.
+func (e *engine) pruneOutputs(ctx context.Context) error {
+	var steps []v1alpha1.WorkflowStepBase
+	for _, step := range e.instance.Steps {
+		steps = append(steps, step.WorkflowStepBase)
+		steps = append(steps, step.SubSteps...)
+	}
+	consumers := make(map[string][]string)
+	for _, step := range steps {
+		for _, input := range step.Inputs {
+			name, _, _ := strings.Cut(input.From, ".")
+			consumers[name] = append(consumers[name], step.Name)
+		}
+	}
+	consumed := func(name string) bool {
+		for _, consumer := range consumers[name] {
+			status, ok := e.stepStatus[consumer]
+			if !ok || (status.Phase != v1alpha1.WorkflowStepPhaseSucceeded && status.Phase != v1alpha1.WorkflowStepPhaseSkipped) {
+				return false
+			}
+		}
+		return true
+	}
+	pruned := false
+	for _, step := range steps {
+		if e.stepStatus[step.Name].Phase != v1alpha1.WorkflowStepPhaseSucceeded {
+			continue
+		}
+		for _, output := range step.Outputs {
+			if output.Retention != v1alpha1.OutputRetentionConsumed || !consumed(output.Name) ||
+				e.wfCtx.GetMutableValue(types.ContextPrefixPrunedOutput, output.Name) != "" {
+				continue
+			}
+			if err := e.wfCtx.DeleteVar(output.Name); err != nil {
+				return errors.WithMessagef(err, "delete output %s", output.Name)
+			}
+			e.wfCtx.SetMutableValue(step.Name, types.ContextPrefixPrunedOutput, output.Name)
+			pruned = true
+		}
+	}
+	if !pruned {
+		return nil
+	}
+	return e.wfCtx.Commit(ctx)
+}
+
+// archiveStepStatus archives the full status of the finished steps in the workflow context, so that the status of
+// the run can be pruned while the full detail is restored on demand.
+func (e *engine) archiveStepStatus(ctx context.Context) error {
+	if err := utils.ArchiveStepStatus(e.wfCtx, e.status); err != nil {
+		return err
+	}
+	return e.wfCtx.Commit(ctx)
+}
+
+// mainStepsPhase returns the outcome of the main steps, the finalizer steps are excluded
+func (e *engine) mainStepsPhase() v1alpha1.WorkflowRunPhase {
+	phase := v1alpha1.WorkflowStateSucceeded
+	for _, step := range e.instance.Steps {
+		if _, ok := e.instance.Finalizers[step.Name]; ok {
+			continue
+		}
+		status := e.stepStatus[step.Name]
+		if status.Phase != v1alpha1.WorkflowStepPhaseFailed {
+			continue
+		}
+		if status.Reason != types.StatusReasonTerminate {
+			return v1alpha1.WorkflowStateFailed
+		}
+		phase = v1alpha1.WorkflowStateTerminated
+	}
+	return phase
+}
+
+// mainStepsFinished checks if all the main steps are finished, the finalizer steps are excluded
+func (e *engine) mainStepsFinished() bool {
+	for _, step := range e.instance.Steps {
+		if _, ok := e.instance.Finalizers[step.Name]; ok {
+			continue
+		}
+		status, ok := e.stepStatus[step.Name]
+		if !ok || !types.IsStepFinish(status.Phase, status.Reason) {
+			return false
+		}
+	}
+	return true
+}
+
+// setWorkflowStatusVar sets the outcome of the main steps into the workflow context before the finalizer step is
+// executed, so that the finalizer steps can reference it by inputs, e.g. `from: workflowStatus.phase`
+func (e *engine) setWorkflowStatusVar(name string) error {
+	if _, ok := e.instance.Finalizers[name]; !ok || e.parentRunner != "" || !e.mainStepsFinished() {
+		return nil
+	}
+	phase := e.mainStepsPhase()
+	if v, err := e.wfCtx.GetVar(types.ContextVarWorkflowStatus, "phase"); err == nil {
+		if current, err := v.String(); err == nil && current == string(phase) {
+			return nil
+		}
+	}
+	failedSteps := make([]string, 0)
+	for _, step := range e.instance.Steps {
+		if _, ok := e.instance.Finalizers[step.Name]; !ok && e.stepStatus[step.Name].Phase == v1alpha1.WorkflowStepPhaseFailed {
+			failedSteps = append(failedSteps, step.Name)
+		}
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"phase":       phase,
+		"message":     e.status.Message,
+		"failedSteps": failedSteps,
+	})
+	if err != nil {
+		return err
+	}
+	return e.wfCtx.ReplaceVar(cuecontext.New().CompileBytes(b), types.ContextVarWorkflowStatus)
+}
+
+// shouldRunFinalizer checks if the finalizer step should be executed by the outcome of the main steps
+func shouldRunFinalizer(kind types.FinalizerKind, phase v1alpha1.WorkflowRunPhase) bool {
+	switch kind {
+	case types.FinalizerOnSuccess:
+		return phase == v1alpha1.WorkflowStateSucceeded
+	case types.FinalizerOnFailure:
+		return phase != v1alpha1.WorkflowStateSucceeded
+	default:
+		return true
+	}
+}
+
 func (e *engine) needStop() bool {
 	// if the workflow is terminated, we still need to execute all the remaining steps
 	return e.status.Suspend
 }
 
 func (e *engine) findDependPhase(taskRunners []types.TaskRunner, index int, dag bool) v1alpha1.WorkflowStepPhase {
-	dependsOn := len(e.stepDependsOn[taskRunners[index].Name()]) > 0
+	dependsOn := len(e.stepDependsOn[taskRunners[index].Name()]) > 0 || e.stepDependsOnCondition[taskRunners[index].Name()] != nil
 	if dag || dependsOn {
 		return e.findDependsOnPhase(taskRunners[index].Name())
 	}
-	if index < 1 {
-		return v1alpha1.WorkflowStepPhaseSucceeded
-	}
+	last, found := v1alpha1.WorkflowStepPhaseSucceeded, false
 	for i := index - 1; i >= 0; i-- {
-		if skipExecutionOfNextStep(e.stepStatus[taskRunners[i].Name()].Phase, dependsOn) {
-			return e.stepStatus[taskRunners[i].Name()].Phase
+		name := taskRunners[i].Name()
+		// the periodic steps won't block the following steps
+		if _, ok := e.stepPeriodic[name]; ok {
+			continue
+		}
+		// the failed sub steps are counted against the tolerance of their group, they won't block the following sub steps
+		if status := e.stepStatus[name]; status.Phase == v1alpha1.WorkflowStepPhaseFailed && types.IsStepFinish(status.Phase, status.Reason) && e.toleratesFailures() {
+			continue
+		}
+		if skipExecutionOfNextStep(e.stepStatus[name].Phase, dependsOn) {
+			return e.stepStatus[name].Phase
+		}
+		if !found {
+			last, found = e.stepStatus[name].Phase, true
 		}
 	}
-	return e.stepStatus[taskRunners[index-1].Name()].Phase
+	return last
 }
 
 func (e *engine) findDependsOnPhase(name string) v1alpha1.WorkflowStepPhase {
 	for _, dependsOn := range e.stepDependsOn[name] {
+		// the dependencies on the excluded steps are treated as satisfied
+		if e.stepStatus[dependsOn].Reason == types.StatusReasonExcluded {
+			continue
+		}
 		if e.stepStatus[dependsOn].Phase != v1alpha1.WorkflowStepPhaseSucceeded {
 			return e.stepStatus[dependsOn].Phase
 		}
@@ -802,6 +1764,11 @@ func (e *engine) findDependsOnPhase(name string) v1alpha1.WorkflowStepPhase {
 			return result
 		}
 	}
+	if condition, ok := e.stepDependsOnCondition[name]; ok {
+		if _, phase := types.CheckDependsOnCondition(condition, e.stepStatus); phase != v1alpha1.WorkflowStepPhaseSucceeded {
+			return phase
+		}
+	}
 	return v1alpha1.WorkflowStepPhaseSucceeded
 }
 
@@ -830,6 +1797,43 @@ func handleBackoffTimes(ctx context.Context, wfCtx wfContext.Context, status v1a
 	return nil
 }
 
+// handleContextBackendError keeps the step running with backoff when it fails to commit the workflow context,
+// the step will be failed if the context backend is still unavailable after the max retry times.
+func (e *engine) handleContextBackendError(ctx monitorContext.Context, status v1alpha1.StepStatus, err error) error {
+	ctx.Error(err, "commit workflow context", "step", status.Name)
+	e.status.SetConditions(condition.Condition{
+		Type:               condition.ConditionType(v1alpha1.WorkflowRunContextBackendConditionType),
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(e.clock.Now()),
+		Reason:             condition.ReasonUnavailable,
+		Message:            err.Error(),
+	})
+	e.wfCtx.IncreaseCountValueInMemory(types.ContextPrefixBackoffTimes, status.ID)
+	status.Phase = v1alpha1.WorkflowStepPhaseRunning
+	status.Reason = types.StatusReasonContextBackendUnavailable
+	status.Message = err.Error()
+	if times := e.wfCtx.IncreaseCountValueInMemory(types.ContextPrefixBackendFailedTimes, status.ID); times >= types.MaxContextBackendRetryTimes {
+		e.wfCtx.DeleteValueInMemory(types.ContextPrefixBackendFailedTimes, status.ID)
+		status.Phase = v1alpha1.WorkflowStepPhaseFailed
+		status.Message = fmt.Sprintf("context backend is still unavailable after %d retries: %s", times, err.Error())
+		e.failedAfterRetries = true
+	}
+	return e.updateStepStatus(ctx, status)
+}
+
+// recoverContextBackend clears the context backend failures after the workflow context is committed
+func (e *engine) recoverContextBackend(status v1alpha1.StepStatus) {
+	e.wfCtx.DeleteValueInMemory(types.ContextPrefixBackendFailedTimes, status.ID)
+	if c := e.status.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunContextBackendConditionType)); c.Status == corev1.ConditionTrue {
+		e.status.SetConditions(condition.Condition{
+			Type:               condition.ConditionType(v1alpha1.WorkflowRunContextBackendConditionType),
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.NewTime(e.clock.Now()),
+			Reason:             condition.ReasonAvailable,
+		})
+	}
+}
+
 func (e *engine) cleanBackoffTimesForTerminated() {
 	for _, ss := range e.status.Steps {
 		for _, sub := range ss.SubStepsStatus {
@@ -18,32 +18,44 @@ package executor
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"math"
 	"testing"
 	"time"
 
+	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
 	"github.com/google/go-cmp/cmp"
 	"github.com/kubevela/pkg/util/slices"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	featuregatetesting "k8s.io/component-base/featuregate/testing"
+	clocktesting "k8s.io/utils/clock/testing"
 	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/yaml"
 
 	monitorContext "github.com/kubevela/pkg/monitor/context"
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/kubevela/workflow/api/condition"
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/cue/process"
 	"github.com/kubevela/workflow/pkg/features"
 	"github.com/kubevela/workflow/pkg/providers"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/tasks/builtin"
 	"github.com/kubevela/workflow/pkg/tasks/custom"
 	"github.com/kubevela/workflow/pkg/types"
@@ -103,7 +115,8 @@ var _ = Describe("Test Workflow", func() {
 		workflowStatus.ContextBackend = nil
 		cleanStepTimeStamp(&workflowStatus)
 		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
-			Mode: defaultMode,
+			Failures: []v1alpha1.StepFailure{{Name: "s2"}},
+			Mode:     defaultMode,
 			Steps: []v1alpha1.WorkflowStepStatus{
 				{
 					StepStatus: v1alpha1.StepStatus{
@@ -213,7 +226,8 @@ var _ = Describe("Test Workflow", func() {
 		instance.Status.ContextBackend = nil
 		cleanStepTimeStamp(&instance.Status)
 		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
-			Mode: defaultMode,
+			Failures: []v1alpha1.StepFailure{{Name: "s2-sub2"}},
+			Mode:     defaultMode,
 			Steps: []v1alpha1.WorkflowStepStatus{{
 				StepStatus: v1alpha1.StepStatus{
 					Name:  "s1",
@@ -285,6 +299,8 @@ var _ = Describe("Test Workflow", func() {
 		workflowStatus.ContextBackend = nil
 		cleanStepTimeStamp(&workflowStatus)
 		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 1 failed step(s): s2",
+			Failures:   []v1alpha1.StepFailure{{Name: "s2", Reason: types.StatusReasonTimeout}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{
@@ -319,6 +335,60 @@ var _ = Describe("Test Workflow", func() {
 		})).Should(BeEquivalentTo(""))
 	})
 
+	It("Workflow test for timeout with fake clock", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name:    "s1",
+					Type:    "running",
+					Timeout: "1h",
+				},
+			},
+		})
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		fakeClock := clocktesting.NewFakeClock(time.Now())
+		wf := New(instance, WithClock(fakeClock))
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps[0].FirstExecuteTime.Time).Should(BeTemporally("==", fakeClock.Now()))
+
+		fakeClock.Step(30 * time.Minute)
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseRunning))
+
+		fakeClock.Step(30*time.Minute + time.Second)
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(instance.Status.Steps[0].Reason).Should(BeEquivalentTo(types.StatusReasonTimeout))
+	})
+
+	It("Workflow test for the execute times of the step", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+		})
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		fakeClock := clocktesting.NewFakeClock(time.Now())
+		start := fakeClock.Now()
+		runners[0] = &slowTaskRunner{TaskRunner: runners[0], clock: fakeClock, duration: time.Minute}
+		wf := New(instance, WithClock(fakeClock))
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(instance.Status.StartTime.Time).Should(BeTemporally("==", start))
+		Expect(instance.Status.Steps[0].FirstExecuteTime.Time).Should(BeTemporally("==", start))
+		Expect(instance.Status.Steps[0].LastExecuteTime.Time).Should(BeTemporally("==", start.Add(time.Minute)))
+	})
+
 	It("Workflow test for timeout with suspend", func() {
 		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
 			{
@@ -370,6 +440,8 @@ var _ = Describe("Test Workflow", func() {
 		workflowStatus.ContextBackend = nil
 		cleanStepTimeStamp(&workflowStatus)
 		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 1 failed step(s): s4",
+			Failures:   []v1alpha1.StepFailure{{Name: "s4", Reason: types.StatusReasonTimeout}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{
@@ -462,6 +534,8 @@ var _ = Describe("Test Workflow", func() {
 		workflowStatus.ContextBackend = nil
 		cleanStepTimeStamp(&workflowStatus)
 		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 2 failed step(s): s2-sub2, s2-suspend",
+			Failures:   []v1alpha1.StepFailure{{Name: "s2-sub2", Reason: types.StatusReasonTimeout}, {Name: "s2-suspend", Reason: types.StatusReasonTimeout}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
@@ -553,6 +627,8 @@ var _ = Describe("Test Workflow", func() {
 		workflowStatus.ContextBackend = nil
 		cleanStepTimeStamp(&workflowStatus)
 		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 2 failed step(s): s2-sub2, s2-suspend",
+			Failures:   []v1alpha1.StepFailure{{Name: "s2-sub2", Reason: types.StatusReasonTimeout}, {Name: "s2-suspend", Reason: types.StatusReasonTimeout}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
@@ -596,6 +672,168 @@ var _ = Describe("Test Workflow", func() {
 		})).Should(BeEquivalentTo(""))
 	})
 
+	It("Workflow test for sub steps timeout", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "step-group",
+				},
+				SubStepsTimeout: "1s",
+				SubSteps: []v1alpha1.WorkflowStepBase{
+					{
+						Name: "s2-sub1",
+						Type: "success",
+					},
+					{
+						Name: "s2-sub2",
+						Type: "running",
+					},
+					{
+						Name:    "s2-sub3",
+						Type:    "running",
+						Timeout: "1m",
+					},
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s3",
+					Type: "success",
+				},
+			},
+		})
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		wf := New(instance)
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		// the running sub steps take 1.2s in total, which exceeds the sub steps timeout before the group timeout
+		time.Sleep(600 * time.Millisecond)
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		workflowStatus := instance.Status
+		workflowStatus.ContextBackend = nil
+		cleanStepTimeStamp(&workflowStatus)
+		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 2 failed step(s): s2-sub2, s2-sub3",
+			Failures:   []v1alpha1.StepFailure{{Name: "s2-sub2", Reason: types.StatusReasonTimeout}, {Name: "s2-sub3", Reason: types.StatusReasonTimeout}},
+			Mode:       defaultMode,
+			Terminated: true,
+			Steps: []v1alpha1.WorkflowStepStatus{{
+				StepStatus: v1alpha1.StepStatus{
+					Name:  "s1",
+					Type:  "success",
+					Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+				},
+			}, {
+				StepStatus: v1alpha1.StepStatus{
+					Name:   "s2",
+					Type:   "step-group",
+					Phase:  v1alpha1.WorkflowStepPhaseFailed,
+					Reason: types.StatusReasonTimeout,
+				},
+				SubStepsStatus: []v1alpha1.StepStatus{
+					{
+						Name:  "s2-sub1",
+						Type:  "success",
+						Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+					}, {
+						Name:   "s2-sub2",
+						Type:   "running",
+						Phase:  v1alpha1.WorkflowStepPhaseFailed,
+						Reason: types.StatusReasonTimeout,
+					}, {
+						Name:   "s2-sub3",
+						Type:   "running",
+						Phase:  v1alpha1.WorkflowStepPhaseFailed,
+						Reason: types.StatusReasonTimeout,
+					},
+				},
+			}, {
+				StepStatus: v1alpha1.StepStatus{
+					Name:   "s3",
+					Type:   "success",
+					Phase:  v1alpha1.WorkflowStepPhaseSkipped,
+					Reason: types.StatusReasonSkip,
+				},
+			}},
+		})).Should(BeEquivalentTo(""))
+	})
+
+	It("Workflow test aggregate failures in DAG mode", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "failed-after-retries",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "success",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s3",
+					Type: "failed-after-retries",
+				},
+			},
+		})
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{
+			Steps: v1alpha1.WorkflowModeDAG,
+		}
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		wf := New(instance)
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(instance.Status.Message).Should(BeEquivalentTo("The workflow has 2 failed step(s): s1, s3"))
+		Expect(instance.Status.Failures).Should(BeEquivalentTo([]v1alpha1.StepFailure{
+			{Name: "s1", Reason: types.StatusReasonFailedAfterRetries},
+			{Name: "s3", Reason: types.StatusReasonFailedAfterRetries},
+		}))
+
+		By("the failures are cleared when the failed steps are rerun")
+		instance.Status.Terminated = false
+		instance.Status.Steps = instance.Status.Steps[1:2]
+		StepStatusCache.Delete(fmt.Sprintf("%s-%s", instance.Name, instance.Namespace))
+		_, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "success",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s3",
+					Type: "success",
+				},
+			},
+		})
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(instance.Status.Message).Should(BeEquivalentTo(""))
+		Expect(instance.Status.Failures).Should(BeNil())
+	})
+
 	It("Workflow test skipped with sub steps", func() {
 		By("Test skipped with step group")
 		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
@@ -636,6 +874,8 @@ var _ = Describe("Test Workflow", func() {
 		instance.Status.ContextBackend = nil
 		cleanStepTimeStamp(&instance.Status)
 		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 1 failed step(s): s1",
+			Failures:   []v1alpha1.StepFailure{{Name: "s1", Reason: types.StatusReasonFailedAfterRetries}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
@@ -723,6 +963,8 @@ var _ = Describe("Test Workflow", func() {
 		instance.Status.ContextBackend = nil
 		cleanStepTimeStamp(&instance.Status)
 		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 3 failed step(s): s1, s2-sub2, s2-sub3",
+			Failures:   []v1alpha1.StepFailure{{Name: "s1", Reason: types.StatusReasonFailedAfterRetries}, {Name: "s2-sub2", Reason: types.StatusReasonFailedAfterRetries}, {Name: "s2-sub3", Reason: types.StatusReasonTerminate}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
@@ -893,75 +1135,239 @@ var _ = Describe("Test Workflow", func() {
 		})).Should(BeEquivalentTo(""))
 	})
 
-	It("Workflow test for failed after retries with suspend", func() {
-		By("Test failed-after-retries in StepByStep mode with suspend")
-		defer featuregatetesting.SetFeatureGateDuringTest(&testing.T{}, utilfeature.DefaultFeatureGate, features.EnableSuspendOnFailure, true)()
+	It("Workflow test paused", func() {
+		By("Test the steps that are not started are held")
 		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
 			{
 				WorkflowStepBase: v1alpha1.WorkflowStepBase{
 					Name: "s1",
-					Type: "success",
+					Type: "running",
 				},
 			},
 			{
 				WorkflowStepBase: v1alpha1.WorkflowStepBase{
 					Name: "s2",
-					Type: "failed-after-retries",
+					Type: "success",
+				},
+			},
+		})
+		instance.Mode = &dagMode
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := New(instance, WithPaused(true)).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps).Should(BeEmpty())
+
+		By("Test the in-flight steps are allowed to finish")
+		instance.Status.Steps = []v1alpha1.WorkflowStepStatus{{
+			StepStatus: v1alpha1.StepStatus{Name: "s1", Type: "running", Phase: v1alpha1.WorkflowStepPhaseRunning},
+		}}
+		StepStatusCache.Delete(fmt.Sprintf("%s-%s", instance.Name, instance.Namespace))
+		state, err = New(instance, WithPaused(true)).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps).Should(HaveLen(1))
+		Expect(instance.Status.Steps[0].LastExecuteTime.IsZero()).Should(BeFalse())
+
+		By("Test the held steps are started once resumed")
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps).Should(HaveLen(2))
+		Expect(instance.Status.Steps[1].Name).Should(Equal("s2"))
+		Expect(instance.Status.Steps[1].Phase).Should(Equal(v1alpha1.WorkflowStepPhaseSucceeded))
+	})
+
+	It("Workflow test step by step with sub steps", func() {
+		By("Test the next step waits for the sub steps in StepByStep mode")
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "step-group",
+				},
+				Mode: v1alpha1.WorkflowModeStep,
+				SubSteps: []v1alpha1.WorkflowStepBase{
+					{
+						Name: "s1-sub1",
+						Type: "running",
+					},
+					{
+						Name: "s1-sub2",
+						Type: "success",
+					},
 				},
 			},
 			{
 				WorkflowStepBase: v1alpha1.WorkflowStepBase{
-					Name: "s3",
+					Name: "s2",
 					Type: "success",
 				},
 			},
 		})
-		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
 		wf := New(instance)
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
 		state, err := wf.ExecuteRunners(ctx, runners)
 		Expect(err).ToNot(HaveOccurred())
-		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
-		workflowStatus := instance.Status
-		Expect(workflowStatus.ContextBackend.Name).Should(BeEquivalentTo("workflow-" + instance.Name + "-context"))
-		workflowStatus.ContextBackend = nil
-		cleanStepTimeStamp(&workflowStatus)
-		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
-			Mode:    defaultMode,
-			Message: types.MessageSuspendFailedAfterRetries,
-			Suspend: true,
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		instance.Status.ContextBackend = nil
+		cleanStepTimeStamp(&instance.Status)
+		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
+			Mode: defaultMode,
 			Steps: []v1alpha1.WorkflowStepStatus{{
 				StepStatus: v1alpha1.StepStatus{
 					Name:  "s1",
-					Type:  "success",
-					Phase: v1alpha1.WorkflowStepPhaseSucceeded,
-				},
-			}, {
-				StepStatus: v1alpha1.StepStatus{
-					Name:   "s2",
-					Type:   "failed-after-retries",
-					Phase:  v1alpha1.WorkflowStepPhaseFailed,
-					Reason: types.StatusReasonFailedAfterRetries,
+					Type:  "step-group",
+					Phase: v1alpha1.WorkflowStepPhaseRunning,
 				},
+				SubStepsStatus: []v1alpha1.StepStatus{{
+					Name:  "s1-sub1",
+					Type:  "running",
+					Phase: v1alpha1.WorkflowStepPhaseRunning,
+				}},
 			}},
 		})).Should(BeEquivalentTo(""))
 
-		By("Test failed-after-retries in DAG mode with suspend")
+		By("Test the next step waits for the retrying sub steps in DAG mode")
 		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
 			{
 				WorkflowStepBase: v1alpha1.WorkflowStepBase{
 					Name: "s1",
-					Type: "success",
+					Type: "step-group",
 				},
-			},
-			{
-				WorkflowStepBase: v1alpha1.WorkflowStepBase{
-					Name: "s2",
-					Type: "failed-after-retries",
+				SubSteps: []v1alpha1.WorkflowStepBase{
+					{
+						Name: "s1-sub1",
+						Type: "failed",
+					},
+					{
+						Name: "s1-sub2",
+						Type: "terminate",
+					},
 				},
 			},
 			{
 				WorkflowStepBase: v1alpha1.WorkflowStepBase{
-					Name: "s3",
+					Name: "s2",
+					Type: "success",
+				},
+			},
+		})
+		wf = New(instance)
+		ctx = monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		instance.Status.ContextBackend = nil
+		cleanStepTimeStamp(&instance.Status)
+		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
+			Mode:       defaultMode,
+			Terminated: true,
+			Message:    "The workflow has 2 failed step(s): s1-sub1, s1-sub2",
+			Failures:   []v1alpha1.StepFailure{{Name: "s1-sub1"}, {Name: "s1-sub2", Reason: types.StatusReasonTerminate}},
+			Steps: []v1alpha1.WorkflowStepStatus{{
+				StepStatus: v1alpha1.StepStatus{
+					Name:  "s1",
+					Type:  "step-group",
+					Phase: v1alpha1.WorkflowStepPhaseFailed,
+				},
+				SubStepsStatus: []v1alpha1.StepStatus{{
+					Name:  "s1-sub1",
+					Type:  "failed",
+					Phase: v1alpha1.WorkflowStepPhaseFailed,
+				}, {
+					Name:   "s1-sub2",
+					Type:   "terminate",
+					Phase:  v1alpha1.WorkflowStepPhaseFailed,
+					Reason: types.StatusReasonTerminate,
+				}},
+			}},
+		})).Should(BeEquivalentTo(""))
+
+		By("Test the next step begins after the sub steps are finished")
+		runners[0] = makeRunner(runners[0].(*testTaskRunner).step, []types.TaskRunner{
+			makeRunner(v1alpha1.WorkflowStep{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1-sub1", Type: "success"}}, nil),
+			makeRunner(v1alpha1.WorkflowStep{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1-sub2", Type: "terminate"}}, nil),
+		})
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateTerminated))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(instance.Status.Steps[0].Reason).Should(BeEquivalentTo(types.StatusReasonTerminate))
+		Expect(len(instance.Status.Steps)).Should(BeEquivalentTo(2))
+		Expect(instance.Status.Steps[1].Name).Should(BeEquivalentTo("s2"))
+	})
+
+	It("Workflow test for failed after retries with suspend", func() {
+		By("Test failed-after-retries in StepByStep mode with suspend")
+		defer featuregatetesting.SetFeatureGateDuringTest(&testing.T{}, utilfeature.DefaultFeatureGate, features.EnableSuspendOnFailure, true)()
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "failed-after-retries",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s3",
+					Type: "success",
+				},
+			},
+		})
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		wf := New(instance)
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
+		workflowStatus := instance.Status
+		Expect(workflowStatus.ContextBackend.Name).Should(BeEquivalentTo("workflow-" + instance.Name + "-context"))
+		workflowStatus.ContextBackend = nil
+		cleanStepTimeStamp(&workflowStatus)
+		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
+			Failures: []v1alpha1.StepFailure{{Name: "s2", Reason: types.StatusReasonFailedAfterRetries}},
+			Mode:     defaultMode,
+			Message:  types.MessageSuspendFailedAfterRetries,
+			Suspend:  true,
+			Steps: []v1alpha1.WorkflowStepStatus{{
+				StepStatus: v1alpha1.StepStatus{
+					Name:  "s1",
+					Type:  "success",
+					Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+				},
+			}, {
+				StepStatus: v1alpha1.StepStatus{
+					Name:   "s2",
+					Type:   "failed-after-retries",
+					Phase:  v1alpha1.WorkflowStepPhaseFailed,
+					Reason: types.StatusReasonFailedAfterRetries,
+				},
+			}},
+		})).Should(BeEquivalentTo(""))
+
+		By("Test failed-after-retries in DAG mode with suspend")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "failed-after-retries",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s3",
 					Type: "success",
 				},
 			},
@@ -979,9 +1385,10 @@ var _ = Describe("Test Workflow", func() {
 		workflowStatus.ContextBackend = nil
 		cleanStepTimeStamp(&workflowStatus)
 		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
-			Mode:    dagMode,
-			Message: types.MessageSuspendFailedAfterRetries,
-			Suspend: true,
+			Failures: []v1alpha1.StepFailure{{Name: "s2", Reason: types.StatusReasonFailedAfterRetries}},
+			Mode:     dagMode,
+			Message:  types.MessageSuspendFailedAfterRetries,
+			Suspend:  true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
 				StepStatus: v1alpha1.StepStatus{
 					Name:  "s1",
@@ -1051,6 +1458,8 @@ var _ = Describe("Test Workflow", func() {
 		workflowStatus.ContextBackend = nil
 		cleanStepTimeStamp(&workflowStatus)
 		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 1 failed step(s): s2",
+			Failures:   []v1alpha1.StepFailure{{Name: "s2", Reason: types.StatusReasonFailedAfterRetries}},
 			Mode:       defaultMode,
 			Suspend:    false,
 			Terminated: true,
@@ -1147,6 +1556,8 @@ var _ = Describe("Test Workflow", func() {
 		workflowStatus.ContextBackend = nil
 		cleanStepTimeStamp(&workflowStatus)
 		Expect(cmp.Diff(workflowStatus, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 1 failed step(s): s2",
+			Failures:   []v1alpha1.StepFailure{{Name: "s2", Reason: types.StatusReasonFailedAfterRetries}},
 			Mode:       dagMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
@@ -1416,6 +1827,8 @@ var _ = Describe("Test Workflow", func() {
 		instance.Status.ContextBackend = nil
 		cleanStepTimeStamp(&instance.Status)
 		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 1 failed step(s): s3_sub2",
+			Failures:   []v1alpha1.StepFailure{{Name: "s3_sub2", Reason: types.StatusReasonFailedAfterRetries}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
@@ -1467,6 +1880,241 @@ var _ = Describe("Test Workflow", func() {
 		})).Should(BeEquivalentTo(""))
 	})
 
+	It("Workflow test finalizer steps", func() {
+		for _, tc := range []struct {
+			failedType string
+			phase      v1alpha1.WorkflowRunPhase
+			notify     v1alpha1.WorkflowStepPhase
+			cleanup    v1alpha1.WorkflowStepPhase
+		}{
+			{failedType: "success", phase: v1alpha1.WorkflowStateSucceeded, notify: v1alpha1.WorkflowStepPhaseSucceeded, cleanup: v1alpha1.WorkflowStepPhaseSkipped},
+			{failedType: "failed-after-retries", phase: v1alpha1.WorkflowStateFailed, notify: v1alpha1.WorkflowStepPhaseSkipped, cleanup: v1alpha1.WorkflowStepPhaseSucceeded},
+			{failedType: "terminate", phase: v1alpha1.WorkflowStateTerminated, notify: v1alpha1.WorkflowStepPhaseSkipped, cleanup: v1alpha1.WorkflowStepPhaseSucceeded},
+		} {
+			instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success"}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: tc.failedType}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "done", Type: "success", DependsOn: []string{"s1", "s2"}}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "notify", Type: "success", DependsOn: []string{"s1", "s2"}}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "cleanup", Type: "success", DependsOn: []string{"s1", "s2"}}},
+			})
+			instance.Finalizers = map[string]types.FinalizerKind{
+				"done":    types.FinalizerOnComplete,
+				"notify":  types.FinalizerOnSuccess,
+				"cleanup": types.FinalizerOnFailure,
+			}
+			ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+			state, err := New(instance).ExecuteRunners(ctx, runners)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state).Should(BeEquivalentTo(tc.phase))
+			phases := map[string]v1alpha1.WorkflowStepPhase{}
+			for _, step := range instance.Status.Steps {
+				phases[step.Name] = step.Phase
+			}
+			Expect(phases["done"]).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+			Expect(phases["notify"]).Should(BeEquivalentTo(tc.notify))
+			Expect(phases["cleanup"]).Should(BeEquivalentTo(tc.cleanup))
+
+			wfCtx, err := wfContext.LoadContext(ctx, instance.Namespace, instance.Name, instance.Status.ContextBackend.Name)
+			Expect(err).ToNot(HaveOccurred())
+			v, err := wfCtx.GetVar(types.ContextVarWorkflowStatus, "phase")
+			Expect(err).ToNot(HaveOccurred())
+			phase, err := v.String()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(phase).Should(BeEquivalentTo(tc.phase))
+			wfContext.CleanupMemoryStore(instance.Name, instance.Namespace)
+			Expect(k8sClient.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: instance.Status.ContextBackend.Name, Namespace: instance.Namespace}})).Should(Succeed())
+		}
+	})
+
+	It("Workflow test finalizer steps with if", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "notify", Type: "success", If: "false", DependsOn: []string{"s1"}}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "done", Type: "success", If: "true", DependsOn: []string{"s1"}}},
+		})
+		instance.Finalizers = map[string]types.FinalizerKind{
+			"notify": types.FinalizerOnSuccess,
+			"done":   types.FinalizerOnComplete,
+		}
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		phases := map[string]v1alpha1.WorkflowStepPhase{}
+		for _, step := range instance.Status.Steps {
+			phases[step.Name] = step.Phase
+		}
+		Expect(phases["notify"]).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSkipped))
+		Expect(phases["done"]).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+		wfContext.CleanupMemoryStore(instance.Name, instance.Namespace)
+		Expect(k8sClient.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: instance.Status.ContextBackend.Name, Namespace: instance.Namespace}})).Should(Succeed())
+
+		By("the finalizer steps are gated with the EnableSuspendOnFailure feature")
+		defer featuregatetesting.SetFeatureGateDuringTest(&testing.T{}, utilfeature.DefaultFeatureGate, features.EnableSuspendOnFailure, true)()
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "terminate"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "notify", Type: "success", DependsOn: []string{"s1"}}},
+		})
+		instance.Finalizers = map[string]types.FinalizerKind{
+			"notify": types.FinalizerOnSuccess,
+		}
+		_, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		for _, step := range instance.Status.Steps {
+			if step.Name == "notify" {
+				Expect(step.Phase).ShouldNot(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+			}
+		}
+	})
+
+	It("Workflow test depends on excluded steps", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "excluded"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "success", DependsOn: []string{"s1"}}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s3", Type: "success", DependsOn: []string{"s2"}}},
+		})
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{
+			Steps: v1alpha1.WorkflowModeDAG,
+		}
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		phases := map[string]v1alpha1.WorkflowStepPhase{}
+		for _, step := range instance.Status.Steps {
+			phases[step.Name] = step.Phase
+		}
+		Expect(phases).Should(Equal(map[string]v1alpha1.WorkflowStepPhase{
+			"s1": v1alpha1.WorkflowStepPhaseSkipped,
+			"s2": v1alpha1.WorkflowStepPhaseSucceeded,
+			"s3": v1alpha1.WorkflowStepPhaseSucceeded,
+		}))
+	})
+
+	It("Workflow test depends on condition ignoring failure", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "deploy", Type: "failed-after-retries"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "cleanup", Type: "success", DependsOnCondition: &v1alpha1.DependsOnCondition{
+				Step: "deploy", IgnoreFailure: true,
+			}}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "notify", Type: "success", DependsOnCondition: &v1alpha1.DependsOnCondition{
+				Step: "deploy",
+			}}},
+		})
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{
+			Steps: v1alpha1.WorkflowModeDAG,
+		}
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		phases := map[string]v1alpha1.WorkflowStepPhase{}
+		for _, step := range instance.Status.Steps {
+			phases[step.Name] = step.Phase
+		}
+		Expect(phases).Should(Equal(map[string]v1alpha1.WorkflowStepPhase{
+			"deploy":  v1alpha1.WorkflowStepPhaseFailed,
+			"cleanup": v1alpha1.WorkflowStepPhaseSucceeded,
+			"notify":  v1alpha1.WorkflowStepPhaseSkipped,
+		}))
+	})
+
+	It("Workflow test failure policy in dag mode", func() {
+		makeSteps := func() []v1alpha1.WorkflowStep {
+			return []v1alpha1.WorkflowStep{
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "running"}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "failed-after-retries"}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s3", Type: "success"}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s4", Type: "success", If: "always"}},
+			}
+		}
+		phases := func(instance *types.WorkflowInstance) map[string]v1alpha1.WorkflowStepPhase {
+			phases := map[string]v1alpha1.WorkflowStepPhase{}
+			for _, step := range instance.Status.Steps {
+				phases[step.Name] = step.Phase
+			}
+			return phases
+		}
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+
+		By("the other branches are executed to completion by default")
+		instance, runners := makeTestCase(makeSteps())
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG}
+		state, err := New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(phases(instance)).Should(Equal(map[string]v1alpha1.WorkflowStepPhase{
+			"s1": v1alpha1.WorkflowStepPhaseRunning,
+			"s2": v1alpha1.WorkflowStepPhaseFailed,
+			"s3": v1alpha1.WorkflowStepPhaseSucceeded,
+			"s4": v1alpha1.WorkflowStepPhaseSucceeded,
+		}))
+
+		By("the unfinished steps are canceled with FailFast")
+		instance, runners = makeTestCase(makeSteps())
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG}
+		instance.FailurePolicy = v1alpha1.FailurePolicyFailFast
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(phases(instance)).Should(Equal(map[string]v1alpha1.WorkflowStepPhase{
+			"s1": v1alpha1.WorkflowStepPhaseFailed,
+			"s2": v1alpha1.WorkflowStepPhaseFailed,
+			"s3": v1alpha1.WorkflowStepPhaseSkipped,
+			"s4": v1alpha1.WorkflowStepPhaseSucceeded,
+		}))
+		Expect(instance.Status.Steps[0].Reason).Should(Equal(types.StatusReasonTerminate))
+		Expect(instance.Status.Steps[0].Message).Should(Equal("Canceled since the step s2 is failed"))
+	})
+
+	It("Workflow test prune consumed outputs", func() {
+		makeSteps := func(consumerType string) []v1alpha1.WorkflowStep {
+			return []v1alpha1.WorkflowStep{
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success", Outputs: v1alpha1.StepOutputs{{
+					Name: "test", ValueFrom: "context.name", Retention: v1alpha1.OutputRetentionConsumed,
+				}}}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: consumerType, Inputs: v1alpha1.StepInputs{{
+					From: "test",
+				}}}},
+			}
+		}
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		loadContext := func(instance *types.WorkflowInstance) wfContext.Context {
+			wfCtx, err := wfContext.LoadContext(ctx, instance.Namespace, instance.Name, instance.Status.ContextBackend.Name)
+			Expect(err).ToNot(HaveOccurred())
+			return wfCtx
+		}
+		cleanup := func(instance *types.WorkflowInstance) {
+			wfContext.CleanupMemoryStore(instance.Name, instance.Namespace)
+			Expect(k8sClient.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: instance.Status.ContextBackend.Name, Namespace: instance.Namespace}})).Should(Succeed())
+		}
+
+		By("the output is kept until the consumers are finished")
+		instance, runners := makeTestCase(makeSteps("running"))
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG}
+		state, err := New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		wfCtx := loadContext(instance)
+		_, err = wfCtx.GetVar("test")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(wfCtx.GetMutableValue(types.ContextPrefixPrunedOutput, "test")).Should(BeEmpty())
+		cleanup(instance)
+
+		By("the output is pruned once the consumers are succeeded")
+		instance, runners = makeTestCase(makeSteps("noop"))
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG}
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		wfCtx = loadContext(instance)
+		_, err = wfCtx.GetVar("test")
+		Expect(err).Should(HaveOccurred())
+		Expect(wfCtx.GetMutableValue(types.ContextPrefixPrunedOutput, "test")).Should(Equal("s1"))
+		cleanup(instance)
+	})
+
 	It("Test failed after retries with sub steps", func() {
 		By("Test failed-after-retries with step group in StepByStep mode")
 		defer featuregatetesting.SetFeatureGateDuringTest(&testing.T{}, utilfeature.DefaultFeatureGate, features.EnableSuspendOnFailure, true)()
@@ -1508,9 +2156,10 @@ var _ = Describe("Test Workflow", func() {
 		instance.Status.ContextBackend = nil
 		cleanStepTimeStamp(&instance.Status)
 		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
-			Mode:    defaultMode,
-			Message: types.MessageSuspendFailedAfterRetries,
-			Suspend: true,
+			Failures: []v1alpha1.StepFailure{{Name: "s2-sub2", Reason: types.StatusReasonFailedAfterRetries}},
+			Mode:     defaultMode,
+			Message:  types.MessageSuspendFailedAfterRetries,
+			Suspend:  true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
 				StepStatus: v1alpha1.StepStatus{
 					Name:  "s1",
@@ -1917,6 +2566,8 @@ var _ = Describe("Test Workflow", func() {
 		instance.Status.ContextBackend = nil
 		cleanStepTimeStamp(&instance.Status)
 		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 1 failed step(s): s2",
+			Failures:   []v1alpha1.StepFailure{{Name: "s2", Reason: types.StatusReasonTerminate}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
@@ -1940,6 +2591,80 @@ var _ = Describe("Test Workflow", func() {
 		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateTerminated))
 	})
 
+	It("test for exiting the workflow as succeeded", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "exit"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s3", Type: "success"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s4", Type: "success", If: "always"}},
+		})
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		wf := New(instance)
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(instance.Status.Terminated).Should(BeTrue())
+		Expect(instance.Status.Failures).Should(BeEmpty())
+		Expect(instance.Status.Message).Should(Equal("The workflow is exited by the step s2: nothing to deploy"))
+		Expect(instance.Status.Steps[1].Reason).Should(Equal(types.StatusReasonExit))
+		Expect(instance.Status.Steps[2].Phase).Should(Equal(v1alpha1.WorkflowStepPhaseSkipped))
+		Expect(instance.Status.Steps[3].Phase).Should(Equal(v1alpha1.WorkflowStepPhaseSucceeded))
+
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+
+		By("the workflow is failed if another step is failed")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "exit"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "terminate", If: "always"}},
+		})
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateTerminated))
+
+		By("the workflow broken by a step is still failed")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "break"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "success"}},
+		})
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+
+		By("the workflow is exited by a sub step")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "step-group"},
+				SubSteps: []v1alpha1.WorkflowStepBase{
+					{Name: "s1-sub1", Type: "success"},
+					{Name: "s1-sub2", Type: "exit"},
+				},
+			},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "success"}},
+		})
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(instance.Status.Message).Should(Equal("The workflow is exited by the step s1-sub2: nothing to deploy"))
+		Expect(instance.Status.Steps[1].Phase).Should(Equal(v1alpha1.WorkflowStepPhaseSkipped))
+	})
+
+	It("test for cancelling the in-flight steps of the run", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "cancelled"}},
+		})
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps[0].Phase).Should(Equal(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(instance.Status.Steps[0].Message).Should(Equal(context.Canceled.Error()))
+
+		By("the run is not cancelled once it's not executing the steps")
+		Expect(CancelRun(instance.Namespace, instance.Name)).Should(BeFalse())
+	})
+
 	It("test for terminate with sub steps", func() {
 
 		By("Test terminate with step group")
@@ -1975,6 +2700,8 @@ var _ = Describe("Test Workflow", func() {
 		instance.Status.ContextBackend = nil
 		cleanStepTimeStamp(&instance.Status)
 		Expect(cmp.Diff(instance.Status, v1alpha1.WorkflowRunStatus{
+			Message:    "The workflow has 1 failed step(s): s2-sub2",
+			Failures:   []v1alpha1.StepFailure{{Name: "s2-sub2", Reason: types.StatusReasonTerminate}},
 			Mode:       defaultMode,
 			Terminated: true,
 			Steps: []v1alpha1.WorkflowStepStatus{{
@@ -2150,40 +2877,682 @@ var _ = Describe("Test Workflow", func() {
 		})).Should(BeEquivalentTo(""))
 	})
 
-	It("step commit data without success", func() {
+	It("test for serialized status updates", func() {
+		defer featuregatetesting.SetFeatureGateDuringTest(&testing.T{}, utilfeature.DefaultFeatureGate, features.EnablePatchStatusAtOnce, true)()
+		types.StatusUpdateDebounce = time.Hour
+		defer func() { types.StatusUpdateDebounce = 0 }()
 		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
-			{
-				WorkflowStepBase: v1alpha1.WorkflowStepBase{
-					Name: "s1",
-					Type: "wait-with-set-var",
-				},
-			},
-			{
-				WorkflowStepBase: v1alpha1.WorkflowStepBase{
-					Name: "s2",
-					Type: "success",
-				},
-			},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "pending"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s3", Type: "success"}},
 		})
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG}
+		var written []v1alpha1.WorkflowRunStatus
+		var patchErr error
+		patcher := func(_ context.Context, status *v1alpha1.WorkflowRunStatus, _ bool) error {
+			written = append(written, *status)
+			return patchErr
+		}
+		pending = true
+		wf := New(instance, WithStatusPatcher(patcher))
 		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
-		wf := New(instance)
+
+		By("the updates of the steps are coalesced into one write")
 		state, err := wf.ExecuteRunners(ctx, runners)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
-		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseRunning))
-		wfCtx, err := wfContext.LoadContext(ctx, instance.Namespace, instance.Name, instance.Status.ContextBackend.Name)
-		Expect(err).ToNot(HaveOccurred())
-		v, err := wfCtx.GetVar("saved")
-		Expect(err).ToNot(HaveOccurred())
-		saved, err := v.Bool()
+		Expect(len(written)).Should(Equal(1))
+		Expect(len(written[0].Steps)).Should(Equal(3))
+
+		By("the status is written at once when the run is finished")
+		pending = false
+		written = nil
+		state, err = wf.ExecuteRunners(ctx, runners)
 		Expect(err).ToNot(HaveOccurred())
-		Expect(saved).Should(BeEquivalentTo(true))
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(len(written)).Should(Equal(1))
+		Expect(written[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+
+		By("the error of the write is returned")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success"}},
+		})
+		patchErr = errors.New("conflict")
+		wf = New(instance, WithStatusPatcher(patcher))
+		_, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).Should(MatchError("conflict"))
 	})
-})
 
-func makeTestCase(steps []v1alpha1.WorkflowStep) (*types.WorkflowInstance, []types.TaskRunner) {
-	instance := &types.WorkflowInstance{
-		WorkflowMeta: types.WorkflowMeta{
+	It("test for audit sink", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success", ServiceAccount: "deployer"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "success"}},
+		})
+		sink := &fakeAuditSink{err: errors.New("sink is unavailable")}
+		wf := New(instance, WithAuditSink(sink))
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(len(sink.entries)).Should(Equal(3))
+		Expect(sink.entries[0].Actor).Should(Equal("system:serviceaccount:default:deployer"))
+		Expect(sink.entries[0].Action).Should(Equal(types.AuditActionExecuteStep))
+		Expect(sink.entries[0].Target).Should(Equal(types.AuditTarget{Namespace: "default", Name: "app", Step: "s1", StepType: "success"}))
+		Expect(sink.entries[0].Outcome).Should(Equal(string(v1alpha1.WorkflowStepPhaseSucceeded)))
+		Expect(sink.entries[1].Actor).Should(Equal(types.AuditActorController))
+		Expect(sink.entries[1].Target.Step).Should(Equal("s2"))
+		Expect(sink.entries[2].Action).Should(Equal(types.AuditActionFinishRun))
+		Expect(sink.entries[2].Outcome).Should(Equal(string(v1alpha1.WorkflowStateSucceeded)))
+		Expect(sink.entries[2].Target.Step).Should(BeEmpty())
+
+		By("the suspending step is audited once until its phase changes")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "suspend"}},
+		})
+		sink = &fakeAuditSink{}
+		wf = New(instance, WithAuditSink(sink))
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSuspending))
+		Expect(len(sink.entries)).Should(Equal(1))
+		Expect(sink.entries[0].Outcome).Should(Equal(string(v1alpha1.WorkflowStepPhaseSuspending)))
+	})
+
+	It("test for periodic step", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "failed-after-retries",
+				},
+				Periodic: &v1alpha1.StepPeriodic{Interval: "1h"},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "pending",
+				},
+			},
+		})
+		pending = true
+		wf := New(instance)
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Terminated).Should(BeFalse())
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(instance.Status.Steps[1].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhasePending))
+		lastExecuteTime := instance.Status.Steps[0].LastExecuteTime
+
+		By("the periodic step is not executed again before the interval")
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps[0].LastExecuteTime).Should(BeEquivalentTo(lastExecuteTime))
+		Expect(wf.GetBackoffWaitTime()).Should(BeNumerically("<=", time.Hour))
+
+		By("the periodic step is executed again after the interval")
+		expired := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+		instance.Status.Steps[0].LastExecuteTime = expired
+		pending = false
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Terminated).Should(BeFalse())
+		Expect(instance.Status.Steps[0].LastExecuteTime.After(expired.Time)).Should(BeTrue())
+		Expect(instance.Status.Steps[1].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+	})
+
+	It("test for context backend unavailable", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+		})
+		singleton.KubeClient.Set(&failedPatchClient{Client: k8sClient})
+		defer singleton.KubeClient.Set(k8sClient)
+		wf := New(instance)
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseRunning))
+		Expect(instance.Status.Steps[0].Reason).Should(BeEquivalentTo(types.StatusReasonContextBackendUnavailable))
+		cond := instance.Status.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunContextBackendConditionType))
+		Expect(cond.Status).Should(BeEquivalentTo(corev1.ConditionTrue))
+
+		By("recover after the context backend is available")
+		singleton.KubeClient.Set(k8sClient)
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+		cond = instance.Status.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunContextBackendConditionType))
+		Expect(cond.Status).Should(BeEquivalentTo(corev1.ConditionFalse))
+
+		By("fail the step after the max retry times")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+		})
+		singleton.KubeClient.Set(&failedPatchClient{Client: k8sClient})
+		maxRetryTimes := types.MaxContextBackendRetryTimes
+		types.MaxContextBackendRetryTimes = 2
+		defer func() { types.MaxContextBackendRetryTimes = maxRetryTimes }()
+		wf = New(instance)
+		for i := 0; i < 2; i++ {
+			state, err = wf.ExecuteRunners(ctx, runners)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		}
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(instance.Status.Steps[0].Reason).Should(BeEquivalentTo(types.StatusReasonContextBackendUnavailable))
+	})
+
+	It("test for retry budget of the run", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "failed",
+				},
+			},
+		})
+		instance.MaxRetries = 2
+		wf := New(instance)
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		// the first failure of the step is not a retry
+		for i := 0; i <= 2; i++ {
+			state, err := wf.ExecuteRunners(ctx, runners)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+			Expect(instance.Status.Retries).Should(Equal(i))
+		}
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(instance.Status.Retries).Should(Equal(3))
+		Expect(instance.Status.Steps[1].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(instance.Status.Steps[1].Reason).Should(BeEquivalentTo(types.StatusReasonFailedAfterRetries))
+		Expect(instance.Status.Steps[1].Message).Should(Equal("The retries of the workflow exceed the budget 2"))
+	})
+
+	It("test for checking the permissions before the steps run", func() {
+		templ := cuecontext.New().CompileString(`
+apply: {
+	#provider: "kube"
+	#do:       "apply"
+	$params: value: {
+		apiVersion: "v1"
+		kind:       "ConfigMap"
+		metadata: name: "config"
+	}
+}
+`)
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+		})
+		instance.Annotations = map[string]string{types.AnnotationPermissionCheck: "true"}
+		runners[0] = &renderedTaskRunner{TaskRunner: runners[0], templates: []cue.Value{templ}}
+		cli := &reviewClient{Client: k8sClient, allowed: true}
+		singleton.KubeClient.Set(cli)
+		defer singleton.KubeClient.Set(k8sClient)
+		wf := New(instance)
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		cond := instance.Status.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunPermissionsConditionType))
+		Expect(cond.Status).Should(BeEquivalentTo(corev1.ConditionTrue))
+		Expect(cond.Reason).Should(BeEquivalentTo(v1alpha1.ReasonPermissionsAllowed))
+		Expect(cli.reviews).Should(Equal(3))
+
+		By("check the permissions once per run")
+		_, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cli.reviews).Should(Equal(3))
+
+		By("fail the run if the permissions are missing")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+		})
+		instance.Annotations = map[string]string{types.AnnotationPermissionCheck: "true"}
+		runners[0] = &renderedTaskRunner{TaskRunner: runners[0], templates: []cue.Value{templ}}
+		cli.allowed = false
+		wf = New(instance)
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(instance.Status.Terminated).Should(BeTrue())
+		Expect(instance.Status.Steps).Should(BeEmpty())
+		Expect(instance.Status.Message).Should(ContainSubstring("create configmaps config in namespace default"))
+		cond = instance.Status.GetCondition(condition.ConditionType(v1alpha1.WorkflowRunPermissionsConditionType))
+		Expect(cond.Status).Should(BeEquivalentTo(corev1.ConditionFalse))
+		Expect(cond.Reason).Should(BeEquivalentTo(v1alpha1.ReasonPermissionsMissing))
+	})
+
+	It("test for exceeding max workflow steps", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "success",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "step-group",
+				},
+				SubSteps: []v1alpha1.WorkflowStepBase{
+					{
+						Name: "s2-sub1",
+						Type: "success",
+					},
+					{
+						Name: "s2-sub2",
+						Type: "success",
+					},
+				},
+			},
+		})
+		maxSteps := types.MaxWorkflowSteps
+		types.MaxWorkflowSteps = 3
+		defer func() { types.MaxWorkflowSteps = maxSteps }()
+		wf := New(instance)
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(instance.Status.Terminated).Should(BeTrue())
+		Expect(instance.Status.Message).Should(BeEquivalentTo(fmt.Sprintf(types.MessageExceedMaxWorkflowSteps, 4, 3)))
+		Expect(instance.Status.Steps).Should(BeEmpty())
+
+		types.MaxWorkflowSteps = 4
+		instance, runners = makeTestCase(instance.Steps)
+		wf = New(instance)
+		state, err = wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+	})
+
+	It("test for init hooks", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "running",
+				},
+			},
+		})
+		instance.Name = "app-init-hooks"
+		instance.InitVars = map[string]interface{}{"endpoint": "http://mock"}
+		times := 0
+		hookErr := fmt.Errorf("mock init error")
+		hook := func(ctx wfContext.Context, instance *types.WorkflowInstance) error {
+			times++
+			return hookErr
+		}
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		state, err := New(instance, WithInitHooks(hook)).ExecuteRunners(ctx, runners)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(BeEquivalentTo("initialize context: mock init error"))
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateInitializing))
+		Expect(instance.Status.Steps).Should(BeEmpty())
+
+		hookErr = nil
+		state, err = New(instance, WithInitHooks(hook)).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(times).Should(BeEquivalentTo(2))
+		wfCtx, err := wfContext.LoadContext(ctx, instance.Namespace, instance.Name, instance.Status.ContextBackend.Name)
+		Expect(err).ToNot(HaveOccurred())
+		v, err := wfCtx.GetVar("endpoint")
+		Expect(err).ToNot(HaveOccurred())
+		endpoint, err := v.String()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(endpoint).Should(BeEquivalentTo("http://mock"))
+
+		_, err = New(instance, WithInitHooks(hook)).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(times).Should(BeEquivalentTo(2))
+	})
+
+	It("step commit data without success", func() {
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s1",
+					Type: "wait-with-set-var",
+				},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name: "s2",
+					Type: "success",
+				},
+			},
+		})
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		wf := New(instance)
+		state, err := wf.ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseRunning))
+		wfCtx, err := wfContext.LoadContext(ctx, instance.Namespace, instance.Name, instance.Status.ContextBackend.Name)
+		Expect(err).ToNot(HaveOccurred())
+		v, err := wfCtx.GetVar("saved")
+		Expect(err).ToNot(HaveOccurred())
+		saved, err := v.Bool()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(saved).Should(BeEquivalentTo(true))
+	})
+
+	It("test for the shared inputs resolved once", func() {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shared-settings"},
+			Data:       map[string]string{"region": "us-east-1"},
+		}
+		Expect(k8sClient.Create(context.Background(), cm)).Should(Succeed())
+		defer func() {
+			Expect(k8sClient.Delete(context.Background(), cm)).Should(Succeed())
+		}()
+		instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "wait-with-set-var"}},
+		})
+		// the context backend of the run is created with the name of the run, which must not be initialized before
+		instance.Name = "shared-app"
+		instance.Shared = []v1alpha1.SharedInput{
+			{Name: "region", ConfigMapRef: &v1alpha1.SharedInputSource{Name: "shared-settings", Key: "region"}},
+		}
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		region := func() string {
+			wfCtx, err := wfContext.LoadContext(ctx, instance.Namespace, instance.Name, instance.Status.ContextBackend.Name)
+			Expect(err).ToNot(HaveOccurred())
+			v, err := wfCtx.GetVar("shared", "region")
+			Expect(err).ToNot(HaveOccurred())
+			s, err := v.String()
+			Expect(err).ToNot(HaveOccurred())
+			return s
+		}
+		state, err := New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateExecuting))
+		Expect(region()).Should(Equal("us-east-1"))
+
+		By("the changes of the source after the initialization are not seen by the run")
+		cm.Data["region"] = "eu-west-1"
+		Expect(k8sClient.Update(context.Background(), cm)).Should(Succeed())
+		_, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(region()).Should(Equal("us-east-1"))
+
+		By("the run fails if the shared inputs can't be resolved")
+		instance, runners = makeTestCase([]v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success"}},
+		})
+		instance.Name = "shared-failed-app"
+		instance.Shared = []v1alpha1.SharedInput{
+			{Name: "zone", ConfigMapRef: &v1alpha1.SharedInputSource{Name: "shared-settings", Key: "zone"}},
+		}
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(instance.Status.Terminated).Should(BeTrue())
+		Expect(instance.Status.Steps).Should(BeEmpty())
+		Expect(instance.Status.Message).Should(Equal("The workflow fails because the shared inputs can't be resolved: shared input zone: key zone is not found in config map shared-settings"))
+	})
+
+	It("test for the failure tolerance of the fan-out group", func() {
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		run := func(name string, tolerance intstr.IntOrString, failed ...string) (*types.WorkflowInstance, v1alpha1.WorkflowRunPhase) {
+			group := v1alpha1.WorkflowStep{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "fanout", Type: "step-group"},
+				Generator: &v1alpha1.StepGenerator{
+					From:      "items",
+					Template:  v1alpha1.WorkflowStepBase{Name: "item", Type: "success"},
+					Tolerance: &tolerance,
+				},
+			}
+			next := v1alpha1.WorkflowStep{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "next", Type: "success"}}
+			instance, _ := makeTestCase([]v1alpha1.WorkflowStep{group, next})
+			instance.Name = name
+			instance.InitVars = map[string]interface{}{"items": []interface{}{"a", "b", "c", "d"}}
+			groupRunner, err := builtin.StepGroup(group, &types.TaskGeneratorOptions{
+				ID:             "fanout",
+				ProcessContext: process.NewContext(process.ContextData{}),
+				SubTaskGenerator: func(step v1alpha1.WorkflowStepBase, id string) (types.TaskRunner, error) {
+					if slices.Contains(failed, step.Name) {
+						step.Type = "failed-after-retries"
+					}
+					return makeRunner(v1alpha1.WorkflowStep{WorkflowStepBase: step}, nil), nil
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			state, err := New(instance).ExecuteRunners(ctx, []types.TaskRunner{groupRunner, makeRunner(next, nil)})
+			Expect(err).ToNot(HaveOccurred())
+			return instance, state
+		}
+
+		By("the failures within the tolerance don't fail the group")
+		instance, state := run("tolerance-app-1", intstr.FromInt(1), "item-1")
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+		Expect(instance.Status.Steps[0].FailedSubSteps).Should(Equal(1))
+		Expect(instance.Status.Steps[0].Message).Should(Equal("1 of 4 sub steps are failed within the tolerance 1"))
+		Expect(instance.Status.Steps[0].SubStepsStatus).Should(HaveLen(4))
+		Expect(instance.Status.Steps[1].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+
+		By("the group fails once the failures exceed the tolerance")
+		instance, state = run("tolerance-app-2", intstr.FromString("25%"), "item-1", "item-2")
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateFailed))
+		Expect(instance.Status.Steps[0].Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(instance.Status.Steps[0].Reason).Should(BeEquivalentTo(types.StatusReasonFailedAfterRetries))
+		Expect(instance.Status.Steps[0].FailedSubSteps).Should(Equal(2))
+		Expect(instance.Status.Steps[0].Message).Should(Equal("2 of 4 sub steps are failed, which exceed the tolerance 25%"))
+	})
+
+	It("test for detecting the changes of the step outputs", func() {
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		run := func(name string) (v1alpha1.StepStatus, v1alpha1.WorkflowStepPhase) {
+			instance, runners := makeTestCase([]v1alpha1.WorkflowStep{
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success", DetectChanges: true, Outputs: v1alpha1.StepOutputs{{Name: "test", ValueFrom: "output"}}}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "success", If: "status.s1.changed"}},
+				{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s3", Type: "success", DetectChanges: true, Outputs: v1alpha1.StepOutputs{{Name: "test3", ValueFrom: "output"}}}},
+			})
+			instance.Name = name
+			instance.WorkflowRef = "changes"
+			_, err := New(instance).ExecuteRunners(ctx, runners)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Status.Steps[1].Metadata).Should(BeEmpty())
+			return instance.Status.Steps[0].StepStatus, instance.Status.Steps[1].Phase
+		}
+		fingerprints := func(v string) map[string]string {
+			sum := sha256.Sum256([]byte(v))
+			return map[string]string{"test": hex.EncodeToString(sum[:])}
+		}
+
+		By("the outputs are changed if there's no previous succeeded run")
+		status, phase := run("changes-app-1")
+		Expect(phase).Should(Equal(v1alpha1.WorkflowStepPhaseSucceeded))
+		Expect(status.Metadata).Should(Equal(map[string]string{types.MetadataKeyChanged: "true", types.MetadataKeyDiff: `test: <none> -> "app"`}))
+		Expect(status.OutputFingerprints).Should(Equal(fingerprints(`"app"`)))
+
+		previous := v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "changes-previous", Namespace: "default"},
+			Status: v1alpha1.WorkflowRunStatus{
+				EndTime: metav1.Now(),
+				Steps: []v1alpha1.WorkflowStepStatus{{
+					StepStatus: v1alpha1.StepStatus{Name: "s1", Phase: v1alpha1.WorkflowStepPhaseSucceeded, OutputFingerprints: fingerprints(`"app"`)},
+				}},
+			},
+		}
+		// the run created later but finished earlier is not the previous run
+		older := v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "changes-older", Namespace: "default", CreationTimestamp: metav1.Now()},
+			Status: v1alpha1.WorkflowRunStatus{
+				EndTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+				Steps: []v1alpha1.WorkflowStepStatus{{
+					StepStatus: v1alpha1.StepStatus{Name: "s1", Phase: v1alpha1.WorkflowStepPhaseSucceeded, OutputFingerprints: fingerprints(`"older"`)},
+				}},
+			},
+		}
+		cli := &runsClient{Client: k8sClient, runs: []v1alpha1.WorkflowRun{older, previous}}
+		singleton.KubeClient.Set(cli)
+		defer singleton.KubeClient.Set(k8sClient)
+
+		By("the outputs are not changed from the previous succeeded run")
+		status, phase = run("changes-app-2")
+		Expect(phase).Should(Equal(v1alpha1.WorkflowStepPhaseSkipped))
+		Expect(status.Metadata).Should(Equal(map[string]string{types.MetadataKeyChanged: "false", types.MetadataKeyDiff: ""}))
+		// the previous run is listed once for the steps in the reconcile
+		Expect(cli.lists).Should(Equal(1))
+
+		By("the outputs are changed from the previous succeeded run")
+		cli.runs[1].Status.Steps[0].OutputFingerprints = fingerprints(`"old"`)
+		status, phase = run("changes-app-3")
+		Expect(phase).Should(Equal(v1alpha1.WorkflowStepPhaseSucceeded))
+		Expect(status.Metadata).Should(Equal(map[string]string{
+			types.MetadataKeyChanged: "true",
+			types.MetadataKeyDiff:    `test: sha256:` + fingerprints(`"old"`)["test"][:12] + ` -> "app"`,
+		}))
+	})
+
+	It("test for recording the execution order", func() {
+		ctx := monitorContext.NewTraceContext(context.Background(), "test-app")
+		order := func(instance *types.WorkflowInstance) [][]string {
+			var waves [][]string
+			for _, wave := range instance.Status.ExecutionOrder {
+				Expect(wave.StartTime.IsZero()).Should(BeFalse())
+				steps := []string{wave.Parent}
+				for _, step := range wave.Steps {
+					steps = append(steps, step.Name)
+				}
+				waves = append(waves, steps)
+			}
+			return waves
+		}
+		steps := []v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s1", Type: "success"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s2", Type: "success"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "s3", Type: "step-group", DependsOn: []string{"s1"}}, SubSteps: []v1alpha1.WorkflowStepBase{
+				{Name: "s3-sub1", Type: "success"},
+				{Name: "s3-sub2", Type: "success"},
+			}},
+		}
+
+		By("the execution order is not recorded by default")
+		instance, runners := makeTestCase(steps)
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG, SubSteps: v1alpha1.WorkflowModeDAG}
+		state, err := New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(instance.Status.ExecutionOrder).Should(BeNil())
+
+		By("the steps started in the same pass are in the same wave in DAG mode")
+		instance, runners = makeTestCase(steps)
+		instance.Annotations = map[string]string{types.AnnotationRecordExecutionOrder: "true"}
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG, SubSteps: v1alpha1.WorkflowModeDAG}
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(order(instance)).Should(Equal([][]string{
+			{"", "s1", "s2"},
+			{"", "s3"},
+			{"s3", "s3-sub1", "s3-sub2"},
+		}))
+		Expect(instance.Status.ExecutionOrder[0].Steps[0].ID).Should(Equal(instance.Status.Steps[0].ID))
+
+		By("every step starts a new wave in StepByStep mode")
+		steps[2].Mode = v1alpha1.WorkflowModeStep
+		instance, runners = makeTestCase(steps)
+		instance.Annotations = map[string]string{types.AnnotationRecordExecutionOrder: "true"}
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeStep, SubSteps: v1alpha1.WorkflowModeStep}
+		state, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).Should(BeEquivalentTo(v1alpha1.WorkflowStateSucceeded))
+		Expect(order(instance)).Should(Equal([][]string{
+			{"", "s1"},
+			{"", "s2"},
+			{"", "s3"},
+			{"s3", "s3-sub1"},
+			{"s3", "s3-sub2"},
+		}))
+
+		By("the oldest waves are dropped beyond the limit")
+		defer func(max int) { types.MaxExecutionWaves = max }(types.MaxExecutionWaves)
+		types.MaxExecutionWaves = 2
+		instance, runners = makeTestCase(steps)
+		instance.Annotations = map[string]string{types.AnnotationRecordExecutionOrder: "true"}
+		instance.Mode = &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeStep, SubSteps: v1alpha1.WorkflowModeStep}
+		_, err = New(instance).ExecuteRunners(ctx, runners)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(order(instance)).Should(Equal([][]string{
+			{"s3", "s3-sub1"},
+			{"s3", "s3-sub2"},
+		}))
+	})
+})
+
+// runsClient lists the workflow runs from the items, the CRDs are not installed in the test environment
+type runsClient struct {
+	client.Client
+	runs  []v1alpha1.WorkflowRun
+	lists int
+}
+
+func (c *runsClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if runs, ok := list.(*v1alpha1.WorkflowRunList); ok {
+		c.lists++
+		runs.Items = c.runs
+		return nil
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+type fakeAuditSink struct {
+	entries []types.AuditEntry
+	err     error
+}
+
+func (s *fakeAuditSink) Record(_ context.Context, entry types.AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return s.err
+}
+
+func makeTestCase(steps []v1alpha1.WorkflowStep) (*types.WorkflowInstance, []types.TaskRunner) {
+	instance := &types.WorkflowInstance{
+		WorkflowMeta: types.WorkflowMeta{
 			ChildOwnerReferences: []metav1.OwnerReference{
 				{
 					APIVersion: v1alpha1.SchemeGroupVersion.String(),
@@ -2253,6 +3622,45 @@ func makeRunner(step v1alpha1.WorkflowStep, subTaskRunners []types.TaskRunner) t
 					Terminated: true,
 				}, nil
 		}
+	case "break":
+		run = func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
+			return v1alpha1.StepStatus{
+				Name:   step.Name,
+				Type:   "break",
+				Phase:  v1alpha1.WorkflowStepPhaseSucceeded,
+				Reason: types.StatusReasonTerminate,
+			}, &types.Operation{
+				Terminated: true,
+			}, nil
+		}
+	case "exit":
+		run = func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
+			return v1alpha1.StepStatus{
+				Name:    step.Name,
+				Type:    "exit",
+				Phase:   v1alpha1.WorkflowStepPhaseSucceeded,
+				Reason:  types.StatusReasonExit,
+				Message: "nothing to deploy",
+			}, &types.Operation{
+				Terminated: true,
+			}, nil
+		}
+	case "cancelled":
+		run = func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
+			stepCtx, cancel := providertypes.WithCancellation(options.GetTracer("id", step).GetContext())
+			defer cancel()
+			// the run is cancelled while the step is in flight, e.g. it's terminated
+			if !CancelRun("default", "app") {
+				return v1alpha1.StepStatus{}, nil, errors.New("the run is not executing the steps")
+			}
+			<-stepCtx.Done()
+			return v1alpha1.StepStatus{
+				Name:    step.Name,
+				Type:    "cancelled",
+				Phase:   v1alpha1.WorkflowStepPhaseFailed,
+				Message: stepCtx.Err().Error(),
+			}, &types.Operation{}, nil
+		}
 	case "success":
 		run = func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
 			v := cuecontext.New().CompileString(`"app"`)
@@ -2284,6 +3692,15 @@ func makeRunner(step v1alpha1.WorkflowStep, subTaskRunners []types.TaskRunner) t
 					FailedAfterRetries: true,
 				}, nil
 		}
+	case "excluded":
+		run = func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
+			return v1alpha1.StepStatus{
+				Name:   step.Name,
+				Type:   "excluded",
+				Phase:  v1alpha1.WorkflowStepPhaseSkipped,
+				Reason: types.StatusReasonExcluded,
+			}, &types.Operation{Skip: true}, nil
+		}
 	case "error":
 		run = func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
 			return v1alpha1.StepStatus{
@@ -2303,7 +3720,7 @@ func makeRunner(step v1alpha1.WorkflowStep, subTaskRunners []types.TaskRunner) t
 			}, &types.Operation{}, err
 		}
 	case "step-group":
-		group, _ := builtin.StepGroup(step, &types.TaskGeneratorOptions{SubTaskRunners: subTaskRunners, ProcessContext: process.NewContext(process.ContextData{})})
+		group, _ := builtin.StepGroup(step, &types.TaskGeneratorOptions{SubTaskRunners: subTaskRunners, SubStepExecuteMode: step.Mode, ProcessContext: process.NewContext(process.ContextData{})})
 		run = group.Run
 	case "running":
 		run = func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
@@ -2353,6 +3770,18 @@ func makeRunner(step v1alpha1.WorkflowStep, subTaskRunners []types.TaskRunner) t
 	}
 }
 
+// slowTaskRunner is the task runner that takes the duration of the clock to run
+type slowTaskRunner struct {
+	types.TaskRunner
+	clock    *clocktesting.FakeClock
+	duration time.Duration
+}
+
+func (tr *slowTaskRunner) Run(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
+	tr.clock.Step(tr.duration)
+	return tr.TaskRunner.Run(ctx, options)
+}
+
 type testTaskRunner struct {
 	step         v1alpha1.WorkflowStep
 	run          func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error)
@@ -2445,3 +3874,41 @@ metadata:
   name: app-v1
   namespace: default
 `
+
+type renderedTaskRunner struct {
+	types.TaskRunner
+	templates []cue.Value
+}
+
+func (tr *renderedTaskRunner) RenderTemplates(_ monitorContext.Context, _ wfContext.Context) []cue.Value {
+	return tr.templates
+}
+
+type reviewClient struct {
+	client.Client
+	allowed bool
+	reviews int
+}
+
+func (c *reviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if review, ok := obj.(*authorizationv1.SelfSubjectAccessReview); ok {
+		c.reviews++
+		review.Status.Allowed = c.allowed
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *reviewClient) RESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	return mapper
+}
+
+type failedPatchClient struct {
+	client.Client
+}
+
+func (c *failedPatchClient) Patch(_ context.Context, _ client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	return errors.New("context backend is unavailable")
+}
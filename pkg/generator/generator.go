@@ -20,8 +20,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -34,9 +39,11 @@ import (
 	"github.com/kubevela/workflow/pkg/monitor/metrics"
 
 	"github.com/kubevela/workflow/pkg/providers"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/tasks"
 	"github.com/kubevela/workflow/pkg/tasks/template"
 	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
 )
 
 // GenerateRunners generates task runners
@@ -48,18 +55,26 @@ func GenerateRunners(ctx monitorContext.Context, instance *types.WorkflowInstanc
 	defer subCtx.Commit("finish generate task runners")
 	options = initStepGeneratorOptions(ctx, instance, options)
 	taskDiscover := tasks.NewTaskDiscover(ctx, options)
+	overrides, err := resolveSteps(ctx, instance, taskDiscover)
+	if err != nil {
+		return nil, err
+	}
 	var tasks []types.TaskRunner
+	dependents := stepDependents(instance.Steps)
+	locks := newLockHolders(instance.Steps, instance.Status)
 	for _, step := range instance.Steps {
 		opt := &types.TaskGeneratorOptions{
 			ID:             generateStepID(instance.Status, step.Name),
 			ProcessContext: options.ProcessCtx,
+			Dependents:     dependents[step.Name],
+			LockPeers:      locks.peers(step.Lock, step.Name),
 		}
 		for typ, convertor := range options.StepConvertor {
 			if step.Type == typ {
 				opt.StepConvertor = convertor
 			}
 		}
-		task, err := generateTaskRunner(ctx, instance, step, taskDiscover, opt, options)
+		task, err := generateTaskRunner(ctx, instance, step, taskDiscover, opt, options, overrides, locks)
 		if err != nil {
 			return nil, err
 		}
@@ -68,27 +83,93 @@ func GenerateRunners(ctx monitorContext.Context, instance *types.WorkflowInstanc
 	return tasks, nil
 }
 
+// resolveSteps renders the steps of the instance and resolves the overrides of the steps by the annotations and
+// the step selectors of the run
+func resolveSteps(ctx monitorContext.Context, instance *types.WorkflowInstance, taskDiscover types.TaskDiscover) (map[string]types.StepOverride, error) {
+	steps, err := renderSteps(ctx, instance, taskDiscover)
+	if err != nil {
+		return nil, err
+	}
+	if len(instance.Finalizers) > 0 {
+		// the finalizer steps keep their positions after rendering
+		finalizers := make(map[string]types.FinalizerKind, len(instance.Finalizers))
+		for i, step := range instance.Steps {
+			if kind, ok := instance.Finalizers[step.Name]; ok {
+				finalizers[steps[i].Name] = kind
+			}
+		}
+		instance.Finalizers = finalizers
+	}
+	instance.Steps = steps
+	overrides, err := parseStepOverrides(instance)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err = parseSkipStepSelector(instance, overrides)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err = parseStepSelectors(instance, overrides)
+	if err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
 // GenerateWorkflowInstance generates a workflow instance
 func GenerateWorkflowInstance(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun) (*types.WorkflowInstance, error) {
-	var steps []v1alpha1.WorkflowStep
+	instance, override, err := newWorkflowInstance(ctx, cli, run)
+	if err != nil {
+		return nil, err
+	}
+	executor.InitializeWorkflowInstance(instance, providertypes.ClockFrom(ctx).Now())
+	if override != nil && !instance.Status.ModeOverridden {
+		// the status may be initialized before the annotation is set
+		instance.Status.Mode.Steps = override.Steps
+		if override.SubSteps != "" {
+			instance.Status.Mode.SubSteps = override.SubSteps
+		}
+		instance.Status.ModeOverridden = true
+	}
+	return instance, nil
+}
+
+// newWorkflowInstance builds the workflow instance of the run without initializing its status, the execute mode
+// overridden by the annotation is returned as well
+func newWorkflowInstance(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun) (*types.WorkflowInstance, *v1alpha1.WorkflowExecuteMode, error) {
+	var spec *v1alpha1.WorkflowSpec
+	var params []v1alpha1.WorkflowParameter
 	mode := run.Spec.Mode
 	switch {
 	case run.Spec.WorkflowSpec != nil:
-		steps = run.Spec.WorkflowSpec.Steps
+		spec = run.Spec.WorkflowSpec
 	case run.Spec.WorkflowRef != "":
 		template := new(v1alpha1.Workflow)
 		if err := cli.Get(ctx, client.ObjectKey{
 			Name:      run.Spec.WorkflowRef,
 			Namespace: run.Namespace,
 		}, template); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		steps = template.WorkflowSpec.Steps
+		spec = &template.WorkflowSpec
+		params = template.Parameters
 		if template.Mode != nil && mode == nil {
 			mode = template.Mode
 		}
 	default:
-		return nil, errors.New("failed to generate workflow instance")
+		return nil, nil, errors.New("failed to generate workflow instance")
+	}
+	steps, finalizers := appendFinalizerSteps(spec)
+
+	override, err := parseModeOverride(run)
+	if err != nil {
+		return nil, nil, err
+	}
+	if override != nil {
+		if mode != nil && override.SubSteps == "" {
+			override.SubSteps = mode.SubSteps
+		}
+		mode = override
 	}
 
 	debug := false
@@ -96,14 +177,14 @@ func GenerateWorkflowInstance(ctx context.Context, cli client.Client, run *v1alp
 		debug = true
 	}
 
-	contextData := make(map[string]interface{})
-	if run.Spec.Context != nil {
-		contextByte, err := run.Spec.Context.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(contextByte, &contextData); err != nil {
-			return nil, err
+	contextData, applied, err := runContext(run, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	var initVars map[string]interface{}
+	if run.Spec.InitVars != nil {
+		if err := json.Unmarshal(run.Spec.InitVars.Raw, &initVars); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse init vars: %w", err)
 		}
 	}
 	instance := &types.WorkflowInstance{
@@ -123,14 +204,63 @@ func GenerateWorkflowInstance(ctx context.Context, cli client.Client, run *v1alp
 				},
 			},
 		},
-		Context: contextData,
-		Debug:   debug,
-		Mode:    mode,
-		Steps:   steps,
-		Status:  run.Status,
+		Context:               contextData,
+		InitVars:              initVars,
+		Shared:                run.Spec.Shared,
+		Debug:                 debug,
+		Mode:                  mode,
+		Steps:                 steps,
+		Status:                run.Status,
+		IncludeSteps:          run.Spec.IncludeSteps,
+		ExcludeSteps:          run.Spec.ExcludeSteps,
+		FailurePolicy:         run.Spec.FailurePolicy,
+		UnknownStepTypePolicy: run.Spec.UnknownStepTypePolicy,
+		MaxRetries:            types.MaxWorkflowRunRetries,
+		Finalizers:            finalizers,
+		WorkflowRef:           run.Spec.WorkflowRef,
 	}
-	executor.InitializeWorkflowInstance(instance)
-	return instance, nil
+	if run.Spec.MaxRetries != nil {
+		instance.MaxRetries = *run.Spec.MaxRetries
+	}
+	if applied {
+		raw, err := json.Marshal(contextData)
+		if err != nil {
+			return nil, nil, err
+		}
+		instance.Status.Context = &runtime.RawExtension{Raw: raw}
+	}
+	return instance, override, nil
+}
+
+// runContext returns the context of the run with the defaults of the workflow parameters applied, and whether the
+// parameters are applied to the context that is not frozen yet. The context is frozen in the status once the parameters are applied, so the changes of
+// the parameters and the context during the run are ignored. The invalid parameters fail the run, e.g. the run is
+// created without the webhook.
+func runContext(run *v1alpha1.WorkflowRun, params []v1alpha1.WorkflowParameter) (map[string]interface{}, bool, error) {
+	raw, frozen := run.Spec.Context, run.Status.Context != nil
+	if frozen {
+		raw = run.Status.Context
+	}
+	contextData := make(map[string]interface{})
+	if raw != nil {
+		contextByte, err := raw.MarshalJSON()
+		if err != nil {
+			return nil, false, err
+		}
+		if err := json.Unmarshal(contextByte, &contextData); err != nil {
+			return nil, false, err
+		}
+		if contextData == nil {
+			contextData = make(map[string]interface{})
+		}
+	}
+	if frozen || len(params) == 0 {
+		return contextData, false, nil
+	}
+	if errs := utils.ApplyParameters(params, contextData, field.NewPath("spec", "context")); len(errs) > 0 {
+		return nil, false, fmt.Errorf("invalid parameters of the workflow: %w", errs.ToAggregate())
+	}
+	return contextData, true, nil
 }
 
 func initStepGeneratorOptions(_ monitorContext.Context, instance *types.WorkflowInstance, options types.StepGeneratorOptions) types.StepGeneratorOptions {
@@ -151,29 +281,51 @@ func generateTaskRunner(ctx context.Context,
 	step v1alpha1.WorkflowStep,
 	taskDiscover types.TaskDiscover,
 	options *types.TaskGeneratorOptions,
-	stepOptions types.StepGeneratorOptions) (types.TaskRunner, error) {
+	stepOptions types.StepGeneratorOptions,
+	overrides map[string]types.StepOverride,
+	locks lockHolders) (types.TaskRunner, error) {
 	if step.Type == types.WorkflowStepTypeStepGroup {
 		var subTaskRunners []types.TaskRunner
+		dependents := stepDependents(instance.Steps)
 		for _, subStep := range step.SubSteps {
 			workflowStep := v1alpha1.WorkflowStep{
-				WorkflowStepBase: subStep,
+				WorkflowStepBase: inheritSubStep(step, subStep),
 			}
 			o := &types.TaskGeneratorOptions{
 				ID:             generateSubStepID(instance.Status, subStep.Name, step.Name),
 				ProcessContext: options.ProcessContext,
+				Dependents:     dependents[subStep.Name],
+				LockPeers:      locks.peers(subStep.Lock, subStep.Name),
 			}
 			for typ, convertor := range stepOptions.StepConvertor {
 				if subStep.Type == typ {
 					o.StepConvertor = convertor
 				}
 			}
-			subTask, err := generateTaskRunner(ctx, instance, workflowStep, taskDiscover, o, stepOptions)
+			subTask, err := generateTaskRunner(ctx, instance, workflowStep, taskDiscover, o, stepOptions, overrides, locks)
 			if err != nil {
 				return nil, err
 			}
 			subTaskRunners = append(subTaskRunners, subTask)
 		}
 		options.SubTaskRunners = subTaskRunners
+		if step.Generator != nil {
+			options.SubTaskGenerator = func(subStep v1alpha1.WorkflowStepBase, id string) (types.TaskRunner, error) {
+				// the generated sub step holds the lock of the template, the other steps see it once it's generated
+				locks.add(subStep.Lock, subStep.Name)
+				o := &types.TaskGeneratorOptions{
+					ID:             id,
+					ProcessContext: options.ProcessContext,
+					LockPeers:      locks.peers(subStep.Lock, subStep.Name),
+				}
+				for typ, convertor := range stepOptions.StepConvertor {
+					if subStep.Type == typ {
+						o.StepConvertor = convertor
+					}
+				}
+				return generateTaskRunner(ctx, instance, v1alpha1.WorkflowStep{WorkflowStepBase: inheritSubStep(step, subStep)}, taskDiscover, o, stepOptions, overrides, locks)
+			}
+		}
 		options.SubStepExecuteMode = v1alpha1.WorkflowModeDAG
 		if instance.Mode != nil {
 			options.SubStepExecuteMode = instance.Mode.SubSteps
@@ -183,14 +335,21 @@ func generateTaskRunner(ctx context.Context,
 		}
 	}
 
+	var task types.TaskRunner
 	genTask, err := taskDiscover.GetTaskGenerator(ctx, step.Type)
-	if err != nil {
+	switch {
+	case types.IsUnknownStepType(err):
+		task = &unknownTypeTaskRunner{id: options.ID, step: step, policy: instance.UnknownStepTypePolicy, err: err}
+	case err != nil:
 		return nil, err
+	default:
+		task, err = genTask(step, options)
+		if err != nil {
+			return nil, err
+		}
 	}
-
-	task, err := genTask(step, options)
-	if err != nil {
-		return nil, err
+	if override, ok := overrides[step.Name]; ok {
+		return &overrideTaskRunner{TaskRunner: task, id: options.ID, step: step, override: override}, nil
 	}
 	return task, nil
 }
@@ -221,9 +380,169 @@ func generateSubStepID(status v1alpha1.WorkflowRunStatus, name, parentStepName s
 
 func generateContextDataFromWorkflowRun(instance *types.WorkflowInstance) process.ContextData {
 	data := process.ContextData{
-		Name:       instance.Name,
-		Namespace:  instance.Namespace,
-		CustomData: instance.Context,
+		Name:        instance.Name,
+		Namespace:   instance.Namespace,
+		Labels:      map[string]string{},
+		Annotations: map[string]string{},
+		CustomData:  instance.Context,
+	}
+	if metadata := instance.Status.Metadata; metadata != nil {
+		if metadata.Labels != nil {
+			data.Labels = metadata.Labels
+		}
+		if metadata.Annotations != nil {
+			data.Annotations = metadata.Annotations
+		}
 	}
 	return data
 }
+
+// appendFinalizerSteps appends the finalizer steps after the main steps, the finalizer steps depend on all the
+// main steps so that they are executed once the main steps are finished.
+func appendFinalizerSteps(spec *v1alpha1.WorkflowSpec) ([]v1alpha1.WorkflowStep, map[string]types.FinalizerKind) {
+	if len(spec.OnComplete)+len(spec.OnSuccess)+len(spec.OnFailure) == 0 {
+		return spec.Steps, nil
+	}
+	mainSteps := make([]string, 0, len(spec.Steps))
+	for _, step := range spec.Steps {
+		mainSteps = append(mainSteps, step.Name)
+	}
+	steps := append([]v1alpha1.WorkflowStep{}, spec.Steps...)
+	finalizers := make(map[string]types.FinalizerKind)
+	for _, group := range []struct {
+		kind  types.FinalizerKind
+		steps []v1alpha1.WorkflowStep
+	}{
+		{kind: types.FinalizerOnComplete, steps: spec.OnComplete},
+		{kind: types.FinalizerOnSuccess, steps: spec.OnSuccess},
+		{kind: types.FinalizerOnFailure, steps: spec.OnFailure},
+	} {
+		for _, step := range group.steps {
+			finalizer := step.DeepCopy()
+			finalizer.DependsOn = append(finalizer.DependsOn, mainSteps...)
+			steps = append(steps, *finalizer)
+			finalizers[finalizer.Name] = group.kind
+		}
+	}
+	return steps, finalizers
+}
+
+// stepDependents returns the names of the steps that depend on each step, a step depends on another one if it
+// refers to the step in dependsOn or dependsOnCondition, or takes the outputs of the step as inputs that are not lazy
+func stepDependents(steps []v1alpha1.WorkflowStep) map[string][]string {
+	var all []v1alpha1.WorkflowStepBase
+	for _, step := range steps {
+		all = append(all, step.WorkflowStepBase)
+		all = append(all, step.SubSteps...)
+	}
+	producers := make(map[string]string)
+	for _, step := range all {
+		for _, output := range step.Outputs {
+			producers[output.Name] = step.Name
+		}
+	}
+	// the step group produces the aggregated outputs of its sub steps, e.g. `group.results`
+	for _, step := range steps {
+		if len(step.SubSteps) > 0 || step.Generator != nil {
+			producers[step.Name] = step.Name
+		}
+	}
+	generators := make(map[string]string)
+	for _, step := range steps {
+		if step.Generator != nil {
+			generators[step.Name] = step.Generator.From
+		}
+	}
+	dependents := make(map[string][]string)
+	for _, step := range all {
+		deps := append([]string{}, step.DependsOn...)
+		deps = append(deps, step.DependsOnCondition.StepNames()...)
+		froms := make([]string, 0, len(step.Inputs)+1)
+		for _, input := range step.Inputs {
+			// the lazy input doesn't order the step after its producer
+			if !input.Lazy {
+				froms = append(froms, input.From)
+			}
+		}
+		// the step group with the generator takes the output array to generate its sub steps
+		if from, ok := generators[step.Name]; ok {
+			froms = append(froms, from)
+		}
+		for _, from := range froms {
+			if producer, ok := producers[strings.Split(from, ".")[0]]; ok {
+				deps = append(deps, producer)
+			}
+		}
+		for _, dep := range deps {
+			if dep != step.Name && !slices.Contains(dependents[dep], step.Name) {
+				dependents[dep] = append(dependents[dep], step.Name)
+			}
+		}
+	}
+	return dependents
+}
+
+// lockHolders is the names of the steps that declare each lock, including the sub steps. The sub steps generated
+// by the step groups are added once they're generated, so the lock peers are resolved when the steps are checked.
+type lockHolders map[string][]string
+
+// newLockHolders collects the steps that declare the locks, the sub steps generated in the previous executions
+// are found in the status of their step groups
+func newLockHolders(steps []v1alpha1.WorkflowStep, status v1alpha1.WorkflowRunStatus) lockHolders {
+	holders := make(lockHolders)
+	for _, step := range steps {
+		for _, s := range append([]v1alpha1.WorkflowStepBase{step.WorkflowStepBase}, step.SubSteps...) {
+			holders.add(s.Lock, s.Name)
+		}
+		if step.Generator == nil || step.Generator.Template.Lock == "" {
+			continue
+		}
+		for _, ss := range status.Steps {
+			if ss.Name != step.Name {
+				continue
+			}
+			for _, sub := range ss.SubStepsStatus {
+				holders.add(step.Generator.Template.Lock, sub.Name)
+			}
+		}
+	}
+	return holders
+}
+
+// add adds the step as a holder of the lock
+func (h lockHolders) add(lock, name string) {
+	if lock == "" {
+		return
+	}
+	for _, holder := range h[lock] {
+		if holder == name {
+			return
+		}
+	}
+	h[lock] = append(h[lock], name)
+}
+
+// peers returns the func that resolves the names of the other steps that declare the same lock as the step
+func (h lockHolders) peers(lock, name string) func() []string {
+	if lock == "" {
+		return nil
+	}
+	return func() []string {
+		var peers []string
+		for _, holder := range h[lock] {
+			if holder != name {
+				peers = append(peers, holder)
+			}
+		}
+		return peers
+	}
+}
+
+// inheritSubStep fills the fields of the sub step that are inherited from the step group, e.g. the cluster,
+// the fields set in the sub step take precedence
+func inheritSubStep(group v1alpha1.WorkflowStep, sub v1alpha1.WorkflowStepBase) v1alpha1.WorkflowStepBase {
+	if sub.Cluster == "" {
+		sub.Cluster = group.Cluster
+	}
+	return sub
+}
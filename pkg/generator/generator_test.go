@@ -24,11 +24,15 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	monitorContext "github.com/kubevela/pkg/monitor/context"
 
 	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/types"
 )
 
@@ -133,4 +137,768 @@ var _ = Describe("Test workflow step runner generator", func() {
 		Expect(len(runners)).Should(BeEquivalentTo(1))
 		Expect(runners[0].Name()).Should(BeEquivalentTo("step-1"))
 	})
+	It("Test generate workflow step runners with step overrides", func() {
+		wr := &v1alpha1.WorkflowRun{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "WorkflowRun",
+				APIVersion: "core.oam.dev/v1alpha1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wr-overrides",
+				Namespace: namespaceName,
+				Annotations: map[string]string{
+					types.AnnotationStepOverrides: `{"step-1":{"phase":"succeeded","message":"mocked","outputs":{"endpoint":"http://mock"}}}`,
+				},
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name: "step-1",
+								Type: "suspend",
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name: "step-2",
+								Type: "suspend",
+							},
+						},
+					},
+				},
+			},
+		}
+		ctx := monitorContext.NewTraceContext(ctx, "test-wr-overrides")
+		instance, err := GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).Should(BeNil())
+		runners, err := GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+		Expect(len(runners)).Should(BeEquivalentTo(2))
+		_, ok := runners[0].(*overrideTaskRunner)
+		Expect(ok).Should(BeTrue())
+		_, ok = runners[1].(*overrideTaskRunner)
+		Expect(ok).Should(BeFalse())
+
+		wfCtx, err := wfContext.NewContext(ctx, namespaceName, wr.Name, nil)
+		Expect(err).Should(BeNil())
+		status, operation, err := runners[0].Run(wfCtx, &types.TaskRunOptions{})
+		Expect(err).Should(BeNil())
+		Expect(status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+		Expect(status.Reason).Should(BeEquivalentTo(types.StatusReasonOverridden))
+		Expect(status.Message).Should(BeEquivalentTo("mocked"))
+		Expect(operation.FailedAfterRetries).Should(BeFalse())
+		v, err := wfCtx.GetVar("endpoint")
+		Expect(err).Should(BeNil())
+		endpoint, err := v.String()
+		Expect(err).Should(BeNil())
+		Expect(endpoint).Should(BeEquivalentTo("http://mock"))
+
+		By("Test invalid overridden phase")
+		instance.Annotations = map[string]string{
+			types.AnnotationStepOverrides: `{"step-1":{"phase":"running"}}`,
+		}
+		_, err = GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("Test generate workflow step runners with skip step selector", func() {
+		wr := &v1alpha1.WorkflowRun{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "WorkflowRun",
+				APIVersion: "core.oam.dev/v1alpha1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wr-skip-selector",
+				Namespace: namespaceName,
+				Annotations: map[string]string{
+					types.AnnotationSkipStepSelector: "tier=app",
+					types.AnnotationStepOverrides:    `{"step-2":{"phase":"succeeded"}}`,
+				},
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:   "step-1",
+								Type:   "suspend",
+								Labels: map[string]string{"tier": "app"},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:   "step-2",
+								Type:   "suspend",
+								Labels: map[string]string{"tier": "app"},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:   "step-3",
+								Type:   "suspend",
+								Labels: map[string]string{"tier": "infra"},
+							},
+						},
+					},
+				},
+			},
+		}
+		ctx := monitorContext.NewTraceContext(ctx, "test-wr-skip-selector")
+		instance, err := GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).Should(BeNil())
+		runners, err := GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+		Expect(len(runners)).Should(BeEquivalentTo(3))
+		_, ok := runners[2].(*overrideTaskRunner)
+		Expect(ok).Should(BeFalse())
+
+		wfCtx, err := wfContext.NewContext(ctx, namespaceName, wr.Name, nil)
+		Expect(err).Should(BeNil())
+		status, operation, err := runners[0].Run(wfCtx, &types.TaskRunOptions{})
+		Expect(err).Should(BeNil())
+		Expect(status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSkipped))
+		Expect(operation.Skip).Should(BeTrue())
+		status, _, err = runners[1].Run(wfCtx, &types.TaskRunOptions{})
+		Expect(err).Should(BeNil())
+		Expect(status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSucceeded))
+
+		By("Test multiple skip step selectors")
+		instance.Annotations = map[string]string{
+			types.AnnotationSkipStepSelector: "tier=app;tier=infra",
+		}
+		runners, err = GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+		for _, runner := range runners {
+			status, _, err = runner.Run(wfCtx, &types.TaskRunOptions{})
+			Expect(err).Should(BeNil())
+			Expect(status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSkipped))
+		}
+
+		By("Test invalid skip step selector")
+		instance.Annotations = map[string]string{
+			types.AnnotationSkipStepSelector: "tier in app",
+		}
+		_, err = GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("Test generate workflow step runners with include and exclude steps", func() {
+		wr := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wr-step-selectors",
+				Namespace: namespaceName,
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				IncludeSteps: &v1alpha1.StepSelector{
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "app"}},
+				},
+				ExcludeSteps: &v1alpha1.StepSelector{Names: []string{"step-2"}},
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:   "step-1",
+								Type:   "suspend",
+								Labels: map[string]string{"tier": "app"},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:    "step-2",
+								Type:    "suspend",
+								Labels:  map[string]string{"tier": "app"},
+								Outputs: v1alpha1.StepOutputs{{Name: "version", ValueFrom: "parameter.version"}},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name: "step-3",
+								Type: "step-group",
+							},
+							SubSteps: []v1alpha1.WorkflowStepBase{
+								{Name: "sub-1", Type: "suspend", Labels: map[string]string{"tier": "app"}},
+								{Name: "sub-2", Type: "suspend"},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name: "step-4",
+								Type: "suspend",
+							},
+						},
+					},
+				},
+			},
+		}
+		ctx := monitorContext.NewTraceContext(ctx, "test-wr-step-selectors")
+		instance, err := GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).Should(BeNil())
+		runners, err := GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+		wfCtx, err := wfContext.NewContext(ctx, namespaceName, wr.Name, nil)
+		Expect(err).Should(BeNil())
+		for _, runner := range []types.TaskRunner{runners[1], runners[3]} {
+			status, operation, err := runner.Run(wfCtx, &types.TaskRunOptions{})
+			Expect(err).Should(BeNil())
+			Expect(status.Phase).Should(BeEquivalentTo(v1alpha1.WorkflowStepPhaseSkipped))
+			Expect(status.Reason).Should(BeEquivalentTo(types.StatusReasonExcluded))
+			Expect(operation.Skip).Should(BeTrue())
+		}
+		for _, runner := range []types.TaskRunner{runners[0], runners[2]} {
+			_, ok := runner.(*overrideTaskRunner)
+			Expect(ok).Should(BeFalse())
+		}
+
+		By("Test the input requires the output of the excluded step")
+		instance.Steps[2].SubSteps[0].Inputs = v1alpha1.StepInputs{{From: "version", ParameterKey: "version"}}
+		_, err = GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(Equal("the input version of step sub-1 requires the output of the excluded step step-2"))
+
+		By("Test the selected step is not found")
+		instance.Steps[2].SubSteps[0].Inputs = nil
+		instance.ExcludeSteps = &v1alpha1.StepSelector{Names: []string{"not-found"}}
+		_, err = GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(Equal("the selected step not-found is not found"))
+	})
+
+	It("Test generate workflow instance with mode override", func() {
+		wr := &v1alpha1.WorkflowRun{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "WorkflowRun",
+				APIVersion: "core.oam.dev/v1alpha1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wr-mode-override",
+				Namespace: namespaceName,
+				Annotations: map[string]string{
+					types.AnnotationModeOverride: "DAG",
+				},
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				Mode: &v1alpha1.WorkflowExecuteMode{
+					Steps:    v1alpha1.WorkflowModeStep,
+					SubSteps: v1alpha1.WorkflowModeStep,
+				},
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name: "step-1",
+								Type: "suspend",
+							},
+						},
+					},
+				},
+			},
+		}
+		instance, err := GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).Should(BeNil())
+		Expect(instance.Status.ModeOverridden).Should(BeTrue())
+		Expect(instance.Status.Mode).Should(BeEquivalentTo(v1alpha1.WorkflowExecuteMode{
+			Steps:    v1alpha1.WorkflowModeDAG,
+			SubSteps: v1alpha1.WorkflowModeStep,
+		}))
+
+		By("Test the overridden mode is kept after the run starts executing steps")
+		wr.Status = instance.Status
+		wr.Status.Steps = []v1alpha1.WorkflowStepStatus{{StepStatus: v1alpha1.StepStatus{Name: "step-1"}}}
+		wr.Annotations[types.AnnotationModeOverride] = "StepByStep,DAG"
+		instance, err = GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).Should(BeNil())
+		Expect(instance.Mode.Steps).Should(BeEquivalentTo(v1alpha1.WorkflowModeDAG))
+		Expect(instance.Status.Mode.Steps).Should(BeEquivalentTo(v1alpha1.WorkflowModeDAG))
+
+		By("Test the annotation is ignored after the run starts executing steps")
+		wr.Status.ModeOverridden = false
+		wr.Status.Mode = *wr.Spec.Mode
+		instance, err = GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).Should(BeNil())
+		Expect(instance.Status.ModeOverridden).Should(BeFalse())
+		Expect(instance.Status.Mode.Steps).Should(BeEquivalentTo(v1alpha1.WorkflowModeStep))
+
+		By("Test invalid mode override")
+		wr.Status = v1alpha1.WorkflowRunStatus{}
+		wr.Annotations[types.AnnotationModeOverride] = "Parallel"
+		_, err = GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).ShouldNot(BeNil())
+		wr.Annotations[types.AnnotationModeOverride] = "DAG,DAG,DAG"
+		_, err = GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("Test generate workflow instance with parameters", func() {
+		template := &v1alpha1.Workflow{
+			ObjectMeta: metav1.ObjectMeta{Name: "wf-parameters", Namespace: namespaceName},
+			WorkflowSpec: v1alpha1.WorkflowSpec{
+				Steps: []v1alpha1.WorkflowStep{{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step-1", Type: "suspend"}}},
+			},
+			Parameters: []v1alpha1.WorkflowParameter{
+				{Name: "env", Type: v1alpha1.ParameterTypeString, Default: &apiextensionsv1.JSON{Raw: []byte(`"dev"`)}},
+				{Name: "replicas", Type: v1alpha1.ParameterTypeInteger, Required: true},
+			},
+		}
+		// the workflows are not installed in the test environment
+		workflowScheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(workflowScheme)).Should(BeNil())
+		cli := fake.NewClientBuilder().WithScheme(workflowScheme).WithObjects(template).Build()
+		wr := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "wr-parameters", Namespace: namespaceName},
+			Spec: v1alpha1.WorkflowRunSpec{
+				WorkflowRef: "wf-parameters",
+				Context:     &runtime.RawExtension{Raw: []byte(`{"replicas":2}`)},
+			},
+		}
+		instance, err := GenerateWorkflowInstance(ctx, cli, wr)
+		Expect(err).Should(BeNil())
+		Expect(instance.Context).Should(BeEquivalentTo(map[string]interface{}{"env": "dev", "replicas": float64(2)}))
+		Expect(string(instance.Status.Context.Raw)).Should(MatchJSON(`{"env":"dev","replicas":2}`))
+
+		By("Test the applied context is frozen once the run is initialized")
+		wr.Status = instance.Status
+		template.Parameters[0].Default = &apiextensionsv1.JSON{Raw: []byte(`"prod"`)}
+		Expect(cli.Update(ctx, template)).Should(BeNil())
+		wr.Spec.Context = &runtime.RawExtension{Raw: []byte(`{"replicas":3}`)}
+		instance, err = GenerateWorkflowInstance(ctx, cli, wr)
+		Expect(err).Should(BeNil())
+		Expect(instance.Context).Should(BeEquivalentTo(map[string]interface{}{"env": "dev", "replicas": float64(2)}))
+
+		By("Test the invalid parameters fail the run")
+		wr.Status = v1alpha1.WorkflowRunStatus{}
+		wr.Spec.Context = &runtime.RawExtension{Raw: []byte(`{"replicas":"two"}`)}
+		_, err = GenerateWorkflowInstance(ctx, cli, wr)
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring("invalid parameters of the workflow"))
+		Expect(err.Error()).Should(ContainSubstring("spec.context.replicas"))
+	})
+
+	It("Test generate workflow step runners with templated steps", func() {
+		wr := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wr-templated",
+				Namespace: namespaceName,
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				Context: &runtime.RawExtension{Raw: []byte(`{"env":"prod"}`)},
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:       "deploy-\\(context.env)",
+								Type:       "\\(parameter.kind)",
+								Properties: &runtime.RawExtension{Raw: []byte(`{"kind":"suspend"}`)},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name: "group-\\(context.name)",
+								Type: "step-group",
+							},
+							SubSteps: []v1alpha1.WorkflowStepBase{
+								{
+									Name:      "notify-\\(context.env)",
+									Type:      "suspend",
+									DependsOn: []string{"deploy-\\(context.env)"},
+								},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:       "join",
+								Type:       "suspend",
+								DependsOn:  []string{`\([for e in parameter.envs {"deploy-\(e)"}])`, "group-\\(context.name)"},
+								Properties: &runtime.RawExtension{Raw: []byte(`{"envs":["prod"]}`)},
+							},
+						},
+					},
+				},
+			},
+		}
+		ctx := monitorContext.NewTraceContext(ctx, "test-wr-templated")
+		generate := func() (*types.WorkflowInstance, []types.TaskRunner, error) {
+			instance, err := GenerateWorkflowInstance(ctx, k8sClient, wr)
+			Expect(err).Should(BeNil())
+			runners, err := GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+			return instance, runners, err
+		}
+		instance, runners, err := generate()
+		Expect(err).Should(BeNil())
+		Expect(len(runners)).Should(BeEquivalentTo(3))
+		Expect(runners[0].Name()).Should(BeEquivalentTo("deploy-prod"))
+		Expect(runners[1].Name()).Should(BeEquivalentTo("group-wr-templated"))
+		Expect(instance.Steps[0].Type).Should(BeEquivalentTo("suspend"))
+		Expect(instance.Steps[1].SubSteps[0].Name).Should(BeEquivalentTo("notify-prod"))
+		Expect(instance.Steps[1].SubSteps[0].DependsOn).Should(BeEquivalentTo([]string{"deploy-prod"}))
+		Expect(instance.Steps[2].DependsOn).Should(BeEquivalentTo([]string{"deploy-prod", "group-wr-templated"}))
+		Expect(wr.Spec.WorkflowSpec.Steps[0].Name).Should(BeEquivalentTo("deploy-\\(context.env)"))
+
+		By("Test the rendered dependencies must be steps")
+		wr.Spec.WorkflowSpec.Steps[2].Properties = &runtime.RawExtension{Raw: []byte(`{"envs":["prod","staging"]}`)}
+		_, _, err = generate()
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring("the rendered dependency deploy-staging of step join is not a step"))
+
+		By("Test the dependsOn must be resolved to the step names")
+		wr.Spec.WorkflowSpec.Steps[2].Properties = &runtime.RawExtension{Raw: []byte(`{"envs":"prod"}`)}
+		_, _, err = generate()
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring("render the dependsOn"))
+		wr.Spec.WorkflowSpec.Steps[2].Properties = &runtime.RawExtension{Raw: []byte(`{"envs":["prod"]}`)}
+
+		By("Test the rendered names must be unique")
+		wr.Spec.WorkflowSpec.Steps[1].SubSteps[0].Name = "deploy-\\(context.env)"
+		_, _, err = generate()
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring("duplicated step name deploy-prod after rendering"))
+
+		By("Test the rendered names must be valid")
+		wr.Spec.WorkflowSpec.Steps[1].SubSteps[0].Name = "notify \\(context.env)"
+		_, _, err = generate()
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring(`invalid rendered name "notify prod"`))
+
+		By("Test the rendered type must be known")
+		wr.Spec.WorkflowSpec.Steps[1].SubSteps[0].Name = "notify-\\(context.env)"
+		wr.Spec.WorkflowSpec.Steps[0].Properties = &runtime.RawExtension{Raw: []byte(`{"kind":"not-exist"}`)}
+		_, _, err = generate()
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring(`unknown rendered type "not-exist" of step deploy-\(context.env)`))
+
+		By("Test the reference must be resolved")
+		wr.Spec.WorkflowSpec.Steps[0].Properties = nil
+		_, _, err = generate()
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring("render the type"))
+	})
+
+	It("Test generate workflow instance with finalizer steps", func() {
+		wr := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wr-finalizers",
+				Namespace: namespaceName,
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step-1", Type: "suspend"}},
+						{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step-2", Type: "suspend"}},
+					},
+					OnComplete: []v1alpha1.WorkflowStep{
+						{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "done", Type: "suspend"}},
+					},
+					OnFailure: []v1alpha1.WorkflowStep{
+						{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "cleanup", Type: "suspend"}},
+					},
+				},
+			},
+		}
+		instance, err := GenerateWorkflowInstance(ctx, k8sClient, wr)
+		Expect(err).Should(BeNil())
+		Expect(instance.Steps).Should(HaveLen(4))
+		Expect(instance.Steps[2].Name).Should(Equal("done"))
+		Expect(instance.Steps[2].DependsOn).Should(Equal([]string{"step-1", "step-2"}))
+		Expect(instance.Steps[3].Name).Should(Equal("cleanup"))
+		Expect(instance.Steps[3].DependsOn).Should(Equal([]string{"step-1", "step-2"}))
+		Expect(instance.Finalizers).Should(Equal(map[string]types.FinalizerKind{
+			"done":    types.FinalizerOnComplete,
+			"cleanup": types.FinalizerOnFailure,
+		}))
+		Expect(wr.Spec.WorkflowSpec.OnComplete[0].DependsOn).Should(BeEmpty())
+		ctx := monitorContext.NewTraceContext(ctx, "test-wr")
+		runners, err := GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+		Expect(runners).Should(HaveLen(4))
+	})
+
+	It("Test step dependents", func() {
+		steps := []v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:    "build",
+				Type:    "suspend",
+				Outputs: v1alpha1.StepOutputs{{Name: "image", ValueFrom: "output.image"}},
+			}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:      "deploy",
+				Type:      "suspend",
+				DependsOn: []string{"build"},
+				Inputs:    v1alpha1.StepInputs{{From: "image.tag", ParameterKey: "image"}},
+			}},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name:      "verify",
+					Type:      "step-group",
+					DependsOn: []string{"deploy"},
+				},
+				SubSteps: []v1alpha1.WorkflowStepBase{
+					{Name: "check", Type: "suspend"},
+					{Name: "report", Type: "suspend", DependsOn: []string{"check"}},
+				},
+			},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name: "cleanup",
+				Type: "suspend",
+				DependsOnCondition: &v1alpha1.DependsOnCondition{AnyOf: []v1alpha1.DependsOnCondition{
+					{Step: "deploy", IgnoreFailure: true},
+					{Step: "verify"},
+				}},
+			}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:   "summary",
+				Type:   "suspend",
+				Inputs: v1alpha1.StepInputs{{From: "verify.results", ParameterKey: "results"}},
+			}},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "rebuild", Type: "step-group"},
+				Generator: &v1alpha1.StepGenerator{
+					From:     "image.tags",
+					Template: v1alpha1.WorkflowStepBase{Name: "push", Type: "suspend"},
+				},
+			},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:   "notify",
+				Type:   "suspend",
+				Inputs: v1alpha1.StepInputs{{From: "rebuild.results", ParameterKey: "results"}},
+			}},
+		}
+		Expect(stepDependents(steps)).Should(Equal(map[string][]string{
+			"build":   {"deploy", "rebuild"},
+			"deploy":  {"verify", "cleanup"},
+			"check":   {"report"},
+			"verify":  {"cleanup", "summary"},
+			"rebuild": {"notify"},
+		}))
+	})
+
+	It("Test sub steps inherit the cluster of step group", func() {
+		group := v1alpha1.WorkflowStep{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "group", Type: "step-group", Cluster: "cluster-a"},
+		}
+		Expect(inheritSubStep(group, v1alpha1.WorkflowStepBase{Name: "sub1", Type: "suspend"}).Cluster).Should(Equal("cluster-a"))
+		Expect(inheritSubStep(group, v1alpha1.WorkflowStepBase{Name: "sub2", Type: "suspend", Cluster: "cluster-b"}).Cluster).Should(Equal("cluster-b"))
+		group.Cluster = ""
+		Expect(inheritSubStep(group, v1alpha1.WorkflowStepBase{Name: "sub3", Type: "suspend"}).Cluster).Should(BeEmpty())
+	})
+
+	It("Test lock peers of steps", func() {
+		steps := []v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step1", Type: "suspend", Lock: "db"}},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step2", Type: "suspend", Lock: "cache"}},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "group", Type: "step-group"},
+				SubSteps: []v1alpha1.WorkflowStepBase{
+					{Name: "sub1", Type: "suspend", Lock: "db"},
+					{Name: "sub2", Type: "suspend"},
+				},
+			},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step3", Type: "suspend", Lock: "db"}},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "fixes", Type: "step-group"},
+				Generator: &v1alpha1.StepGenerator{
+					From:     "items",
+					Template: v1alpha1.WorkflowStepBase{Name: "fix", Type: "suspend", Lock: "db"},
+				},
+			},
+		}
+		status := v1alpha1.WorkflowRunStatus{
+			Steps: []v1alpha1.WorkflowStepStatus{
+				{
+					StepStatus:     v1alpha1.StepStatus{Name: "fixes"},
+					SubStepsStatus: []v1alpha1.StepStatus{{Name: "fix-0"}},
+				},
+			},
+		}
+		locks := newLockHolders(steps, status)
+		Expect(locks.peers("db", "step1")()).Should(Equal([]string{"sub1", "step3", "fix-0"}))
+		Expect(locks.peers("db", "sub1")()).Should(Equal([]string{"step1", "step3", "fix-0"}))
+		Expect(locks.peers("cache", "step2")()).Should(BeNil())
+		Expect(locks.peers("", "sub2")).Should(BeNil())
+
+		By("the generated sub steps are the peers once they're generated")
+		peers := locks.peers("db", "step3")
+		locks.add("db", "fix-1")
+		locks.add("db", "fix-0")
+		Expect(peers()).Should(Equal([]string{"step1", "sub1", "fix-0", "fix-1"}))
+		Expect(locks.peers("db", "fix-1")()).Should(Equal([]string{"step1", "sub1", "step3", "fix-0"}))
+	})
+
+	It("Test plan workflowrun", func() {
+		wr := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wr-plan",
+				Namespace: namespaceName,
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				Context:      &runtime.RawExtension{Raw: []byte(`{"env":"prod"}`)},
+				Mode:         &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG},
+				ExcludeSteps: &v1alpha1.StepSelector{Names: []string{"step-4"}},
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:    "step-1",
+								Type:    "suspend",
+								Outputs: v1alpha1.StepOutputs{{Name: "version", ValueFrom: "parameter.version"}},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:   "deploy-\\(context.env)",
+								Type:   "step-group",
+								Inputs: v1alpha1.StepInputs{{From: "version", ParameterKey: "version"}},
+							},
+							SubSteps: []v1alpha1.WorkflowStepBase{
+								{Name: "sub-1", Type: "suspend"},
+								{Name: "sub-2", Type: "suspend", DependsOn: []string{"sub-1"}},
+								{Name: "sub-3", Type: "suspend"},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:       "step-3",
+								Type:       "suspend",
+								Properties: &runtime.RawExtension{Raw: []byte(`{"duration":"1s"}`)},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:      "step-4",
+								Type:      "suspend",
+								DependsOn: []string{"step-3"},
+							},
+						},
+					},
+					OnComplete: []v1alpha1.WorkflowStep{
+						{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "notify", Type: "suspend"}},
+					},
+				},
+			},
+		}
+		plan, err := Plan(ctx, k8sClient, wr, types.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+		Expect(plan.Mode).Should(Equal(v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG, SubSteps: v1alpha1.WorkflowModeDAG}))
+		Expect(plan.Context).Should(Equal(map[string]interface{}{"env": "prod"}))
+		Expect(plan.String()).Should(Equal(`WorkflowRun ` + namespaceName + `/wr-plan (mode: DAG, sub steps mode: DAG)
+context: {"env":"prod"}
+├── [1] step-1 (suspend)
+├── [2] deploy-prod (step-group) after step-1
+│   sub steps mode: DAG
+│   ├── [1] sub-1 (suspend)
+│   ├── [2] sub-2 (suspend) after sub-1
+│   └── [1] sub-3 (suspend)
+├── [1] step-3 (suspend)
+│   properties: {"duration":"1s"}
+├── [2] step-4 (suspend) after step-3 => skipped: Skipped since the step is excluded by the excludeSteps
+└── [3] notify (suspend) onComplete
+`))
+		Expect(plan.Summary()).Should(Equal(`WorkflowRun ` + namespaceName + `/wr-plan (mode: DAG, sub steps mode: DAG)
+├── [1] step-1 (suspend)
+├── [2] deploy-prod (step-group) after step-1
+│   sub steps mode: DAG
+│   ├── [1] sub-1 (suspend)
+│   ├── [2] sub-2 (suspend) after sub-1
+│   └── [1] sub-3 (suspend)
+├── [1] step-3 (suspend)
+├── [2] step-4 (suspend) after step-3 => skipped: Skipped since the step is excluded by the excludeSteps
+└── [3] notify (suspend) onComplete
+`))
+		Expect(plan.Steps[2].Properties).ShouldNot(BeNil())
+		Expect(wr.Status.StartTime.IsZero()).Should(BeTrue())
+
+		By("Test plan the steps one by one")
+		wr.Spec.Mode = nil
+		plan, err = Plan(ctx, k8sClient, wr, types.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+		Expect(plan.Mode.Steps).Should(Equal(v1alpha1.WorkflowModeStep))
+		for i, step := range plan.Steps {
+			Expect(step.Stage).Should(Equal(i + 1))
+		}
+
+		By("Test plan the unknown step type")
+		wr.Spec.WorkflowSpec.Steps[2].Type = "not-found"
+		_, err = Plan(ctx, k8sClient, wr, types.StepGeneratorOptions{})
+		Expect(err).ShouldNot(BeNil())
+		Expect(err.Error()).Should(ContainSubstring("step type not-found"))
+
+		By("Test plan the unknown step type kept pending")
+		wr.Spec.UnknownStepTypePolicy = v1alpha1.UnknownStepTypePolicyPending
+		_, err = Plan(ctx, k8sClient, wr, types.StepGeneratorOptions{})
+		Expect(err).Should(BeNil())
+	})
+
+	It("Test generate workflow step runners with unknown step types", func() {
+		wr := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "wr-unknown",
+				Namespace: namespaceName,
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name: "step-1",
+								Type: "suspend",
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:      "step-2",
+								Type:      "not-registered",
+								DependsOn: []string{"step-1"},
+							},
+						},
+					},
+				},
+			},
+		}
+		ctx := monitorContext.NewTraceContext(ctx, "test-wr-unknown")
+		wfCtx, err := wfContext.NewContext(ctx, namespaceName, wr.Name, nil)
+		Expect(err).Should(BeNil())
+		generate := func(policy v1alpha1.UnknownStepTypePolicy) types.TaskRunner {
+			wr.Spec.UnknownStepTypePolicy = policy
+			instance, err := GenerateWorkflowInstance(ctx, k8sClient, wr)
+			Expect(err).Should(BeNil())
+			runners, err := GenerateRunners(ctx, instance, types.StepGeneratorOptions{})
+			Expect(err).Should(BeNil())
+			Expect(len(runners)).Should(BeEquivalentTo(2))
+			_, ok := runners[1].(*unknownTypeTaskRunner)
+			Expect(ok).Should(BeTrue())
+			return runners[1]
+		}
+
+		By("Test the unknown step type fails the step by default")
+		runner := generate("")
+		pending, status := runner.Pending(ctx, wfCtx, nil)
+		Expect(pending).Should(BeTrue())
+		Expect(status.Message).Should(Equal("Pending on DependsOn: step-1"))
+		stepStatus := map[string]v1alpha1.StepStatus{"step-1": {Phase: v1alpha1.WorkflowStepPhaseSucceeded}}
+		pending, _ = runner.Pending(ctx, wfCtx, stepStatus)
+		Expect(pending).Should(BeFalse())
+		status, operation, err := runner.Run(wfCtx, &types.TaskRunOptions{StepStatus: stepStatus})
+		Expect(err).Should(BeNil())
+		Expect(status.Phase).Should(Equal(v1alpha1.WorkflowStepPhaseFailed))
+		Expect(status.Reason).Should(Equal(types.StatusReasonUnknownStepType))
+		Expect(status.Message).Should(Equal(`unknown step type "not-registered", no builtin step type, template or WorkflowStepDefinition is found for it`))
+		Expect(operation.FailedAfterRetries).Should(BeTrue())
+
+		By("Test the unknown step type skips the step")
+		runner = generate(v1alpha1.UnknownStepTypePolicySkip)
+		status, operation, err = runner.Run(wfCtx, &types.TaskRunOptions{StepStatus: stepStatus})
+		Expect(err).Should(BeNil())
+		Expect(status.Phase).Should(Equal(v1alpha1.WorkflowStepPhaseSkipped))
+		Expect(status.Reason).Should(Equal(types.StatusReasonUnknownStepType))
+		Expect(status.Message).Should(Equal("Skipped since the step type not-registered is not registered"))
+		Expect(operation.Skip).Should(BeTrue())
+
+		By("Test the unknown step type keeps the step pending")
+		runner = generate(v1alpha1.UnknownStepTypePolicyPending)
+		pending, status = runner.Pending(ctx, wfCtx, stepStatus)
+		Expect(pending).Should(BeTrue())
+		Expect(status.Phase).Should(Equal(v1alpha1.WorkflowStepPhasePending))
+		Expect(status.Reason).Should(Equal(types.StatusReasonUnknownStepType))
+		Expect(status.Message).Should(Equal("Pending on StepType: not-registered is not registered"))
+
+	})
 })
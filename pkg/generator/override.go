@@ -0,0 +1,298 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/hooks"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// overrideTaskRunner returns the forced result of the step instead of executing it
+type overrideTaskRunner struct {
+	types.TaskRunner
+	id       string
+	step     v1alpha1.WorkflowStep
+	override types.StepOverride
+}
+
+// Run returns the overridden status and sets the overridden outputs in workflow context.
+func (r *overrideTaskRunner) Run(ctx wfContext.Context, _ *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
+	status := v1alpha1.StepStatus{
+		ID:      r.id,
+		Name:    r.step.Name,
+		Type:    r.step.Type,
+		Phase:   r.override.Phase,
+		Reason:  types.StatusReasonOverridden,
+		Message: r.override.Message,
+	}
+	if r.override.Reason != "" {
+		status.Reason = r.override.Reason
+	}
+	operation := &types.Operation{}
+	switch r.override.Phase {
+	case v1alpha1.WorkflowStepPhaseFailed:
+		operation.FailedAfterRetries = true
+	case v1alpha1.WorkflowStepPhaseSkipped:
+		operation.Skip = true
+	}
+	for name, raw := range r.override.Outputs {
+		if err := ctx.SetVar(cuecontext.New().CompileBytes(raw), name); err != nil {
+			return status, nil, errors.WithMessagef(err, "set overridden output %s", name)
+		}
+	}
+	return status, operation, nil
+}
+
+func parseStepOverrides(instance *types.WorkflowInstance) (map[string]types.StepOverride, error) {
+	s, ok := instance.Annotations[types.AnnotationStepOverrides]
+	if !ok || s == "" {
+		return nil, nil
+	}
+	overrides := make(map[string]types.StepOverride)
+	if err := json.Unmarshal([]byte(s), &overrides); err != nil {
+		return nil, errors.WithMessagef(err, "parse annotation %s", types.AnnotationStepOverrides)
+	}
+	for name, override := range overrides {
+		switch override.Phase {
+		case v1alpha1.WorkflowStepPhaseSucceeded, v1alpha1.WorkflowStepPhaseFailed, v1alpha1.WorkflowStepPhaseSkipped:
+		default:
+			return nil, fmt.Errorf("invalid overridden phase %q of step %s, only succeeded, failed and skipped are supported", override.Phase, name)
+		}
+	}
+	return overrides, nil
+}
+
+// parseModeOverride returns the execute mode overridden by the annotation, the annotation is ignored once the run
+// starts executing steps, and the overridden mode in status is kept after that
+func parseModeOverride(run *v1alpha1.WorkflowRun) (*v1alpha1.WorkflowExecuteMode, error) {
+	if run.Status.ModeOverridden {
+		return run.Status.Mode.DeepCopy(), nil
+	}
+	s, ok := run.Annotations[types.AnnotationModeOverride]
+	if !ok || s == "" || len(run.Status.Steps) > 0 {
+		return nil, nil
+	}
+	modes := strings.Split(s, ",")
+	if len(modes) > 2 {
+		return nil, fmt.Errorf("invalid annotation %s: %s, the format should be <steps mode>[,<sub steps mode>]", types.AnnotationModeOverride, s)
+	}
+	for _, mode := range modes {
+		if m := v1alpha1.WorkflowMode(strings.TrimSpace(mode)); m != v1alpha1.WorkflowModeDAG && m != v1alpha1.WorkflowModeStep {
+			return nil, fmt.Errorf("invalid mode %q in annotation %s, only %s and %s are supported", mode, types.AnnotationModeOverride, v1alpha1.WorkflowModeDAG, v1alpha1.WorkflowModeStep)
+		}
+	}
+	mode := &v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowMode(strings.TrimSpace(modes[0]))}
+	if len(modes) > 1 {
+		mode.SubSteps = v1alpha1.WorkflowMode(strings.TrimSpace(modes[1]))
+	}
+	return mode, nil
+}
+
+// parseSkipStepSelector adds the skipped overrides for the steps that match any of the skip step selectors,
+// the explicit overrides of the steps take precedence over the selectors
+func parseSkipStepSelector(instance *types.WorkflowInstance, overrides map[string]types.StepOverride) (map[string]types.StepOverride, error) {
+	s, ok := instance.Annotations[types.AnnotationSkipStepSelector]
+	if !ok || s == "" {
+		return overrides, nil
+	}
+	var selectors []labels.Selector
+	for _, item := range strings.Split(s, types.SkipStepSelectorSeparator) {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		selector, err := labels.Parse(item)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse annotation %s", types.AnnotationSkipStepSelector)
+		}
+		selectors = append(selectors, selector)
+	}
+	skip := func(step v1alpha1.WorkflowStepBase) {
+		if _, ok := overrides[step.Name]; ok {
+			return
+		}
+		for _, selector := range selectors {
+			if !selector.Matches(labels.Set(step.Labels)) {
+				continue
+			}
+			if overrides == nil {
+				overrides = make(map[string]types.StepOverride)
+			}
+			overrides[step.Name] = types.StepOverride{
+				Phase:   v1alpha1.WorkflowStepPhaseSkipped,
+				Message: fmt.Sprintf("Skipped by the step selector %s", selector.String()),
+			}
+			return
+		}
+	}
+	for _, step := range instance.Steps {
+		skip(step.WorkflowStepBase)
+		for _, sub := range step.SubSteps {
+			skip(sub)
+		}
+	}
+	return overrides, nil
+}
+
+// parseStepSelectors adds the skipped overrides for the steps that are not included by the includeSteps or excluded by
+// the excludeSteps of the run, the explicit overrides of the steps take precedence over the selectors. The inputs of the
+// executed steps can't refer to the outputs that are only provided by the excluded steps.
+func parseStepSelectors(instance *types.WorkflowInstance, overrides map[string]types.StepOverride) (map[string]types.StepOverride, error) {
+	if instance.IncludeSteps == nil && instance.ExcludeSteps == nil {
+		return overrides, nil
+	}
+	include, err := newStepMatcher(instance.IncludeSteps)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse includeSteps")
+	}
+	exclude, err := newStepMatcher(instance.ExcludeSteps)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse excludeSteps")
+	}
+	stepNames := make(map[string]struct{})
+	for _, step := range instance.Steps {
+		stepNames[step.Name] = struct{}{}
+		for _, sub := range step.SubSteps {
+			stepNames[sub.Name] = struct{}{}
+		}
+	}
+	for _, selector := range []*v1alpha1.StepSelector{instance.IncludeSteps, instance.ExcludeSteps} {
+		if selector == nil {
+			continue
+		}
+		for _, name := range selector.Names {
+			if _, ok := stepNames[name]; !ok {
+				return nil, fmt.Errorf("the selected step %s is not found", name)
+			}
+		}
+	}
+
+	excluded := make(map[string]string)
+	isExcluded := func(step v1alpha1.WorkflowStepBase, included bool) bool {
+		switch {
+		case instance.IncludeSteps != nil && !included:
+			excluded[step.Name] = "Skipped since the step is not included by the includeSteps"
+		case exclude(step):
+			excluded[step.Name] = "Skipped since the step is excluded by the excludeSteps"
+		default:
+			return false
+		}
+		return true
+	}
+	for _, step := range instance.Steps {
+		included := include(step.WorkflowStepBase)
+		for _, sub := range step.SubSteps {
+			included = included || include(sub)
+		}
+		if isExcluded(step.WorkflowStepBase, included) {
+			for _, sub := range step.SubSteps {
+				excluded[sub.Name] = excluded[step.Name]
+			}
+			continue
+		}
+		for _, sub := range step.SubSteps {
+			isExcluded(sub, include(step.WorkflowStepBase) || include(sub))
+		}
+	}
+
+	if err := validateExcludedOutputs(instance.Steps, excluded); err != nil {
+		return nil, err
+	}
+	for name, message := range excluded {
+		if _, ok := overrides[name]; ok {
+			continue
+		}
+		if overrides == nil {
+			overrides = make(map[string]types.StepOverride)
+		}
+		overrides[name] = types.StepOverride{
+			Phase:   v1alpha1.WorkflowStepPhaseSkipped,
+			Message: message,
+			Reason:  types.StatusReasonExcluded,
+		}
+	}
+	return overrides, nil
+}
+
+// newStepMatcher returns the function to check if the step is selected by the selector, nothing is selected by a nil selector
+func newStepMatcher(selector *v1alpha1.StepSelector) (func(step v1alpha1.WorkflowStepBase) bool, error) {
+	if selector == nil {
+		return func(v1alpha1.WorkflowStepBase) bool { return false }, nil
+	}
+	labelSelector := labels.Nothing()
+	if selector.LabelSelector != nil {
+		var err error
+		if labelSelector, err = metav1.LabelSelectorAsSelector(selector.LabelSelector); err != nil {
+			return nil, err
+		}
+	}
+	return func(step v1alpha1.WorkflowStepBase) bool {
+		return slices.Contains(selector.Names, step.Name) || labelSelector.Matches(labels.Set(step.Labels))
+	}, nil
+}
+
+// validateExcludedOutputs checks that the inputs of the executed steps don't require the outputs that are only
+// provided by the excluded steps, otherwise the steps will be pending forever
+func validateExcludedOutputs(steps []v1alpha1.WorkflowStep, excluded map[string]string) error {
+	providers := make(map[string][]string)
+	var executed []v1alpha1.WorkflowStepBase
+	collect := func(step v1alpha1.WorkflowStepBase) {
+		_, skip := excluded[step.Name]
+		for _, output := range step.Outputs {
+			if !skip {
+				// the output is available as long as one of the executed steps provides it
+				providers[output.Name] = nil
+				continue
+			}
+			if p, ok := providers[output.Name]; !ok || p != nil {
+				providers[output.Name] = append(p, step.Name)
+			}
+		}
+		if !skip {
+			executed = append(executed, step)
+		}
+	}
+	for _, step := range steps {
+		collect(step.WorkflowStepBase)
+		for _, sub := range step.SubSteps {
+			collect(sub)
+		}
+	}
+	for _, step := range executed {
+		for _, input := range step.Inputs {
+			if strings.HasPrefix(input.From, hooks.PreviousOutputPrefix) {
+				continue
+			}
+			name := strings.Split(input.From, ".")[0]
+			if p := providers[name]; len(p) > 0 {
+				return fmt.Errorf("the input %s of step %s requires the output of the excluded step %s", input.From, step.Name, p[0])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitorContext "github.com/kubevela/pkg/monitor/context"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/tasks"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// ExecutionPlan is the resolved steps of a workflowrun to review before it runs, the steps are rendered, validated
+// and selected the same way as executing the run
+type ExecutionPlan struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Mode is the execute mode of the steps and the sub steps
+	Mode v1alpha1.WorkflowExecuteMode `json:"mode"`
+	// Context is the context of the run that can be referenced by the steps
+	Context map[string]interface{} `json:"context,omitempty"`
+	// InitVars are the variables set in the workflow context before the steps are executed
+	InitVars map[string]interface{} `json:"initVars,omitempty"`
+	Steps    []PlannedStep          `json:"steps"`
+}
+
+// PlannedStep is a step in the execution plan
+type PlannedStep struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Stage is the order to start the step among its siblings, the steps in the same stage run in parallel
+	Stage int `json:"stage"`
+	// DependsOn are the siblings that the step waits for, including the producers of its inputs
+	DependsOn  []string              `json:"dependsOn,omitempty"`
+	If         string                `json:"if,omitempty"`
+	Properties *runtime.RawExtension `json:"properties,omitempty"`
+	// Phase is the forced phase of the step that is overridden or excluded, the step is executed if it's empty
+	Phase   v1alpha1.WorkflowStepPhase `json:"phase,omitempty"`
+	Message string                     `json:"message,omitempty"`
+	// Finalizer is the kind of the finalizer step
+	Finalizer types.FinalizerKind `json:"finalizer,omitempty"`
+	// SubStepsMode is the execute mode of the sub steps of the step group
+	SubStepsMode v1alpha1.WorkflowMode `json:"subStepsMode,omitempty"`
+	// GeneratedFrom is the output array to generate the sub steps at runtime
+	GeneratedFrom string        `json:"generatedFrom,omitempty"`
+	SubSteps      []PlannedStep `json:"subSteps,omitempty"`
+}
+
+// Plan resolves the execution plan of the workflowrun without executing it. The templated steps are rendered, the
+// step types are checked and the overrides and selectors of the run are applied, nothing is changed in the cluster.
+func Plan(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, options types.StepGeneratorOptions) (*ExecutionPlan, error) {
+	ctx = types.SetNamespaceInCtx(ctx, run.Namespace)
+	instance, _, err := newWorkflowInstance(ctx, cli, run)
+	if err != nil {
+		return nil, err
+	}
+	monCtx := monitorContext.NewTraceContext(ctx, "").AddTag("workflowrun", client.ObjectKeyFromObject(run).String())
+	options = initStepGeneratorOptions(monCtx, instance, options)
+	taskDiscover := tasks.NewTaskDiscover(monCtx, options)
+	overrides, err := resolveSteps(monCtx, instance, taskDiscover)
+	if err != nil {
+		return nil, err
+	}
+	checkType := func(typ string) error {
+		_, err := taskDiscover.GetTaskGenerator(ctx, typ)
+		// the step with the unknown type is skipped or kept pending by the policy of the run instead of failing
+		if types.IsUnknownStepType(err) && instance.UnknownStepTypePolicy != "" && instance.UnknownStepTypePolicy != v1alpha1.UnknownStepTypePolicyFail {
+			return nil
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "step type %s", typ)
+		}
+		return nil
+	}
+	for _, step := range instance.Steps {
+		if err := checkType(step.Type); err != nil {
+			return nil, err
+		}
+		for _, sub := range step.SubSteps {
+			if err := checkType(sub.Type); err != nil {
+				return nil, err
+			}
+		}
+		if step.Generator != nil && step.Generator.Template.Type != "" {
+			if err := checkType(step.Generator.Template.Type); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	plan := &ExecutionPlan{
+		Name:      instance.Name,
+		Namespace: instance.Namespace,
+		Mode:      v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeStep, SubSteps: v1alpha1.WorkflowModeDAG},
+		Context:   instance.Context,
+		InitVars:  instance.InitVars,
+	}
+	if instance.Mode != nil {
+		if instance.Mode.Steps != "" {
+			plan.Mode.Steps = instance.Mode.Steps
+		}
+		if instance.Mode.SubSteps != "" {
+			plan.Mode.SubSteps = instance.Mode.SubSteps
+		}
+	}
+	dependents := stepDependents(instance.Steps)
+	newPlannedStep := func(step v1alpha1.WorkflowStepBase) PlannedStep {
+		planned := PlannedStep{Name: step.Name, Type: step.Type, If: step.If, Properties: step.Properties}
+		if override, ok := overrides[step.Name]; ok {
+			planned.Phase, planned.Message = override.Phase, override.Message
+		}
+		return planned
+	}
+	var mainSteps []v1alpha1.WorkflowStepBase
+	for _, step := range instance.Steps {
+		mainSteps = append(mainSteps, step.WorkflowStepBase)
+	}
+	stages, deps := planStages(mainSteps, plan.Mode.Steps, dependents)
+	for i, step := range instance.Steps {
+		planned := newPlannedStep(step.WorkflowStepBase)
+		planned.Stage, planned.DependsOn = stages[i], deps[i]
+		planned.Finalizer = instance.Finalizers[step.Name]
+		if step.Type == types.WorkflowStepTypeStepGroup {
+			planned.SubStepsMode = plan.Mode.SubSteps
+			if step.Mode != "" {
+				planned.SubStepsMode = step.Mode
+			}
+			if step.Generator != nil {
+				planned.GeneratedFrom = step.Generator.From
+			}
+			subStages, subDeps := planStages(step.SubSteps, planned.SubStepsMode, dependents)
+			for j, sub := range step.SubSteps {
+				plannedSub := newPlannedStep(inheritSubStep(step, sub))
+				plannedSub.Stage, plannedSub.DependsOn = subStages[j], subDeps[j]
+				planned.SubSteps = append(planned.SubSteps, plannedSub)
+			}
+		}
+		plan.Steps = append(plan.Steps, planned)
+	}
+	return plan, nil
+}
+
+// planStages returns the stages of the sibling steps and the siblings that each step depends on. The steps are
+// started one by one in StepByStep mode, and a step starts after all its dependencies in DAG mode.
+func planStages(steps []v1alpha1.WorkflowStepBase, mode v1alpha1.WorkflowMode, dependents map[string][]string) ([]int, [][]string) {
+	index := make(map[string]int, len(steps))
+	for i, step := range steps {
+		index[step.Name] = i
+	}
+	deps := make([][]string, len(steps))
+	for _, step := range steps {
+		for _, dependent := range dependents[step.Name] {
+			if i, ok := index[dependent]; ok {
+				deps[i] = append(deps[i], step.Name)
+			}
+		}
+	}
+	stages := make([]int, len(steps))
+	var stageOf func(i int) int
+	stageOf = func(i int) int {
+		if stages[i] != 0 {
+			return stages[i]
+		}
+		// the cyclic dependencies are rejected by the validation, the step is treated as the first stage in case
+		stages[i] = 1
+		stage := 1
+		for _, dep := range deps[i] {
+			stage = max(stage, stageOf(index[dep])+1)
+		}
+		stages[i] = stage
+		return stage
+	}
+	for i := range steps {
+		slices.Sort(deps[i])
+		if mode == v1alpha1.WorkflowModeStep {
+			stages[i] = i + 1
+			continue
+		}
+		stageOf(i)
+	}
+	return stages, deps
+}
+
+// String renders the execution plan as a tree, the stage of each step is shown in the brackets
+func (p *ExecutionPlan) String() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "WorkflowRun %s/%s (mode: %s, sub steps mode: %s)\n", p.Namespace, p.Name, p.Mode.Steps, p.Mode.SubSteps)
+	for _, vars := range []struct {
+		name   string
+		values map[string]interface{}
+	}{
+		{name: "context", values: p.Context},
+		{name: "initVars", values: p.InitVars},
+	} {
+		if len(vars.values) == 0 {
+			continue
+		}
+		b, _ := json.Marshal(vars.values)
+		fmt.Fprintf(sb, "%s: %s\n", vars.name, b)
+	}
+	writePlannedSteps(sb, p.Steps, "")
+	return sb.String()
+}
+
+// Summary renders the execution plan like String without the context, the init vars and the properties of the
+// steps, which may carry the credentials, so that it can be shown where the values are not protected, e.g. in the
+// admission warnings that are logged by the clients
+func (p *ExecutionPlan) Summary() string {
+	summary := &ExecutionPlan{Name: p.Name, Namespace: p.Namespace, Mode: p.Mode, Steps: withoutProperties(p.Steps)}
+	return summary.String()
+}
+
+// withoutProperties returns the copy of the planned steps without the properties
+func withoutProperties(steps []PlannedStep) []PlannedStep {
+	if steps == nil {
+		return nil
+	}
+	copied := make([]PlannedStep, len(steps))
+	for i, step := range steps {
+		step.Properties = nil
+		step.SubSteps = withoutProperties(step.SubSteps)
+		copied[i] = step
+	}
+	return copied
+}
+
+func writePlannedSteps(sb *strings.Builder, steps []PlannedStep, indent string) {
+	for i, step := range steps {
+		branch, next := "├── ", "│   "
+		if i == len(steps)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(sb, "%s%s[%d] %s (%s)", indent, branch, step.Stage, step.Name, step.Type)
+		if step.Finalizer != "" {
+			fmt.Fprintf(sb, " %s", step.Finalizer)
+		} else if len(step.DependsOn) > 0 {
+			fmt.Fprintf(sb, " after %s", strings.Join(step.DependsOn, ", "))
+		}
+		if step.Phase != "" {
+			fmt.Fprintf(sb, " => %s", step.Phase)
+			if step.Message != "" {
+				fmt.Fprintf(sb, ": %s", step.Message)
+			}
+		}
+		sb.WriteString("\n")
+		details := indent + next
+		if step.If != "" {
+			fmt.Fprintf(sb, "%sif: %s\n", details, step.If)
+		}
+		if step.Properties != nil && len(step.Properties.Raw) > 0 {
+			fmt.Fprintf(sb, "%sproperties: %s\n", details, step.Properties.Raw)
+		}
+		if step.SubStepsMode != "" {
+			fmt.Fprintf(sb, "%ssub steps mode: %s\n", details, step.SubStepsMode)
+		}
+		if step.GeneratedFrom != "" {
+			fmt.Fprintf(sb, "%ssub steps generated from: %s\n", details, step.GeneratedFrom)
+		}
+		writePlannedSteps(sb, step.SubSteps, details)
+	}
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"context"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
+)
+
+// renderSteps renders the templated steps of the instance into a copy of the steps, the steps of the instance are not
+// changed. The rendered types must be known by the task discover.
+func renderSteps(ctx context.Context, instance *types.WorkflowInstance, discover types.TaskDiscover) ([]v1alpha1.WorkflowStep, error) {
+	return utils.RenderSteps(instance.Name, instance.Namespace, instance.Context, instance.Steps, func(typ string) error {
+		_, err := discover.GetTaskGenerator(ctx, typ)
+		return err
+	})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generator
+
+import (
+	"fmt"
+
+	"cuelang.org/go/cue/cuecontext"
+
+	monitorContext "github.com/kubevela/pkg/monitor/context"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/process"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/tasks/custom"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// unknownTypeTaskRunner handles the step whose type can't be resolved by the unknown step type policy of the run,
+// the type is resolved again once the runners are generated in the next reconcile
+type unknownTypeTaskRunner struct {
+	id     string
+	step   v1alpha1.WorkflowStep
+	policy v1alpha1.UnknownStepTypePolicy
+	err    error
+}
+
+// Name returns the name of the step
+func (r *unknownTypeTaskRunner) Name() string {
+	return r.step.Name
+}
+
+// Pending keeps the step pending until its type is registered with the Pending policy, otherwise the step waits
+// for its dependencies like the other steps before it's skipped or failed
+func (r *unknownTypeTaskRunner) Pending(ctx monitorContext.Context, wfCtx wfContext.Context, stepStatus map[string]v1alpha1.StepStatus) (bool, v1alpha1.StepStatus) {
+	if r.policy == v1alpha1.UnknownStepTypePolicyPending {
+		status := r.status(stepStatus)
+		status.Phase = v1alpha1.WorkflowStepPhasePending
+		status.Message = fmt.Sprintf("Pending on StepType: %s is not registered", r.step.Type)
+		return true, status
+	}
+	return custom.CheckPending(wfCtx, r.step, r.id, nil, stepStatus, cuecontext.New().CompileString("{}"), providertypes.ClockFrom(ctx.GetContext()).Now())
+}
+
+// Run skips the step with the Skip policy and fails the step with the unknown type otherwise
+func (r *unknownTypeTaskRunner) Run(_ wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
+	status := r.status(options.StepStatus)
+	operation := &types.Operation{}
+	if r.policy == v1alpha1.UnknownStepTypePolicySkip {
+		status.Phase = v1alpha1.WorkflowStepPhaseSkipped
+		status.Message = fmt.Sprintf("Skipped since the step type %s is not registered", r.step.Type)
+		operation.Skip = true
+		return status, operation, nil
+	}
+	status.Phase = v1alpha1.WorkflowStepPhaseFailed
+	status.Message = r.err.Error()
+	operation.FailedAfterRetries = true
+	return status, operation, nil
+}
+
+// FillContextData does nothing since the step is not executed
+func (r *unknownTypeTaskRunner) FillContextData(_ monitorContext.Context, _ process.Context) types.ContextDataResetter {
+	return func(process.Context) {}
+}
+
+func (r *unknownTypeTaskRunner) status(stepStatus map[string]v1alpha1.StepStatus) v1alpha1.StepStatus {
+	return v1alpha1.StepStatus{
+		ID:      r.id,
+		Name:    r.step.Name,
+		Type:    r.step.Type,
+		Reason:  types.StatusReasonUnknownStepType,
+		Attempt: types.StepAttempt(r.id, stepStatus[r.step.Name]),
+	}
+}
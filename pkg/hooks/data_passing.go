@@ -19,6 +19,7 @@ package hooks
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"cuelang.org/go/cue"
@@ -27,20 +28,61 @@ import (
 
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model/sets"
 	"github.com/kubevela/workflow/pkg/cue/model/value"
 	wfTypes "github.com/kubevela/workflow/pkg/types"
 )
 
+const (
+	// PreviousOutputPrefix is the prefix of the input that refers to the output of the step's last completed execution
+	PreviousOutputPrefix = "self.previous."
+	// StepGroupResultsKey is the key of the aggregated outputs of the sub steps under the name of the step group,
+	// e.g. `group.results`
+	StepGroupResultsKey = "results"
+)
+
 // Input set data to parameter.
 func Input(ctx wfContext.Context, paramValue cue.Value, step v1alpha1.WorkflowStep) (cue.Value, error) {
 	filledVal := paramValue
+	retryInputs := getRetryInputs(ctx, step)
+	lazyInputs := make(map[string]string)
 	for _, input := range step.Inputs {
-		inputValue, err := ctx.GetVar(strings.Split(input.From, ".")...)
-		if err != nil {
-			inputValue, err = value.LookupValueByScript(paramValue, input.From)
+		var (
+			inputValue cue.Value
+			err        error
+		)
+		if s, ok := retryInputs[input.ParameterKey]; ok && input.ParameterKey != "" {
+			// the retry reuses the input resolved by the failed attempt
+			inputValue = paramValue.Context().CompileString(s)
+		} else if path, ok := strings.CutPrefix(input.From, PreviousOutputPrefix); ok {
+			var found bool
+			inputValue, found, err = getPreviousOutput(ctx, paramValue.Context(), step.Name, path)
 			if err != nil {
 				return filledVal, errors.WithMessagef(err, "get input from [%s]", input.From)
 			}
+			// there is no previous output on the first run, leave the parameter as it is
+			if !found {
+				continue
+			}
+		} else {
+			inputValue, err = ctx.GetVar(strings.Split(input.From, ".")...)
+			if err != nil {
+				// the pruned output is read from the previous output of its step, e.g. the step is restarted
+				var found bool
+				if inputValue, found, err = getPrunedOutput(ctx, paramValue.Context(), input.From); err == nil && !found {
+					inputValue, err = value.LookupValueByScript(paramValue, input.From)
+				}
+				// the lazy input that is not available yet is resolved in the next executions of the step
+				if err != nil && input.Lazy {
+					if input.ParameterKey != "" {
+						lazyInputs[input.ParameterKey] = input.From
+					}
+					continue
+				}
+				if err != nil {
+					return filledVal, errors.WithMessagef(err, "get input from [%s]", input.From)
+				}
+			}
 		}
 		if input.ParameterKey != "" {
 			filledVal, err = value.SetValueByScript(filledVal, inputValue, strings.Join([]string{"parameter", input.ParameterKey}, "."))
@@ -54,27 +96,191 @@ func Input(ctx wfContext.Context, paramValue cue.Value, step v1alpha1.WorkflowSt
 			}
 		}
 	}
+	setUnresolvedLazyInputs(ctx, step, lazyInputs)
 	return filledVal, nil
 }
 
+// setUnresolvedLazyInputs records the lazy inputs of the step that are unresolved by the execution, keyed by their
+// parameter keys
+func setUnresolvedLazyInputs(ctx wfContext.Context, step v1alpha1.WorkflowStep, inputs map[string]string) {
+	if len(inputs) == 0 {
+		if ctx.GetMutableValue(wfTypes.ContextPrefixLazyInputs, step.Name) != "" {
+			ctx.DeleteMutableValue(wfTypes.ContextPrefixLazyInputs, step.Name)
+		}
+		return
+	}
+	if b, err := json.Marshal(inputs); err == nil {
+		ctx.SetMutableValue(string(b), wfTypes.ContextPrefixLazyInputs, step.Name)
+	}
+}
+
+// GetUnresolvedLazyInputs returns the lazy inputs of the step that are unresolved by the last execution, keyed by
+// their parameter keys
+func GetUnresolvedLazyInputs(ctx wfContext.Context, step v1alpha1.WorkflowStep) map[string]string {
+	s := ctx.GetMutableValue(wfTypes.ContextPrefixLazyInputs, step.Name)
+	if s == "" {
+		return nil
+	}
+	inputs := make(map[string]string)
+	if err := json.Unmarshal([]byte(s), &inputs); err != nil {
+		return nil
+	}
+	return inputs
+}
+
+// UnresolvedLazyInputsTemplate returns the template that makes the parameters of the unresolved lazy inputs
+// unavailable, so that the template can't read them by the default values of the parameters
+func UnresolvedLazyInputsTemplate(inputs map[string]string) string {
+	keys := make([]string, 0, len(inputs))
+	for key := range inputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		selectors := []string{"parameter"}
+		for _, sel := range value.FieldPath(key).Selectors() {
+			selectors = append(selectors, sel.String())
+		}
+		lines = append(lines, strings.Join(selectors, ": ")+": _|_")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SetRetryInputs keeps the inputs filled in the parameter of the failed step, so that the retries of the step reuse
+// them instead of resolving the inputs again. The inputs kept by the first failed attempt are not replaced, and the
+// inputs are not kept if the step re-renders on retry.
+func SetRetryInputs(ctx wfContext.Context, paramValue cue.Value, step v1alpha1.WorkflowStep) {
+	if step.RerenderOnRetry || ctx.GetMutableValue(wfTypes.ContextPrefixRetryInputs, step.Name) != "" {
+		return
+	}
+	inputs := make(map[string]string)
+	for _, input := range step.Inputs {
+		if input.ParameterKey == "" {
+			continue
+		}
+		v := paramValue.LookupPath(value.FieldPath(strings.Join([]string{"parameter", input.ParameterKey}, ".")))
+		if !v.Exists() || v.Validate(cue.Concrete(true)) != nil {
+			// the unavailable input is resolved again by the retry
+			continue
+		}
+		if s, err := sets.ToString(v); err == nil {
+			inputs[input.ParameterKey] = s
+		}
+	}
+	if len(inputs) == 0 {
+		return
+	}
+	if b, err := json.Marshal(inputs); err == nil {
+		ctx.SetMutableValue(string(b), wfTypes.ContextPrefixRetryInputs, step.Name)
+	}
+}
+
+// DeleteRetryInputs deletes the inputs kept for the retries of the step, e.g. the step is finished or restarted
+func DeleteRetryInputs(ctx wfContext.Context, step v1alpha1.WorkflowStep) {
+	if ctx.GetMutableValue(wfTypes.ContextPrefixRetryInputs, step.Name) != "" {
+		ctx.DeleteMutableValue(wfTypes.ContextPrefixRetryInputs, step.Name)
+	}
+}
+
+// getRetryInputs returns the inputs kept for the retries of the step keyed by their parameter keys
+func getRetryInputs(ctx wfContext.Context, step v1alpha1.WorkflowStep) map[string]string {
+	s := ctx.GetMutableValue(wfTypes.ContextPrefixRetryInputs, step.Name)
+	if step.RerenderOnRetry || s == "" {
+		return nil
+	}
+	inputs := make(map[string]string)
+	if err := json.Unmarshal([]byte(s), &inputs); err != nil {
+		return nil
+	}
+	return inputs
+}
+
+// CheckRetryInputs checks the inputs resolved again by the retry of the step are not from the steps that have failed
+// since the step started, the retry would otherwise be rendered with the outputs of the failed steps
+func CheckRetryInputs(ctx wfContext.Context, step v1alpha1.WorkflowStep, stepStatus map[string]v1alpha1.StepStatus) error {
+	started := stepStatus[step.Name].FirstExecuteTime
+	for _, input := range step.Inputs {
+		if strings.HasPrefix(input.From, PreviousOutputPrefix) {
+			continue
+		}
+		name, _, _ := strings.Cut(input.From, ".")
+		from := ctx.GetMutableValue(wfTypes.ContextPrefixOutputStep, name)
+		if from == "" || from == step.Name {
+			continue
+		}
+		if status, ok := stepStatus[from]; ok && status.Phase == v1alpha1.WorkflowStepPhaseFailed && !status.LastExecuteTime.Before(&started) {
+			return fmt.Errorf("the input %s is from the step %s that has failed: %s", input.From, from, status.Message)
+		}
+	}
+	return nil
+}
+
+// CheckLazyInputs checks the lazy inputs filled in the parameter of the step are resolved before the step succeeds,
+// the step that finishes without its lazy inputs would run with the missing parameters. The parameters of the
+// unresolved lazy inputs are unavailable even if the template has their default values.
+func CheckLazyInputs(taskValue cue.Value, step v1alpha1.WorkflowStep) error {
+	for _, input := range step.Inputs {
+		if !input.Lazy || input.ParameterKey == "" {
+			continue
+		}
+		v := taskValue.LookupPath(value.FieldPath(strings.Join([]string{"parameter", input.ParameterKey}, ".")))
+		if !v.Exists() || v.Validate(cue.Concrete(true)) != nil {
+			return fmt.Errorf("the lazy input %s is still unavailable when the step is about to succeed, the step should wait for it before using it", input.From)
+		}
+	}
+	return nil
+}
+
 // Output get data from task value.
 func Output(ctx wfContext.Context, taskValue cue.Value, step v1alpha1.WorkflowStep, status v1alpha1.StepStatus, stepStatus map[string]v1alpha1.StepStatus) error {
+	return output(ctx, taskValue, step, status, stepStatus, false)
+}
+
+// SubStepOutput get data from task value of the sub step, the outputs are always persisted as the previous outputs
+// to be aggregated into the results of the step group.
+func SubStepOutput(ctx wfContext.Context, taskValue cue.Value, step v1alpha1.WorkflowStep, status v1alpha1.StepStatus, stepStatus map[string]v1alpha1.StepStatus) error {
+	return output(ctx, taskValue, step, status, stepStatus, true)
+}
+
+func output(ctx wfContext.Context, taskValue cue.Value, step v1alpha1.WorkflowStep, status v1alpha1.StepStatus, stepStatus map[string]v1alpha1.StepStatus, subStep bool) error {
 	errMsg := ""
+	readsPrevious := false
+	for _, input := range step.Inputs {
+		if strings.HasPrefix(input.From, PreviousOutputPrefix) {
+			readsPrevious = true
+		}
+	}
 	if wfTypes.IsStepFinish(status.Phase, status.Reason) {
 		SetAdditionalNameInStatus(stepStatus, step.Name, step.Properties, status)
 		for _, output := range step.Outputs {
-			v, err := value.LookupValueByScript(taskValue, output.ValueFrom)
+			v, err := LookupOutput(taskValue, output)
 			// if the error is not nil and the step is not skipped, return the error
 			if err != nil && status.Phase != v1alpha1.WorkflowStepPhaseSkipped {
 				errMsg += fmt.Sprintf("failed to get output from %s: %s\n", output.ValueFrom, err.Error())
 			}
+			// the output of the step that has been executed before is replaced by the new one
+			rerun := ctx.GetMutableValue(wfTypes.ContextPrefixOutputStep, output.Name) == step.Name ||
+				ctx.GetMutableValue(wfTypes.ContextPrefixPreviousOutput, step.Name, output.Name) != ""
 			// if the error is not nil, set the value to null
 			if err != nil || v.Err() != nil {
 				v = taskValue.Context().CompileString("null")
+			} else if status.Phase != v1alpha1.WorkflowStepPhaseSkipped && !output.Sensitive &&
+				(readsPrevious || subStep || output.Retention == v1alpha1.OutputRetentionConsumed) {
+				// the previous output is only persisted if it's read later by the step itself, the step group or
+				// the restarted steps that consume the pruned output, the sensitive output is never persisted in
+				// plaintext
+				if err := setPreviousOutput(ctx, v, step.Name, output.Name); err != nil {
+					errMsg += fmt.Sprintf("failed to persist output %s: %s\n", output.Name, err.Error())
+				}
 			}
-			if err := ctx.SetVar(v, output.Name); err != nil {
+			if err := setOutput(ctx, v, output.Name, rerun); err != nil {
 				errMsg += fmt.Sprintf("failed to set output %s: %s\n", output.Name, err.Error())
 			}
+			if ctx.GetMutableValue(wfTypes.ContextPrefixOutputStep, output.Name) != step.Name {
+				ctx.SetMutableValue(step.Name, wfTypes.ContextPrefixOutputStep, output.Name)
+			}
+			ctx.DeleteMutableValue(wfTypes.ContextPrefixPrunedOutput, output.Name)
 		}
 	}
 
@@ -84,6 +290,111 @@ func Output(ctx wfContext.Context, taskValue cue.Value, step v1alpha1.WorkflowSt
 	return nil
 }
 
+// setOutput sets the output in the context vars, the output is spilled to the context backend if it's too large,
+// and the existing output is replaced if replace is true
+func setOutput(ctx wfContext.Context, v cue.Value, name string, replace bool) error {
+	if wfTypes.MaxInlineOutputSize > 0 {
+		if s, err := sets.ToString(v); err == nil && len(s) > wfTypes.MaxInlineOutputSize {
+			return wfContext.SpillVar(ctx, v, name)
+		}
+	}
+	if replace {
+		return ctx.ReplaceVar(v, name)
+	}
+	return ctx.SetVar(v, name)
+}
+
+// setPreviousOutput persists the output of the step, so that the next execution of the step can read it as input
+func setPreviousOutput(ctx wfContext.Context, v cue.Value, stepName, name string) error {
+	s, err := sets.ToString(v)
+	if err != nil {
+		return err
+	}
+	ctx.SetMutableValue(s, wfTypes.ContextPrefixPreviousOutput, stepName, name)
+	return nil
+}
+
+// getPreviousOutput gets the output of the last completed execution of the step by the path of the output,
+// returns false if the step has not completed before
+func getPreviousOutput(ctx wfContext.Context, cuectx *cue.Context, stepName, path string) (cue.Value, bool, error) {
+	name, field, _ := strings.Cut(path, ".")
+	s := ctx.GetMutableValue(wfTypes.ContextPrefixPreviousOutput, stepName, name)
+	if s == "" {
+		return cue.Value{}, false, nil
+	}
+	v := cuectx.CompileString(s)
+	if v.Err() != nil {
+		return v, false, v.Err()
+	}
+	if field != "" {
+		v = v.LookupPath(value.FieldPath(field))
+		if !v.Exists() {
+			return v, false, fmt.Errorf("field %s not found in the previous output %s", field, name)
+		}
+	}
+	return v, true, nil
+}
+
+// SetStepGroupResults aggregates the outputs of the sub steps into an array under `<group>.results` of the
+// workflow context, the items are in the order of the sub steps and contain the name, the phase and the outputs of
+// the sub steps, the outputs are only set if the sub step is succeeded
+func SetStepGroupResults(ctx wfContext.Context, cuectx *cue.Context, group v1alpha1.WorkflowStep, status v1alpha1.WorkflowStepStatus) error {
+	phases := make(map[string]v1alpha1.WorkflowStepPhase)
+	for _, sub := range status.SubStepsStatus {
+		phases[sub.Name] = sub.Phase
+	}
+	results := make([]cue.Value, 0, len(group.SubSteps))
+	for _, sub := range group.SubSteps {
+		// the sub steps that are not executed are skipped once the group is finished
+		phase, ok := phases[sub.Name]
+		if !ok {
+			phase = v1alpha1.WorkflowStepPhaseSkipped
+		}
+		item := cuectx.CompileString("{}").
+			FillPath(cue.ParsePath("name"), sub.Name).
+			FillPath(cue.ParsePath("phase"), string(phase))
+		if phase == v1alpha1.WorkflowStepPhaseSucceeded {
+			outputs := cuectx.CompileString("{}")
+			for _, output := range sub.Outputs {
+				// the outputs are read from the sub steps instead of the context vars, which may be shared by the
+				// sub steps or pruned
+				v, found, err := getPreviousOutput(ctx, cuectx, sub.Name, output.Name)
+				if err != nil {
+					return errors.WithMessagef(err, "get output %s of sub step %s", output.Name, sub.Name)
+				}
+				if !found {
+					v = cuectx.CompileString("null")
+				}
+				outputs = outputs.FillPath(value.FieldPath(output.Name), v)
+			}
+			item = item.FillPath(cue.ParsePath("outputs"), outputs)
+		}
+		results = append(results, item)
+	}
+	return ctx.ReplaceVar(cuectx.NewList(results...), group.Name, StepGroupResultsKey)
+}
+
+// IsOutputPruned checks if the output referred by the input is pruned from the workflow context
+func IsOutputPruned(ctx wfContext.Context, from string) bool {
+	name, _, _ := strings.Cut(from, ".")
+	return ctx.GetMutableValue(wfTypes.ContextPrefixPrunedOutput, name) != ""
+}
+
+// getPrunedOutput gets the output pruned from the workflow context by the previous output of the step that
+// generates it, returns false if the output is not pruned
+func getPrunedOutput(ctx wfContext.Context, cuectx *cue.Context, from string) (cue.Value, bool, error) {
+	name, _, _ := strings.Cut(from, ".")
+	stepName := ctx.GetMutableValue(wfTypes.ContextPrefixPrunedOutput, name)
+	if stepName == "" {
+		return cue.Value{}, false, nil
+	}
+	v, found, err := getPreviousOutput(ctx, cuectx, stepName, from)
+	if err == nil && !found {
+		return v, false, fmt.Errorf("output %s is pruned", name)
+	}
+	return v, found, err
+}
+
 // SetAdditionalNameInStatus sets additional name from properties to status map
 func SetAdditionalNameInStatus(stepStatus map[string]v1alpha1.StepStatus, name string, properties *runtime.RawExtension, status v1alpha1.StepStatus) { //nolint:revive,unused
 	if stepStatus == nil || properties == nil {
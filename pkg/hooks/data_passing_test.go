@@ -24,12 +24,16 @@ import (
 	"cuelang.org/go/cue/cuecontext"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"github.com/kubevela/pkg/util/singleton"
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
+	wfTypes "github.com/kubevela/workflow/pkg/types"
 )
 
 func TestInput(t *testing.T) {
@@ -86,6 +90,7 @@ func TestInput(t *testing.T) {
 	s, err := result.String()
 	r.NoError(err)
 	r.Equal(s, "test")
+
 }
 
 func TestOutput(t *testing.T) {
@@ -116,6 +121,106 @@ func TestOutput(t *testing.T) {
 	r.Equal(stepStatus["mystep"].Phase, v1alpha1.WorkflowStepPhaseSucceeded)
 }
 
+func TestOutputPipeline(t *testing.T) {
+	wfCtx := mockContext(t)
+	r := require.New(t)
+	cuectx := cuecontext.New()
+	// {"token":" abc ","replicas":3}
+	taskValue := cuectx.CompileString(`output: data: config: "eyJ0b2tlbiI6IiBhYmMgIiwicmVwbGljYXMiOjN9"`)
+	decode := []v1alpha1.OutputTransform{{Transform: v1alpha1.OutputTransformBase64Decode}, {Transform: v1alpha1.OutputTransformJSONParse}}
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Outputs: v1alpha1.StepOutputs{{
+				ValueFrom: "output.data.config",
+				Name:      "replicas",
+				Pipeline:  append(decode, v1alpha1.OutputTransform{Expression: "value.replicas + 1"}),
+			}, {
+				ValueFrom: "output.data.config",
+				Name:      "token",
+				Pipeline:  append(decode, v1alpha1.OutputTransform{Expression: "value.token"}, v1alpha1.OutputTransform{Transform: v1alpha1.OutputTransformTrim}),
+			}},
+		},
+	}
+	r.NoError(Output(wfCtx, taskValue, step, v1alpha1.StepStatus{Phase: v1alpha1.WorkflowStepPhaseSucceeded}, nil))
+	replicas, err := wfCtx.GetVar("replicas")
+	r.NoError(err)
+	n, err := replicas.Int64()
+	r.NoError(err)
+	r.Equal(int64(4), n)
+	token, err := wfCtx.GetVar("token")
+	r.NoError(err)
+	s, err := token.String()
+	r.NoError(err)
+	r.Equal("abc", s)
+
+	// the error reports the failed stage
+	step.Outputs = v1alpha1.StepOutputs{{
+		ValueFrom: "output.data.config",
+		Name:      "invalid",
+		Pipeline:  []v1alpha1.OutputTransform{{Transform: v1alpha1.OutputTransformBase64Decode}, {Name: "parse-config", Transform: v1alpha1.OutputTransformYAMLParse}, {Transform: v1alpha1.OutputTransformBase64Decode}},
+	}}
+	err = Output(wfCtx, taskValue, step, v1alpha1.StepStatus{Phase: v1alpha1.WorkflowStepPhaseSucceeded}, nil)
+	r.Error(err)
+	r.Contains(err.Error(), "pipeline stage 2 (base64Decode): the input of base64Decode must be a string")
+	_, err = TransformOutput(cuectx.CompileString(`"{"`), []v1alpha1.OutputTransform{{Name: "parse-config", Transform: v1alpha1.OutputTransformJSONParse}})
+	r.Error(err)
+	r.Contains(err.Error(), "pipeline stage 0 (parse-config)")
+}
+
+func TestSpillOutput(t *testing.T) {
+	r := require.New(t)
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	singleton.KubeClient.Set(cli)
+	wfCtx, err := wfContext.NewContext(context.Background(), "default", "v1", nil)
+	r.NoError(err)
+	maxSize := wfTypes.MaxInlineOutputSize
+	wfTypes.MaxInlineOutputSize = 16
+	defer func() { wfTypes.MaxInlineOutputSize = maxSize }()
+	cuectx := cuecontext.New()
+	taskValue := cuectx.CompileString(`output: {small: 1, large: {name: "a-large-output", score: 99}}`)
+	err = Output(wfCtx, taskValue, v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Outputs: v1alpha1.StepOutputs{{
+				ValueFrom: "output.small",
+				Name:      "small",
+			}, {
+				ValueFrom: "output.large",
+				Name:      "large",
+			}},
+		},
+	}, v1alpha1.StepStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+	}, nil)
+	r.NoError(err)
+	r.NoError(wfCtx.Commit(context.Background()))
+	r.NotContains(wfCtx.GetStore().Data[wfContext.ConfigMapKeyVars], "a-large-output")
+	cms := &corev1.ConfigMapList{}
+	r.NoError(cli.List(context.Background(), cms, client.MatchingLabels{wfContext.LabelSpilledVar: "true"}))
+	r.Len(cms.Items, 1)
+	r.Contains(cms.Items[0].Data[wfContext.ConfigMapKeySpilledData], "a-large-output")
+
+	val, err := Input(wfCtx, cuectx.CompileString(`parameter: {}`), v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Inputs: v1alpha1.StepInputs{{
+				From:         "large.score",
+				ParameterKey: "score",
+			}, {
+				From:         "large",
+				ParameterKey: "large",
+			}},
+		},
+	})
+	r.NoError(err)
+	score, err := val.LookupPath(cue.ParsePath("parameter.score")).Int64()
+	r.NoError(err)
+	r.Equal(int64(99), score)
+	name, err := val.LookupPath(cue.ParsePath("parameter.large.name")).String()
+	r.NoError(err)
+	r.Equal("a-large-output", name)
+	_, err = wfCtx.GetVar("large", "notfound")
+	r.Equal("var large.notfound not found", err.Error())
+}
+
 func mockContext(t *testing.T) wfContext.Context {
 	cli := &test.MockClient{
 		MockCreate: func(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
@@ -133,3 +238,245 @@ func mockContext(t *testing.T) wfContext.Context {
 	require.NoError(t, err)
 	return wfCtx
 }
+
+func TestPreviousOutput(t *testing.T) {
+	wfCtx := mockContext(t)
+	r := require.New(t)
+	cuectx := cuecontext.New()
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "counter",
+			Inputs: v1alpha1.StepInputs{{
+				From:         "self.previous.result.count",
+				ParameterKey: "count",
+			}},
+			Outputs: v1alpha1.StepOutputs{{
+				ValueFrom: "output",
+				Name:      "result",
+			}},
+		},
+	}
+
+	// the parameter is not filled on the first run
+	val, err := Input(wfCtx, cuectx.CompileString(`parameter: count: *0 | int`), step)
+	r.NoError(err)
+	count, _ := val.LookupPath(cue.ParsePath("parameter.count")).Default()
+	n, err := count.Int64()
+	r.NoError(err)
+	r.Equal(int64(0), n)
+
+	r.NoError(Output(wfCtx, cuectx.CompileString(`output: count: 1`), step, v1alpha1.StepStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+	}, nil))
+	val, err = Input(wfCtx, cuectx.CompileString(`parameter: count: *0 | int`), step)
+	r.NoError(err)
+	n, err = val.LookupPath(cue.ParsePath("parameter.count")).Int64()
+	r.NoError(err)
+	r.Equal(int64(1), n)
+
+	// the next execution reads the output of the last one
+	r.NoError(Output(wfCtx, cuectx.CompileString(`output: count: 2`), step, v1alpha1.StepStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+	}, nil))
+	val, err = Input(wfCtx, cuectx.CompileString(`parameter: count: *0 | int`), step)
+	r.NoError(err)
+	n, err = val.LookupPath(cue.ParsePath("parameter.count")).Int64()
+	r.NoError(err)
+	r.Equal(int64(2), n)
+	result, err := wfCtx.GetVar("result", "count")
+	r.NoError(err)
+	n, err = result.Int64()
+	r.NoError(err)
+	r.Equal(int64(2), n)
+
+	// the output of the other step is not the previous output
+	step.Name = "other"
+	val, err = Input(wfCtx, cuectx.CompileString(`parameter: count: *0 | int`), step)
+	r.NoError(err)
+	n, err = val.LookupPath(cue.ParsePath("parameter.count")).Int64()
+	r.NoError(err)
+	r.Equal(int64(0), n)
+}
+
+func TestPreviousOutputNotReferenced(t *testing.T) {
+	wfCtx := mockContext(t)
+	r := require.New(t)
+	cuectx := cuecontext.New()
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "counter",
+			Outputs: v1alpha1.StepOutputs{{
+				ValueFrom: "output",
+				Name:      "result",
+			}},
+		},
+	}
+	r.NoError(Output(wfCtx, cuectx.CompileString(`output: count: 1`), step, v1alpha1.StepStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+	}, nil))
+	r.Equal("", wfCtx.GetMutableValue(wfTypes.ContextPrefixPreviousOutput, "counter", "result"))
+	r.Equal("counter", wfCtx.GetMutableValue(wfTypes.ContextPrefixOutputStep, "result"))
+
+	// the sensitive output is not persisted as the previous output
+	sensitive := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "password",
+			Outputs: v1alpha1.StepOutputs{{
+				ValueFrom: "output",
+				Name:      "password",
+				Sensitive: true,
+				Retention: v1alpha1.OutputRetentionConsumed,
+			}},
+		},
+	}
+	r.NoError(SubStepOutput(wfCtx, cuectx.CompileString(`output: "s3cr3t"`), sensitive, v1alpha1.StepStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+	}, nil))
+	r.Equal("", wfCtx.GetMutableValue(wfTypes.ContextPrefixPreviousOutput, "password", "password"))
+
+	// the output of the rerun step is still replaced
+	r.NoError(Output(wfCtx, cuectx.CompileString(`output: count: 2`), step, v1alpha1.StepStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+	}, nil))
+	result, err := wfCtx.GetVar("result", "count")
+	r.NoError(err)
+	n, err := result.Int64()
+	r.NoError(err)
+	r.Equal(int64(2), n)
+}
+
+func TestPrunedOutput(t *testing.T) {
+	wfCtx := mockContext(t)
+	r := require.New(t)
+	cuectx := cuecontext.New()
+	producer := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "build",
+			Outputs: v1alpha1.StepOutputs{{
+				ValueFrom: "output",
+				Name:      "image",
+				Retention: v1alpha1.OutputRetentionConsumed,
+			}},
+		},
+	}
+	consumer := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "deploy",
+			Inputs: v1alpha1.StepInputs{{
+				From:         "image.tag",
+				ParameterKey: "tag",
+			}},
+		},
+	}
+	r.NoError(Output(wfCtx, cuectx.CompileString(`output: tag: "v1"`), producer, v1alpha1.StepStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+	}, nil))
+	r.NoError(wfCtx.DeleteVar("image"))
+	wfCtx.SetMutableValue("build", wfTypes.ContextPrefixPrunedOutput, "image")
+	r.True(IsOutputPruned(wfCtx, "image.tag"))
+
+	// the pruned output is read from the previous output of the step
+	val, err := Input(wfCtx, cuectx.CompileString(`parameter: tag: string`), consumer)
+	r.NoError(err)
+	tag, err := val.LookupPath(cue.ParsePath("parameter.tag")).String()
+	r.NoError(err)
+	r.Equal("v1", tag)
+
+	// the output is no longer pruned once it's generated again
+	r.NoError(Output(wfCtx, cuectx.CompileString(`output: tag: "v2"`), producer, v1alpha1.StepStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+	}, nil))
+	r.False(IsOutputPruned(wfCtx, "image.tag"))
+	v, err := wfCtx.GetVar("image", "tag")
+	r.NoError(err)
+	tag, err = v.String()
+	r.NoError(err)
+	r.Equal("v2", tag)
+}
+
+func TestStepGroupResults(t *testing.T) {
+	wfCtx := mockContext(t)
+	r := require.New(t)
+	cuectx := cuecontext.New()
+	group := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "deploy", Type: "step-group"},
+		SubSteps: []v1alpha1.WorkflowStepBase{
+			{Name: "deploy-1", Outputs: v1alpha1.StepOutputs{{ValueFrom: "output", Name: "replicas1"}}},
+			{Name: "deploy-2", Outputs: v1alpha1.StepOutputs{{ValueFrom: "output", Name: "replicas2"}}},
+			{Name: "deploy-3", Outputs: v1alpha1.StepOutputs{{ValueFrom: "output", Name: "replicas3"}}},
+		},
+	}
+	for i, phase := range []v1alpha1.WorkflowStepPhase{v1alpha1.WorkflowStepPhaseSucceeded, v1alpha1.WorkflowStepPhaseFailed} {
+		sub := v1alpha1.WorkflowStep{WorkflowStepBase: group.SubSteps[i]}
+		r.NoError(SubStepOutput(wfCtx, cuectx.CompileString(`output: 3`), sub, v1alpha1.StepStatus{
+			Phase:  phase,
+			Reason: wfTypes.StatusReasonFailedAfterRetries,
+		}, nil))
+	}
+	// the sub steps are finished in the reverse order
+	status := v1alpha1.WorkflowStepStatus{SubStepsStatus: []v1alpha1.StepStatus{
+		{Name: "deploy-2", Phase: v1alpha1.WorkflowStepPhaseFailed},
+		{Name: "deploy-1", Phase: v1alpha1.WorkflowStepPhaseSucceeded},
+	}}
+	r.NoError(SetStepGroupResults(wfCtx, cuectx, group, status))
+
+	val, err := Input(wfCtx, cuectx.CompileString(`parameter: results: [...]`), v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name:   "report",
+			Inputs: v1alpha1.StepInputs{{From: "deploy.results", ParameterKey: "results"}},
+		},
+	})
+	r.NoError(err)
+	b, err := val.LookupPath(cue.ParsePath("parameter.results")).MarshalJSON()
+	r.NoError(err)
+	r.JSONEq(`[
+		{"name": "deploy-1", "phase": "succeeded", "outputs": {"replicas1": 3}},
+		{"name": "deploy-2", "phase": "failed"},
+		{"name": "deploy-3", "phase": "skipped"}
+	]`, string(b))
+
+	// the results are replaced when the group is executed again
+	status.SubStepsStatus[0].Phase = v1alpha1.WorkflowStepPhaseSkipped
+	r.NoError(SetStepGroupResults(wfCtx, cuectx, group, status))
+	v, err := wfCtx.GetVar("deploy", "results")
+	r.NoError(err)
+	phase, err := v.LookupPath(cue.MakePath(cue.Index(1), cue.Str("phase"))).String()
+	r.NoError(err)
+	r.Equal("skipped", phase)
+}
+
+func TestUnresolvedLazyInputs(t *testing.T) {
+	wfCtx := mockContext(t)
+	r := require.New(t)
+	cuectx := cuecontext.New()
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "migrate",
+			Inputs: v1alpha1.StepInputs{
+				{From: "schema.version", ParameterKey: "schema.version", Lazy: true},
+				{From: "image", ParameterKey: "image", Lazy: true},
+			},
+		},
+	}
+	paramValue := cuectx.CompileString(`parameter: {}`)
+	_, err := Input(wfCtx, paramValue, step)
+	r.NoError(err)
+	inputs := GetUnresolvedLazyInputs(wfCtx, step)
+	r.Equal(map[string]string{"schema.version": "schema.version", "image": "image"}, inputs)
+
+	// the default values of the parameters are not used for the unresolved lazy inputs
+	templ := UnresolvedLazyInputsTemplate(inputs)
+	r.Equal("parameter: image: _|_\nparameter: schema: version: _|_", templ)
+	v := cuectx.CompileString(`parameter: schema: version: *"v1" | string` + "\n" + templ)
+	r.Error(v.LookupPath(cue.ParsePath("parameter.schema.version")).Err())
+
+	// the resolved lazy inputs are not recorded
+	r.NoError(wfCtx.SetVar(cuectx.CompileString(`"v2"`), "schema", "version"))
+	_, err = Input(wfCtx, paramValue, step)
+	r.NoError(err)
+	r.Equal(map[string]string{"image": "image"}, GetUnresolvedLazyInputs(wfCtx, step))
+	r.NoError(wfCtx.SetVar(cuectx.CompileString(`"nginx"`), "image"))
+	_, err = Input(wfCtx, paramValue, step)
+	r.NoError(err)
+	r.Nil(GetUnresolvedLazyInputs(wfCtx, step))
+}
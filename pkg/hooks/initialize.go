@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// InitVars sets the init vars of the workflow instance in the context backend
+func InitVars(ctx wfContext.Context, instance *types.WorkflowInstance) error {
+	for name, value := range instance.InitVars {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		v := cuecontext.New().CompileBytes(b)
+		if v.Err() != nil {
+			return v.Err()
+		}
+		if err := ctx.SetVar(v, name); err != nil {
+			return errors.WithMessagef(err, "set init var %s", name)
+		}
+	}
+	return nil
+}
+
+// SharedInputsKey is the key of the shared inputs in the context backend, the steps read them from `shared.<name>`
+const SharedInputsKey = "shared"
+
+// SharedInputError is the error of resolving the shared input, e.g. the source doesn't exist, the run fails with it
+// instead of being retried
+type SharedInputError struct {
+	Name string
+	Err  error
+}
+
+// Error returns the message of the error
+func (e *SharedInputError) Error() string {
+	return fmt.Sprintf("shared input %s: %s", e.Name, e.Err.Error())
+}
+
+// Unwrap returns the cause of the error
+func (e *SharedInputError) Unwrap() error {
+	return e.Err
+}
+
+// SharedInputs resolves the shared inputs of the workflow instance and sets them in the context backend, they're
+// resolved once when the run is initialized so that the later changes of the sources are not seen by the steps
+func SharedInputs(ctx context.Context, cli client.Client, wfCtx wfContext.Context, instance *types.WorkflowInstance) error {
+	for _, input := range instance.Shared {
+		value, err := resolveSharedInput(ctx, cli, instance.Namespace, input)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return &SharedInputError{Name: input.Name, Err: err}
+		}
+		v := cuecontext.New().CompileBytes(b)
+		if v.Err() != nil {
+			return &SharedInputError{Name: input.Name, Err: v.Err()}
+		}
+		if err := wfCtx.SetVar(v, SharedInputsKey, input.Name); err != nil {
+			return &SharedInputError{Name: input.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// resolveSharedInput returns the SharedInputError if the source of the shared input doesn't exist, the other errors
+// of reading the source, e.g. the api server is unavailable, are returned as they are so that the run is retried
+func resolveSharedInput(ctx context.Context, cli client.Client, namespace string, input v1alpha1.SharedInput) (interface{}, error) {
+	ref := input.ConfigMapRef
+	if ref == nil {
+		return nil, &SharedInputError{Name: input.Name, Err: fmt.Errorf("no source is set")}
+	}
+	cm := &corev1.ConfigMap{}
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, cm); err != nil {
+		err = errors.WithMessagef(err, "get config map %s", ref.Name)
+		if kerrors.IsNotFound(err) {
+			return nil, &SharedInputError{Name: input.Name, Err: err}
+		}
+		return nil, errors.WithMessagef(err, "shared input %s", input.Name)
+	}
+	if ref.Key == "" {
+		return cm.Data, nil
+	}
+	value, ok := cm.Data[ref.Key]
+	if !ok {
+		return nil, &SharedInputError{Name: input.Name, Err: fmt.Errorf("key %s is not found in config map %s", ref.Key, ref.Name)}
+	}
+	return value, nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfTypes "github.com/kubevela/workflow/pkg/types"
+)
+
+func TestSharedInputs(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	wfCtx := mockContext(t)
+	cli := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "settings"},
+		Data:       map[string]string{"region": "us-east-1", "replicas": "3"},
+	}).Build()
+	instance := &wfTypes.WorkflowInstance{
+		WorkflowMeta: wfTypes.WorkflowMeta{Namespace: "default", Name: "run"},
+		Shared: []v1alpha1.SharedInput{
+			{Name: "region", ConfigMapRef: &v1alpha1.SharedInputSource{Name: "settings", Key: "region"}},
+			{Name: "settings", ConfigMapRef: &v1alpha1.SharedInputSource{Name: "settings"}},
+		},
+	}
+	r.NoError(SharedInputs(ctx, cli, wfCtx, instance))
+
+	// the steps read the shared inputs by their inputs
+	val, err := Input(wfCtx, cuecontext.New().CompileString(`parameter: {}`), v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Inputs: v1alpha1.StepInputs{
+				{From: "shared.region", ParameterKey: "region"},
+				{From: "shared.settings.replicas", ParameterKey: "replicas"},
+			},
+		},
+	})
+	r.NoError(err)
+	region, err := val.LookupPath(cue.ParsePath("parameter.region")).String()
+	r.NoError(err)
+	r.Equal("us-east-1", region)
+	replicas, err := val.LookupPath(cue.ParsePath("parameter.replicas")).String()
+	r.NoError(err)
+	r.Equal("3", replicas)
+
+	testCases := map[string]struct {
+		input v1alpha1.SharedInput
+		err   string
+	}{
+		"config map not found": {
+			input: v1alpha1.SharedInput{Name: "missing", ConfigMapRef: &v1alpha1.SharedInputSource{Name: "missing"}},
+			err:   "shared input missing: get config map missing",
+		},
+		"key not found": {
+			input: v1alpha1.SharedInput{Name: "zone", ConfigMapRef: &v1alpha1.SharedInputSource{Name: "settings", Key: "zone"}},
+			err:   "shared input zone: key zone is not found in config map settings",
+		},
+		"no source": {
+			input: v1alpha1.SharedInput{Name: "empty"},
+			err:   "shared input empty: no source is set",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			instance.Shared = []v1alpha1.SharedInput{tc.input}
+			err := SharedInputs(ctx, cli, mockContext(t), instance)
+			var sharedErr *SharedInputError
+			require.True(t, errors.As(err, &sharedErr))
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+
+	// the run is retried if the source can't be read
+	instance.Shared = []v1alpha1.SharedInput{{Name: "region", ConfigMapRef: &v1alpha1.SharedInputSource{Name: "settings", Key: "region"}}}
+	err = SharedInputs(ctx, &failedGetClient{Client: cli}, mockContext(t), instance)
+	r.EqualError(err, "shared input region: get config map settings: the server is currently unable to handle the request")
+	var sharedErr *SharedInputError
+	r.False(errors.As(err, &sharedErr))
+}
+
+type failedGetClient struct {
+	client.Client
+}
+
+func (c *failedGetClient) Get(_ context.Context, _ client.ObjectKey, _ client.Object, _ ...client.GetOption) error {
+	return kerrors.NewServiceUnavailable("the server is currently unable to handle the request")
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hooks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/cue/model/value"
+)
+
+// LookupOutput reads the value of the output from the task value and transforms it by the stages of its pipeline in
+// order. The error of a stage reports the index and the name of the stage.
+func LookupOutput(taskValue cue.Value, output v1alpha1.OutputItem) (cue.Value, error) {
+	v, err := value.LookupValueByScript(taskValue, output.ValueFrom)
+	if err != nil {
+		return v, err
+	}
+	return TransformOutput(v, output.Pipeline)
+}
+
+// TransformOutput applies the stages of the pipeline to the value in order, the result of a stage is the input of
+// the next one
+func TransformOutput(v cue.Value, pipeline []v1alpha1.OutputTransform) (cue.Value, error) {
+	for i, stage := range pipeline {
+		if v.Err() != nil {
+			return v, v.Err()
+		}
+		var err error
+		if v, err = transform(v, stage); err != nil {
+			return v, errors.WithMessagef(err, "pipeline stage %d (%s)", i, StageName(stage))
+		}
+	}
+	return v, nil
+}
+
+// StageName returns the name of the stage of the output pipeline, it defaults to the transform or `expression`
+func StageName(stage v1alpha1.OutputTransform) string {
+	switch {
+	case stage.Name != "":
+		return stage.Name
+	case stage.Transform != "":
+		return string(stage.Transform)
+	default:
+		return "expression"
+	}
+}
+
+func transform(v cue.Value, stage v1alpha1.OutputTransform) (cue.Value, error) {
+	if stage.Expression != "" {
+		scope := v.Context().CompileString("{}").FillPath(cue.ParsePath("value"), v)
+		result := v.Context().CompileString(stage.Expression, cue.Scope(scope))
+		if result.Err() != nil {
+			return result, result.Err()
+		}
+		if err := result.Validate(cue.Concrete(true)); err != nil {
+			return result, err
+		}
+		return result, nil
+	}
+	switch stage.Transform {
+	case v1alpha1.OutputTransformJSONStringify:
+		b, err := v.MarshalJSON()
+		if err != nil {
+			return v, err
+		}
+		return v.Context().Encode(string(b)), nil
+	case "":
+		return v, fmt.Errorf("either the transform or the expression must be set")
+	}
+	s, err := v.String()
+	if err != nil {
+		return v, errors.WithMessagef(err, "the input of %s must be a string", stage.Transform)
+	}
+	switch stage.Transform {
+	case v1alpha1.OutputTransformBase64Decode:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return v, err
+		}
+		return v.Context().Encode(string(b)), nil
+	case v1alpha1.OutputTransformBase64Encode:
+		return v.Context().Encode(base64.StdEncoding.EncodeToString([]byte(s))), nil
+	case v1alpha1.OutputTransformJSONParse:
+		return parseJSON(v.Context(), []byte(s))
+	case v1alpha1.OutputTransformYAMLParse:
+		b, err := yaml.YAMLToJSON([]byte(s))
+		if err != nil {
+			return v, err
+		}
+		return parseJSON(v.Context(), b)
+	case v1alpha1.OutputTransformTrim:
+		return v.Context().Encode(strings.TrimSpace(s)), nil
+	default:
+		return v, fmt.Errorf("unknown transform %s", stage.Transform)
+	}
+}
+
+// parseJSON compiles the JSON as a CUE value, so that the numbers are kept as they are
+func parseJSON(cuectx *cue.Context, data []byte) (cue.Value, error) {
+	var x interface{}
+	if err := json.Unmarshal(data, &x); err != nil {
+		return cue.Value{}, err
+	}
+	v := cuectx.CompileBytes(data)
+	return v, v.Err()
+}
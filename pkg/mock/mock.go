@@ -20,8 +20,12 @@ import "github.com/kubevela/workflow/api/v1alpha1"
 
 // Action ...
 type Action struct {
-	Phase string
-	Msg   string
+	Phase  string
+	Msg    string
+	Sub    string
+	Token  string
+	Meta   map[string]string
+	Status v1alpha1.StepStatus
 }
 
 // Suspend makes the step suspend
@@ -34,7 +38,7 @@ func (act *Action) Suspend(message string) {
 
 // GetStatus returns the step status
 func (act *Action) GetStatus() v1alpha1.StepStatus {
-	return v1alpha1.StepStatus{}
+	return act.Status
 }
 
 // Resume makes the step resume
@@ -69,6 +73,26 @@ func (act *Action) Fail(message string) {
 	}
 }
 
+// SubPhase writes sub phase to step status
+func (act *Action) SubPhase(subPhase string) {
+	act.Sub = subPhase
+}
+
+// ContinuationToken writes the continuation token to step status
+func (act *Action) ContinuationToken(token string) {
+	act.Token = token
+}
+
+// Metadata writes the metadata to step status
+func (act *Action) Metadata(metadata map[string]string) {
+	if act.Meta == nil {
+		act.Meta = make(map[string]string)
+	}
+	for k, v := range metadata {
+		act.Meta[k] = v
+	}
+}
+
 // Message write message to step status
 func (act *Action) Message(message string) {
 	act.Phase = "Fail"
@@ -0,0 +1,194 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StepMetricType is the type of the custom metric emitted by the steps
+type StepMetricType string
+
+const (
+	// StepMetricCounter is the counter that the recorded values are added to, e.g. the records processed
+	StepMetricCounter StepMetricType = "counter"
+	// StepMetricGauge is the gauge that is set to the recorded value, e.g. the size of the queue
+	StepMetricGauge StepMetricType = "gauge"
+)
+
+// StepMetricPrefix is the prefix of the names of the custom step metrics exposed by the controller
+const StepMetricPrefix = "workflowrun_custom_"
+
+// MaxStepMetricSeries is the max number of the label values of each custom step metric, the values out of the
+// limit are rejected to bound the cardinality of the metrics
+var MaxStepMetricSeries = 100
+
+// StepMetricSeriesIdleTimeout is the duration after which the label values that are not recorded are released, so
+// that the new label values can be recorded once the metric reaches MaxStepMetricSeries
+var StepMetricSeriesIdleTimeout = time.Hour
+
+var stepMetricNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// stepMetricSeries is the label values recorded for the custom metric
+type stepMetricSeries struct {
+	values       []string
+	lastRecorded time.Time
+}
+
+// stepMetric is a custom metric registered in the allowlist
+type stepMetric struct {
+	typ       StepMetricType
+	labels    []string
+	collector prometheus.Collector
+	// series are the time that the label values are last recorded, keyed by the joined values
+	series map[string]stepMetricSeries
+}
+
+var (
+	stepMetricsMu sync.Mutex
+	// stepMetrics is the allowlist of the custom metrics that the steps can emit, keyed by the name
+	stepMetrics = map[string]*stepMetric{}
+)
+
+// SetStepMetrics registers the allowlist of the custom metrics that the steps can emit, each metric is in the format
+// of `name:type[:label,...]`, e.g. `records_processed:counter:source,region`. The metric is exposed with the prefix
+// workflowrun_custom_, and only the declared labels can be recorded.
+func SetStepMetrics(specs []string) error {
+	registered := map[string]*stepMetric{}
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("invalid step metric %s, the format should be name:type[:label,...]", spec)
+		}
+		name, typ := parts[0], StepMetricType(parts[1])
+		if !stepMetricNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid name of step metric %s", spec)
+		}
+		if _, ok := registered[name]; ok {
+			return fmt.Errorf("step metric %s is duplicated", name)
+		}
+		var labels []string
+		if len(parts) == 3 && parts[2] != "" {
+			labels = strings.Split(parts[2], ",")
+		}
+		for _, label := range labels {
+			if !stepMetricNameRegexp.MatchString(label) || strings.HasPrefix(label, "__") {
+				return fmt.Errorf("invalid label %s of step metric %s", label, name)
+			}
+		}
+		m := &stepMetric{typ: typ, labels: labels, series: map[string]stepMetricSeries{}}
+		help := fmt.Sprintf("custom %s %s emitted by the workflow steps", typ, name)
+		switch typ {
+		case StepMetricCounter:
+			m.collector = prometheus.NewCounterVec(prometheus.CounterOpts{Name: StepMetricPrefix + name, Help: help}, labels)
+		case StepMetricGauge:
+			m.collector = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: StepMetricPrefix + name, Help: help}, labels)
+		default:
+			return fmt.Errorf("invalid type %s of step metric %s, only %s and %s are supported", typ, name, StepMetricCounter, StepMetricGauge)
+		}
+		registered[name] = m
+	}
+	stepMetricsMu.Lock()
+	defer stepMetricsMu.Unlock()
+	stepMetrics = registered
+	return nil
+}
+
+// RecordStepMetric records the value of the custom metric emitted by the steps. The value is added to a counter
+// and set to a gauge. The metric must be registered in the allowlist, the labels must be declared by the metric,
+// and the new label values are rejected once the metric reaches MaxStepMetricSeries. The label values that are not
+// recorded for StepMetricSeriesIdleTimeout are released when the metric reaches the limit.
+func RecordStepMetric(name string, value float64, labels map[string]string, now time.Time) error {
+	stepMetricsMu.Lock()
+	defer stepMetricsMu.Unlock()
+	m, ok := stepMetrics[name]
+	if !ok {
+		return fmt.Errorf("step metric %s is not registered", name)
+	}
+	for label := range labels {
+		if !slices.Contains(m.labels, label) {
+			return fmt.Errorf("label %s is not declared by step metric %s", label, name)
+		}
+	}
+	values := make([]string, 0, len(m.labels))
+	for _, label := range m.labels {
+		values = append(values, labels[label])
+	}
+	key := strings.Join(values, "\x00")
+	if _, ok := m.series[key]; !ok && len(m.series) >= MaxStepMetricSeries {
+		m.releaseIdleSeries(now)
+		if len(m.series) >= MaxStepMetricSeries {
+			return fmt.Errorf("step metric %s exceeds the max %d series", name, MaxStepMetricSeries)
+		}
+	}
+	switch vec := m.collector.(type) {
+	case *prometheus.CounterVec:
+		if value < 0 {
+			return fmt.Errorf("the value of counter %s can't be negative, got %v", name, value)
+		}
+		vec.WithLabelValues(values...).Add(value)
+	case *prometheus.GaugeVec:
+		vec.WithLabelValues(values...).Set(value)
+	}
+	m.series[key] = stepMetricSeries{values: values, lastRecorded: now}
+	return nil
+}
+
+// releaseIdleSeries deletes the label values that are not recorded for StepMetricSeriesIdleTimeout
+func (m *stepMetric) releaseIdleSeries(now time.Time) {
+	for key, series := range m.series {
+		if now.Sub(series.lastRecorded) < StepMetricSeriesIdleTimeout {
+			continue
+		}
+		switch vec := m.collector.(type) {
+		case *prometheus.CounterVec:
+			vec.DeleteLabelValues(series.values...)
+		case *prometheus.GaugeVec:
+			vec.DeleteLabelValues(series.values...)
+		}
+		delete(m.series, key)
+	}
+}
+
+// stepMetricsCollector collects the custom step metrics. It's registered as an unchecked collector without
+// descriptors, since the allowlist is registered after the collectors.
+type stepMetricsCollector struct{}
+
+// Describe implements prometheus.Collector
+func (stepMetricsCollector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (stepMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	stepMetricsMu.Lock()
+	defer stepMetricsMu.Unlock()
+	names := make([]string, 0, len(stepMetrics))
+	for name := range stepMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stepMetrics[name].collector.Collect(ch)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestSetStepMetrics(t *testing.T) {
+	r := require.New(t)
+	defer func() {
+		r.NoError(SetStepMetrics(nil))
+	}()
+
+	r.EqualError(SetStepMetrics([]string{"records"}), "invalid step metric records, the format should be name:type[:label,...]")
+	r.EqualError(SetStepMetrics([]string{"records-processed:counter"}), "invalid name of step metric records-processed:counter")
+	r.EqualError(SetStepMetrics([]string{"records:histogram"}), "invalid type histogram of step metric records, only counter and gauge are supported")
+	r.EqualError(SetStepMetrics([]string{"records:counter:source,__name"}), "invalid label __name of step metric records")
+	r.EqualError(SetStepMetrics([]string{"records:counter", "records:gauge"}), "step metric records is duplicated")
+
+	r.NoError(SetStepMetrics([]string{"records_processed:counter:source,region", "queue_size:gauge"}))
+	now := time.Now()
+	r.EqualError(RecordStepMetric("unknown", 1, nil, now), "step metric unknown is not registered")
+	r.EqualError(RecordStepMetric("records_processed", 1, map[string]string{"run": "wr"}, now), "label run is not declared by step metric records_processed")
+	r.EqualError(RecordStepMetric("records_processed", -1, nil, now), "the value of counter records_processed can't be negative, got -1")
+
+	r.NoError(RecordStepMetric("records_processed", 2, map[string]string{"source": "kafka"}, now))
+	r.NoError(RecordStepMetric("records_processed", 3, map[string]string{"source": "kafka"}, now))
+	r.NoError(RecordStepMetric("queue_size", 5, nil, now))
+	r.NoError(RecordStepMetric("queue_size", 4, nil, now))
+	counter := stepMetrics["records_processed"].collector.(*prometheus.CounterVec)
+	r.Equal(5.0, testutil.ToFloat64(counter.WithLabelValues("kafka", "")))
+	gauge := stepMetrics["queue_size"].collector.(*prometheus.GaugeVec)
+	r.Equal(4.0, testutil.ToFloat64(gauge.WithLabelValues()))
+
+	// the custom metrics are gathered by the registry with the prefix
+	mfs, err := metrics.Registry.Gather()
+	r.NoError(err)
+	found := map[string]bool{}
+	for _, mf := range mfs {
+		found[mf.GetName()] = true
+	}
+	r.True(found["workflowrun_custom_records_processed"])
+	r.True(found["workflowrun_custom_queue_size"])
+
+	defer func() {
+		MaxStepMetricSeries = 100
+	}()
+	MaxStepMetricSeries = 2
+	r.NoError(RecordStepMetric("records_processed", 1, map[string]string{"source": "s3"}, now))
+	r.EqualError(RecordStepMetric("records_processed", 1, map[string]string{"source": "gcs"}, now), "step metric records_processed exceeds the max 2 series")
+	// the recorded label values can still be updated
+	r.NoError(RecordStepMetric("records_processed", 1, map[string]string{"source": "kafka"}, now))
+	// the idle label values are released once the metric reaches the limit
+	later := now.Add(StepMetricSeriesIdleTimeout / 2)
+	r.NoError(RecordStepMetric("records_processed", 1, map[string]string{"source": "kafka"}, later))
+	r.NoError(RecordStepMetric("records_processed", 1, map[string]string{"source": "gcs"}, now.Add(StepMetricSeriesIdleTimeout)))
+	r.Equal(2, testutil.CollectAndCount(counter))
+	r.Equal(7.0, testutil.ToFloat64(counter.WithLabelValues("kafka", "")))
+	r.EqualError(RecordStepMetric("records_processed", 1, map[string]string{"source": "s3"}, now.Add(StepMetricSeriesIdleTimeout)), "step metric records_processed exceeds the max 2 series")
+}
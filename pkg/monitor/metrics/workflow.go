@@ -17,7 +17,11 @@ limitations under the License.
 package metrics
 
 import (
+	"fmt"
+	"regexp"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
@@ -41,19 +45,11 @@ var (
 		ConstLabels: prometheus.Labels{},
 	}, []string{"controller"})
 
-	// WorkflowRunPhaseCounter report the number of workflow run phase
-	WorkflowRunPhaseCounter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "workflowrun_phase_number",
-		Help: "workflow run phase number",
-	}, []string{"phase"})
+	// WorkflowRunPhaseCounter report the number of workflow run phase, it's labeled with the promoted run labels
+	WorkflowRunPhaseCounter = newWorkflowRunPhaseCounter()
 
-	// WorkflowRunFinishedTimeHistogram report the time for finished workflow run
-	WorkflowRunFinishedTimeHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name:        "workflowrun_finished_time_seconds",
-		Help:        "workflow run finished time distributions.",
-		Buckets:     velametrics.FineGrainedBuckets,
-		ConstLabels: prometheus.Labels{},
-	}, []string{"phase"})
+	// WorkflowRunFinishedTimeHistogram report the time for finished workflow run, it's labeled with the promoted run labels
+	WorkflowRunFinishedTimeHistogram = newWorkflowRunFinishedTimeHistogram()
 
 	// WorkflowRunInitializedCounter report the workflow run initialize execute number.
 	WorkflowRunInitializedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
@@ -61,6 +57,18 @@ var (
 		Help: "workflow run initialize times",
 	}, []string{})
 
+	// WorkflowRunTerminalReconcileCounter report the number of the reconciles that are short-circuited for the finished workflow runs
+	WorkflowRunTerminalReconcileCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "workflowrun_terminal_reconcile_num",
+		Help: "workflow run terminal reconcile times",
+	}, []string{"phase"})
+
+	// WorkflowRunStatusUpdateConflictCounter report the number of the conflicts of the status updates of the workflow runs
+	WorkflowRunStatusUpdateConflictCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "workflowrun_status_update_conflict_num",
+		Help: "workflow run status update conflict times",
+	}, []string{"method"})
+
 	// WorkflowRunStepPhaseGauge report the number of workflow run step state
 	WorkflowRunStepPhaseGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "workflowrun_step_phase_number",
@@ -74,16 +82,112 @@ var (
 		Buckets:     velametrics.FineGrainedBuckets,
 		ConstLabels: prometheus.Labels{},
 	}, []string{"controller", "step_type"})
+
+	// WorkflowRunTenantInflightGauge report the number of the in-flight reconciles of the workflow runs of every tenant
+	WorkflowRunTenantInflightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "workflowrun_tenant_inflight_reconcile_number",
+		Help: "workflow run in-flight reconcile number of the tenant",
+	}, []string{"tenant"})
+
+	// WorkflowRunTenantThrottledCounter report the number of the reconciles that are requeued since the tenant reaches its concurrent reconciles
+	WorkflowRunTenantThrottledCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "workflowrun_tenant_throttled_reconcile_num",
+		Help: "workflow run throttled reconcile times of the tenant",
+	}, []string{"tenant"})
 )
 
 var collectorGroup = []prometheus.Collector{
 	GenerateTaskRunnersDurationHistogram,
 	WorkflowRunStepDurationHistogram,
 	WorkflowRunReconcileTimeHistogram,
-	WorkflowRunFinishedTimeHistogram,
 	WorkflowRunInitializedCounter,
-	WorkflowRunPhaseCounter,
+	WorkflowRunTerminalReconcileCounter,
+	WorkflowRunStatusUpdateConflictCounter,
 	WorkflowRunStepPhaseGauge,
+	WorkflowRunTenantInflightGauge,
+	WorkflowRunTenantThrottledCounter,
+	runMetrics{},
+	stepMetricsCollector{},
+}
+
+// MaxRunLabelKeys is the max number of the run labels promoted to the metric labels, it bounds the cardinality of
+// the run metrics
+const MaxRunLabelKeys = 5
+
+// runLabelKeys are the keys of the run labels promoted to the metric labels, e.g. team or cost-center
+var runLabelKeys []string
+
+var invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func newWorkflowRunPhaseCounter() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "workflowrun_phase_number",
+		Help: "workflow run phase number",
+	}, append([]string{"phase"}, runLabelNames()...))
+}
+
+func newWorkflowRunFinishedTimeHistogram() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "workflowrun_finished_time_seconds",
+		Help:        "workflow run finished time distributions.",
+		Buckets:     velametrics.FineGrainedBuckets,
+		ConstLabels: prometheus.Labels{},
+	}, append([]string{"phase"}, runLabelNames()...))
+}
+
+// runLabelNames returns the metric label names of the promoted run labels, e.g. label_cost_center for cost-center
+func runLabelNames() []string {
+	names := make([]string, 0, len(runLabelKeys))
+	for _, key := range runLabelKeys {
+		names = append(names, "label_"+invalidLabelNameChars.ReplaceAllString(key, "_"))
+	}
+	return names
+}
+
+// runMetrics collects the metrics labeled with the promoted run labels. It's registered as an unchecked collector
+// without descriptors, since the registry doesn't allow the label names of a registered metric to be changed.
+type runMetrics struct{}
+
+// Describe implements prometheus.Collector
+func (runMetrics) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (runMetrics) Collect(ch chan<- prometheus.Metric) {
+	WorkflowRunPhaseCounter.Collect(ch)
+	WorkflowRunFinishedTimeHistogram.Collect(ch)
+}
+
+// SetRunLabelKeys promotes the labels of the runs to the labels of the run phase and finished time metrics, so that
+// the metrics can be broken down by them. The metrics are recreated, so it should be called before the metrics are
+// reported.
+func SetRunLabelKeys(keys []string) error {
+	if len(keys) > MaxRunLabelKeys {
+		return fmt.Errorf("at most %d run labels can be promoted to the metric labels, got %d", MaxRunLabelKeys, len(keys))
+	}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid run label %s: %v", key, errs)
+		}
+		name := invalidLabelNameChars.ReplaceAllString(key, "_")
+		if seen[name] {
+			return fmt.Errorf("run label %s is duplicated in the metric labels", key)
+		}
+		seen[name] = true
+	}
+	runLabelKeys = keys
+	WorkflowRunPhaseCounter = newWorkflowRunPhaseCounter()
+	WorkflowRunFinishedTimeHistogram = newWorkflowRunFinishedTimeHistogram()
+	return nil
+}
+
+// RunLabelValues returns the values of the promoted labels of the run, the value is empty if the run doesn't have the label
+func RunLabelValues(labels map[string]string) []string {
+	values := make([]string, 0, len(runLabelKeys))
+	for _, key := range runLabelKeys {
+		values = append(values, labels[key])
+	}
+	return values
 }
 
 func init() {
@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+func TestSetRunLabelKeys(t *testing.T) {
+	r := require.New(t)
+	defer func() {
+		r.NoError(SetRunLabelKeys(nil))
+	}()
+
+	r.EqualError(SetRunLabelKeys([]string{"a", "b", "c", "d", "e", "f"}), "at most 5 run labels can be promoted to the metric labels, got 6")
+	r.ErrorContains(SetRunLabelKeys([]string{"team!"}), "invalid run label team!")
+	r.EqualError(SetRunLabelKeys([]string{"cost-center", "cost.center"}), "run label cost.center is duplicated in the metric labels")
+
+	r.NoError(SetRunLabelKeys([]string{"team", "example.com/cost-center"}))
+	labels := map[string]string{"team": "payments", "other": "ignored"}
+	r.Equal([]string{"payments", ""}, RunLabelValues(labels))
+	WorkflowRunFinishedTimeHistogram.WithLabelValues(append([]string{"succeeded"}, RunLabelValues(labels)...)...).Observe(1)
+	WorkflowRunPhaseCounter.WithLabelValues(append([]string{"executing"}, RunLabelValues(labels)...)...).Set(2)
+	r.Equal(2.0, testutil.ToFloat64(WorkflowRunPhaseCounter.WithLabelValues("executing", "payments", "")))
+
+	// the recreated metrics are gathered by the registry
+	mfs, err := metrics.Registry.Gather()
+	r.NoError(err)
+	found := map[string]string{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "label_team" {
+					found[mf.GetName()] = l.GetValue()
+				}
+			}
+		}
+	}
+	r.Equal(map[string]string{"workflowrun_phase_number": "payments", "workflowrun_finished_time_seconds": "payments"}, found)
+}
@@ -58,7 +58,8 @@ func (watcher *workflowRunMetricsWatcher) getPhase(phase string) string {
 func (watcher *workflowRunMetricsWatcher) inc(wr *v1alpha1.WorkflowRun, delta int) {
 	watcher.mu.Lock()
 	defer watcher.mu.Unlock()
-	phase := watcher.getPhase(string(wr.Status.Phase))
+	// the phase is counted with the values of the promoted run labels, which never contain the separator
+	phase := strings.Join(append([]string{watcher.getPhase(string(wr.Status.Phase))}, metrics.RunLabelValues(wr.Labels)...), "/")
 	watcher.phaseCounter[phase] += delta
 	watcher.phaseDirty[phase] = struct{}{}
 	for _, step := range wr.Status.Steps {
@@ -73,7 +74,7 @@ func (watcher *workflowRunMetricsWatcher) report() {
 	watcher.mu.Lock()
 	defer watcher.mu.Unlock()
 	for phase := range watcher.phaseDirty {
-		metrics.WorkflowRunPhaseCounter.WithLabelValues(phase).Set(float64(watcher.phaseCounter[phase]))
+		metrics.WorkflowRunPhaseCounter.WithLabelValues(strings.Split(phase, "/")...).Set(float64(watcher.phaseCounter[phase]))
 	}
 	for stepPhase := range watcher.stepPhaseDirty {
 		metrics.WorkflowRunStepPhaseGauge.WithLabelValues(strings.Split(stepPhase, "/")[:2]...).Set(float64(watcher.stepPhaseCounter[stepPhase]))
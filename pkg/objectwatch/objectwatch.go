@@ -0,0 +1,293 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectwatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kubevela/pkg/util/singleton"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReconnectInterval is the interval to wait before re-establishing the watch that is closed or failed
+var ReconnectInterval = 5 * time.Second
+
+// SubscriptionTTL is how long a subscription is kept without being renewed by the waiting step, the watch is
+// stopped once it has no subscriptions
+var SubscriptionTTL = 10 * time.Minute
+
+// MaxWatches is the max number of the objects watched at once, the runs waiting for the other objects read them from
+// the cluster every time they're reconciled. No limit if it's not positive
+var MaxWatches = 1000
+
+// Client is the client to watch the objects, it's built from the config of the controller by default
+var Client = singleton.NewSingletonE[client.WithWatch](func() (client.WithWatch, error) {
+	return client.NewWithWatch(singleton.KubeConfig.Get(), client.Options{Mapper: singleton.RESTMapper.Get()})
+})
+
+// Key identifies the watched object
+type Key struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+}
+
+// Subscriber identifies the run waiting for the condition of the object
+type Subscriber struct {
+	Namespace string
+	Name      string
+	Condition string
+}
+
+// Check checks if the condition of the object is met, the object is nil if it's not found
+type Check func(obj *unstructured.Unstructured) bool
+
+type subscription struct {
+	check   Check
+	met     bool
+	renewed time.Time
+}
+
+type objectWatch struct {
+	cancel context.CancelFunc
+	// synced is true once the object is read, until the watch is closed. The object is nil if it's not found
+	synced      bool
+	object      *unstructured.Unstructured
+	subscribers map[Subscriber]*subscription
+}
+
+// Manager shares the watches of the objects among the runs waiting for them, and notifies the runs once the
+// conditions they're waiting for flip, so that the runs don't have to poll the objects
+type Manager struct {
+	mu      sync.Mutex
+	watches map[Key]*objectWatch
+	notify  func(namespace, name string)
+}
+
+// DefaultManager is the manager of the watches used by the providers
+var DefaultManager = NewManager()
+
+// NewManager creates a manager of the watches
+func NewManager() *Manager {
+	return &Manager{watches: map[Key]*objectWatch{}}
+}
+
+// SetNotifier sets the function called with the run once the condition it's waiting for flips
+func (m *Manager) SetNotifier(notify func(namespace, name string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = notify
+}
+
+// Subscribe subscribes the run to the condition of the object, the watch of the object is started if it's not. It
+// returns the latest object received by the watch, which is nil if the object is not found, and false if the watch
+// is not synced, e.g. it's just started or reconnecting, or the object can't be watched since there're MaxWatches
+// watches already, in which case the object should be read from the cluster.
+func (m *Manager) Subscribe(key Key, sub Subscriber, check Check) (*unstructured.Unstructured, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.watches[key]
+	if !ok {
+		if MaxWatches > 0 && len(m.watches) >= MaxWatches {
+			return nil, false
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		w = &objectWatch{cancel: cancel, subscribers: map[Subscriber]*subscription{}}
+		m.watches[key] = w
+		go m.run(ctx, key, w)
+	}
+	s, ok := w.subscribers[sub]
+	if !ok {
+		s = &subscription{}
+		w.subscribers[sub] = s
+	}
+	s.check, s.renewed = check, time.Now()
+	if !w.synced {
+		s.met = false
+		return nil, false
+	}
+	s.met = check(w.object)
+	if w.object == nil {
+		return nil, true
+	}
+	return w.object.DeepCopy(), true
+}
+
+// Unsubscribe removes the subscription of the run, the watch is stopped once it has no subscriptions
+func (m *Manager) Unsubscribe(key Key, sub Subscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.watches[key]
+	if !ok {
+		return
+	}
+	delete(w.subscribers, sub)
+	m.stopIfIdle(key, w)
+}
+
+// stopIfIdle drops the expired subscriptions, e.g. the ones of the deleted runs, and stops the watch once it has no
+// subscriptions. It returns true if the watch is stopped
+func (m *Manager) stopIfIdle(key Key, w *objectWatch) bool {
+	for sub, s := range w.subscribers {
+		if time.Since(s.renewed) > SubscriptionTTL {
+			delete(w.subscribers, sub)
+		}
+	}
+	if len(w.subscribers) == 0 {
+		w.cancel()
+		if m.watches[key] == w {
+			delete(m.watches, key)
+		}
+		return true
+	}
+	return false
+}
+
+// run reads the object and watches it until the watch is stopped, the watch is re-established after it's closed or
+// failed, unless it has no subscriptions any more
+func (m *Manager) run(ctx context.Context, key Key, w *objectWatch) {
+	for {
+		if rv, ok := m.sync(ctx, key, w); ok {
+			m.watch(ctx, key, w, rv)
+		}
+		m.mu.Lock()
+		w.synced = false
+		stopped := m.stopIfIdle(key, w)
+		m.mu.Unlock()
+		if stopped {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ReconnectInterval):
+		}
+	}
+}
+
+// sync reads the object to catch up the changes missed while the watch is not established, it returns the resource
+// version to start the watch from
+func (m *Manager) sync(ctx context.Context, key Key, w *objectWatch) (string, bool) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(key.APIVersion)
+	obj.SetKind(key.Kind)
+	if err := Client.Get().Get(ctx, client.ObjectKey{Namespace: key.Namespace, Name: key.Name}, obj); err != nil {
+		if !kerrors.IsNotFound(err) {
+			klog.ErrorS(err, "failed to read the watched object", "kind", key.Kind, "namespace", key.Namespace, "name", key.Name)
+			return "", false
+		}
+		obj = nil
+	}
+	m.update(key, w, obj, true)
+	if obj == nil {
+		return "", true
+	}
+	return obj.GetResourceVersion(), true
+}
+
+func (m *Manager) watch(ctx context.Context, key Key, w *objectWatch, resourceVersion string) {
+	list := &unstructured.UnstructuredList{}
+	list.SetAPIVersion(key.APIVersion)
+	list.SetKind(key.Kind + "List")
+	watcher, err := Client.Get().Watch(ctx, list, &client.ListOptions{
+		Namespace:     key.Namespace,
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", key.Name),
+		Raw:           &metav1.ListOptions{ResourceVersion: resourceVersion},
+	})
+	if err != nil {
+		klog.ErrorS(err, "failed to watch the object", "kind", key.Kind, "namespace", key.Namespace, "name", key.Name)
+		return
+	}
+	defer watcher.Stop()
+	prune := time.NewTicker(SubscriptionTTL)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-prune.C:
+			m.mu.Lock()
+			m.stopIfIdle(key, w)
+			m.mu.Unlock()
+		case e, ok := <-watcher.ResultChan():
+			if !ok || e.Type == watch.Error {
+				return
+			}
+			obj, err := toUnstructured(e.Object)
+			if err != nil || obj.GetName() != key.Name || obj.GetNamespace() != key.Namespace {
+				continue
+			}
+			obj.SetAPIVersion(key.APIVersion)
+			obj.SetKind(key.Kind)
+			switch e.Type {
+			case watch.Added, watch.Modified:
+				m.update(key, w, obj, false)
+			case watch.Deleted:
+				m.update(key, w, nil, false)
+			}
+		}
+	}
+}
+
+// update sets the latest object of the watch and notifies the runs whose conditions flip
+func (m *Manager) update(key Key, w *objectWatch, obj *unstructured.Unstructured, synced bool) {
+	m.mu.Lock()
+	if m.watches[key] != w {
+		m.mu.Unlock()
+		return
+	}
+	w.object = obj
+	if synced {
+		w.synced = true
+	}
+	var flipped []Subscriber
+	for sub, s := range w.subscribers {
+		if met := s.check(obj); met != s.met {
+			s.met = met
+			flipped = append(flipped, sub)
+		}
+	}
+	notify := m.notify
+	m.mu.Unlock()
+	if notify == nil {
+		return
+	}
+	for _, sub := range flipped {
+		notify(sub.Namespace, sub.Name)
+	}
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: m}, nil
+}
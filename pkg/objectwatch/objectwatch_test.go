@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectwatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestManager(t *testing.T) {
+	r := require.New(t)
+	cli := fake.NewClientBuilder().Build()
+	Client.Set(cli)
+	ReconnectInterval = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	var notified []string
+	m := NewManager()
+	m.SetNotifier(func(namespace, name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, namespace+"/"+name)
+	})
+	notifications := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, notified...)
+	}
+	key := Key{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "settings"}
+	sub := Subscriber{Namespace: "default", Name: "run", Condition: "ready"}
+	check := func(obj *unstructured.Unstructured) bool {
+		if obj == nil {
+			return false
+		}
+		ready, _, _ := unstructured.NestedString(obj.Object, "data", "ready")
+		return ready == "true"
+	}
+
+	// the object is read from the cluster until the watch is synced
+	obj, synced := m.Subscribe(key, sub, check)
+	r.False(synced)
+	r.Nil(obj)
+	r.Eventually(func() bool {
+		_, synced = m.Subscribe(key, sub, check)
+		return synced
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// the run is notified once the condition flips
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+		Data:       map[string]string{"ready": "false"},
+	}
+	r.NoError(cli.Create(context.Background(), cm))
+	r.Eventually(func() bool {
+		obj, _ = m.Subscribe(key, sub, check)
+		return obj != nil
+	}, 3*time.Second, 10*time.Millisecond)
+	r.Empty(notifications())
+	cm.Data["ready"] = "true"
+	r.NoError(cli.Update(context.Background(), cm))
+	r.Eventually(func() bool {
+		return len(notifications()) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	r.Equal([]string{"default/run"}, notifications())
+	obj, synced = m.Subscribe(key, sub, check)
+	r.True(synced)
+	r.True(check(obj))
+
+	// the other objects in the namespace are ignored
+	r.NoError(cli.Create(context.Background(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "others", Namespace: "default"},
+	}))
+
+	// the deletion flips the condition as well
+	r.NoError(cli.Delete(context.Background(), cm))
+	r.Eventually(func() bool {
+		return len(notifications()) == 2
+	}, 3*time.Second, 10*time.Millisecond)
+	obj, synced = m.Subscribe(key, sub, check)
+	r.True(synced)
+	r.Nil(obj)
+
+	// the watch is stopped once it has no subscriptions
+	m.Unsubscribe(key, sub)
+	m.mu.Lock()
+	r.Empty(m.watches)
+	m.mu.Unlock()
+}
+
+type failingClient struct {
+	client.WithWatch
+}
+
+func (c failingClient) Get(_ context.Context, _ client.ObjectKey, _ client.Object, _ ...client.GetOption) error {
+	return errors.New("unavailable")
+}
+
+func TestManagerStopsFailingWatch(t *testing.T) {
+	r := require.New(t)
+	Client.Set(failingClient{WithWatch: fake.NewClientBuilder().Build()})
+	ReconnectInterval = 10 * time.Millisecond
+	ttl := SubscriptionTTL
+	defer func() { SubscriptionTTL = ttl }()
+	SubscriptionTTL = 50 * time.Millisecond
+
+	m := NewManager()
+	key := Key{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "settings"}
+	check := func(obj *unstructured.Unstructured) bool { return obj != nil }
+	_, synced := m.Subscribe(key, Subscriber{Namespace: "default", Name: "deleted-run"}, check)
+	r.False(synced)
+
+	// the watch keeps failing to sync, it's stopped once the subscription of the deleted run expires
+	r.Eventually(func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.watches) == 0
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestManagerMaxWatches(t *testing.T) {
+	r := require.New(t)
+	Client.Set(fake.NewClientBuilder().Build())
+	ReconnectInterval = 10 * time.Millisecond
+	maxWatches := MaxWatches
+	defer func() { MaxWatches = maxWatches }()
+	MaxWatches = 1
+
+	m := NewManager()
+	check := func(obj *unstructured.Unstructured) bool { return obj != nil }
+	first := Key{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "first"}
+	second := Key{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "second"}
+	sub := Subscriber{Namespace: "default", Name: "run"}
+	m.Subscribe(first, sub, check)
+	r.Eventually(func() bool {
+		_, synced := m.Subscribe(first, sub, check)
+		return synced
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// the object beyond the limit is not watched, so it's read from the cluster
+	_, synced := m.Subscribe(second, sub, check)
+	r.False(synced)
+	m.mu.Lock()
+	r.Len(m.watches, 1)
+	m.mu.Unlock()
+
+	// the object is watched once the other watch is stopped
+	m.Unsubscribe(first, sub)
+	m.Subscribe(second, sub, check)
+	m.mu.Lock()
+	r.Contains(m.watches, second)
+	m.mu.Unlock()
+	m.Unsubscribe(second, sub)
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+
+	"github.com/kubevela/workflow/pkg/errors"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+)
+
+// Assertion is an assertion of the actual value, the actual value should equal the expected value if it's set,
+// and the condition should be true if it's set.
+type Assertion struct {
+	Actual any `json:"actual"`
+	// Expected is kept raw to tell the expected null from the unset one
+	Expected json.RawMessage `json:"expected,omitempty"`
+	// Condition is the cue expression over the actual value, e.g. `actual >= 3` or `len(actual.items) > 0`
+	Condition string `json:"condition,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// AssertVars .
+type AssertVars struct {
+	Assertions map[string]Assertion `json:"assertions"`
+}
+
+// AssertParams .
+type AssertParams = providertypes.Params[AssertVars]
+
+// Assert checks the assertions, the step fails with the differences between the expected and actual values of
+// the failed assertions, its status is failed and reason is Action
+func Assert(_ context.Context, params *AssertParams) (*any, error) {
+	assertions := params.Params.Assertions
+	if len(assertions) == 0 {
+		return nil, fmt.Errorf("the assertions of assert can not be empty")
+	}
+	names := make([]string, 0, len(assertions))
+	for name := range assertions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var failures []string
+	for _, name := range names {
+		assertion := assertions[name]
+		diffs, err := checkAssertion(assertion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid assertion %s: %w", name, err)
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+		failure := fmt.Sprintf("Assertion %s failed", name)
+		if assertion.Message != "" {
+			failure = fmt.Sprintf("%s (%s)", failure, assertion.Message)
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", failure, strings.Join(diffs, ", ")))
+	}
+	if len(failures) > 0 {
+		params.Action.Fail(strings.Join(failures, "; "))
+		return nil, errors.GenericActionError(errors.ActionTerminate)
+	}
+	params.Action.Message(fmt.Sprintf("All %d assertions passed", len(assertions)))
+	return nil, nil
+}
+
+// checkAssertion returns the descriptions of the failures of the assertion
+func checkAssertion(assertion Assertion) ([]string, error) {
+	if len(assertion.Expected) == 0 && assertion.Condition == "" {
+		return nil, fmt.Errorf("either expected or condition must be set")
+	}
+	var diffs []string
+	if len(assertion.Expected) > 0 {
+		var expected any
+		if err := json.Unmarshal(assertion.Expected, &expected); err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diffValues("", expected, assertion.Actual)...)
+	}
+	if assertion.Condition != "" {
+		ok, err := evalCondition(assertion.Condition, assertion.Actual)
+		switch {
+		case err != nil:
+			diffs = append(diffs, fmt.Sprintf("condition `%s` can't be evaluated: %s, actual %s", assertion.Condition, err.Error(), toJSON(assertion.Actual)))
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("condition `%s` is false, actual %s", assertion.Condition, toJSON(assertion.Actual)))
+		}
+	}
+	return diffs, nil
+}
+
+// evalCondition evaluates the cue expression with the actual value in the scope
+func evalCondition(condition string, actual any) (bool, error) {
+	v := cuecontext.New().CompileString(fmt.Sprintf("actual: %s\nresult: %s", toJSON(actual), condition))
+	if v.Err() != nil {
+		return false, v.Err()
+	}
+	return v.LookupPath(cue.ParsePath("result")).Bool()
+}
+
+// diffValues returns the differences between the expected and actual values by the paths of the fields
+func diffValues(path string, expected, actual any) []string {
+	prefix := ""
+	if path != "" {
+		prefix = path + ": "
+	}
+	switch e := expected.(type) {
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(e))
+		for k := range e {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var diffs []string
+		for _, k := range keys {
+			sub := k
+			if path != "" {
+				sub = path + "." + k
+			}
+			if v, ok := a[k]; ok {
+				diffs = append(diffs, diffValues(sub, e[k], v)...)
+			} else {
+				diffs = append(diffs, fmt.Sprintf("%s: expected %s, actual is missing", sub, toJSON(e[k])))
+			}
+		}
+		return diffs
+	case []any:
+		a, ok := actual.([]any)
+		if !ok {
+			break
+		}
+		if len(e) != len(a) {
+			return []string{fmt.Sprintf("%sexpected %d items, actual %d items %s", prefix, len(e), len(a), toJSON(a))}
+		}
+		var diffs []string
+		for i := range e {
+			diffs = append(diffs, diffValues(fmt.Sprintf("%s[%d]", path, i), e[i], a[i])...)
+		}
+		return diffs
+	}
+	if reflect.DeepEqual(expected, actual) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%sexpected %s, actual %s", prefix, toJSON(expected), toJSON(actual))}
+}
+
+func toJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
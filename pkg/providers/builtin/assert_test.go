@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubevela/workflow/pkg/errors"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+)
+
+func TestProvider_Assert(t *testing.T) {
+	ctx := context.Background()
+	testCases := map[string]struct {
+		assertions string
+		failed     bool
+		msg        string
+		err        string
+	}{
+		"passed": {
+			assertions: `{"ready":{"actual":{"phase":"Running","replicas":3},"expected":{"phase":"Running"}},"replicas":{"actual":3,"condition":"actual >= 3"}}`,
+			msg:        "All 2 assertions passed",
+		},
+		"expected null": {
+			assertions: `{"empty":{"actual":null,"expected":null}}`,
+			msg:        "All 1 assertions passed",
+		},
+		"diff of fields": {
+			assertions: `{"ready":{"actual":{"status":{"phase":"Pending"},"ports":[80]},"expected":{"status":{"phase":"Running","ready":true},"ports":[80,443]},"message":"the pod should be ready"}}`,
+			failed:     true,
+			msg:        `Assertion ready failed (the pod should be ready): ports: expected 2 items, actual 1 items [80], status.phase: expected "Running", actual "Pending", status.ready: expected true, actual is missing`,
+		},
+		"false condition": {
+			assertions: `{"replicas":{"actual":2,"condition":"actual >= 3"},"version":{"actual":"v1","expected":"v2"}}`,
+			failed:     true,
+			msg:        "Assertion replicas failed: condition `actual >= 3` is false, actual 2; Assertion version failed: expected \"v2\", actual \"v1\"",
+		},
+		"condition can't be evaluated": {
+			assertions: `{"phase":{"actual":{},"condition":"actual.status.phase == \"Running\""}}`,
+			failed:     true,
+			msg:        "Assertion phase failed: condition `actual.status.phase == \"Running\"` can't be evaluated",
+		},
+		"invalid assertion": {
+			assertions: `{"invalid":{"actual":1}}`,
+			err:        "invalid assertion invalid: either expected or condition must be set",
+		},
+		"empty assertions": {
+			assertions: `{}`,
+			err:        "the assertions of assert can not be empty",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			vars := AssertVars{}
+			r.NoError(json.Unmarshal([]byte(tc.assertions), &vars.Assertions))
+			act := &mockAction{}
+			_, err := Assert(ctx, &AssertParams{
+				Params:        vars,
+				RuntimeParams: providertypes.RuntimeParams{Action: act},
+			})
+			if tc.err != "" {
+				r.EqualError(err, tc.err)
+				return
+			}
+			if tc.failed {
+				_, ok := err.(errors.GenericActionError)
+				r.True(ok)
+				r.True(act.terminate)
+				r.Contains(act.msg, tc.msg)
+				return
+			}
+			r.NoError(err)
+			r.False(act.terminate)
+			r.Equal(tc.msg, act.msg)
+		})
+	}
+}
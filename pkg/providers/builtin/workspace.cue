@@ -28,6 +28,8 @@
 		continue: *false | bool
 		// +usage=Optional message that will be shown in workflow step status, note that the message might be override by other actions.
 		message?: string
+		// +usage=Optional sub phase of the running step that will be shown in workflow step status, such as "uploading" or "verifying". It's advisory and doesn't affect the scheduling of the steps.
+		subPhase?: string
 	}
 }
 
@@ -43,6 +45,18 @@
 	}
 }
 
+#Delay: {
+	#do:       "delay"
+	#provider: "builtin"
+
+	$params: {
+		// +usage=The duration to wait since the step is first executed, such as "30s", "1m" or "2m15s"
+		duration: string
+		// +usage=The max random duration added to the duration, the same jitter is used across the reconciles of the step
+		jitter?: string
+	}
+}
+
 #Break: {
 	#do:       "break"
 	#provider: "builtin"
@@ -53,6 +67,16 @@
 	}
 }
 
+#Exit: {
+	#do:       "exit"
+	#provider: "builtin"
+
+	$params: {
+		// +usage=Optional message that will be shown in workflow step status, note that the message might be override by other actions.
+		message?: string
+	}
+}
+
 #Fail: {
 	#do:       "fail"
 	#provider: "builtin"
@@ -73,6 +97,101 @@
 	}
 }
 
+#Metadata: {
+	#do:       "metadata"
+	#provider: "builtin"
+
+	$params: {
+		// +usage=The informational metadata of the step for the operators, e.g. the URL of the external job, it can't be referenced by the inputs of the other steps
+		metadata: [string]: string
+	}
+}
+
+#SetStatus: {
+	#do:       "status"
+	#provider: "builtin"
+
+	$params: {
+		// +usage=The custom status to set in the workflow run, the key will be removed if the value is null
+		status: {...}
+	}
+}
+
+#Progress: {
+	#do:       "progress"
+	#provider: "builtin"
+
+	$params: {
+		// +usage=The stages to advance through, the value of the current stage will be returned
+		stages: [...{
+			// +usage=The value of the stage, such as the weight of traffic or the number of replicas
+			value: _
+			// +usage=The duration to bake the stage before advancing to the next stage, such as "30s" or "5m"
+			duration?: string
+			// +usage=Whether to suspend the step for approval before advancing to the next stage
+			approval: *false | bool
+		}]
+		// +usage=The policy to roll back the stage when the step fails
+		rollback: *"none" | "previous" | "first"
+	}
+
+	$returns?: {
+		// +usage=The index of the current stage
+		stage: int
+		// +usage=The value of the current stage
+		value: _
+		// +usage=Whether all the stages are finished
+		finished: bool
+	}
+}
+
+#Assert: {
+	#do:       "assert"
+	#provider: "builtin"
+
+	$params: {
+		// +usage=The assertions keyed by their names, the step fails if any of them is false
+		assertions: [string]: {
+			// +usage=The actual value to check, such as the input of the step
+			actual: _
+			// +usage=The expected value, the actual value should equal it
+			expected?: _
+			// +usage=The cue expression over the actual value that should be true, such as "actual >= 3"
+			condition?: string
+			// +usage=Optional message that describes the assertion in the failure
+			message?: string
+		}
+	}
+}
+
+#Gen: {
+	#do:       "gen"
+	#provider: "builtin"
+
+	$params: {
+		// +usage=The values to generate keyed by their names
+		values: [string]: {
+			// +usage=The kind of the value, the derived value is the same for the same seed
+			kind: "uuid" | "randomString" | "derived"
+			// +usage=The length of the random string or the derived value
+			length?: int
+			// +usage=The characters to pick for the random string or the derived value, defaults to the letters and digits
+			charset?: string
+			// +usage=The seed to derive the value from
+			seed?: string
+			// +usage=Whether the value is redacted in the debug dumps
+			sensitive: *false | bool
+		}
+		// +usage=Whether to generate the values again instead of reusing the persisted values
+		regenerate: *false | bool
+	}
+
+	$returns?: {
+		// +usage=The generated values keyed by their names
+		values: [string]: string
+	}
+}
+
 #Steps: {
 	...
 }
@@ -18,13 +18,19 @@ package builtin
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"math/big"
 	"strings"
 	"time"
 
 	"cuelang.org/go/cue/cuecontext"
+	"github.com/google/uuid"
 
 	cuexruntime "github.com/kubevela/pkg/cue/cuex/runtime"
 
@@ -32,6 +38,7 @@ import (
 	"github.com/kubevela/workflow/pkg/cue/model"
 	"github.com/kubevela/workflow/pkg/errors"
 	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
 )
 
 const (
@@ -41,6 +48,8 @@ const (
 	ResumeTimeStamp = "resumeTimeStamp"
 	// SuspendTimeStamp is suspend time stamp.
 	SuspendTimeStamp = "suspendTimeStamp"
+	// ProgressState is the state of the progressive stages.
+	ProgressState = "progressState"
 )
 
 // VarVars .
@@ -109,6 +118,8 @@ type ActionParams = providertypes.Params[ActionVars]
 // WaitVars .
 type WaitVars struct {
 	Continue bool `json:"continue"`
+	// SubPhase is the intermediate state of the step while it's waiting, e.g. verifying
+	SubPhase string `json:"subPhase,omitempty"`
 	ActionVars
 }
 
@@ -121,6 +132,9 @@ func Wait(_ context.Context, params *WaitParams) (*any, error) {
 		return nil, nil
 	}
 	params.Action.Wait(params.Params.Message)
+	if phaser, ok := params.Action.(types.ActionSubPhaser); ok && params.Params.SubPhase != "" {
+		phaser.SubPhase(params.Params.SubPhase)
+	}
 	return nil, errors.GenericActionError(errors.ActionWait)
 }
 
@@ -130,6 +144,16 @@ func Break(_ context.Context, params *ActionParams) (*any, error) {
 	return nil, errors.GenericActionError(errors.ActionTerminate)
 }
 
+// Exit let workflow exit as succeeded, the remaining steps are skipped.
+func Exit(_ context.Context, params *ActionParams) (*any, error) {
+	exiter, ok := params.Action.(types.ActionExiter)
+	if !ok {
+		return nil, fmt.Errorf("the action of the step doesn't support exiting the workflow")
+	}
+	exiter.Exit(params.Params.Message)
+	return nil, errors.GenericActionError(errors.ActionTerminate)
+}
+
 // Fail let the step fail, its status is failed and reason is Action
 func Fail(_ context.Context, params *ActionParams) (*any, error) {
 	params.Action.Fail(params.Params.Message)
@@ -162,7 +186,7 @@ func Suspend(_ context.Context, params *SuspendParams) (*any, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse timestamp %s: %w", timestamp, err)
 		}
-		if time.Now().After(t) {
+		if params.Now().After(t) {
 			act.Resume("")
 			return nil, nil
 		}
@@ -174,7 +198,7 @@ func Suspend(_ context.Context, params *SuspendParams) (*any, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse duration %s: %w", params.Params.Duration, err)
 		}
-		wfCtx.SetMutableValue(time.Now().Add(d).Format(time.RFC3339), stepID, ResumeTimeStamp)
+		wfCtx.SetMutableValue(params.Now().Add(d).Format(time.RFC3339), stepID, ResumeTimeStamp)
 	}
 	if ts := wfCtx.GetMutableValue(stepID, params.FieldLabel, SuspendTimeStamp); ts != "" {
 		if act.GetStatus().Phase == v1alpha1.WorkflowStepPhaseRunning {
@@ -182,18 +206,422 @@ func Suspend(_ context.Context, params *SuspendParams) (*any, error) {
 			return nil, nil
 		}
 	} else {
-		wfCtx.SetMutableValue(time.Now().Format(time.RFC3339), stepID, params.FieldLabel, SuspendTimeStamp)
+		wfCtx.SetMutableValue(params.Now().Format(time.RFC3339), stepID, params.FieldLabel, SuspendTimeStamp)
 	}
 	act.Suspend(msg)
 	return nil, errors.GenericActionError(errors.ActionSuspend)
 }
 
+// DelayVars .
+type DelayVars struct {
+	Duration string `json:"duration"`
+	Jitter   string `json:"jitter,omitempty"`
+}
+
+// DelayParams .
+type DelayParams = providertypes.Params[DelayVars]
+
+// Delay lets the step wait for the duration and the jitter since it's first executed. The resume time is computed
+// from the first execute time in the step status and the jitter is derived from the step session id, so that the
+// same resume time is computed after the controller restarts.
+func Delay(_ context.Context, params *DelayParams) (*any, error) {
+	d, err := time.ParseDuration(params.Params.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse duration %s: %w", params.Params.Duration, err)
+	}
+	if params.Params.Jitter != "" {
+		jitter, err := time.ParseDuration(params.Params.Jitter)
+		if err != nil || jitter < 0 {
+			return nil, fmt.Errorf("invalid jitter %s, it must be a non-negative duration", params.Params.Jitter)
+		}
+		if jitter > 0 {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(fmt.Sprint(params.ProcessContext.GetData(model.ContextStepSessionID))))
+			d += time.Duration(h.Sum64() % uint64(jitter))
+		}
+	}
+	act := params.Action
+	start := act.GetStatus().FirstExecuteTime.Time
+	if start.IsZero() {
+		// the step is executed for the first time
+		start = params.Now()
+	}
+	if resume := start.Add(d); params.Now().Before(resume) {
+		act.Wait(fmt.Sprintf("Delaying until %s", resume.Format(time.RFC3339)))
+		return nil, errors.GenericActionError(errors.ActionWait)
+	}
+	act.Message(fmt.Sprintf("Delayed for %s", d.Round(time.Second)))
+	return nil, nil
+}
+
+// StatusVars .
+type StatusVars struct {
+	Status map[string]any `json:"status"`
+}
+
+// StatusParams .
+type StatusParams = providertypes.Params[StatusVars]
+
+// SetStatus sets the custom status of the workflow run, the key will be removed if the value is null.
+func SetStatus(_ context.Context, params *StatusParams) (*any, error) {
+	wfCtx := params.WorkflowContext
+	custom := make(map[string]any)
+	if s := wfCtx.GetMutableValue(types.ContextKeyCustomStatus); s != "" {
+		if err := json.Unmarshal([]byte(s), &custom); err != nil {
+			return nil, fmt.Errorf("failed to parse custom status: %w", err)
+		}
+	}
+	for k, v := range params.Params.Status {
+		if k == "" {
+			return nil, fmt.Errorf("the key of custom status can not be empty")
+		}
+		if v == nil {
+			delete(custom, k)
+			continue
+		}
+		custom[k] = v
+	}
+	b, err := json.Marshal(custom)
+	if err != nil {
+		return nil, err
+	}
+	wfCtx.SetMutableValue(string(b), types.ContextKeyCustomStatus)
+	return nil, nil
+}
+
 // Message writes message to step status, note that the message will be overwritten by the next message.
 func Message(_ context.Context, params *ActionParams) (*any, error) {
 	params.Action.Message(params.Params.Message)
 	return nil, nil
 }
 
+// MetadataVars .
+type MetadataVars struct {
+	Metadata map[string]string `json:"metadata"`
+}
+
+// MetadataParams .
+type MetadataParams = providertypes.Params[MetadataVars]
+
+// Metadata adds the informational metadata to step status, it's shown in the status and events of the run but can't
+// be referenced by the inputs of the other steps.
+func Metadata(_ context.Context, params *MetadataParams) (*any, error) {
+	if reporter, ok := params.Action.(types.ActionMetadataReporter); ok {
+		reporter.Metadata(params.Params.Metadata)
+	}
+	return nil, nil
+}
+
+// ProgressStage is a stage of the progressive step
+type ProgressStage struct {
+	Value    any    `json:"value"`
+	Duration string `json:"duration,omitempty"`
+	Approval bool   `json:"approval,omitempty"`
+}
+
+// ProgressVars .
+type ProgressVars struct {
+	Stages   []ProgressStage `json:"stages"`
+	Rollback string          `json:"rollback,omitempty"`
+}
+
+// ProgressReturnVars .
+type ProgressReturnVars struct {
+	Stage    int  `json:"stage"`
+	Value    any  `json:"value"`
+	Finished bool `json:"finished"`
+}
+
+// ProgressReturns .
+type ProgressReturns = providertypes.Returns[ProgressReturnVars]
+
+// ProgressParams .
+type ProgressParams = providertypes.Params[ProgressVars]
+
+type progressState struct {
+	Stage     int       `json:"stage"`
+	StartTime time.Time `json:"startTime"`
+	Suspended bool      `json:"suspended,omitempty"`
+}
+
+const (
+	// ProgressRollbackNone keeps the current stage when the step fails
+	ProgressRollbackNone = "none"
+	// ProgressRollbackPrevious rolls back to the previous stage when the step fails
+	ProgressRollbackPrevious = "previous"
+	// ProgressRollbackFirst rolls back to the first stage when the step fails
+	ProgressRollbackFirst = "first"
+)
+
+// Progress advances the stages across reconciles and returns the value of the current stage,
+// the step waits for the duration and suspends for the approval of a stage before advancing to the next stage.
+// If the step failed at a stage, the stage will be rolled back by the rollback policy and the step fails.
+func Progress(_ context.Context, params *ProgressParams) (*ProgressReturns, error) {
+	stages := params.Params.Stages
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("the stages of progress can not be empty")
+	}
+	pCtx := params.ProcessContext
+	wfCtx := params.WorkflowContext
+	act := params.Action
+	stepID := fmt.Sprint(pCtx.GetData(model.ContextStepSessionID))
+
+	state := progressState{StartTime: params.Now()}
+	s := wfCtx.GetMutableValue(stepID, ProgressState)
+	if s != "" {
+		if err := json.Unmarshal([]byte(s), &state); err != nil {
+			return nil, fmt.Errorf("failed to parse progress state: %w", err)
+		}
+	}
+	if state.Stage >= len(stages) {
+		state.Stage = len(stages) - 1
+	}
+	finished := false
+	returns := func() (*ProgressReturns, error) {
+		b, err := json.Marshal(state)
+		if err != nil {
+			return nil, err
+		}
+		wfCtx.SetMutableValue(string(b), stepID, ProgressState)
+		return &ProgressReturns{Returns: ProgressReturnVars{
+			Stage:    state.Stage,
+			Value:    stages[state.Stage].Value,
+			Finished: finished,
+		}}, nil
+	}
+
+	if act.GetStatus().Phase == v1alpha1.WorkflowStepPhaseFailed {
+		failed := state.Stage
+		switch params.Params.Rollback {
+		case ProgressRollbackPrevious:
+			if state.Stage > 0 {
+				state.Stage--
+			}
+		case ProgressRollbackFirst:
+			state.Stage = 0
+		default:
+			return returns()
+		}
+		state.StartTime, state.Suspended = params.Now(), false
+		act.Fail(fmt.Sprintf("Failed at stage %d/%d, rolled back to stage %d/%d", failed+1, len(stages), state.Stage+1, len(stages)))
+		return returns()
+	}
+
+	// the stage is advanced only if it has been applied in the previous reconcile and is not gated
+	if s != "" {
+		isGated, err := gateProgressStage(act, stages, &state, params.Now())
+		if err != nil || isGated {
+			if err != nil {
+				return nil, err
+			}
+			return returns()
+		}
+		if state.Stage < len(stages)-1 {
+			state.Stage++
+			state.StartTime, state.Suspended = params.Now(), false
+		}
+	}
+	isGated, err := gateProgressStage(act, stages, &state, params.Now())
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isGated:
+	case state.Stage < len(stages)-1:
+		act.Wait(fmt.Sprintf("Progressing to stage %d/%d", state.Stage+2, len(stages)))
+	default:
+		finished = true
+		act.Message(fmt.Sprintf("All %d stages are finished", len(stages)))
+	}
+	return returns()
+}
+
+// gateProgressStage checks whether the current stage is still baking or waiting for the approval
+func gateProgressStage(act types.Action, stages []ProgressStage, state *progressState, now time.Time) (bool, error) {
+	stage := stages[state.Stage]
+	if stage.Duration != "" {
+		d, err := time.ParseDuration(stage.Duration)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse duration %s: %w", stage.Duration, err)
+		}
+		if now.Before(state.StartTime.Add(d)) {
+			act.Wait(fmt.Sprintf("Stage %d/%d is baking for %s", state.Stage+1, len(stages), stage.Duration))
+			return true, nil
+		}
+	}
+	if stage.Approval {
+		if state.Suspended && act.GetStatus().Phase == v1alpha1.WorkflowStepPhaseRunning {
+			return false, nil
+		}
+		state.Suspended = true
+		act.Suspend(fmt.Sprintf("Stage %d/%d is waiting for approval", state.Stage+1, len(stages)))
+		return true, nil
+	}
+	return false, nil
+}
+
+const (
+	// GenKindUUID generates a random UUID
+	GenKindUUID = "uuid"
+	// GenKindRandomString generates a random string from the charset
+	GenKindRandomString = "randomString"
+	// GenKindDerived derives a string from the seed, the same seed always derives the same string
+	GenKindDerived = "derived"
+
+	genDefaultLength  = 16
+	genDefaultCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// GenValue is the spec of a generated value
+type GenValue struct {
+	Kind      string `json:"kind"`
+	Length    int    `json:"length,omitempty"`
+	Charset   string `json:"charset,omitempty"`
+	Seed      string `json:"seed,omitempty"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+// sameValue checks if the spec generates the same value, the sensitivity doesn't change the value
+func (v GenValue) sameValue(spec GenValue) bool {
+	return v.Kind == spec.Kind && v.Length == spec.Length && v.Charset == spec.Charset && v.Seed == spec.Seed
+}
+
+// GenVars .
+type GenVars struct {
+	Values     map[string]GenValue `json:"values"`
+	Regenerate bool                `json:"regenerate,omitempty"`
+}
+
+// GenReturnVars .
+type GenReturnVars struct {
+	Values map[string]string `json:"values"`
+}
+
+// GenReturns .
+type GenReturns = providertypes.Returns[GenReturnVars]
+
+// GenParams .
+type GenParams = providertypes.Params[GenVars]
+
+// GeneratedValue is the value generated by the gen step with its spec, it's persisted in the workflow context
+type GeneratedValue struct {
+	GenValue
+	Value string `json:"value"`
+}
+
+// Gen generates the values and persists them in the workflow context under the name of the step, so the executions
+// of the step after the reconciles, the restarts of the controller and the restarts of the step return the same
+// values. A value is generated again if regenerate is set or its spec is changed.
+func Gen(_ context.Context, params *GenParams) (*GenReturns, error) {
+	wfCtx := params.WorkflowContext
+	// the step is persisted by its name since the session id is changed once the step is restarted
+	step := fmt.Sprint(params.ProcessContext.GetData(model.ContextStepName))
+	values := make(map[string]string, len(params.Params.Values))
+	for name, spec := range params.Params.Values {
+		switch spec.Kind {
+		case GenKindUUID:
+			spec.Length, spec.Charset, spec.Seed = 0, "", ""
+		case GenKindRandomString, GenKindDerived:
+			if spec.Length < 0 {
+				return nil, providertypes.NewProviderError(types.StatusReasonParameter, fmt.Errorf("invalid length %d of the value %s, it must be positive", spec.Length, name))
+			}
+			if spec.Length == 0 {
+				spec.Length = genDefaultLength
+			}
+			if spec.Charset == "" {
+				spec.Charset = genDefaultCharset
+			}
+			if spec.Kind == GenKindRandomString {
+				spec.Seed = ""
+			}
+		default:
+			return nil, providertypes.NewProviderError(types.StatusReasonParameter, fmt.Errorf("unknown kind %s of the value %s, it must be one of %s, %s and %s", spec.Kind, name, GenKindUUID, GenKindRandomString, GenKindDerived))
+		}
+
+		var generated GeneratedValue
+		if s := wfCtx.GetMutableValue(types.ContextPrefixGeneratedValue, step, name); s != "" && !params.Params.Regenerate {
+			if err := json.Unmarshal([]byte(s), &generated); err != nil {
+				return nil, fmt.Errorf("failed to parse the generated value %s: %w", name, err)
+			}
+		}
+		if !generated.sameValue(spec) || generated.Value == "" {
+			v, err := generateValue(spec)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate the value %s: %w", name, err)
+			}
+			generated.Value = v
+		} else if generated.Sensitive == spec.Sensitive {
+			values[name] = generated.Value
+			continue
+		}
+		// the value is persisted again if it's generated or its sensitivity is changed
+		generated.GenValue = spec
+		b, err := json.Marshal(generated)
+		if err != nil {
+			return nil, err
+		}
+		wfCtx.SetMutableValue(string(b), types.ContextPrefixGeneratedValue, step, name)
+		values[name] = generated.Value
+	}
+	return &GenReturns{Returns: GenReturnVars{Values: values}}, nil
+}
+
+// redactGenCall redacts the sensitive values in the returns of the recorded call, the whole returns are redacted if
+// they can't be parsed
+func redactGenCall(call providertypes.ProviderCall) providertypes.ProviderCall {
+	if len(call.Returns) == 0 {
+		return call
+	}
+	var spec GenVars
+	var ret map[string]interface{}
+	if json.Unmarshal(call.Params, &spec) != nil || json.Unmarshal(call.Returns, &ret) != nil {
+		call.Returns = nil
+		return call
+	}
+	if r, ok := ret["$returns"].(map[string]interface{}); ok {
+		if values, ok := r["values"].(map[string]interface{}); ok {
+			for name := range values {
+				if spec.Values[name].Sensitive {
+					values[name] = types.RedactedValue
+				}
+			}
+		}
+	}
+	b, err := json.Marshal(ret)
+	if err != nil {
+		b = nil
+	}
+	call.Returns = b
+	return call
+}
+
+func generateValue(spec GenValue) (string, error) {
+	if spec.Kind == GenKindUUID {
+		return uuid.NewString(), nil
+	}
+	charset := []rune(spec.Charset)
+	size := big.NewInt(int64(len(charset)))
+	value := make([]rune, spec.Length)
+	// the seed is hashed with the index of the block to derive the strings longer than a hash
+	var block []byte
+	for i := range value {
+		if spec.Kind == GenKindRandomString {
+			n, err := rand.Int(rand.Reader, size)
+			if err != nil {
+				return "", err
+			}
+			value[i] = charset[n.Int64()]
+			continue
+		}
+		if i%8 == 0 {
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", spec.Seed, i/8)))
+			block = sum[:]
+		}
+		value[i] = charset[binary.BigEndian.Uint32(block[i%8*4:])%uint32(len(charset))]
+	}
+	return string(value), nil
+}
+
 //go:embed workspace.cue
 var template string
 
@@ -205,11 +633,21 @@ func GetTemplate() string {
 // GetProviders returns the cue providers.
 func GetProviders() map[string]cuexruntime.ProviderFn {
 	return map[string]cuexruntime.ProviderFn{
-		"wait":    providertypes.GenericProviderFn[WaitVars, any](Wait),
-		"break":   providertypes.GenericProviderFn[ActionVars, any](Break),
-		"fail":    providertypes.GenericProviderFn[ActionVars, any](Fail),
-		"message": providertypes.GenericProviderFn[ActionVars, any](Message),
-		"var":     providertypes.GenericProviderFn[VarVars, VarReturns](DoVar),
-		"suspend": providertypes.GenericProviderFn[SuspendVars, any](Suspend),
+		"wait":     providertypes.GenericProviderFn[WaitVars, any](Wait),
+		"break":    providertypes.GenericProviderFn[ActionVars, any](Break),
+		"exit":     providertypes.GenericProviderFn[ActionVars, any](Exit),
+		"fail":     providertypes.GenericProviderFn[ActionVars, any](Fail),
+		"message":  providertypes.GenericProviderFn[ActionVars, any](Message),
+		"metadata": providertypes.GenericProviderFn[MetadataVars, any](Metadata),
+		"var":      providertypes.GenericProviderFn[VarVars, VarReturns](DoVar),
+		"suspend":  providertypes.GenericProviderFn[SuspendVars, any](Suspend),
+		"delay":    providertypes.GenericProviderFn[DelayVars, any](Delay),
+		"status":   providertypes.GenericProviderFn[StatusVars, any](SetStatus),
+		"progress": providertypes.GenericProviderFn[ProgressVars, ProgressReturns](Progress),
+		"assert":   providertypes.GenericProviderFn[AssertVars, any](Assert),
+		"gen": &providertypes.RedactedProviderFn{
+			ProviderFn: providertypes.GenericProviderFn[GenVars, GenReturns](Gen),
+			Redact:     redactGenCall,
+		},
 	}
 }
@@ -19,19 +19,29 @@ package builtin
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/yaml"
 
+	"github.com/kubevela/pkg/util/singleton"
+
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/cue/model"
 	"github.com/kubevela/workflow/pkg/cue/process"
 	"github.com/kubevela/workflow/pkg/errors"
 	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
 )
 
 func TestProvider_DoVar(t *testing.T) {
@@ -90,6 +100,24 @@ func TestProvider_Wait(t *testing.T) {
 	r.Equal(act.wait, true)
 	r.Equal(act.msg, "test log")
 
+	// the sub phase is reported by the action that supports it
+	reportAct := &mockReportAction{}
+	_, err = Wait(ctx, &WaitParams{
+		Params: WaitVars{
+			SubPhase: "verifying",
+			ActionVars: ActionVars{
+				Message: "test log",
+			},
+		},
+		RuntimeParams: providertypes.RuntimeParams{
+			Action: reportAct,
+		},
+	})
+	_, ok = err.(errors.GenericActionError)
+	r.Equal(ok, true)
+	r.Equal(reportAct.wait, true)
+	r.Equal(reportAct.subPhase, "verifying")
+
 	act = &mockAction{}
 	_, err = Wait(ctx, &WaitParams{
 		Params: WaitVars{
@@ -135,6 +163,35 @@ func TestProvider_Break(t *testing.T) {
 	r.Equal(act.msg, "terminate")
 }
 
+func TestProvider_Exit(t *testing.T) {
+	ctx := context.Background()
+	r := require.New(t)
+	act := &mockExitAction{}
+	_, err := Exit(ctx, &ActionParams{
+		Params: ActionVars{
+			Message: "nothing to deploy",
+		},
+		RuntimeParams: providertypes.RuntimeParams{
+			Action: act,
+		},
+	})
+	_, ok := err.(errors.GenericActionError)
+	r.Equal(ok, true)
+	r.Equal(act.exit, true)
+	r.Equal(act.terminate, false)
+	r.Equal(act.msg, "nothing to deploy")
+
+	// the action that doesn't support exiting fails the step
+	_, err = Exit(ctx, &ActionParams{
+		RuntimeParams: providertypes.RuntimeParams{
+			Action: &mockAction{},
+		},
+	})
+	r.Error(err)
+	_, ok = err.(errors.GenericActionError)
+	r.Equal(ok, false)
+}
+
 func TestProvider_Suspend(t *testing.T) {
 	wfCtx := newWorkflowContextForTest(t)
 	ctx := context.Background()
@@ -142,15 +199,17 @@ func TestProvider_Suspend(t *testing.T) {
 	pCtx.PushData(model.ContextStepSessionID, "test-id")
 	r := require.New(t)
 	act := &mockAction{}
+	fakeClock := clocktesting.NewFakeClock(time.Now())
 
 	params := &SuspendParams{
 		Params: SuspendVars{
-			Duration: "1s",
+			Duration: "1h",
 		},
 		RuntimeParams: providertypes.RuntimeParams{
 			Action:          act,
 			WorkflowContext: wfCtx,
 			ProcessContext:  pCtx,
+			Clock:           fakeClock,
 		},
 	}
 	_, err := Suspend(ctx, params)
@@ -158,17 +217,72 @@ func TestProvider_Suspend(t *testing.T) {
 	r.Equal(ok, true)
 	r.Equal(act.suspend, true)
 	r.Equal(act.msg, "Suspended by field ")
-	// test second time to check if the suspend is resumed in 1s
+	// test second time to check if the suspend is resumed in 1h
+	fakeClock.Step(30 * time.Minute)
 	_, err = Suspend(ctx, params)
 	_, ok = err.(errors.GenericActionError)
 	r.Equal(ok, true)
 	r.Equal(act.suspend, true)
-	time.Sleep(time.Second)
+	fakeClock.Step(30 * time.Minute)
 	_, err = Suspend(ctx, params)
 	r.NoError(err)
 	r.Equal(act.suspend, false)
 }
 
+func TestProvider_Delay(t *testing.T) {
+	ctx := context.Background()
+	r := require.New(t)
+	pCtx := process.NewContext(process.ContextData{})
+	pCtx.PushData(model.ContextStepSessionID, "test-id")
+	start := time.Now()
+	fakeClock := clocktesting.NewFakeClock(start)
+	act := &mockAction{}
+	params := &DelayParams{
+		Params: DelayVars{Duration: "1m", Jitter: "30s"},
+		RuntimeParams: providertypes.RuntimeParams{
+			Action:         act,
+			ProcessContext: pCtx,
+			Clock:          fakeClock,
+		},
+	}
+
+	// the step is executed for the first time
+	_, err := Delay(ctx, params)
+	_, ok := err.(errors.GenericActionError)
+	r.True(ok)
+	r.True(act.wait)
+	r.Contains(act.msg, "Delaying until")
+	resume, err := time.Parse(time.RFC3339, strings.TrimPrefix(act.msg, "Delaying until "))
+	r.NoError(err)
+
+	r.False(resume.Before(start.Add(time.Minute).Truncate(time.Second)))
+	r.True(resume.Before(start.Add(90 * time.Second)))
+
+	// the same resume time is computed against the first execute time after restarts
+	act = &mockAction{status: v1alpha1.StepStatus{FirstExecuteTime: metav1.NewTime(start)}}
+	params.Action = act
+	fakeClock.SetTime(resume.Add(-time.Second))
+	_, err = Delay(ctx, params)
+	_, ok = err.(errors.GenericActionError)
+	r.True(ok)
+	r.Equal(fmt.Sprintf("Delaying until %s", resume.Format(time.RFC3339)), act.msg)
+
+	act = &mockAction{status: v1alpha1.StepStatus{FirstExecuteTime: metav1.NewTime(start)}}
+	params.Action = act
+	fakeClock.SetTime(start.Add(90 * time.Second))
+	_, err = Delay(ctx, params)
+	r.NoError(err)
+	r.False(act.wait)
+	r.Contains(act.msg, "Delayed for")
+
+	params.Params.Jitter = "-1s"
+	_, err = Delay(ctx, params)
+	r.EqualError(err, "invalid jitter -1s, it must be a non-negative duration")
+	params.Params.Duration = "invalid"
+	_, err = Delay(ctx, params)
+	r.Error(err)
+}
+
 func TestProvider_Fail(t *testing.T) {
 	ctx := context.Background()
 	r := require.New(t)
@@ -213,15 +327,291 @@ func TestProvider_Message(t *testing.T) {
 	r.Equal(act.msg, "test")
 }
 
+func TestProvider_Metadata(t *testing.T) {
+	ctx := context.Background()
+	r := require.New(t)
+	act := &mockReportAction{}
+	_, err := Metadata(ctx, &MetadataParams{
+		Params: MetadataVars{
+			Metadata: map[string]string{"jobURL": "https://ci.example.com/jobs/1"},
+		},
+		RuntimeParams: providertypes.RuntimeParams{
+			Action: act,
+		},
+	})
+	r.NoError(err)
+	r.Equal(map[string]string{"jobURL": "https://ci.example.com/jobs/1"}, act.metadata)
+
+	// the metadata is dropped if the action doesn't support it
+	_, err = Metadata(ctx, &MetadataParams{
+		Params: MetadataVars{
+			Metadata: map[string]string{"jobURL": "https://ci.example.com/jobs/1"},
+		},
+		RuntimeParams: providertypes.RuntimeParams{
+			Action: &mockAction{},
+		},
+	})
+	r.NoError(err)
+}
+
+func TestProvider_SetStatus(t *testing.T) {
+	ctx := context.Background()
+	r := require.New(t)
+	wfCtx := newWorkflowContextForTest(t)
+	_, err := SetStatus(ctx, &StatusParams{
+		Params: StatusVars{
+			Status: map[string]any{"canary": "50%", "replicas": 2},
+		},
+		RuntimeParams: providertypes.RuntimeParams{
+			WorkflowContext: wfCtx,
+		},
+	})
+	r.NoError(err)
+	r.Equal(`{"canary":"50%","replicas":2}`, wfCtx.GetMutableValue(types.ContextKeyCustomStatus))
+
+	_, err = SetStatus(ctx, &StatusParams{
+		Params: StatusVars{
+			Status: map[string]any{"canary": "100%", "replicas": nil},
+		},
+		RuntimeParams: providertypes.RuntimeParams{
+			WorkflowContext: wfCtx,
+		},
+	})
+	r.NoError(err)
+	r.Equal(`{"canary":"100%"}`, wfCtx.GetMutableValue(types.ContextKeyCustomStatus))
+
+	_, err = SetStatus(ctx, &StatusParams{
+		Params: StatusVars{
+			Status: map[string]any{"": "invalid"},
+		},
+		RuntimeParams: providertypes.RuntimeParams{
+			WorkflowContext: wfCtx,
+		},
+	})
+	r.Error(err)
+}
+
+func TestProvider_Progress(t *testing.T) {
+	wfCtx := newWorkflowContextForTest(t)
+	ctx := context.Background()
+	pCtx := process.NewContext(process.ContextData{})
+	pCtx.PushData(model.ContextStepSessionID, "test-progress")
+	r := require.New(t)
+	act := &mockAction{}
+	progress := func(rollback string) *ProgressReturnVars {
+		res, err := Progress(ctx, &ProgressParams{
+			Params: ProgressVars{
+				Stages: []ProgressStage{
+					{Value: 1},
+					{Value: 2, Duration: "1s"},
+					{Value: 3, Approval: true},
+				},
+				Rollback: rollback,
+			},
+			RuntimeParams: providertypes.RuntimeParams{
+				Action:          act,
+				WorkflowContext: wfCtx,
+				ProcessContext:  pCtx,
+			},
+		})
+		r.NoError(err)
+		return &res.Returns
+	}
+
+	res := progress("")
+	r.Equal(0, res.Stage)
+	r.Equal(1, res.Value)
+	r.Equal(true, act.wait)
+	r.Equal("Progressing to stage 2/3", act.msg)
+
+	act = &mockAction{}
+	res = progress("")
+	r.Equal(1, res.Stage)
+	r.Equal(2, res.Value)
+	r.Equal("Stage 2/3 is baking for 1s", act.msg)
+	res = progress("")
+	r.Equal(1, res.Stage)
+
+	time.Sleep(time.Second)
+	act = &mockAction{}
+	res = progress("")
+	r.Equal(2, res.Stage)
+	r.Equal(true, act.suspend)
+	r.Equal("Stage 3/3 is waiting for approval", act.msg)
+	r.Equal(false, res.Finished)
+
+	act = &mockAction{status: v1alpha1.StepStatus{Phase: v1alpha1.WorkflowStepPhaseRunning}}
+	res = progress("")
+	r.Equal(2, res.Stage)
+	r.Equal(false, act.suspend)
+	r.Equal(false, act.wait)
+	r.Equal(true, res.Finished)
+
+	act = &mockAction{status: v1alpha1.StepStatus{Phase: v1alpha1.WorkflowStepPhaseFailed}}
+	res = progress(ProgressRollbackNone)
+	r.Equal(2, res.Stage)
+	r.Equal(false, act.terminate)
+	res = progress(ProgressRollbackPrevious)
+	r.Equal(1, res.Stage)
+	r.Equal(2, res.Value)
+	r.Equal(true, act.terminate)
+	r.Equal("Failed at stage 3/3, rolled back to stage 2/3", act.msg)
+	res = progress(ProgressRollbackFirst)
+	r.Equal(0, res.Stage)
+
+	_, err := Progress(ctx, &ProgressParams{
+		RuntimeParams: providertypes.RuntimeParams{
+			Action:          act,
+			WorkflowContext: wfCtx,
+			ProcessContext:  pCtx,
+		},
+	})
+	r.Error(err)
+}
+
+func TestProvider_Gen(t *testing.T) {
+	wfCtx := newWorkflowContextForTest(t)
+	ctx := context.Background()
+	pCtx := process.NewContext(process.ContextData{})
+	pCtx.PushData(model.ContextStepName, "gen")
+	r := require.New(t)
+	gen := func(values map[string]GenValue, regenerate bool) (map[string]string, error) {
+		res, err := Gen(ctx, &GenParams{
+			Params: GenVars{Values: values, Regenerate: regenerate},
+			RuntimeParams: providertypes.RuntimeParams{
+				WorkflowContext: wfCtx,
+				ProcessContext:  pCtx,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res.Returns.Values, nil
+	}
+
+	values := map[string]GenValue{
+		"id":       {Kind: GenKindUUID},
+		"password": {Kind: GenKindRandomString, Length: 40, Charset: "ab", Sensitive: true},
+		"suffix":   {Kind: GenKindDerived, Seed: "app"},
+	}
+	res, err := gen(values, false)
+	r.NoError(err)
+	r.Len(res["id"], 36)
+	r.Regexp("^[ab]{40}$", res["password"])
+	r.Regexp("^[a-zA-Z0-9]{16}$", res["suffix"])
+	generated := GeneratedValue{}
+	r.NoError(json.Unmarshal([]byte(wfCtx.GetMutableValue(types.ContextPrefixGeneratedValue, "gen", "password")), &generated))
+	r.Equal(GeneratedValue{GenValue: values["password"], Value: res["password"]}, generated)
+
+	// the persisted values are reused
+	reused, err := gen(values, false)
+	r.NoError(err)
+	r.Equal(res, reused)
+
+	// the value is kept if only its sensitivity is changed
+	values["password"] = GenValue{Kind: GenKindRandomString, Length: 40, Charset: "ab"}
+	reused, err = gen(values, false)
+	r.NoError(err)
+	r.Equal(res, reused)
+	generated = GeneratedValue{}
+	r.NoError(json.Unmarshal([]byte(wfCtx.GetMutableValue(types.ContextPrefixGeneratedValue, "gen", "password")), &generated))
+	r.False(generated.Sensitive)
+
+	// the value is generated again once its spec is changed
+	values["password"] = GenValue{Kind: GenKindRandomString, Length: 8}
+	changed, err := gen(values, false)
+	r.NoError(err)
+	r.Len(changed["password"], 8)
+	r.Equal(res["id"], changed["id"])
+
+	// the derived value only depends on the seed
+	regenerated, err := gen(values, true)
+	r.NoError(err)
+	r.NotEqual(res["id"], regenerated["id"])
+	r.Equal(res["suffix"], regenerated["suffix"])
+	pCtx.PushData(model.ContextStepName, "other")
+	derived, err := gen(map[string]GenValue{"suffix": {Kind: GenKindDerived, Seed: "app"}}, false)
+	r.NoError(err)
+	r.Equal(res["suffix"], derived["suffix"])
+	derived, err = gen(map[string]GenValue{"suffix": {Kind: GenKindDerived, Seed: "app", Length: 40}}, false)
+	r.NoError(err)
+	r.Equal(res["suffix"], derived["suffix"][:16])
+
+	_, err = gen(map[string]GenValue{"token": {Kind: "invalid"}}, false)
+	r.EqualError(err, "unknown kind invalid of the value token, it must be one of uuid, randomString and derived")
+	r.Equal(types.StatusReasonParameter, providertypes.ReasonOf(err))
+	_, err = gen(map[string]GenValue{"token": {Kind: GenKindRandomString, Length: -1}}, false)
+	r.EqualError(err, "invalid length -1 of the value token, it must be positive")
+	r.Equal(types.StatusReasonParameter, providertypes.ReasonOf(err))
+}
+
+func TestProvider_GenTrace(t *testing.T) {
+	r := require.New(t)
+	singleton.KubeClient.Set(fake.NewClientBuilder().Build())
+	wfCtx := newWorkflowContextForTest(t)
+	pCtx := process.NewContext(process.ContextData{})
+	pCtx.PushData(model.ContextStepName, "gen")
+	recorder := providertypes.NewProviderRecorder()
+	ctx := providertypes.WithRuntimeParams(providertypes.WithProviderTrace(context.Background(), recorder),
+		providertypes.RuntimeParams{WorkflowContext: wfCtx, ProcessContext: pCtx})
+	fn := providertypes.TraceProviders("builtin", GetProviders())["gen"]
+	v, err := fn.Call(ctx, cuecontext.New().CompileString(`$params: values: {
+	password: {kind: "randomString", sensitive: true}
+	suffix: {kind: "derived", seed: "app"}
+}`))
+	r.NoError(err)
+	password, err := v.LookupPath(cue.ParsePath("$returns.values.password")).String()
+	r.NoError(err)
+	r.Len(password, 16)
+	suffix, err := v.LookupPath(cue.ParsePath("$returns.values.suffix")).String()
+	r.NoError(err)
+
+	// the sensitive values are redacted in the recorded calls
+	calls, err := providertypes.LoadProviderCalls(wfCtx)
+	r.NoError(err)
+	r.Equal(recorder.Calls(), calls)
+	r.Len(calls, 1)
+	var recorded struct {
+		Returns GenReturnVars `json:"$returns"`
+	}
+	r.NoError(json.Unmarshal(calls[0].Returns, &recorded))
+	r.Equal(map[string]string{"password": types.RedactedValue, "suffix": suffix}, recorded.Returns.Values)
+}
+
+type mockReportAction struct {
+	mockAction
+	subPhase string
+	metadata map[string]string
+}
+
+func (act *mockReportAction) SubPhase(subPhase string) {
+	act.subPhase = subPhase
+}
+
+func (act *mockReportAction) Metadata(metadata map[string]string) {
+	act.metadata = metadata
+}
+
+type mockExitAction struct {
+	mockAction
+	exit bool
+}
+
+func (act *mockExitAction) Exit(msg string) {
+	act.exit = true
+	act.msg = msg
+}
+
 type mockAction struct {
 	suspend   bool
 	terminate bool
 	wait      bool
 	msg       string
+	status    v1alpha1.StepStatus
 }
 
 func (act *mockAction) GetStatus() v1alpha1.StepStatus {
-	return v1alpha1.StepStatus{}
+	return act.status
 }
 
 func (act *mockAction) Suspend(msg string) {
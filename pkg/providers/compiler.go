@@ -27,12 +27,16 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/kubevela/workflow/pkg/providers/builtin"
+	"github.com/kubevela/workflow/pkg/providers/counter"
 	"github.com/kubevela/workflow/pkg/providers/email"
+	"github.com/kubevela/workflow/pkg/providers/exec"
+	"github.com/kubevela/workflow/pkg/providers/external"
 	"github.com/kubevela/workflow/pkg/providers/http"
 	"github.com/kubevela/workflow/pkg/providers/kube"
 	"github.com/kubevela/workflow/pkg/providers/legacy"
 	"github.com/kubevela/workflow/pkg/providers/metrics"
 	"github.com/kubevela/workflow/pkg/providers/time"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/providers/util"
 )
 
@@ -51,16 +55,19 @@ var (
 var compiler = singleton.NewSingletonE[*cuex.Compiler](func() (*cuex.Compiler, error) {
 	return cuex.NewCompilerWithInternalPackages(
 		// legacy packages
-		runtime.Must(cuexruntime.NewInternalPackage(LegacyProviderName, legacy.GetLegacyTemplate(), legacy.GetLegacyProviders())),
+		runtime.Must(cuexruntime.NewInternalPackage(LegacyProviderName, legacy.GetLegacyTemplate(), providertypes.TraceProviders(LegacyProviderName, legacy.GetLegacyProviders()))),
 
 		// internal packages
-		runtime.Must(cuexruntime.NewInternalPackage("email", email.GetTemplate(), email.GetProviders())),
-		runtime.Must(cuexruntime.NewInternalPackage("http", http.GetTemplate(), http.GetProviders())),
-		runtime.Must(cuexruntime.NewInternalPackage("kube", kube.GetTemplate(), kube.GetProviders())),
-		runtime.Must(cuexruntime.NewInternalPackage("metrics", metrics.GetTemplate(), metrics.GetProviders())),
-		runtime.Must(cuexruntime.NewInternalPackage("time", time.GetTemplate(), time.GetProviders())),
-		runtime.Must(cuexruntime.NewInternalPackage("util", util.GetTemplate(), util.GetProviders())),
-		runtime.Must(cuexruntime.NewInternalPackage("builtin", builtin.GetTemplate(), builtin.GetProviders())),
+		runtime.Must(cuexruntime.NewInternalPackage("email", email.GetTemplate(), providertypes.TraceProviders("email", email.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("exec", exec.GetTemplate(), providertypes.TraceProviders("exec", exec.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("external", external.GetTemplate(), providertypes.TraceProviders("external", external.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("http", http.GetTemplate(), providertypes.TraceProviders("http", http.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("kube", kube.GetTemplate(), providertypes.TraceProviders("kube", kube.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("metrics", metrics.GetTemplate(), providertypes.TraceProviders("metrics", metrics.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("time", time.GetTemplate(), providertypes.TraceProviders("time", time.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("util", util.GetTemplate(), providertypes.TraceProviders("util", util.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("builtin", builtin.GetTemplate(), providertypes.TraceProviders("builtin", builtin.GetProviders()))),
+		runtime.Must(cuexruntime.NewInternalPackage("counter", counter.GetTemplate(), providertypes.TraceProviders("counter", counter.GetProviders()))),
 	), nil
 })
 
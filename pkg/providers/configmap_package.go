@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cuelang.org/go/cue/build"
+	"github.com/kubevela/pkg/cue/cuex"
+	cuexruntime "github.com/kubevela/pkg/cue/cuex/runtime"
+	"github.com/kubevela/pkg/cue/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+var (
+	// EnableConfigMapPackageForDefaultCompiler .
+	EnableConfigMapPackageForDefaultCompiler = false
+	// ConfigMapPackageNamespace is the namespace of the configmaps that contain cue packages
+	ConfigMapPackageNamespace = "vela-system"
+	// ConfigMapPackageResyncPeriod is the period to resync the cue packages from configmaps
+	ConfigMapPackageResyncPeriod = time.Minute
+)
+
+// configMapPackage is the cue package that has no provider, the templates come from the data of a configmap
+type configMapPackage struct {
+	name            string
+	path            string
+	resourceVersion string
+	templates       map[string]string
+	imports         []*build.Instance
+}
+
+func (in *configMapPackage) GetProviderFn(_ string) cuexruntime.ProviderFn {
+	return nil
+}
+
+func (in *configMapPackage) GetName() string {
+	return in.name
+}
+
+func (in *configMapPackage) GetPath() string {
+	return in.path
+}
+
+func (in *configMapPackage) GetTemplates() []string {
+	var templates []string
+	for _, t := range in.templates {
+		templates = append(templates, t)
+	}
+	return templates
+}
+
+func (in *configMapPackage) GetImports() []*build.Instance {
+	return in.imports
+}
+
+var _ cuexruntime.Package = &configMapPackage{}
+
+// NewConfigMapPackage creates the cue package from the configmap, each data of the configmap is a cue file
+func NewConfigMapPackage(cm *corev1.ConfigMap) (cuexruntime.Package, error) {
+	path := cm.Annotations[types.AnnotationCUEPackagePath]
+	if path == "" {
+		path = cm.Name
+	}
+	pkg := &configMapPackage{
+		name:            "configmap/" + cm.Namespace + "/" + cm.Name,
+		path:            path,
+		resourceVersion: cm.ResourceVersion,
+		templates:       cm.Data,
+	}
+	bi, err := util.BuildImport(path, cm.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build cue package %s from configmap %s/%s: %w", path, cm.Namespace, cm.Name, err)
+	}
+	pkg.imports = []*build.Instance{bi}
+	return pkg, nil
+}
+
+// ConfigMapPackageLoader loads the cue packages from configmaps into the compiler,
+// the packages are cached and only rebuilt when the configmaps are changed.
+type ConfigMapPackageLoader struct {
+	mu       sync.Mutex
+	packages map[string]*configMapPackage
+}
+
+// NewConfigMapPackageLoader creates a loader for the cue packages in configmaps
+func NewConfigMapPackageLoader() *ConfigMapPackageLoader {
+	return &ConfigMapPackageLoader{packages: make(map[string]*configMapPackage)}
+}
+
+// Load lists the cue package configmaps in the namespace and loads them into the compiler,
+// the packages of the deleted configmaps will be removed from the compiler.
+func (l *ConfigMapPackageLoader) Load(ctx context.Context, c *cuex.Compiler, cli client.Reader, namespace string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cms := &corev1.ConfigMapList{}
+	if err := cli.List(ctx, cms, client.InNamespace(namespace), client.HasLabels{types.LabelCUEPackage}); err != nil {
+		return err
+	}
+	var errs []error
+	loaded := make(map[string]*configMapPackage)
+	for i := range cms.Items {
+		cm := &cms.Items[i]
+		name := "configmap/" + cm.Namespace + "/" + cm.Name
+		if cached, ok := l.packages[name]; ok && cached.resourceVersion == cm.ResourceVersion {
+			loaded[name] = cached
+			continue
+		}
+		pkg, err := NewConfigMapPackage(cm)
+		if err != nil {
+			// keep the last valid version of the package
+			if cached, ok := l.packages[name]; ok {
+				loaded[name] = cached
+			}
+			errs = append(errs, err)
+			continue
+		}
+		loaded[name] = pkg.(*configMapPackage)
+		c.Externals.Set(name, pkg)
+	}
+	for name := range l.packages {
+		if _, ok := loaded[name]; !ok {
+			c.Externals.Del(name)
+		}
+	}
+	l.packages = loaded
+	return errors.Join(errs...)
+}
+
+var configMapPackageLoader = NewConfigMapPackageLoader()
+
+// ListenConfigMapPackages resyncs the cue packages from configmaps for the default compiler until the context is done
+func ListenConfigMapPackages(ctx context.Context, cli client.Reader) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := configMapPackageLoader.Load(ctx, DefaultCompiler.Get(), cli, ConfigMapPackageNamespace); err != nil {
+			klog.Errorf("failed to load cue packages from configmaps: %s", err.Error())
+		}
+	}, ConfigMapPackageResyncPeriod)
+}
@@ -0,0 +1,50 @@
+// counter.cue
+
+#Increment: {
+	#do:       "increment"
+	#provider: "counter"
+
+	$params: {
+		// +usage=The name of the counter in the workflow run
+		name: string
+		// +usage=The value added to the counter
+		by: *1 | int
+	}
+
+	$returns?: {
+		// +usage=The value of the counter after the increment
+		value: int
+	}
+}
+
+#Get: {
+	#do:       "get"
+	#provider: "counter"
+
+	$params: {
+		// +usage=The name of the counter in the workflow run
+		name: string
+	}
+
+	$returns?: {
+		// +usage=The value of the counter, it's 0 if the counter is not set
+		value: int
+	}
+}
+
+#Set: {
+	#do:       "set"
+	#provider: "counter"
+
+	$params: {
+		// +usage=The name of the counter in the workflow run
+		name: string
+		// +usage=The value to set
+		value: int
+	}
+
+	$returns?: {
+		// +usage=The value of the counter after it's set
+		value: int
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package counter
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+
+	cuexruntime "github.com/kubevela/pkg/cue/cuex/runtime"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+)
+
+const (
+	// ProviderName is provider name.
+	ProviderName = "counter"
+)
+
+// IncrementVars .
+type IncrementVars struct {
+	Name string `json:"name"`
+	By   int64  `json:"by"`
+}
+
+// IncrementParams .
+type IncrementParams = providertypes.Params[IncrementVars]
+
+// GetVars .
+type GetVars struct {
+	Name string `json:"name"`
+}
+
+// GetParams .
+type GetParams = providertypes.Params[GetVars]
+
+// SetVars .
+type SetVars struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// SetParams .
+type SetParams = providertypes.Params[SetVars]
+
+// ReturnVars .
+type ReturnVars struct {
+	Value int64 `json:"value"`
+}
+
+// Returns .
+type Returns = providertypes.Returns[ReturnVars]
+
+// Increment increments the counter of the workflow run
+func Increment(_ context.Context, params *IncrementParams) (*Returns, error) {
+	value, err := updateCounter(params.RuntimeParams, params.Params.Name, func(v int64) int64 {
+		return v + params.Params.By
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Returns{Returns: ReturnVars{Value: value}}, nil
+}
+
+// Get gets the counter of the workflow run
+func Get(_ context.Context, params *GetParams) (*Returns, error) {
+	value, err := wfContext.GetCounter(params.RuntimeParams.WorkflowContext, params.Params.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Returns{Returns: ReturnVars{Value: value}}, nil
+}
+
+// Set sets the counter of the workflow run
+func Set(_ context.Context, params *SetParams) (*Returns, error) {
+	value, err := updateCounter(params.RuntimeParams, params.Params.Name, func(int64) int64 {
+		return params.Params.Value
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Returns{Returns: ReturnVars{Value: value}}, nil
+}
+
+// updateCounter updates the counter once per execution of the field in the step, so that the counter is not updated
+// again if the field is re-evaluated in the same execution
+func updateCounter(params providertypes.RuntimeParams, name string, update func(int64) int64) (int64, error) {
+	pCtx := params.ProcessContext
+	caller := fmt.Sprintf("%v/%s", pCtx.GetData(model.ContextStepSessionID), params.FieldLabel)
+	return wfContext.UpdateCounter(params.WorkflowContext, name, caller, fmt.Sprint(pCtx.GetData(model.ContextSpanID)), update)
+}
+
+//go:embed counter.cue
+var template string
+
+// GetTemplate returns the cue template.
+func GetTemplate() string {
+	return template
+}
+
+// GetProviders returns the cue providers.
+func GetProviders() map[string]cuexruntime.ProviderFn {
+	return map[string]cuexruntime.ProviderFn{
+		"increment": providertypes.GenericProviderFn[IncrementVars, Returns](Increment),
+		"get":       providertypes.GenericProviderFn[GetVars, Returns](Get),
+		"set":       providertypes.GenericProviderFn[SetVars, Returns](Set),
+	}
+}
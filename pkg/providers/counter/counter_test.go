@@ -0,0 +1,71 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package counter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubevela/pkg/util/singleton"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/cue/process"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+)
+
+func TestCounter(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	singleton.KubeClient.Set(fake.NewClientBuilder().Build())
+	wfCtx, err := wfContext.NewContext(ctx, "default", "counter", nil)
+	r.NoError(err)
+	r.NoError(wfCtx.Commit(ctx))
+	pCtx := process.NewContext(process.ContextData{})
+	pCtx.PushData(model.ContextStepSessionID, "step")
+	runtimeParams := providertypes.RuntimeParams{WorkflowContext: wfCtx, ProcessContext: pCtx, FieldLabel: "counter"}
+	execute := func(id string) providertypes.RuntimeParams {
+		pCtx.PushData(model.ContextSpanID, id)
+		return runtimeParams
+	}
+
+	res, err := Get(ctx, &GetParams{Params: GetVars{Name: "retries"}, RuntimeParams: runtimeParams})
+	r.NoError(err)
+	r.Equal(int64(0), res.Returns.Value)
+	res, err = Increment(ctx, &IncrementParams{Params: IncrementVars{Name: "retries", By: 1}, RuntimeParams: execute("1")})
+	r.NoError(err)
+	r.Equal(int64(1), res.Returns.Value)
+	res, err = Increment(ctx, &IncrementParams{Params: IncrementVars{Name: "retries", By: 2}, RuntimeParams: execute("2")})
+	r.NoError(err)
+	r.Equal(int64(3), res.Returns.Value)
+	// the counter is updated once if the field is re-evaluated in the same execution
+	res, err = Increment(ctx, &IncrementParams{Params: IncrementVars{Name: "retries", By: 2}, RuntimeParams: execute("2")})
+	r.NoError(err)
+	r.Equal(int64(3), res.Returns.Value)
+	res, err = Set(ctx, &SetParams{Params: SetVars{Name: "retries", Value: 0}, RuntimeParams: execute("3")})
+	r.NoError(err)
+	r.Equal(int64(0), res.Returns.Value)
+	res, err = Get(ctx, &GetParams{Params: GetVars{Name: "retries"}, RuntimeParams: runtimeParams})
+	r.NoError(err)
+	r.Equal(int64(0), res.Returns.Value)
+
+	_, err = Increment(ctx, &IncrementParams{Params: IncrementVars{By: 1}, RuntimeParams: runtimeParams})
+	r.ErrorContains(err, "the name of the counter can not be empty")
+}
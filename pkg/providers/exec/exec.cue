@@ -0,0 +1,46 @@
+// exec.cue
+
+#Run: {
+	#do:       "run"
+	#provider: "exec"
+
+	$params: {
+		// +usage=The prefix of the name of the pod to run the command, the attempt of the pod is appended to it
+		name: string
+		// +usage=The namespace of the pod to run the command
+		namespace: *"default" | string
+		// +usage=The image of the container
+		image: string
+		// +usage=The command of the container
+		command?: [...string]
+		// +usage=The arguments of the command
+		args?: [...string]
+		// +usage=The environment variables of the container
+		env?: [string]: string
+		// +usage=The resource requirements of the container
+		resources?: {
+			limits?: [string]:   string
+			requests?: [string]: string
+		}
+		// +usage=The duration the pod may be active before it's killed, e.g. "10m"
+		activeDeadline?: string
+		// +usage=The number of the lines from the end of the logs to return, all the logs are returned if it's 0
+		tailLines: *0 | int
+		// +usage=The max size in bytes of the logs to return, the beginning of the logs is dropped beyond it, the default is 65536
+		logLimit?: int
+	}
+
+	$returns?: {
+		// +usage=The phase of the command, pending, running, succeeded or failed
+		phase: string
+		// +usage=The exit code of the command
+		exitCode: int
+		// +usage=The logs of the command
+		logs: string
+		// +usage=The message of the pod or the terminated container
+		message?: string
+		// +usage=Whether the beginning of the logs is dropped to keep them within the limit
+		truncated?: bool
+	}
+	...
+}
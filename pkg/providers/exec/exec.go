@@ -0,0 +1,382 @@
+/*
+ Copyright 2021. The KubeVela Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package exec
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuexruntime "github.com/kubevela/pkg/cue/cuex/runtime"
+	"github.com/kubevela/pkg/util/singleton"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+const (
+	// ProviderName is provider name for install.
+	ProviderName = "exec"
+	// containerName is the name of the container that runs the command
+	containerName = "exec"
+)
+
+const (
+	// PhasePending means the pod is created but the command is not started
+	PhasePending = "pending"
+	// PhaseRunning means the command is running
+	PhaseRunning = "running"
+	// PhaseSucceeded means the command exits with zero
+	PhaseSucceeded = "succeeded"
+	// PhaseFailed means the command exits with non-zero or the pod is failed, e.g. the active deadline is exceeded
+	PhaseFailed = "failed"
+)
+
+// Resources is the resource requirements of the container
+type Resources struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+// RunVars .
+type RunVars struct {
+	Name           string            `json:"name"`
+	Namespace      string            `json:"namespace"`
+	Image          string            `json:"image"`
+	Command        []string          `json:"command,omitempty"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Resources      *Resources        `json:"resources,omitempty"`
+	ActiveDeadline string            `json:"activeDeadline,omitempty"`
+	TailLines      int64             `json:"tailLines,omitempty"`
+	LogLimit       int               `json:"logLimit,omitempty"`
+}
+
+// RunReturnVars .
+type RunReturnVars struct {
+	Phase    string `json:"phase"`
+	ExitCode int32  `json:"exitCode"`
+	Logs     string `json:"logs"`
+	Message  string `json:"message,omitempty"`
+	// Truncated is true if the beginning of the logs is dropped to keep them within the limit
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// podState is the state of the pods of the step in the workflow context
+type podState struct {
+	// Attempt is the number of the pods created before the current one, it's appended to the name of the pod
+	Attempt int `json:"attempt"`
+	// Token is the idempotency token of the execution of the step that created the pod
+	Token string `json:"token,omitempty"`
+	// Result is the result of the finished pod, the pod is deleted once its result is captured
+	Result *RunReturnVars `json:"result,omitempty"`
+}
+
+// RunParams .
+type RunParams = providertypes.Params[RunVars]
+
+// RunReturns .
+type RunReturns = providertypes.Returns[RunReturnVars]
+
+// DefaultLogLimit is the default max size in bytes of the logs returned by the exec pods
+const DefaultLogLimit = 64 * 1024
+
+// maxLogReadSize is the max size in bytes of the logs kept in memory while they're read
+const maxLogReadSize = 4 * 1024 * 1024
+
+// LogReader reads the logs of the container in the pod
+type LogReader func(ctx context.Context, namespace, name string, tailLines int64) (string, error)
+
+// ReadLogs reads the logs of the exec pods, it can be replaced for the environments without kubelet
+var ReadLogs LogReader = func(ctx context.Context, namespace, name string, tailLines int64) (string, error) {
+	opts := &corev1.PodLogOptions{Container: containerName}
+	if tailLines > 0 {
+		opts.TailLines = &tailLines
+	}
+	stream, err := singleton.StaticClient.Get().CoreV1().Pods(namespace).GetLogs(name, opts).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = stream.Close()
+	}()
+	return readTail(stream, maxLogReadSize)
+}
+
+// readTail reads the reader and keeps at most the last limit bytes
+func readTail(r io.Reader, limit int) (string, error) {
+	var buf []byte
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if len(buf) > 2*limit {
+			buf = append(buf[:0], buf[len(buf)-limit:]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(buf) > limit {
+		buf = buf[len(buf)-limit:]
+	}
+	return string(buf), nil
+}
+
+// Run runs the command in a pod, the pod is created on the first call and its status and logs are returned
+// in the following calls until the command exits. The pod is owned by the run and deleted once its result is
+// captured in the workflow context, and the result is returned again if the step is evaluated again in the same
+// execution. Once the failed command is retried or the step is executed again in a new attempt, the command runs
+// in a new pod whose name ends with the attempt.
+func Run(ctx context.Context, params *RunParams) (*RunReturns, error) {
+	cli := params.KubeClient
+	state, err := loadState(params)
+	if err != nil {
+		return nil, err
+	}
+	if state.Result != nil {
+		if state.Token == params.IdempotencyToken && state.Result.Phase == PhaseSucceeded {
+			return &RunReturns{Returns: *state.Result}, nil
+		}
+		state = podState{Attempt: state.Attempt + 1}
+	}
+	state.Token = params.IdempotencyToken
+	name := fmt.Sprintf("%s-%d", params.Params.Name, state.Attempt)
+	pod := &corev1.Pod{}
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: params.Params.Namespace, Name: name}, pod); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return nil, err
+		}
+		if pod, err = newPod(params, name); err != nil {
+			return nil, err
+		}
+		if err := cli.Create(ctx, pod); err != nil {
+			return nil, err
+		}
+		if err := saveState(params, state); err != nil {
+			return nil, err
+		}
+		return &RunReturns{Returns: RunReturnVars{Phase: PhasePending}}, nil
+	}
+
+	returns := RunReturnVars{Phase: PhasePending}
+	switch pod.Status.Phase {
+	case corev1.PodRunning:
+		returns.Phase = PhaseRunning
+	case corev1.PodSucceeded:
+		returns.Phase = PhaseSucceeded
+	case corev1.PodFailed:
+		returns.Phase, returns.Message = PhaseFailed, pod.Status.Message
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName && status.State.Terminated != nil {
+			returns.ExitCode = status.State.Terminated.ExitCode
+			if returns.Message == "" {
+				returns.Message = status.State.Terminated.Message
+			}
+		}
+	}
+	if returns.Phase == PhasePending {
+		return &RunReturns{Returns: returns}, nil
+	}
+	logs, err := ReadLogs(ctx, pod.Namespace, pod.Name, params.Params.TailLines)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the logs of pod %s: %w", pod.Name, err)
+	}
+	returns.Logs, returns.Truncated = truncateLogs(logs, params.Params.LogLimit)
+	if returns.Phase == PhaseRunning {
+		return &RunReturns{Returns: returns}, nil
+	}
+	state.Result = &returns
+	if err := saveState(params, state); err != nil {
+		return nil, err
+	}
+	if err := cli.Delete(ctx, pod); err != nil && !kerrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to delete the finished pod %s: %w", pod.Name, err)
+	}
+	return &RunReturns{Returns: returns}, nil
+}
+
+// truncateLogs keeps the end of the logs within the limit, the default limit is used if it's not positive
+func truncateLogs(logs string, limit int) (string, bool) {
+	if limit <= 0 {
+		limit = DefaultLogLimit
+	}
+	if len(logs) <= limit {
+		return logs, false
+	}
+	return logs[len(logs)-limit:], true
+}
+
+func loadState(params *RunParams) (podState, error) {
+	state := podState{}
+	if params.WorkflowContext == nil {
+		return state, nil
+	}
+	data := params.WorkflowContext.GetMutableValue(types.ContextPrefixExecPod, params.Params.Name)
+	if data == "" {
+		return state, nil
+	}
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return state, fmt.Errorf("failed to decode the state of the pods %s: %w", params.Params.Name, err)
+	}
+	return state, nil
+}
+
+func saveState(params *RunParams, state podState) error {
+	if params.WorkflowContext == nil {
+		return nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	params.WorkflowContext.SetMutableValue(string(b), types.ContextPrefixExecPod, params.Params.Name)
+	return nil
+}
+
+func newPod(params *RunParams, name string) (*corev1.Pod, error) {
+	container := corev1.Container{
+		Name:    containerName,
+		Image:   params.Params.Image,
+		Command: params.Params.Command,
+		Args:    params.Params.Args,
+	}
+	for k, v := range params.Params.Env {
+		container.Env = append(container.Env, corev1.EnvVar{Name: k, Value: v})
+	}
+	if r := params.Params.Resources; r != nil {
+		var err error
+		if container.Resources.Limits, err = parseResourceList(r.Limits); err != nil {
+			return nil, err
+		}
+		if container.Resources.Requests, err = parseResourceList(r.Requests); err != nil {
+			return nil, err
+		}
+	}
+	labels := map[string]string{types.LabelExecPod: "true"}
+	for k, v := range params.Labels {
+		labels[k] = v
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: params.Params.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers:    []corev1.Container{container},
+		},
+	}
+	// the pod is garbage collected with the run, the owner must be in the same namespace
+	if runName := params.Labels[types.LabelWorkflowRunName]; params.RunUID != "" && runName != "" &&
+		params.Labels[types.LabelWorkflowRunNamespace] == pod.Namespace {
+		pod.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       v1alpha1.WorkflowRunKind,
+			Name:       runName,
+			UID:        ktypes.UID(params.RunUID),
+			Controller: pointer.Bool(true),
+		}}
+	}
+	if params.Params.ActiveDeadline != "" {
+		deadline, err := time.ParseDuration(params.Params.ActiveDeadline)
+		if err != nil {
+			return nil, fmt.Errorf("invalid active deadline %s: %w", params.Params.ActiveDeadline, err)
+		}
+		seconds := int64(deadline.Seconds())
+		if seconds < 1 {
+			seconds = 1
+		}
+		pod.Spec.ActiveDeadlineSeconds = &seconds
+	}
+	return pod, nil
+}
+
+func parseResourceList(resources map[string]string) (corev1.ResourceList, error) {
+	if len(resources) == 0 {
+		return nil, nil
+	}
+	list := corev1.ResourceList{}
+	for k, v := range resources {
+		quantity, err := resource.ParseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %s of resource %s: %w", v, k, err)
+		}
+		list[corev1.ResourceName(k)] = quantity
+	}
+	return list, nil
+}
+
+// CleanupPods deletes the exec pods of the workflow run that are not completed, e.g. once the run is terminated. The
+// completed pods are deleted by the steps once their results are captured.
+func CleanupPods(ctx context.Context, cli client.Client, name, namespace string) error {
+	pods := &corev1.PodList{}
+	if err := cli.List(ctx, pods, client.MatchingLabels{
+		types.LabelExecPod:              "true",
+		types.LabelWorkflowRunName:      name,
+		types.LabelWorkflowRunNamespace: namespace,
+	}); err != nil {
+		return err
+	}
+	var errs []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if err := cli.Delete(ctx, pod); err != nil && !kerrors.IsNotFound(err) {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete the exec pods: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+//go:embed exec.cue
+var template string
+
+// GetTemplate returns the cue template.
+func GetTemplate() string {
+	return template
+}
+
+// GetProviders returns the cue providers.
+func GetProviders() map[string]cuexruntime.ProviderFn {
+	return map[string]cuexruntime.ProviderFn{
+		"run": providertypes.GenericProviderFn[RunVars, RunReturns](Run),
+	}
+}
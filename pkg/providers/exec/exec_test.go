@@ -0,0 +1,187 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+func TestRun(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+	singleton.KubeClient.Set(cli)
+	wfCtx, err := wfContext.NewContext(ctx, "default", "run", nil)
+	r.NoError(err)
+	originalReadLogs := ReadLogs
+	defer func() { ReadLogs = originalReadLogs }()
+	ReadLogs = func(ctx context.Context, namespace, name string, tailLines int64) (string, error) {
+		r.Equal(int64(10), tailLines)
+		return "hello", nil
+	}
+	params := &RunParams{
+		Params: RunVars{
+			Name:           "run-step",
+			Namespace:      "default",
+			Image:          "busybox",
+			Command:        []string{"echo", "hello"},
+			Env:            map[string]string{"FOO": "bar"},
+			Resources:      &Resources{Limits: map[string]string{"cpu": "500m"}},
+			ActiveDeadline: "90s",
+			TailLines:      10,
+		},
+		RuntimeParams: providertypes.RuntimeParams{
+			WorkflowContext:  wfCtx,
+			KubeClient:       cli,
+			Labels:           map[string]string{types.LabelWorkflowRunName: "run", types.LabelWorkflowRunNamespace: "default"},
+			RunUID:           "run-uid",
+			IdempotencyToken: "attempt-0",
+		},
+	}
+	setStatus := func(name string, phase corev1.PodPhase, exitCode int32, message string) {
+		pod := &corev1.Pod{}
+		r.NoError(cli.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, pod))
+		pod.Status.Phase = phase
+		if exitCode != 0 || phase == corev1.PodSucceeded {
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  containerName,
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Message: message}},
+			}}
+		}
+		r.NoError(cli.Update(ctx, pod))
+	}
+
+	res, err := Run(ctx, params)
+	r.NoError(err)
+	r.Equal(PhasePending, res.Returns.Phase)
+	pod := &corev1.Pod{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Name: "run-step-0", Namespace: "default"}, pod))
+	r.Equal("true", pod.Labels[types.LabelExecPod])
+	r.Equal("run", pod.Labels[types.LabelWorkflowRunName])
+	r.Equal(corev1.RestartPolicyNever, pod.Spec.RestartPolicy)
+	r.Equal(int64(90), *pod.Spec.ActiveDeadlineSeconds)
+	r.Equal([]corev1.EnvVar{{Name: "FOO", Value: "bar"}}, pod.Spec.Containers[0].Env)
+	r.Equal(resource.MustParse("500m"), pod.Spec.Containers[0].Resources.Limits[corev1.ResourceCPU])
+	r.Equal("run", pod.OwnerReferences[0].Name)
+	r.Equal("run-uid", string(pod.OwnerReferences[0].UID))
+
+	setStatus("run-step-0", corev1.PodRunning, 0, "")
+	res, err = Run(ctx, params)
+	r.NoError(err)
+	r.Equal(RunReturnVars{Phase: PhaseRunning, Logs: "hello"}, res.Returns)
+
+	// the finished pod is deleted once its result is captured
+	setStatus("run-step-0", corev1.PodFailed, 2, "not found")
+	res, err = Run(ctx, params)
+	r.NoError(err)
+	r.Equal(RunReturnVars{Phase: PhaseFailed, ExitCode: 2, Logs: "hello", Message: "not found"}, res.Returns)
+	r.True(kerrors.IsNotFound(cli.Get(ctx, client.ObjectKey{Name: "run-step-0", Namespace: "default"}, &corev1.Pod{})))
+
+	// the failed command is retried in a new pod
+	res, err = Run(ctx, params)
+	r.NoError(err)
+	r.Equal(PhasePending, res.Returns.Phase)
+	setStatus("run-step-1", corev1.PodSucceeded, 0, "")
+	res, err = Run(ctx, params)
+	r.NoError(err)
+	r.Equal(RunReturnVars{Phase: PhaseSucceeded, Logs: "hello"}, res.Returns)
+	// the succeeded result is returned again in the same execution
+	res, err = Run(ctx, params)
+	r.NoError(err)
+	r.Equal(PhaseSucceeded, res.Returns.Phase)
+	r.True(kerrors.IsNotFound(cli.Get(ctx, client.ObjectKey{Name: "run-step-2", Namespace: "default"}, &corev1.Pod{})))
+	// the command runs again in a new attempt of the step
+	params.IdempotencyToken = "attempt-1"
+	res, err = Run(ctx, params)
+	r.NoError(err)
+	r.Equal(PhasePending, res.Returns.Phase)
+	r.NoError(cli.Get(ctx, client.ObjectKey{Name: "run-step-2", Namespace: "default"}, &corev1.Pod{}))
+
+	// the beginning of the logs is dropped beyond the limit
+	ReadLogs = func(ctx context.Context, namespace, name string, tailLines int64) (string, error) {
+		return "0123456789", nil
+	}
+	params.Params.LogLimit = 4
+	setStatus("run-step-2", corev1.PodSucceeded, 0, "")
+	res, err = Run(ctx, params)
+	r.NoError(err)
+	r.Equal(RunReturnVars{Phase: PhaseSucceeded, Logs: "6789", Truncated: true}, res.Returns)
+
+	params.Params.Name = "invalid-pod"
+	params.Params.ActiveDeadline = "soon"
+	_, err = Run(ctx, params)
+	r.Contains(err.Error(), "invalid active deadline soon")
+	params.Params.ActiveDeadline = "1m"
+	params.Params.Resources.Requests = map[string]string{"memory": "a lot"}
+	_, err = Run(ctx, params)
+	r.Contains(err.Error(), "invalid quantity a lot of resource memory")
+}
+
+func TestReadTail(t *testing.T) {
+	r := require.New(t)
+	logs, err := readTail(strings.NewReader(strings.Repeat("a", 100)+"end"), 10)
+	r.NoError(err)
+	r.Equal("aaaaaaaend", logs)
+	logs, err = readTail(strings.NewReader("short"), 10)
+	r.NoError(err)
+	r.Equal("short", logs)
+}
+
+func TestCleanupPods(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	newPod := func(name, run string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{
+				types.LabelExecPod:              "true",
+				types.LabelWorkflowRunName:      run,
+				types.LabelWorkflowRunNamespace: "default",
+			}},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	cli := fake.NewClientBuilder().WithObjects(
+		newPod("running", "run", corev1.PodRunning),
+		newPod("pending", "run", corev1.PodPending),
+		newPod("succeeded", "run", corev1.PodSucceeded),
+		newPod("other", "other-run", corev1.PodRunning),
+	).Build()
+
+	r.NoError(CleanupPods(ctx, cli, "run", "default"))
+	pods := &corev1.PodList{}
+	r.NoError(cli.List(ctx, pods))
+	var names []string
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	r.ElementsMatch([]string{"succeeded", "other"}, names)
+}
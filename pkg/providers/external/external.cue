@@ -0,0 +1,39 @@
+// external.cue
+
+#Call: {
+	#do:       "call"
+	#provider: "external"
+
+	$params: {
+		// +usage=The name of the external executor registered by the config map in the registry namespace
+		executor: string
+		// +usage=The workflow run that the step belongs to
+		run: {
+			name:      string
+			namespace: string
+		}
+		// +usage=The step called on the executor, the id is kept across the calls of the same step execution
+		step: {
+			name: string
+			id:   string
+		}
+		// +usage=The properties passed to the executor
+		properties?: {...}
+		// +usage=The timeout of each call, e.g. "10s", the timeout of the executor is used if it's empty
+		timeout?: string
+	}
+
+	$returns?: {
+		// +usage=The phase of the step, running, succeeded or failed
+		phase: string
+		// +usage=The intermediate state of the running step, such as "uploading" or "verifying"
+		subPhase?: string
+		// +usage=The message of the step
+		message?: string
+		// +usage=The outputs of the step
+		outputs?: {...}
+		// +usage=The informational metadata of the step, e.g. the URL of the remote job
+		metadata?: [string]: string
+	}
+	...
+}
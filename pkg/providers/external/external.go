@@ -0,0 +1,269 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cuexruntime "github.com/kubevela/pkg/cue/cuex/runtime"
+	"github.com/kubevela/pkg/util/singleton"
+
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+const (
+	// ProviderName is provider name for install.
+	ProviderName = "external"
+	// MethodExecute is the JSON-RPC method called on the external executors
+	MethodExecute = "execute"
+	// EndpointKey is the key of the endpoint in the data of the executor config map
+	EndpointKey = "endpoint"
+	// TimeoutKey is the key of the default timeout in the data of the executor config map
+	TimeoutKey = "timeout"
+	// DefaultTimeout is the timeout of each call if it's not set in the step or the executor config map
+	DefaultTimeout = 30 * time.Second
+)
+
+const (
+	// PhaseRunning means the executor is still working on the step, it will be called again later
+	PhaseRunning = "running"
+	// PhaseSucceeded means the step is succeeded
+	PhaseSucceeded = "succeeded"
+	// PhaseFailed means the step is failed
+	PhaseFailed = "failed"
+)
+
+// RegistryNamespace is the namespace of the config maps that register the external executors
+var RegistryNamespace = "vela-system"
+
+// Run is the workflow run that the step belongs to
+type Run struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// Step is the step called on the external executor
+type Step struct {
+	Name string `json:"name"`
+	// ID is the session id of the step, it's kept across the calls of the same step execution so that the
+	// executor can report the status of a long operation instead of starting it again
+	ID string `json:"id"`
+}
+
+// ExecuteParams is the params of the execute method
+type ExecuteParams struct {
+	Run        Run                    `json:"run"`
+	Step       Step                   `json:"step"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	// ContinuationToken is the token returned by the executor in the last call of the same step execution
+	ContinuationToken string `json:"continuationToken,omitempty"`
+	// IdempotencyToken is the same in the calls of the same step execution, including the retries of the failed
+	// calls, the executor can dedupe the side effects of the step by it
+	IdempotencyToken string `json:"idempotencyToken,omitempty"`
+}
+
+// ExecuteResult is the result of the execute method
+type ExecuteResult struct {
+	// Phase is running, succeeded or failed
+	Phase string `json:"phase"`
+	// SubPhase is the optional intermediate state of the running step, e.g. uploading or verifying
+	SubPhase string                 `json:"subPhase,omitempty"`
+	Message  string                 `json:"message,omitempty"`
+	Outputs  map[string]interface{} `json:"outputs,omitempty"`
+	// ContinuationToken is the optional handle of the long operation started by the executor, it's kept in the step
+	// status and passed back in the next calls so that the executor polls the operation instead of starting a new one
+	ContinuationToken string `json:"continuationToken,omitempty"`
+	// Metadata is the optional informational data of the step for the operators, e.g. the URL of the remote job,
+	// it's kept in the step status
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Request is the JSON-RPC 2.0 request sent to the external executor
+type Request struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      string        `json:"id"`
+	Method  string        `json:"method"`
+	Params  ExecuteParams `json:"params"`
+}
+
+// Error is the JSON-RPC 2.0 error returned by the external executor
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Response is the JSON-RPC 2.0 response returned by the external executor
+type Response struct {
+	JSONRPC string         `json:"jsonrpc"`
+	ID      string         `json:"id"`
+	Result  *ExecuteResult `json:"result,omitempty"`
+	Error   *Error         `json:"error,omitempty"`
+}
+
+// CallVars .
+type CallVars struct {
+	Executor   string                 `json:"executor"`
+	Run        Run                    `json:"run"`
+	Step       Step                   `json:"step"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Timeout    string                 `json:"timeout,omitempty"`
+}
+
+// CallParams .
+type CallParams = providertypes.Params[CallVars]
+
+// CallReturns .
+type CallReturns = providertypes.Returns[ExecuteResult]
+
+// Call calls the execute method of the registered external executor. The executor is expected to be idempotent
+// for the same step id, it returns running for the long operations and is polled until it returns succeeded or failed.
+func Call(ctx context.Context, params *CallParams) (*CallReturns, error) {
+	endpoint, timeout, err := getExecutor(ctx, params.Params.Executor)
+	if err != nil {
+		return nil, err
+	}
+	if params.Params.Timeout != "" {
+		if timeout, err = time.ParseDuration(params.Params.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout %s: %w", params.Params.Timeout, err)
+		}
+	}
+	req := Request{
+		JSONRPC: "2.0",
+		ID:      params.Params.Step.ID,
+		Method:  MethodExecute,
+		Params: ExecuteParams{
+			Run:              params.Params.Run,
+			Step:             params.Params.Step,
+			Properties:       params.Params.Properties,
+			IdempotencyToken: params.IdempotencyToken,
+		},
+	}
+	if params.Action != nil {
+		if status := params.Action.GetStatus(); status.ID == params.Params.Step.ID {
+			req.Params.ContinuationToken = status.ContinuationToken
+		}
+	}
+	resp, err := call(ctx, endpoint, timeout, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call the external executor %s: %w", params.Params.Executor, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("the external executor %s returns error %d: %s", params.Params.Executor, resp.Error.Code, resp.Error.Message)
+	}
+	if resp.Result == nil {
+		return nil, fmt.Errorf("the external executor %s returns no result", params.Params.Executor)
+	}
+	switch resp.Result.Phase {
+	case PhaseRunning, PhaseSucceeded, PhaseFailed:
+	default:
+		return nil, fmt.Errorf("the external executor %s returns invalid phase %q", params.Params.Executor, resp.Result.Phase)
+	}
+	if continuer, ok := params.Action.(types.ActionContinuer); ok && resp.Result.ContinuationToken != "" {
+		continuer.ContinuationToken(resp.Result.ContinuationToken)
+	}
+	if reporter, ok := params.Action.(types.ActionMetadataReporter); ok && len(resp.Result.Metadata) > 0 {
+		reporter.Metadata(resp.Result.Metadata)
+	}
+	return &CallReturns{Returns: *resp.Result}, nil
+}
+
+// getExecutor gets the endpoint and the default timeout of the executor from its config map, the config map is read
+// by the controller instead of the user of the run since the executors are registered by the administrators
+func getExecutor(ctx context.Context, name string) (string, time.Duration, error) {
+	cm := &corev1.ConfigMap{}
+	if err := singleton.KubeClient.Get().Get(ctx, client.ObjectKey{Namespace: RegistryNamespace, Name: name}, cm); err != nil {
+		if kerrors.IsNotFound(err) {
+			return "", 0, fmt.Errorf("external executor %s is not registered", name)
+		}
+		return "", 0, err
+	}
+	if cm.Labels[types.LabelExternalExecutor] != "true" {
+		return "", 0, fmt.Errorf("external executor %s is not registered, the config map must be labeled with %s=true", name, types.LabelExternalExecutor)
+	}
+	endpoint := cm.Data[EndpointKey]
+	if endpoint == "" {
+		return "", 0, fmt.Errorf("the endpoint of external executor %s is empty", name)
+	}
+	timeout := DefaultTimeout
+	if s := cm.Data[TimeoutKey]; s != "" {
+		var err error
+		if timeout, err = time.ParseDuration(s); err != nil {
+			return "", 0, fmt.Errorf("invalid timeout %s of external executor %s: %w", s, name, err)
+		}
+	}
+	return endpoint, timeout, nil
+}
+
+func call(ctx context.Context, endpoint string, timeout time.Duration, req Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = httpResp.Body.Close()
+	}()
+	b, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", httpResp.StatusCode, string(b))
+	}
+	resp := &Response{}
+	if err := json.Unmarshal(b, resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return resp, nil
+}
+
+//go:embed external.cue
+var template string
+
+// GetTemplate returns the cue template.
+func GetTemplate() string {
+	return template
+}
+
+// GetProviders returns the cue providers.
+func GetProviders() map[string]cuexruntime.ProviderFn {
+	return map[string]cuexruntime.ProviderFn{
+		"call": providertypes.GenericProviderFn[CallVars, CallReturns](Call),
+	}
+}
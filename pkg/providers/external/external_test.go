@@ -0,0 +1,149 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubevela/pkg/util/singleton"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/mock"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+func TestCall(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	phases := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.Equal(http.MethodPost, req.Method)
+		request := Request{}
+		r.NoError(json.NewDecoder(req.Body).Decode(&request))
+		r.Equal("2.0", request.JSONRPC)
+		r.Equal(MethodExecute, request.Method)
+		r.Equal("run", request.Params.Run.Name)
+		resp := Response{JSONRPC: "2.0", ID: request.ID}
+		switch request.Params.Properties["action"] {
+		case "sleep":
+			time.Sleep(time.Second)
+		case "error":
+			resp.Error = &Error{Code: -32602, Message: "invalid params"}
+		case "invalid":
+			resp.Result = &ExecuteResult{Phase: "unknown"}
+		case "async":
+			r.Equal("token-1", request.Params.IdempotencyToken)
+			// the operation is started on the first call and polled by the token on the next calls
+			if request.Params.ContinuationToken == "" {
+				resp.Result = &ExecuteResult{Phase: PhaseRunning, ContinuationToken: "op-1", Metadata: map[string]string{"operation": "op-1"}}
+			} else {
+				resp.Result = &ExecuteResult{Phase: PhaseSucceeded, Message: "polled " + request.Params.ContinuationToken}
+			}
+		default:
+			// the operation is running on the first call and succeeded on the next call of the same step
+			if _, ok := phases[request.ID]; !ok {
+				phases[request.ID] = PhaseRunning
+				resp.Result = &ExecuteResult{Phase: PhaseRunning, Message: "deploying"}
+			} else {
+				resp.Result = &ExecuteResult{Phase: PhaseSucceeded, Outputs: map[string]interface{}{"version": request.Params.Properties["version"]}}
+			}
+		}
+		r.NoError(json.NewEncoder(w).Encode(resp))
+	}))
+	defer srv.Close()
+
+	singleton.KubeClient.Set(fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: RegistryNamespace, Labels: map[string]string{types.LabelExternalExecutor: "true"}},
+			Data:       map[string]string{EndpointKey: srv.URL, TimeoutKey: "5s"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlabeled", Namespace: RegistryNamespace},
+			Data:       map[string]string{EndpointKey: srv.URL},
+		},
+	).Build())
+
+	call := func(executor string, properties map[string]interface{}, timeout string) (*CallReturns, error) {
+		return Call(ctx, &CallParams{Params: CallVars{
+			Executor:   executor,
+			Run:        Run{Name: "run", Namespace: "default"},
+			Step:       Step{Name: "deploy", ID: "deploy-abc"},
+			Properties: properties,
+			Timeout:    timeout,
+		}})
+	}
+
+	res, err := call("deployer", map[string]interface{}{"version": "v1"}, "")
+	r.NoError(err)
+	r.Equal(ExecuteResult{Phase: PhaseRunning, Message: "deploying"}, res.Returns)
+	res, err = call("deployer", map[string]interface{}{"version": "v1"}, "")
+	r.NoError(err)
+	r.Equal(ExecuteResult{Phase: PhaseSucceeded, Outputs: map[string]interface{}{"version": "v1"}}, res.Returns)
+
+	act := &mock.Action{}
+	callAsync := func() (*CallReturns, error) {
+		return Call(ctx, &CallParams{
+			Params: CallVars{
+				Executor:   "deployer",
+				Run:        Run{Name: "run", Namespace: "default"},
+				Step:       Step{Name: "deploy", ID: "deploy-abc"},
+				Properties: map[string]interface{}{"action": "async"},
+			},
+			RuntimeParams: providertypes.RuntimeParams{Action: act, IdempotencyToken: "token-1"},
+		})
+	}
+	res, err = callAsync()
+	r.NoError(err)
+	r.Equal(PhaseRunning, res.Returns.Phase)
+	r.Equal("op-1", act.Token)
+	r.Equal(map[string]string{"operation": "op-1"}, act.Meta)
+	// the token of another execution of the step is not passed back
+	act.Status = v1alpha1.StepStatus{ID: "deploy-old", ContinuationToken: "op-0"}
+	res, err = callAsync()
+	r.NoError(err)
+	r.Equal(PhaseRunning, res.Returns.Phase)
+	act.Status = v1alpha1.StepStatus{ID: "deploy-abc", ContinuationToken: act.Token}
+	res, err = callAsync()
+	r.NoError(err)
+	r.Equal(ExecuteResult{Phase: PhaseSucceeded, Message: "polled op-1"}, res.Returns)
+
+	_, err = call("deployer", map[string]interface{}{"action": "sleep"}, "100ms")
+	r.Error(err)
+	r.Contains(err.Error(), "context deadline exceeded")
+	_, err = call("deployer", map[string]interface{}{"action": "error"}, "")
+	r.EqualError(err, "the external executor deployer returns error -32602: invalid params")
+	_, err = call("deployer", map[string]interface{}{"action": "invalid"}, "")
+	r.EqualError(err, "the external executor deployer returns invalid phase \"unknown\"")
+	_, err = call("deployer", nil, "invalid")
+	r.Error(err)
+	r.Contains(err.Error(), "invalid timeout invalid")
+	_, err = call("not-found", nil, "")
+	r.EqualError(err, "external executor not-found is not registered")
+	_, err = call("unlabeled", nil, "")
+	r.EqualError(err, "external executor unlabeled is not registered, the config map must be labeled with workflow.oam.dev/external-executor=true")
+}
@@ -155,6 +155,21 @@ func TestHttpDo(t *testing.T) {
 		r.Equal(res.Returns.StatusCode, tc.expected.StatusCode, tName)
 	}
 
+	// the request is cancelled with the context, e.g. when the workflow run is terminated
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := Do(cancelCtx, &DoParams{
+		Params: RequestVars{
+			Method:  "GET",
+			URL:     "http://127.0.0.1:1229/timeout",
+			Request: &Request{Timeout: "3s"},
+		},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "context canceled")
+	require.Less(t, time.Since(start), time.Second)
+
 	// test ratelimiter
 	rateLimiter = ratelimiter.NewRateLimiter(1)
 	limiterTestCases := []struct {
@@ -226,6 +241,26 @@ func TestHttpDo(t *testing.T) {
 	}
 }
 
+func TestHttpDoIdempotencyKey(t *testing.T) {
+	r := require.New(t)
+	var keys []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		keys = append(keys, req.Header.Get("Idempotency-Key"))
+	}))
+	defer s.Close()
+	do := func(header map[string]string, token string) {
+		_, err := Do(context.Background(), &DoParams{
+			Params:        RequestVars{Method: "POST", URL: s.URL, Request: &Request{Header: header}},
+			RuntimeParams: types.RuntimeParams{IdempotencyToken: token},
+		})
+		r.NoError(err)
+	}
+	do(nil, "token")
+	do(map[string]string{"Idempotency-Key": "custom"}, "token")
+	do(nil, "")
+	r.Equal([]string{"token", "custom", ""}, keys)
+}
+
 func runMockServer(shutdown chan struct{}) {
 	http.HandleFunc("/timeout", func(w http.ResponseWriter, req *http.Request) {
 		time.Sleep(time.Second * 2)
@@ -0,0 +1,192 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+)
+
+// DriftReturnVars .
+type DriftReturnVars struct {
+	Drifted bool `json:"drifted"`
+	// Missing is true if the resource is not found in the cluster
+	Missing bool `json:"missing"`
+	// Fields are the paths of the desired fields that differ from the live resource
+	Fields []string `json:"fields"`
+}
+
+// DriftReturns .
+type DriftReturns = providertypes.Returns[DriftReturnVars]
+
+// Drift compares the desired resource with the live resource in the cluster. Only the fields set in the desired
+// resource are compared, so the fields defaulted by the cluster and the status are not drift.
+func Drift(ctx context.Context, params *ResourceParams) (*DriftReturns, error) {
+	desired := params.Params.Resource
+	if desired == nil {
+		return nil, fmt.Errorf("the desired resource can not be empty")
+	}
+	key := client.ObjectKeyFromObject(desired)
+	if key.Namespace == "" {
+		key.Namespace = "default"
+	}
+	readCtx := handleContext(ctx, params.GetCluster(params.Params.Cluster))
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(desired.GroupVersionKind())
+	if params.PermissionCheck {
+		live.SetName(key.Name)
+		live.SetNamespace(key.Namespace)
+		if err := checkPermissions(readCtx, params.KubeClient, params.RuntimeParams, params.GetCluster(params.Params.Cluster), readVerbs, live); err != nil {
+			return nil, err
+		}
+	}
+	if err := params.KubeClient.Get(readCtx, key, live); err != nil {
+		if errors.IsNotFound(err) {
+			return &DriftReturns{Returns: DriftReturnVars{Drifted: true, Missing: true, Fields: []string{}}}, nil
+		}
+		return nil, err
+	}
+	fields := detectDrift(desired.Object, live.Object)
+	return &DriftReturns{Returns: DriftReturnVars{Drifted: len(fields) > 0, Fields: fields}}, nil
+}
+
+// detectDrift returns the sorted paths of the fields in the desired object that differ from the live object
+func detectDrift(desired, live map[string]interface{}) []string {
+	fields := []string{}
+	var compare func(path string, d, l interface{})
+	compare = func(path string, d, l interface{}) {
+		switch dv := d.(type) {
+		case map[string]interface{}:
+			lv, ok := l.(map[string]interface{})
+			if !ok {
+				fields = append(fields, path)
+				return
+			}
+			for _, k := range sortedKeys(dv) {
+				compare(path+"."+k, dv[k], lv[k])
+			}
+		case []interface{}:
+			lv, ok := l.([]interface{})
+			if !ok {
+				fields = append(fields, path)
+				return
+			}
+			// only the desired elements are compared, the elements added to the live list by the cluster, e.g. the
+			// injected sidecars, are not drift
+			for i := range dv {
+				item, found := matchListItem(dv[i], i, lv)
+				if !found {
+					fields = append(fields, fmt.Sprintf("%s[%d]", path, i))
+					continue
+				}
+				compare(fmt.Sprintf("%s[%d]", path, i), dv[i], item)
+			}
+		default:
+			if !equalScalar(d, l) {
+				fields = append(fields, path)
+			}
+		}
+	}
+	for _, k := range sortedKeys(desired) {
+		switch k {
+		case "apiVersion", "kind", "status":
+		case "metadata":
+			// only the labels and annotations are owned by the desired resource in the metadata
+			dm, _ := desired[k].(map[string]interface{})
+			lm, _ := live[k].(map[string]interface{})
+			for _, f := range []string{"labels", "annotations"} {
+				if v, ok := dm[f]; ok {
+					compare("metadata."+f, v, lm[f])
+				}
+			}
+		default:
+			compare(k, desired[k], live[k])
+		}
+	}
+	return fields
+}
+
+// matchListItem returns the live element of the desired element at index i, the elements with a name, e.g. the
+// containers, the volumes and the envs, are matched by their names since the cluster may insert elements before
+// them, the others are matched by the index
+func matchListItem(desired interface{}, i int, live []interface{}) (interface{}, bool) {
+	if name, ok := listItemName(desired); ok {
+		for _, item := range live {
+			if n, ok := listItemName(item); ok && n == name {
+				return item, true
+			}
+		}
+		return nil, false
+	}
+	if i >= len(live) {
+		return nil, false
+	}
+	return live[i], true
+}
+
+func listItemName(item interface{}) (string, bool) {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := m["name"].(string)
+	return name, ok
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// equalScalar compares the scalar values, the numbers are compared by their values as the decoded numbers can be
+// either integers or floats
+func equalScalar(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
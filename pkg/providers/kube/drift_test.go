@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectDriftOfLists(t *testing.T) {
+	container := func(name, image string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "image": image}
+	}
+	spec := func(containers ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"spec": map[string]interface{}{"containers": containers}}
+	}
+	testCases := map[string]struct {
+		desired map[string]interface{}
+		live    map[string]interface{}
+		fields  []string
+	}{
+		"injected sidecar": {
+			desired: spec(container("app", "nginx")),
+			live:    spec(container("istio-proxy", "proxy"), map[string]interface{}{"name": "app", "image": "nginx", "imagePullPolicy": "Always"}),
+			fields:  []string{},
+		},
+		"changed element": {
+			desired: spec(container("app", "nginx")),
+			live:    spec(container("istio-proxy", "proxy"), container("app", "busybox")),
+			fields:  []string{"spec.containers[0].image"},
+		},
+		"missing element": {
+			desired: spec(container("app", "nginx"), container("sidecar", "envoy")),
+			live:    spec(container("app", "nginx")),
+			fields:  []string{"spec.containers[1]"},
+		},
+		"appended scalar": {
+			desired: map[string]interface{}{"metadata": map[string]interface{}{}, "spec": map[string]interface{}{"args": []interface{}{"a", "b"}}},
+			live:    map[string]interface{}{"spec": map[string]interface{}{"args": []interface{}{"a", "b", "c"}}},
+			fields:  []string{},
+		},
+		"changed scalar": {
+			desired: map[string]interface{}{"spec": map[string]interface{}{"args": []interface{}{"a", "b"}}},
+			live:    map[string]interface{}{"spec": map[string]interface{}{"args": []interface{}{"a"}}},
+			fields:  []string{"spec.args[1]"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.fields, detectDrift(tc.desired, tc.live))
+		})
+	}
+}
@@ -11,6 +11,12 @@
 		value: {...}
 		// +usage=The patcher that will be applied to the resource, you can define the strategy of list merge through comments. Reference doc here: https://kubevela.io/docs/platform-engineers/traits/patch-trait#patch-in-workflow-step
 		patch?: {...}
+		// +usage=The dry run mode, server validates and defaults the resource in the API server without persisting it, client only renders the resource
+		dryRun: *"none" | "server" | "client"
+		// +usage=Wait until the resource is healthy after it's applied, the step keeps running until then
+		waitHealthy: *false | bool
+		// +usage=The CUE expression to check the health of the resource with its fields, e.g. `status.readyReplicas == spec.replicas`, the built-in health checks of the kind are used if it's not set
+		healthCheck?: string
 	}
 
 	$returns?: {
@@ -80,6 +86,48 @@
 	...
 }
 
+#Drift: {
+	#do:       "drift"
+	#provider: "kube"
+
+	$params: {
+		// +usage=The cluster to use
+		cluster: *"" | string
+		// +usage=The desired resource to compare with the live resource in the cluster, only the fields set in it are compared
+		value: {...}
+	}
+
+	$returns?: {
+		// +usage=Whether the live resource is drifted from the desired resource
+		drifted: bool
+		// +usage=Whether the resource is not found in the cluster
+		missing: bool
+		// +usage=The paths of the desired fields that differ from the live resource
+		fields: [...string]
+	}
+	...
+}
+
+#WaitFor: {
+	#do:       "wait-for"
+	#provider: "kube"
+
+	$params: {
+		// +usage=The cluster to use
+		cluster: *"" | string
+		// +usage=The resource to wait for, only its apiVersion, kind, name and namespace are used
+		value: {...}
+		// +usage=The CUE expression evaluated with the fields of the resource, e.g. `status.phase == "Ready"`, the built-in health checks of the kind are used if it's empty
+		condition: *"" | string
+	}
+
+	$returns?: {
+		// +usage=The resource that meets the condition will be filled in this field after the action is executed
+		value?: {...}
+	}
+	...
+}
+
 #List: {
 	#do:       "list"
 	#provider: "kube"
@@ -28,6 +28,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -40,7 +41,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/cue/process"
+	wferrors "github.com/kubevela/workflow/pkg/errors"
+	"github.com/kubevela/workflow/pkg/objectwatch"
 	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
 )
 
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
@@ -144,6 +150,45 @@ var _ = Describe("Test Workflow Provider Kube", func() {
 		}))
 	})
 
+	It("drift", func() {
+		ctx := context.Background()
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "drift", Namespace: "default", Labels: map[string]string{"app": "drift"}},
+			Data:       map[string]string{"key": "changed", "extra": "kept"},
+		}
+		Expect(k8sClient.Create(ctx, cm)).Should(Succeed())
+		desired := func(name string, data map[string]interface{}) *unstructured.Unstructured {
+			return &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]interface{}{
+					"name":   name,
+					"labels": map[string]interface{}{"app": "drift"},
+				},
+				"data": data,
+			}}
+		}
+		drift := func(un *unstructured.Unstructured) DriftReturnVars {
+			res, err := Drift(ctx, &ResourceParams{
+				Params:        ResourceVars{Resource: un},
+				RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			return res.Returns
+		}
+
+		Expect(drift(desired("drift", map[string]interface{}{"key": "changed"}))).Should(Equal(DriftReturnVars{Fields: []string{}}))
+		Expect(drift(desired("drift", map[string]interface{}{"key": "value", "new": "value"}))).Should(Equal(DriftReturnVars{
+			Drifted: true,
+			Fields:  []string{"data.key", "data.new"},
+		}))
+		Expect(drift(desired("not-found", map[string]interface{}{"key": "value"}))).Should(Equal(DriftReturnVars{
+			Drifted: true,
+			Missing: true,
+			Fields:  []string{},
+		}))
+	})
+
 	It("patch & apply", func() {
 		ctx := context.Background()
 
@@ -407,6 +452,233 @@ $params: {
 		}, time.Second*2, time.Millisecond*300).Should(BeNil())
 	})
 
+	It("apply with the default cluster of step", func() {
+		var clusters []string
+		handlers := &providertypes.KubeHandlers{
+			Apply: func(_ context.Context, _ client.Client, cluster, _ string, _ ...*unstructured.Unstructured) error {
+				clusters = append(clusters, cluster)
+				return nil
+			},
+		}
+		ctx := providertypes.WithCluster(providertypes.WithKubeClient(context.Background(), k8sClient), "cluster-a")
+		runtimeParams := providertypes.RuntimeParamsFrom(ctx)
+		runtimeParams.KubeHandlers = handlers
+		_, err := Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: testUnstructured.DeepCopy()},
+			RuntimeParams: runtimeParams,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: testUnstructured.DeepCopy(), Cluster: "cluster-b"},
+			RuntimeParams: runtimeParams,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clusters).Should(Equal([]string{"cluster-a", "cluster-b"}))
+	})
+
+	It("apply with dry run", func() {
+		ctx := context.Background()
+		By("server dry run defaults the resource without persisting it")
+		un := testUnstructured.DeepCopy()
+		un.SetName("dry-run")
+		res, err := Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: un, DryRun: providertypes.DryRunServer},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		restartPolicy, _, _ := unstructured.NestedString(res.Returns.Resource.Object, "spec", "restartPolicy")
+		Expect(restartPolicy).Should(Equal("Always"))
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "dry-run"}, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).Should(BeTrue())
+
+		By("server dry run fails with the validation error")
+		un = testUnstructured.DeepCopy()
+		un.SetName("dry-run")
+		Expect(unstructured.SetNestedSlice(un.Object, []interface{}{}, "spec", "containers")).Should(Succeed())
+		_, err = Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: un, DryRun: providertypes.DryRunServer},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient},
+		})
+		Expect(err).Should(HaveOccurred())
+		Expect(providertypes.ReasonOf(err)).Should(Equal(types.StatusReasonDryRun))
+		Expect(err.Error()).Should(ContainSubstring("spec.containers: Required value"))
+
+		By("client dry run only renders the resource")
+		un = testUnstructured.DeepCopy()
+		un.SetName("dry-run")
+		res, err = Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: un, DryRun: providertypes.DryRunClient},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Returns.Resource.GetNamespace()).Should(Equal("default"))
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "dry-run"}, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).Should(BeTrue())
+
+		By("invalid dry run mode")
+		_, err = Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: testUnstructured.DeepCopy(), DryRun: "all"},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient},
+		})
+		Expect(err).Should(HaveOccurred())
+		Expect(providertypes.ReasonOf(err)).Should(Equal(types.StatusReasonParameter))
+	})
+
+	It("apply and wait healthy", func() {
+		ctx := context.Background()
+		By("the pod is not running in envtest, so the step waits")
+		act := &mockAction{}
+		un := testUnstructured.DeepCopy()
+		un.SetName("wait-healthy")
+		_, err := Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: un, WaitHealthy: true},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient, Action: act},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(act.wait).Should(BeTrue())
+		Expect(act.msg).Should(Equal("Waiting for Pod default/wait-healthy to be healthy: the pod is Pending"))
+
+		By("the custom health check is evaluated with the fields of the resource")
+		act = &mockAction{}
+		un = testUnstructured.DeepCopy()
+		un.SetName("wait-healthy")
+		_, err = Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: un, WaitHealthy: true, HealthCheck: `spec.containers[0].image == "nginx:1.14.2"`},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient, Action: act},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(act.wait).Should(BeFalse())
+
+		By("the dry run doesn't wait")
+		act = &mockAction{}
+		un = testUnstructured.DeepCopy()
+		un.SetName("wait-healthy-dry-run")
+		_, err = Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: un, WaitHealthy: true, DryRun: providertypes.DryRunServer},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient, Action: act},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(act.wait).Should(BeFalse())
+	})
+
+	It("wait for", func() {
+		ctx := context.Background()
+		watchClient, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme})
+		Expect(err).ToNot(HaveOccurred())
+		objectwatch.Client.Set(watchClient)
+		notified := make(chan string, 10)
+		objectwatch.DefaultManager.SetNotifier(func(namespace, name string) {
+			notified <- namespace + "/" + name
+		})
+		defer objectwatch.DefaultManager.SetNotifier(nil)
+		wait := func(act *mockAction) (*ResourceReturns, error) {
+			cm := &unstructured.Unstructured{}
+			cm.SetAPIVersion("v1")
+			cm.SetKind("ConfigMap")
+			cm.SetName("wait-for")
+			return WaitFor(ctx, &WaitForParams{
+				Params: WaitForVars{Resource: cm, Condition: `data.ready == "true"`},
+				RuntimeParams: providertypes.RuntimeParams{
+					KubeClient:     k8sClient,
+					Action:         act,
+					ProcessContext: process.NewContext(process.ContextData{Namespace: "default", Name: "wait-for-run"}),
+				},
+			})
+		}
+
+		By("the step waits for the resource to be created")
+		act := &mockAction{}
+		_, err = wait(act)
+		Expect(err).Should(Equal(wferrors.GenericActionError(wferrors.ActionWait)))
+		Expect(act.msg).Should(Equal("Waiting for ConfigMap default/wait-for to be created"))
+
+		By("the step waits for the condition once the resource is created")
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "wait-for", Namespace: "default"},
+			Data:       map[string]string{"ready": "false"},
+		}
+		Expect(k8sClient.Create(ctx, cm)).Should(Succeed())
+		Eventually(func() string {
+			act = &mockAction{}
+			_, _ = wait(act)
+			return act.msg
+		}, 10*time.Second, 100*time.Millisecond).Should(HavePrefix("Waiting for ConfigMap default/wait-for: "))
+
+		By("the run is notified once the condition flips")
+		cm.Data["ready"] = "true"
+		Expect(k8sClient.Update(ctx, cm)).Should(Succeed())
+		Eventually(notified, 10*time.Second).Should(Receive(Equal("default/wait-for-run")))
+		act = &mockAction{}
+		ret, err := wait(act)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(act.wait).Should(BeFalse())
+		Expect(ret.Returns.Resource.Object["data"]).Should(Equal(map[string]interface{}{"ready": "true"}))
+	})
+
+	It("check permissions", func() {
+		ctx := context.Background()
+		Expect(k8sClient.Create(ctx, &rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-reader", Namespace: "default"},
+			Rules: []rbacv1.PolicyRule{{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get"},
+			}},
+		})).Should(Succeed())
+		Expect(k8sClient.Create(ctx, &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-reader", Namespace: "default"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "pod-reader"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "pod-reader"}},
+		})).Should(Succeed())
+		user, err := testEnv.AddUser(envtest.User{Name: "pod-reader"}, cfg)
+		Expect(err).ToNot(HaveOccurred())
+		cli, err := client.New(user.Config(), client.Options{Scheme: scheme})
+		Expect(err).ToNot(HaveOccurred())
+
+		un := testUnstructured.DeepCopy()
+		un.SetName("app-permission")
+		_, err = Apply(ctx, &ResourceParams{
+			Params: ResourceVars{
+				Resource: un,
+			},
+			RuntimeParams: providertypes.RuntimeParams{
+				KubeClient:      cli,
+				PermissionCheck: true,
+			},
+		})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(Equal("missing permissions: create pods app-permission in namespace default, patch pods app-permission in namespace default"))
+
+		res, err := Read(ctx, &ResourceParams{
+			Params: ResourceVars{
+				Resource: un.DeepCopy(),
+			},
+			RuntimeParams: providertypes.RuntimeParams{
+				KubeClient:      cli,
+				PermissionCheck: true,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Returns.Error).Should(ContainSubstring("not found"))
+
+		cm := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "app-permission", "namespace": "default"},
+		}}
+		_, err = Read(ctx, &ResourceParams{
+			Params: ResourceVars{
+				Resource: cm,
+			},
+			RuntimeParams: providertypes.RuntimeParams{
+				KubeClient:      cli,
+				PermissionCheck: true,
+			},
+		})
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).Should(Equal("missing permissions: get configmaps app-permission in namespace default"))
+	})
+
 	It("test error case", func() {
 		ctx := context.Background()
 		res, err := Read(ctx, &ResourceParams{
@@ -453,3 +725,27 @@ var (
 		},
 	}
 )
+
+type mockAction struct {
+	wait bool
+	msg  string
+}
+
+func (act *mockAction) Suspend(string) {}
+
+func (act *mockAction) Resume(string) {}
+
+func (act *mockAction) Terminate(string) {}
+
+func (act *mockAction) Wait(msg string) {
+	act.wait = true
+	act.msg = msg
+}
+
+func (act *mockAction) Fail(string) {}
+
+func (act *mockAction) Message(string) {}
+
+func (act *mockAction) GetStatus() v1alpha1.StepStatus {
+	return v1alpha1.StepStatus{}
+}
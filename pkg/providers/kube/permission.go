@@ -0,0 +1,195 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/pkg/cue/util"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+var (
+	// applyVerbs are the verbs required to apply resources, the resource is created if it's not found, otherwise patched
+	applyVerbs = []string{"get", "create", "patch"}
+	// patchVerbs are the verbs required to patch resources
+	patchVerbs = []string{"get", "patch"}
+	// readVerbs are the verbs required to read resources
+	readVerbs = []string{"get"}
+	// providerVerbs are the verbs required by the providers that check the permissions
+	providerVerbs = map[string][]string{
+		"apply":             applyVerbs,
+		"apply-in-parallel": applyVerbs,
+		"patch":             patchVerbs,
+		"read":              readVerbs,
+		"wait-for":          readVerbs,
+		"drift":             readVerbs,
+	}
+)
+
+// CheckTemplatePermissions checks whether the controller is allowed to access the resources of the kube providers in
+// the templates of the steps rendered before the steps run, returns all the missing permissions. The resources that
+// are not concrete until the steps run, e.g. rendered from the outputs of the other steps, or in the other clusters
+// are checked by the providers when they're accessed.
+func CheckTemplatePermissions(ctx context.Context, cli client.Client, wfCtx wfContext.Context, templates ...cue.Value) ([]string, error) {
+	var missing []string
+	for _, templ := range templates {
+		var err error
+		util.Iterate(templ, func(call cue.Value) bool {
+			if provider, _ := call.LookupPath(cue.ParsePath("#provider")).String(); provider != "kube" {
+				return false
+			}
+			fn, _ := call.LookupPath(cue.ParsePath("#do")).String()
+			verbs, ok := providerVerbs[fn]
+			if !ok {
+				return false
+			}
+			objs := renderedResources(call.LookupPath(cue.ParsePath("$params")), fn == "apply-in-parallel")
+			var perms []string
+			if perms, err = missingPermissions(ctx, cli, wfCtx, "", verbs, objs...); err != nil {
+				return true
+			}
+			missing = append(missing, perms...)
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// renderedResources returns the concrete resources in the parameters of the provider call, the resources in the
+// other clusters are skipped
+func renderedResources(params cue.Value, list bool) []*unstructured.Unstructured {
+	if cluster, _ := params.LookupPath(cue.ParsePath("cluster")).String(); cluster != "" {
+		return nil
+	}
+	v := params.LookupPath(cue.ParsePath("value"))
+	if !v.Exists() || v.Validate(cue.Concrete(true)) != nil {
+		return nil
+	}
+	var objs []*unstructured.Unstructured
+	if list {
+		var items []map[string]interface{}
+		if err := v.Decode(&items); err != nil {
+			return nil
+		}
+		for _, item := range items {
+			objs = append(objs, &unstructured.Unstructured{Object: item})
+		}
+	} else {
+		obj := &unstructured.Unstructured{}
+		if err := v.Decode(&obj.Object); err != nil {
+			return nil
+		}
+		objs = append(objs, obj)
+	}
+	for _, obj := range objs {
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			return nil
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace("default")
+		}
+	}
+	return objs
+}
+
+// checkPermissions checks whether the controller is allowed to perform the verbs on the resources by SelfSubjectAccessReview,
+// returns the error that lists all the missing permissions
+func checkPermissions(ctx context.Context, cli client.Client, params providertypes.RuntimeParams, cluster string, verbs []string, objs ...*unstructured.Unstructured) error {
+	// the permissions of the impersonated service account and the other clusters are reviewed separately
+	reviewer := strings.Join([]string{cluster, params.ServiceAccount}, "/")
+	if reviewer == "/" {
+		reviewer = ""
+	}
+	missing, err := missingPermissions(ctx, cli, params.WorkflowContext, reviewer, verbs, objs...)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing permissions: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// missingPermissions returns the permissions to perform the verbs on the resources that are not allowed. The allowed
+// permissions are cached in the memory store of the workflow context, so that they're reviewed once per run, while
+// the missing permissions are reviewed again in case they're granted.
+func missingPermissions(ctx context.Context, cli client.Client, wfCtx wfContext.Context, reviewer string, verbs []string, objs ...*unstructured.Unstructured) ([]string, error) {
+	var missing []string
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		mapping, err := cli.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to get the resource of %s", gvk.String())
+		}
+		namespace := ""
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			namespace = obj.GetNamespace()
+		}
+		for _, verb := range verbs {
+			attributes := &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     mapping.Resource.Group,
+				Resource:  mapping.Resource.Resource,
+			}
+			// the name of the resource is unknown to the authorizer when creating it
+			if verb != "create" {
+				attributes.Name = obj.GetName()
+			}
+			key := strings.Join([]string{reviewer, attributes.Verb, attributes.Group, attributes.Resource, attributes.Namespace, attributes.Name}, "/")
+			if wfCtx != nil {
+				if allowed, ok := wfCtx.GetValueInMemory(types.ContextPrefixPermissionReviews, key); ok && allowed == true {
+					continue
+				}
+			}
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attributes},
+			}
+			if err := cli.Create(ctx, review); err != nil {
+				return nil, errors.WithMessage(err, "failed to review the permissions")
+			}
+			if review.Status.Allowed {
+				if wfCtx != nil {
+					wfCtx.SetValueInMemory(true, types.ContextPrefixPermissionReviews, key)
+				}
+				continue
+			}
+			permission := fmt.Sprintf("%s %s %s", verb, mapping.Resource.GroupResource().String(), obj.GetName())
+			if namespace != "" {
+				permission += " in namespace " + namespace
+			}
+			missing = append(missing, permission)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+)
+
+// reviewClient allows the controller to get the resources only
+type reviewClient struct {
+	client.Client
+	reviews int
+}
+
+func (c *reviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if review, ok := obj.(*authorizationv1.SelfSubjectAccessReview); ok {
+		c.reviews++
+		review.Status.Allowed = review.Spec.ResourceAttributes.Verb == "get"
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestCheckTemplatePermissions(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, kind := range []string{"ConfigMap", "Secret", "Pod"} {
+		mapper.Add(corev1.SchemeGroupVersion.WithKind(kind), meta.RESTScopeNamespace)
+	}
+	cli := &reviewClient{Client: fake.NewClientBuilder().WithRESTMapper(mapper).Build()}
+	singleton.KubeClient.Set(cli)
+	wfCtx, err := wfContext.NewContext(ctx, "default", "test-permissions", nil)
+	r.NoError(err)
+
+	templ := cuecontext.New().CompileString(`
+parameter: image: string
+apply: {
+	#provider: "kube"
+	#do:       "apply"
+	$params: value: {
+		apiVersion: "v1"
+		kind:       "ConfigMap"
+		metadata: name: "config"
+	}
+}
+read: {
+	#provider: "kube"
+	#do:       "read"
+	$params: value: {
+		apiVersion: "v1"
+		kind:       "Secret"
+		metadata: {name: "secret", namespace: "prod"}
+	}
+}
+deploy: {
+	#provider: "kube"
+	#do:       "apply"
+	$params: value: {
+		apiVersion: "v1"
+		kind:       "Pod"
+		metadata: name: "app"
+		spec: containers: [{name: "app", image: parameter.image}]
+	}
+}
+remote: {
+	#provider: "kube"
+	#do:       "apply"
+	$params: {
+		cluster: "remote"
+		value: {
+			apiVersion: "v1"
+			kind:       "ConfigMap"
+			metadata: name: "remote"
+		}
+	}
+}
+`)
+	r.NoError(templ.Err())
+	missing, err := CheckTemplatePermissions(ctx, cli, wfCtx, templ)
+	r.NoError(err)
+	// the resource that is not concrete and the resource in the other cluster are checked when they're accessed
+	r.Equal([]string{
+		"create configmaps config in namespace default",
+		"patch configmaps config in namespace default",
+	}, missing)
+	r.Equal(4, cli.reviews)
+
+	// the allowed permissions are reviewed once per run, the missing ones are reviewed again
+	missing, err = CheckTemplatePermissions(ctx, cli, wfCtx, templ)
+	r.NoError(err)
+	r.Len(missing, 2)
+	r.Equal(6, cli.reviews)
+
+	// the providers don't review the permissions checked ahead again
+	secret := &unstructured.Unstructured{}
+	secret.SetAPIVersion("v1")
+	secret.SetKind("Secret")
+	secret.SetName("secret")
+	secret.SetNamespace("prod")
+	r.NoError(checkPermissions(ctx, cli, providertypes.RuntimeParams{WorkflowContext: wfCtx}, "", readVerbs, secret))
+	r.Equal(6, cli.reviews)
+	err = checkPermissions(ctx, cli, providertypes.RuntimeParams{WorkflowContext: wfCtx}, "", patchVerbs, secret)
+	r.EqualError(err, "missing permissions: patch secrets secret in namespace prod")
+	r.Equal(7, cli.reviews)
+}
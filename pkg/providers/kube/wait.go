@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubevela/pkg/multicluster"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/errors"
+	"github.com/kubevela/workflow/pkg/objectwatch"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// WaitForVars .
+type WaitForVars struct {
+	Resource *unstructured.Unstructured `json:"value"`
+	Cluster  string                     `json:"cluster,omitempty"`
+	// Condition is the CUE expression evaluated with the fields of the resource, e.g. `status.phase == "Ready"`,
+	// the built-in health checks of the kind are used if it's empty
+	Condition string `json:"condition,omitempty"`
+}
+
+// WaitForParams .
+type WaitForParams = providertypes.Params[WaitForVars]
+
+// WaitFor lets the step wait until the resource meets the condition, and fails the step if the resource is failed.
+// The resource in the local cluster is watched instead of being read every time the step is executed, and the run
+// is reconciled once the condition flips. The resource is read from the cluster while the watch is not synced.
+func WaitFor(ctx context.Context, params *WaitForParams) (*ResourceReturns, error) {
+	workload := params.Params.Resource
+	if workload == nil {
+		return nil, providertypes.NewProviderError(types.StatusReasonParameter, fmt.Errorf("the resource to wait for can not be empty"))
+	}
+	if workload.GetNamespace() == "" {
+		workload.SetNamespace("default")
+	}
+	cluster := params.GetCluster(params.Params.Cluster)
+	readCtx := handleContext(ctx, cluster)
+	if params.PermissionCheck {
+		if err := checkPermissions(readCtx, params.KubeClient, params.RuntimeParams, cluster, readVerbs, workload); err != nil {
+			return nil, err
+		}
+	}
+	condition := params.Params.Condition
+	key := objectwatch.Key{APIVersion: workload.GetAPIVersion(), Kind: workload.GetKind(), Namespace: workload.GetNamespace(), Name: workload.GetName()}
+	sub, watchable := watchSubscriber(ctx, params.RuntimeParams, cluster, condition)
+	live, watched := (*unstructured.Unstructured)(nil), false
+	if watchable {
+		// the failed resource flips the condition as well, so that the step fails without waiting for the poll
+		live, watched = objectwatch.DefaultManager.Subscribe(key, sub, func(obj *unstructured.Unstructured) bool {
+			if obj == nil {
+				return false
+			}
+			status, err := providertypes.CheckHealth(obj, condition)
+			return err == nil && (status.Healthy || status.Failed)
+		})
+	}
+	if !watched {
+		live = &unstructured.Unstructured{}
+		live.SetGroupVersionKind(workload.GroupVersionKind())
+		if err := params.KubeClient.Get(readCtx, client.ObjectKeyFromObject(workload), live); err != nil {
+			if !kerrors.IsNotFound(err) {
+				return nil, err
+			}
+			live = nil
+		}
+	}
+	target := fmt.Sprintf("%s %s/%s", workload.GetKind(), workload.GetNamespace(), workload.GetName())
+	if live == nil {
+		params.Action.Wait(fmt.Sprintf("Waiting for %s to be created", target))
+		return nil, errors.GenericActionError(errors.ActionWait)
+	}
+	status, err := providertypes.CheckHealth(live, condition)
+	if err != nil {
+		return nil, providertypes.NewProviderError(types.StatusReasonParameter, err)
+	}
+	if !status.Healthy && !status.Failed {
+		params.Action.Wait(fmt.Sprintf("Waiting for %s: %s", target, status.Message))
+		return nil, errors.GenericActionError(errors.ActionWait)
+	}
+	if watchable {
+		objectwatch.DefaultManager.Unsubscribe(key, sub)
+	}
+	if status.Failed {
+		params.Action.Fail(fmt.Sprintf("%s is failed: %s", target, status.Message))
+		return nil, errors.GenericActionError(errors.ActionTerminate)
+	}
+	return &ResourceReturns{Returns: ResourceReturnVars{Resource: live}}, nil
+}
+
+// watchSubscriber returns the subscriber of the run to watch the resource. The resource is watched by the
+// controller, so it's only watched in the local cluster and if the step doesn't impersonate a service account.
+func watchSubscriber(ctx context.Context, params providertypes.RuntimeParams, cluster, condition string) (objectwatch.Subscriber, bool) {
+	if !multicluster.IsLocal(cluster) || ctx.Value(providertypes.KubeClientKey) != nil || params.ProcessContext == nil {
+		return objectwatch.Subscriber{}, false
+	}
+	namespace, _ := params.ProcessContext.GetData(model.ContextNamespace).(string)
+	name, _ := params.ProcessContext.GetData(model.ContextName).(string)
+	if namespace == "" || name == "" {
+		return objectwatch.Subscriber{}, false
+	}
+	return objectwatch.Subscriber{Namespace: namespace, Name: name, Condition: condition}, true
+}
@@ -42,6 +42,8 @@ import (
 const (
 	// ProviderName is provider name for install.
 	ProviderName = "http"
+	// idempotencyKeyHeader is the header of the idempotency token of the step execution
+	idempotencyKeyHeader = "Idempotency-Key"
 )
 
 var (
@@ -134,8 +136,12 @@ func runHTTP(ctx context.Context, params *DoParams) (*ResponseVars, error) {
 		header = map[string][]string{}
 		header.Set("Content-Type", "application/json")
 	}
+	// the retries of the step execution are sent with the same key, so that they're not applied twice
+	if params.IdempotencyToken != "" && header.Get(idempotencyKeyHeader) == "" {
+		header.Set(idempotencyKeyHeader, params.IdempotencyToken)
+	}
 
-	req, err := http.NewRequestWithContext(context.Background(), method, url, reader)
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
 		return nil, err
 	}
@@ -10,6 +10,12 @@
 	value: {...}
 	// +usage=The patcher that will be applied to the resource, you can define the strategy of list merge through comments. Reference doc here: https://kubevela.io/docs/platform-engineers/traits/patch-trait#patch-in-workflow-step
 	patch?: {...}
+	// +usage=The dry run mode, server validates and defaults the resource in the API server without persisting it, client only renders the resource
+	dryRun: *"none" | "server" | "client"
+	// +usage=Wait until the resource is healthy after it's applied, the step keeps running until then
+	waitHealthy: *false | bool
+	// +usage=The CUE expression to check the health of the resource with its fields, e.g. `status.readyReplicas == spec.replicas`, the built-in health checks of the kind are used if it's not set
+	healthCheck?: string
 	...
 }
 
@@ -19,7 +19,6 @@ package kube
 import (
 	"context"
 	_ "embed"
-	"encoding/json"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
@@ -110,6 +109,13 @@ type ResourceVars struct {
 	Resource *unstructured.Unstructured `json:"value"`
 	Filter   *ListFilter                `json:"filter,omitempty"`
 	Cluster  string                     `json:"cluster,omitempty"`
+	// DryRun is the dry run mode of apply, one of server, client and none
+	DryRun string `json:"dryRun,omitempty"`
+	// WaitHealthy makes the apply step wait until the applied resource is healthy
+	WaitHealthy bool `json:"waitHealthy,omitempty"`
+	// HealthCheck is the CUE expression to check the health of the applied resource, the built-in health checks
+	// of the kind are used if it's empty
+	HealthCheck string `json:"healthCheck,omitempty"`
 }
 
 // ResourceReturns .
@@ -143,10 +149,26 @@ func Apply(ctx context.Context, params *ResourceParams) (*ResourceReturns, error
 			return nil, err
 		}
 	}
-	deployCtx := handleContext(ctx, params.Params.Cluster)
-	if err := handlers.Apply(deployCtx, params.KubeClient, params.Params.Cluster, WorkflowResourceCreator, workload); err != nil {
+	cluster := params.GetCluster(params.Params.Cluster)
+	deployCtx := handleContext(ctx, cluster)
+	if params.Params.DryRun == "" || params.Params.DryRun == providertypes.DryRunNone {
+		if err := providertypes.CaptureRollbackState(deployCtx, params.RuntimeParams, cluster, workload); err != nil {
+			return nil, err
+		}
+	}
+	if err := providertypes.ApplyWithDryRun(deployCtx, handlers.Apply, params.KubeClient, params.Params.DryRun, cluster, WorkflowResourceCreator, workload); err != nil {
 		return nil, err
 	}
+	if params.Params.DryRun == "" || params.Params.DryRun == providertypes.DryRunNone {
+		if err := providertypes.RecordInventory(params.RuntimeParams, cluster, workload); err != nil {
+			return nil, err
+		}
+		if params.Params.WaitHealthy {
+			if err := providertypes.WaitHealthy(params.Action, workload, params.Params.HealthCheck); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return &ResourceReturns{
 		Resource: workload,
 	}, nil
@@ -175,8 +197,15 @@ func ApplyInParallel(ctx context.Context, params *ApplyInParallelParams) (*Apply
 			workloads[i].SetNamespace("default")
 		}
 	}
-	deployCtx := handleContext(ctx, params.Params.Cluster)
-	if err := handlers.Apply(deployCtx, params.KubeClient, params.Params.Cluster, WorkflowResourceCreator, workloads...); err != nil {
+	cluster := params.GetCluster(params.Params.Cluster)
+	deployCtx := handleContext(ctx, cluster)
+	if err := providertypes.CaptureRollbackState(deployCtx, params.RuntimeParams, cluster, workloads...); err != nil {
+		return nil, err
+	}
+	if err := handlers.Apply(deployCtx, params.KubeClient, cluster, WorkflowResourceCreator, workloads...); err != nil {
+		return nil, err
+	}
+	if err := providertypes.RecordInventory(params.RuntimeParams, cluster, workloads...); err != nil {
 		return nil, err
 	}
 	return &ApplyInParallelReturns{
@@ -189,11 +218,7 @@ func Patch(ctx context.Context, params *providertypes.LegacyParams[cue.Value]) (
 	handlers := getHandlers(params.RuntimeParams)
 	val := params.Params.LookupPath(cue.ParsePath("value"))
 	obj := new(unstructured.Unstructured)
-	b, err := val.MarshalJSON()
-	if err != nil {
-		return cue.Value{}, err
-	}
-	if err := json.Unmarshal(b, obj); err != nil {
+	if err := providertypes.DecodeProperties(val, obj); err != nil {
 		return cue.Value{}, err
 	}
 	key := client.ObjectKeyFromObject(obj)
@@ -204,6 +229,7 @@ func Patch(ctx context.Context, params *providertypes.LegacyParams[cue.Value]) (
 	if err != nil {
 		return cue.Value{}, err
 	}
+	cluster = params.GetCluster(cluster)
 	multiCtx := handleContext(ctx, cluster)
 	if err := params.KubeClient.Get(multiCtx, key, obj); err != nil {
 		return cue.Value{}, err
@@ -227,6 +253,9 @@ func Patch(ctx context.Context, params *providertypes.LegacyParams[cue.Value]) (
 			return cue.Value{}, err
 		}
 	}
+	if err := providertypes.CaptureRollbackState(multiCtx, params.RuntimeParams, cluster, workload); err != nil {
+		return cue.Value{}, err
+	}
 	if err := handlers.Apply(multiCtx, params.KubeClient, cluster, WorkflowResourceCreator, workload); err != nil {
 		return cue.Value{}, err
 	}
@@ -240,7 +269,7 @@ func Read(ctx context.Context, params *ResourceParams) (*ResourceReturns, error)
 	if key.Namespace == "" {
 		key.Namespace = "default"
 	}
-	readCtx := handleContext(ctx, params.Params.Cluster)
+	readCtx := handleContext(ctx, params.GetCluster(params.Params.Cluster))
 	if err := params.KubeClient.Get(readCtx, key, workload); err != nil {
 		return &ResourceReturns{
 			Resource: workload,
@@ -271,7 +300,7 @@ func List(ctx context.Context, params *ResourceParams) (*ListReturns, error) {
 		client.InNamespace(filter.Namespace),
 		client.MatchingLabels(filter.MatchingLabels),
 	}
-	readCtx := handleContext(ctx, params.Params.Cluster)
+	readCtx := handleContext(ctx, params.GetCluster(params.Params.Cluster))
 	if err := params.KubeClient.List(readCtx, list, listOpts...); err != nil {
 		return &ListReturns{
 			Resources: list,
@@ -287,7 +316,8 @@ func List(ctx context.Context, params *ResourceParams) (*ListReturns, error) {
 func Delete(ctx context.Context, params *ResourceParams) (*ResourceReturns, error) {
 	workload := params.Params.Resource
 	handlers := getHandlers(params.RuntimeParams)
-	deleteCtx := handleContext(ctx, params.Params.Cluster)
+	cluster := params.GetCluster(params.Params.Cluster)
+	deleteCtx := handleContext(ctx, cluster)
 
 	if filter := params.Params.Filter; filter != nil {
 		labelSelector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{MatchLabels: filter.MatchingLabels})
@@ -303,7 +333,7 @@ func Delete(ctx context.Context, params *ResourceParams) (*ResourceReturns, erro
 		return nil, nil
 	}
 
-	if err := handlers.Delete(deleteCtx, params.KubeClient, params.Params.Cluster, WorkflowResourceCreator, workload); err != nil {
+	if err := handlers.Delete(deleteCtx, params.KubeClient, cluster, WorkflowResourceCreator, workload); err != nil {
 		return &ResourceReturns{
 			Resource: workload,
 			Error:    err.Error(),
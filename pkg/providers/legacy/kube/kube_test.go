@@ -41,6 +41,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 
 	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
 )
 
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
@@ -405,6 +406,31 @@ patch: {
 		}, time.Second*2, time.Millisecond*300).Should(BeNil())
 	})
 
+	It("apply with dry run", func() {
+		ctx := context.Background()
+		un := testUnstructured.DeepCopy()
+		un.SetName("dry-run")
+		res, err := Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: un, DryRun: providertypes.DryRunServer},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		restartPolicy, _, _ := unstructured.NestedString(res.Resource.Object, "spec", "restartPolicy")
+		Expect(restartPolicy).Should(Equal("Always"))
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: "dry-run"}, &corev1.Pod{})
+		Expect(errors.IsNotFound(err)).Should(BeTrue())
+
+		un = testUnstructured.DeepCopy()
+		un.SetName("dry-run")
+		Expect(unstructured.SetNestedSlice(un.Object, []interface{}{}, "spec", "containers")).Should(Succeed())
+		_, err = Apply(ctx, &ResourceParams{
+			Params:        ResourceVars{Resource: un, DryRun: providertypes.DryRunServer},
+			RuntimeParams: providertypes.RuntimeParams{KubeClient: k8sClient},
+		})
+		Expect(err).Should(HaveOccurred())
+		Expect(providertypes.ReasonOf(err)).Should(Equal(types.StatusReasonDryRun))
+	})
+
 	It("test error case", func() {
 		ctx := context.Background()
 		res, err := Read(ctx, &ResourceParams{
@@ -157,7 +157,7 @@ func Suspend(_ context.Context, params *SuspendParams) (*any, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse timestamp %s: %w", timestamp, err)
 		}
-		if time.Now().After(t) {
+		if params.Now().After(t) {
 			act.Resume("")
 			return nil, nil
 		}
@@ -169,7 +169,7 @@ func Suspend(_ context.Context, params *SuspendParams) (*any, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse duration %s: %w", params.Params.Duration, err)
 		}
-		wfCtx.SetMutableValue(time.Now().Add(d).Format(time.RFC3339), stepID, ResumeTimeStamp)
+		wfCtx.SetMutableValue(params.Now().Add(d).Format(time.RFC3339), stepID, ResumeTimeStamp)
 	}
 	if ts := wfCtx.GetMutableValue(stepID, params.FieldLabel, SuspendTimeStamp); ts != "" {
 		if act.GetStatus().Phase == v1alpha1.WorkflowStepPhaseRunning {
@@ -177,7 +177,7 @@ func Suspend(_ context.Context, params *SuspendParams) (*any, error) {
 			return nil, nil
 		}
 	} else {
-		wfCtx.SetMutableValue(time.Now().Format(time.RFC3339), stepID, params.FieldLabel, SuspendTimeStamp)
+		wfCtx.SetMutableValue(params.Now().Format(time.RFC3339), stepID, params.FieldLabel, SuspendTimeStamp)
 	}
 	act.Suspend(msg)
 	return nil, errors.GenericActionError(errors.ActionSuspend)
@@ -19,3 +19,16 @@
 	}
 	...
 }
+
+#RecordMetric: {
+	#do:       "recordMetric"
+	#provider: "metrics"
+
+	$params: {
+		// the name of the metric registered by --step-metrics of the controller
+		name:   string
+		value:  number
+		labels: *{} | {[string]: string}
+	}
+	...
+}
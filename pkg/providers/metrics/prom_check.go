@@ -69,12 +69,12 @@ func PromCheck(ctx context.Context, params *PromParams) (*PromReturns, error) {
 	wfCtx := params.WorkflowContext
 	stepID := fmt.Sprint(pCtx.GetData(model.ContextStepSessionID))
 
-	valueStr, err := getQueryResult(ctx, params.Params)
+	valueStr, err := QueryValue(ctx, params.Params.MetricEndpoint, params.Params.Query)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := compareValueWithCondition(ctx, valueStr, params.Params)
+	res, err := MatchCondition(valueStr, params.Params.Condition)
 	if err != nil {
 		return nil, err
 	}
@@ -164,15 +164,16 @@ func handleFailCompare(wfCtx wfContext.Context, stepID, valueStr string, vars Pr
 	}, nil
 }
 
-func getQueryResult(ctx context.Context, vars PromVars) (string, error) {
+// QueryValue queries the prometheus by the query, the result must be a scalar or a vector with only one sample
+func QueryValue(ctx context.Context, endpoint, query string) (string, error) {
 	c, err := api.NewClient(api.Config{
-		Address: vars.MetricEndpoint,
+		Address: endpoint,
 	})
 	if err != nil {
 		return "", err
 	}
 	promCli := v1.NewAPI(c)
-	resp, _, err := promCli.Query(ctx, vars.Query, time.Now())
+	resp, _, err := promCli.Query(ctx, query, time.Now())
 	if err != nil {
 		return "", err
 	}
@@ -192,8 +193,9 @@ func getQueryResult(ctx context.Context, vars PromVars) (string, error) {
 	return valueStr, nil
 }
 
-func compareValueWithCondition(_ context.Context, valueStr string, vars PromVars) (bool, error) {
-	template := fmt.Sprintf("if: %s %s", valueStr, vars.Condition)
+// MatchCondition checks whether the query result meets the condition, e.g. `>= 0.95`
+func MatchCondition(valueStr, condition string) (bool, error) {
+	template := fmt.Sprintf("if: %s %s", valueStr, condition)
 	res, err := cuecontext.New().CompileString(template).LookupPath(cue.ParsePath("if")).Bool()
 	if err != nil {
 		return false, err
@@ -225,6 +227,7 @@ func GetTemplate() string {
 // GetProviders returns the metrics provider
 func GetProviders() map[string]cuexruntime.ProviderFn {
 	return map[string]cuexruntime.ProviderFn{
-		"promCheck": providertypes.GenericProviderFn[PromVars, PromReturns](PromCheck),
+		"promCheck":    providertypes.GenericProviderFn[PromVars, PromReturns](PromCheck),
+		"recordMetric": providertypes.GenericProviderFn[RecordVars, any](RecordMetric),
 	}
 }
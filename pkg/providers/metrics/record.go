@@ -0,0 +1,38 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+)
+
+// RecordVars .
+type RecordVars struct {
+	Name   string            `json:"name"`
+	Value  float64           `json:"value"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// RecordParams .
+type RecordParams = providertypes.Params[RecordVars]
+
+// RecordMetric records the value of the custom metric registered in the allowlist of the controller
+func RecordMetric(_ context.Context, params *RecordParams) (*any, error) {
+	return nil, params.RecordMetric(params.Params.Name, params.Params.Value, params.Params.Labels)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/kubevela/pkg/util/singleton"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/cue/process"
+	"github.com/kubevela/workflow/pkg/monitor/metrics"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+func TestRecordMetric(t *testing.T) {
+	r := require.New(t)
+	r.NoError(metrics.SetStepMetrics([]string{"records_processed:counter:source"}))
+	defer func() {
+		r.NoError(metrics.SetStepMetrics(nil))
+	}()
+	ctx := context.Background()
+
+	_, err := RecordMetric(ctx, &RecordParams{Params: RecordVars{Name: "records_processed", Value: 3, Labels: map[string]string{"source": "kafka"}}})
+	r.NoError(err)
+
+	// the metric is recorded once per attempt of the step
+	singleton.KubeClient.Set(fake.NewClientBuilder().Build())
+	wfCtx, err := wfContext.NewContext(ctx, "default", "record-metric", nil)
+	r.NoError(err)
+	pCtx := process.NewContext(process.ContextData{})
+	pCtx.PushData(model.ContextStepSessionID, "step")
+	record := func(token string) {
+		_, err := RecordMetric(ctx, &RecordParams{
+			Params: RecordVars{Name: "records_processed", Value: 2, Labels: map[string]string{"source": "s3"}},
+			RuntimeParams: providertypes.RuntimeParams{
+				WorkflowContext:  wfCtx,
+				ProcessContext:   pCtx,
+				FieldLabel:       "record",
+				IdempotencyToken: token,
+			},
+		})
+		r.NoError(err)
+	}
+	record("attempt-1")
+	record("attempt-1")
+	r.Equal(2.0, recordedValue(r, "records_processed", "s3"))
+	record("attempt-2")
+	r.Equal(4.0, recordedValue(r, "records_processed", "s3"))
+
+	_, err = RecordMetric(ctx, &RecordParams{Params: RecordVars{Name: "bytes_transferred", Value: 3}})
+	r.EqualError(err, "failed to record the metric: step metric bytes_transferred is not registered")
+	r.Equal(types.StatusReasonParameter, providertypes.ReasonOf(err))
+}
+
+func recordedValue(r *require.Assertions, name, source string) float64 {
+	mfs, err := ctrlmetrics.Registry.Gather()
+	r.NoError(err)
+	for _, mf := range mfs {
+		if mf.GetName() != metrics.StepMetricPrefix+name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "source" && label.GetValue() == source {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/parser"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// HealthStatus is the health status of a resource
+type HealthStatus struct {
+	// Healthy is true if the resource is ready to serve
+	Healthy bool
+	// Failed is true if the resource will never be healthy, e.g. the job is failed
+	Failed bool
+	// Message is the reason why the resource is not healthy
+	Message string
+}
+
+// WaitHealthy lets the step wait until the applied resource is healthy, and fails the step if the resource is
+// failed. The step timeout can be used to limit the waiting.
+func WaitHealthy(act types.Action, obj *unstructured.Unstructured, healthCheck string) error {
+	status, err := CheckHealth(obj, healthCheck)
+	if err != nil {
+		return NewProviderError(types.StatusReasonParameter, err)
+	}
+	if act == nil || status.Healthy {
+		return nil
+	}
+	message := fmt.Sprintf("%s %s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	if status.Failed {
+		act.Fail(fmt.Sprintf("%s is failed: %s", message, status.Message))
+		return nil
+	}
+	act.Wait(fmt.Sprintf("Waiting for %s to be healthy: %s", message, status.Message))
+	return nil
+}
+
+// CheckHealth checks the health of the resource by the CUE expression evaluated with the fields of the resource,
+// e.g. `status.readyReplicas == spec.replicas`, or by the built-in health checks of its kind if the expression is empty
+func CheckHealth(obj *unstructured.Unstructured, healthCheck string) (HealthStatus, error) {
+	if healthCheck != "" {
+		return evalHealthCheck(obj, healthCheck)
+	}
+	gk := obj.GroupVersionKind().GroupKind()
+	switch gk.Group + "/" + gk.Kind {
+	case "apps/Deployment":
+		return checkDeployment(obj), nil
+	case "apps/StatefulSet":
+		return checkStatefulSet(obj), nil
+	case "apps/DaemonSet":
+		return checkDaemonSet(obj), nil
+	case "batch/Job":
+		return checkJob(obj), nil
+	case "/Pod":
+		return checkPod(obj), nil
+	case "/PersistentVolumeClaim":
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		if phase != "Bound" {
+			return HealthStatus{Message: fmt.Sprintf("the claim is %s", orUnknown(phase))}, nil
+		}
+		return HealthStatus{Healthy: true}, nil
+	case "/Service":
+		if t, _, _ := unstructured.NestedString(obj.Object, "spec", "type"); t != "LoadBalancer" {
+			return HealthStatus{Healthy: true}, nil
+		}
+		if ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress"); len(ingress) == 0 {
+			return HealthStatus{Message: "the load balancer is not provisioned"}, nil
+		}
+		return HealthStatus{Healthy: true}, nil
+	default:
+		// the other resources are healthy if they don't report a Ready condition that is not true
+		if c := getCondition(obj, "Ready"); c != nil && c["status"] != "True" {
+			return HealthStatus{Message: fmt.Sprintf("the Ready condition is %v: %v", c["status"], c["message"])}, nil
+		}
+		return HealthStatus{Healthy: true}, nil
+	}
+}
+
+func evalHealthCheck(obj *unstructured.Unstructured, healthCheck string) (HealthStatus, error) {
+	if _, err := parser.ParseExpr("healthCheck", healthCheck); err != nil {
+		return HealthStatus{}, fmt.Errorf("invalid health check `%s`: %w", healthCheck, err)
+	}
+	b, err := obj.MarshalJSON()
+	if err != nil {
+		return HealthStatus{}, err
+	}
+	ctx := cuecontext.New()
+	scope := ctx.CompileBytes(b)
+	// the fields of the status may not be reported yet, so the failed evaluation means unhealthy
+	healthy, err := ctx.CompileString(healthCheck, cue.Scope(scope)).Bool()
+	if err != nil {
+		return HealthStatus{Message: fmt.Sprintf("health check `%s` can't be evaluated: %s", healthCheck, err.Error())}, nil
+	}
+	if !healthy {
+		return HealthStatus{Message: fmt.Sprintf("health check `%s` is false", healthCheck)}, nil
+	}
+	return HealthStatus{Healthy: true}, nil
+}
+
+func checkDeployment(obj *unstructured.Unstructured) HealthStatus {
+	if status, observed := checkObservedGeneration(obj); !observed {
+		return status
+	}
+	if c := getCondition(obj, "Progressing"); c != nil && c["reason"] == "ProgressDeadlineExceeded" {
+		return HealthStatus{Failed: true, Message: fmt.Sprintf("%v", c["message"])}
+	}
+	replicas := getReplicas(obj)
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "availableReplicas")
+	if updated < replicas {
+		return HealthStatus{Message: fmt.Sprintf("%d/%d replicas are updated", updated, replicas)}
+	}
+	if available < replicas {
+		return HealthStatus{Message: fmt.Sprintf("%d/%d replicas are available", available, replicas)}
+	}
+	return HealthStatus{Healthy: true}
+}
+
+func checkStatefulSet(obj *unstructured.Unstructured) HealthStatus {
+	if status, observed := checkObservedGeneration(obj); !observed {
+		return status
+	}
+	replicas := getReplicas(obj)
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	if strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type"); strategy != "OnDelete" {
+		updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+		if updated < replicas {
+			return HealthStatus{Message: fmt.Sprintf("%d/%d replicas are updated", updated, replicas)}
+		}
+	}
+	if ready < replicas {
+		return HealthStatus{Message: fmt.Sprintf("%d/%d replicas are ready", ready, replicas)}
+	}
+	return HealthStatus{Healthy: true}
+}
+
+func checkDaemonSet(obj *unstructured.Unstructured) HealthStatus {
+	if status, observed := checkObservedGeneration(obj); !observed {
+		return status
+	}
+	desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedNumberScheduled")
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberAvailable")
+	if updated < desired {
+		return HealthStatus{Message: fmt.Sprintf("%d/%d pods are updated", updated, desired)}
+	}
+	if available < desired {
+		return HealthStatus{Message: fmt.Sprintf("%d/%d pods are available", available, desired)}
+	}
+	return HealthStatus{Healthy: true}
+}
+
+func checkJob(obj *unstructured.Unstructured) HealthStatus {
+	if c := getCondition(obj, "Failed"); c != nil && c["status"] == "True" {
+		return HealthStatus{Failed: true, Message: fmt.Sprintf("%v", c["message"])}
+	}
+	if c := getCondition(obj, "Complete"); c != nil && c["status"] == "True" {
+		return HealthStatus{Healthy: true}
+	}
+	return HealthStatus{Message: "the job is not completed"}
+}
+
+func checkPod(obj *unstructured.Unstructured) HealthStatus {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return HealthStatus{Healthy: true}
+	case "Failed":
+		message, _, _ := unstructured.NestedString(obj.Object, "status", "message")
+		return HealthStatus{Failed: true, Message: message}
+	case "Running":
+		if c := getCondition(obj, "Ready"); c != nil && c["status"] == "True" {
+			return HealthStatus{Healthy: true}
+		}
+		return HealthStatus{Message: "the pod is not ready"}
+	default:
+		return HealthStatus{Message: fmt.Sprintf("the pod is %s", orUnknown(phase))}
+	}
+}
+
+// checkObservedGeneration checks if the latest spec is observed by the controller of the resource
+func checkObservedGeneration(obj *unstructured.Unstructured) (HealthStatus, bool) {
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed < obj.GetGeneration() {
+		return HealthStatus{Message: "the latest spec is not observed"}, false
+	}
+	return HealthStatus{}, true
+}
+
+func getReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+func getCondition(obj *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		if m, ok := c.(map[string]interface{}); ok && m["type"] == conditionType {
+			return m
+		}
+	}
+	return nil
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestCheckHealth(t *testing.T) {
+	testCases := map[string]struct {
+		obj         string
+		healthCheck string
+		expected    HealthStatus
+		err         string
+	}{
+		"deployment not observed": {
+			obj:      "{apiVersion: apps/v1, kind: Deployment, metadata: {generation: 2}, spec: {replicas: 3}, status: {observedGeneration: 1}}",
+			expected: HealthStatus{Message: "the latest spec is not observed"},
+		},
+		"deployment not available": {
+			obj:      "{apiVersion: apps/v1, kind: Deployment, metadata: {generation: 1}, spec: {replicas: 3}, status: {observedGeneration: 1, updatedReplicas: 3, availableReplicas: 1}}",
+			expected: HealthStatus{Message: "1/3 replicas are available"},
+		},
+		"deployment progress deadline exceeded": {
+			obj:      "{apiVersion: apps/v1, kind: Deployment, metadata: {generation: 1}, status: {observedGeneration: 1, conditions: [{type: Progressing, status: 'False', reason: ProgressDeadlineExceeded, message: timeout}]}}",
+			expected: HealthStatus{Failed: true, Message: "timeout"},
+		},
+		"deployment healthy": {
+			obj:      "{apiVersion: apps/v1, kind: Deployment, metadata: {generation: 1}, status: {observedGeneration: 1, updatedReplicas: 1, availableReplicas: 1}}",
+			expected: HealthStatus{Healthy: true},
+		},
+		"statefulset not ready": {
+			obj:      "{apiVersion: apps/v1, kind: StatefulSet, spec: {replicas: 2, updateStrategy: {type: OnDelete}}, status: {readyReplicas: 1}}",
+			expected: HealthStatus{Message: "1/2 replicas are ready"},
+		},
+		"daemonset not updated": {
+			obj:      "{apiVersion: apps/v1, kind: DaemonSet, status: {desiredNumberScheduled: 3, updatedNumberScheduled: 2, numberAvailable: 3}}",
+			expected: HealthStatus{Message: "2/3 pods are updated"},
+		},
+		"job failed": {
+			obj:      "{apiVersion: batch/v1, kind: Job, status: {conditions: [{type: Failed, status: 'True', message: backoff limit exceeded}]}}",
+			expected: HealthStatus{Failed: true, Message: "backoff limit exceeded"},
+		},
+		"job completed": {
+			obj:      "{apiVersion: batch/v1, kind: Job, status: {conditions: [{type: Complete, status: 'True'}]}}",
+			expected: HealthStatus{Healthy: true},
+		},
+		"pod not ready": {
+			obj:      "{apiVersion: v1, kind: Pod, status: {phase: Running, conditions: [{type: Ready, status: 'False'}]}}",
+			expected: HealthStatus{Message: "the pod is not ready"},
+		},
+		"claim pending": {
+			obj:      "{apiVersion: v1, kind: PersistentVolumeClaim, status: {phase: Pending}}",
+			expected: HealthStatus{Message: "the claim is Pending"},
+		},
+		"load balancer not provisioned": {
+			obj:      "{apiVersion: v1, kind: Service, spec: {type: LoadBalancer}}",
+			expected: HealthStatus{Message: "the load balancer is not provisioned"},
+		},
+		"cluster ip service": {
+			obj:      "{apiVersion: v1, kind: Service, spec: {type: ClusterIP}}",
+			expected: HealthStatus{Healthy: true},
+		},
+		"custom resource not ready": {
+			obj:      "{apiVersion: example.com/v1, kind: Database, status: {conditions: [{type: Ready, status: 'False', message: provisioning}]}}",
+			expected: HealthStatus{Message: "the Ready condition is False: provisioning"},
+		},
+		"config map": {
+			obj:      "{apiVersion: v1, kind: ConfigMap}",
+			expected: HealthStatus{Healthy: true},
+		},
+		"health check is false": {
+			obj:         "{apiVersion: example.com/v1, kind: Database, spec: {replicas: 2}, status: {readyReplicas: 1}}",
+			healthCheck: "status.readyReplicas == spec.replicas",
+			expected:    HealthStatus{Message: "health check `status.readyReplicas == spec.replicas` is false"},
+		},
+		"health check is true": {
+			obj:         "{apiVersion: example.com/v1, kind: Database, spec: {replicas: 2}, status: {readyReplicas: 2}}",
+			healthCheck: "status.readyReplicas == spec.replicas",
+			expected:    HealthStatus{Healthy: true},
+		},
+		"health check with the status not reported": {
+			obj:         "{apiVersion: example.com/v1, kind: Database, spec: {replicas: 2}}",
+			healthCheck: "status.readyReplicas == spec.replicas",
+			expected:    HealthStatus{Message: "health check `status.readyReplicas == spec.replicas` can't be evaluated: reference \"status\" not found"},
+		},
+		"invalid health check": {
+			obj:         "{apiVersion: v1, kind: ConfigMap}",
+			healthCheck: "status ==",
+			err:         "invalid health check `status ==`",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			obj := &unstructured.Unstructured{}
+			b, err := yaml.YAMLToJSON([]byte(tc.obj))
+			r.NoError(err)
+			r.NoError(obj.UnmarshalJSON(b))
+			status, err := CheckHealth(obj, tc.healthCheck)
+			if tc.err != "" {
+				r.Error(err)
+				r.Contains(err.Error(), tc.err)
+				return
+			}
+			r.NoError(err)
+			r.Equal(tc.expected, status)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/pkg/util/singleton"
+)
+
+// impersonatedClients caches the clients impersonating the service accounts by the username of the service account
+var impersonatedClients sync.Map
+
+// CheckImpersonatePermission checks whether the client is allowed to impersonate the service account by SelfSubjectAccessReview
+func CheckImpersonatePermission(ctx context.Context, cli client.Client, namespace, name string) error {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "impersonate",
+				Resource:  "serviceaccounts",
+				Name:      name,
+			},
+		},
+	}
+	if err := cli.Create(ctx, review); err != nil {
+		return errors.WithMessagef(err, "failed to review the permission to impersonate service account %s/%s", namespace, name)
+	}
+	if !review.Status.Allowed {
+		return fmt.Errorf("the controller is not allowed to impersonate service account %s/%s", namespace, name)
+	}
+	return nil
+}
+
+// GetImpersonatedClient returns the client that acts as the service account. The permission to impersonate
+// is checked before the client is created, the created clients are cached and shared by the steps.
+func GetImpersonatedClient(ctx context.Context, namespace, name string) (client.Client, error) {
+	username := serviceaccount.MakeUsername(namespace, name)
+	if cli, ok := impersonatedClients.Load(username); ok {
+		return cli.(client.Client), nil
+	}
+	base := singleton.KubeClient.Get()
+	if err := CheckImpersonatePermission(ctx, base, namespace, name); err != nil {
+		return nil, err
+	}
+	cfg := rest.CopyConfig(singleton.KubeConfig.Get())
+	cfg.Impersonate = rest.ImpersonationConfig{UserName: username}
+	cli, err := client.New(cfg, client.Options{Scheme: base.Scheme(), Mapper: base.RESTMapper()})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to create the client of service account %s/%s", namespace, name)
+	}
+	actual, _ := impersonatedClients.LoadOrStore(username, cli)
+	return actual.(client.Client), nil
+}
+
+// WithKubeClient returns a copy of parent in which the kube client used by the providers is set
+func WithKubeClient(parent context.Context, cli client.Client) context.Context {
+	return context.WithValue(parent, KubeClientKey, cli)
+}
+
+// WithImpersonatedClient returns a copy of parent in which the kube client that acts as the service account of the
+// step is set
+func WithImpersonatedClient(parent context.Context, cli client.Client, serviceAccount string) context.Context {
+	return context.WithValue(WithKubeClient(parent, cli), ImpersonatedKey, serviceAccount)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// reviewClient allows the controller to impersonate the service accounts in the allowed namespace
+type reviewClient struct {
+	client.Client
+	allowed string
+}
+
+func (c *reviewClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if review, ok := obj.(*authorizationv1.SelfSubjectAccessReview); ok {
+		review.Status.Allowed = review.Spec.ResourceAttributes.Namespace == c.allowed &&
+			review.Spec.ResourceAttributes.Verb == "impersonate" &&
+			review.Spec.ResourceAttributes.Resource == "serviceaccounts"
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestGetImpersonatedClient(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	singleton.KubeConfig.Set(&rest.Config{Host: "https://127.0.0.1:6443"})
+	singleton.KubeClient.Set(&reviewClient{Client: fake.NewClientBuilder().Build(), allowed: "default"})
+
+	cli, err := GetImpersonatedClient(ctx, "default", "deployer")
+	r.NoError(err)
+	r.NotNil(cli)
+	cached, err := GetImpersonatedClient(ctx, "default", "deployer")
+	r.NoError(err)
+	r.Same(cli, cached)
+
+	_, err = GetImpersonatedClient(ctx, "other", "deployer")
+	r.Equal("the controller is not allowed to impersonate service account other/deployer", err.Error())
+
+	r.Same(cli, RuntimeParamsFrom(WithKubeClient(ctx, cli)).KubeClient)
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kubevela/pkg/multicluster"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// inventoryEntry is a resource applied by the run
+type inventoryEntry struct {
+	// Index is the position of the resource in the order that the resources were first applied
+	Index int    `json:"index"`
+	Step  string `json:"step,omitempty"`
+	// ServiceAccount is the service account of the step that applied the resource, the resource is deleted by it
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	Cluster        string `json:"cluster,omitempty"`
+	APIVersion     string `json:"apiVersion"`
+	Kind           string `json:"kind"`
+	Namespace      string `json:"namespace,omitempty"`
+	Name           string `json:"name"`
+}
+
+// inventoryKey returns the key of the resource in the inventory, it's the hash of the identity of the resource so
+// that the resources applied again are found without loading the whole inventory
+func inventoryKey(cluster string, obj *unstructured.Unstructured) string {
+	h := sha256.Sum256([]byte(strings.Join([]string{cluster, obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName()}, "/")))
+	return hex.EncodeToString(h[:16])
+}
+
+// RecordInventory records the resources applied by the step in the inventory of the run in the order that they were
+// first applied, so that they can be torn down in the reverse order. The resources applied again are kept in their
+// first positions. Every resource is stored in its own key of the workflow context, and the resources beyond
+// MaxInventorySize are not recorded.
+func RecordInventory(params RuntimeParams, cluster string, manifests ...*unstructured.Unstructured) error {
+	wfCtx := params.WorkflowContext
+	if wfCtx == nil {
+		return nil
+	}
+	size, _ := strconv.Atoi(wfCtx.GetMutableValue(types.ContextKeyInventorySize))
+	var step string
+	if params.ProcessContext != nil {
+		step, _ = params.ProcessContext.GetData(model.ContextStepName).(string)
+	}
+	recorded := false
+	for _, manifest := range manifests {
+		key := inventoryKey(cluster, manifest)
+		if wfCtx.GetMutableValue(types.ContextPrefixInventory, key) != "" {
+			continue
+		}
+		if types.MaxInventorySize > 0 && size >= types.MaxInventorySize {
+			wfCtx.SetMutableValue("true", types.ContextKeyInventoryTruncated)
+			break
+		}
+		b, err := json.Marshal(inventoryEntry{
+			Index:          size,
+			Step:           step,
+			ServiceAccount: params.ServiceAccount,
+			Cluster:        cluster,
+			APIVersion:     manifest.GetAPIVersion(),
+			Kind:           manifest.GetKind(),
+			Namespace:      manifest.GetNamespace(),
+			Name:           manifest.GetName(),
+		})
+		if err != nil {
+			return err
+		}
+		wfCtx.SetMutableValue(string(b), types.ContextPrefixInventory, key)
+		size++
+		recorded = true
+	}
+	if recorded {
+		wfCtx.SetMutableValue(strconv.Itoa(size), types.ContextKeyInventorySize)
+	}
+	return nil
+}
+
+// FindRunsForResource returns the workflow runs that applied the resource in the cluster, sorted by the namespace and
+// the name. The runs are found by the inventories in their context backends and by the labels of the resource set by
+// the run that applied it last, both are read from the API on each call, so there's no index to rebuild after the
+// controller restarts and the deleted runs are never returned. The version of the resource is ignored.
+func FindRunsForResource(ctx context.Context, cli client.Client, cluster string, gvk schema.GroupVersionKind, namespace, name string) ([]ktypes.NamespacedName, error) {
+	found := make(map[ktypes.NamespacedName]struct{})
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := cli.Get(multicluster.WithCluster(ctx, cluster), client.ObjectKey{Namespace: namespace, Name: name}, obj); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return nil, err
+		}
+	} else if labels := obj.GetLabels(); labels[types.LabelWorkflowRunName] != "" {
+		found[ktypes.NamespacedName{Namespace: labels[types.LabelWorkflowRunNamespace], Name: labels[types.LabelWorkflowRunName]}] = struct{}{}
+	}
+
+	runs := &v1alpha1.WorkflowRunList{}
+	if err := cli.List(ctx, runs); err != nil {
+		return nil, err
+	}
+	for _, run := range runs.Items {
+		if run.Status.ContextBackend == nil {
+			continue
+		}
+		cm := corev1.ConfigMap{}
+		if err := cli.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: run.Status.ContextBackend.Name}, &cm); err != nil {
+			if kerrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		wfCtx := new(wfContext.WorkflowContext)
+		if err := wfCtx.LoadFromConfigMap(ctx, cm); err != nil {
+			return nil, err
+		}
+		entries, err := loadInventory(wfCtx)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "load the inventory of the workflow run %s/%s", run.Namespace, run.Name)
+		}
+		for _, entry := range entries {
+			if sameCluster(entry.Cluster, cluster) && schema.FromAPIVersionAndKind(entry.APIVersion, entry.Kind).GroupKind() == gvk.GroupKind() &&
+				entry.Namespace == namespace && entry.Name == name {
+				found[ktypes.NamespacedName{Namespace: run.Namespace, Name: run.Name}] = struct{}{}
+				break
+			}
+		}
+	}
+
+	result := make([]ktypes.NamespacedName, 0, len(found))
+	for run := range found {
+		result = append(result, run)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func sameCluster(a, b string) bool {
+	if multicluster.IsLocal(a) || multicluster.IsLocal(b) {
+		return multicluster.IsLocal(a) && multicluster.IsLocal(b)
+	}
+	return a == b
+}
+
+// NewTeardownStatus returns the teardown of the resources in the inventory of the run, the resources are pending in
+// the reverse order that they were applied
+func NewTeardownStatus(wfCtx wfContext.Context) (*v1alpha1.TeardownStatus, error) {
+	status := &v1alpha1.TeardownStatus{Phase: v1alpha1.WorkflowStepPhaseRunning}
+	if wfCtx == nil {
+		return status, nil
+	}
+	entries, err := loadInventory(wfCtx)
+	if err != nil {
+		return nil, err
+	}
+	status.Truncated = wfCtx.GetMutableValue(types.ContextKeyInventoryTruncated) == "true"
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		status.Resources = append(status.Resources, v1alpha1.TeardownResource{
+			Step:           entry.Step,
+			ServiceAccount: entry.ServiceAccount,
+			Cluster:        entry.Cluster,
+			APIVersion:     entry.APIVersion,
+			Kind:           entry.Kind,
+			Namespace:      entry.Namespace,
+			Name:           entry.Name,
+			Phase:          v1alpha1.TeardownResourcePending,
+		})
+	}
+	return status, nil
+}
+
+// TeardownResources advances the teardown by deleting the resources one by one, a resource is deleted only after
+// the resources before it are gone. It returns once a resource is still being deleted, the progress is kept in the
+// status, and the phase of the status is succeeded once all the resources are gone. The resources applied by the
+// steps with the service accounts are deleted by the service accounts in the namespace of the run, and the others
+// by the client of the controller that applied them.
+func TeardownResources(ctx context.Context, cli client.Client, namespace string, status *v1alpha1.TeardownStatus) {
+	for i := range status.Resources {
+		resource := &status.Resources[i]
+		if resource.Phase == v1alpha1.TeardownResourceDeleted {
+			continue
+		}
+		resource.Message = ""
+		deleter := cli
+		if resource.ServiceAccount != "" {
+			impersonated, err := GetImpersonatedClient(ctx, namespace, resource.ServiceAccount)
+			if err != nil {
+				resource.Message = err.Error()
+				return
+			}
+			deleter = impersonated
+		}
+		gone, err := deleteResource(multicluster.WithCluster(ctx, resource.Cluster), deleter, resource)
+		if err != nil {
+			resource.Message = err.Error()
+			return
+		}
+		if !gone {
+			resource.Phase = v1alpha1.TeardownResourceDeleting
+			return
+		}
+		resource.Phase = v1alpha1.TeardownResourceDeleted
+	}
+	status.Phase = v1alpha1.WorkflowStepPhaseSucceeded
+}
+
+// deleteResource deletes the resource if it's not being deleted, it returns true once the resource is gone
+func deleteResource(ctx context.Context, cli client.Client, resource *v1alpha1.TeardownResource) (bool, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(resource.APIVersion)
+	obj.SetKind(resource.Kind)
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: resource.Namespace, Name: resource.Name}, obj); err != nil {
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if obj.GetDeletionTimestamp() != nil {
+		resource.Message = fmt.Sprintf("waiting for the finalizers %v", obj.GetFinalizers())
+		return false, nil
+	}
+	if err := cli.Delete(ctx, obj, client.PropagationPolicy("Foreground")); err != nil {
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// loadInventory loads the resources in the inventory in the order that they were first applied
+func loadInventory(wfCtx wfContext.Context) ([]inventoryEntry, error) {
+	store := wfCtx.GetStore()
+	if store == nil {
+		return nil, nil
+	}
+	var entries []inventoryEntry
+	prefix := types.ContextPrefixInventory + "."
+	for key, data := range store.Data {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var entry inventoryEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, errors.WithMessagef(err, "decode the resource %s in the inventory", key)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Index < entries[j].Index })
+	return entries, nil
+}
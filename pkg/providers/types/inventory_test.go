@@ -0,0 +1,205 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/cue/process"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+func TestTeardownResources(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: "default", Finalizers: []string{"test/finalizer"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "third", Namespace: "default"}},
+	).Build()
+	singleton.KubeClient.Set(cli)
+	wfCtx, err := wfContext.NewContext(ctx, "default", "test-teardown", nil)
+	r.NoError(err)
+	configMap := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		}}
+	}
+
+	// nothing is recorded without the workflow context
+	r.NoError(RecordInventory(RuntimeParams{}, "", configMap("first")))
+
+	pCtx := process.NewContext(process.ContextData{})
+	params := RuntimeParams{WorkflowContext: wfCtx, ProcessContext: pCtx, KubeClient: cli}
+	pCtx.PushData(model.ContextStepName, "prepare")
+	r.NoError(RecordInventory(params, "", configMap("first"), configMap("second")))
+	pCtx.PushData(model.ContextStepName, "deploy")
+	// the resources applied again are kept in their first positions
+	r.NoError(RecordInventory(params, "", configMap("third"), configMap("first")))
+
+	status, err := NewTeardownStatus(wfCtx)
+	r.NoError(err)
+	r.Equal(&v1alpha1.TeardownStatus{
+		Phase: v1alpha1.WorkflowStepPhaseRunning,
+		Resources: []v1alpha1.TeardownResource{
+			{Step: "deploy", APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "third", Phase: v1alpha1.TeardownResourcePending},
+			{Step: "prepare", APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "second", Phase: v1alpha1.TeardownResourcePending},
+			{Step: "prepare", APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "first", Phase: v1alpha1.TeardownResourcePending},
+		},
+	}, status)
+
+	// the resource is deleted after the resources applied after it are gone
+	TeardownResources(ctx, cli, "default", status)
+	r.Equal(v1alpha1.TeardownResourceDeleting, status.Resources[0].Phase)
+	r.Equal(v1alpha1.TeardownResourcePending, status.Resources[1].Phase)
+	TeardownResources(ctx, cli, "default", status)
+	r.Equal(v1alpha1.TeardownResourceDeleted, status.Resources[0].Phase)
+	r.Equal(v1alpha1.TeardownResourceDeleting, status.Resources[1].Phase)
+	// the teardown waits for the finalizers of the resource
+	TeardownResources(ctx, cli, "default", status)
+	r.Equal(v1alpha1.TeardownResourceDeleting, status.Resources[1].Phase)
+	r.Contains(status.Resources[1].Message, "test/finalizer")
+	r.Equal(v1alpha1.TeardownResourcePending, status.Resources[2].Phase)
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+	cm := &corev1.ConfigMap{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "first"}, cm))
+
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "second"}, cm))
+	cm.Finalizers = nil
+	r.NoError(cli.Update(ctx, cm))
+	TeardownResources(ctx, cli, "default", status)
+	TeardownResources(ctx, cli, "default", status)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	for _, resource := range status.Resources {
+		r.Equal(v1alpha1.TeardownResourceDeleted, resource.Phase)
+		r.Equal("", resource.Message)
+	}
+	r.True(kerrors.IsNotFound(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "first"}, cm)))
+}
+
+func TestRecordInventoryLimit(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "first", Namespace: "default"}}).Build()
+	singleton.KubeClient.Set(cli)
+	wfCtx, err := wfContext.NewContext(ctx, "default", "test-inventory-limit", nil)
+	r.NoError(err)
+	configMap := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		}}
+	}
+	defer func(size int) { types.MaxInventorySize = size }(types.MaxInventorySize)
+	types.MaxInventorySize = 2
+
+	pCtx := process.NewContext(process.ContextData{})
+	pCtx.PushData(model.ContextStepName, "deploy")
+	params := RuntimeParams{WorkflowContext: wfCtx, ProcessContext: pCtx, KubeClient: cli, Impersonated: true, ServiceAccount: "teardown-deployer"}
+	r.NoError(RecordInventory(params, "", configMap("first"), configMap("second"), configMap("third")))
+	// the recorded resources are still found once the inventory is full
+	r.NoError(RecordInventory(params, "", configMap("first")))
+
+	status, err := NewTeardownStatus(wfCtx)
+	r.NoError(err)
+	r.True(status.Truncated)
+	r.Len(status.Resources, 2)
+	r.Equal("second", status.Resources[0].Name)
+	r.Equal("first", status.Resources[1].Name)
+	r.Equal("teardown-deployer", status.Resources[1].ServiceAccount)
+
+	// the resources are deleted by the service account of the step that applied them
+	TeardownResources(ctx, cli, "default", status)
+	r.Equal(v1alpha1.TeardownResourcePending, status.Resources[0].Phase)
+	r.Contains(status.Resources[0].Message, "impersonate service account default/teardown-deployer")
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "first"}, &corev1.ConfigMap{}))
+}
+
+func TestFindRunsForResource(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	r.NoError(clientgoscheme.AddToScheme(scheme))
+	r.NoError(v1alpha1.AddToScheme(scheme))
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "applied", Namespace: "default", Labels: map[string]string{
+			types.LabelWorkflowRunName:      "last",
+			types.LabelWorkflowRunNamespace: "default",
+		}}},
+	).Build()
+	singleton.KubeClient.Set(cli)
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "applied", "namespace": "default"},
+	}}
+	newRun := func(namespace, name, cluster string) {
+		wfCtx, err := wfContext.NewContext(ctx, namespace, name, nil)
+		r.NoError(err)
+		r.NoError(RecordInventory(RuntimeParams{WorkflowContext: wfCtx}, cluster, configMap))
+		r.NoError(wfCtx.Commit(ctx))
+		r.NoError(cli.Create(ctx, &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Status:     v1alpha1.WorkflowRunStatus{ContextBackend: wfCtx.StoreRef()},
+		}))
+	}
+	newRun("default", "first", "")
+	newRun("test", "second", "local")
+	newRun("default", "remote", "cluster-a")
+	r.NoError(cli.Create(ctx, &v1alpha1.WorkflowRun{ObjectMeta: metav1.ObjectMeta{Name: "no-context", Namespace: "default"}}))
+
+	runs, err := FindRunsForResource(ctx, cli, "", corev1.SchemeGroupVersion.WithKind("ConfigMap"), "default", "applied")
+	r.NoError(err)
+	r.Equal([]ktypes.NamespacedName{
+		{Namespace: "default", Name: "first"},
+		{Namespace: "default", Name: "last"},
+		{Namespace: "test", Name: "second"},
+	}, runs)
+
+	// the version of the resource is ignored by the inventories, while the resource is not found in the version
+	runs, err = FindRunsForResource(ctx, cli, "local", schema.GroupVersionKind{Version: "v2", Kind: "ConfigMap"}, "default", "applied")
+	r.NoError(err)
+	r.Equal([]ktypes.NamespacedName{{Namespace: "default", Name: "first"}, {Namespace: "test", Name: "second"}}, runs)
+
+	runs, err = FindRunsForResource(ctx, cli, "cluster-a", corev1.SchemeGroupVersion.WithKind("ConfigMap"), "default", "applied")
+	r.NoError(err)
+	r.Contains(runs, ktypes.NamespacedName{Namespace: "default", Name: "remote"})
+
+	runs, err = FindRunsForResource(ctx, cli, "", corev1.SchemeGroupVersion.WithKind("ConfigMap"), "default", "not-applied")
+	r.NoError(err)
+	r.Empty(runs)
+}
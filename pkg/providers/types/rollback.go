@@ -0,0 +1,266 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kubevela/pkg/multicluster"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/cue/process"
+)
+
+const (
+	// RollbackActionDeleted is the action to delete the resource created by the atomic step group
+	RollbackActionDeleted = "Deleted"
+	// RollbackActionReverted is the action to restore the resource updated by the atomic step group
+	RollbackActionReverted = "Reverted"
+	// RollbackActionSkipped is the action for the updated resource whose previous state was not captured
+	RollbackActionSkipped = "Skipped"
+	// MaxRollbackStateSize is the max size in bytes of the captured state of an atomic step group, the previous state
+	// of the resources beyond it is not captured to keep the workflow context under the size limit of the ConfigMap
+	MaxRollbackStateSize = 256 * 1024
+	// rollbackStateKey is the key prefix of the captured state of the atomic step groups in the workflow context
+	rollbackStateKey = "rollback"
+)
+
+// rollbackEntry is the state of a resource captured before it's applied by a sub step of an atomic step group
+type rollbackEntry struct {
+	Step       string `json:"step,omitempty"`
+	Cluster    string `json:"cluster,omitempty"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Previous is the resource before it's applied, it's empty if the resource didn't exist
+	Previous *unstructured.Unstructured `json:"previous,omitempty"`
+	// Uncaptured is the reason why the previous state of the existing resource is not captured
+	Uncaptured string `json:"uncaptured,omitempty"`
+}
+
+func (e rollbackEntry) matches(cluster string, obj *unstructured.Unstructured) bool {
+	return e.Cluster == cluster && e.APIVersion == obj.GetAPIVersion() && e.Kind == obj.GetKind() &&
+		e.Namespace == obj.GetNamespace() && e.Name == obj.GetName()
+}
+
+// AtomicGroupFrom returns the session id of the atomic step group that the step belongs to, it's empty if the step
+// is not a sub step of an atomic group
+func AtomicGroupFrom(pCtx process.Context) string {
+	if pCtx == nil {
+		return ""
+	}
+	group, _ := pCtx.GetData(model.ContextAtomicGroup).(string)
+	return group
+}
+
+// CaptureRollbackState captures the state of the resources before they're applied by a sub step of an atomic step
+// group, so that they can be rolled back if the group fails. Only the first capture of a resource is kept, which is
+// the state before the group applied it. It does nothing if the step is not in an atomic group.
+// The previous state of the Secrets is never captured since the workflow context is stored in a ConfigMap, and the
+// previous state that exceeds MaxRollbackStateSize is not captured either, such resources are skipped by the rollback.
+func CaptureRollbackState(ctx context.Context, params RuntimeParams, cluster string, manifests ...*unstructured.Unstructured) error {
+	group := AtomicGroupFrom(params.ProcessContext)
+	if group == "" || params.WorkflowContext == nil {
+		return nil
+	}
+	entries, err := loadRollbackEntries(params.WorkflowContext, group)
+	if err != nil {
+		return err
+	}
+	step, _ := params.ProcessContext.GetData(model.ContextStepName).(string)
+	size, err := entriesSize(entries)
+	if err != nil {
+		return err
+	}
+	captured := false
+	for _, manifest := range manifests {
+		if containsEntry(entries, cluster, manifest) {
+			continue
+		}
+		entry := rollbackEntry{
+			Step:       step,
+			Cluster:    cluster,
+			APIVersion: manifest.GetAPIVersion(),
+			Kind:       manifest.GetKind(),
+			Namespace:  manifest.GetNamespace(),
+			Name:       manifest.GetName(),
+		}
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(manifest.GroupVersionKind())
+		if err := params.KubeClient.Get(ctx, client.ObjectKeyFromObject(manifest), existing); err != nil {
+			if !kerrors.IsNotFound(err) {
+				return errors.WithMessagef(err, "capture the state of %s %s/%s", manifest.GetKind(), manifest.GetNamespace(), manifest.GetName())
+			}
+		} else if err := capturePrevious(&entry, existing, size); err != nil {
+			return err
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		size += len(b) + 1
+		entries = append(entries, entry)
+		captured = true
+	}
+	if !captured {
+		return nil
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	params.WorkflowContext.SetMutableValue(string(b), rollbackStateKey, group)
+	return nil
+}
+
+// RollbackResources rolls back the resources applied by the sub steps of the atomic step group in the reverse order
+// that they were applied: the created resources are deleted and the updated ones are restored to their captured
+// state. The captured state is cleared afterwards, and nil is returned if no resource was applied.
+func RollbackResources(ctx context.Context, cli client.Client, wfCtx wfContext.Context, group string) (*v1alpha1.StepRollbackStatus, error) {
+	entries, err := loadRollbackEntries(wfCtx, group)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	status := &v1alpha1.StepRollbackStatus{Phase: v1alpha1.WorkflowStepPhaseSucceeded}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		resource := v1alpha1.RolledBackResource{
+			Step:       entry.Step,
+			Cluster:    entry.Cluster,
+			APIVersion: entry.APIVersion,
+			Kind:       entry.Kind,
+			Namespace:  entry.Namespace,
+			Name:       entry.Name,
+			Action:     RollbackActionReverted,
+		}
+		switch {
+		case entry.Uncaptured != "":
+			resource.Action = RollbackActionSkipped
+			resource.Error = entry.Uncaptured
+			status.Resources = append(status.Resources, resource)
+			continue
+		case entry.Previous == nil:
+			resource.Action = RollbackActionDeleted
+		}
+		if err := revert(multicluster.WithCluster(ctx, entry.Cluster), cli, entry); err != nil {
+			resource.Error = err.Error()
+			status.Phase = v1alpha1.WorkflowStepPhaseFailed
+		}
+		status.Resources = append(status.Resources, resource)
+	}
+	ClearRollbackState(wfCtx, group)
+	return status, nil
+}
+
+// ClearRollbackState clears the captured state of the atomic step group, e.g. once the group succeeds
+func ClearRollbackState(wfCtx wfContext.Context, group string) {
+	wfCtx.DeleteMutableValue(rollbackStateKey, group)
+}
+
+func revert(ctx context.Context, cli client.Client, entry rollbackEntry) error {
+	current := &unstructured.Unstructured{}
+	current.SetAPIVersion(entry.APIVersion)
+	current.SetKind(entry.Kind)
+	err := cli.Get(ctx, client.ObjectKey{Namespace: entry.Namespace, Name: entry.Name}, current)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if entry.Previous == nil {
+		if !exists {
+			return nil
+		}
+		return client.IgnoreNotFound(cli.Delete(ctx, current))
+	}
+	previous := entry.Previous.DeepCopy()
+	if !exists {
+		return cli.Create(ctx, previous)
+	}
+	previous.SetResourceVersion(current.GetResourceVersion())
+	return cli.Update(ctx, previous)
+}
+
+// capturePrevious captures the previous state of the existing resource into the entry unless it's a Secret or the
+// captured state would exceed MaxRollbackStateSize
+func capturePrevious(entry *rollbackEntry, existing *unstructured.Unstructured, size int) error {
+	if existing.GroupVersionKind().GroupKind() == corev1.SchemeGroupVersion.WithKind("Secret").GroupKind() {
+		entry.Uncaptured = "the previous state of the Secret is not captured to keep its data out of the workflow context"
+		return nil
+	}
+	entry.Previous = previousState(existing)
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if size+len(b)+1 > MaxRollbackStateSize {
+		entry.Previous = nil
+		entry.Uncaptured = fmt.Sprintf("the previous state is not captured since the captured state of the group exceeds %d bytes", MaxRollbackStateSize)
+	}
+	return nil
+}
+
+func entriesSize(entries []rollbackEntry) (int, error) {
+	if len(entries) == 0 {
+		return 2, nil
+	}
+	b, err := json.Marshal(entries)
+	return len(b), err
+}
+
+// previousState strips the fields managed by the server from the captured resource so that it can be restored
+func previousState(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	previous := obj.DeepCopy()
+	for _, field := range []string{"resourceVersion", "uid", "generation", "creationTimestamp", "managedFields"} {
+		unstructured.RemoveNestedField(previous.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(previous.Object, "status")
+	return previous
+}
+
+func containsEntry(entries []rollbackEntry, cluster string, obj *unstructured.Unstructured) bool {
+	for _, entry := range entries {
+		if entry.matches(cluster, obj) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadRollbackEntries(wfCtx wfContext.Context, group string) ([]rollbackEntry, error) {
+	data := wfCtx.GetMutableValue(rollbackStateKey, group)
+	if data == "" {
+		return nil, nil
+	}
+	var entries []rollbackEntry
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, errors.WithMessagef(err, "decode the captured state of the atomic step group %s", group)
+	}
+	return entries, nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/cue/process"
+)
+
+func TestRollbackResources(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Data:       map[string]string{"version": "v1"},
+	}).Build()
+	singleton.KubeClient.Set(cli)
+	wfCtx, err := wfContext.NewContext(ctx, "default", "test-rollback", nil)
+	r.NoError(err)
+	configMap := func(name, version string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+			"data":       map[string]interface{}{"version": version},
+		}}
+	}
+	apply := func(obj *unstructured.Unstructured) {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := cli.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+			r.NoError(cli.Create(ctx, obj))
+			return
+		}
+		obj.SetResourceVersion(current.GetResourceVersion())
+		r.NoError(cli.Update(ctx, obj))
+	}
+
+	// the state is not captured if the step is not in an atomic group
+	pCtx := process.NewContext(process.ContextData{})
+	params := RuntimeParams{WorkflowContext: wfCtx, ProcessContext: pCtx, KubeClient: cli}
+	r.NoError(CaptureRollbackState(ctx, params, "", configMap("existing", "v2")))
+	r.Equal("", wfCtx.GetMutableValue(rollbackStateKey, "group-id"))
+
+	pCtx.PushData(model.ContextAtomicGroup, "group-id")
+	pCtx.PushData(model.ContextStepName, "deploy")
+	existing, created := configMap("existing", "v2"), configMap("created", "v1")
+	r.NoError(CaptureRollbackState(ctx, params, "", existing, created))
+	apply(existing)
+	apply(created)
+	// the state captured before the group applied the resource is kept
+	r.NoError(CaptureRollbackState(ctx, params, "", configMap("existing", "v3")))
+	apply(configMap("existing", "v3"))
+
+	status, err := RollbackResources(ctx, cli, wfCtx, "group-id")
+	r.NoError(err)
+	r.Equal(&v1alpha1.StepRollbackStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+		Resources: []v1alpha1.RolledBackResource{
+			{Step: "deploy", APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "created", Action: RollbackActionDeleted},
+			{Step: "deploy", APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "existing", Action: RollbackActionReverted},
+		},
+	}, status)
+	cm := &corev1.ConfigMap{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "existing"}, cm))
+	r.Equal(map[string]string{"version": "v1"}, cm.Data)
+	r.True(kerrors.IsNotFound(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "created"}, cm)))
+	r.Equal("", wfCtx.GetMutableValue(rollbackStateKey, "group-id"))
+
+	// nothing is rolled back once the captured state is cleared
+	status, err = RollbackResources(ctx, cli, wfCtx, "group-id")
+	r.NoError(err)
+	r.Nil(status)
+}
+
+func TestCaptureRollbackStateUncaptured(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+	}, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "large", Namespace: "default"},
+		Data:       map[string]string{"data": strings.Repeat("x", MaxRollbackStateSize)},
+	}).Build()
+	singleton.KubeClient.Set(cli)
+	wfCtx, err := wfContext.NewContext(ctx, "default", "test-rollback-uncaptured", nil)
+	r.NoError(err)
+	pCtx := process.NewContext(process.ContextData{})
+	pCtx.PushData(model.ContextAtomicGroup, "group-id")
+	pCtx.PushData(model.ContextStepName, "deploy")
+	params := RuntimeParams{WorkflowContext: wfCtx, ProcessContext: pCtx, KubeClient: cli}
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "existing", "namespace": "default"},
+		"stringData": map[string]interface{}{"password": "updated"},
+	}}
+	large := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "large", "namespace": "default"},
+	}}
+	r.NoError(CaptureRollbackState(ctx, params, "", secret, large))
+	state := wfCtx.GetMutableValue(rollbackStateKey, "group-id")
+	r.NotContains(state, "c2VjcmV0")
+	r.Less(len(state), MaxRollbackStateSize)
+
+	status, err := RollbackResources(ctx, cli, wfCtx, "group-id")
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Len(status.Resources, 2)
+	r.Equal(RollbackActionSkipped, status.Resources[0].Action)
+	r.Equal("large", status.Resources[0].Name)
+	r.Contains(status.Resources[0].Error, "exceeds")
+	r.Equal(RollbackActionSkipped, status.Resources[1].Action)
+	r.Equal("existing", status.Resources[1].Name)
+	r.Contains(status.Resources[1].Error, "Secret")
+}
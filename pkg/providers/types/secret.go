@@ -0,0 +1,230 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// secretRefExpression matches the references to the secrets in the parameters of the providers, e.g.
+// `{{ secret.db.password }}` references the key password of the secret db in the namespace of the run. The name of
+// the secret can't contain dots, while the key can, e.g. `{{ secret.tls.tls.crt }}`.
+var secretRefExpression = regexp.MustCompile(`\{\{\s*secret\.([a-z0-9]([-a-z0-9]*[a-z0-9])?)\.([-._a-zA-Z0-9]+)\s*\}\}`)
+
+// resolveSecretRefs resolves the secret references in the string values of the parameters of the provider in JSON
+// just before the provider is called. The references are kept as they are everywhere else, e.g. the rendered
+// properties, the outputs and the provider trace, so the resolved values are never persisted. The secrets are read
+// with the client of the step, and only the secrets labeled with workflow.oam.dev/secret-ref=true can be referenced
+// if the client is the controller's own instead of the service account of the step. It returns the resolved parameters, and the resolved strings and secret values mapped to
+// their references to redact what the provider returns.
+func resolveSecretRefs(ctx context.Context, params RuntimeParams, data []byte) ([]byte, map[string]string, error) {
+	if !secretRefExpression.Match(data) {
+		return data, nil, nil
+	}
+	var namespace string
+	if params.ProcessContext != nil {
+		namespace, _ = params.ProcessContext.GetData(model.ContextNamespace).(string)
+	}
+	if params.KubeClient == nil || namespace == "" {
+		return nil, nil, errors.New("failed to resolve the secret references: kube client or namespace not found")
+	}
+	obj, err := decodeJSON(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &secretResolver{
+		cli:          params.KubeClient,
+		impersonated: params.Impersonated,
+		namespace:    namespace,
+		secrets:      map[string]*corev1.Secret{},
+		resolved:     map[string]string{},
+	}
+	if obj, err = r.resolve(ctx, obj); err != nil {
+		return nil, nil, err
+	}
+	if data, err = json.Marshal(obj); err != nil {
+		return nil, nil, err
+	}
+	return data, r.resolved, nil
+}
+
+type secretResolver struct {
+	cli          client.Client
+	impersonated bool
+	namespace    string
+	secrets      map[string]*corev1.Secret
+	resolved     map[string]string
+}
+
+func (r *secretResolver) resolve(ctx context.Context, obj any) (any, error) {
+	var err error
+	switch o := obj.(type) {
+	case map[string]any:
+		for k, v := range o {
+			if o[k], err = r.resolve(ctx, v); err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		for i, v := range o {
+			if o[i], err = r.resolve(ctx, v); err != nil {
+				return nil, err
+			}
+		}
+	case string:
+		return r.resolveString(ctx, o)
+	}
+	return obj, nil
+}
+
+func (r *secretResolver) resolveString(ctx context.Context, s string) (string, error) {
+	if !secretRefExpression.MatchString(s) {
+		return s, nil
+	}
+	var resolveErr error
+	resolved := secretRefExpression.ReplaceAllStringFunc(s, func(ref string) string {
+		if resolveErr != nil {
+			return ref
+		}
+		v, err := r.secretValue(ctx, ref)
+		if err != nil {
+			resolveErr = err
+			return ref
+		}
+		if v != "" {
+			r.resolved[v] = ref
+		}
+		return v
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	r.resolved[resolved] = s
+	return resolved, nil
+}
+
+func (r *secretResolver) secretValue(ctx context.Context, ref string) (string, error) {
+	matches := secretRefExpression.FindStringSubmatch(ref)
+	name, key := matches[1], matches[3]
+	secret, ok := r.secrets[name]
+	if !ok {
+		secret = &corev1.Secret{}
+		if err := r.cli.Get(ctx, client.ObjectKey{Namespace: r.namespace, Name: name}, secret); err != nil {
+			return "", fmt.Errorf("failed to resolve the secret reference %s: %w", ref, err)
+		}
+		r.secrets[name] = secret
+	}
+	// the controller can read any secret, so the secrets that the user is not allowed to read can't be referenced
+	if !r.impersonated && secret.Labels[types.LabelSecretRef] != "true" {
+		return "", NewProviderError(types.StatusReasonParameter, fmt.Errorf("failed to resolve the secret reference %s: secret %s is not labeled with %s=true", ref, name, types.LabelSecretRef))
+	}
+	v, ok := secret.Data[key]
+	if !ok {
+		return "", NewProviderError(types.StatusReasonParameter, fmt.Errorf("failed to resolve the secret reference %s: key %s not found in secret %s", ref, key, name))
+	}
+	return string(v), nil
+}
+
+// redactSecretRefs replaces the string values that equal the resolved strings or secret values in what the provider
+// returns with their references, the keys and the other values are kept as they are
+func redactSecretRefs(obj any, resolved map[string]string) any {
+	switch o := obj.(type) {
+	case map[string]any:
+		for k, v := range o {
+			o[k] = redactSecretRefs(v, resolved)
+		}
+	case []any:
+		for i, v := range o {
+			o[i] = redactSecretRefs(v, resolved)
+		}
+	case string:
+		if ref, ok := resolved[o]; ok {
+			return ref
+		}
+	}
+	return obj
+}
+
+// decodeJSON decodes the JSON with the numbers kept as they are
+func decodeJSON(data []byte) (any, error) {
+	var obj any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// redactSecretRefsInError replaces the resolved strings and secret values in the error of the provider with their
+// references, the longer ones first, and the reason of the provider error is kept
+func redactSecretRefsInError(err error, resolved map[string]string) error {
+	if err == nil || len(resolved) == 0 {
+		return err
+	}
+	values := make([]string, 0, len(resolved))
+	for v := range resolved {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	message := err.Error()
+	for _, v := range values {
+		if v != "" {
+			message = strings.ReplaceAll(message, v, resolved[v])
+		}
+	}
+	if message == err.Error() {
+		return err
+	}
+	if reason := ReasonOf(err); reason != "" {
+		return NewProviderError(reason, errors.New(message))
+	}
+	return errors.New(message)
+}
+
+// fillReturns fills what the provider returns back into the value, the resolved values are redacted
+func fillReturns(value cue.Value, ret any, resolved map[string]string) (cue.Value, error) {
+	if len(resolved) == 0 {
+		return value.FillPath(cue.ParsePath(""), ret), nil
+	}
+	b, err := json.Marshal(ret)
+	if err != nil {
+		return value, err
+	}
+	obj, err := decodeJSON(b)
+	if err != nil {
+		return value, err
+	}
+	if b, err = json.Marshal(redactSecretRefs(obj, resolved)); err != nil {
+		return value, err
+	}
+	return value.FillPath(cue.ParsePath(""), value.Context().CompileBytes(b)), nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cuexruntime "github.com/kubevela/pkg/cue/cuex/runtime"
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/process"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+type echoArgs struct {
+	URL string `json:"url"`
+}
+
+type echoReturns struct {
+	Returns struct {
+		URL   string `json:"url"`
+		Count string `json:"count,omitempty"`
+	} `json:"$returns"`
+}
+
+func TestSecretRefs(t *testing.T) {
+	r := require.New(t)
+	labels := map[string]string{types.LabelSecretRef: "true"}
+	cli := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Labels: labels},
+		Data:       map[string][]byte{"password": []byte(`p@ss"word`), "tls.crt": []byte("cert"), "pin": []byte("1")},
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("t0ken")},
+	}).Build()
+	singleton.KubeClient.Set(cli)
+	wfCtx, err := wfContext.NewContext(context.Background(), "default", "test-secret-refs", nil)
+	r.NoError(err)
+	ctx := WithRuntimeParams(WithKubeClient(context.Background(), cli), RuntimeParams{
+		WorkflowContext: wfCtx,
+		ProcessContext:  process.NewContext(process.ContextData{Namespace: "default"}),
+	})
+	ctx = WithProviderTrace(ctx, NewProviderRecorder())
+
+	var received string
+	fn := TraceProviders("test", map[string]cuexruntime.ProviderFn{
+		"echo": GenericProviderFn[echoArgs, echoReturns](func(_ context.Context, params *Params[echoArgs]) (*echoReturns, error) {
+			received = params.Params.URL
+			ret := &echoReturns{}
+			ret.Returns.URL = params.Params.URL
+			if params.Params.URL == "1" {
+				ret.Returns.Count = "10"
+			}
+			return ret, nil
+		}),
+		"fail": GenericProviderFn[echoArgs, echoReturns](func(_ context.Context, params *Params[echoArgs]) (*echoReturns, error) {
+			return nil, NewProviderError(types.StatusReasonExecute, fmt.Errorf("failed to connect to %s", params.Params.URL))
+		}),
+	})
+	cueCtx := cuecontext.New()
+	ref := "postgres://admin:{{ secret.db.password }}@db/{{secret.db.tls.crt}}"
+
+	v, err := fn["echo"].Call(ctx, cueCtx.CompileString(fmt.Sprintf(`$params: url: %q`, ref)))
+	r.NoError(err)
+	r.Equal(`postgres://admin:p@ss"word@db/cert`, received)
+	returned, err := v.LookupPath(cue.ParsePath("$returns.url")).String()
+	r.NoError(err)
+	r.Equal(ref, returned)
+	calls, err := LoadProviderCalls(wfCtx)
+	r.NoError(err)
+	r.Len(calls, 1)
+	r.NotContains(string(calls[0].Params), "p@ss")
+	r.NotContains(string(calls[0].Returns), "p@ss")
+	r.Contains(string(calls[0].Returns), "{{ secret.db.password }}")
+
+	// only the string values that equal the resolved values are redacted
+	v, err = fn["echo"].Call(ctx, cueCtx.CompileString(`$params: url: "{{ secret.db.pin }}"`))
+	r.NoError(err)
+	returned, err = v.LookupPath(cue.ParsePath("$returns.url")).String()
+	r.NoError(err)
+	r.Equal("{{ secret.db.pin }}", returned)
+	count, err := v.LookupPath(cue.ParsePath("$returns.count")).String()
+	r.NoError(err)
+	r.Equal("10", count)
+
+	_, err = fn["fail"].Call(ctx, cueCtx.CompileString(`$params: url: "{{ secret.db.password }}"`))
+	r.Error(err)
+	r.Equal("failed to connect to {{ secret.db.password }}", err.Error())
+	r.Equal(types.StatusReasonExecute, ReasonOf(err))
+
+	_, err = fn["echo"].Call(ctx, cueCtx.CompileString(`$params: url: "{{ secret.db.token }}"`))
+	r.Error(err)
+	r.Contains(err.Error(), "key token not found in secret db")
+	r.Equal(types.StatusReasonParameter, ReasonOf(err))
+
+	_, err = fn["echo"].Call(ctx, cueCtx.CompileString(`$params: url: "{{ secret.private.token }}"`))
+	r.Error(err)
+	r.Contains(err.Error(), "secret private is not labeled with workflow.oam.dev/secret-ref=true")
+	r.Equal(types.StatusReasonParameter, ReasonOf(err))
+
+	// the client of the service account of the step is authorized by the RBAC of the service account
+	impersonated := WithRuntimeParams(WithImpersonatedClient(context.Background(), cli, "deployer"), RuntimeParams{
+		WorkflowContext: wfCtx,
+		ProcessContext:  process.NewContext(process.ContextData{Namespace: "default"}),
+	})
+	_, err = fn["echo"].Call(impersonated, cueCtx.CompileString(`$params: url: "{{ secret.private.token }}"`))
+	r.NoError(err)
+	r.Equal("t0ken", received)
+
+	_, err = fn["echo"].Call(ctx, cueCtx.CompileString(`$params: url: "{{ secret.missing.password }}"`))
+	r.Error(err)
+	r.Contains(err.Error(), "failed to resolve the secret reference {{ secret.missing.password }}")
+	r.Equal("", ReasonOf(err))
+}
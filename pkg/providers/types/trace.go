@@ -0,0 +1,228 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cuelang.org/go/cue"
+	cuexruntime "github.com/kubevela/pkg/cue/cuex/runtime"
+	"k8s.io/klog/v2"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// ProviderCall is a recorded call of the provider
+type ProviderCall struct {
+	Provider string          `json:"provider"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Returns  json.RawMessage `json:"returns,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// ProviderTrace records the calls of the providers, or replays the recorded calls instead of calling the providers
+type ProviderTrace struct {
+	mu       sync.Mutex
+	replay   bool
+	calls    []ProviderCall
+	replayed []bool
+}
+
+// NewProviderRecorder creates a provider trace that records the calls of the providers
+func NewProviderRecorder() *ProviderTrace {
+	return &ProviderTrace{}
+}
+
+// NewProviderReplayer creates a provider trace that replays the recorded calls
+func NewProviderReplayer(calls []ProviderCall) *ProviderTrace {
+	return &ProviderTrace{replay: true, calls: calls, replayed: make([]bool, len(calls))}
+}
+
+// Calls returns the recorded calls of the trace
+func (t *ProviderTrace) Calls() []ProviderCall {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]ProviderCall{}, t.calls...)
+}
+
+// record records the call unless the trace reaches MaxProviderTraceCalls, the first calls are kept so that the
+// replay from the start of the run is not changed by the calls dropped later
+func (t *ProviderTrace) record(call ProviderCall) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if traceFull(len(t.calls)) {
+		return
+	}
+	t.calls = append(t.calls, call)
+}
+
+func traceFull(size int) bool {
+	return types.MaxProviderTraceCalls > 0 && size >= types.MaxProviderTraceCalls
+}
+
+// next returns the first call that is not replayed with the same provider and params,
+// or the first call that is not replayed with the same provider if the params are changed
+func (t *ProviderTrace) next(provider string, params []byte) (ProviderCall, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	index := -1
+	for i, call := range t.calls {
+		if t.replayed[i] || call.Provider != provider {
+			continue
+		}
+		if bytes.Equal(call.Params, params) {
+			index = i
+			break
+		}
+		if index < 0 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return ProviderCall{}, false
+	}
+	t.replayed[index] = true
+	return t.calls[index], true
+}
+
+// WithProviderTrace returns a copy of parent in which the provider trace is set
+func WithProviderTrace(parent context.Context, trace *ProviderTrace) context.Context {
+	return context.WithValue(parent, ProviderTraceKey, trace)
+}
+
+// ProviderTraceFrom returns the provider trace stored in ctx, if any.
+func ProviderTraceFrom(ctx context.Context) *ProviderTrace {
+	if trace, ok := ctx.Value(ProviderTraceKey).(*ProviderTrace); ok {
+		return trace
+	}
+	return nil
+}
+
+// LoadProviderCalls loads the recorded calls of the providers from the workflow context
+func LoadProviderCalls(wfCtx wfContext.Context) ([]ProviderCall, error) {
+	var calls []ProviderCall
+	s := wfCtx.GetMutableValue(types.ContextKeyProviderTrace)
+	if s == "" {
+		return calls, nil
+	}
+	if err := json.Unmarshal([]byte(s), &calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// saveProviderCall saves the call in the workflow context unless the saved calls reach MaxProviderTraceCalls
+func saveProviderCall(wfCtx wfContext.Context, call ProviderCall) error {
+	calls, err := LoadProviderCalls(wfCtx)
+	if err != nil {
+		return err
+	}
+	if traceFull(len(calls)) {
+		return nil
+	}
+	b, err := json.Marshal(append(calls, call))
+	if err != nil {
+		return err
+	}
+	wfCtx.SetMutableValue(string(b), types.ContextKeyProviderTrace)
+	return nil
+}
+
+// RedactedProviderFn is the provider function that redacts the sensitive data of its calls before they're recorded
+// by the provider trace, e.g. the sensitive values returned by the provider
+type RedactedProviderFn struct {
+	cuexruntime.ProviderFn
+	Redact func(call ProviderCall) ProviderCall
+}
+
+// TraceableProviderFn is the provider function that can be recorded or replayed by the provider trace in context
+type TraceableProviderFn struct {
+	Name string
+	Fn   cuexruntime.ProviderFn
+}
+
+// Call calls the provider function if there is no provider trace in context,
+// otherwise records the call or returns the recorded result of the call
+func (fn *TraceableProviderFn) Call(ctx context.Context, value cue.Value) (cue.Value, error) {
+	trace := ProviderTraceFrom(ctx)
+	if trace == nil {
+		return fn.Fn.Call(ctx, value)
+	}
+	params := marshalProviderValue(value, "$params")
+	if trace.replay {
+		call, ok := trace.next(fn.Name, params)
+		if !ok {
+			return value, fmt.Errorf("no recorded call of provider %s to replay", fn.Name)
+		}
+		if call.Error != "" {
+			return value, errors.New(call.Error)
+		}
+		return value.FillPath(cue.ParsePath(""), value.Context().CompileBytes(call.Returns)), nil
+	}
+	ret, err := fn.Fn.Call(ctx, value)
+	call := ProviderCall{Provider: fn.Name, Params: params}
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Returns = marshalProviderValue(ret, "")
+	}
+	if redacted, ok := fn.Fn.(*RedactedProviderFn); ok {
+		call = redacted.Redact(call)
+	}
+	trace.record(call)
+	// the trace is best-effort, failing to save it should not fail the call that has been done
+	if wfCtx := RuntimeParamsFrom(ctx).WorkflowContext; wfCtx != nil {
+		if saveErr := saveProviderCall(wfCtx, call); saveErr != nil {
+			klog.ErrorS(saveErr, "failed to save the provider call in the trace", "provider", fn.Name)
+		}
+	}
+	return ret, err
+}
+
+// marshalProviderValue marshals the value at path, falls back to the whole value if the path does not exist,
+// the incomplete fields will be dropped since they can not be replayed
+func marshalProviderValue(value cue.Value, path string) json.RawMessage {
+	if path != "" {
+		if v := value.LookupPath(cue.ParsePath(path)); v.Exists() {
+			value = v
+		}
+	}
+	if b, err := value.MarshalJSON(); err == nil {
+		return b
+	}
+	if v := value.LookupPath(cue.ParsePath("$returns")); v.Exists() {
+		if b, err := v.MarshalJSON(); err == nil {
+			return json.RawMessage(fmt.Sprintf(`{"$returns":%s}`, b))
+		}
+	}
+	return nil
+}
+
+// TraceProviders wraps the provider functions of the package to be traceable
+func TraceProviders(pkg string, providers map[string]cuexruntime.ProviderFn) map[string]cuexruntime.ProviderFn {
+	traceable := make(map[string]cuexruntime.ProviderFn, len(providers))
+	for name, fn := range providers {
+		traceable[name] = &TraceableProviderFn{Name: pkg + "." + name, Fn: fn}
+	}
+	return traceable
+}
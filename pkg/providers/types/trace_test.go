@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cuexruntime "github.com/kubevela/pkg/cue/cuex/runtime"
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+type counterArgs struct {
+	Name string `json:"name"`
+}
+
+type counterReturns struct {
+	Returns string `json:"$returns"`
+}
+
+func TestProviderTrace(t *testing.T) {
+	r := require.New(t)
+	singleton.KubeClient.Set(fake.NewClientBuilder().Build())
+	count := 0
+	fns := TraceProviders("test", map[string]cuexruntime.ProviderFn{
+		"count": GenericProviderFn[counterArgs, counterReturns](func(_ context.Context, params *Params[counterArgs]) (*counterReturns, error) {
+			count++
+			if params.Params.Name == "" {
+				return nil, fmt.Errorf("empty name")
+			}
+			return &counterReturns{Returns: fmt.Sprintf("%s-%d", params.Params.Name, count)}, nil
+		}),
+	})
+	fn := fns["count"]
+	cueCtx := cuecontext.New()
+	call := func(ctx context.Context, name string) (string, error) {
+		v, err := fn.Call(ctx, cueCtx.CompileString(fmt.Sprintf(`$params: name: %q`, name)))
+		if err != nil {
+			return "", err
+		}
+		return v.LookupPath(cue.ParsePath("$returns")).String()
+	}
+
+	wfCtx := new(wfContext.WorkflowContext)
+	r.NoError(wfCtx.LoadFromConfigMap(context.Background(), corev1.ConfigMap{Data: map[string]string{}}))
+	recorder := NewProviderRecorder()
+	ctx := WithRuntimeParams(WithProviderTrace(context.Background(), recorder), RuntimeParams{WorkflowContext: wfCtx})
+	s, err := call(ctx, "a")
+	r.NoError(err)
+	r.Equal("a-1", s)
+	s, err = call(ctx, "b")
+	r.NoError(err)
+	r.Equal("b-2", s)
+	_, err = call(ctx, "")
+	r.Equal("empty name", err.Error())
+	r.Equal(3, len(recorder.Calls()))
+	r.Equal("test.count", recorder.Calls()[0].Provider)
+	r.Equal(3, count)
+
+	calls, err := LoadProviderCalls(wfCtx)
+	r.NoError(err)
+	r.Equal(recorder.Calls(), calls)
+
+	ctx = WithProviderTrace(context.Background(), NewProviderReplayer(calls))
+	s, err = call(ctx, "b")
+	r.NoError(err)
+	r.Equal("b-2", s)
+	s, err = call(ctx, "a")
+	r.NoError(err)
+	r.Equal("a-1", s)
+	_, err = call(ctx, "changed")
+	r.Equal("empty name", err.Error())
+	_, err = call(ctx, "a")
+	r.Equal("no recorded call of provider test.count to replay", err.Error())
+	r.Equal(3, count)
+
+	s, err = call(context.Background(), "a")
+	r.NoError(err)
+	r.Equal("a-4", s)
+}
+
+func TestProviderTraceBounded(t *testing.T) {
+	r := require.New(t)
+	singleton.KubeClient.Set(fake.NewClientBuilder().Build())
+	defer func(max int) { types.MaxProviderTraceCalls = max }(types.MaxProviderTraceCalls)
+	types.MaxProviderTraceCalls = 2
+	fn := TraceProviders("test", map[string]cuexruntime.ProviderFn{
+		"echo": GenericProviderFn[counterArgs, counterReturns](func(_ context.Context, params *Params[counterArgs]) (*counterReturns, error) {
+			return &counterReturns{Returns: params.Params.Name}, nil
+		}),
+	})["echo"]
+	cueCtx := cuecontext.New()
+
+	wfCtx := new(wfContext.WorkflowContext)
+	r.NoError(wfCtx.LoadFromConfigMap(context.Background(), corev1.ConfigMap{Data: map[string]string{}}))
+	recorder := NewProviderRecorder()
+	ctx := WithRuntimeParams(WithProviderTrace(context.Background(), recorder), RuntimeParams{WorkflowContext: wfCtx})
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := fn.Call(ctx, cueCtx.CompileString(fmt.Sprintf(`$params: name: %q`, name)))
+		r.NoError(err)
+	}
+	r.Equal(2, len(recorder.Calls()))
+	calls, err := LoadProviderCalls(wfCtx)
+	r.NoError(err)
+	r.Equal(recorder.Calls(), calls)
+	r.Equal(`{"name":"b"}`, string(calls[1].Params))
+
+	// the call is not failed by the trace that can not be saved
+	wfCtx.SetMutableValue("invalid", types.ContextKeyProviderTrace)
+	v, err := fn.Call(WithRuntimeParams(WithProviderTrace(context.Background(), NewProviderRecorder()), RuntimeParams{WorkflowContext: wfCtx}),
+		cueCtx.CompileString(`$params: name: "d"`))
+	r.NoError(err)
+	s, err := v.LookupPath(cue.ParsePath("$returns")).String()
+	r.NoError(err)
+	r.Equal("d", s)
+}
@@ -18,15 +18,25 @@ package types
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"cuelang.org/go/cue"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/clock"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/kubevela/pkg/util/singleton"
 	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
 	"github.com/kubevela/workflow/pkg/cue/process"
+	"github.com/kubevela/workflow/pkg/monitor/metrics"
 	"github.com/kubevela/workflow/pkg/types"
 )
 
@@ -46,6 +56,22 @@ const (
 	KubeHandlersKey ContextKey = "kubeHandlers"
 	// KubeClientKey is the key for kube client.
 	KubeClientKey ContextKey = "kubeClient"
+	// ProviderTraceKey is the key for provider trace.
+	ProviderTraceKey ContextKey = "providerTrace"
+	// ClockKey is the key for clock.
+	ClockKey ContextKey = "clock"
+	// PermissionCheckKey is the key for permission check.
+	PermissionCheckKey ContextKey = "permissionCheck"
+	// ClusterKey is the key for the default cluster of the step.
+	ClusterKey ContextKey = "cluster"
+	// CancelSignalKey is the key for the signal of cancelling the steps.
+	CancelSignalKey ContextKey = "cancelSignal"
+	// RunUIDKey is the key for the uid of the workflow run.
+	RunUIDKey ContextKey = "runUID"
+	// IdempotencyTokenKey is the key for the idempotency token of the step execution.
+	IdempotencyTokenKey ContextKey = "idempotencyToken"
+	// ImpersonatedKey is the key for the service account of the step that the kube client acts as.
+	ImpersonatedKey ContextKey = "impersonated"
 )
 
 // Dispatcher is a client for apply resources.
@@ -60,6 +86,36 @@ type KubeHandlers struct {
 	Delete Deleter
 }
 
+const (
+	// DryRunNone applies the resources
+	DryRunNone = "none"
+	// DryRunServer submits the resources to the API server in the dry run mode, the server validates and defaults
+	// the resources without persisting them
+	DryRunServer = "server"
+	// DryRunClient renders the resources without submitting them
+	DryRunClient = "client"
+)
+
+// ApplyWithDryRun applies the resources by the dispatcher in the dry run mode, the resources are filled with the
+// result of the server in the server mode. The rejection of the server, e.g. the validation error, is wrapped as
+// a ProviderError with the reason StatusReasonDryRun.
+func ApplyWithDryRun(ctx context.Context, apply Dispatcher, cli client.Client, dryRun, cluster, owner string, manifests ...*unstructured.Unstructured) error {
+	switch dryRun {
+	case "", DryRunNone:
+		return apply(ctx, cli, cluster, owner, manifests...)
+	case DryRunClient:
+		return nil
+	case DryRunServer:
+		err := apply(ctx, client.NewDryRunClient(cli), cluster, owner, manifests...)
+		if kerrors.IsInvalid(err) || kerrors.IsBadRequest(err) || kerrors.IsForbidden(err) {
+			return NewProviderError(types.StatusReasonDryRun, fmt.Errorf("dry run is rejected by the server: %w", err))
+		}
+		return err
+	default:
+		return NewProviderError(types.StatusReasonParameter, fmt.Errorf("invalid dryRun %s, must be one of %s, %s or %s", dryRun, DryRunServer, DryRunClient, DryRunNone))
+	}
+}
+
 // RuntimeParams is the runtime parameters of a provider.
 type RuntimeParams struct {
 	WorkflowContext wfContext.Context
@@ -69,6 +125,114 @@ type RuntimeParams struct {
 	Labels          map[string]string
 	KubeHandlers    *KubeHandlers
 	KubeClient      client.Client
+	Clock           types.Clock
+	PermissionCheck bool
+	// Cluster is the default cluster of the step, it's used if the cluster is not set in the parameters
+	Cluster string
+	// IdempotencyToken is the stable token of the execution of the step, it's the same across the retries and the
+	// restarts of the controller in the same attempt of the step. The providers with side effects forward it to
+	// the external systems, e.g. as the Idempotency-Key header, so that the duplicated requests are deduped.
+	IdempotencyToken string
+	// RunUID is the uid of the workflow run, e.g. to own the objects created by the providers
+	RunUID string
+	// Impersonated indicates the kube client acts as the service account of the step instead of the controller
+	Impersonated bool
+	// ServiceAccount is the name of the service account that the kube client acts as if it's impersonated
+	ServiceAccount string
+}
+
+// Now returns the current time of the clock, falls back to the real time if the clock is not set
+func (p RuntimeParams) Now() time.Time {
+	if p.Clock == nil {
+		return clock.RealClock{}.Now()
+	}
+	return p.Clock.Now()
+}
+
+// GetInput returns the value of the variable in the workflow context referenced by the key, e.g. the `from` of
+// the inputs of the step. The error is not a ProviderError, so that the step is retried until the input is available,
+// e.g. it's set by another step later.
+func (p RuntimeParams) GetInput(key string) (cue.Value, error) {
+	if p.WorkflowContext == nil {
+		return cue.Value{}, fmt.Errorf("failed to get the input %s: workflow context not found", key)
+	}
+	v, err := p.WorkflowContext.GetVar(strings.Split(key, ".")...)
+	if err != nil {
+		return cue.Value{}, fmt.Errorf("failed to get the input %s: %w", key, err)
+	}
+	return v, nil
+}
+
+// stepMetricRecordedKey is the key in the memory store of the workflow context for the idempotency token of the
+// attempt that records the metric
+const stepMetricRecordedKey = "step_metric_recorded"
+
+// RecordMetric records the value of the custom metric registered in the allowlist of the controller, e.g. the
+// records processed by the step. The metric is recorded once per attempt of the step by the field, so that the
+// re-evaluations of the step in the same attempt don't count it again. The error is wrapped as a ProviderError
+// with the reason StatusReasonParameter.
+func (p RuntimeParams) RecordMetric(name string, value float64, labels map[string]string) error {
+	var recordedKey []string
+	if p.WorkflowContext != nil && p.ProcessContext != nil && p.IdempotencyToken != "" {
+		stepID := fmt.Sprint(p.ProcessContext.GetData(model.ContextStepSessionID))
+		recordedKey = []string{stepMetricRecordedKey, stepID, name, p.FieldLabel}
+		if token, ok := p.WorkflowContext.GetValueInMemory(recordedKey...); ok && token == p.IdempotencyToken {
+			return nil
+		}
+	}
+	if err := metrics.RecordStepMetric(name, value, labels, p.Now()); err != nil {
+		return NewProviderError(types.StatusReasonParameter, fmt.Errorf("failed to record the metric: %w", err))
+	}
+	if recordedKey != nil {
+		p.WorkflowContext.SetValueInMemory(p.IdempotencyToken, recordedKey...)
+	}
+	return nil
+}
+
+// ProviderError is the error returned by the provider with the reason of the failed step. The step fails with
+// StatusReasonExecute and is retried if the provider returns other errors.
+type ProviderError struct {
+	Reason string
+	Err    error
+}
+
+// NewProviderError returns the error of the provider with the reason of the failed step
+func NewProviderError(reason string, err error) error {
+	return &ProviderError{Reason: reason, Err: err}
+}
+
+// Error .
+func (e *ProviderError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap .
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// ReasonOf returns the reason of the provider error, it's empty if the error is not a ProviderError
+func ReasonOf(err error) string {
+	var pErr *ProviderError
+	if errors.As(err, &pErr) {
+		return pErr.Reason
+	}
+	return ""
+}
+
+// DecodeProperties decodes the properties into v, the properties can be any value that can be marshaled into
+// json, e.g. cue.Value or *runtime.RawExtension. The properties that don't match v are invalid, and the error is
+// wrapped as a ProviderError with the reason StatusReasonParameter. The properties that can't be marshaled are
+// retried, e.g. the cue value that is incomplete until its inputs are available.
+func DecodeProperties(properties any, v any) error {
+	bs, err := json.Marshal(properties)
+	if err != nil {
+		return fmt.Errorf("failed to decode the properties: %w", err)
+	}
+	if err = json.Unmarshal(bs, v); err != nil {
+		return NewProviderError(types.StatusReasonParameter, fmt.Errorf("failed to decode the properties: %w", err))
+	}
+	return nil
 }
 
 // Params is the input parameters of a provider.
@@ -77,6 +241,18 @@ type Params[T any] struct {
 	RuntimeParams
 }
 
+// DecodeProperties decodes the parameters of the provider into v. For the native providers, the `$params` of
+// the value is decoded.
+func (p *Params[T]) DecodeProperties(v any) error {
+	var properties any = p.Params
+	if val, ok := properties.(cue.Value); ok {
+		if params := val.LookupPath(cue.ParsePath("$params")); params.Exists() {
+			properties = params
+		}
+	}
+	return DecodeProperties(properties, v)
+}
+
 // Returns is the returns of a provider.
 type Returns[T any] struct {
 	Returns T `json:"$returns"`
@@ -86,7 +262,8 @@ type Returns[T any] struct {
 type GenericProviderFn[T any, U any] func(context.Context, *Params[T]) (*U, error)
 
 // Call marshal value into json and decode into underlying function input
-// parameters, then fill back the returned output value
+// parameters, then fill back the returned output value. The secret references
+// in the parameters are resolved for the function only.
 func (fn GenericProviderFn[T, U]) Call(ctx context.Context, value cue.Value) (cue.Value, error) {
 	type p struct {
 		Params T `json:"$params"`
@@ -96,17 +273,21 @@ func (fn GenericProviderFn[T, U]) Call(ctx context.Context, value cue.Value) (cu
 	if err != nil {
 		return value, err
 	}
-	if err = json.Unmarshal(bs, params); err != nil {
+	runtimeParams := RuntimeParamsFrom(ctx)
+	bs, resolved, err := resolveSecretRefs(ctx, runtimeParams, bs)
+	if err != nil {
 		return value, err
 	}
-	runtimeParams := RuntimeParamsFrom(ctx)
+	if err = json.Unmarshal(bs, params); err != nil {
+		return value, NewProviderError(types.StatusReasonParameter, fmt.Errorf("failed to decode the properties: %w", err))
+	}
 	label, _ := value.Label()
 	runtimeParams.FieldLabel = label
 	ret, err := fn(ctx, &Params[T]{Params: params.Params, RuntimeParams: runtimeParams})
 	if err != nil {
-		return value, err
+		return value, redactSecretRefsInError(err, resolved)
 	}
-	return value.FillPath(cue.ParsePath(""), ret), nil
+	return fillReturns(value, ret, resolved)
 }
 
 // LegacyParams is the legacy input parameters of a provider.
@@ -115,28 +296,38 @@ type LegacyParams[T any] struct {
 	RuntimeParams
 }
 
+// DecodeProperties decodes the parameters of the legacy provider into v
+func (p *LegacyParams[T]) DecodeProperties(v any) error {
+	return DecodeProperties(p.Params, v)
+}
+
 // LegacyGenericProviderFn is the legacy provider function
 type LegacyGenericProviderFn[T any, U any] func(context.Context, *LegacyParams[T]) (*U, error)
 
 // Call marshal value into json and decode into underlying function input
-// parameters, then fill back the returned output value
+// parameters, then fill back the returned output value. The secret references
+// in the parameters are resolved for the function only.
 func (fn LegacyGenericProviderFn[T, U]) Call(ctx context.Context, value cue.Value) (cue.Value, error) {
 	params := new(T)
 	bs, err := value.MarshalJSON()
 	if err != nil {
 		return value, err
 	}
-	if err = json.Unmarshal(bs, params); err != nil {
+	runtimeParams := RuntimeParamsFrom(ctx)
+	bs, resolved, err := resolveSecretRefs(ctx, runtimeParams, bs)
+	if err != nil {
 		return value, err
 	}
-	runtimeParams := RuntimeParamsFrom(ctx)
+	if err = json.Unmarshal(bs, params); err != nil {
+		return value, NewProviderError(types.StatusReasonParameter, fmt.Errorf("failed to decode the properties: %w", err))
+	}
 	label, _ := value.Label()
 	runtimeParams.FieldLabel = label
 	ret, err := fn(ctx, &LegacyParams[T]{Params: *params, RuntimeParams: runtimeParams})
 	if err != nil {
-		return value, err
+		return value, redactSecretRefsInError(err, resolved)
 	}
-	return value.FillPath(cue.ParsePath(""), ret), nil
+	return fillReturns(value, ret, resolved)
 }
 
 // NativeProviderFn is the legacy native provider function
@@ -195,5 +386,96 @@ func RuntimeParamsFrom(ctx context.Context) RuntimeParams {
 	} else {
 		params.KubeClient = singleton.KubeClient.Get()
 	}
+	if c, ok := ctx.Value(ClockKey).(types.Clock); ok {
+		params.Clock = c
+	}
+	if check, ok := ctx.Value(PermissionCheckKey).(bool); ok {
+		params.PermissionCheck = check
+	}
+	if cluster, ok := ctx.Value(ClusterKey).(string); ok {
+		params.Cluster = cluster
+	}
+	if token, ok := ctx.Value(IdempotencyTokenKey).(string); ok {
+		params.IdempotencyToken = token
+	}
+	if uid, ok := ctx.Value(RunUIDKey).(string); ok {
+		params.RunUID = uid
+	}
+	if serviceAccount, ok := ctx.Value(ImpersonatedKey).(string); ok && serviceAccount != "" {
+		params.Impersonated = true
+		params.ServiceAccount = serviceAccount
+	}
 	return params
 }
+
+// WithClock returns a copy of parent in which the clock is set
+func WithClock(parent context.Context, c types.Clock) context.Context {
+	return context.WithValue(parent, ClockKey, c)
+}
+
+// WithCancelSignal returns a copy of parent in which the cancel signal is set, the contexts made by WithCancellation
+// are cancelled once the signal is done, e.g. when the workflow run is terminated
+func WithCancelSignal(parent context.Context, signal context.Context) context.Context {
+	return context.WithValue(parent, CancelSignalKey, signal)
+}
+
+// WithCancellation returns a copy of ctx that is cancelled when ctx is done or the cancel signal stored in ctx is done.
+// The signal is kept apart from ctx so that the steps are cancelled without cancelling the other calls using ctx,
+// e.g. the patches of the workflow run status.
+func WithCancellation(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	signal, ok := ctx.Value(CancelSignalKey).(context.Context)
+	if !ok {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(signal, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// ClockFrom returns the clock stored in ctx, falls back to the real clock if it's not set
+func ClockFrom(ctx context.Context) types.Clock {
+	if c, ok := ctx.Value(ClockKey).(types.Clock); ok {
+		return c
+	}
+	return clock.RealClock{}
+}
+
+// WithCluster returns a copy of parent in which the default cluster of the step is set
+func WithCluster(parent context.Context, cluster string) context.Context {
+	return context.WithValue(parent, ClusterKey, cluster)
+}
+
+// WithRunUID returns a copy of parent in which the uid of the workflow run is set
+func WithRunUID(parent context.Context, uid string) context.Context {
+	return context.WithValue(parent, RunUIDKey, uid)
+}
+
+// WithIdempotencyToken returns a copy of parent in which the idempotency token of the step execution is set, the
+// token is derived from the uid of the run in parent, the id of the step and the attempt of the step
+func WithIdempotencyToken(parent context.Context, stepID string, attempt int) context.Context {
+	uid, _ := parent.Value(RunUIDKey).(string)
+	return context.WithValue(parent, IdempotencyTokenKey, NewIdempotencyToken(uid, stepID, attempt))
+}
+
+// NewIdempotencyToken returns the idempotency token of the attempt of the step in the run, it's the hex of the
+// sha256 of them so that it's stable and doesn't expose the uid of the run
+func NewIdempotencyToken(runUID, stepID string, attempt int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d", runUID, stepID, attempt)))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetCluster returns the cluster in the parameters, falls back to the default cluster of the step if it's not set
+func (p RuntimeParams) GetCluster(cluster string) string {
+	if cluster == "" {
+		return p.Cluster
+	}
+	return cluster
+}
+
+// WithPermissionCheck returns a copy of parent in which the permission check of providers is enabled
+func WithPermissionCheck(parent context.Context) context.Context {
+	return context.WithValue(parent, PermissionCheckKey, true)
+}
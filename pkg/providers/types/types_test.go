@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/kubevela/pkg/util/singleton"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+type testProperties struct {
+	Name     string `json:"name"`
+	Replicas int    `json:"replicas"`
+}
+
+func TestDecodeProperties(t *testing.T) {
+	r := require.New(t)
+	cuectx := cuecontext.New()
+
+	props := testProperties{}
+	native := &Params[cue.Value]{Params: cuectx.CompileString(`$params: {name: "test", replicas: 2}`)}
+	r.NoError(native.DecodeProperties(&props))
+	r.Equal(testProperties{Name: "test", Replicas: 2}, props)
+
+	props = testProperties{}
+	legacy := &LegacyParams[cue.Value]{Params: cuectx.CompileString(`{name: "legacy", replicas: 1}`)}
+	r.NoError(legacy.DecodeProperties(&props))
+	r.Equal(testProperties{Name: "legacy", Replicas: 1}, props)
+
+	props = testProperties{}
+	generic := &Params[map[string]any]{Params: map[string]any{"name": "generic"}}
+	r.NoError(generic.DecodeProperties(&props))
+	r.Equal("generic", props.Name)
+
+	props = testProperties{}
+	r.NoError(DecodeProperties(&runtime.RawExtension{Raw: []byte(`{"replicas":3}`)}, &props))
+	r.Equal(3, props.Replicas)
+
+	err := DecodeProperties(&runtime.RawExtension{Raw: []byte(`{"replicas":"3"}`)}, &props)
+	r.Error(err)
+	r.Contains(err.Error(), "failed to decode the properties")
+	r.Equal(types.StatusReasonParameter, ReasonOf(err))
+	r.Equal("", ReasonOf(errors.New("mock error")))
+
+	// the incomplete properties are retried
+	err = DecodeProperties(cuectx.CompileString(`{name: string}`), &props)
+	r.Error(err)
+	r.Equal("", ReasonOf(err))
+}
+
+func TestGetInput(t *testing.T) {
+	r := require.New(t)
+	singleton.KubeClient.Set(fake.NewClientBuilder().Build())
+	wfCtx, err := wfContext.NewContext(context.Background(), "default", "test-get-input", nil)
+	r.NoError(err)
+	r.NoError(wfCtx.SetVar(cuecontext.New().CompileString(`"1.1.1.1"`), "pod", "ip"))
+	params := RuntimeParams{WorkflowContext: wfCtx}
+
+	v, err := params.GetInput("pod.ip")
+	r.NoError(err)
+	s, err := v.String()
+	r.NoError(err)
+	r.Equal("1.1.1.1", s)
+
+	_, err = params.GetInput("pod.name")
+	r.Error(err)
+	r.Contains(err.Error(), "failed to get the input pod.name")
+	// the input may be available later, so that the step is retried
+	r.Equal("", ReasonOf(err))
+
+	_, err = RuntimeParams{}.GetInput("pod.ip")
+	r.Error(err)
+	r.Equal("", ReasonOf(err))
+}
+
+func TestIdempotencyToken(t *testing.T) {
+	r := require.New(t)
+	ctx := WithIdempotencyToken(WithRunUID(context.Background(), "run-uid"), "step-id", 0)
+	token := RuntimeParamsFrom(ctx).IdempotencyToken
+	r.Equal(NewIdempotencyToken("run-uid", "step-id", 0), token)
+	r.Len(token, 64)
+	// the token is the same for the same execution of the step
+	r.Equal(token, RuntimeParamsFrom(WithIdempotencyToken(WithRunUID(context.Background(), "run-uid"), "step-id", 0)).IdempotencyToken)
+	r.NotEqual(token, NewIdempotencyToken("run-uid", "step-id", 1))
+	r.NotEqual(token, NewIdempotencyToken("another-uid", "step-id", 0))
+	r.NotEqual(token, NewIdempotencyToken("run-uid", "another-id", 0))
+	r.Equal("", RuntimeParamsFrom(context.Background()).IdempotencyToken)
+}
@@ -18,20 +18,31 @@ package builtin
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"cuelang.org/go/cue"
 	monitorContext "github.com/kubevela/pkg/monitor/context"
+	"github.com/kubevela/pkg/util/rand"
 	"github.com/kubevela/pkg/util/slices"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/cue/process"
+	"github.com/kubevela/workflow/pkg/hooks"
 	"github.com/kubevela/workflow/pkg/providers"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/tasks/custom"
 	"github.com/kubevela/workflow/pkg/types"
 )
 
+// DefaultGeneratorParameterKey is the default key of the properties to fill the item in for the generated sub steps
+const DefaultGeneratorParameterKey = "item"
+
 // StepGroup is the step group runner
 func StepGroup(step v1alpha1.WorkflowStep, opt *types.TaskGeneratorOptions) (types.TaskRunner, error) {
 	return &stepGroupTaskRunner{
@@ -41,6 +52,8 @@ func StepGroup(step v1alpha1.WorkflowStep, opt *types.TaskGeneratorOptions) (typ
 		subTaskRunners: opt.SubTaskRunners,
 		mode:           opt.SubStepExecuteMode,
 		pCtx:           opt.ProcessContext,
+		lockPeers:      opt.LockPeers,
+		subTaskGen:     opt.SubTaskGenerator,
 	}, nil
 }
 
@@ -51,6 +64,8 @@ type stepGroupTaskRunner struct {
 	subTaskRunners []types.TaskRunner
 	pCtx           process.Context
 	mode           v1alpha1.WorkflowMode
+	lockPeers      func() []string
+	subTaskGen     func(step v1alpha1.WorkflowStepBase, id string) (types.TaskRunner, error)
 }
 
 // Name return suspend step name.
@@ -63,7 +78,37 @@ func (tr *stepGroupTaskRunner) Pending(ctx monitorContext.Context, wfCtx wfConte
 	resetter := tr.FillContextData(ctx, tr.pCtx)
 	defer resetter(tr.pCtx)
 	basicVal, _ := custom.MakeBasicValue(ctx, providers.DefaultCompiler.Get(), nil, tr.pCtx)
-	return custom.CheckPending(wfCtx, tr.step, tr.id, stepStatus, basicVal)
+	var lockPeers []string
+	if tr.lockPeers != nil {
+		lockPeers = tr.lockPeers()
+	}
+	if pending, status := custom.CheckPending(wfCtx, tr.step, tr.id, lockPeers, stepStatus, basicVal, providertypes.ClockFrom(ctx.GetContext()).Now()); pending {
+		return pending, status
+	}
+	if g := tr.step.Generator; g != nil && !hooks.IsOutputPruned(wfCtx, g.From) {
+		if _, err := wfCtx.GetVar(strings.Split(g.From, ".")...); err != nil {
+			return true, v1alpha1.StepStatus{
+				Phase:   v1alpha1.WorkflowStepPhasePending,
+				Type:    tr.step.Type,
+				ID:      tr.id,
+				Name:    tr.name,
+				Message: fmt.Sprintf("Pending on Generator: %s", g.From),
+			}
+		}
+	}
+	return false, v1alpha1.StepStatus{}
+}
+
+// RenderTemplates renders the templates of the sub steps without running the providers, the generated sub steps are
+// rendered once they run.
+func (tr *stepGroupTaskRunner) RenderTemplates(ctx monitorContext.Context, wfCtx wfContext.Context) []cue.Value {
+	var templates []cue.Value
+	for _, sub := range tr.subTaskRunners {
+		if renderer, ok := sub.(types.TaskTemplateRenderer); ok {
+			templates = append(templates, renderer.RenderTemplates(ctx, wfCtx)...)
+		}
+	}
+	return templates
 }
 
 // Run make workflow step group.
@@ -112,16 +157,46 @@ func (tr *stepGroupTaskRunner) Run(ctx wfContext.Context, options *types.TaskRun
 			options.StepStatus[tr.step.Name] = status
 		}
 	}
+	// the group is failed rather than skipped if its precondition is not met
+	if status.Phase == "" {
+		if met, message := custom.CheckPreCondition(ctx, tr.step, options.StepStatus, basicVal); !met {
+			status.Phase = v1alpha1.WorkflowStepPhaseFailed
+			status.Reason = types.StatusReasonPreconditionFailed
+			status.Message = message
+			return status, &types.Operation{Terminated: true}, nil
+		}
+	}
 	// step-group has no properties so there is no need to fill in the properties with the input values
 	// skip input handle here
 	e := options.Engine
-	if len(tr.subTaskRunners) > 0 {
+	step := tr.step
+	subTaskRunners := tr.subTaskRunners
+	if step.Generator != nil && status.Phase != v1alpha1.WorkflowStepPhaseSkipped {
+		if step.SubSteps, err = generateSubSteps(ctx, step); err == nil {
+			subTaskRunners, err = tr.generateSubTaskRunners(step.SubSteps, e.GetStepStatus(tr.name))
+		}
+		if err != nil {
+			status.Phase = v1alpha1.WorkflowStepPhaseFailed
+			status.Reason = types.StatusReasonGenerate
+			status.Message = fmt.Sprintf("generate sub steps error: %s", err.Error())
+			return status, &types.Operation{Terminated: true}, nil
+		}
+	}
+	if step.Switch != nil && status.Phase != v1alpha1.WorkflowStepPhaseSkipped {
+		if subTaskRunners, err = tr.switchSubTaskRunners(ctx, options.StepStatus, basicVal, e.GetStepStatus(tr.name), pStatus); err != nil {
+			status.Phase = v1alpha1.WorkflowStepPhaseFailed
+			status.Reason = types.StatusReasonSwitch
+			status.Message = fmt.Sprintf("switch error: %s", err.Error())
+			return status, &types.Operation{Terminated: true}, nil
+		}
+	}
+	if len(subTaskRunners) > 0 {
 		e.SetParentRunner(tr.name)
 		dag := true
 		if tr.mode == v1alpha1.WorkflowModeStep {
 			dag = false
 		}
-		if err := e.Run(tracer, tr.subTaskRunners, dag); err != nil {
+		if err := e.Run(tracer, subTaskRunners, dag); err != nil {
 			return v1alpha1.StepStatus{
 				ID:    tr.id,
 				Name:  tr.name,
@@ -133,11 +208,226 @@ func (tr *stepGroupTaskRunner) Run(ctx wfContext.Context, options *types.TaskRun
 	}
 
 	stepStatus := e.GetStepStatus(tr.name)
-	status, operations = getStepGroupStatus(status, stepStatus, e.GetOperation(), len(tr.subTaskRunners))
+	var tolerance *intstr.IntOrString
+	if step.Generator != nil {
+		tolerance = step.Generator.Tolerance
+	}
+	status, operations = getStepGroupStatus(status, stepStatus, e.GetOperation(), len(subTaskRunners), tolerance)
+	if step.Atomic {
+		tr.rollbackAtomicGroup(tracer, ctx, pStatus, stepStatus)
+	}
+	if step.Switch != nil && status.Phase == v1alpha1.WorkflowStepPhaseSucceeded {
+		ctx.DeleteMutableValue(types.ContextPrefixSwitchValue, tr.id)
+	}
+	if (len(step.SubSteps) > 0 || step.Generator != nil) && types.IsStepFinish(status.Phase, status.Reason) {
+		if err := hooks.SetStepGroupResults(ctx, basicVal.Context(), step, stepStatus); err != nil {
+			status.Phase = v1alpha1.WorkflowStepPhaseFailed
+			status.Reason = types.StatusReasonOutput
+			status.Message = fmt.Sprintf("output error: %s", err.Error())
+			operations.Terminated = true
+		}
+	}
 
 	return status, operations, nil
 }
 
+// rollbackAtomicGroup rolls back the resources applied by the sub steps once the atomic group fails and its failed
+// sub steps stop retrying, the captured state of the resources is cleared once the group succeeds
+func (tr *stepGroupTaskRunner) rollbackAtomicGroup(ctx monitorContext.Context, wfCtx wfContext.Context, status *v1alpha1.StepStatus, groupStatus v1alpha1.WorkflowStepStatus) {
+	switch {
+	case status.Phase == v1alpha1.WorkflowStepPhaseSucceeded:
+		providertypes.ClearRollbackState(wfCtx, tr.id)
+		return
+	case status.Phase != v1alpha1.WorkflowStepPhaseFailed:
+		return
+	case status.Reason != types.StatusReasonTimeout && isRetrying(groupStatus):
+		return
+	}
+	// the resources are rolled back only once, the result is kept in the next executions of the group
+	status.Rollback = groupStatus.Rollback
+	rollback, err := providertypes.RollbackResources(ctx.GetContext(), providertypes.RuntimeParamsFrom(ctx.GetContext()).KubeClient, wfCtx, tr.id)
+	if err != nil {
+		ctx.Error(err, "roll back the atomic step group")
+		status.Message = fmt.Sprintf("rollback error: %s", err.Error())
+		return
+	}
+	if rollback == nil {
+		return
+	}
+	status.Rollback = rollback
+	failed := 0
+	for _, resource := range rollback.Resources {
+		if resource.Error != "" {
+			failed++
+		}
+	}
+	message := fmt.Sprintf("Rolled back %d applied resources", len(rollback.Resources))
+	if failed > 0 {
+		message = fmt.Sprintf("Failed to roll back %d of %d applied resources", failed, len(rollback.Resources))
+	}
+	if status.Message != "" {
+		message = status.Message + "; " + message
+	}
+	status.Message = message
+}
+
+// isRetrying returns true if any failed sub step of the group is still retrying
+func isRetrying(groupStatus v1alpha1.WorkflowStepStatus) bool {
+	for _, sub := range groupStatus.SubStepsStatus {
+		if sub.Phase == v1alpha1.WorkflowStepPhaseFailed && (sub.Reason == "" || sub.Reason == types.StatusReasonExecute) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateSubTaskRunners generates the runners of the generated sub steps, the ids of the sub steps that have been
+// executed are kept
+func (tr *stepGroupTaskRunner) generateSubTaskRunners(subSteps []v1alpha1.WorkflowStepBase, groupStatus v1alpha1.WorkflowStepStatus) ([]types.TaskRunner, error) {
+	if tr.subTaskGen == nil {
+		return nil, fmt.Errorf("the sub steps of step group %s can not be generated", tr.name)
+	}
+	ids := make(map[string]string)
+	for _, sub := range groupStatus.SubStepsStatus {
+		ids[sub.Name] = sub.ID
+	}
+	runners := make([]types.TaskRunner, 0, len(subSteps))
+	for _, sub := range subSteps {
+		id, ok := ids[sub.Name]
+		if !ok {
+			id = rand.RandomString(10)
+		}
+		runner, err := tr.subTaskGen(sub, id)
+		if err != nil {
+			return nil, err
+		}
+		runners = append(runners, runner)
+	}
+	return runners, nil
+}
+
+// switchSubTaskRunners selects the case of the switch by its value, the runners of the sub steps that are not in the
+// selected case are replaced to skip them. The value is evaluated once the group starts and kept in the context, so
+// that the selected case doesn't change while the sub steps are executed even if the inputs of the value change
+func (tr *stepGroupTaskRunner) switchSubTaskRunners(ctx wfContext.Context, stepStatus map[string]v1alpha1.StepStatus, basicVal cue.Value, groupStatus v1alpha1.WorkflowStepStatus, status *v1alpha1.StepStatus) ([]types.TaskRunner, error) {
+	sw := tr.step.Switch
+	var value string
+	if selected := ctx.GetMutableValue(types.ContextPrefixSwitchValue, tr.id); selected == "" || json.Unmarshal([]byte(selected), &value) != nil {
+		var err error
+		if value, err = custom.EvaluateSwitchValue(ctx, tr.step, stepStatus, basicVal); err != nil {
+			return nil, errors.WithMessagef(err, "evaluate the value %s", sw.Value)
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		ctx.SetMutableValue(string(b), types.ContextPrefixSwitchValue, tr.id)
+	}
+	var selected []string
+	matched := false
+	for _, c := range sw.Cases {
+		if c.Value == value {
+			selected, matched = c.Steps, true
+			status.Message = fmt.Sprintf("The case %s is selected", value)
+			break
+		}
+	}
+	if !matched {
+		if sw.Default == nil {
+			return nil, fmt.Errorf("no case matches the value %s and there's no default", value)
+		}
+		selected = sw.Default
+		status.Message = fmt.Sprintf("The default case is selected by the value %s", value)
+	}
+	subStepTypes := make(map[string]string)
+	for _, sub := range tr.step.SubSteps {
+		subStepTypes[sub.Name] = sub.Type
+	}
+	ids := make(map[string]string)
+	for _, sub := range groupStatus.SubStepsStatus {
+		ids[sub.Name] = sub.ID
+	}
+	runners := make([]types.TaskRunner, 0, len(tr.subTaskRunners))
+	for _, runner := range tr.subTaskRunners {
+		if slices.Contains(selected, runner.Name()) {
+			runners = append(runners, runner)
+			continue
+		}
+		id, ok := ids[runner.Name()]
+		if !ok {
+			id = rand.RandomString(10)
+		}
+		runners = append(runners, &skippedTaskRunner{TaskRunner: runner, id: id, typ: subStepTypes[runner.Name()], message: fmt.Sprintf("The sub step is not in the case of the value %s", value)})
+	}
+	return runners, nil
+}
+
+// skippedTaskRunner skips the sub step that is not in the selected case of the switch
+type skippedTaskRunner struct {
+	types.TaskRunner
+	id      string
+	typ     string
+	message string
+}
+
+// Pending returns false since the skipped sub step doesn't wait for its dependencies
+func (r *skippedTaskRunner) Pending(monitorContext.Context, wfContext.Context, map[string]v1alpha1.StepStatus) (bool, v1alpha1.StepStatus) {
+	return false, v1alpha1.StepStatus{}
+}
+
+// Run returns the skipped status without executing the sub step
+func (r *skippedTaskRunner) Run(wfContext.Context, *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error) {
+	return v1alpha1.StepStatus{
+		ID:      r.id,
+		Name:    r.Name(),
+		Type:    r.typ,
+		Phase:   v1alpha1.WorkflowStepPhaseSkipped,
+		Reason:  types.StatusReasonSkip,
+		Message: r.message,
+	}, &types.Operation{Skip: true}, nil
+}
+
+// generateSubSteps generates a sub step from the template for each item of the output array of the generator, the
+// item is filled in the properties of the sub step
+func generateSubSteps(ctx wfContext.Context, step v1alpha1.WorkflowStep) ([]v1alpha1.WorkflowStepBase, error) {
+	g := step.Generator
+	v, err := ctx.GetVar(strings.Split(g.From, ".")...)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "get the items from [%s]", g.From)
+	}
+	iter, err := v.List()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "the items from [%s] is not an array", g.From)
+	}
+	key := g.ParameterKey
+	if key == "" {
+		key = DefaultGeneratorParameterKey
+	}
+	var subSteps []v1alpha1.WorkflowStepBase
+	for i := 0; iter.Next(); i++ {
+		item, err := iter.Value().MarshalJSON()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "marshal the item %d from [%s]", i, g.From)
+		}
+		properties := make(map[string]json.RawMessage)
+		if g.Template.Properties != nil && len(g.Template.Properties.Raw) > 0 {
+			if err := json.Unmarshal(g.Template.Properties.Raw, &properties); err != nil {
+				return nil, errors.WithMessage(err, "unmarshal the properties of the template")
+			}
+		}
+		properties[key] = item
+		raw, err := json.Marshal(properties)
+		if err != nil {
+			return nil, err
+		}
+		sub := *g.Template.DeepCopy()
+		sub.Name = fmt.Sprintf("%s-%d", g.Template.Name, i)
+		sub.Properties = &runtime.RawExtension{Raw: raw}
+		subSteps = append(subSteps, sub)
+	}
+	return subSteps, nil
+}
+
 func (tr *stepGroupTaskRunner) FillContextData(ctx monitorContext.Context, processCtx process.Context) types.ContextDataResetter {
 	metas := []process.StepMetaKV{
 		process.WithName(tr.name),
@@ -145,6 +435,9 @@ func (tr *stepGroupTaskRunner) FillContextData(ctx monitorContext.Context, proce
 		process.WithSpanID(ctx.GetID()),
 		process.WithGroupName(tr.name),
 	}
+	if tr.step.Atomic {
+		metas = append(metas, process.WithAtomicGroup(tr.id))
+	}
 	manager := process.NewStepRunTimeMeta()
 	manager.Fill(processCtx, metas)
 	return func(processCtx process.Context) {
@@ -156,11 +449,24 @@ func (tr *stepGroupTaskRunner) FillContextData(ctx monitorContext.Context, proce
 	}
 }
 
-func getStepGroupStatus(status v1alpha1.StepStatus, stepStatus v1alpha1.WorkflowStepStatus, operation *types.Operation, subTaskRunners int) (v1alpha1.StepStatus, *types.Operation) {
+// getStepGroupStatus aggregates the phase of the group from its sub steps. The failed sub steps within the tolerance
+// don't fail the group, whose failures are not counted by the engine either, so the group stops the run once the
+// failures exceed the tolerance.
+func getStepGroupStatus(status v1alpha1.StepStatus, stepStatus v1alpha1.WorkflowStepStatus, operation *types.Operation, subTaskRunners int, tolerance *intstr.IntOrString) (v1alpha1.StepStatus, *types.Operation) {
 	subStepCounts := make(map[string]int)
+	retrying := 0
 	for _, subStepsStatus := range stepStatus.SubStepsStatus {
 		subStepCounts[string(subStepsStatus.Phase)]++
 		subStepCounts[subStepsStatus.Reason]++
+		if subStepsStatus.Phase == v1alpha1.WorkflowStepPhaseFailed && (subStepsStatus.Reason == "" || subStepsStatus.Reason == types.StatusReasonExecute) {
+			retrying++
+		}
+	}
+	failed := subStepCounts[string(v1alpha1.WorkflowStepPhaseFailed)] - retrying
+	tolerated := 0
+	if tolerance != nil {
+		tolerated, _ = intstr.GetScaledValueFromIntOrPercent(tolerance, subTaskRunners, false)
+		status.FailedSubSteps = failed
 	}
 	switch {
 	case status.Phase == v1alpha1.WorkflowStepPhaseSkipped:
@@ -175,23 +481,45 @@ func getStepGroupStatus(status v1alpha1.StepStatus, stepStatus v1alpha1.Workflow
 		status.Phase = v1alpha1.WorkflowStepPhaseRunning
 	case subStepCounts[string(v1alpha1.WorkflowStepPhasePending)] > 0:
 		status.Phase = v1alpha1.WorkflowStepPhasePending
-	case subStepCounts[string(v1alpha1.WorkflowStepPhaseFailed)] > 0:
+	case retrying > 0 || failed > tolerated:
 		status.Phase = v1alpha1.WorkflowStepPhaseFailed
+		// the group is not finished until its failed sub steps stop retrying, so the next step won't begin
+		// before all the sub steps are finished
+		if retrying > 0 {
+			break
+		}
 		switch {
 		case subStepCounts[types.StatusReasonFailedAfterRetries] > 0:
 			status.Reason = types.StatusReasonFailedAfterRetries
 		case subStepCounts[types.StatusReasonTimeout] > 0:
 			status.Reason = types.StatusReasonTimeout
+		case subStepCounts[types.StatusReasonPreconditionFailed] > 0:
+			status.Reason = types.StatusReasonPreconditionFailed
 		case subStepCounts[types.StatusReasonAction] > 0:
 			status.Reason = types.StatusReasonAction
 		case subStepCounts[types.StatusReasonTerminate] > 0:
 			status.Reason = types.StatusReasonTerminate
 		}
+		if tolerance != nil {
+			status.Message = fmt.Sprintf("%d of %d sub steps are failed, which exceed the tolerance %s", failed, subTaskRunners, tolerance.String())
+			if status.Reason == types.StatusReasonFailedAfterRetries {
+				operation.FailedAfterRetries = true
+			} else {
+				operation.Terminated = true
+			}
+		}
 	case subStepCounts[string(v1alpha1.WorkflowStepPhaseSkipped)] > 0 && subStepCounts[string(v1alpha1.WorkflowStepPhaseSkipped)] == subTaskRunners:
 		status.Phase = v1alpha1.WorkflowStepPhaseSkipped
 		status.Reason = types.StatusReasonSkip
 	default:
 		status.Phase = v1alpha1.WorkflowStepPhaseSucceeded
+		// the group exits the workflow with its sub step
+		if subStepCounts[types.StatusReasonExit] > 0 {
+			status.Reason = types.StatusReasonExit
+		}
+		if failed > 0 {
+			status.Message = fmt.Sprintf("%d of %d sub steps are failed within the tolerance %s", failed, subTaskRunners, tolerance.String())
+		}
 	}
 	return status, operation
 }
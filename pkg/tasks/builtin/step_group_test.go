@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"testing"
 
+	"cuelang.org/go/cue/cuecontext"
+
 	"github.com/kubevela/workflow/pkg/cue/process"
 	"github.com/stretchr/testify/require"
 	"sigs.k8s.io/yaml"
@@ -14,18 +16,26 @@ import (
 	"github.com/kubevela/pkg/util/singleton"
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/types"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 type testEngine struct {
 	stepStatus v1alpha1.WorkflowStepStatus
 	operation  *types.Operation
+	runners    []types.TaskRunner
 }
 
 func (e *testEngine) Run(ctx monitorContext.Context, taskRunners []types.TaskRunner, dag bool) error {
+	e.runners = taskRunners
 	return nil
 }
 
@@ -112,9 +122,10 @@ func TestStepGroupStep(t *testing.T) {
 
 	// test run
 	testCases := []struct {
-		name          string
-		engine        *testEngine
-		expectedPhase v1alpha1.WorkflowStepPhase
+		name           string
+		engine         *testEngine
+		expectedPhase  v1alpha1.WorkflowStepPhase
+		expectedReason string
 	}{
 		{
 			name: "running1",
@@ -155,6 +166,44 @@ func TestStepGroupStep(t *testing.T) {
 			},
 			expectedPhase: v1alpha1.WorkflowStepPhaseFailed,
 		},
+		{
+			name: "fail with retrying sub step",
+			engine: &testEngine{
+				stepStatus: v1alpha1.WorkflowStepStatus{
+					SubStepsStatus: []v1alpha1.StepStatus{
+						{
+							Phase:  v1alpha1.WorkflowStepPhaseFailed,
+							Reason: types.StatusReasonExecute,
+						},
+						{
+							Phase:  v1alpha1.WorkflowStepPhaseFailed,
+							Reason: types.StatusReasonTerminate,
+						},
+					},
+				},
+				operation: &types.Operation{},
+			},
+			expectedPhase: v1alpha1.WorkflowStepPhaseFailed,
+		},
+		{
+			name: "fail with finished sub steps",
+			engine: &testEngine{
+				stepStatus: v1alpha1.WorkflowStepStatus{
+					SubStepsStatus: []v1alpha1.StepStatus{
+						{
+							Phase:  v1alpha1.WorkflowStepPhaseFailed,
+							Reason: types.StatusReasonTerminate,
+						},
+						{
+							Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+						},
+					},
+				},
+				operation: &types.Operation{},
+			},
+			expectedPhase:  v1alpha1.WorkflowStepPhaseFailed,
+			expectedReason: types.StatusReasonTerminate,
+		},
 		{
 			name: "success",
 			engine: &testEngine{
@@ -199,10 +248,253 @@ func TestStepGroupStep(t *testing.T) {
 			r.Equal(status.Name, "test")
 			r.Equal(act.Suspend, tc.engine.operation.Suspend)
 			r.Equal(status.Phase, tc.expectedPhase)
+			r.Equal(status.Reason, tc.expectedReason)
 		})
 	}
 }
 
+func TestStepGroupGenerator(t *testing.T) {
+	r := require.New(t)
+	ctx := newWorkflowContextForTest(t)
+	var generated []v1alpha1.WorkflowStepBase
+	var ids []string
+	subRunner, err := StepGroup(v1alpha1.WorkflowStep{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "sub"}}, &types.TaskGeneratorOptions{ID: "1"})
+	r.NoError(err)
+	runner, err := StepGroup(v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "remediate",
+			Type: types.WorkflowStepTypeStepGroup,
+		},
+		Generator: &v1alpha1.StepGenerator{
+			From: "check.failures",
+			Template: v1alpha1.WorkflowStepBase{
+				Name:       "fix",
+				Type:       "apply-object",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"cluster":"local"}`)},
+			},
+		},
+	}, &types.TaskGeneratorOptions{
+		ID:             "124",
+		ProcessContext: process.NewContext(process.ContextData{}),
+		SubTaskGenerator: func(step v1alpha1.WorkflowStepBase, id string) (types.TaskRunner, error) {
+			generated = append(generated, step)
+			ids = append(ids, id)
+			return subRunner, nil
+		},
+	})
+	r.NoError(err)
+
+	// the group is pending on the output array
+	logCtx := monitorContext.NewTraceContext(context.Background(), "test-app")
+	p, status := runner.Pending(logCtx, ctx, nil)
+	r.True(p)
+	r.Equal("Pending on Generator: check.failures", status.Message)
+	r.NoError(ctx.SetVar(cuecontext.New().CompileString(`[{name: "a"}, {name: "b"}]`), "check", "failures"))
+	p, _ = runner.Pending(logCtx, ctx, nil)
+	r.False(p)
+
+	status, _, err = runner.Run(ctx, &types.TaskRunOptions{
+		Engine: &testEngine{
+			stepStatus: v1alpha1.WorkflowStepStatus{
+				StepStatus: v1alpha1.StepStatus{Name: "remediate"},
+				SubStepsStatus: []v1alpha1.StepStatus{
+					{ID: "fix-0-id", Name: "fix-0", Phase: v1alpha1.WorkflowStepPhaseSucceeded},
+				},
+			},
+			operation: &types.Operation{},
+		},
+	})
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+	r.Len(generated, 2)
+	r.Equal("fix-0", generated[0].Name)
+	r.Equal("fix-1", generated[1].Name)
+	r.Equal("apply-object", generated[1].Type)
+	r.JSONEq(`{"cluster":"local","item":{"name":"b"}}`, string(generated[1].Properties.Raw))
+	r.Equal("fix-0-id", ids[0])
+	r.NotEmpty(ids[1])
+
+	// the group fails if the output is not an array
+	r.NoError(ctx.ReplaceVar(cuecontext.New().CompileString(`"a"`), "check", "failures"))
+	status, operations, err := runner.Run(ctx, &types.TaskRunOptions{
+		Engine: &testEngine{operation: &types.Operation{}},
+	})
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonGenerate, status.Reason)
+	r.Contains(status.Message, "is not an array")
+	r.True(operations.Terminated)
+}
+
+func TestStepGroupSwitch(t *testing.T) {
+	r := require.New(t)
+	ctx := newWorkflowContextForTest(t)
+	r.NoError(ctx.SetVar(cuecontext.New().CompileString(`"prod"`), "env"))
+	var subRunners []types.TaskRunner
+	for _, name := range []string{"deploy-dev", "deploy-prod", "notify"} {
+		sub, err := StepGroup(v1alpha1.WorkflowStep{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: name}}, &types.TaskGeneratorOptions{ID: name + "-id"})
+		r.NoError(err)
+		subRunners = append(subRunners, sub)
+	}
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name:   "deploy",
+			Type:   types.WorkflowStepTypeStepGroup,
+			Inputs: v1alpha1.StepInputs{{From: "env"}},
+		},
+		SubSteps: []v1alpha1.WorkflowStepBase{
+			{Name: "deploy-dev", Type: "apply-object"},
+			{Name: "deploy-prod", Type: "apply-object"},
+			{Name: "notify", Type: "notification"},
+		},
+		Switch: &v1alpha1.StepSwitch{
+			Value: "inputs.env",
+			Cases: []v1alpha1.SwitchCase{
+				{Value: "dev", Steps: []string{"deploy-dev"}},
+				{Value: "prod", Steps: []string{"deploy-prod", "notify"}},
+			},
+		},
+	}
+	run := func(id string, step v1alpha1.WorkflowStep) (v1alpha1.StepStatus, *types.Operation, *testEngine) {
+		runner, err := StepGroup(step, &types.TaskGeneratorOptions{
+			ID:             id,
+			SubTaskRunners: subRunners,
+			ProcessContext: process.NewContext(process.ContextData{}),
+		})
+		r.NoError(err)
+		e := &testEngine{
+			stepStatus: v1alpha1.WorkflowStepStatus{
+				StepStatus: v1alpha1.StepStatus{Name: "deploy"},
+				SubStepsStatus: []v1alpha1.StepStatus{
+					{ID: "deploy-dev-id", Name: "deploy-dev", Phase: v1alpha1.WorkflowStepPhaseSkipped},
+				},
+			},
+			operation: &types.Operation{},
+		}
+		status, operations, err := runner.Run(ctx, &types.TaskRunOptions{Engine: e})
+		r.NoError(err)
+		return status, operations, e
+	}
+
+	// the sub steps that are not in the selected case are skipped
+	status, _, e := run("124", step)
+	r.Equal("The case prod is selected", status.Message)
+	r.Len(e.runners, 3)
+	logCtx := monitorContext.NewTraceContext(context.Background(), "test-app")
+	p, _ := e.runners[0].Pending(logCtx, ctx, nil)
+	r.False(p)
+	skipped, operations, err := e.runners[0].Run(ctx, &types.TaskRunOptions{})
+	r.NoError(err)
+	r.Equal(v1alpha1.StepStatus{
+		ID:      "deploy-dev-id",
+		Name:    "deploy-dev",
+		Type:    "apply-object",
+		Phase:   v1alpha1.WorkflowStepPhaseSkipped,
+		Reason:  types.StatusReasonSkip,
+		Message: "The sub step is not in the case of the value prod",
+	}, skipped)
+	r.True(operations.Skip)
+	r.Equal(subRunners[1], e.runners[1])
+	r.Equal(subRunners[2], e.runners[2])
+
+	// the case selected when the group starts is kept even if the value changes
+	r.NoError(ctx.DeleteVar("env"))
+	r.NoError(ctx.SetVar(cuecontext.New().CompileString(`"dev"`), "env"))
+	status, _, e = run("124", step)
+	r.Equal("The case prod is selected", status.Message)
+	r.Equal(subRunners[1], e.runners[1])
+	r.NoError(ctx.DeleteVar("env"))
+	r.NoError(ctx.SetVar(cuecontext.New().CompileString(`"prod"`), "env"))
+
+	// the default case is selected if no case matches
+	step.Switch.Cases = step.Switch.Cases[:1]
+	step.Switch.Default = []string{"notify"}
+	status, _, e = run("125", step)
+	r.Equal("The default case is selected by the value prod", status.Message)
+	r.Equal(subRunners[2], e.runners[2])
+	skipped, _, err = e.runners[1].Run(ctx, &types.TaskRunOptions{})
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseSkipped, skipped.Phase)
+	r.NotEmpty(skipped.ID)
+
+	// the group fails if no case matches and there's no default
+	step.Switch.Default = nil
+	status, operations, _ = run("126", step)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonSwitch, status.Reason)
+	r.Contains(status.Message, "no case matches the value prod")
+	r.True(operations.Terminated)
+
+	// the value that is not a string is matched in JSON
+	step.Switch.Value = "len(inputs.env)"
+	step.Switch.Cases = []v1alpha1.SwitchCase{{Value: "4", Steps: []string{"deploy-prod"}}}
+	status, _, _ = run("127", step)
+	r.Equal("The case 4 is selected", status.Message)
+}
+
+func TestStepGroupAtomic(t *testing.T) {
+	r := require.New(t)
+	ctx := newWorkflowContextForTest(t)
+	cli := ctrlfake.NewClientBuilder().Build()
+	singleton.KubeClient.Set(cli)
+	pCtx := process.NewContext(process.ContextData{})
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "deploy", Type: types.WorkflowStepTypeStepGroup},
+		SubSteps:         []v1alpha1.WorkflowStepBase{{Name: "deploy-db"}, {Name: "deploy-app"}},
+		Atomic:           true,
+	}
+	runner, err := StepGroup(step, &types.TaskGeneratorOptions{ID: "124", ProcessContext: pCtx})
+	r.NoError(err)
+
+	// the sub steps of the atomic group capture the state of the resources before they're applied
+	logCtx := monitorContext.NewTraceContext(context.Background(), "test-app")
+	resetter := runner.FillContextData(logCtx, pCtx)
+	r.Equal("124", providertypes.AtomicGroupFrom(pCtx))
+	pCtx.PushData(model.ContextStepName, "deploy-db")
+	db := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "db", "namespace": "default"},
+	}}
+	r.NoError(providertypes.CaptureRollbackState(context.Background(), providertypes.RuntimeParams{WorkflowContext: ctx, ProcessContext: pCtx, KubeClient: cli}, "", db))
+	r.NoError(cli.Create(context.Background(), db))
+	pCtx.RemoveData(model.ContextStepName)
+	resetter(pCtx)
+	r.Equal("", providertypes.AtomicGroupFrom(pCtx))
+
+	run := func(subSteps ...v1alpha1.StepStatus) v1alpha1.StepStatus {
+		e := &testEngine{
+			stepStatus: v1alpha1.WorkflowStepStatus{StepStatus: v1alpha1.StepStatus{Name: "deploy"}, SubStepsStatus: subSteps},
+			operation:  &types.Operation{},
+		}
+		status, _, err := runner.Run(ctx, &types.TaskRunOptions{Engine: e})
+		r.NoError(err)
+		return status
+	}
+	// the resources are not rolled back while the failed sub step is retrying
+	status := run(
+		v1alpha1.StepStatus{Name: "deploy-db", Phase: v1alpha1.WorkflowStepPhaseSucceeded},
+		v1alpha1.StepStatus{Name: "deploy-app", Phase: v1alpha1.WorkflowStepPhaseFailed, Reason: types.StatusReasonExecute},
+	)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Nil(status.Rollback)
+
+	// the resources are rolled back once the group fails
+	status = run(
+		v1alpha1.StepStatus{Name: "deploy-db", Phase: v1alpha1.WorkflowStepPhaseSucceeded},
+		v1alpha1.StepStatus{Name: "deploy-app", Phase: v1alpha1.WorkflowStepPhaseFailed, Reason: types.StatusReasonFailedAfterRetries},
+	)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(&v1alpha1.StepRollbackStatus{
+		Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+		Resources: []v1alpha1.RolledBackResource{
+			{Step: "deploy-db", APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "db", Action: providertypes.RollbackActionDeleted},
+		},
+	}, status.Rollback)
+	r.Equal("Rolled back 1 applied resources", status.Message)
+	r.True(kerrors.IsNotFound(cli.Get(context.Background(), client.ObjectKeyFromObject(db), db)))
+}
+
 func newWorkflowContextForTest(t *testing.T) wfContext.Context {
 	cm := corev1.ConfigMap{}
 	r := require.New(t)
@@ -17,12 +17,15 @@ limitations under the License.
 */
 
 import (
+	"sort"
+
 	"github.com/kubevela/pkg/cue/cuex"
 
 	monitorContext "github.com/kubevela/pkg/monitor/context"
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/errors"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/types"
 )
 
@@ -38,6 +41,18 @@ func ResolveActionBreak(err error) error {
 	return err
 }
 
+// ResolveErrorReason resolves the reason of the error returned by the provider, StatusReasonExecute is returned
+// if the provider doesn't set the reason
+func ResolveErrorReason(err error) string {
+	if fc, ok := err.(cuex.FunctionCallError); ok {
+		err = fc.Err
+	}
+	if reason := providertypes.ReasonOf(err); reason != "" {
+		return reason
+	}
+	return types.StatusReasonExecute
+}
+
 type executor struct {
 	wfStatus           v1alpha1.StepStatus
 	stepStatus         v1alpha1.StepStatus
@@ -82,6 +97,16 @@ func (exec *executor) Terminate(message string) {
 	exec.wfStatus.Reason = types.StatusReasonTerminate
 }
 
+// Exit let workflow exit as succeeded, the remaining steps are skipped.
+func (exec *executor) Exit(message string) {
+	exec.terminated = true
+	exec.wfStatus.Phase = v1alpha1.WorkflowStepPhaseSucceeded
+	if message != "" {
+		exec.wfStatus.Message = message
+	}
+	exec.wfStatus.Reason = types.StatusReasonExit
+}
+
 // Wait let workflow wait.
 func (exec *executor) Wait(message string) {
 	exec.wait = true
@@ -111,6 +136,31 @@ func (exec *executor) Message(message string) {
 	}
 }
 
+// SubPhase writes the intermediate state of the running step to step status, it's cleared once the step is
+// not running.
+func (exec *executor) SubPhase(subPhase string) {
+	exec.wfStatus.SubPhase = subPhase
+}
+
+// ContinuationToken keeps the token of the long operation in the step status, it's passed back to the provider by
+// the status of the step in the next executions until the step is finished.
+func (exec *executor) ContinuationToken(token string) {
+	exec.wfStatus.ContinuationToken = token
+}
+
+// Metadata adds the informational metadata of the step to step status, the values of the same keys are overwritten.
+func (exec *executor) Metadata(metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+	if exec.wfStatus.Metadata == nil {
+		exec.wfStatus.Metadata = make(map[string]string, len(metadata))
+	}
+	for k, v := range metadata {
+		exec.wfStatus.Metadata[k] = v
+	}
+}
+
 func (exec *executor) Skip(message string) {
 	exec.skip = true
 	exec.wfStatus.Phase = v1alpha1.WorkflowStepPhaseSkipped
@@ -162,5 +212,52 @@ func (exec *executor) operation() *types.Operation {
 }
 
 func (exec *executor) status() v1alpha1.StepStatus {
+	if exec.wfStatus.Phase != v1alpha1.WorkflowStepPhaseRunning {
+		exec.wfStatus.SubPhase = ""
+	}
+	switch {
+	case types.IsStepFinish(exec.wfStatus.Phase, exec.wfStatus.Reason):
+		exec.wfStatus.ContinuationToken = ""
+	case exec.wfStatus.ContinuationToken == "" && exec.stepStatus.ID == exec.wfStatus.ID:
+		// the token is kept if the provider doesn't issue a new one in this execution, e.g. the polling is failed
+		exec.wfStatus.ContinuationToken = exec.stepStatus.ContinuationToken
+	}
+	// the approvals applied to the gates of the suspend step are kept until the step is restarted
+	if exec.stepStatus.ID == exec.wfStatus.ID && len(exec.wfStatus.Approvals) == 0 {
+		exec.wfStatus.Approvals = exec.stepStatus.Approvals
+	}
+	// the metadata reported in the previous executions of the step is kept
+	if exec.stepStatus.ID == exec.wfStatus.ID && len(exec.stepStatus.Metadata) > 0 {
+		metadata := make(map[string]string, len(exec.stepStatus.Metadata)+len(exec.wfStatus.Metadata))
+		for k, v := range exec.stepStatus.Metadata {
+			metadata[k] = v
+		}
+		for k, v := range exec.wfStatus.Metadata {
+			metadata[k] = v
+		}
+		exec.wfStatus.Metadata = metadata
+	}
+	exec.wfStatus.Metadata = boundMetadata(exec.wfStatus.Metadata, types.MaxStepMetadataSize)
 	return exec.wfStatus
 }
+
+// boundMetadata keeps the entries of the metadata in the order of their keys until the total size of the keys and
+// values exceeds the limit, the other entries are dropped
+func boundMetadata(metadata map[string]string, limit int) map[string]string {
+	if limit <= 0 || len(metadata) == 0 {
+		return metadata
+	}
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	size := 0
+	for _, k := range keys {
+		size += len(k) + len(metadata[k])
+		if size > limit {
+			delete(metadata, k)
+		}
+	}
+	return metadata
+}
@@ -20,10 +20,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/parser"
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 
@@ -40,6 +45,7 @@ import (
 	"github.com/kubevela/workflow/pkg/hooks"
 	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
 )
 
 // LoadTaskTemplate gets the workflowStep definition from cluster and resolve it.
@@ -50,6 +56,7 @@ type TaskLoader struct {
 	loadTemplate      func(ctx context.Context, name string) (string, error)
 	runOptionsProcess func(*types.TaskRunOptions)
 	logLevel          int
+	compiler          *cuex.Compiler
 }
 
 // GetTaskGenerator get TaskGenerator by name.
@@ -58,14 +65,51 @@ func (t *TaskLoader) GetTaskGenerator(ctx context.Context, name string) (types.T
 	if err != nil {
 		return nil, err
 	}
+	if err := CheckImports(t.compiler, templ); err != nil {
+		return nil, errors.WithMessagef(err, "check imports of step type %s", name)
+	}
 	return t.makeTaskGenerator(templ)
 }
 
+// CheckImports checks whether all the imported packages in the template can be resolved by the compiler.
+// The cue builtin packages like `strings` are always resolvable, while the packages with a domain like
+// `team.org/common` and the `vela/...` packages must be loaded in the compiler.
+func CheckImports(compiler *cuex.Compiler, templ string) error {
+	if compiler == nil {
+		return nil
+	}
+	f, err := parser.ParseFile("-", templ, parser.ImportsOnly)
+	if err != nil {
+		return errors.WithMessage(err, "parse template")
+	}
+	paths := make(map[string]bool)
+	for _, pkg := range compiler.GetPackages() {
+		paths[pkg.GetPath()] = true
+	}
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return errors.WithMessagef(err, "parse import %s", spec.Path.Value)
+		}
+		if i := strings.Index(path, ":"); i >= 0 {
+			path = path[:i]
+		}
+		if paths[path] {
+			continue
+		}
+		if first := strings.Split(path, "/")[0]; strings.Contains(first, ".") || first == "vela" {
+			return fmt.Errorf("cannot find package %q, please make sure it's defined in a Package or a configmap labeled with %s", path, types.LabelCUEPackage)
+		}
+	}
+	return nil
+}
+
 type taskRunner struct {
 	name         string
 	run          func(ctx wfContext.Context, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation, error)
 	checkPending func(ctx monitorContext.Context, wfCtx wfContext.Context, stepStatus map[string]v1alpha1.StepStatus) (bool, v1alpha1.StepStatus)
 	fillContext  func(ctx monitorContext.Context, processCtx process.Context) types.ContextDataResetter
+	render       func(ctx monitorContext.Context, wfCtx wfContext.Context) []cue.Value
 }
 
 // Name return step name.
@@ -87,6 +131,11 @@ func (tr *taskRunner) FillContextData(ctx monitorContext.Context, processCtx pro
 	return tr.fillContext(ctx, processCtx)
 }
 
+// RenderTemplates renders the template of the step without running the providers.
+func (tr *taskRunner) RenderTemplates(ctx monitorContext.Context, wfCtx wfContext.Context) []cue.Value {
+	return tr.render(ctx, wfCtx)
+}
+
 // nolint:gocyclo
 func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error) {
 	return func(wfStep v1alpha1.WorkflowStep, genOpt *types.TaskGeneratorOptions) (types.TaskRunner, error) {
@@ -113,6 +162,13 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 			}
 		}
 
+		var dependents []string
+		var lockPeers func() []string
+		if genOpt != nil {
+			dependents = genOpt.Dependents
+			lockPeers = genOpt.LockPeers
+		}
+
 		tRunner := new(taskRunner)
 		tRunner.name = wfStep.Name
 		tRunner.checkPending = func(ctx monitorContext.Context, wfCtx wfContext.Context, stepStatus map[string]v1alpha1.StepStatus) (bool, v1alpha1.StepStatus) {
@@ -125,7 +181,37 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 			defer resetter(options.PCtx)
 			basicVal, _ := MakeBasicValue(ctx, options.Compiler, wfStep.Properties, options.PCtx)
 
-			return CheckPending(wfCtx, wfStep, exec.wfStatus.ID, stepStatus, basicVal)
+			var peers []string
+			if lockPeers != nil {
+				peers = lockPeers()
+			}
+			return CheckPending(wfCtx, wfStep, exec.wfStatus.ID, peers, stepStatus, basicVal, providertypes.ClockFrom(ctx.GetContext()).Now())
+		}
+		tRunner.render = func(ctx monitorContext.Context, wfCtx wfContext.Context) []cue.Value {
+			// the step with the inputs, or acting as another identity or in another cluster is rendered once it runs
+			if len(wfStep.Inputs) > 0 || wfStep.ServiceAccount != "" || wfStep.Cluster != "" {
+				return nil
+			}
+			options := &types.TaskRunOptions{}
+			if t.runOptionsProcess != nil {
+				t.runOptionsProcess(options)
+			}
+
+			resetter := tRunner.fillContext(ctx, options.PCtx)
+			defer resetter(options.PCtx)
+			basicVal, err := MakeBasicValue(ctx, options.Compiler, wfStep.Properties, options.PCtx)
+			if err != nil {
+				return nil
+			}
+			basicTempl, err := util.ToString(basicVal)
+			if err != nil {
+				return nil
+			}
+			v, err := options.Compiler.CompileStringWithOptions(ctx, strings.Join([]string{templ, basicTempl}, "\n"), cuex.DisableResolveProviderFunctions{})
+			if err != nil {
+				return nil
+			}
+			return []cue.Value{v}
 		}
 		tRunner.fillContext = func(ctx monitorContext.Context, processCtx process.Context) types.ContextDataResetter {
 			metas := []process.StepMetaKV{
@@ -133,6 +219,15 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 				process.WithSessionID(exec.wfStatus.ID),
 				process.WithSpanID(ctx.GetID()),
 			}
+			if wfStep.Timeout != "" {
+				metas = append(metas, process.WithTimeout(wfStep.Timeout))
+			}
+			if token, ok := ctx.GetContext().Value(providertypes.IdempotencyTokenKey).(string); ok {
+				metas = append(metas, process.WithIdempotencyToken(token))
+			}
+			if len(dependents) > 0 {
+				metas = append(metas, process.WithDependents(dependents))
+			}
 			manager := process.NewStepRunTimeMeta()
 			manager.Fill(processCtx, metas)
 			return func(processCtx process.Context) {
@@ -159,6 +254,9 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 			if t.runOptionsProcess != nil {
 				t.runOptionsProcess(options)
 			}
+			// the attempt is kept across the retries of the step, so that the providers get the same idempotency token
+			exec.wfStatus.Attempt = types.StepAttempt(exec.wfStatus.ID, options.StepStatus[wfStep.Name])
+			tracer.SetContext(providertypes.WithIdempotencyToken(tracer.GetContext(), exec.wfStatus.ID, exec.wfStatus.Attempt))
 			resetter := tRunner.fillContext(tracer, options.PCtx)
 			defer resetter(options.PCtx)
 
@@ -185,21 +283,42 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 				if taskv == (cue.Value{}) {
 					taskv = basicVal.FillPath(cue.ParsePath(""), templ)
 				}
+				if len(wfStep.Inputs) > 0 {
+					switch {
+					case types.IsStepFinish(exec.wfStatus.Phase, exec.wfStatus.Reason):
+						hooks.DeleteRetryInputs(wfCtx, wfStep)
+					case exec.wfStatus.Phase == v1alpha1.WorkflowStepPhaseFailed:
+						hooks.SetRetryInputs(wfCtx, basicVal, wfStep)
+					}
+				}
 				if options.Debug != nil {
-					if err := options.Debug(exec.wfStatus.ID, taskv); err != nil {
+					if debugv, err := RedactSensitiveValue(taskv, wfStep); err != nil {
+						tracer.Error(err, "failed to redact the sensitive outputs for debug")
+					} else if err := options.Debug(exec.wfStatus.ID, debugv); err != nil {
 						tracer.Error(err, "failed to debug")
 					}
 				}
 				for _, hook := range options.PostStopHooks {
 					if err := hook(wfCtx, taskv, wfStep, exec.status(), options.StepStatus); err != nil {
-						exec.wfStatus.Message = err.Error()
+						exec.wfStatus.Message = RedactSensitiveOutputs(taskv, wfStep, err.Error())
 						stepStatus = exec.status()
 						operations = exec.operation()
 						return
 					}
 				}
+				stepStatus.Message = RenderStatusMessage(taskv, wfStep, stepStatus.Message)
+				stepStatus.Reason = RenderStatusMessage(taskv, wfStep, stepStatus.Reason)
+				if wfStep.StatusMessage != "" && stepStatus.Phase == v1alpha1.WorkflowStepPhaseSucceeded {
+					stepStatus.Message = RenderStatusMessage(taskv, wfStep, wfStep.StatusMessage)
+				}
+				stepStatus.Message = RedactSensitiveOutputs(taskv, wfStep, stepStatus.Message)
+				stepStatus.Reason = RedactSensitiveOutputs(taskv, wfStep, stepStatus.Reason)
+				if len(wfStep.ApprovalGates) > 0 && stepStatus.Phase == v1alpha1.WorkflowStepPhaseSuspending {
+					stepStatus.Message = utils.ApprovalGatesMessage(wfStep.ApprovalGates, stepStatus.Approvals)
+				}
 			}()
 
+			var timeLeft time.Duration
 			for _, hook := range options.PreCheckHooks {
 				result, err := hook(wfStep, &types.PreCheckOptions{BasicValue: basicVal})
 				if err != nil {
@@ -214,6 +333,29 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 				if result.Timeout {
 					exec.timeout("")
 				}
+				if result.TimeLeft > 0 && (timeLeft == 0 || result.TimeLeft < timeLeft) {
+					timeLeft = result.TimeLeft
+				}
+			}
+
+			// the step is failed rather than skipped if its precondition is not met
+			if met, message := CheckPreCondition(wfCtx, wfStep, options.StepStatus, basicVal); !met && !exec.terminated {
+				exec.err(wfCtx, false, errors.New(message), types.StatusReasonPreconditionFailed)
+				return exec.status(), exec.operation(), nil
+			}
+
+			// the retry of the failed step reuses the inputs resolved by the failed attempt unless it re-renders on
+			// retry, which fails if the inputs are from the steps that have failed since
+			if prev := options.StepStatus[wfStep.Name]; prev.ID == exec.wfStatus.ID && prev.Phase == v1alpha1.WorkflowStepPhaseFailed {
+				if wfStep.RerenderOnRetry {
+					if err := hooks.CheckRetryInputs(wfCtx, wfStep, options.StepStatus); err != nil {
+						tracer.Error(err, "check retry inputs")
+						exec.err(wfCtx, false, err, types.StatusReasonInput)
+						return exec.status(), exec.operation(), nil
+					}
+				}
+			} else if len(wfStep.Inputs) > 0 {
+				hooks.DeleteRetryInputs(wfCtx, wfStep)
 			}
 
 			for _, hook := range options.PreStartHooks {
@@ -224,6 +366,40 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 				}
 			}
 
+			if wfStep.ServiceAccount != "" {
+				namespace := fmt.Sprint(options.PCtx.GetData(model.ContextNamespace))
+				cli, err := providertypes.GetImpersonatedClient(ctx, namespace, wfStep.ServiceAccount)
+				if err != nil {
+					tracer.Error(err, "impersonate service account")
+					exec.err(wfCtx, false, err, types.StatusReasonExecute)
+					return exec.status(), exec.operation(), nil
+				}
+				ctx = providertypes.WithImpersonatedClient(ctx, cli, wfStep.ServiceAccount)
+			}
+			if wfStep.Cluster != "" {
+				ctx = providertypes.WithCluster(ctx, wfStep.Cluster)
+			}
+
+			if wfStep.OperationTimeout != "" {
+				timeout, err := time.ParseDuration(wfStep.OperationTimeout)
+				if err != nil {
+					exec.err(wfCtx, false, errors.WithMessage(err, "invalid operation timeout"), types.StatusReasonParameter)
+					return exec.status(), exec.operation(), nil
+				}
+				// the providers use the context for the deadlines of their calls
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			if timeLeft > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeLeft)
+				defer cancel()
+			}
+			// the in-flight calls of the providers are cancelled once the workflow run is cancelled, e.g. terminated
+			ctx, cancel := providertypes.WithCancellation(ctx)
+			defer cancel()
+
 			if status, ok := options.StepStatus[wfStep.Name]; ok {
 				exec.stepStatus = status
 			}
@@ -232,12 +408,36 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 				exec.err(wfCtx, false, err, types.StatusReasonRendering)
 				return exec.status(), exec.operation(), nil
 			}
+			// the parameters of the unresolved lazy inputs are unavailable rather than their default values, and the
+			// step waits for the inputs before any provider runs if the providers read them
+			if lazyInputs := hooks.GetUnresolvedLazyInputs(wfCtx, wfStep); len(lazyInputs) > 0 {
+				lazyTempl := hooks.UnresolvedLazyInputsTemplate(lazyInputs)
+				if readsLazyInputs(ctx, options.Compiler, strings.Join([]string{templ, basicTempl}, "\n"), lazyTempl) {
+					froms := make([]string, 0, len(lazyInputs))
+					for _, from := range lazyInputs {
+						froms = append(froms, from)
+					}
+					sort.Strings(froms)
+					exec.Wait(fmt.Sprintf("Waiting for the lazy inputs: %s", strings.Join(froms, ", ")))
+					return exec.status(), exec.operation(), nil
+				}
+				basicTempl = strings.Join([]string{basicTempl, lazyTempl}, "\n")
+			}
 			taskv, err = options.Compiler.CompileString(ctx, strings.Join([]string{templ, basicTempl}, "\n"))
 			if err != nil {
 				// resolve the action break error
 				if resolvedErr := ResolveActionBreak(err); resolvedErr != nil {
 					tracer.Error(resolvedErr, "do steps")
-					exec.err(wfCtx, true, resolvedErr, types.StatusReasonExecute)
+					exec.err(wfCtx, true, resolvedErr, ResolveErrorReason(resolvedErr))
+					return exec.status(), exec.operation(), nil
+				}
+			}
+
+			// the lazy inputs are not waited for to start the step, but the step can't succeed without them
+			if exec.wfStatus.Phase == v1alpha1.WorkflowStepPhaseSucceeded && !exec.terminated {
+				if err := hooks.CheckLazyInputs(taskv, wfStep); err != nil {
+					tracer.Error(err, "check lazy inputs")
+					exec.err(wfCtx, false, err, types.StatusReasonInput)
 					return exec.status(), exec.operation(), nil
 				}
 			}
@@ -256,17 +456,62 @@ func (t *TaskLoader) makeTaskGenerator(templ string) (types.TaskGenerator, error
 
 // ValidateIfValue validates the if value
 func ValidateIfValue(ctx wfContext.Context, step v1alpha1.WorkflowStep, stepStatus map[string]v1alpha1.StepStatus, basicVal cue.Value) (bool, error) {
-	s, _ := util.ToString(basicVal)
-	template := fmt.Sprintf("if: %s\n%s\n%s\n%s", step.If, getInputsTemplate(ctx, step, basicVal), buildValueForStatus(ctx, stepStatus), s)
-	v := cuecontext.New().CompileString(template).LookupPath(cue.ParsePath("if"))
+	check, err := evaluateCondition(ctx, step.If, step, stepStatus, basicVal)
+	if err != nil {
+		return false, errors.WithMessage(err, "invalid if value")
+	}
+	return check, nil
+}
+
+// CheckPreCondition checks the precondition of the step before it starts, it returns false with the message if the
+// precondition is not met or can't be evaluated. The running or suspending step is not checked again.
+func CheckPreCondition(ctx wfContext.Context, step v1alpha1.WorkflowStep, stepStatus map[string]v1alpha1.StepStatus, basicVal cue.Value) (bool, string) {
+	if step.PreCondition == "" {
+		return true, ""
+	}
+	if phase := stepStatus[step.Name].Phase; phase == v1alpha1.WorkflowStepPhaseRunning || phase == v1alpha1.WorkflowStepPhaseSuspending {
+		return true, ""
+	}
+	met, err := evaluateCondition(ctx, step.PreCondition, step, stepStatus, basicVal)
+	if err != nil {
+		return false, fmt.Sprintf("invalid precondition %s: %s", step.PreCondition, err.Error())
+	}
+	if !met {
+		return false, fmt.Sprintf("the precondition %s is not met", step.PreCondition)
+	}
+	return true, ""
+}
+
+// EvaluateSwitchValue evaluates the value of the switch of the step group like `if`, the value that is not a string
+// is returned in JSON
+func EvaluateSwitchValue(ctx wfContext.Context, step v1alpha1.WorkflowStep, stepStatus map[string]v1alpha1.StepStatus, basicVal cue.Value) (string, error) {
+	v := evaluateExpression(ctx, step.Switch.Value, step, stepStatus, basicVal)
 	if v.Err() != nil {
-		return false, errors.WithMessage(v.Err(), "invalid if value")
+		return "", v.Err()
 	}
-	check, err := v.Bool()
+	if s, err := v.String(); err == nil {
+		return s, nil
+	}
+	b, err := v.MarshalJSON()
 	if err != nil {
-		return false, err
+		return "", err
 	}
-	return check, nil
+	return string(b), nil
+}
+
+// evaluateCondition evaluates the condition of the step with its inputs, parameter and the status of the steps
+func evaluateCondition(ctx wfContext.Context, condition string, step v1alpha1.WorkflowStep, stepStatus map[string]v1alpha1.StepStatus, basicVal cue.Value) (bool, error) {
+	v := evaluateExpression(ctx, condition, step, stepStatus, basicVal)
+	if v.Err() != nil {
+		return false, v.Err()
+	}
+	return v.Bool()
+}
+
+func evaluateExpression(ctx wfContext.Context, expr string, step v1alpha1.WorkflowStep, stepStatus map[string]v1alpha1.StepStatus, basicVal cue.Value) cue.Value {
+	s, _ := util.ToString(basicVal)
+	template := fmt.Sprintf("if: %s\n%s\n%s\n%s", expr, getInputsTemplate(ctx, step, basicVal), buildValueForStatus(ctx, stepStatus), s)
+	return cuecontext.New().CompileString(template).LookupPath(cue.ParsePath("if"))
 }
 
 func buildValueForStatus(_ wfContext.Context, stepStatus map[string]v1alpha1.StepStatus) string {
@@ -280,6 +525,7 @@ func buildValueForStatus(_ wfContext.Context, stepStatus map[string]v1alpha1.Ste
 			Timeout             bool `json:"timeout"`
 			FailedAfterRetries  bool `json:"failedAfterRetries"`
 			Terminate           bool `json:"terminate"`
+			Changed             bool `json:"changed"`
 		}{
 			StepStatus:         ss,
 			Failed:             ss.Phase == v1alpha1.WorkflowStepPhaseFailed,
@@ -288,6 +534,7 @@ func buildValueForStatus(_ wfContext.Context, stepStatus map[string]v1alpha1.Ste
 			Timeout:            ss.Reason == types.StatusReasonTimeout,
 			FailedAfterRetries: ss.Reason == types.StatusReasonFailedAfterRetries,
 			Terminate:          ss.Reason == types.StatusReasonTerminate,
+			Changed:            ss.Metadata[types.MetadataKeyChanged] == "true",
 		}
 		statusMap[name] = abbrStatus
 	}
@@ -310,6 +557,29 @@ func MakeBasicValue(ctx monitorContext.Context, compiler *cuex.Compiler, propert
 	return v, nil
 }
 
+// readsLazyInputs checks if the providers of the template read the unresolved lazy inputs, i.e. the provider call
+// can't be evaluated once the parameters of the inputs are unavailable. The template is compiled without running
+// the providers.
+func readsLazyInputs(ctx context.Context, compiler *cuex.Compiler, templ string, lazyTempl string) bool {
+	v, err := compiler.CompileStringWithOptions(ctx, templ, cuex.DisableResolveProviderFunctions{})
+	if err != nil {
+		return false
+	}
+	lazyVal, err := compiler.CompileStringWithOptions(ctx, strings.Join([]string{templ, lazyTempl}, "\n"), cuex.DisableResolveProviderFunctions{})
+	if err != nil {
+		return true
+	}
+	reads := false
+	util.Iterate(lazyVal, func(call cue.Value) bool {
+		if fn, _ := call.LookupPath(cue.ParsePath("#do")).String(); fn == "" {
+			return false
+		}
+		reads = call.Validate() != nil && v.LookupPath(call.Path()).Validate() == nil
+		return reads
+	})
+	return reads
+}
+
 func getContextTemplate(pCtx process.Context) string {
 	var contextTempl string
 	if pCtx == nil {
@@ -356,16 +626,19 @@ func NewTaskLoader(lt LoadTaskTemplate, logLevel int, pCtx process.Context, comp
 			options.Compiler = compiler
 		},
 		logLevel: logLevel,
+		compiler: compiler,
 	}
 }
 
-// CheckPending checks whether to pending task run
-func CheckPending(ctx wfContext.Context, step v1alpha1.WorkflowStep, id string, stepStatus map[string]v1alpha1.StepStatus, basicValue cue.Value) (bool, v1alpha1.StepStatus) {
+// CheckPending checks whether to pending task run, the step is pending until its dependencies and inputs are ready,
+// the lock of the step is not held by any of the lock peers and the time is in the execution window of the step
+func CheckPending(ctx wfContext.Context, step v1alpha1.WorkflowStep, id string, lockPeers []string, stepStatus map[string]v1alpha1.StepStatus, basicValue cue.Value, now time.Time) (bool, v1alpha1.StepStatus) {
 	pStatus := v1alpha1.StepStatus{
-		Phase: v1alpha1.WorkflowStepPhasePending,
-		Type:  step.Type,
-		ID:    id,
-		Name:  step.Name,
+		Phase:   v1alpha1.WorkflowStepPhasePending,
+		Type:    step.Type,
+		ID:      id,
+		Name:    step.Name,
+		Attempt: types.StepAttempt(id, stepStatus[step.Name]),
 	}
 	for _, depend := range step.DependsOn {
 		pStatus.Message = fmt.Sprintf("Pending on DependsOn: %s", depend)
@@ -377,7 +650,18 @@ func CheckPending(ctx wfContext.Context, step v1alpha1.WorkflowStep, id string,
 			return true, pStatus
 		}
 	}
+	if step.DependsOnCondition != nil {
+		if finished, _ := types.CheckDependsOnCondition(step.DependsOnCondition, stepStatus); !finished {
+			pStatus.Message = fmt.Sprintf("Pending on DependsOnCondition: %s", strings.Join(step.DependsOnCondition.StepNames(), ", "))
+			return true, pStatus
+		}
+	}
 	for _, input := range step.Inputs {
+		// the output of the step's prior execution is optional, the pruned output is already generated and the lazy
+		// input is resolved when the step is executed, the step should not wait for them
+		if input.Lazy || strings.HasPrefix(input.From, hooks.PreviousOutputPrefix) || hooks.IsOutputPruned(ctx, input.From) {
+			continue
+		}
 		pStatus.Message = fmt.Sprintf("Pending on Input: %s", input.From)
 		if _, err := ctx.GetVar(strings.Split(input.From, ".")...); err != nil {
 			if v := basicValue.LookupPath(value.FieldPath(input.From)); !v.Exists() {
@@ -385,5 +669,150 @@ func CheckPending(ctx wfContext.Context, step v1alpha1.WorkflowStep, id string,
 			}
 		}
 	}
+	// the step that already holds the lock keeps running
+	if status, ok := stepStatus[step.Name]; !ok || !holdsLock(status) {
+		for _, peer := range lockPeers {
+			if status, ok := stepStatus[peer]; ok && holdsLock(status) {
+				pStatus.Message = fmt.Sprintf("Pending on Lock: %s held by %s", step.Lock, peer)
+				return true, pStatus
+			}
+		}
+	}
+	// the started step is not interrupted when the execution window closes
+	if status, ok := stepStatus[step.Name]; step.ExecutionWindow != nil && (!ok || !holdsLock(status)) {
+		// the invalid window keeps the step pending instead of running it at any time
+		if in, err := types.InExecutionWindow(step.ExecutionWindow, now); err != nil {
+			pStatus.Message = fmt.Sprintf("Pending on ExecutionWindow: %s", err.Error())
+			return true, pStatus
+		} else if !in {
+			pStatus.Message = fmt.Sprintf("Pending on ExecutionWindow: %s", types.FormatExecutionWindow(step.ExecutionWindow))
+			return true, pStatus
+		}
+	}
 	return false, v1alpha1.StepStatus{}
 }
+
+// holdsLock checks if the step holds its lock, the lock is held from the start of the step until it's finished
+func holdsLock(status v1alpha1.StepStatus) bool {
+	return status.Phase != v1alpha1.WorkflowStepPhasePending && !types.IsStepFinish(status.Phase, status.Reason)
+}
+
+// templateExpression matches the template expressions in the status messages, e.g. `{{ output.version }}`
+var templateExpression = regexp.MustCompile(`\{\{\s*(.+?)\s*\}\}`)
+
+// StatusMessageExpressions returns the template expressions in the status message, e.g. `output.version`
+func StatusMessageExpressions(message string) []string {
+	var exprs []string
+	for _, match := range templateExpression.FindAllStringSubmatch(message, -1) {
+		exprs = append(exprs, match[1])
+	}
+	return exprs
+}
+
+// RenderStatusMessage renders the template expressions in the message by the outputs of the step,
+// the raw message is returned if any of the expressions fails to render
+func RenderStatusMessage(taskv cue.Value, step v1alpha1.WorkflowStep, message string) string {
+	if !templateExpression.MatchString(message) || !taskv.Exists() {
+		return message
+	}
+	cuectx := cuecontext.New()
+	scope := cuectx.CompileString("{}")
+	for _, output := range step.Outputs {
+		v, err := hooks.LookupOutput(taskv, output)
+		if err != nil || v.Err() != nil {
+			continue
+		}
+		path := cue.MakePath(cue.Str("output"), cue.Str(output.Name))
+		if output.Sensitive {
+			scope = scope.FillPath(path, types.RedactedValue)
+			continue
+		}
+		s, err := util.ToString(v)
+		if err != nil {
+			continue
+		}
+		scope = scope.FillPath(path, cuectx.CompileString(s))
+	}
+	var renderErr error
+	rendered := templateExpression.ReplaceAllStringFunc(message, func(expr string) string {
+		v := cuectx.CompileString(templateExpression.FindStringSubmatch(expr)[1], cue.Scope(scope))
+		if v.Err() != nil {
+			renderErr = v.Err()
+			return expr
+		}
+		if s, err := v.String(); err == nil {
+			return s
+		}
+		b, err := v.MarshalJSON()
+		if err != nil {
+			renderErr = err
+			return expr
+		}
+		return string(b)
+	})
+	if renderErr != nil {
+		return message
+	}
+	return rendered
+}
+
+// RedactSensitiveOutputs replaces the values of the sensitive outputs of the step in the message
+func RedactSensitiveOutputs(taskv cue.Value, step v1alpha1.WorkflowStep, message string) string {
+	if message == "" || !taskv.Exists() {
+		return message
+	}
+	for _, output := range step.Outputs {
+		if !output.Sensitive {
+			continue
+		}
+		v, err := value.LookupValueByScript(taskv, output.ValueFrom)
+		if err != nil || v.Err() != nil {
+			continue
+		}
+		message = redactValue(message, v)
+		// the transformed value is redacted as well, e.g. the decoded token
+		if len(output.Pipeline) > 0 {
+			if transformed, err := hooks.TransformOutput(v, output.Pipeline); err == nil && transformed.Err() == nil {
+				message = redactValue(message, transformed)
+			}
+		}
+	}
+	return message
+}
+
+func redactValue(message string, v cue.Value) string {
+	s, err := v.String()
+	if err != nil {
+		b, err := v.MarshalJSON()
+		if err != nil {
+			return message
+		}
+		s = string(b)
+	}
+	if s == "" {
+		return message
+	}
+	return strings.ReplaceAll(message, s, types.RedactedValue)
+}
+
+// RedactSensitiveValue returns the task value with the values of the sensitive outputs of the step replaced, the
+// sensitive outputs must be read from the fields of the task value instead of the scripts
+func RedactSensitiveValue(taskv cue.Value, step v1alpha1.WorkflowStep) (cue.Value, error) {
+	redacted := taskv
+	for _, output := range step.Outputs {
+		if !output.Sensitive {
+			continue
+		}
+		if v, err := value.LookupValueByScript(taskv, output.ValueFrom); err != nil || !v.Exists() {
+			continue
+		}
+		if err := cue.ParsePath(output.ValueFrom).Err(); err != nil {
+			return cue.Value{}, errors.WithMessagef(err, "the sensitive output %s is not read from a field", output.Name)
+		}
+		var err error
+		if redacted, err = value.SetValueByScript(redacted, taskv.Context().CompileString(strconv.Quote(types.RedactedValue)), output.ValueFrom); err != nil {
+			return cue.Value{}, errors.WithMessagef(err, "redact the sensitive output %s", output.Name)
+		}
+	}
+	return redacted, nil
+}
@@ -20,7 +20,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
@@ -28,9 +30,12 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/dynamic/fake"
+	clocktesting "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/yaml"
 
 	cuexv1alpha1 "github.com/kubevela/pkg/apis/cue/v1alpha1"
@@ -42,7 +47,9 @@ import (
 
 	"github.com/kubevela/workflow/api/v1alpha1"
 	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/cue/model"
 	"github.com/kubevela/workflow/pkg/cue/process"
+	"github.com/kubevela/workflow/pkg/hooks"
 	"github.com/kubevela/workflow/pkg/providers"
 	providertypes "github.com/kubevela/workflow/pkg/providers/types"
 	"github.com/kubevela/workflow/pkg/types"
@@ -204,6 +211,16 @@ func TestErrCases(t *testing.T) {
 			"error": providertypes.LegacyGenericProviderFn[any, any](func(ctx context.Context, val *providertypes.LegacyParams[any]) (*any, error) {
 				return nil, errors.New("mock error")
 			}),
+			"decode": providertypes.LegacyGenericProviderFn[any, any](func(ctx context.Context, val *providertypes.LegacyParams[any]) (*any, error) {
+				props := struct {
+					Replicas int `json:"replicas"`
+				}{}
+				return nil, val.DecodeProperties(&props)
+			}),
+			"get-input": providertypes.LegacyGenericProviderFn[any, any](func(ctx context.Context, val *providertypes.LegacyParams[any]) (*any, error) {
+				_, err := val.GetInput("notReady")
+				return nil, err
+			}),
 			"input": cuexruntime.NativeProviderFn(func(ctx context.Context, v cue.Value) (cue.Value, error) {
 				val := v.LookupPath(cue.ParsePath("set.prefixIP"))
 				str, err := val.String()
@@ -266,6 +283,19 @@ func TestErrCases(t *testing.T) {
 				Type: "error",
 			},
 		},
+		{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:       "decode-error",
+				Type:       "decode",
+				Properties: &runtime.RawExtension{Raw: []byte(`{"replicas":"1"}`)},
+			},
+		},
+		{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name: "input-unavailable",
+				Type: "get-input",
+			},
+		},
 		{
 			WorkflowStepBase: v1alpha1.WorkflowStepBase{
 				Name: "failed-after-retries",
@@ -290,6 +320,17 @@ func TestErrCases(t *testing.T) {
 			r.Equal(operation.Waiting, false)
 			r.Equal(status.Phase, v1alpha1.WorkflowStepPhaseFailed)
 			r.Equal(status.Reason, types.StatusReasonInput)
+		case "decode-error":
+			r.Contains(status.Message, "failed to decode the properties")
+			r.Equal(operation.Terminated, true)
+			r.Equal(status.Phase, v1alpha1.WorkflowStepPhaseFailed)
+			r.Equal(status.Reason, types.StatusReasonParameter)
+		case "input-unavailable":
+			r.Contains(status.Message, "failed to get the input notReady")
+			r.Equal(operation.Terminated, false)
+			r.Equal(operation.Waiting, true)
+			r.Equal(status.Phase, v1alpha1.WorkflowStepPhaseFailed)
+			r.Equal(status.Reason, types.StatusReasonExecute)
 		case "output-var-conflict":
 			r.Contains(status.Message, "conflict")
 			r.Equal(operation.Waiting, false)
@@ -317,6 +358,196 @@ func TestErrCases(t *testing.T) {
 	}
 }
 
+func TestInputsOnRetry(t *testing.T) {
+	r := require.New(t)
+	var versions []string
+	compiler := cuex.NewCompilerWithInternalPackages(
+		pkgruntime.Must(cuexruntime.NewInternalPackage("test", "", map[string]cuexruntime.ProviderFn{
+			"deploy": cuexruntime.NativeProviderFn(func(ctx context.Context, v cue.Value) (cue.Value, error) {
+				version, err := v.LookupPath(cue.ParsePath("version")).String()
+				r.NoError(err)
+				versions = append(versions, version)
+				if version == "v1" {
+					return v, errors.New("version v1 is broken")
+				}
+				return v, nil
+			}),
+		})),
+	)
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, compiler)
+	newStep := func(rerender bool) v1alpha1.WorkflowStep {
+		return v1alpha1.WorkflowStep{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name: "deploy",
+				Type: "deploy",
+				Inputs: v1alpha1.StepInputs{{
+					From:         "version",
+					ParameterKey: "version",
+				}},
+				RerenderOnRetry: rerender,
+			},
+		}
+	}
+	start := metav1.NewTime(time.Now().Add(-time.Minute))
+	run := func(wfCtx wfContext.Context, step v1alpha1.WorkflowStep, stepStatus map[string]v1alpha1.StepStatus) v1alpha1.StepStatus {
+		gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+		r.NoError(err)
+		task, err := gen(step, &types.TaskGeneratorOptions{ID: "deploy-id"})
+		r.NoError(err)
+		status, _, err := task.Run(wfCtx, &types.TaskRunOptions{StepStatus: stepStatus})
+		r.NoError(err)
+		status.FirstExecuteTime = start
+		stepStatus[step.Name] = status
+		return status
+	}
+
+	// the retries reuse the inputs resolved by the failed attempt by default
+	wfCtx := newWorkflowContextForTest(t)
+	stepStatus := map[string]v1alpha1.StepStatus{}
+	r.NoError(wfCtx.SetVar(cuecontext.New().CompileString(`"v1"`), "version"))
+	status := run(wfCtx, newStep(false), stepStatus)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonExecute, status.Reason)
+	r.NoError(wfCtx.ReplaceVar(cuecontext.New().CompileString(`"v2"`), "version"))
+	status = run(wfCtx, newStep(false), stepStatus)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal([]string{"v1", "v1"}, versions)
+	// the restarted step resolves the inputs again
+	status = run(wfCtx, newStep(false), map[string]v1alpha1.StepStatus{})
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal([]string{"v1", "v1", "v2"}, versions)
+	r.Empty(wfCtx.GetMutableValue(types.ContextPrefixRetryInputs, "deploy"))
+
+	// the retries render the properties with the latest value of the input if the step re-renders on retry
+	versions = nil
+	wfCtx = newWorkflowContextForTest(t)
+	stepStatus = map[string]v1alpha1.StepStatus{}
+	r.NoError(wfCtx.SetVar(cuecontext.New().CompileString(`"v1"`), "version"))
+	status = run(wfCtx, newStep(true), stepStatus)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.NoError(wfCtx.ReplaceVar(cuecontext.New().CompileString(`"v2"`), "version"))
+	status = run(wfCtx, newStep(true), stepStatus)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal([]string{"v1", "v2"}, versions)
+
+	// the retry fails if the input is from a step that has failed since the step started
+	versions = nil
+	wfCtx = newWorkflowContextForTest(t)
+	stepStatus = map[string]v1alpha1.StepStatus{}
+	r.NoError(wfCtx.SetVar(cuecontext.New().CompileString(`"v1"`), "version"))
+	wfCtx.SetMutableValue("build", types.ContextPrefixOutputStep, "version")
+	status = run(wfCtx, newStep(true), stepStatus)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	stepStatus["build"] = v1alpha1.StepStatus{
+		Name:            "build",
+		Phase:           v1alpha1.WorkflowStepPhaseFailed,
+		Message:         "image not found",
+		LastExecuteTime: metav1.Now(),
+	}
+	status = run(wfCtx, newStep(true), stepStatus)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonInput, status.Reason)
+	r.Equal("the input version is from the step build that has failed: image not found", status.Message)
+	r.Equal([]string{"v1"}, versions)
+}
+
+func TestLazyInput(t *testing.T) {
+	wfCtx := newWorkflowContextForTest(t)
+	r := require.New(t)
+	var calls []string
+	compiler := cuex.NewCompilerWithInternalPackages(
+		pkgruntime.Must(cuexruntime.NewInternalPackage("test", "", map[string]cuexruntime.ProviderFn{
+			"deploy": cuexruntime.NativeProviderFn(func(ctx context.Context, v cue.Value) (cue.Value, error) {
+				version, _ := v.LookupPath(cue.ParsePath("version")).String()
+				calls = append(calls, "deploy "+version)
+				return v, nil
+			}),
+			"notify": cuexruntime.NativeProviderFn(func(ctx context.Context, v cue.Value) (cue.Value, error) {
+				calls = append(calls, "notify")
+				return v, nil
+			}),
+		})),
+	)
+	templates := map[string]string{
+		"deploy": `
+parameter: version: *"v0" | string
+deploy: {
+	#provider: "test"
+	#do: "deploy"
+	version: parameter.version
+}
+`,
+		"notify": `
+parameter: version: *"v0" | string
+wait: {
+	#provider: "test"
+	#do: "notify"
+	ready: parameter.version != _|_
+}
+`,
+	}
+	loadTemplate := func(_ context.Context, name string) (string, error) {
+		return templates[name], nil
+	}
+	newStep := func(typ string) v1alpha1.WorkflowStep {
+		return v1alpha1.WorkflowStep{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name: typ,
+				Type: typ,
+				Inputs: v1alpha1.StepInputs{{
+					From:         "version",
+					ParameterKey: "version",
+					Lazy:         true,
+				}},
+			},
+		}
+	}
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(loadTemplate, 0, pCtx, compiler)
+	newTask := func(step v1alpha1.WorkflowStep) types.TaskRunner {
+		gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+		r.NoError(err)
+		task, err := gen(step, &types.TaskGeneratorOptions{ID: step.Name + "-id"})
+		r.NoError(err)
+		return task
+	}
+
+	// the step doesn't wait for the lazy input to start
+	p, _ := newTask(newStep("deploy")).Pending(monitorContext.NewTraceContext(context.Background(), "test-app"), wfCtx, nil)
+	r.False(p)
+	// the step waits for the lazy input read by the provider before any provider runs, the default value of the
+	// parameter is not used
+	status, _, err := newTask(newStep("deploy")).Run(wfCtx, &types.TaskRunOptions{})
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+	r.Equal(types.StatusReasonWait, status.Reason)
+	r.Equal("Waiting for the lazy inputs: version", status.Message)
+	r.Empty(calls)
+	r.Equal(map[string]string{"version": "version"}, hooks.GetUnresolvedLazyInputs(wfCtx, newStep("deploy")))
+	// the providers that don't read the lazy input run, but the step can't succeed without it
+	status, _, err = newTask(newStep("notify")).Run(wfCtx, &types.TaskRunOptions{})
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonInput, status.Reason)
+	r.Contains(status.Message, "the lazy input version is still unavailable")
+	r.Equal([]string{"notify"}, calls)
+
+	// the lazy input is resolved once it's available
+	r.NoError(wfCtx.SetVar(cuecontext.New().CompileString(`"v2"`), "version"))
+	status, _, err = newTask(newStep("deploy")).Run(wfCtx, &types.TaskRunOptions{})
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal([]string{"notify", "deploy v2"}, calls)
+	r.Nil(hooks.GetUnresolvedLazyInputs(wfCtx, newStep("deploy")))
+}
+
 func TestPendingInputCheck(t *testing.T) {
 	wfCtx := newWorkflowContextForTest(t)
 	r := require.New(t)
@@ -381,6 +612,381 @@ func TestPendingDependsOnCheck(t *testing.T) {
 	r.Equal(p, false)
 }
 
+func TestPendingLockCheck(t *testing.T) {
+	wfCtx := newWorkflowContextForTest(t)
+	r := require.New(t)
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "pending",
+			Type: "ok",
+			Lock: "db",
+		},
+	}
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, providers.DefaultCompiler.Get())
+	gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+	r.NoError(err)
+	run, err := gen(step, &types.TaskGeneratorOptions{LockPeers: func() []string { return []string{"holder"} }})
+	r.NoError(err)
+	logCtx := monitorContext.NewTraceContext(context.Background(), "test-app")
+	p, _ := run.Pending(logCtx, wfCtx, nil)
+	r.Equal(p, false)
+
+	ss := map[string]v1alpha1.StepStatus{
+		"holder": {
+			Phase: v1alpha1.WorkflowStepPhaseRunning,
+		},
+	}
+	p, status := run.Pending(logCtx, wfCtx, ss)
+	r.Equal(p, true)
+	r.Equal(status.Message, "Pending on Lock: db held by holder")
+
+	// the step that already holds the lock is not blocked
+	ss["pending"] = v1alpha1.StepStatus{Phase: v1alpha1.WorkflowStepPhaseRunning}
+	p, _ = run.Pending(logCtx, wfCtx, ss)
+	r.Equal(p, false)
+
+	ss["pending"] = v1alpha1.StepStatus{Phase: v1alpha1.WorkflowStepPhasePending}
+	ss["holder"] = v1alpha1.StepStatus{Phase: v1alpha1.WorkflowStepPhaseSucceeded}
+	p, _ = run.Pending(logCtx, wfCtx, ss)
+	r.Equal(p, false)
+}
+
+func TestPendingExecutionWindowCheck(t *testing.T) {
+	wfCtx := newWorkflowContextForTest(t)
+	r := require.New(t)
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "pending",
+			Type: "ok",
+			ExecutionWindow: &v1alpha1.ExecutionWindow{
+				Timezone: "Asia/Shanghai",
+				Ranges:   []v1alpha1.TimeRange{{Days: []string{"Sat"}, Start: "22:00", End: "02:00"}},
+			},
+		},
+	}
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, providers.DefaultCompiler.Get())
+	gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+	r.NoError(err)
+	run, err := gen(step, &types.TaskGeneratorOptions{})
+	r.NoError(err)
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	r.NoError(err)
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 6, 21, 59, 0, 0, loc))
+	logCtx := monitorContext.NewTraceContext(context.Background(), "test-app")
+	logCtx.SetContext(providertypes.WithClock(logCtx.GetContext(), fakeClock))
+
+	// Saturday 21:59 is before the window
+	p, status := run.Pending(logCtx, wfCtx, nil)
+	r.Equal(p, true)
+	r.Equal(status.Message, "Pending on ExecutionWindow: Sat 22:00-02:00 (Asia/Shanghai)")
+
+	fakeClock.Step(time.Minute)
+	p, _ = run.Pending(logCtx, wfCtx, nil)
+	r.Equal(p, false)
+
+	// Sunday 01:59 is in the window started on Saturday
+	fakeClock.SetTime(time.Date(2024, 1, 7, 1, 59, 0, 0, loc))
+	p, _ = run.Pending(logCtx, wfCtx, nil)
+	r.Equal(p, false)
+
+	fakeClock.Step(time.Minute)
+	p, _ = run.Pending(logCtx, wfCtx, nil)
+	r.Equal(p, true)
+
+	// the started step is not interrupted when the window closes
+	ss := map[string]v1alpha1.StepStatus{
+		"pending": {Phase: v1alpha1.WorkflowStepPhaseRunning},
+	}
+	p, _ = run.Pending(logCtx, wfCtx, ss)
+	r.Equal(p, false)
+
+	// the window is evaluated in its time zone, Saturday 22:30 in UTC is Sunday in Shanghai
+	fakeClock.SetTime(time.Date(2024, 1, 6, 22, 30, 0, 0, time.UTC))
+	p, _ = run.Pending(logCtx, wfCtx, nil)
+	r.Equal(p, true)
+}
+
+func TestOperationTimeout(t *testing.T) {
+	r := require.New(t)
+	compiler := cuex.NewCompilerWithInternalPackages(
+		pkgruntime.Must(cuexruntime.NewInternalPackage("test", "", map[string]cuexruntime.ProviderFn{
+			"slow": cuexruntime.NativeProviderFn(func(ctx context.Context, v cue.Value) (cue.Value, error) {
+				<-ctx.Done()
+				return v, ctx.Err()
+			}),
+		})),
+	)
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, compiler)
+	run := func(operationTimeout string) (v1alpha1.StepStatus, *types.Operation) {
+		step := v1alpha1.WorkflowStep{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:             "slow",
+				Type:             "slow",
+				OperationTimeout: operationTimeout,
+			},
+		}
+		gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+		r.NoError(err)
+		runner, err := gen(step, &types.TaskGeneratorOptions{ID: "slow-id"})
+		r.NoError(err)
+		status, operation, err := runner.Run(newWorkflowContextForTest(t), &types.TaskRunOptions{})
+		r.NoError(err)
+		return status, operation
+	}
+
+	// the timed out execution is retried
+	status, operation := run("100ms")
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonExecute, status.Reason)
+	r.Contains(status.Message, "context deadline exceeded")
+	r.True(operation.Waiting)
+	r.False(operation.Terminated)
+
+	status, operation = run("invalid")
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonParameter, status.Reason)
+	r.Contains(status.Message, "invalid operation timeout")
+	r.True(operation.Terminated)
+}
+
+func TestCancellation(t *testing.T) {
+	r := require.New(t)
+	compiler := cuex.NewCompilerWithInternalPackages(
+		pkgruntime.Must(cuexruntime.NewInternalPackage("test", "", map[string]cuexruntime.ProviderFn{
+			"slow": cuexruntime.NativeProviderFn(func(ctx context.Context, v cue.Value) (cue.Value, error) {
+				<-ctx.Done()
+				return v, ctx.Err()
+			}),
+		})),
+	)
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, compiler)
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "slow",
+			Type: "slow",
+		},
+	}
+	gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+	r.NoError(err)
+	runner, err := gen(step, &types.TaskGeneratorOptions{ID: "cancel-id"})
+	r.NoError(err)
+
+	// the execution is cancelled once the time left before the step times out is used up
+	status, _, err := runner.Run(newWorkflowContextForTest(t), &types.TaskRunOptions{
+		PreCheckHooks: []types.TaskPreCheckHook{
+			func(step v1alpha1.WorkflowStep, options *types.PreCheckOptions) (*types.PreCheckResult, error) {
+				return &types.PreCheckResult{TimeLeft: 100 * time.Millisecond}, nil
+			},
+		},
+	})
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Contains(status.Message, "context deadline exceeded")
+
+	// the execution is cancelled by the cancel signal of the run, e.g. when the run is terminated
+	signal, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	status, _, err = runner.Run(newWorkflowContextForTest(t), &types.TaskRunOptions{
+		GetTracer: func(id string, step v1alpha1.WorkflowStep) monitorContext.Context {
+			return monitorContext.NewTraceContext(providertypes.WithCancelSignal(context.Background(), signal), "")
+		},
+	})
+	r.NoError(err)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Contains(status.Message, "context canceled")
+}
+
+func TestContinuationToken(t *testing.T) {
+	r := require.New(t)
+	var polled []string
+	compiler := cuex.NewCompilerWithInternalPackages(
+		pkgruntime.Must(cuexruntime.NewInternalPackage("test", "", map[string]cuexruntime.ProviderFn{
+			"async": providertypes.LegacyGenericProviderFn[any, any](func(ctx context.Context, val *providertypes.LegacyParams[any]) (*any, error) {
+				token := val.RuntimeParams.Action.GetStatus().ContinuationToken
+				polled = append(polled, token)
+				switch token {
+				case "":
+					val.RuntimeParams.Action.(types.ActionContinuer).ContinuationToken("op-1")
+					val.RuntimeParams.Action.Wait("the operation is started")
+				case "op-1":
+					if len(polled) == 2 {
+						return nil, fmt.Errorf("failed to poll the operation")
+					}
+				}
+				return nil, nil
+			}),
+		})),
+	)
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, compiler)
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "async",
+			Type: "async",
+		},
+	}
+	gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+	r.NoError(err)
+	wfCtx := newWorkflowContextForTest(t)
+	run := func(previous v1alpha1.StepStatus) v1alpha1.StepStatus {
+		runner, err := gen(step, &types.TaskGeneratorOptions{ID: "async-id"})
+		r.NoError(err)
+		status, _, err := runner.Run(wfCtx, &types.TaskRunOptions{StepStatus: map[string]v1alpha1.StepStatus{step.Name: previous}})
+		r.NoError(err)
+		return status
+	}
+
+	status := run(v1alpha1.StepStatus{})
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+	r.Equal("op-1", status.ContinuationToken)
+
+	// the token is kept if the polling is failed
+	status = run(status)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal("op-1", status.ContinuationToken)
+
+	// the token is cleared once the step is finished
+	status = run(status)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Empty(status.ContinuationToken)
+	r.Equal([]string{"", "op-1", "op-1"}, polled)
+}
+
+func TestMetadata(t *testing.T) {
+	r := require.New(t)
+	calls := 0
+	compiler := cuex.NewCompilerWithInternalPackages(
+		pkgruntime.Must(cuexruntime.NewInternalPackage("test", "", map[string]cuexruntime.ProviderFn{
+			"job": providertypes.LegacyGenericProviderFn[any, any](func(ctx context.Context, val *providertypes.LegacyParams[any]) (*any, error) {
+				calls++
+				if calls == 1 {
+					val.RuntimeParams.Action.(types.ActionMetadataReporter).Metadata(map[string]string{"jobURL": "https://ci.example.com/jobs/1", "attempt": "1"})
+					val.RuntimeParams.Action.Wait("the job is running")
+					return nil, nil
+				}
+				val.RuntimeParams.Action.(types.ActionMetadataReporter).Metadata(map[string]string{"attempt": "2", "log": strings.Repeat("a", 100)})
+				return nil, nil
+			}),
+		})),
+	)
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, compiler)
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "job",
+			Type: "job",
+		},
+	}
+	gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+	r.NoError(err)
+	wfCtx := newWorkflowContextForTest(t)
+	run := func(previous v1alpha1.StepStatus) v1alpha1.StepStatus {
+		runner, err := gen(step, &types.TaskGeneratorOptions{ID: "job-id"})
+		r.NoError(err)
+		status, _, err := runner.Run(wfCtx, &types.TaskRunOptions{StepStatus: map[string]v1alpha1.StepStatus{step.Name: previous}})
+		r.NoError(err)
+		return status
+	}
+
+	status := run(v1alpha1.StepStatus{})
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+	r.Equal(map[string]string{"jobURL": "https://ci.example.com/jobs/1", "attempt": "1"}, status.Metadata)
+
+	// the metadata of the previous executions is kept, and the entries beyond the limit are dropped
+	defer func(size int) { types.MaxStepMetadataSize = size }(types.MaxStepMetadataSize)
+	types.MaxStepMetadataSize = 64
+	status = run(status)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal(map[string]string{"jobURL": "https://ci.example.com/jobs/1", "attempt": "2"}, status.Metadata)
+}
+
+func TestIdempotencyToken(t *testing.T) {
+	r := require.New(t)
+	var tokens []string
+	compiler := cuex.NewCompilerWithInternalPackages(
+		pkgruntime.Must(cuexruntime.NewInternalPackage("test", "", map[string]cuexruntime.ProviderFn{
+			"ticket": providertypes.LegacyGenericProviderFn[any, any](func(ctx context.Context, val *providertypes.LegacyParams[any]) (*any, error) {
+				tokens = append(tokens, val.RuntimeParams.IdempotencyToken)
+				// the token is exposed in the context of the step as well
+				r.Equal(val.RuntimeParams.IdempotencyToken, val.ProcessContext.GetData(model.ContextIdempotencyToken))
+				if len(tokens) == 1 {
+					return nil, fmt.Errorf("the ticket system is unavailable")
+				}
+				return nil, nil
+			}),
+		})),
+	)
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, compiler)
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name: "ticket",
+			Type: "ticket",
+		},
+	}
+	gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+	r.NoError(err)
+	wfCtx := newWorkflowContextForTest(t)
+	run := func(previous v1alpha1.StepStatus) v1alpha1.StepStatus {
+		runner, err := gen(step, &types.TaskGeneratorOptions{ID: "ticket-id"})
+		r.NoError(err)
+		ctx := monitorContext.NewTraceContext(providertypes.WithRunUID(context.Background(), "run-uid"), "")
+		status, _, err := runner.Run(wfCtx, &types.TaskRunOptions{
+			StepStatus: map[string]v1alpha1.StepStatus{step.Name: previous},
+			GetTracer: func(id string, step v1alpha1.WorkflowStep) monitorContext.Context {
+				return ctx
+			},
+		})
+		r.NoError(err)
+		return status
+	}
+
+	// the retry of the failed step is in the same attempt
+	status := run(v1alpha1.StepStatus{})
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(0, status.Attempt)
+	status = run(status)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal(0, status.Attempt)
+
+	// the finished step executed again starts a new attempt
+	status = run(status)
+	r.Equal(1, status.Attempt)
+	r.Equal([]string{
+		providertypes.NewIdempotencyToken("run-uid", "ticket-id", 0),
+		providertypes.NewIdempotencyToken("run-uid", "ticket-id", 0),
+		providertypes.NewIdempotencyToken("run-uid", "ticket-id", 1),
+	}, tokens)
+	r.NotEqual(tokens[0], tokens[2])
+	r.Len(tokens[0], 64)
+	r.Nil(pCtx.GetData(model.ContextIdempotencyToken))
+}
+
 func TestSkip(t *testing.T) {
 	r := require.New(t)
 	step := v1alpha1.WorkflowStep{
@@ -450,6 +1056,114 @@ func TestTimeout(t *testing.T) {
 	r.Equal(status.Reason, types.StatusReasonTimeout)
 }
 
+func TestPreCondition(t *testing.T) {
+	compiler := cuex.NewCompilerWithInternalPackages(
+		// legacy packages
+		pkgruntime.Must(cuexruntime.NewInternalPackage("test", "", map[string]cuexruntime.ProviderFn{
+			"ok": providertypes.LegacyGenericProviderFn[any, any](func(ctx context.Context, val *providertypes.LegacyParams[any]) (*any, error) {
+				return nil, nil
+			}),
+		})),
+	)
+	pCtx := process.NewContext(process.ContextData{
+		Name:      "app",
+		Namespace: "default",
+	})
+	testCases := map[string]struct {
+		preCondition string
+		status       map[string]v1alpha1.StepStatus
+		phase        v1alpha1.WorkflowStepPhase
+		reason       string
+		message      string
+	}{
+		"met": {
+			preCondition: `parameter.key == "value"`,
+			phase:        v1alpha1.WorkflowStepPhaseSucceeded,
+		},
+		"not met": {
+			preCondition: `parameter.key == "other"`,
+			phase:        v1alpha1.WorkflowStepPhaseFailed,
+			reason:       types.StatusReasonPreconditionFailed,
+			message:      `the precondition parameter.key == "other" is not met`,
+		},
+		"invalid": {
+			preCondition: `parameter.missing == "value"`,
+			phase:        v1alpha1.WorkflowStepPhaseFailed,
+			reason:       types.StatusReasonPreconditionFailed,
+			message:      `invalid precondition parameter.missing == "value"`,
+		},
+		"not checked for the running step": {
+			preCondition: `parameter.key == "other"`,
+			status:       map[string]v1alpha1.StepStatus{"precondition": {Phase: v1alpha1.WorkflowStepPhaseRunning}},
+			phase:        v1alpha1.WorkflowStepPhaseSucceeded,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			step := v1alpha1.WorkflowStep{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{
+					Name:         "precondition",
+					Type:         "ok",
+					PreCondition: tc.preCondition,
+					Properties:   &runtime.RawExtension{Raw: []byte(`{"key":"value"}`)},
+				},
+			}
+			tasksLoader := NewTaskLoader(mockLoadTemplate, 0, pCtx, compiler)
+			gen, err := tasksLoader.GetTaskGenerator(context.Background(), step.Type)
+			r.NoError(err)
+			runner, err := gen(step, &types.TaskGeneratorOptions{ID: "precondition-" + name})
+			r.NoError(err)
+			status, operations, err := runner.Run(newWorkflowContextForTest(t), &types.TaskRunOptions{StepStatus: tc.status})
+			r.NoError(err)
+			r.Equal(tc.phase, status.Phase)
+			r.Equal(tc.reason, status.Reason)
+			r.Contains(status.Message, tc.message)
+			r.Equal(tc.reason != "", operations.Terminated)
+		})
+	}
+}
+
+func TestCheckImportsWithConfigMapPackage(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	compiler := cuex.NewCompilerWithInternalPackages()
+	templ := `import (
+	"strings"
+	"team.org/common"
+)
+
+replicas: common.replicas
+name:     strings.ToUpper("app")
+`
+	err := CheckImports(compiler, templ)
+	r.Error(err)
+	r.Contains(err.Error(), `cannot find package "team.org/common"`)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "common",
+			Namespace:   "vela-system",
+			Labels:      map[string]string{types.LabelCUEPackage: "true"},
+			Annotations: map[string]string{types.AnnotationCUEPackagePath: "team.org/common"},
+		},
+		Data: map[string]string{"common.cue": "package common\nreplicas: 3"},
+	}
+	cli := clientfake.NewClientBuilder().WithObjects(cm).Build()
+	loader := providers.NewConfigMapPackageLoader()
+	r.NoError(loader.Load(ctx, compiler, cli, "vela-system"))
+	r.NoError(CheckImports(compiler, templ))
+	v, err := compiler.CompileString(ctx, templ)
+	r.NoError(err)
+	replicas, err := v.LookupPath(cue.ParsePath("replicas")).Int64()
+	r.NoError(err)
+	r.Equal(int64(3), replicas)
+
+	r.NoError(cli.Delete(ctx, cm))
+	r.NoError(loader.Load(ctx, compiler, cli, "vela-system"))
+	r.Error(CheckImports(compiler, templ))
+}
+
 func TestValidateIfValue(t *testing.T) {
 	ctx := newWorkflowContextForTest(t)
 	pCtx := process.NewContext(process.ContextData{
@@ -633,6 +1347,101 @@ func TestValidateIfValue(t *testing.T) {
 	}
 }
 
+func TestRenderStatusMessage(t *testing.T) {
+	taskv := cuecontext.New().CompileString(`
+output: {
+	version: "v1.2.0"
+	replicas: 3
+	token: "s3cr3t"
+}
+`)
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Outputs: v1alpha1.StepOutputs{
+				{Name: "version", ValueFrom: "output.version"},
+				{Name: "replicas", ValueFrom: "output.replicas"},
+				{Name: "notFound", ValueFrom: "output.notFound"},
+				{Name: "token", ValueFrom: "output.token", Sensitive: true},
+			},
+		},
+	}
+	testCases := map[string]struct {
+		message  string
+		expected string
+	}{
+		"static message": {
+			message:  "Deployed",
+			expected: "Deployed",
+		},
+		"render outputs": {
+			message:  "Deployed version {{ output.version }} with {{output.replicas}} replicas",
+			expected: "Deployed version v1.2.0 with 3 replicas",
+		},
+		"render expressions": {
+			message:  "{{ output.replicas * 2 }} pods",
+			expected: "6 pods",
+		},
+		"redact sensitive outputs": {
+			message:  "Issued token {{ output.token }}",
+			expected: "Issued token <redacted>",
+		},
+		"fallback to the raw message": {
+			message:  "Deployed version {{ output.version }} of {{ output.notFound }}",
+			expected: "Deployed version {{ output.version }} of {{ output.notFound }}",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, RenderStatusMessage(taskv, step, tc.message))
+		})
+	}
+	require.Equal(t, "{{ output.version }}", RenderStatusMessage(cue.Value{}, step, "{{ output.version }}"))
+}
+
+func TestRedactSensitiveOutputs(t *testing.T) {
+	r := require.New(t)
+	taskv := cuecontext.New().CompileString(`
+output: {
+	token: "s3cr3t"
+	config: {key: "value"}
+	version: "v1.2.0"
+}
+`)
+	step := v1alpha1.WorkflowStep{
+		WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Outputs: v1alpha1.StepOutputs{
+				{Name: "token", ValueFrom: "output.token", Sensitive: true},
+				{Name: "config", ValueFrom: "output.config", Sensitive: true},
+				{Name: "version", ValueFrom: "output.version"},
+			},
+		},
+	}
+	r.Equal("failed to login with <redacted> and <redacted> for v1.2.0",
+		RedactSensitiveOutputs(taskv, step, `failed to login with s3cr3t and {"key":"value"} for v1.2.0`))
+	r.Equal("", RedactSensitiveOutputs(taskv, step, ""))
+
+	redacted, err := RedactSensitiveValue(taskv, step)
+	r.NoError(err)
+	s, err := redacted.LookupPath(cue.ParsePath("output.token")).String()
+	r.NoError(err)
+	r.Equal(types.RedactedValue, s)
+	s, err = redacted.LookupPath(cue.ParsePath("output.config")).String()
+	r.NoError(err)
+	r.Equal(types.RedactedValue, s)
+	s, err = redacted.LookupPath(cue.ParsePath("output.version")).String()
+	r.NoError(err)
+	r.Equal("v1.2.0", s)
+	// the original value is not changed
+	s, err = taskv.LookupPath(cue.ParsePath("output.token")).String()
+	r.NoError(err)
+	r.Equal("s3cr3t", s)
+
+	// the sensitive output read by the script can not be redacted
+	step.Outputs = v1alpha1.StepOutputs{{Name: "token", ValueFrom: `output.token + "-suffix"`, Sensitive: true}}
+	_, err = RedactSensitiveValue(taskv, step)
+	r.Error(err)
+}
+
 func newWorkflowContextForTest(t *testing.T) wfContext.Context {
 	r := require.New(t)
 	cm := corev1.ConfigMap{}
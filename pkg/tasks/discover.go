@@ -18,16 +18,74 @@ package tasks
 
 import (
 	"context"
+	"sort"
+	"strings"
 
-	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 
 	monitorContext "github.com/kubevela/pkg/monitor/context"
 
 	"github.com/kubevela/workflow/pkg/tasks/builtin"
 	"github.com/kubevela/workflow/pkg/tasks/custom"
+	"github.com/kubevela/workflow/pkg/tasks/template"
 	"github.com/kubevela/workflow/pkg/types"
 )
 
+// builtinStepType is the step type executed by the builtin task generator instead of a template
+type builtinStepType struct {
+	generator types.TaskGenerator
+	info      types.StepTypeInfo
+}
+
+// builtinStepTypes are the step types executed by the builtin task generators
+var builtinStepTypes = []builtinStepType{
+	{
+		generator: builtin.StepGroup,
+		info: types.StepTypeInfo{
+			Name:        types.WorkflowStepTypeStepGroup,
+			Description: "Group the sub steps and execute them in the step or DAG mode",
+		},
+	},
+}
+
+const (
+	// descriptionMarker is the marker of the description in the header comments of the template
+	descriptionMarker = "// +description="
+	// sideEffectsMarker is the marker that indicates whether the step has side effects in the header comments of the template
+	sideEffectsMarker = "// +sideEffects="
+)
+
+// ListStepTypes returns the step types registered in the build, including the builtin task generators and
+// the templates built in, sorted by name. The step types defined by the WorkflowStepDefinitions are not included.
+func ListStepTypes() []types.StepTypeInfo {
+	var infos []types.StepTypeInfo
+	for _, t := range builtinStepTypes {
+		infos = append(infos, t.info)
+	}
+	// the templates are embedded in the build, so they can always be read
+	templates, _ := template.ListStaticTemplates()
+	for name, templ := range templates {
+		// the step has side effects unless it's declared explicitly
+		info := types.StepTypeInfo{Name: name, SideEffects: true}
+		for _, line := range strings.Split(templ, "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "//") {
+				break
+			}
+			if description, ok := strings.CutPrefix(line, descriptionMarker); ok {
+				info.Description = strings.TrimSpace(description)
+			}
+			if sideEffects, ok := strings.CutPrefix(line, sideEffectsMarker); ok {
+				info.SideEffects = strings.TrimSpace(sideEffects) != "false"
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
 type taskDiscover struct {
 	builtin            map[string]types.TaskGenerator
 	customTaskDiscover *custom.TaskLoader
@@ -35,10 +93,12 @@ type taskDiscover struct {
 
 // NewTaskDiscover new task discover
 func NewTaskDiscover(ctx monitorContext.Context, options types.StepGeneratorOptions) types.TaskDiscover { //nolint:revive,unused
+	builtins := make(map[string]types.TaskGenerator)
+	for _, t := range builtinStepTypes {
+		builtins[t.info.Name] = t.generator
+	}
 	return &taskDiscover{
-		builtin: map[string]types.TaskGenerator{
-			types.WorkflowStepTypeStepGroup: builtin.StepGroup,
-		},
+		builtin:            builtins,
 		customTaskDiscover: custom.NewTaskLoader(options.TemplateLoader.LoadTemplate, options.LogLevel, options.ProcessCtx, options.Compiler),
 	}
 }
@@ -53,10 +113,15 @@ func (td *taskDiscover) GetTaskGenerator(ctx context.Context, name string) (type
 		var err error
 		tg, err = td.customTaskDiscover.GetTaskGenerator(ctx, name)
 		if err != nil {
+			// neither the template nor the definition of the step type is found, there's no definition either if
+			// the CRD of the definitions is not installed
+			if kerrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				return nil, &types.UnknownStepTypeError{Type: name}
+			}
 			return nil, err
 		}
 		return tg, nil
 
 	}
-	return nil, errors.Errorf("can't find task generator: %s", name)
+	return nil, &types.UnknownStepTypeError{Type: name}
 }
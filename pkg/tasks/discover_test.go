@@ -18,14 +18,40 @@ package tasks
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	cuexv1alpha1 "github.com/kubevela/pkg/apis/cue/v1alpha1"
+	"github.com/kubevela/pkg/util/singleton"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
 	"github.com/kubevela/workflow/pkg/cue/process"
+	"github.com/kubevela/workflow/pkg/objectwatch"
+	"github.com/kubevela/workflow/pkg/providers"
+	"github.com/kubevela/workflow/pkg/providers/exec"
+	"github.com/kubevela/workflow/pkg/providers/external"
 	"github.com/kubevela/workflow/pkg/tasks/builtin"
 	"github.com/kubevela/workflow/pkg/tasks/custom"
+	"github.com/kubevela/workflow/pkg/tasks/template"
 	"github.com/kubevela/workflow/pkg/types"
 )
 
@@ -41,6 +67,8 @@ func TestDiscover(t *testing.T) {
 			return "", nil
 		case "crazy":
 			return "", nil
+		case "missing":
+			return "", kerrors.NewNotFound(schema.GroupResource{Group: "core.oam.dev", Resource: "workflowstepdefinitions"}, name)
 		default:
 			return "", makeErr(name)
 		}
@@ -63,5 +91,439 @@ func TestDiscover(t *testing.T) {
 	r.NoError(err)
 	_, err = discover.GetTaskGenerator(context.Background(), "fly")
 	r.Equal(err.Error(), makeErr("fly").Error())
+	r.False(types.IsUnknownStepType(err))
+	_, err = discover.GetTaskGenerator(context.Background(), "missing")
+	r.True(types.IsUnknownStepType(err))
+	r.Equal(`unknown step type "missing", no builtin step type, template or WorkflowStepDefinition is found for it`, err.Error())
+
+}
+
+func TestListStepTypes(t *testing.T) {
+	r := require.New(t)
+	infos := ListStepTypes()
+	r.Equal([]types.StepTypeInfo{
+		{Name: types.WorkflowStepTypeAssert, Description: "Check the assertions of the values, the step fails with the differences between the expected and actual values"},
+		{Name: types.WorkflowStepTypeBuiltinApplyComponent, Description: "Apply the component and its traits", SideEffects: true},
+		{Name: types.WorkflowStepTypeDelay, Description: "Wait for the duration with an optional jitter and then succeed, the delay is computed since the step is first executed"},
+		{Name: types.WorkflowStepTypeExec, Description: "Run the command in a pod and capture its logs, the step fails if the command exits with a non-zero code", SideEffects: true},
+		{Name: types.WorkflowStepTypeExternal, Description: "Call the registered external executor over JSON-RPC, the executor is polled until the step is succeeded or failed", SideEffects: true},
+		{Name: types.WorkflowStepTypeGen, Description: "Generate the values such as the passwords and the suffixes, the values are persisted and reused by the later executions of the step"},
+		{Name: types.WorkflowStepTypeHelmRender, Description: "Render the helm chart with the values in a pod, the rendered manifests are returned as the objects"},
+		{Name: types.WorkflowStepTypeKustomizeRender, Description: "Render the kustomize base with the overlays in a pod, the rendered manifests are returned as the objects"},
+		{Name: types.WorkflowStepTypeReconcile, Description: "Compare the desired resources with the live resources and report the drift, the drifted resources are applied again in the enforce mode", SideEffects: true},
+		{Name: types.WorkflowStepTypeSetStatus, Description: "Set the custom status of the workflow run"},
+		{Name: types.WorkflowStepTypeStepGroup, Description: "Group the sub steps and execute them in the step or DAG mode"},
+		{Name: types.WorkflowStepTypeSuspend, Description: "Suspend the workflow run until it is resumed or the duration is reached"},
+		{Name: types.WorkflowStepTypeTerminate, Description: "Terminate the workflow with the status and the message, the remaining steps are skipped and the workflow is succeeded if the status is succeeded"},
+		{Name: types.WorkflowStepTypeWaitFor, Description: "Wait until the resource meets the condition by watching it instead of polling, the step fails if the resource is failed"},
+	}, infos)
+
+	// all the listed step types are executable
+	discover := NewTaskDiscover(nil, types.StepGeneratorOptions{TemplateLoader: template.NewWorkflowStepTemplateLoader()})
+	for _, info := range infos {
+		_, err := discover.GetTaskGenerator(context.Background(), info.Name)
+		r.NoError(err, info.Name)
+	}
+}
+
+// stepRunner runs the step of the step type in the context of the app
+type stepRunner func(step v1alpha1.WorkflowStepBase, id string, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation)
+
+// newStepRunner sets the fake clients with cli and returns the context of the app and the runner of the step type,
+// the runner is generated in every run as it is in every reconcile
+func newStepRunner(t *testing.T, cli client.Client, stepType string) (wfContext.Context, stepRunner) {
+	r := require.New(t)
+	ctx := context.Background()
+	singleton.KubeClient.Set(cli)
+	scheme := runtime.NewScheme()
+	r.NoError(cuexv1alpha1.AddToScheme(scheme))
+	singleton.DynamicClient.Set(dynamicfake.NewSimpleDynamicClient(scheme))
+	wfCtx, err := wfContext.NewContext(ctx, "default", "app", nil)
+	r.NoError(err)
+	discover := NewTaskDiscover(nil, types.StepGeneratorOptions{
+		TemplateLoader: template.NewWorkflowStepTemplateLoader(),
+		ProcessCtx:     process.NewContext(process.ContextData{Name: "app", Namespace: "default"}),
+		Compiler:       providers.DefaultCompiler.Get(),
+	})
+	gen, err := discover.GetTaskGenerator(ctx, stepType)
+	r.NoError(err)
+	return wfCtx, func(step v1alpha1.WorkflowStepBase, id string, options *types.TaskRunOptions) (v1alpha1.StepStatus, *types.Operation) {
+		step.Type = stepType
+		runner, err := gen(v1alpha1.WorkflowStep{WorkflowStepBase: step}, &types.TaskGeneratorOptions{ID: id})
+		r.NoError(err)
+		if options == nil {
+			options = &types.TaskRunOptions{}
+		}
+		status, operation, err := runner.Run(wfCtx, options)
+		r.NoError(err)
+		return status, operation
+	}
+}
+
+func TestRenderStepTypes(t *testing.T) {
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+	readLogs := exec.ReadLogs
+	defer func() { exec.ReadLogs = readLogs }()
+	exec.ReadLogs = func(ctx context.Context, namespace, name string, tailLines int64) (string, error) {
+		return "---\n# Source: app/templates/cm.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: app\n", nil
+	}
+
+	testCases := map[string]struct {
+		properties string
+		command    string
+		args       []string
+		env        string
+		message    string
+		failure    string
+	}{
+		types.WorkflowStepTypeHelmRender: {
+			properties: `{"chart":"app","repo":"https://charts.example.com","version":"1.0.0","values":{"replicas":2}}`,
+			command:    "exec helm",
+			args:       []string{"helm", "template", "app", "app", "--version", "1.0.0", "--namespace", "default", "--repo", "https://charts.example.com", "--include-crds"},
+			env:        `{"replicas":2}`,
+			message:    "Error: chart not found",
+			failure:    "Failed to render the chart app: Error: chart not found",
+		},
+		types.WorkflowStepTypeKustomizeRender: {
+			properties: `{"base":"https://github.com/org/repo//deploy?ref=v1.0.0","namePrefix":"dev-","images":[{"name":"nginx","newTag":"1.25"}]}`,
+			command:    "exec kustomize build /tmp/render",
+			args:       []string{},
+			env:        `{"apiVersion":"kustomize.config.k8s.io/v1beta1","kind":"Kustomization","resources":["https://github.com/org/repo//deploy?ref=v1.0.0"],"namePrefix":"dev-","images":[{"name":"nginx","newTag":"1.25"}]}`,
+			message:    "Error: accumulating resources",
+			failure:    "Failed to render the base https://github.com/org/repo//deploy?ref=v1.0.0: Error: accumulating resources",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			wfCtx, runStep := newStepRunner(t, cli, name)
+			run := func(id, properties string) v1alpha1.StepStatus {
+				status, _ := runStep(v1alpha1.WorkflowStepBase{
+					Name:       name,
+					Properties: &runtime.RawExtension{Raw: []byte(properties)},
+					Outputs:    v1alpha1.StepOutputs{{Name: name + "-objects", ValueFrom: "objects"}},
+				}, id, nil)
+				return status
+			}
+			setPhase := func(podName string, phase corev1.PodPhase, message string) {
+				pod := &corev1.Pod{}
+				r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: podName}, pod))
+				pod.Status.Phase = phase
+				if message != "" {
+					pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+						Name:  "exec",
+						State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Message: message}},
+					}}
+				}
+				r.NoError(cli.Status().Update(ctx, pod))
+			}
+			status := run(name, tc.properties)
+			r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+			r.Equal("Waiting for the pod to start", status.Message)
+
+			pod := &corev1.Pod{}
+			r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-" + name + "-0"}, pod))
+			container := pod.Spec.Containers[0]
+			r.Contains(container.Command[2], tc.command)
+			r.Equal(tc.args, append(container.Command[3:], container.Args...))
+			r.JSONEq(tc.env, container.Env[0].Value)
+
+			setPhase("app-"+name+"-0", corev1.PodSucceeded, "")
+			status = run(name, tc.properties)
+			r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+			objects, err := wfCtx.GetVar(name + "-objects")
+			r.NoError(err)
+			var rendered []map[string]interface{}
+			r.NoError(objects.Decode(&rendered))
+			r.Len(rendered, 2)
+			r.Equal("ConfigMap", rendered[0]["kind"])
+			r.Equal("Service", rendered[1]["kind"])
+
+			run(name+"-failed", tc.properties)
+			setPhase("app-"+name+"-failed-0", corev1.PodFailed, tc.message)
+			status = run(name+"-failed", tc.properties)
+			r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+			r.Equal(tc.failure, status.Message)
+			// the failed rendering is retried in a new pod
+			status = run(name+"-failed", tc.properties)
+			r.Equal("Waiting for the pod to start", status.Message)
+			r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "app-" + name + "-failed-1"}, pod))
+
+			// the truncated manifests are not parsed
+			limited := strings.Replace(tc.properties, "{", `{"maxManifestsSize":10,`, 1)
+			run(name+"-limited", limited)
+			setPhase("app-"+name+"-limited-0", corev1.PodSucceeded, "")
+			status = run(name+"-limited", limited)
+			r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+			r.Contains(status.Message, "exceed 10 bytes")
+		})
+	}
+}
+
+func TestAssertStepType(t *testing.T) {
+	r := require.New(t)
+	wfCtx, runStep := newStepRunner(t, fake.NewClientBuilder().Build(), types.WorkflowStepTypeAssert)
+	r.NoError(wfCtx.SetVar(cuecontext.New().CompileString(`{phase: "Pending", readyReplicas: 2}`), "pod"))
+
+	run := func(properties string) (v1alpha1.StepStatus, *types.Operation) {
+		return runStep(v1alpha1.WorkflowStepBase{
+			Name:       "assert",
+			Properties: &runtime.RawExtension{Raw: []byte(properties)},
+			Inputs: v1alpha1.StepInputs{
+				{From: "pod.phase", ParameterKey: "assertions.phase.actual"},
+				{From: "pod.readyReplicas", ParameterKey: "assertions.replicas.actual"},
+			},
+		}, "assert", nil)
+	}
+
+	status, operation := run(`{"assertions":{"phase":{"expected":"Running"},"replicas":{"condition":"actual >= 3","message":"the pods should be ready"}}}`)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonAction, status.Reason)
+	r.True(operation.Terminated)
+	r.Equal("Assertion phase failed: expected \"Running\", actual \"Pending\"; Assertion replicas failed (the pods should be ready): condition `actual >= 3` is false, actual 2", status.Message)
+
+	status, _ = run(`{"assertions":{"phase":{"expected":"Pending"},"replicas":{"condition":"actual >= 2"}}}`)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal("All 2 assertions passed", status.Message)
+}
+
+func TestExternalStepType(t *testing.T) {
+	r := require.New(t)
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		request := external.Request{}
+		r.NoError(json.NewDecoder(req.Body).Decode(&request))
+		r.Equal("deploy", request.Params.Step.Name)
+		r.Equal("deploy-id", request.Params.Step.ID)
+		r.Equal("v2", request.Params.Properties["version"])
+		calls++
+		result := &external.ExecuteResult{Phase: external.PhaseRunning, SubPhase: "verifying", Message: "Deploying v2"}
+		switch calls {
+		case 2:
+			result = &external.ExecuteResult{Phase: external.PhaseSucceeded, Outputs: map[string]interface{}{"revision": "rev-2"}}
+		case 3:
+			result = &external.ExecuteResult{Phase: external.PhaseFailed, Message: "Rollout is aborted"}
+		}
+		r.NoError(json.NewEncoder(w).Encode(external.Response{JSONRPC: "2.0", ID: request.ID, Result: result}))
+	}))
+	defer srv.Close()
+	wfCtx, runStep := newStepRunner(t, fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: external.RegistryNamespace, Labels: map[string]string{types.LabelExternalExecutor: "true"}},
+		Data:       map[string]string{external.EndpointKey: srv.URL},
+	}).Build(), types.WorkflowStepTypeExternal)
+	r.NoError(wfCtx.SetVar(cuecontext.New().CompileString(`"v2"`), "version"))
+
+	run := func(outputs v1alpha1.StepOutputs) v1alpha1.StepStatus {
+		status, _ := runStep(v1alpha1.WorkflowStepBase{
+			Name:       "deploy",
+			Properties: &runtime.RawExtension{Raw: []byte(`{"executor":"deployer"}`)},
+			Inputs:     v1alpha1.StepInputs{{From: "version", ParameterKey: "properties.version"}},
+			Outputs:    outputs,
+		}, "deploy-id", nil)
+		return status
+	}
+
+	outputs := v1alpha1.StepOutputs{{Name: "revision", ValueFrom: "outputs.revision"}}
+	status := run(outputs)
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+	r.Equal("Deploying v2", status.Message)
+	r.Equal("verifying", status.SubPhase)
+	r.Equal("running (verifying)", status.DisplayPhase())
+
+	status = run(outputs)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Empty(status.SubPhase)
+	revision, err := wfCtx.GetVar("revision")
+	r.NoError(err)
+	s, err := revision.String()
+	r.NoError(err)
+	r.Equal("rev-2", s)
+
+	status = run(nil)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal("Rollout is aborted", status.Message)
+}
+
+func TestReconcileStepType(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "drifted", Namespace: "default"},
+		Data:       map[string]string{"key": "changed", "extra": "kept"},
+	}).Build()
+	wfCtx, runStep := newStepRunner(t, cli, types.WorkflowStepTypeReconcile)
+
+	run := func(mode string) v1alpha1.StepStatus {
+		status, _ := runStep(v1alpha1.WorkflowStepBase{
+			Name: "reconcile",
+			Properties: &runtime.RawExtension{Raw: []byte(`{"mode":"` + mode + `","objects":[
+				{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"drifted","namespace":"default"},"data":{"key":"value"}},
+				{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"missing","namespace":"default"},"data":{"key":"value"}}
+			]}`)},
+			Outputs: v1alpha1.StepOutputs{{Name: "report", ValueFrom: "report"}},
+		}, "reconcile-"+mode, nil)
+		return status
+	}
+
+	status := run("report")
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal("2 resources are drifted", status.Message)
+	report, err := wfCtx.GetVar("report")
+	r.NoError(err)
+	fields, err := report.LookupPath(cue.ParsePath("resources[0].fields")).List()
+	r.NoError(err)
+	r.True(fields.Next())
+	field, err := fields.Value().String()
+	r.NoError(err)
+	r.Equal("data.key", field)
+	missing, err := report.LookupPath(cue.ParsePath("resources[1].missing")).Bool()
+	r.NoError(err)
+	r.True(missing)
+	r.True(kerrors.IsNotFound(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "missing"}, &corev1.ConfigMap{})))
+
+	status = run("enforce")
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal("2 drifted resources are applied again", status.Message)
+	cm := &corev1.ConfigMap{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "drifted"}, cm))
+	r.Equal(map[string]string{"key": "value", "extra": "kept"}, cm.Data)
+	r.NoError(cli.Get(ctx, client.ObjectKey{Namespace: "default", Name: "missing"}, cm))
+
+	status = run("report")
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal("No drift is detected", status.Message)
+}
+
+func TestWaitForStepType(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	cli := fake.NewClientBuilder().Build()
+	objectwatch.Client.Set(cli)
+	wfCtx, runStep := newStepRunner(t, cli, types.WorkflowStepTypeWaitFor)
+
+	run := func() v1alpha1.StepStatus {
+		status, _ := runStep(v1alpha1.WorkflowStepBase{
+			Name:       "wait-db",
+			Properties: &runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"ConfigMap","name":"db","condition":"data.ready == \"true\""}`)},
+			Outputs:    v1alpha1.StepOutputs{{Name: "db", ValueFrom: "output.data"}},
+		}, "wait-db", nil)
+		return status
+	}
+
+	status := run()
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+	r.Equal(types.StatusReasonWait, status.Reason)
+	r.Equal("Waiting for ConfigMap default/db to be created", status.Message)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Data:       map[string]string{"ready": "false"},
+	}
+	r.NoError(cli.Create(ctx, cm))
+	r.Eventually(func() bool {
+		status = run()
+		return status.Message == "Waiting for ConfigMap default/db: health check `data.ready == \"true\"` is false"
+	}, 5*time.Second, 50*time.Millisecond)
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+
+	cm.Data["ready"] = "true"
+	r.NoError(cli.Update(ctx, cm))
+	r.Eventually(func() bool {
+		return run().Phase == v1alpha1.WorkflowStepPhaseSucceeded
+	}, 5*time.Second, 50*time.Millisecond)
+	db, err := wfCtx.GetVar("db")
+	r.NoError(err)
+	ready, err := db.LookupPath(cue.ParsePath("ready")).String()
+	r.NoError(err)
+	r.Equal("true", ready)
+}
+
+func TestDelayStepType(t *testing.T) {
+	r := require.New(t)
+	_, runStep := newStepRunner(t, fake.NewClientBuilder().Build(), types.WorkflowStepTypeDelay)
+
+	run := func(stepStatus map[string]v1alpha1.StepStatus) v1alpha1.StepStatus {
+		status, _ := runStep(v1alpha1.WorkflowStepBase{
+			Name:       "delay",
+			Properties: &runtime.RawExtension{Raw: []byte(`{"duration":"1m","jitter":"10s"}`)},
+		}, "delay-id", &types.TaskRunOptions{StepStatus: stepStatus})
+		return status
+	}
+
+	status := run(nil)
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, status.Phase)
+	r.Equal(types.StatusReasonWait, status.Reason)
+	r.Contains(status.Message, "Delaying until")
+
+	// the step is resumed by the first execute time in the status, e.g. after the controller restarts
+	firstExecuteTime := metav1.NewTime(time.Now().Add(-2 * time.Minute))
+	status = run(map[string]v1alpha1.StepStatus{"delay": {ID: "delay-id", FirstExecuteTime: firstExecuteTime}})
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+}
+
+func TestTerminateStepType(t *testing.T) {
+	r := require.New(t)
+	_, runStep := newStepRunner(t, fake.NewClientBuilder().Build(), types.WorkflowStepTypeTerminate)
+
+	run := func(properties string) (v1alpha1.StepStatus, *types.Operation) {
+		return runStep(v1alpha1.WorkflowStepBase{
+			Name:       "terminate",
+			Properties: &runtime.RawExtension{Raw: []byte(properties)},
+		}, "terminate-id", nil)
+	}
+
+	status, operation := run(`{"message":"nothing to deploy"}`)
+	r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+	r.Equal(types.StatusReasonExit, status.Reason)
+	r.Equal("nothing to deploy", status.Message)
+	r.True(operation.Terminated)
+
+	status, operation = run(`{"status":"failed","message":"the cluster is not ready"}`)
+	r.Equal(v1alpha1.WorkflowStepPhaseFailed, status.Phase)
+	r.Equal(types.StatusReasonAction, status.Reason)
+	r.Equal("the cluster is not ready", status.Message)
+	r.True(operation.Terminated)
+}
+
+func TestGenStepType(t *testing.T) {
+	r := require.New(t)
+	wfCtx, runStep := newStepRunner(t, fake.NewClientBuilder().Build(), types.WorkflowStepTypeGen)
+
+	run := func(id string, regenerate bool) map[string]string {
+		status, _ := runStep(v1alpha1.WorkflowStepBase{
+			Name: "gen",
+			Properties: &runtime.RawExtension{Raw: []byte(fmt.Sprintf(`{"values":{"id":{"kind":"uuid"},`+
+				`"password":{"kind":"randomString","length":24,"sensitive":true},`+
+				`"suffix":{"kind":"derived","length":5,"charset":"abcdef0123456789","seed":"app"}},"regenerate":%t}`, regenerate))},
+			Outputs: v1alpha1.StepOutputs{
+				{Name: "id", ValueFrom: "values.id"},
+				{Name: "password", ValueFrom: "values.password", Sensitive: true},
+				{Name: "suffix", ValueFrom: "values.suffix"},
+			},
+		}, id, nil)
+		r.Equal(v1alpha1.WorkflowStepPhaseSucceeded, status.Phase)
+		values := make(map[string]string)
+		for _, name := range []string{"id", "password", "suffix"} {
+			v, err := wfCtx.GetVar(name)
+			r.NoError(err)
+			s, err := v.String()
+			r.NoError(err)
+			values[name] = s
+		}
+		return values
+	}
+
+	values := run("gen-id", false)
+	r.Len(values["id"], 36)
+	r.Len(values["password"], 24)
+	r.Regexp("^[a-f0-9]{5}$", values["suffix"])
+
+	// the restarted step with a new id reuses the persisted values
+	r.Equal(values, run("gen-restarted", false))
 
+	regenerated := run("gen-regenerated", true)
+	r.NotEqual(values["id"], regenerated["id"])
+	r.NotEqual(values["password"], regenerated["password"])
+	r.Equal(values["suffix"], regenerated["suffix"])
 }
@@ -20,6 +20,7 @@ import (
 	"context"
 	"embed"
 	"fmt"
+	"strings"
 
 	"github.com/kubevela/pkg/util/singleton"
 	"github.com/pkg/errors"
@@ -76,6 +77,27 @@ func (loader *WorkflowStepLoader) LoadTemplate(ctx context.Context, name string)
 	return loader.loadDefinition(ctx, name)
 }
 
+// ListStaticTemplates returns the templates of the step types built in the build by the name of the step types
+func ListStaticTemplates() (map[string]string, error) {
+	files, err := templateFS.ReadDir(templateDir)
+	if err != nil {
+		return nil, err
+	}
+	templates := make(map[string]string)
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ".cue")
+		if !ok {
+			continue
+		}
+		content, err := templateFS.ReadFile(fmt.Sprintf("%s/%s", templateDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = string(content)
+	}
+	return templates, nil
+}
+
 // NewWorkflowStepTemplateLoader create a task template loader.
 func NewWorkflowStepTemplateLoader() Loader {
 	return &WorkflowStepLoader{
@@ -0,0 +1,23 @@
+// +description=Check the assertions of the values, the step fails with the differences between the expected and actual values
+// +sideEffects=false
+import (
+	"vela/builtin"
+)
+
+assert: builtin.#Assert & {
+	$params: assertions: parameter.assertions
+}
+
+parameter: {
+	// +usage=The assertions keyed by their names, the actual values can be set by the inputs of the step, such as "assertions.ready.actual"
+	assertions: [string]: {
+		// +usage=The actual value to check
+		actual: _
+		// +usage=The expected value, the actual value should equal it
+		expected?: _
+		// +usage=The cue expression over the actual value that should be true, such as "actual >= 3"
+		condition?: string
+		// +usage=Optional message that describes the assertion in the failure
+		message?: string
+	}
+}
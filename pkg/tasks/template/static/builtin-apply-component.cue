@@ -1,3 +1,5 @@
+// +description=Apply the component and its traits
+// +sideEffects=true
 import (
 	"vela/op"
 )
@@ -0,0 +1,21 @@
+// +description=Wait for the duration with an optional jitter and then succeed, the delay is computed since the step is first executed
+// +sideEffects=false
+import (
+	"vela/builtin"
+)
+
+delay: builtin.#Delay & {
+	$params: {
+		duration: parameter.duration
+		if parameter.jitter != _|_ {
+			jitter: parameter.jitter
+		}
+	}
+}
+
+parameter: {
+	// +usage=The duration to wait, such as "30s", "1m" or "2m15s"
+	duration: string
+	// +usage=The max random duration added to the duration to spread the load, such as "10s"
+	jitter?: string
+}
@@ -0,0 +1,76 @@
+// +description=Run the command in a pod and capture its logs, the step fails if the command exits with a non-zero code
+// +sideEffects=true
+import (
+	"vela/builtin"
+	"vela/exec"
+)
+
+run: exec.#Run & {
+	$params: {
+		name:      "\(context.name)-\(context.stepSessionID)"
+		namespace: context.namespace
+		image:     parameter.image
+		if parameter.command != _|_ {
+			command: parameter.command
+		}
+		if parameter.args != _|_ {
+			args: parameter.args
+		}
+		if parameter.env != _|_ {
+			env: parameter.env
+		}
+		if parameter.resources != _|_ {
+			resources: parameter.resources
+		}
+		if context.stepTimeout != _|_ {
+			activeDeadline: context.stepTimeout
+		}
+		tailLines: parameter.tailLines
+	}
+}
+
+wait: builtin.#ConditionalWait & {
+	$params: {
+		continue: run.$returns.phase == "succeeded" || run.$returns.phase == "failed"
+		if run.$returns.phase == "pending" {
+			message: "Waiting for the pod to start"
+		}
+		if run.$returns.phase == "running" {
+			message: "Running: \(run.$returns.logs)"
+		}
+	}
+}
+
+if run.$returns.phase == "failed" {
+	fail: builtin.#Fail & {
+		$params: {
+			if run.$returns.message != _|_ {
+				message: "The command exits with code \(run.$returns.exitCode): \(run.$returns.message)"
+			}
+			if run.$returns.message == _|_ {
+				message: "The command exits with code \(run.$returns.exitCode)"
+			}
+		}
+	}
+}
+
+logs:     run.$returns.logs
+exitCode: run.$returns.exitCode
+
+parameter: {
+	// +usage=The image to run the command
+	image: string
+	// +usage=The command to run
+	command?: [...string]
+	// +usage=The arguments of the command
+	args?: [...string]
+	// +usage=The environment variables of the command
+	env?: [string]: string
+	// +usage=The resource requirements of the pod, e.g. {limits: {cpu: "500m", memory: "256Mi"}}
+	resources?: {
+		limits?: [string]:   string
+		requests?: [string]: string
+	}
+	// +usage=The number of the lines from the end of the logs to capture, all the logs are captured if it's 0
+	tailLines: *0 | int
+}
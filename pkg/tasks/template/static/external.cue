@@ -0,0 +1,62 @@
+// +description=Call the registered external executor over JSON-RPC, the executor is polled until the step is succeeded or failed
+// +sideEffects=true
+import (
+	"vela/builtin"
+	"vela/external"
+)
+
+call: external.#Call & {
+	$params: {
+		executor: parameter.executor
+		run: {
+			name:      context.name
+			namespace: context.namespace
+		}
+		step: {
+			name: context.stepName
+			id:   context.stepSessionID
+		}
+		properties: parameter.properties
+		if parameter.timeout != _|_ {
+			timeout: parameter.timeout
+		}
+	}
+}
+
+wait: builtin.#ConditionalWait & {
+	$params: {
+		continue: call.$returns.phase != "running"
+		if call.$returns.message != _|_ {
+			message: call.$returns.message
+		}
+		if call.$returns.subPhase != _|_ {
+			subPhase: call.$returns.subPhase
+		}
+	}
+}
+
+if call.$returns.phase == "failed" {
+	fail: builtin.#Fail & {
+		$params: {
+			if call.$returns.message != _|_ {
+				message: call.$returns.message
+			}
+			if call.$returns.message == _|_ {
+				message: "The external executor \(parameter.executor) reports the step is failed"
+			}
+		}
+	}
+}
+
+if call.$returns.outputs != _|_ {
+	outputs: call.$returns.outputs
+}
+
+parameter: {
+	// +usage=The name of the registered external executor
+	executor: string
+	// +usage=The properties passed to the executor, the inputs of the step are filled in the properties
+	properties: *{} | {...}
+	// +usage=The timeout of each call to the executor, e.g. "10s"
+	timeout?: string
+}
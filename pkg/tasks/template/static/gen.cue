@@ -0,0 +1,32 @@
+// +description=Generate the values such as the passwords and the suffixes, the values are persisted and reused by the later executions of the step
+// +sideEffects=false
+import (
+	"vela/builtin"
+)
+
+gen: builtin.#Gen & {
+	$params: {
+		values:     parameter.values
+		regenerate: parameter.regenerate
+	}
+}
+
+values: gen.$returns.values
+
+parameter: {
+	// +usage=The values to generate keyed by their names, which can be referenced by the outputs as "values.<name>"
+	values: [string]: {
+		// +usage=The kind of the value, "derived" derives the same value from the same seed
+		kind: "uuid" | "randomString" | "derived"
+		// +usage=The length of the random string or the derived value, defaults to 16
+		length?: int
+		// +usage=The characters to pick for the random string or the derived value, defaults to the letters and digits
+		charset?: string
+		// +usage=The seed to derive the value from
+		seed?: string
+		// +usage=Whether the value is redacted in the debug dumps, the outputs of it should be sensitive as well
+		sensitive: *false | bool
+	}
+	// +usage=Whether to generate the values again instead of reusing the persisted values
+	regenerate: *false | bool
+}
@@ -0,0 +1,103 @@
+// +description=Render the helm chart with the values in a pod, the rendered manifests are returned as the objects
+// +sideEffects=false
+import (
+	"encoding/json"
+	"encoding/yaml"
+	"vela/builtin"
+	"vela/exec"
+)
+
+run: exec.#Run & {
+	$params: {
+		name:      "\(context.name)-\(context.stepSessionID)"
+		namespace: context.namespace
+		image:     parameter.image
+		// the errors are written to the termination message, so the logs only contain the rendered manifests
+		command: ["sh", "-c", "printf '%s' \"$VALUES\" > /tmp/values.yaml && exec helm \"$@\" --values /tmp/values.yaml 2>/dev/termination-log", "helm"]
+		args: [
+			"template", parameter.release, parameter.chart,
+			"--version", parameter.version,
+			"--namespace", parameter.namespace,
+			if parameter.repo != _|_ {"--repo"},
+			if parameter.repo != _|_ {parameter.repo},
+			if parameter.includeCRDs {"--include-crds"},
+		]
+		env: VALUES: json.Marshal(parameter.values)
+		if parameter.resources != _|_ {
+			resources: parameter.resources
+		}
+		if context.stepTimeout != _|_ {
+			activeDeadline: context.stepTimeout
+		}
+		logLimit: parameter.maxManifestsSize
+	}
+}
+
+wait: builtin.#ConditionalWait & {
+	$params: {
+		continue: run.$returns.phase == "succeeded" || run.$returns.phase == "failed"
+		if run.$returns.phase == "pending" {
+			message: "Waiting for the pod to start"
+		}
+		if run.$returns.phase == "running" {
+			message: "Rendering the chart \(parameter.chart)"
+		}
+	}
+}
+
+// the logs beyond the limit are truncated, which can't be parsed as the manifests
+_truncated: *false | bool
+if run.$returns.truncated != _|_ {
+	_truncated: run.$returns.truncated
+}
+if run.$returns.phase == "succeeded" && _truncated {
+	truncated: builtin.#Fail & {
+		$params: message: "The rendered manifests of the chart \(parameter.chart) exceed \(parameter.maxManifestsSize) bytes"
+	}
+}
+
+if run.$returns.phase == "failed" {
+	fail: builtin.#Fail & {
+		$params: {
+			if run.$returns.message != _|_ {
+				message: "Failed to render the chart \(parameter.chart): \(run.$returns.message)"
+			}
+			if run.$returns.message == _|_ {
+				message: "Failed to render the chart \(parameter.chart), exit code \(run.$returns.exitCode)"
+			}
+		}
+	}
+}
+
+// the manifests are empty until the rendering is succeeded
+manifests: *"" | string
+if run.$returns.phase == "succeeded" && !_truncated {
+	manifests: run.$returns.logs
+}
+objects: [for o in yaml.UnmarshalStream(manifests) if o != null {o}]
+
+parameter: {
+	// +usage=The name of the chart, or the url of the chart, e.g. oci://ghcr.io/org/charts/app
+	chart: string
+	// +usage=The url of the chart repository
+	repo?: string
+	// +usage=The version of the chart, it's required to keep the rendering deterministic
+	version: string
+	// +usage=The release name of the chart
+	release: *context.name | string
+	// +usage=The namespace of the release
+	namespace: *context.namespace | string
+	// +usage=The values of the chart
+	values: *{} | {...}
+	// +usage=Whether to render the CRDs of the chart
+	includeCRDs: *true | bool
+	// +usage=The image of helm
+	image: *"alpine/helm:3.14.4" | string
+	// +usage=The max size in bytes of the rendered manifests, the rendering fails beyond it
+	maxManifestsSize: *262144 | int
+	// +usage=The resource requirements of the pod, e.g. {limits: {cpu: "500m", memory: "256Mi"}}
+	resources?: {
+		limits?: [string]:   string
+		requests?: [string]: string
+	}
+}
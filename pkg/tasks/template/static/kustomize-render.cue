@@ -0,0 +1,127 @@
+// +description=Render the kustomize base with the overlays in a pod, the rendered manifests are returned as the objects
+// +sideEffects=false
+import (
+	"encoding/json"
+	"encoding/yaml"
+	"vela/builtin"
+	"vela/exec"
+)
+
+kustomization: {
+	apiVersion: "kustomize.config.k8s.io/v1beta1"
+	kind:       "Kustomization"
+	resources: [parameter.base]
+	if parameter.namespace != _|_ {
+		namespace: parameter.namespace
+	}
+	if parameter.namePrefix != _|_ {
+		namePrefix: parameter.namePrefix
+	}
+	if parameter.nameSuffix != _|_ {
+		nameSuffix: parameter.nameSuffix
+	}
+	if parameter.labels != _|_ {
+		labels: [{pairs: parameter.labels, includeSelectors: false}]
+	}
+	if parameter.images != _|_ {
+		images: parameter.images
+	}
+	if parameter.patches != _|_ {
+		patches: parameter.patches
+	}
+}
+
+run: exec.#Run & {
+	$params: {
+		name:      "\(context.name)-\(context.stepSessionID)"
+		namespace: context.namespace
+		image:     parameter.image
+		// the errors are written to the termination message, so the logs only contain the rendered manifests
+		command: ["sh", "-c", "mkdir -p /tmp/render && printf '%s' \"$KUSTOMIZATION\" > /tmp/render/kustomization.yaml && exec kustomize build /tmp/render 2>/dev/termination-log"]
+		env: KUSTOMIZATION: json.Marshal(kustomization)
+		if parameter.resources != _|_ {
+			resources: parameter.resources
+		}
+		if context.stepTimeout != _|_ {
+			activeDeadline: context.stepTimeout
+		}
+		logLimit: parameter.maxManifestsSize
+	}
+}
+
+wait: builtin.#ConditionalWait & {
+	$params: {
+		continue: run.$returns.phase == "succeeded" || run.$returns.phase == "failed"
+		if run.$returns.phase == "pending" {
+			message: "Waiting for the pod to start"
+		}
+		if run.$returns.phase == "running" {
+			message: "Rendering the base \(parameter.base)"
+		}
+	}
+}
+
+// the logs beyond the limit are truncated, which can't be parsed as the manifests
+_truncated: *false | bool
+if run.$returns.truncated != _|_ {
+	_truncated: run.$returns.truncated
+}
+if run.$returns.phase == "succeeded" && _truncated {
+	truncated: builtin.#Fail & {
+		$params: message: "The rendered manifests of the base \(parameter.base) exceed \(parameter.maxManifestsSize) bytes"
+	}
+}
+
+if run.$returns.phase == "failed" {
+	fail: builtin.#Fail & {
+		$params: {
+			if run.$returns.message != _|_ {
+				message: "Failed to render the base \(parameter.base): \(run.$returns.message)"
+			}
+			if run.$returns.message == _|_ {
+				message: "Failed to render the base \(parameter.base), exit code \(run.$returns.exitCode)"
+			}
+		}
+	}
+}
+
+// the manifests are empty until the rendering is succeeded
+manifests: *"" | string
+if run.$returns.phase == "succeeded" && !_truncated {
+	manifests: run.$returns.logs
+}
+objects: [for o in yaml.UnmarshalStream(manifests) if o != null {o}]
+
+parameter: {
+	// +usage=The url of the kustomize base, e.g. https://github.com/org/repo//deploy/base?ref=v1.0.0
+	base: string
+	// +usage=The namespace of the rendered objects
+	namespace?: string
+	// +usage=The prefix of the names of the rendered objects
+	namePrefix?: string
+	// +usage=The suffix of the names of the rendered objects
+	nameSuffix?: string
+	// +usage=The labels added to the rendered objects
+	labels?: [string]: string
+	// +usage=The images to override, e.g. [{name: "nginx", newTag: "1.25"}]
+	images?: [...{
+		name:     string
+		newName?: string
+		newTag?:  string
+		digest?:  string
+	}]
+	// +usage=The patches of the rendered objects, e.g. [{patch: "...", target: {kind: "Deployment"}}]
+	patches?: [...{
+		patch: string
+		target?: {...}
+	}]
+	// +usage=The image of kustomize
+	image: *"registry.k8s.io/kustomize/kustomize:v5.4.3" | string
+	// +usage=The max size in bytes of the rendered manifests, the rendering fails beyond it
+	maxManifestsSize: *262144 | int
+	// +usage=The resource requirements of the pod, e.g. {limits: {cpu: "500m", memory: "256Mi"}}
+	resources?: {
+		limits?: [string]:   string
+		requests?: [string]: string
+	}
+}
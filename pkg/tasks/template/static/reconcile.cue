@@ -0,0 +1,71 @@
+// +description=Compare the desired resources with the live resources and report the drift, the drifted resources are applied again in the enforce mode
+// +sideEffects=true
+import (
+	"list"
+	"strconv"
+	"vela/builtin"
+	"vela/kube"
+)
+
+drift: {
+	for i, o in parameter.objects {
+		"\(i)": kube.#Drift & {
+			$params: {
+				value:   o
+				cluster: parameter.cluster
+			}
+		}
+	}
+}
+
+report: {
+	resources: [for i, o in parameter.objects {
+		apiVersion: o.apiVersion
+		kind:       o.kind
+		name:       o.metadata.name
+		if o.metadata.namespace != _|_ {
+			namespace: o.metadata.namespace
+		}
+		drifted: drift["\(i)"].$returns.drifted
+		missing: drift["\(i)"].$returns.missing
+		fields:  drift["\(i)"].$returns.fields
+	}]
+	drifted: list.Contains([for r in resources {r.drifted}], true)
+	count:   len([for r in resources if r.drifted {r}])
+}
+
+if parameter.mode == "enforce" {
+	enforce: {
+		for i, o in parameter.objects if drift["\(i)"].$returns.drifted {
+			"\(i)": kube.#Apply & {
+				$params: {
+					value:   o
+					cluster: parameter.cluster
+				}
+			}
+		}
+	}
+}
+
+message: builtin.#Message & {
+	$params: {
+		if !report.drifted {
+			message: "No drift is detected"
+		}
+		if report.drifted && parameter.mode == "report" {
+			message: strconv.FormatInt(report.count, 10) + " resources are drifted"
+		}
+		if report.drifted && parameter.mode == "enforce" {
+			message: strconv.FormatInt(report.count, 10) + " drifted resources are applied again"
+		}
+	}
+}
+
+parameter: {
+	// +usage=The desired resources to compare with the live resources
+	objects: [...{...}]
+	// +usage=The mode of the reconcile, report only reports the drift while enforce applies the drifted resources again
+	mode: *"report" | "enforce"
+	// +usage=The cluster of the resources
+	cluster: *"" | string
+}
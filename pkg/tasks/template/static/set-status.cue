@@ -0,0 +1,14 @@
+// +description=Set the custom status of the workflow run
+// +sideEffects=false
+import (
+	"vela/builtin"
+)
+
+setStatus: builtin.#SetStatus & {
+	$params: status: parameter.status
+}
+
+parameter: {
+	// +usage=The custom status to set in the workflow run, the key will be removed if the value is null
+	status: {...}
+}
@@ -1,3 +1,5 @@
+// +description=Suspend the workflow run until it is resumed or the duration is reached
+// +sideEffects=false
 import (
 	"vela/op"
 )
@@ -0,0 +1,32 @@
+// +description=Terminate the workflow with the status and the message, the remaining steps are skipped and the workflow is succeeded if the status is succeeded
+// +sideEffects=false
+import (
+	"vela/builtin"
+)
+
+if parameter.status == "succeeded" {
+	exit: builtin.#Exit & {
+		$params: {
+			if parameter.message != _|_ {
+				message: parameter.message
+			}
+		}
+	}
+}
+
+if parameter.status == "failed" {
+	fail: builtin.#Fail & {
+		$params: {
+			if parameter.message != _|_ {
+				message: parameter.message
+			}
+		}
+	}
+}
+
+parameter: {
+	// +usage=The status of the terminated workflow, the succeeded status exits the workflow cleanly while the failed status fails it
+	status: *"succeeded" | "failed"
+	// +usage=Optional message that explains the termination, such as "nothing to deploy"
+	message?: string
+}
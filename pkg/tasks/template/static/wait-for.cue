@@ -0,0 +1,37 @@
+// +description=Wait until the resource meets the condition by watching it instead of polling, the step fails if the resource is failed
+// +sideEffects=false
+import (
+	"vela/kube"
+)
+
+wait: kube.#WaitFor & {
+	$params: {
+		value: {
+			apiVersion: parameter.apiVersion
+			kind:       parameter.kind
+			metadata: {
+				name:      parameter.name
+				namespace: parameter.namespace
+			}
+		}
+		condition: parameter.condition
+		cluster:   parameter.cluster
+	}
+}
+
+output: wait.$returns.value
+
+parameter: {
+	// +usage=The apiVersion of the resource
+	apiVersion: string
+	// +usage=The kind of the resource
+	kind: string
+	// +usage=The name of the resource
+	name: string
+	// +usage=The namespace of the resource
+	namespace: *context.namespace | string
+	// +usage=The cue expression evaluated with the fields of the resource, such as "status.phase == \"Ready\"", the built-in health checks of the kind are used if it's empty
+	condition: *"" | string
+	// +usage=The cluster of the resource
+	cluster: *"" | string
+}
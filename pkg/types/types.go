@@ -18,6 +18,11 @@ package types
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"cuelang.org/go/cue"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -40,11 +45,39 @@ type WorkflowInstance struct {
 	OwnerInfo []metav1.OwnerReference
 	Debug     bool
 	Context   map[string]interface{}
+	InitVars  map[string]interface{}
 	Mode      *v1alpha1.WorkflowExecuteMode
 	Steps     []v1alpha1.WorkflowStep
 	Status    v1alpha1.WorkflowRunStatus
+	// IncludeSteps and ExcludeSteps select the steps to execute in the run
+	IncludeSteps *v1alpha1.StepSelector
+	ExcludeSteps *v1alpha1.StepSelector
+	// FailurePolicy decides whether the failure of a step cancels the other branches in DAG mode
+	FailurePolicy v1alpha1.FailurePolicy
+	// UnknownStepTypePolicy decides how the step is handled if its type can't be resolved
+	UnknownStepTypePolicy v1alpha1.UnknownStepTypePolicy
+	// MaxRetries is the budget of the retries of all the steps in the run, no limit if it's not positive
+	MaxRetries int
+	// Shared are the inputs shared by the steps, which are resolved once when the run is initialized
+	Shared []v1alpha1.SharedInput
+	// Finalizers records the kinds of the finalizer steps appended after the main steps, keyed by the step name
+	Finalizers map[string]FinalizerKind
+	// WorkflowRef is the name of the workflow referred by the run, it's empty if the steps are inlined in the run
+	WorkflowRef string
 }
 
+// FinalizerKind is the kind of the finalizer step, which decides whether the step is executed by the outcome of the main steps
+type FinalizerKind string
+
+const (
+	// FinalizerOnComplete is executed after the main steps are finished, regardless of the outcome
+	FinalizerOnComplete FinalizerKind = "onComplete"
+	// FinalizerOnSuccess is executed after all the main steps are succeeded or skipped
+	FinalizerOnSuccess FinalizerKind = "onSuccess"
+	// FinalizerOnFailure is executed after the main steps are failed or the workflow run is terminated
+	FinalizerOnFailure FinalizerKind = "onFailure"
+)
+
 // WorkflowMeta is the meta information for workflow instance
 type WorkflowMeta struct {
 	Name                 string
@@ -66,6 +99,13 @@ type TaskRunner interface {
 	FillContextData(ctx monitorContext.Context, processCtx process.Context) ContextDataResetter
 }
 
+// TaskTemplateRenderer is the TaskRunner that renders its templates without running the providers before it runs,
+// e.g. to check the permissions of the resources ahead of the steps. It's checked by type assertion, and the step
+// that can't be rendered ahead, e.g. with the inputs from the other steps, returns nothing
+type TaskTemplateRenderer interface {
+	RenderTemplates(ctx monitorContext.Context, wfCtx wfContext.Context) []cue.Value
+}
+
 // TaskDiscover is the interface to obtain the TaskGenerator
 type TaskDiscover interface {
 	GetTaskGenerator(ctx context.Context, name string) (TaskGenerator, error)
@@ -98,6 +138,9 @@ type TaskRunOptions struct {
 type PreCheckResult struct {
 	Skip    bool
 	Timeout bool
+	// TimeLeft is the time left before the step times out, the execution of the step is cancelled once it's used up.
+	// Zero means the step has no timeout.
+	TimeLeft time.Duration
 }
 
 // PreCheckOptions is the options for pre check.
@@ -108,12 +151,66 @@ type PreCheckOptions struct {
 // StatusPatcher is the interface to patch status
 type StatusPatcher func(ctx context.Context, status *v1alpha1.WorkflowRunStatus, isUpdate bool) error
 
+// AuditEntry is the structured record of a consequential action in a workflow run
+type AuditEntry struct {
+	// Timestamp is the time of the action
+	Timestamp time.Time `json:"timestamp"`
+	// Actor is the identity that takes the action, e.g. the service account of the step or the approver
+	Actor string `json:"actor"`
+	// Action is the action taken, e.g. ExecuteStep, Approve and FinishRun
+	Action string `json:"action"`
+	// Target is the run and the step that the action is taken on
+	Target AuditTarget `json:"target"`
+	// Outcome is the result of the action, e.g. the phase of the step
+	Outcome string `json:"outcome"`
+	// Message is the details of the outcome
+	Message string `json:"message,omitempty"`
+}
+
+// AuditTarget is the run and the step that the audited action is taken on
+type AuditTarget struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid,omitempty"`
+	Step      string    `json:"step,omitempty"`
+	StepType  string    `json:"stepType,omitempty"`
+}
+
+// AuditSink records the audit entries of the workflow runs. It's called synchronously at the key points of the
+// execution, so the sinks that write to the remote services should buffer the entries instead of blocking.
+type AuditSink interface {
+	Record(ctx context.Context, entry AuditEntry) error
+}
+
+const (
+	// AuditActionExecuteStep is the audit action of executing a step until it's finished
+	AuditActionExecuteStep = "ExecuteStep"
+	// AuditActionFinishRun is the audit action of finishing a run, the outcome is the phase of the run
+	AuditActionFinishRun = "FinishRun"
+	// AuditActionApprove is the audit action of approving a suspended step
+	AuditActionApprove = "Approve"
+	// AuditActionReject is the audit action of rejecting a suspended step, which terminates the run
+	AuditActionReject = "Reject"
+	// AuditActionTerminate is the audit action of terminating a run, e.g. by the breached watcher or the rejection
+	AuditActionTerminate = "Terminate"
+	// AuditActorController is the actor of the actions taken by the controller itself
+	AuditActorController = "workflow-controller"
+)
+
+// Clock provides the time for the workflow execution, it can be replaced by a fake clock in tests
+type Clock interface {
+	Now() time.Time
+}
+
 // TaskPreCheckHook is the hook for pre check.
 type TaskPreCheckHook func(step v1alpha1.WorkflowStep, options *PreCheckOptions) (*PreCheckResult, error)
 
 // TaskPreStartHook run before task execution.
 type TaskPreStartHook func(ctx wfContext.Context, paramValue cue.Value, step v1alpha1.WorkflowStep) (cue.Value, error)
 
+// WorkflowInitHook prepares the context backend before any step runs
+type WorkflowInitHook func(ctx wfContext.Context, instance *WorkflowInstance) error
+
 // TaskPostStopHook  run after task execution.
 type TaskPostStopHook func(ctx wfContext.Context, taskValue cue.Value, step v1alpha1.WorkflowStep, status v1alpha1.StepStatus, stepStatus map[string]v1alpha1.StepStatus) error
 
@@ -136,7 +233,14 @@ type TaskGeneratorOptions struct {
 	StepConvertor      func(step v1alpha1.WorkflowStep) (v1alpha1.WorkflowStep, error)
 	SubTaskRunners     []TaskRunner
 	SubStepExecuteMode v1alpha1.WorkflowMode
-	ProcessContext     process.Context
+	// SubTaskGenerator generates the runners of the sub steps generated at runtime by the generator of the step group
+	SubTaskGenerator func(step v1alpha1.WorkflowStepBase, id string) (TaskRunner, error)
+	ProcessContext   process.Context
+	// Dependents are the names of the steps that depend on the step
+	Dependents []string
+	// LockPeers returns the names of the other steps that declare the same lock as the step, it's resolved when the
+	// step is checked since the sub steps holding the lock may be generated after the step
+	LockPeers func() []string
 }
 
 // StepGeneratorOptions is the options for generate step.
@@ -148,6 +252,16 @@ type StepGeneratorOptions struct {
 	Compiler       *cuex.Compiler
 }
 
+// StepOverride is the forced result of a step, the step won't be executed and
+// the phase and outputs will be set directly.
+type StepOverride struct {
+	Phase   v1alpha1.WorkflowStepPhase `json:"phase"`
+	Message string                     `json:"message,omitempty"`
+	Outputs map[string]json.RawMessage `json:"outputs,omitempty"`
+	// Reason is the reason of the overridden status, StatusReasonOverridden is used if it's empty
+	Reason string `json:"-"`
+}
+
 // Action is that workflow provider can do.
 type Action interface {
 	Suspend(message string)
@@ -159,6 +273,30 @@ type Action interface {
 	GetStatus() v1alpha1.StepStatus
 }
 
+// ActionExiter is the Action that exits the workflow as succeeded, it's checked by type assertion so that the
+// existing implementations of Action are not broken
+type ActionExiter interface {
+	Exit(message string)
+}
+
+// ActionSubPhaser is the Action that reports the advisory sub phase of the running step, e.g. verifying. It's
+// checked by type assertion, the sub phase is dropped if the Action doesn't implement it
+type ActionSubPhaser interface {
+	SubPhase(subPhase string)
+}
+
+// ActionContinuer is the Action that keeps the continuation token of the long operation in the step status. It's
+// checked by type assertion, the operation is started again in the next execution if the Action doesn't implement it
+type ActionContinuer interface {
+	ContinuationToken(token string)
+}
+
+// ActionMetadataReporter is the Action that reports the informational metadata of the step. It's checked by type
+// assertion, the metadata is dropped if the Action doesn't implement it
+type ActionMetadataReporter interface {
+	Metadata(metadata map[string]string)
+}
+
 // Parameter defines a parameter for cli from capability template
 type Parameter struct {
 	Name     string      `json:"name"`
@@ -199,12 +337,48 @@ const (
 	ContextPrefixBackoffTimes = "backoff_times"
 	// ContextPrefixBackoffReason is the prefix that refer to the current backoff reason in workflow context config map
 	ContextPrefixBackoffReason = "backoff_reason"
+	// ContextPrefixPermissionReviews is the prefix that refer to the permissions of the controller reviewed as allowed in workflow context memory store.
+	ContextPrefixPermissionReviews = "permission_reviews"
+	// ContextPrefixBackendFailedTimes is the prefix that refer to the times of the step failed to commit the workflow context.
+	ContextPrefixBackendFailedTimes = "backend_failed_times"
+	// ContextVarWorkflowStatus is the variable that refer to the outcome of the main steps, it's set before the finalizer steps are executed.
+	ContextVarWorkflowStatus = "workflowStatus"
 	// ContextKeyLastExecuteTime is the key that refer to the last execute time in workflow context config map.
 	ContextKeyLastExecuteTime = "last_execute_time"
 	// ContextKeyNextExecuteTime is the key that refer to the next execute time in workflow context config map.
 	ContextKeyNextExecuteTime = "next_execute_time"
 	// ContextKeyLogConfig is key for log config.
 	ContextKeyLogConfig = "logConfig"
+	// ContextKeyCustomStatus is the key that refer to the custom status of workflow run in workflow context config map.
+	ContextKeyCustomStatus = "custom_status"
+	// ContextKeyInitialized is the key that marks the context backend has been initialized in workflow context config map.
+	ContextKeyInitialized = "initialized"
+	// ContextKeyProviderTrace is the key that refer to the recorded calls of providers in workflow context config map.
+	ContextKeyProviderTrace = "provider_trace"
+	// ContextPrefixPreviousOutput is the prefix that refer to the outputs of the step's last completed execution in workflow context config map.
+	ContextPrefixPreviousOutput = "previous_output"
+	// ContextPrefixRetryInputs is the prefix that refer to the inputs resolved by the failed attempt of the step and reused by its retries in workflow context config map.
+	ContextPrefixRetryInputs = "retry_inputs"
+	// ContextPrefixLazyInputs is the prefix that refer to the lazy inputs of the step that are unresolved by its last execution in workflow context config map.
+	ContextPrefixLazyInputs = "lazy_inputs"
+	// ContextPrefixOutputStep is the prefix that refer to the name of the step that sets the output last in workflow context config map.
+	ContextPrefixOutputStep = "output_step"
+	// ContextPrefixPrunedOutput is the prefix that refer to the step names of the outputs pruned from the vars in workflow context config map.
+	ContextPrefixPrunedOutput = "pruned_output"
+	// ContextPrefixStepStatus is the prefix that refer to the archived full status of the finished steps in workflow context config map.
+	ContextPrefixStepStatus = "step_status"
+	// ContextPrefixGeneratedValue is the prefix that refer to the values generated by the gen steps in workflow context config map.
+	ContextPrefixGeneratedValue = "generated_value"
+	// ContextPrefixSwitchValue is the prefix that refer to the value of the switch selected when the step group starts in workflow context config map.
+	ContextPrefixSwitchValue = "switch_value"
+	// ContextPrefixExecPod is the prefix that refer to the state of the pods of the exec steps in workflow context config map.
+	ContextPrefixExecPod = "exec_pod"
+	// ContextPrefixInventory is the prefix that refer to the resources applied by the run in workflow context config map.
+	ContextPrefixInventory = "inventory"
+	// ContextKeyInventorySize is the key that refer to the number of the resources in the inventory in workflow context config map.
+	ContextKeyInventorySize = "inventory_size"
+	// ContextKeyInventoryTruncated is the key that marks the inventory reached its max size in workflow context config map.
+	ContextKeyInventoryTruncated = "inventory_truncated"
 )
 
 const (
@@ -216,18 +390,88 @@ const (
 	WorkflowStepTypeBuiltinApplyComponent = "builtin-apply-component"
 	// WorkflowStepTypeStepGroup type step-group
 	WorkflowStepTypeStepGroup = "step-group"
+	// WorkflowStepTypeSetStatus type set-status
+	WorkflowStepTypeSetStatus = "set-status"
+	// WorkflowStepTypeExec type exec
+	WorkflowStepTypeExec = "exec"
+	// WorkflowStepTypeHelmRender type helm-render
+	WorkflowStepTypeHelmRender = "helm-render"
+	// WorkflowStepTypeKustomizeRender type kustomize-render
+	WorkflowStepTypeKustomizeRender = "kustomize-render"
+	// WorkflowStepTypeAssert type assert
+	WorkflowStepTypeAssert = "assert"
+	// WorkflowStepTypeExternal type external
+	WorkflowStepTypeExternal = "external"
+	// WorkflowStepTypeDelay type delay
+	WorkflowStepTypeDelay = "delay"
+	// WorkflowStepTypeTerminate type terminate
+	WorkflowStepTypeTerminate = "terminate"
+	// WorkflowStepTypeReconcile type reconcile
+	WorkflowStepTypeReconcile = "reconcile"
+	// WorkflowStepTypeWaitFor type wait-for
+	WorkflowStepTypeWaitFor = "wait-for"
+	// WorkflowStepTypeGen type gen
+	WorkflowStepTypeGen = "gen"
 )
 
+// StepTypeInfo is the information of a step type registered in the build
+type StepTypeInfo struct {
+	// Name is the name of the step type
+	Name string `json:"name"`
+	// Description is the description of the step type
+	Description string `json:"description,omitempty"`
+	// SideEffects indicates whether the step changes the resources out of the workflow run
+	SideEffects bool `json:"sideEffects"`
+}
+
 const (
 	// LabelWorkflowRunName is the label key for workflow run name
 	LabelWorkflowRunName = "workflowrun.oam.dev/name"
 	// LabelWorkflowRunNamespace is the label key for workflow run namespace
 	LabelWorkflowRunNamespace = "workflowrun.oam.dev/namespace"
+	// LabelExecPod is the label key of the pods created by the exec steps
+	LabelExecPod = "workflowrun.oam.dev/exec-pod"
+	// LabelWorkflowRunPhase is the label key of the phase of the workflow run, it's synced by the controller
+	LabelWorkflowRunPhase = "workflowrun.oam.dev/phase"
+	// LabelWorkflowRunWorkflow is the label key of the workflow referred by the workflow run, it's synced by the controller
+	LabelWorkflowRunWorkflow = "workflowrun.oam.dev/workflow"
+	// LabelWorkflowRunParent is the label key of the workflow run that the stage run belongs to
+	LabelWorkflowRunParent = "workflowrun.oam.dev/parent"
+	// LabelWorkflowRunStage is the label key of the name of the stage that the stage run executes
+	LabelWorkflowRunStage = "workflowrun.oam.dev/stage"
 )
 
 var (
 	// MaxWorkflowStepErrorRetryTimes is the max retry times of the failed workflow step.
 	MaxWorkflowStepErrorRetryTimes = 10
+	// MaxContextBackendRetryTimes is the max retry times of the workflow step when the context backend is unavailable.
+	MaxContextBackendRetryTimes = 10
+	// MaxWorkflowRunRetries is the default budget of the retries of all the steps in a workflow run, no limit if
+	// it's not positive.
+	MaxWorkflowRunRetries = 0
+	// MaxWorkflowSteps is the max number of steps including sub steps in a workflow, no limit if it's not positive.
+	MaxWorkflowSteps = 1000
+	// MaxInlineOutputSize is the max size in bytes of a step output stored inline in the context vars,
+	// the larger output is spilled into a separate ConfigMap owned by the context backend. No limit if it's not positive.
+	MaxInlineOutputSize = 65536
+	// MaxStepMetadataSize is the max total size in bytes of the keys and values of the metadata of a step, the
+	// entries beyond it are dropped. No limit if it's not positive.
+	MaxStepMetadataSize = 4096
+	// MaxInventorySize is the max number of the resources recorded in the inventory of a run for the teardown, the
+	// resources applied beyond it are not torn down. No limit if it's not positive.
+	MaxInventorySize = 500
+	// MaxProviderTraceCalls is the max number of the calls of the providers recorded by the provider trace of a run,
+	// the calls beyond it are not recorded and can not be replayed. No limit if it's not positive.
+	MaxProviderTraceCalls = 500
+	// MaxExecutionWaves is the max number of the waves of the steps recorded in the execution order of a run, the
+	// oldest waves are dropped beyond it, e.g. the waves of the periodic steps. No limit if it's not positive.
+	MaxExecutionWaves = 100
+	// PruneFinishedStepStatus prunes the finished steps in the status of the run to their id, name, phase and
+	// reason to reduce the size of the run, the full status is archived in the workflow context.
+	PruneFinishedStepStatus = false
+	// StatusUpdateDebounce is the interval to coalesce the status updates of the steps of a run when the status is
+	// patched at once, the updates are written by a single writer of the run. It's disabled if it's not positive.
+	StatusUpdateDebounce time.Duration = 0
 	// MaxWorkflowWaitBackoffTime is the max time to wait before reconcile wait workflow again
 	MaxWorkflowWaitBackoffTime = 60
 	// MaxWorkflowFailedBackoffTime is the max time to wait before reconcile failed workflow again
@@ -247,6 +491,8 @@ const (
 	StatusReasonSuspend = "Suspend"
 	// StatusReasonTerminate is the reason of the workflow progress condition which is Terminate.
 	StatusReasonTerminate = "Terminate"
+	// StatusReasonExit is the reason of the step that exits the workflow as succeeded.
+	StatusReasonExit = "Exit"
 	// StatusReasonParameter is the reason of the workflow progress condition which is ProcessParameter.
 	StatusReasonParameter = "ProcessParameter"
 	// StatusReasonInput is the reason of the workflow progress condition which is Input.
@@ -255,15 +501,50 @@ const (
 	StatusReasonOutput = "Output"
 	// StatusReasonFailedAfterRetries is the reason of the workflow progress condition which is FailedAfterRetries.
 	StatusReasonFailedAfterRetries = "FailedAfterRetries"
+	// StatusReasonPreconditionFailed is the reason of the workflow progress condition which is PreconditionFailed.
+	StatusReasonPreconditionFailed = "PreconditionFailed"
 	// StatusReasonTimeout is the reason of the workflow progress condition which is Timeout.
 	StatusReasonTimeout = "Timeout"
 	// StatusReasonAction is the reason of the workflow progress condition which is Action.
 	StatusReasonAction = "Action"
+	// StatusReasonOverridden is the reason of the workflow progress condition which is Overridden.
+	StatusReasonOverridden = "Overridden"
+	// StatusReasonExcluded is the reason of the workflow progress condition which is Excluded.
+	StatusReasonExcluded = "Excluded"
+	// StatusReasonContextBackendUnavailable is the reason of the workflow progress condition which is ContextBackendUnavailable.
+	StatusReasonContextBackendUnavailable = "ContextBackendUnavailable"
+	// StatusReasonDryRun is the reason of the workflow progress condition which is DryRun.
+	StatusReasonDryRun = "DryRun"
+	// StatusReasonGenerate is the reason of the workflow progress condition which is Generate.
+	StatusReasonGenerate = "Generate"
+	// StatusReasonSwitch is the reason of the workflow progress condition which is Switch.
+	StatusReasonSwitch = "Switch"
+	// StatusReasonUnknownStepType is the reason of the workflow progress condition which is UnknownStepType.
+	StatusReasonUnknownStepType = "UnknownStepType"
 )
 
 const (
 	// MessageSuspendFailedAfterRetries is the message of failed after retries
 	MessageSuspendFailedAfterRetries = "The workflow suspends automatically because the failed times of steps have reached the limit"
+	// MessageFailedSharedInputs is the message of the workflow failed because the shared inputs can't be resolved
+	MessageFailedSharedInputs = "The workflow fails because the shared inputs can't be resolved: %s"
+	// MessageMissingPermissions is the message of the workflow failed because the controller is missing the permissions to access the resources of the steps
+	MessageMissingPermissions = "The workflow fails because the controller is missing the permissions to run the steps: %s"
+	// MessageExceedMaxWorkflowSteps is the message of the workflow failed because the number of steps exceeds the limit
+	MessageExceedMaxWorkflowSteps = "The workflow fails because the number of steps %d exceeds the limit %d"
+	// MessageExceedRetryBudget is the message of the step failed because the retries of the run exceed the budget
+	MessageExceedRetryBudget = "The retries of the workflow exceed the budget %d"
+	// MessageFailedSteps is the message of the workflow that has failed steps
+	MessageFailedSteps = "The workflow has %d failed step(s): %s"
+	// MessageExitedStep is the message of the workflow that is exited as succeeded by the step
+	MessageExitedStep = "The workflow is exited by the step %s"
+	// RedactedValue replaces the values of the sensitive outputs in the step status and the debug dumps
+	RedactedValue = "<redacted>"
+	// MetadataKeyChanged is the key of the step metadata that tells whether the outputs of the step are changed
+	// from the previous succeeded run
+	MetadataKeyChanged = "changed"
+	// MetadataKeyDiff is the key of the step metadata that holds the diff of the changed outputs of the step
+	MetadataKeyDiff = "diff"
 )
 
 const (
@@ -271,6 +552,39 @@ const (
 	AnnotationWorkflowRunDebug = "workflowrun.oam.dev/debug"
 	// AnnotationControllerRequirement indicates the controller version that can process the workflow run
 	AnnotationControllerRequirement = "workflowrun.oam.dev/controller-version-require"
+	// AnnotationRecordProviderTrace is the annotation to record the calls of providers in the context backend for replay
+	AnnotationRecordProviderTrace = "workflowrun.oam.dev/record-provider-trace"
+	// AnnotationPermissionCheck is the annotation to check the permissions of the controller before the resources are applied or read,
+	// the resources rendered ahead are checked once before the steps run and reported as the PermissionsChecked condition,
+	// the others are checked when they're accessed and the missing permissions are reported as the error of the step
+	AnnotationPermissionCheck = "workflowrun.oam.dev/permission-check"
+	// AnnotationSkipStepSelector is the annotation key of the label selectors separated by `;`, the steps that match any of
+	// the selectors will be skipped
+	AnnotationSkipStepSelector = "workflowrun.oam.dev/skip-step-selector"
+	// SkipStepSelectorSeparator separates the label selectors in the AnnotationSkipStepSelector
+	SkipStepSelectorSeparator = ";"
+	// AnnotationStepOverrides is the annotation that forces the results of the steps without executing them,
+	// the value is a json map from the step name to the StepOverride
+	AnnotationStepOverrides = "workflowrun.oam.dev/step-overrides"
+	// AnnotationModeOverride overrides the execute mode of the workflow run before it starts executing steps,
+	// the value is the mode of steps optionally followed by the mode of sub steps, e.g. DAG or StepByStep,DAG
+	AnnotationModeOverride = "workflow.oam.dev/mode-override"
+	// AnnotationTeardown requests to delete the resources applied by the finished workflow run one by one in the
+	// reverse order that they were applied, it's ignored until the run is finished
+	AnnotationTeardown = "workflowrun.oam.dev/teardown"
+	// AnnotationRecordExecutionOrder records the waves of the steps in the order that they're started in the status of
+	// the workflow run if it's "true"
+	AnnotationRecordExecutionOrder = "workflowrun.oam.dev/record-execution-order"
+	// LabelCUEPackage is the label of the configmaps that contain cue packages
+	LabelCUEPackage = "workflow.oam.dev/cue-package"
+	// AnnotationCUEPackagePath is the import path of the cue package in the configmap, e.g. team.org/common,
+	// the name of the configmap will be used if it's empty
+	AnnotationCUEPackagePath = "workflow.oam.dev/cue-package-path"
+	// LabelExternalExecutor is the label of the configmaps that register the external step executors
+	LabelExternalExecutor = "workflow.oam.dev/external-executor"
+	// LabelSecretRef is the label of the secrets that can be referenced by `{{ secret.<name>.<key> }}` in the
+	// parameters of the providers if it's "true"
+	LabelSecretRef = "workflow.oam.dev/secret-ref"
 )
 
 // IsStepFinish will decide whether step is finish.
@@ -290,6 +604,167 @@ func IsStepFinish(phase v1alpha1.WorkflowStepPhase, reason string) bool {
 	}
 }
 
+// StepAttempt returns the attempt of the execution of the step by its previous status, a new attempt is started once
+// the finished step is executed again, e.g. the periodic step, while the retries of the failed step are in the same
+// attempt
+func StepAttempt(id string, previous v1alpha1.StepStatus) int {
+	if previous.ID != id {
+		return 0
+	}
+	if IsStepFinish(previous.Phase, previous.Reason) {
+		return previous.Attempt + 1
+	}
+	return previous.Attempt
+}
+
+// UnknownStepTypeError is the error of the step type that can't be resolved, there's no builtin step type, template
+// or WorkflowStepDefinition for it
+type UnknownStepTypeError struct {
+	Type string
+}
+
+func (e *UnknownStepTypeError) Error() string {
+	return fmt.Sprintf("unknown step type %q, no builtin step type, template or WorkflowStepDefinition is found for it", e.Type)
+}
+
+// IsUnknownStepType checks if the error is caused by an unknown step type
+func IsUnknownStepType(err error) bool {
+	var e *UnknownStepTypeError
+	return errors.As(err, &e)
+}
+
+// CheckDependsOnCondition checks the grouped dependency with the step status,
+// returns whether the dependency is finished and the phase of the dependency.
+func CheckDependsOnCondition(c *v1alpha1.DependsOnCondition, stepStatus map[string]v1alpha1.StepStatus) (bool, v1alpha1.WorkflowStepPhase) {
+	if c == nil {
+		return true, v1alpha1.WorkflowStepPhaseSucceeded
+	}
+	finished, phase := true, v1alpha1.WorkflowStepPhaseSucceeded
+	merge := func(f bool, p v1alpha1.WorkflowStepPhase) {
+		finished = finished && f
+		if phase == v1alpha1.WorkflowStepPhaseSucceeded {
+			phase = p
+		}
+	}
+	if c.Step != "" {
+		status, ok := stepStatus[c.Step]
+		if !ok {
+			merge(false, v1alpha1.WorkflowStepPhasePending)
+		} else {
+			stepFinished, stepPhase := IsStepFinish(status.Phase, status.Reason), status.Phase
+			// the finished step satisfies the condition that ignores its failure
+			if stepFinished && c.IgnoreFailure {
+				stepPhase = v1alpha1.WorkflowStepPhaseSucceeded
+			}
+			merge(stepFinished, stepPhase)
+		}
+	}
+	for i := range c.AllOf {
+		merge(CheckDependsOnCondition(&c.AllOf[i], stepStatus))
+	}
+	if len(c.AnyOf) > 0 {
+		anyFinished, anyPhase := true, v1alpha1.WorkflowStepPhase("")
+		for i := range c.AnyOf {
+			f, p := CheckDependsOnCondition(&c.AnyOf[i], stepStatus)
+			if f && p == v1alpha1.WorkflowStepPhaseSucceeded {
+				anyFinished, anyPhase = true, p
+				break
+			}
+			anyFinished = anyFinished && f
+			if anyPhase == "" {
+				anyPhase = p
+			}
+		}
+		merge(anyFinished, anyPhase)
+	}
+	return finished, phase
+}
+
+// InExecutionWindow checks whether the time is in any of the ranges of the execution window, it returns the error
+// if the window is invalid, e.g. the time zone is unknown or the time of the range is not in the format of HH:MM
+func InExecutionWindow(w *v1alpha1.ExecutionWindow, now time.Time) (bool, error) {
+	if w == nil {
+		return true, nil
+	}
+	if len(w.Ranges) == 0 {
+		return false, fmt.Errorf("the execution window has no time ranges")
+	}
+	loc := time.UTC
+	if w.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return false, fmt.Errorf("invalid time zone %s: %w", w.Timezone, err)
+		}
+	}
+	now = now.In(loc)
+	minute := now.Hour()*60 + now.Minute()
+	in := false
+	for _, r := range w.Ranges {
+		start, err := parseTimeOfDay(r.Start)
+		if err != nil {
+			return false, err
+		}
+		end, err := parseTimeOfDay(r.End)
+		if err != nil {
+			return false, err
+		}
+		days := make(map[time.Weekday]bool)
+		for _, d := range r.Days {
+			day, err := parseWeekday(d)
+			if err != nil {
+				return false, err
+			}
+			days[day] = true
+		}
+		onDay := func(day time.Weekday) bool {
+			return len(days) == 0 || days[day]
+		}
+		if start < end {
+			in = in || (onDay(now.Weekday()) && minute >= start && minute < end)
+			continue
+		}
+		// the range ends on the next day, so the time before the end is in the range started on the day before
+		in = in || (onDay(now.Weekday()) && minute >= start) || (onDay((now.Weekday()+6)%7) && minute < end)
+	}
+	return in, nil
+}
+
+// FormatExecutionWindow formats the time ranges of the execution window, e.g. `Mon,Tue 22:00-02:00 (Asia/Shanghai)`
+func FormatExecutionWindow(w *v1alpha1.ExecutionWindow) string {
+	var ranges []string
+	for _, r := range w.Ranges {
+		s := fmt.Sprintf("%s-%s", r.Start, r.End)
+		if len(r.Days) > 0 {
+			s = strings.Join(r.Days, ",") + " " + s
+		}
+		ranges = append(ranges, s)
+	}
+	timezone := w.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	return fmt.Sprintf("%s (%s)", strings.Join(ranges, ", "), timezone)
+}
+
+// parseTimeOfDay parses the time of the day in the format of HH:MM to the minutes since the midnight
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, please use the format of HH:MM like 22:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseWeekday parses the day of the week, e.g. Mon or Monday
+func parseWeekday(s string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(s, day.String()) || strings.EqualFold(s, day.String()[:3]) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q, please use the day of the week like Mon or Monday", s)
+}
+
 // SetNamespaceInCtx set namespace in context.
 func SetNamespaceInCtx(ctx context.Context, namespace string) context.Context {
 	if namespace == "" {
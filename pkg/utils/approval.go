@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+// GetStepApprovalGates returns the approval gates of the step or sub step of the workflow run
+func GetStepApprovalGates(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, name string) ([]v1alpha1.ApprovalGate, error) {
+	steps, err := getWorkflowSteps(ctx, cli, run)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		if step.Name == name {
+			return step.ApprovalGates, nil
+		}
+		for _, sub := range step.SubSteps {
+			if sub.Name == name {
+				return sub.ApprovalGates, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// FindApprovalGate returns the approval gate with the name, nil if it's not found
+func FindApprovalGate(gates []v1alpha1.ApprovalGate, name string) *v1alpha1.ApprovalGate {
+	for i := range gates {
+		if gates[i].Name == name {
+			return &gates[i]
+		}
+	}
+	return nil
+}
+
+// IsGateApprover returns true if the user or one of the groups of the approver is allowed to approve the gate, the
+// service accounts are matched by their users, e.g. system:serviceaccount:<namespace>:<name>, and their groups, e.g.
+// system:serviceaccounts:<namespace>
+func IsGateApprover(gate v1alpha1.ApprovalGate, approver string, groups []string) bool {
+	if approver == "" {
+		return false
+	}
+	if len(gate.Approvers) == 0 {
+		return true
+	}
+	for _, a := range gate.Approvers {
+		if a == approver {
+			return true
+		}
+		for _, group := range groups {
+			if a == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PendingApprovalGates returns the gates that are not approved by their quorum yet with their progress,
+// e.g. `security (1/2)`
+func PendingApprovalGates(gates []v1alpha1.ApprovalGate, approvals []v1alpha1.StepApproval) []string {
+	var pending []string
+	for _, gate := range gates {
+		quorum := gate.Quorum
+		if quorum <= 0 {
+			quorum = 1
+		}
+		approvers := make(map[string]bool)
+		for _, approval := range approvals {
+			if approval.Gate == gate.Name && approval.Decision == v1alpha1.ApprovalDecisionApproved {
+				approvers[approval.Approver] = true
+			}
+		}
+		if len(approvers) < quorum {
+			pending = append(pending, fmt.Sprintf("%s (%d/%d)", gate.Name, len(approvers), quorum))
+		}
+	}
+	return pending
+}
+
+// ApprovalGatesMessage returns the message of the suspend step that is waiting for its approval gates, it's empty
+// if all the gates are approved
+func ApprovalGatesMessage(gates []v1alpha1.ApprovalGate, approvals []v1alpha1.StepApproval) string {
+	pending := PendingApprovalGates(gates, approvals)
+	if len(pending) == 0 {
+		return ""
+	}
+	return "Waiting for the approval gates: " + strings.Join(pending, ", ")
+}
+
+// RecordStepApproval records the approval in the status of the step or sub step of the workflow run, the status of
+// the step is returned, nil if the step is not found
+func RecordStepApproval(run *v1alpha1.WorkflowRun, name string, approval v1alpha1.StepApproval) *v1alpha1.StepStatus {
+	for i, step := range run.Status.Steps {
+		if step.Name == name {
+			status := &run.Status.Steps[i].StepStatus
+			status.Approvals = append(status.Approvals, approval)
+			return status
+		}
+		for j, sub := range step.SubStepsStatus {
+			if sub.Name == name {
+				status := &run.Status.Steps[i].SubStepsStatus[j]
+				status.Approvals = append(status.Approvals, approval)
+				return status
+			}
+		}
+	}
+	return nil
+}
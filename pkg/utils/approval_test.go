@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func TestApprovalGates(t *testing.T) {
+	r := require.New(t)
+	gates := []v1alpha1.ApprovalGate{
+		{Name: "security", Approvers: []string{"alice", "bob"}, Quorum: 2},
+		{Name: "platform"},
+	}
+	r.True(IsGateApprover(gates[0], "alice", nil))
+	r.False(IsGateApprover(gates[0], "eve", []string{"system:authenticated"}))
+	r.True(IsGateApprover(gates[1], "eve", nil))
+	r.False(IsGateApprover(gates[1], "", nil))
+	ops := v1alpha1.ApprovalGate{Name: "ops", Approvers: []string{"ops-team", "system:serviceaccount:ci:deployer"}}
+	r.True(IsGateApprover(ops, "carol", []string{"system:authenticated", "ops-team"}))
+	r.True(IsGateApprover(ops, "system:serviceaccount:ci:deployer", []string{"system:serviceaccounts", "system:serviceaccounts:ci"}))
+	r.False(IsGateApprover(ops, "system:serviceaccount:ci:builder", []string{"system:serviceaccounts", "system:serviceaccounts:ci"}))
+	r.Equal("platform", FindApprovalGate(gates, "platform").Name)
+	r.Nil(FindApprovalGate(gates, "legal"))
+
+	run := &v1alpha1.WorkflowRun{Status: v1alpha1.WorkflowRunStatus{Steps: []v1alpha1.WorkflowStepStatus{{
+		StepStatus:     v1alpha1.StepStatus{Name: "group"},
+		SubStepsStatus: []v1alpha1.StepStatus{{Name: "approve"}},
+	}}}}
+	r.Nil(RecordStepApproval(run, "not-found", v1alpha1.StepApproval{}))
+	r.Equal("Waiting for the approval gates: security (0/2), platform (0/1)", ApprovalGatesMessage(gates, nil))
+	for _, approval := range []v1alpha1.StepApproval{
+		{Gate: "security", Approver: "alice", Decision: v1alpha1.ApprovalDecisionApproved},
+		// the same approver is counted once
+		{Gate: "security", Approver: "alice", Decision: v1alpha1.ApprovalDecisionApproved},
+		{Gate: "platform", Approver: "carol", Decision: v1alpha1.ApprovalDecisionApproved},
+	} {
+		RecordStepApproval(run, "approve", approval)
+	}
+	approvals := run.Status.Steps[0].SubStepsStatus[0].Approvals
+	r.Len(approvals, 3)
+	r.Equal([]string{"security (1/2)"}, PendingApprovalGates(gates, approvals))
+	approvals = RecordStepApproval(run, "approve", v1alpha1.StepApproval{Gate: "security", Approver: "bob", Decision: v1alpha1.ApprovalDecisionApproved}).Approvals
+	r.Empty(PendingApprovalGates(gates, approvals))
+	r.Equal("", ApprovalGatesMessage(gates, approvals))
+}
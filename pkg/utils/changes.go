@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// maxOutputDiffValueSize is the max size in bytes of a value shown in the diff of an output, the longer value is
+// truncated so that the diff fits in the metadata of the step
+const maxOutputDiffValueSize = 256
+
+// shortFingerprintSize is the size of the fingerprint of a previous output shown in the diff
+const shortFingerprintSize = 12
+
+// LatestSucceededRun returns the last finished succeeded run of the workflow in the namespace except the excluded run,
+// nil if there's no such run
+func LatestSucceededRun(ctx context.Context, cli client.Client, namespace, workflow, exclude string) (*v1alpha1.WorkflowRun, error) {
+	runs, _, err := ListRuns(ctx, cli, ListRunsOptions{
+		Namespace: namespace,
+		Phases:    []v1alpha1.WorkflowRunPhase{v1alpha1.WorkflowStateSucceeded},
+		Workflow:  workflow,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var latest *v1alpha1.WorkflowRun
+	for i, run := range runs.Items {
+		if run.Name == exclude {
+			continue
+		}
+		if latest == nil || runFinishTime(latest).Before(runFinishTime(&run)) {
+			latest = &runs.Items[i]
+		}
+	}
+	return latest, nil
+}
+
+// runFinishTime returns the end time of the run, or the creation time if the end time is not recorded
+func runFinishTime(run *v1alpha1.WorkflowRun) time.Time {
+	if !run.Status.EndTime.IsZero() {
+		return run.Status.EndTime.Time
+	}
+	return run.CreationTimestamp.Time
+}
+
+// StepOutputFingerprints returns the fingerprints of the outputs of the step kept in the status of the run, it returns
+// false if the step is not found or has no fingerprints
+func StepOutputFingerprints(run *v1alpha1.WorkflowRun, step string) (map[string]string, bool) {
+	for _, ss := range run.Status.Steps {
+		if ss.Name == step {
+			return ss.OutputFingerprints, ss.OutputFingerprints != nil
+		}
+		for _, sub := range ss.SubStepsStatus {
+			if sub.Name == step {
+				return sub.OutputFingerprints, sub.OutputFingerprints != nil
+			}
+		}
+	}
+	return nil, false
+}
+
+// FingerprintOutputs returns the fingerprints of the JSON of the outputs keyed by their names
+func FingerprintOutputs(outputs map[string]string) map[string]string {
+	fingerprints := make(map[string]string, len(outputs))
+	for name, v := range outputs {
+		fingerprints[name] = fingerprint(v)
+	}
+	return fingerprints
+}
+
+func fingerprint(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContextOutputs returns the JSON of the outputs in the workflow context keyed by their names, the outputs that
+// are not in the context are omitted
+func ContextOutputs(wfCtx wfContext.Context, names []string) (map[string]string, error) {
+	outputs := make(map[string]string, len(names))
+	for _, name := range names {
+		v, err := wfCtx.GetVar(name)
+		if !v.Exists() {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := v.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal output %s: %w", name, err)
+		}
+		outputs[name] = string(b)
+	}
+	return outputs, nil
+}
+
+// RunOutputs returns the JSON of the outputs kept in the context backend of the workflow run keyed by their names
+func RunOutputs(ctx context.Context, run *v1alpha1.WorkflowRun, names []string) (map[string]string, error) {
+	if run.Status.ContextBackend == nil {
+		return map[string]string{}, nil
+	}
+	wfCtx, err := wfContext.LoadContext(ctx, run.Namespace, run.Name, run.Status.ContextBackend.Name)
+	if err != nil {
+		return nil, err
+	}
+	return ContextOutputs(wfCtx, names)
+}
+
+// DiffOutputs compares the current outputs with the fingerprints of the previous ones, it returns the lines of the diff
+// in the order of the names of the outputs, e.g. `config: sha256:1a2b3c4d5e6f -> {"replicas":2}`. The previous values
+// are shown by their short fingerprints, the values of the sensitive outputs are redacted, and the outputs
+// that are missing in the previous ones are always changed.
+func DiffOutputs(previous, current map[string]string, sensitive map[string]bool) []string {
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var diff []string
+	for _, name := range names {
+		old, hasOld := previous[name]
+		cur, hasCur := current[name]
+		if hasOld && hasCur && old == fingerprint(cur) {
+			continue
+		}
+		oldValue, curValue := "<none>", "<none>"
+		switch {
+		case !hasOld:
+		case sensitive[name]:
+			oldValue = types.RedactedValue
+		default:
+			oldValue = "sha256:" + old[:min(len(old), shortFingerprintSize)]
+		}
+		switch {
+		case !hasCur:
+		case sensitive[name]:
+			curValue = types.RedactedValue
+		case len(cur) > maxOutputDiffValueSize:
+			curValue = cur[:maxOutputDiffValueSize] + "..."
+		default:
+			curValue = cur
+		}
+		diff = append(diff, fmt.Sprintf("%s: %s -> %s", name, oldValue, curValue))
+	}
+	return diff
+}
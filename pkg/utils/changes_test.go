@@ -0,0 +1,127 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+func TestLatestSucceededRun(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	newRun := func(name, workflow string, phase v1alpha1.WorkflowRunPhase, creationTime time.Time, endTime ...time.Time) *v1alpha1.WorkflowRun {
+		run := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "latest-run",
+				CreationTimestamp: metav1.NewTime(creationTime),
+				Labels: map[string]string{
+					types.LabelWorkflowRunPhase:    string(phase),
+					types.LabelWorkflowRunWorkflow: workflow,
+				},
+			},
+			Status: v1alpha1.WorkflowRunStatus{
+				ContextBackend: &corev1.ObjectReference{Name: "workflow-" + name + "-context", Namespace: "latest-run"},
+			},
+		}
+		if len(endTime) > 0 {
+			run.Status.EndTime = metav1.NewTime(endTime[0])
+		}
+		r.NoError(cli.Create(ctx, run))
+		return run
+	}
+	runs := []*v1alpha1.WorkflowRun{
+		newRun("run-1", "deploy", v1alpha1.WorkflowStateSucceeded, now.Add(-3*time.Hour)),
+		newRun("run-2", "deploy", v1alpha1.WorkflowStateSucceeded, now.Add(-2*time.Hour)),
+		newRun("run-3", "deploy", v1alpha1.WorkflowStateFailed, now.Add(-time.Hour)),
+		newRun("run-4", "test", v1alpha1.WorkflowStateSucceeded, now.Add(-time.Hour)),
+		newRun("run-5", "deploy", v1alpha1.WorkflowStateSucceeded, now),
+		// created later than run-2 but finished earlier
+		newRun("run-7", "deploy", v1alpha1.WorkflowStateSucceeded, now.Add(-time.Hour), now.Add(-3*time.Hour)),
+	}
+	for _, run := range runs {
+		defer func(run *v1alpha1.WorkflowRun) { _ = cli.Delete(ctx, run) }(run)
+	}
+
+	latest, err := LatestSucceededRun(ctx, cli, "latest-run", "deploy", "run-5")
+	r.NoError(err)
+	r.Equal("run-2", latest.Name)
+	latest, err = LatestSucceededRun(ctx, cli, "latest-run", "deploy", "run-6")
+	r.NoError(err)
+	r.Equal("run-5", latest.Name)
+	latest, err = LatestSucceededRun(ctx, cli, "latest-run", "build", "")
+	r.NoError(err)
+	r.Nil(latest)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "workflow-run-2-context", Namespace: "latest-run"},
+		Data:       map[string]string{wfContext.ConfigMapKeyVars: `config: {replicas: 1}, version: "v1"`},
+	}
+	r.NoError(cli.Create(ctx, cm))
+	defer func() { _ = cli.Delete(ctx, cm) }()
+	outputs, err := RunOutputs(ctx, runs[1], []string{"config", "version", "missing"})
+	r.NoError(err)
+	r.Equal(map[string]string{"config": `{"replicas":1}`, "version": `"v1"`}, outputs)
+}
+
+func TestStepOutputFingerprints(t *testing.T) {
+	r := require.New(t)
+	run := &v1alpha1.WorkflowRun{Status: v1alpha1.WorkflowRunStatus{Steps: []v1alpha1.WorkflowStepStatus{
+		{StepStatus: v1alpha1.StepStatus{Name: "render", OutputFingerprints: map[string]string{"config": "a"}}},
+		{
+			StepStatus:     v1alpha1.StepStatus{Name: "group"},
+			SubStepsStatus: []v1alpha1.StepStatus{{Name: "sub", OutputFingerprints: map[string]string{"version": "b"}}},
+		},
+	}}}
+	fingerprints, ok := StepOutputFingerprints(run, "render")
+	r.True(ok)
+	r.Equal(map[string]string{"config": "a"}, fingerprints)
+	fingerprints, ok = StepOutputFingerprints(run, "sub")
+	r.True(ok)
+	r.Equal(map[string]string{"version": "b"}, fingerprints)
+	_, ok = StepOutputFingerprints(run, "group")
+	r.False(ok)
+	_, ok = StepOutputFingerprints(run, "missing")
+	r.False(ok)
+}
+
+func TestDiffOutputs(t *testing.T) {
+	r := require.New(t)
+	previous := FingerprintOutputs(map[string]string{"config": `{"replicas":1}`, "token": `"a"`, "removed": `1`, "same": `true`})
+	current := map[string]string{"config": `{"replicas":2}`, "token": `"b"`, "added": `"x"`, "same": `true`, "long": `"` + strings.Repeat("a", 300) + `"`}
+	diff := DiffOutputs(previous, current, map[string]bool{"token": true})
+	r.Equal([]string{
+		`added: <none> -> "x"`,
+		`config: sha256:` + previous["config"][:shortFingerprintSize] + ` -> {"replicas":2}`,
+		`long: <none> -> "` + strings.Repeat("a", maxOutputDiffValueSize-1) + `...`,
+		`removed: sha256:` + previous["removed"][:shortFingerprintSize] + ` -> <none>`,
+		`token: <redacted> -> <redacted>`,
+	}, diff)
+	r.Empty(DiffOutputs(FingerprintOutputs(current), current, nil))
+}
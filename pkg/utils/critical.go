@@ -0,0 +1,197 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/hooks"
+)
+
+// CriticalPath returns the steps on the critical path of the run in the order that they're executed and the total
+// duration of them. The critical path is the chain of the dependent steps with the longest total duration, which
+// determines the duration of the run, so the steps on it are the ones worth optimizing or parallelizing.
+//
+// It's computed from the status of the run only, so it works on the archived runs as well. The duration of a step
+// is from its first to its last execution, and a step group is counted as a whole. In StepByStep mode each step
+// depends on the previous one. In DAG mode the dependencies are read from the dependsOn and the inputs of the
+// steps in the spec, or inferred from the timings if the steps are not in the spec, e.g. the run refers to a
+// workflow, where a step depends on the steps finished before it starts, see CriticalPathInferred.
+func CriticalPath(wr *v1alpha1.WorkflowRun) ([]v1alpha1.StepStatus, time.Duration) {
+	steps := make([]v1alpha1.StepStatus, 0, len(wr.Status.Steps))
+	index := make(map[string]int, len(wr.Status.Steps))
+	for _, step := range wr.Status.Steps {
+		index[step.Name] = len(steps)
+		steps = append(steps, step.StepStatus)
+	}
+	if len(steps) == 0 {
+		return nil, 0
+	}
+	durations := make([]time.Duration, len(steps))
+	for i, step := range steps {
+		durations[i] = stepDuration(step)
+	}
+	dependencies := stepDependencies(wr, steps, index)
+
+	// longest[i] is the longest total duration of the chains ending with the step i, and previous[i] is the step
+	// before it on the chain, the steps are resolved recursively since the status is not in topological order in
+	// DAG mode
+	longest := make([]time.Duration, len(steps))
+	previous := make([]int, len(steps))
+	resolved := make([]bool, len(steps))
+	visiting := make([]bool, len(steps))
+	var resolve func(i int) time.Duration
+	resolve = func(i int) time.Duration {
+		if resolved[i] {
+			return longest[i]
+		}
+		// the cyclic dependencies are ignored, which can't be executed anyway
+		if visiting[i] {
+			return 0
+		}
+		visiting[i] = true
+		previous[i] = -1
+		var chain time.Duration
+		for _, dep := range dependencies[i] {
+			if d := resolve(dep); previous[i] < 0 || d > chain {
+				chain, previous[i] = d, dep
+			}
+		}
+		visiting[i] = false
+		resolved[i] = true
+		longest[i] = chain + durations[i]
+		return longest[i]
+	}
+	last := 0
+	for i := range steps {
+		if resolve(i) >= longest[last] {
+			last = i
+		}
+	}
+
+	var path []v1alpha1.StepStatus
+	for i := last; i >= 0; i = previous[i] {
+		path = append([]v1alpha1.StepStatus{steps[i]}, path...)
+	}
+	return path, longest[last]
+}
+
+// CriticalPathInferred returns whether the critical path of the run is inferred from the timings of the steps, it's
+// a heuristic in DAG mode if the steps are not in the spec of the run, since a step that starts after another step
+// is finished doesn't necessarily depend on it
+func CriticalPathInferred(wr *v1alpha1.WorkflowRun) bool {
+	if mode := wr.Status.Mode.Steps; mode == "" || mode == v1alpha1.WorkflowModeStep {
+		return false
+	}
+	return wr.Spec.WorkflowSpec == nil || len(wr.Spec.WorkflowSpec.Steps) == 0
+}
+
+// stepDependencies returns the indexes of the steps that each step depends on
+func stepDependencies(wr *v1alpha1.WorkflowRun, steps []v1alpha1.StepStatus, index map[string]int) [][]int {
+	dependencies := make([][]int, len(steps))
+	if mode := wr.Status.Mode.Steps; mode == "" || mode == v1alpha1.WorkflowModeStep {
+		for i := 1; i < len(steps); i++ {
+			dependencies[i] = []int{i - 1}
+		}
+		return dependencies
+	}
+
+	if CriticalPathInferred(wr) {
+		for i, step := range steps {
+			for j, dep := range steps {
+				if i != j && !step.FirstExecuteTime.IsZero() && !dep.LastExecuteTime.IsZero() && !step.FirstExecuteTime.Before(&dep.LastExecuteTime) {
+					dependencies[i] = append(dependencies[i], j)
+				}
+			}
+		}
+		return dependencies
+	}
+
+	spec := wr.Spec.WorkflowSpec
+	// the sub steps are counted in their groups, and the outputs of the sub steps are produced by their groups
+	groups := make(map[string]string)
+	producers := make(map[string][]string)
+	var all []v1alpha1.WorkflowStep
+	for _, list := range [][]v1alpha1.WorkflowStep{spec.Steps, spec.OnComplete, spec.OnSuccess, spec.OnFailure} {
+		all = append(all, list...)
+	}
+	for _, step := range all {
+		groups[step.Name] = step.Name
+		for _, output := range step.Outputs {
+			producers[output.Name] = append(producers[output.Name], step.Name)
+		}
+		if len(step.SubSteps) > 0 || step.Generator != nil {
+			producers[step.Name] = append(producers[step.Name], step.Name)
+		}
+		for _, sub := range step.SubSteps {
+			groups[sub.Name] = step.Name
+			for _, output := range sub.Outputs {
+				producers[output.Name] = append(producers[output.Name], step.Name)
+			}
+		}
+	}
+	add := func(step, dep string) {
+		i, ok := index[step]
+		j, found := index[groups[dep]]
+		if !ok || !found || i == j {
+			return
+		}
+		for _, k := range dependencies[i] {
+			if k == j {
+				return
+			}
+		}
+		dependencies[i] = append(dependencies[i], j)
+	}
+	addBase := func(group string, step v1alpha1.WorkflowStepBase) {
+		for _, dep := range step.DependsOn {
+			add(group, dep)
+		}
+		if step.DependsOnCondition != nil {
+			for _, dep := range step.DependsOnCondition.StepNames() {
+				add(group, dep)
+			}
+		}
+		for _, input := range step.Inputs {
+			// the lazy input and the output of the prior execution don't make the step wait for the producer
+			if input.Lazy || strings.HasPrefix(input.From, hooks.PreviousOutputPrefix) {
+				continue
+			}
+			name, _, _ := strings.Cut(input.From, ".")
+			for _, producer := range producers[name] {
+				add(group, producer)
+			}
+		}
+	}
+	for _, step := range all {
+		addBase(step.Name, step.WorkflowStepBase)
+		for _, sub := range step.SubSteps {
+			addBase(step.Name, sub)
+		}
+	}
+	// the finalizer steps are executed after all the main steps
+	for _, list := range [][]v1alpha1.WorkflowStep{spec.OnComplete, spec.OnSuccess, spec.OnFailure} {
+		for _, finalizer := range list {
+			for _, step := range spec.Steps {
+				add(finalizer.Name, step.Name)
+			}
+		}
+	}
+	return dependencies
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func TestCriticalPath(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	timed := func(name string, from, to time.Duration) v1alpha1.WorkflowStepStatus {
+		return v1alpha1.WorkflowStepStatus{StepStatus: v1alpha1.StepStatus{
+			ID:               name + "-id",
+			Name:             name,
+			Phase:            v1alpha1.WorkflowStepPhaseSucceeded,
+			FirstExecuteTime: metav1.NewTime(start.Add(from)),
+			LastExecuteTime:  metav1.NewTime(start.Add(to)),
+		}}
+	}
+	step := func(name string, base v1alpha1.WorkflowStepBase) v1alpha1.WorkflowStep {
+		base.Name = name
+		base.Type = "apply"
+		return v1alpha1.WorkflowStep{WorkflowStepBase: base}
+	}
+	dag := v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG}
+	testCases := map[string]struct {
+		run      *v1alpha1.WorkflowRun
+		path     []string
+		duration time.Duration
+		inferred bool
+	}{
+		"step by step": {
+			run: &v1alpha1.WorkflowRun{Status: v1alpha1.WorkflowRunStatus{Steps: []v1alpha1.WorkflowStepStatus{
+				timed("build", 0, time.Minute),
+				timed("test", time.Minute, 3*time.Minute),
+				// the pruned step has no timings
+				{StepStatus: v1alpha1.StepStatus{ID: "deploy-id", Name: "deploy", Phase: v1alpha1.WorkflowStepPhaseSucceeded}},
+			}}},
+			path:     []string{"build", "test", "deploy"},
+			duration: 3 * time.Minute,
+		},
+		"dag with the steps in spec": {
+			run: &v1alpha1.WorkflowRun{
+				Spec: v1alpha1.WorkflowRunSpec{WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						step("build", v1alpha1.WorkflowStepBase{}),
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "test", Type: "step-group", DependsOn: []string{"build"}},
+							SubSteps: []v1alpha1.WorkflowStepBase{
+								{Name: "unit", Type: "apply", Outputs: v1alpha1.StepOutputs{{Name: "report", ValueFrom: "output.report"}}},
+							},
+						},
+						step("lint", v1alpha1.WorkflowStepBase{DependsOn: []string{"build"}}),
+						step("publish", v1alpha1.WorkflowStepBase{Inputs: v1alpha1.StepInputs{{From: "report"}, {From: "lint-result", Lazy: true}}}),
+					},
+					OnComplete: []v1alpha1.WorkflowStep{step("notify", v1alpha1.WorkflowStepBase{})},
+				}},
+				Status: v1alpha1.WorkflowRunStatus{Mode: dag, Steps: []v1alpha1.WorkflowStepStatus{
+					timed("publish", 7*time.Minute, 8*time.Minute),
+					timed("build", 0, 2*time.Minute),
+					timed("lint", 2*time.Minute, 6*time.Minute),
+					timed("test", 2*time.Minute, 7*time.Minute),
+					timed("notify", 8*time.Minute, 8*time.Minute+30*time.Second),
+				}},
+			},
+			path:     []string{"build", "test", "publish", "notify"},
+			duration: 8*time.Minute + 30*time.Second,
+		},
+		"dag inferred from the timings": {
+			run: &v1alpha1.WorkflowRun{
+				Spec: v1alpha1.WorkflowRunSpec{WorkflowRef: "release"},
+				Status: v1alpha1.WorkflowRunStatus{Mode: dag, Steps: []v1alpha1.WorkflowStepStatus{
+					timed("a", 0, 2*time.Minute),
+					timed("b", 0, 5*time.Minute),
+					timed("c", 5*time.Minute, 6*time.Minute),
+					timed("d", time.Minute, 3*time.Minute),
+				}},
+			},
+			path:     []string{"b", "c"},
+			duration: 6 * time.Minute,
+			inferred: true,
+		},
+		"no steps": {
+			run: &v1alpha1.WorkflowRun{},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			path, duration := CriticalPath(tc.run)
+			var names []string
+			for _, step := range path {
+				names = append(names, step.Name)
+			}
+			r.Equal(tc.path, names)
+			r.Equal(tc.duration, duration)
+			r.Equal(tc.inferred, CriticalPathInferred(tc.run))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/hooks"
+)
+
+// DataFlowEdge is the data passed from the output of a step to the input of another step
+type DataFlowEdge struct {
+	// From is the name of the step that produces the output
+	From string `json:"from"`
+	// To is the name of the step that consumes the output
+	To string `json:"to"`
+	// Output is the name of the output
+	Output string `json:"output"`
+	// Input is the `from` of the input, e.g. `output.replicas`, or the `from` of the generator of the step group
+	Input string `json:"input"`
+	// ParameterKey is the key of the properties that the input is filled in
+	ParameterKey string `json:"parameterKey,omitempty"`
+}
+
+// DataFlowIssue is an input that can't be resolved or an output that is not used
+type DataFlowIssue struct {
+	// Step is the name of the step
+	Step string `json:"step"`
+	// Name is the `from` of the input or the name of the output
+	Name string `json:"name"`
+	// Message describes the issue
+	Message string `json:"message"`
+}
+
+// DataFlowReport is the data flow between the steps of a workflow
+type DataFlowReport struct {
+	// Edges are the data passed between the steps, in the order of the consuming steps
+	Edges []DataFlowEdge `json:"edges,omitempty"`
+	// ExternalInputs are the inputs from the outside of the workflow, e.g. `shared.<name>` and `context.<path>`
+	ExternalInputs []DataFlowIssue `json:"externalInputs,omitempty"`
+	// UnresolvedInputs are the inputs that are not the outputs of any step
+	UnresolvedInputs []DataFlowIssue `json:"unresolvedInputs,omitempty"`
+	// UnusedOutputs are the outputs that are not the inputs of any step
+	UnusedOutputs []DataFlowIssue `json:"unusedOutputs,omitempty"`
+}
+
+// Valid returns true if all the inputs of the steps are resolved
+func (r DataFlowReport) Valid() bool {
+	return len(r.UnresolvedInputs) == 0
+}
+
+// DOT renders the data flow as a graph in the DOT language of graphviz. The edges are labeled with the inputs, and
+// the unresolved inputs are drawn from a dashed node.
+func (r DataFlowReport) DOT() string {
+	sb := strings.Builder{}
+	sb.WriteString("digraph dataflow {\n")
+	for _, e := range r.Edges {
+		sb.WriteString(fmt.Sprintf("  %q -> %q [label=%q];\n", e.From, e.To, e.Input))
+	}
+	for _, i := range r.UnresolvedInputs {
+		sb.WriteString(fmt.Sprintf("  %q [style=dashed];\n  %q -> %q [style=dashed];\n", i.Name, i.Name, i.Step))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// AnalyzeDataFlow maps the inputs of the steps to the outputs that produce them, including the sub steps and the
+// finalizer steps. It only reads the spec, so it can be used to review the workflows before they're run.
+func AnalyzeDataFlow(spec *v1alpha1.WorkflowSpec) DataFlowReport {
+	report := DataFlowReport{}
+	if spec == nil {
+		return report
+	}
+	var steps []v1alpha1.WorkflowStep
+	for _, list := range [][]v1alpha1.WorkflowStep{spec.Steps, spec.OnComplete, spec.OnSuccess, spec.OnFailure} {
+		steps = append(steps, list...)
+	}
+
+	// producers are the steps that produce the outputs keyed by the output names, the aggregated outputs of the sub
+	// steps are produced under the name of the step group
+	producers := map[string][]string{}
+	var outputs []DataFlowIssue
+	addOutputs := func(step v1alpha1.WorkflowStepBase) {
+		for _, output := range step.Outputs {
+			producers[output.Name] = append(producers[output.Name], step.Name)
+			outputs = append(outputs, DataFlowIssue{Step: step.Name, Name: output.Name})
+		}
+	}
+	for _, step := range steps {
+		addOutputs(step.WorkflowStepBase)
+		if len(step.SubSteps) > 0 || step.Generator != nil {
+			producers[step.Name] = append(producers[step.Name], step.Name)
+		}
+		for _, sub := range step.SubSteps {
+			addOutputs(sub)
+		}
+	}
+
+	used := map[string]bool{}
+	consume := func(step, from, parameterKey string) {
+		if previous, ok := strings.CutPrefix(from, hooks.PreviousOutputPrefix); ok {
+			name, _, _ := strings.Cut(previous, ".")
+			used[name] = true
+			report.Edges = append(report.Edges, DataFlowEdge{From: step, To: step, Output: name, Input: from, ParameterKey: parameterKey})
+			return
+		}
+		name, _, _ := strings.Cut(from, ".")
+		if name == hooks.SharedInputsKey || name == model.ContextFieldName {
+			report.ExternalInputs = append(report.ExternalInputs, DataFlowIssue{Step: step, Name: from, Message: fmt.Sprintf("the input %s is from the %s of the run", from, name)})
+			return
+		}
+		if len(producers[name]) == 0 {
+			report.UnresolvedInputs = append(report.UnresolvedInputs, DataFlowIssue{Step: step, Name: from, Message: fmt.Sprintf("the input %s is not the output of any step", from)})
+			return
+		}
+		used[name] = true
+		for _, producer := range producers[name] {
+			report.Edges = append(report.Edges, DataFlowEdge{From: producer, To: step, Output: name, Input: from, ParameterKey: parameterKey})
+		}
+	}
+	consumeInputs := func(step v1alpha1.WorkflowStepBase) {
+		for _, input := range step.Inputs {
+			consume(step.Name, input.From, input.ParameterKey)
+		}
+	}
+	for _, step := range steps {
+		consumeInputs(step.WorkflowStepBase)
+		if step.Generator != nil {
+			consume(step.Name, step.Generator.From, "")
+		}
+		for _, sub := range step.SubSteps {
+			consumeInputs(sub)
+		}
+	}
+
+	for _, output := range outputs {
+		if !used[output.Name] {
+			output.Message = fmt.Sprintf("the output %s is not the input of any step", output.Name)
+			report.UnusedOutputs = append(report.UnusedOutputs, output)
+		}
+	}
+	return report
+}
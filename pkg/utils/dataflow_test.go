@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func TestAnalyzeDataFlow(t *testing.T) {
+	r := require.New(t)
+	r.True(AnalyzeDataFlow(nil).Valid())
+
+	spec := &v1alpha1.WorkflowSpec{
+		Steps: []v1alpha1.WorkflowStep{
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:    "build",
+				Outputs: v1alpha1.StepOutputs{{Name: "image", ValueFrom: "output.image"}, {Name: "digest", ValueFrom: "output.digest"}},
+			}},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "deploy"},
+				SubSteps: []v1alpha1.WorkflowStepBase{{
+					Name:    "deploy-app",
+					Inputs:  v1alpha1.StepInputs{{From: "image", ParameterKey: "image"}, {From: "shared.region", ParameterKey: "region"}},
+					Outputs: v1alpha1.StepOutputs{{Name: "endpoint", ValueFrom: "output.endpoint"}},
+				}},
+			},
+			{
+				WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "verify"},
+				Generator:        &v1alpha1.StepGenerator{From: "deploy.endpoints"},
+			},
+			{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:    "poll",
+				Inputs:  v1alpha1.StepInputs{{From: "self.previous.cursor", ParameterKey: "cursor"}, {From: "token"}},
+				Outputs: v1alpha1.StepOutputs{{Name: "cursor", ValueFrom: "output.cursor"}},
+			}},
+		},
+		OnFailure: []v1alpha1.WorkflowStep{{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+			Name:   "notify",
+			Inputs: v1alpha1.StepInputs{{From: "endpoint", ParameterKey: "url"}, {From: "context.name"}},
+		}}},
+	}
+	report := AnalyzeDataFlow(spec)
+	r.False(report.Valid())
+	r.Equal([]DataFlowEdge{
+		{From: "build", To: "deploy-app", Output: "image", Input: "image", ParameterKey: "image"},
+		{From: "deploy", To: "verify", Output: "deploy", Input: "deploy.endpoints"},
+		{From: "poll", To: "poll", Output: "cursor", Input: "self.previous.cursor", ParameterKey: "cursor"},
+		{From: "deploy-app", To: "notify", Output: "endpoint", Input: "endpoint", ParameterKey: "url"},
+	}, report.Edges)
+	r.Equal([]DataFlowIssue{
+		{Step: "deploy-app", Name: "shared.region", Message: "the input shared.region is from the shared of the run"},
+		{Step: "notify", Name: "context.name", Message: "the input context.name is from the context of the run"},
+	}, report.ExternalInputs)
+	r.Equal([]DataFlowIssue{{Step: "poll", Name: "token", Message: "the input token is not the output of any step"}}, report.UnresolvedInputs)
+	r.Equal([]DataFlowIssue{{Step: "build", Name: "digest", Message: "the output digest is not the input of any step"}}, report.UnusedOutputs)
+
+	dot := report.DOT()
+	r.Contains(dot, `"build" -> "deploy-app" [label="image"];`)
+	r.Contains(dot, `"token" -> "poll" [style=dashed];`)
+}
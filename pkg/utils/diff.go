@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"time"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+// StepDiff is the difference of a step between two workflow runs
+type StepDiff struct {
+	// Name is the name of the step, the name of sub step is in the format of `<group>.<sub step>`
+	Name string `json:"name"`
+	// OldPhase is the phase of the step in the old run
+	OldPhase v1alpha1.WorkflowStepPhase `json:"oldPhase,omitempty"`
+	// NewPhase is the phase of the step in the new run
+	NewPhase v1alpha1.WorkflowStepPhase `json:"newPhase,omitempty"`
+	// OldReason is the reason of the step in the old run
+	OldReason string `json:"oldReason,omitempty"`
+	// NewReason is the reason of the step in the new run
+	NewReason string `json:"newReason,omitempty"`
+	// OldDuration is the execute duration of the step in the old run
+	OldDuration time.Duration `json:"oldDuration,omitempty"`
+	// NewDuration is the execute duration of the step in the new run
+	NewDuration time.Duration `json:"newDuration,omitempty"`
+}
+
+// PhaseChanged returns true if the phase of the step is changed
+func (d StepDiff) PhaseChanged() bool {
+	return d.OldPhase != d.NewPhase
+}
+
+// ReasonChanged returns true if the reason of the step is changed
+func (d StepDiff) ReasonChanged() bool {
+	return d.OldReason != d.NewReason
+}
+
+// RunDiff is the difference between two workflow runs
+type RunDiff struct {
+	// OldPhase is the phase of the old run
+	OldPhase v1alpha1.WorkflowRunPhase `json:"oldPhase,omitempty"`
+	// NewPhase is the phase of the new run
+	NewPhase v1alpha1.WorkflowRunPhase `json:"newPhase,omitempty"`
+	// Steps is the differences of the steps that exist in both runs, in the order of the new run
+	Steps []StepDiff `json:"steps,omitempty"`
+	// AddedSteps is the steps that only exist in the new run
+	AddedSteps []string `json:"addedSteps,omitempty"`
+	// RemovedSteps is the steps that only exist in the old run
+	RemovedSteps []string `json:"removedSteps,omitempty"`
+	// NewlyFailedSteps is the steps that failed in the new run but not in the old run
+	NewlyFailedSteps []string `json:"newlyFailedSteps,omitempty"`
+}
+
+// Empty returns true if there is no difference between the two runs
+func (d RunDiff) Empty() bool {
+	return d.OldPhase == d.NewPhase && len(d.Steps) == 0 && len(d.AddedSteps) == 0 && len(d.RemovedSteps) == 0
+}
+
+// DiffRuns compares the status of the old run a with the new run b.
+// It only reads the status of the runs, so it works with the archived runs as well.
+func DiffRuns(a, b *v1alpha1.WorkflowRun) RunDiff {
+	var oldStatus, newStatus v1alpha1.WorkflowRunStatus
+	if a != nil {
+		oldStatus = a.Status
+	}
+	if b != nil {
+		newStatus = b.Status
+	}
+	diff := RunDiff{
+		OldPhase: oldStatus.Phase,
+		NewPhase: newStatus.Phase,
+	}
+	oldSteps, oldOrder := flattenStepStatus(oldStatus.Steps)
+	newSteps, newOrder := flattenStepStatus(newStatus.Steps)
+	for _, name := range newOrder {
+		newStep := newSteps[name]
+		oldStep, ok := oldSteps[name]
+		if !ok {
+			diff.AddedSteps = append(diff.AddedSteps, name)
+			if newStep.Phase == v1alpha1.WorkflowStepPhaseFailed {
+				diff.NewlyFailedSteps = append(diff.NewlyFailedSteps, name)
+			}
+			continue
+		}
+		if newStep.Phase == v1alpha1.WorkflowStepPhaseFailed && oldStep.Phase != v1alpha1.WorkflowStepPhaseFailed {
+			diff.NewlyFailedSteps = append(diff.NewlyFailedSteps, name)
+		}
+		stepDiff := StepDiff{
+			Name:        name,
+			OldPhase:    oldStep.Phase,
+			NewPhase:    newStep.Phase,
+			OldReason:   oldStep.Reason,
+			NewReason:   newStep.Reason,
+			OldDuration: stepDuration(oldStep),
+			NewDuration: stepDuration(newStep),
+		}
+		if stepDiff.PhaseChanged() || stepDiff.ReasonChanged() || stepDiff.OldDuration != stepDiff.NewDuration {
+			diff.Steps = append(diff.Steps, stepDiff)
+		}
+	}
+	for _, name := range oldOrder {
+		if _, ok := newSteps[name]; !ok {
+			diff.RemovedSteps = append(diff.RemovedSteps, name)
+		}
+	}
+	return diff
+}
+
+func flattenStepStatus(steps []v1alpha1.WorkflowStepStatus) (map[string]v1alpha1.StepStatus, []string) {
+	m := make(map[string]v1alpha1.StepStatus)
+	var order []string
+	for _, step := range steps {
+		m[step.Name] = step.StepStatus
+		order = append(order, step.Name)
+		for _, sub := range step.SubStepsStatus {
+			name := step.Name + "." + sub.Name
+			m[name] = sub
+			order = append(order, name)
+		}
+	}
+	return m, order
+}
+
+func stepDuration(status v1alpha1.StepStatus) time.Duration {
+	if status.FirstExecuteTime.IsZero() || status.LastExecuteTime.IsZero() {
+		return 0
+	}
+	return status.LastExecuteTime.Sub(status.FirstExecuteTime.Time)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func TestDiffRuns(t *testing.T) {
+	now := time.Now()
+	step := func(name string, phase v1alpha1.WorkflowStepPhase, reason string, duration time.Duration, subs ...v1alpha1.StepStatus) v1alpha1.WorkflowStepStatus {
+		return v1alpha1.WorkflowStepStatus{
+			StepStatus: v1alpha1.StepStatus{
+				Name:             name,
+				Phase:            phase,
+				Reason:           reason,
+				FirstExecuteTime: metav1.NewTime(now),
+				LastExecuteTime:  metav1.NewTime(now.Add(duration)),
+			},
+			SubStepsStatus: subs,
+		}
+	}
+	testCases := map[string]struct {
+		a        *v1alpha1.WorkflowRun
+		b        *v1alpha1.WorkflowRun
+		expected RunDiff
+	}{
+		"same": {
+			a: &v1alpha1.WorkflowRun{Status: v1alpha1.WorkflowRunStatus{
+				Phase: v1alpha1.WorkflowStateSucceeded,
+				Steps: []v1alpha1.WorkflowStepStatus{step("step1", v1alpha1.WorkflowStepPhaseSucceeded, "", time.Second)},
+			}},
+			b: &v1alpha1.WorkflowRun{Status: v1alpha1.WorkflowRunStatus{
+				Phase: v1alpha1.WorkflowStateSucceeded,
+				Steps: []v1alpha1.WorkflowStepStatus{step("step1", v1alpha1.WorkflowStepPhaseSucceeded, "", time.Second)},
+			}},
+			expected: RunDiff{
+				OldPhase: v1alpha1.WorkflowStateSucceeded,
+				NewPhase: v1alpha1.WorkflowStateSucceeded,
+			},
+		},
+		"newly failed": {
+			a: &v1alpha1.WorkflowRun{Status: v1alpha1.WorkflowRunStatus{
+				Phase: v1alpha1.WorkflowStateSucceeded,
+				Steps: []v1alpha1.WorkflowStepStatus{
+					step("step1", v1alpha1.WorkflowStepPhaseSucceeded, "", time.Second),
+					step("group", v1alpha1.WorkflowStepPhaseSucceeded, "", time.Second,
+						v1alpha1.StepStatus{Name: "sub1", Phase: v1alpha1.WorkflowStepPhaseSucceeded},
+						v1alpha1.StepStatus{Name: "sub2", Phase: v1alpha1.WorkflowStepPhaseSucceeded}),
+					step("removed", v1alpha1.WorkflowStepPhaseSucceeded, "", time.Second),
+				},
+			}},
+			b: &v1alpha1.WorkflowRun{Status: v1alpha1.WorkflowRunStatus{
+				Phase: v1alpha1.WorkflowStateFailed,
+				Steps: []v1alpha1.WorkflowStepStatus{
+					step("step1", v1alpha1.WorkflowStepPhaseSucceeded, "", 2*time.Second),
+					step("group", v1alpha1.WorkflowStepPhaseFailed, "", time.Second,
+						v1alpha1.StepStatus{Name: "sub1", Phase: v1alpha1.WorkflowStepPhaseSucceeded},
+						v1alpha1.StepStatus{Name: "sub2", Phase: v1alpha1.WorkflowStepPhaseFailed, Reason: "Timeout"}),
+					step("added", v1alpha1.WorkflowStepPhaseFailed, "Execute", time.Second),
+				},
+			}},
+			expected: RunDiff{
+				OldPhase: v1alpha1.WorkflowStateSucceeded,
+				NewPhase: v1alpha1.WorkflowStateFailed,
+				Steps: []StepDiff{
+					{
+						Name:        "step1",
+						OldPhase:    v1alpha1.WorkflowStepPhaseSucceeded,
+						NewPhase:    v1alpha1.WorkflowStepPhaseSucceeded,
+						OldDuration: time.Second,
+						NewDuration: 2 * time.Second,
+					},
+					{
+						Name:        "group",
+						OldPhase:    v1alpha1.WorkflowStepPhaseSucceeded,
+						NewPhase:    v1alpha1.WorkflowStepPhaseFailed,
+						OldDuration: time.Second,
+						NewDuration: time.Second,
+					},
+					{
+						Name:      "group.sub2",
+						OldPhase:  v1alpha1.WorkflowStepPhaseSucceeded,
+						NewPhase:  v1alpha1.WorkflowStepPhaseFailed,
+						NewReason: "Timeout",
+					},
+				},
+				AddedSteps:       []string{"added"},
+				RemovedSteps:     []string{"removed"},
+				NewlyFailedSteps: []string{"group", "group.sub2", "added"},
+			},
+		},
+		"nil run": {
+			b: &v1alpha1.WorkflowRun{Status: v1alpha1.WorkflowRunStatus{
+				Phase: v1alpha1.WorkflowStateExecuting,
+				Steps: []v1alpha1.WorkflowStepStatus{step("step1", v1alpha1.WorkflowStepPhaseRunning, "", time.Second)},
+			}},
+			expected: RunDiff{
+				NewPhase:   v1alpha1.WorkflowStateExecuting,
+				AddedSteps: []string{"step1"},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			diff := DiffRuns(tc.a, tc.b)
+			r.Equal(tc.expected, diff)
+			r.Equal(name == "same", diff.Empty())
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// ListRunsOptions is the options to list the workflow runs
+type ListRunsOptions struct {
+	// Namespace is the namespace of the runs, all the namespaces are listed if it's empty
+	Namespace string
+	// Phases filters the runs in any of the phases
+	Phases []v1alpha1.WorkflowRunPhase
+	// Workflow filters the runs that refer to the workflow
+	Workflow string
+	// CreatedAfter and CreatedBefore filter the runs by the creation time, the zero value means no limit
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Limit is the max number of the runs in a page, all the runs are listed if it's 0
+	Limit int64
+	// Continue is the token of the page returned by the previous call
+	Continue string
+}
+
+// ListRuns lists the workflow runs matching the options, it returns the runs of a page and the token of the next page.
+// The phase and workflow are filtered by the labels synced by the controller on the server side, while the creation
+// time is filtered after listing, the pages are filled up to the limit by listing more until there're no more runs.
+func ListRuns(ctx context.Context, cli client.Client, opts ListRunsOptions) (*v1alpha1.WorkflowRunList, string, error) {
+	selector := labels.NewSelector()
+	if len(opts.Phases) > 0 {
+		phases := make([]string, 0, len(opts.Phases))
+		for _, phase := range opts.Phases {
+			phases = append(phases, string(phase))
+		}
+		req, err := labels.NewRequirement(types.LabelWorkflowRunPhase, selection.In, phases)
+		if err != nil {
+			return nil, "", err
+		}
+		selector = selector.Add(*req)
+	}
+	if opts.Workflow != "" {
+		req, err := labels.NewRequirement(types.LabelWorkflowRunWorkflow, selection.Equals, []string{opts.Workflow})
+		if err != nil {
+			return nil, "", err
+		}
+		selector = selector.Add(*req)
+	}
+
+	result := &v1alpha1.WorkflowRunList{}
+	token := opts.Continue
+	for {
+		listOpts := &client.ListOptions{Namespace: opts.Namespace, LabelSelector: selector, Continue: token}
+		if opts.Limit > 0 {
+			listOpts.Limit = opts.Limit - int64(len(result.Items))
+		}
+		runs := &v1alpha1.WorkflowRunList{}
+		if err := cli.List(ctx, runs, listOpts); err != nil {
+			return nil, "", err
+		}
+		for _, run := range runs.Items {
+			created := run.CreationTimestamp.Time
+			if !opts.CreatedAfter.IsZero() && created.Before(opts.CreatedAfter) {
+				continue
+			}
+			if !opts.CreatedBefore.IsZero() && !created.Before(opts.CreatedBefore) {
+				continue
+			}
+			result.Items = append(result.Items, run)
+		}
+		result.ListMeta = runs.ListMeta
+		token = runs.Continue
+		if token == "" || (opts.Limit > 0 && int64(len(result.Items)) >= opts.Limit) {
+			return result, token, nil
+		}
+	}
+}
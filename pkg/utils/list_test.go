@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// pagingClient pages the listed runs by the limit and the continue token, which are ignored by the fake client
+type pagingClient struct {
+	client.Client
+}
+
+func (c *pagingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	runs := list.(*v1alpha1.WorkflowRunList)
+	start := 0
+	if listOpts.Continue != "" {
+		start, _ = strconv.Atoi(listOpts.Continue)
+	}
+	end := len(runs.Items)
+	if listOpts.Limit > 0 && start+int(listOpts.Limit) < end {
+		end = start + int(listOpts.Limit)
+		runs.Continue = strconv.Itoa(end)
+	}
+	runs.Items = runs.Items[start:end]
+	return nil
+}
+
+func TestListRuns(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	var created []*v1alpha1.WorkflowRun
+	defer func() {
+		for _, run := range created {
+			_ = cli.Delete(ctx, run)
+		}
+	}()
+	newRun := func(name, workflow string, phase v1alpha1.WorkflowRunPhase, creationTime time.Time) {
+		run := &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "list-runs",
+				CreationTimestamp: metav1.NewTime(creationTime),
+				Labels: map[string]string{
+					types.LabelWorkflowRunPhase:    string(phase),
+					types.LabelWorkflowRunWorkflow: workflow,
+				},
+			},
+		}
+		r.NoError(cli.Create(ctx, run))
+		created = append(created, run)
+	}
+	newRun("run-1", "deploy", v1alpha1.WorkflowStateSucceeded, now.Add(-3*time.Hour))
+	newRun("run-2", "deploy", v1alpha1.WorkflowStateFailed, now.Add(-2*time.Hour))
+	newRun("run-3", "deploy", v1alpha1.WorkflowStateSucceeded, now.Add(-time.Hour))
+	newRun("run-4", "test", v1alpha1.WorkflowStateSucceeded, now.Add(-time.Hour))
+	newRun("run-5", "deploy", v1alpha1.WorkflowStateExecuting, now)
+	pagingCli := &pagingClient{Client: cli}
+
+	names := func(runs *v1alpha1.WorkflowRunList) []string {
+		var names []string
+		for _, run := range runs.Items {
+			names = append(names, run.Name)
+		}
+		return names
+	}
+
+	runs, token, err := ListRuns(ctx, pagingCli, ListRunsOptions{Namespace: "list-runs", Workflow: "deploy"})
+	r.NoError(err)
+	r.Equal("", token)
+	r.Equal([]string{"run-1", "run-2", "run-3", "run-5"}, names(runs))
+
+	runs, _, err = ListRuns(ctx, pagingCli, ListRunsOptions{
+		Namespace: "list-runs",
+		Phases:    []v1alpha1.WorkflowRunPhase{v1alpha1.WorkflowStateSucceeded, v1alpha1.WorkflowStateFailed},
+	})
+	r.NoError(err)
+	r.Equal([]string{"run-1", "run-2", "run-3", "run-4"}, names(runs))
+
+	list := func(opts ListRunsOptions) ([]string, string) {
+		runs, token, err := ListRuns(ctx, pagingCli, opts)
+		r.NoError(err)
+		return names(runs), token
+	}
+	opts := ListRunsOptions{Namespace: "list-runs", CreatedAfter: now.Add(-150 * time.Minute), CreatedBefore: now.Add(-30 * time.Minute), Limit: 2}
+	page, token := list(opts)
+	r.Equal([]string{"run-2", "run-3"}, page)
+	r.NotEmpty(token)
+	opts.Continue = token
+	page, token = list(opts)
+	r.Equal([]string{"run-4"}, page)
+	r.Equal("", token)
+}
@@ -18,9 +18,11 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/ast"
@@ -29,7 +31,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/kubevela/workflow/api/v1alpha1"
@@ -290,6 +294,32 @@ func (wo workflowRunOperator) Terminate(ctx context.Context) error {
 	return writeOutputF(wo.outputWriter, "Successfully terminate workflow: %s\n", run.Name)
 }
 
+// TerminateWorkflowBy terminates the workflow and records the termination in the audit sink with the actor that
+// terminates it, the failure of the sink doesn't fail the termination
+func TerminateWorkflowBy(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, sink wfTypes.AuditSink, actor, message string) error {
+	if err := TerminateWorkflow(ctx, cli, run); err != nil {
+		return err
+	}
+	if sink == nil {
+		return nil
+	}
+	if actor == "" {
+		actor = wfTypes.AuditActorController
+	}
+	entry := wfTypes.AuditEntry{
+		Timestamp: time.Now(),
+		Actor:     actor,
+		Action:    wfTypes.AuditActionTerminate,
+		Target:    wfTypes.AuditTarget{Namespace: run.Namespace, Name: run.Name, UID: run.UID},
+		Outcome:   string(v1alpha1.WorkflowStateTerminated),
+		Message:   message,
+	}
+	if err := sink.Record(ctx, entry); err != nil {
+		klog.ErrorS(err, "record audit entry", "action", entry.Action, "workflowrun", klog.KObj(run))
+	}
+	return nil
+}
+
 // TerminateWorkflow terminate workflow
 func TerminateWorkflow(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun) error {
 	// set the workflow terminated to true
@@ -300,22 +330,26 @@ func TerminateWorkflow(ctx context.Context, cli client.Client, run *v1alpha1.Wor
 	for i, step := range steps {
 		switch step.Phase {
 		case v1alpha1.WorkflowStepPhaseFailed:
-			if step.Reason != wfTypes.StatusReasonFailedAfterRetries && step.Reason != wfTypes.StatusReasonTimeout {
+			if step.Reason != wfTypes.StatusReasonFailedAfterRetries && step.Reason != wfTypes.StatusReasonTimeout && step.Reason != wfTypes.StatusReasonPreconditionFailed {
 				steps[i].Reason = wfTypes.StatusReasonTerminate
 			}
 		case v1alpha1.WorkflowStepPhaseRunning, v1alpha1.WorkflowStepPhaseSuspending:
 			steps[i].Phase = v1alpha1.WorkflowStepPhaseFailed
+			steps[i].SubPhase = ""
+			steps[i].ContinuationToken = ""
 			steps[i].Reason = wfTypes.StatusReasonTerminate
 		default:
 		}
 		for j, sub := range step.SubStepsStatus {
 			switch sub.Phase {
 			case v1alpha1.WorkflowStepPhaseFailed:
-				if sub.Reason != wfTypes.StatusReasonFailedAfterRetries && sub.Reason != wfTypes.StatusReasonTimeout {
+				if sub.Reason != wfTypes.StatusReasonFailedAfterRetries && sub.Reason != wfTypes.StatusReasonTimeout && sub.Reason != wfTypes.StatusReasonPreconditionFailed {
 					steps[i].SubStepsStatus[j].Reason = wfTypes.StatusReasonTerminate
 				}
 			case v1alpha1.WorkflowStepPhaseRunning, v1alpha1.WorkflowStepPhaseSuspending:
 				steps[i].SubStepsStatus[j].Phase = v1alpha1.WorkflowStepPhaseFailed
+				steps[i].SubStepsStatus[j].SubPhase = ""
+				steps[i].SubStepsStatus[j].ContinuationToken = ""
 				steps[i].SubStepsStatus[j].Reason = wfTypes.StatusReasonTerminate
 			default:
 			}
@@ -338,17 +372,14 @@ func RestartFromStep(ctx context.Context, cli client.Client, run *v1alpha1.Workf
 	if !run.Status.EndTime.IsZero() {
 		run.Status.EndTime = metav1.Time{}
 	}
+	run.Status.Duration = nil
+	// the restarted steps are retried with a new budget
+	run.Status.Retries = 0
 	mode := run.Status.Mode
 
-	var steps []v1alpha1.WorkflowStep
-	if run.Spec.WorkflowSpec != nil {
-		steps = run.Spec.WorkflowSpec.Steps
-	} else {
-		workflow := &v1alpha1.Workflow{}
-		if err := cli.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: run.Spec.WorkflowRef}, workflow); err != nil {
-			return err
-		}
-		steps = workflow.Steps
+	steps, err := getWorkflowSteps(ctx, cli, run)
+	if err != nil {
+		return err
 	}
 
 	cm := &corev1.ConfigMap{}
@@ -367,9 +398,12 @@ func RestartFromStep(ctx context.Context, cli client.Client, run *v1alpha1.Workf
 	}); err != nil {
 		return err
 	}
-	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+	if err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
 		return cli.Update(ctx, cm)
-	})
+	}); err != nil {
+		return err
+	}
+	return wfContext.PruneSpilledVars(ctx, cli, cm)
 }
 
 // CleanStatusFromStep cleans status and context data from a specified step
@@ -417,6 +451,187 @@ func CleanStatusFromStep(steps []v1alpha1.WorkflowStep, stepStatus []v1alpha1.Wo
 	return stepStatus, contextCM, nil
 }
 
+// SelectSteps returns the names of the steps and sub-steps whose labels match the selector
+func SelectSteps(steps []v1alpha1.WorkflowStep, selector labels.Selector) []string {
+	names := make([]string, 0)
+	for _, step := range steps {
+		if selector.Matches(labels.Set(step.Labels)) {
+			names = append(names, step.Name)
+		}
+		for _, sub := range step.SubSteps {
+			if selector.Matches(labels.Set(sub.Labels)) {
+				names = append(names, sub.Name)
+			}
+		}
+	}
+	return names
+}
+
+// ResumeStepsBySelector resume the suspending steps that match the label selector
+func ResumeStepsBySelector(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, selector labels.Selector) error {
+	names, err := selectWorkflowSteps(ctx, cli, run, selector)
+	if err != nil {
+		return err
+	}
+	run.Status.Suspend = false
+	steps := run.Status.Steps
+	for i, step := range steps {
+		if step.Phase == v1alpha1.WorkflowStepPhaseSuspending && stringsContain(names, step.Name) {
+			OperateSteps(steps, i, -1, v1alpha1.WorkflowStepPhaseRunning)
+		}
+		for j, sub := range step.SubStepsStatus {
+			if sub.Phase == v1alpha1.WorkflowStepPhaseSuspending && stringsContain(names, sub.Name) {
+				OperateSteps(steps, i, j, v1alpha1.WorkflowStepPhaseRunning)
+			}
+		}
+	}
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		return cli.Status().Patch(ctx, run, client.Merge)
+	})
+}
+
+// SkipStepsBySelector skip the steps that match the label selector, the steps that are already finished will not be affected.
+// The selector is added to the skip step selectors of the run, so the steps skipped by the previous selectors are still skipped.
+func SkipStepsBySelector(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, selector labels.Selector) error {
+	if _, err := selectWorkflowSteps(ctx, cli, run, selector); err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if err := cli.Get(ctx, client.ObjectKeyFromObject(run), run); err != nil {
+			return err
+		}
+		if run.Annotations == nil {
+			run.Annotations = make(map[string]string)
+		}
+		selectors := []string{selector.String()}
+		if existing := run.Annotations[wfTypes.AnnotationSkipStepSelector]; existing != "" {
+			selectors = strings.Split(existing, wfTypes.SkipStepSelectorSeparator)
+			if stringsContain(selectors, selector.String()) {
+				return nil
+			}
+			selectors = append(selectors, selector.String())
+		}
+		run.Annotations[wfTypes.AnnotationSkipStepSelector] = strings.Join(selectors, wfTypes.SkipStepSelectorSeparator)
+		return cli.Update(ctx, run)
+	})
+}
+
+// RestartStepsBySelector restart the steps that match the label selector, the status and outputs of the steps will be cleaned
+func RestartStepsBySelector(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, selector labels.Selector) error {
+	steps, err := getWorkflowSteps(ctx, cli, run)
+	if err != nil {
+		return err
+	}
+	names := SelectSteps(steps, selector)
+	if len(names) == 0 {
+		return fmt.Errorf("can not find steps matching selector %s", selector.String())
+	}
+	run.Status.Terminated = false
+	run.Status.Suspend = false
+	run.Status.Finished = false
+	if !run.Status.EndTime.IsZero() {
+		run.Status.EndTime = metav1.Time{}
+	}
+	run.Status.Duration = nil
+	// the restarted steps are retried with a new budget
+	run.Status.Retries = 0
+
+	var cm *corev1.ConfigMap
+	if run.Status.ContextBackend != nil {
+		cm = &corev1.ConfigMap{}
+		if err := cli.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: run.Status.ContextBackend.Name}, cm); err != nil {
+			return err
+		}
+	}
+	stepStatus, cm, err := CleanStatusOfSteps(steps, run.Status.Steps, cm, names)
+	if err != nil {
+		return err
+	}
+	run.Status.Steps = stepStatus
+	if err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		return cli.Status().Update(ctx, run)
+	}); err != nil {
+		return err
+	}
+	if cm == nil {
+		return nil
+	}
+	if err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		return cli.Update(ctx, cm)
+	}); err != nil {
+		return err
+	}
+	return wfContext.PruneSpilledVars(ctx, cli, cm)
+}
+
+// CleanStatusOfSteps cleans status and context data of the specified steps, the step groups of the cleaned sub-steps will be set to running
+func CleanStatusOfSteps(steps []v1alpha1.WorkflowStep, stepStatus []v1alpha1.WorkflowStepStatus, contextCM *corev1.ConfigMap, names []string) ([]v1alpha1.WorkflowStepStatus, *corev1.ConfigMap, error) {
+	status := make([]v1alpha1.WorkflowStepStatus, 0)
+	for _, step := range stepStatus {
+		if stringsContain(names, step.Name) {
+			continue
+		}
+		subStatus := deleteSubStepStatus(names, step.SubStepsStatus, "")
+		if len(subStatus) != len(step.SubStepsStatus) {
+			step.SubStepsStatus = subStatus
+			step.Phase = v1alpha1.WorkflowStepPhaseRunning
+			step.Reason = ""
+		}
+		status = append(status, step)
+	}
+	if contextCM != nil && contextCM.Data != nil {
+		v := cuecontext.New().CompileString(contextCM.Data[wfContext.ConfigMapKeyVars])
+		s, err := clearContextVars(steps, v, "", names)
+		if err != nil {
+			return nil, nil, err
+		}
+		contextCM.Data[wfContext.ConfigMapKeyVars] = s
+	}
+	return status, contextCM, nil
+}
+
+// getWorkflowSteps returns the steps of the run rendered by the context of the run, so that the steps are found by
+// the rendered names in the status
+func getWorkflowSteps(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun) ([]v1alpha1.WorkflowStep, error) {
+	var steps []v1alpha1.WorkflowStep
+	if run.Spec.WorkflowSpec != nil {
+		steps = run.Spec.WorkflowSpec.Steps
+	} else {
+		workflow := &v1alpha1.Workflow{}
+		if err := cli.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: run.Spec.WorkflowRef}, workflow); err != nil {
+			return nil, err
+		}
+		steps = workflow.Steps
+	}
+	if !hasTemplatedSteps(steps) {
+		return steps, nil
+	}
+	// the context is frozen in the status once the parameters of the workflow are applied
+	raw := run.Spec.Context
+	if run.Status.Context != nil {
+		raw = run.Status.Context
+	}
+	runContext := make(map[string]interface{})
+	if raw != nil && len(raw.Raw) > 0 {
+		if err := json.Unmarshal(raw.Raw, &runContext); err != nil {
+			return nil, fmt.Errorf("failed to parse the context: %w", err)
+		}
+	}
+	return RenderSteps(run.Name, run.Namespace, runContext, steps, nil)
+}
+
+func selectWorkflowSteps(ctx context.Context, cli client.Client, run *v1alpha1.WorkflowRun, selector labels.Selector) ([]string, error) {
+	steps, err := getWorkflowSteps(ctx, cli, run)
+	if err != nil {
+		return nil, err
+	}
+	names := SelectSteps(steps, selector)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("can not find steps matching selector %s", selector.String())
+	}
+	return names, nil
+}
+
 // nolint:staticcheck
 func clearContextVars(steps []v1alpha1.WorkflowStep, v cue.Value, stepName string, dependency []string) (string, error) {
 	outputs := make([]string, 0)
@@ -516,12 +731,12 @@ func getStepDependency(steps []v1alpha1.WorkflowStep, stepName string, dag bool)
 		for _, output := range step.Outputs {
 			stepOutputs[output.Name] = step.Name
 		}
-		dependsOn[step.Name] = step.DependsOn
+		dependsOn[step.Name] = mergeUniqueStringSlice(append([]string{}, step.DependsOn...), step.DependsOnCondition.StepNames())
 		for _, sub := range step.SubSteps {
 			for _, output := range sub.Outputs {
 				stepOutputs[output.Name] = sub.Name
 			}
-			dependsOn[sub.Name] = sub.DependsOn
+			dependsOn[sub.Name] = mergeUniqueStringSlice(append([]string{}, sub.DependsOn...), sub.DependsOnCondition.StepNames())
 		}
 	}
 	for _, step := range steps {
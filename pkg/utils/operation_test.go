@@ -25,6 +25,7 @@ import (
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/kubevela/workflow/api/v1alpha1"
@@ -421,6 +422,42 @@ func TestTerminateWorkflowRun(t *testing.T) {
 	}
 }
 
+type fakeAuditSink struct {
+	entries []wfTypes.AuditEntry
+}
+
+func (s *fakeAuditSink) Record(_ context.Context, entry wfTypes.AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func TestTerminateWorkflowBy(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	run := &v1alpha1.WorkflowRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "terminate-by", Namespace: "default"},
+		Status:     v1alpha1.WorkflowRunStatus{Suspend: true},
+	}
+	r.NoError(cli.Create(ctx, run))
+	defer func() {
+		r.NoError(cli.Delete(ctx, run))
+	}()
+	sink := &fakeAuditSink{}
+	r.NoError(TerminateWorkflowBy(ctx, cli, run, sink, "watcher/error-rate", "the error rate is too high"))
+	updated := &v1alpha1.WorkflowRun{}
+	r.NoError(cli.Get(ctx, client.ObjectKeyFromObject(run), updated))
+	r.True(updated.Status.Terminated)
+	r.Len(sink.entries, 1)
+	r.Equal("watcher/error-rate", sink.entries[0].Actor)
+	r.Equal(wfTypes.AuditActionTerminate, sink.entries[0].Action)
+	r.Equal(wfTypes.AuditTarget{Namespace: "default", Name: "terminate-by"}, sink.entries[0].Target)
+	r.Equal(string(v1alpha1.WorkflowStateTerminated), sink.entries[0].Outcome)
+	r.Equal("the error rate is too high", sink.entries[0].Message)
+
+	// the run is terminated without the sink as well
+	r.NoError(TerminateWorkflowBy(ctx, cli, run, nil, "", ""))
+}
+
 func TestResumeWorkflowRun(t *testing.T) {
 	ctx := context.Background()
 
@@ -631,6 +668,138 @@ func TestResumeWorkflowRun(t *testing.T) {
 	}
 }
 
+func TestOperateStepsBySelector(t *testing.T) {
+	ctx := context.Background()
+	r := require.New(t)
+	newRun := func(name string) *v1alpha1.WorkflowRun {
+		return &v1alpha1.WorkflowRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: v1alpha1.WorkflowRunSpec{
+				WorkflowSpec: &v1alpha1.WorkflowSpec{
+					Steps: []v1alpha1.WorkflowStep{
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name:   "infra",
+								Type:   "suspend",
+								Labels: map[string]string{"tier": "infra"},
+							},
+						},
+						{
+							WorkflowStepBase: v1alpha1.WorkflowStepBase{
+								Name: "group",
+								Type: "step-group",
+							},
+							SubSteps: []v1alpha1.WorkflowStepBase{
+								{
+									Name:   "app",
+									Type:   "suspend",
+									Labels: map[string]string{"tier": "app"},
+								},
+								{
+									Name: "other",
+									Type: "suspend",
+								},
+							},
+						},
+					},
+				},
+			},
+			Status: v1alpha1.WorkflowRunStatus{
+				Suspend: true,
+				Steps: []v1alpha1.WorkflowStepStatus{
+					{
+						StepStatus: v1alpha1.StepStatus{
+							Name:  "infra",
+							Phase: v1alpha1.WorkflowStepPhaseSuspending,
+						},
+					},
+					{
+						StepStatus: v1alpha1.StepStatus{
+							Name:  "group",
+							Phase: v1alpha1.WorkflowStepPhaseSuspending,
+						},
+						SubStepsStatus: []v1alpha1.StepStatus{
+							{
+								Name:  "app",
+								Phase: v1alpha1.WorkflowStepPhaseSuspending,
+							},
+							{
+								Name:  "other",
+								Phase: v1alpha1.WorkflowStepPhaseSucceeded,
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	selector, err := labels.Parse("tier=app")
+	r.NoError(err)
+	r.Equal([]string{"app"}, SelectSteps(newRun("select").Spec.WorkflowSpec.Steps, selector))
+	notFound, err := labels.Parse("tier=not-found")
+	r.NoError(err)
+
+	resumeRun := newRun("resume-by-selector")
+	r.NoError(cli.Create(ctx, resumeRun))
+	defer func() {
+		r.NoError(cli.Delete(ctx, resumeRun))
+	}()
+	r.Equal("can not find steps matching selector tier=not-found", ResumeStepsBySelector(ctx, cli, resumeRun, notFound).Error())
+	r.NoError(ResumeStepsBySelector(ctx, cli, resumeRun, selector))
+	checkRun := &v1alpha1.WorkflowRun{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Name: resumeRun.Name}, checkRun))
+	r.False(checkRun.Status.Suspend)
+	r.Equal(v1alpha1.WorkflowStepPhaseSuspending, checkRun.Status.Steps[0].Phase)
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, checkRun.Status.Steps[1].SubStepsStatus[0].Phase)
+
+	skipRun := newRun("skip-by-selector")
+	r.NoError(cli.Create(ctx, skipRun))
+	defer func() {
+		r.NoError(cli.Delete(ctx, skipRun))
+	}()
+	r.NoError(SkipStepsBySelector(ctx, cli, skipRun, selector))
+	checkRun = &v1alpha1.WorkflowRun{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Name: skipRun.Name}, checkRun))
+	r.Equal("tier=app", checkRun.Annotations[wfTypes.AnnotationSkipStepSelector])
+
+	infra, err := labels.Parse("tier=infra")
+	r.NoError(err)
+	r.NoError(SkipStepsBySelector(ctx, cli, skipRun, infra))
+	r.NoError(SkipStepsBySelector(ctx, cli, skipRun, selector))
+	checkRun = &v1alpha1.WorkflowRun{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Name: skipRun.Name}, checkRun))
+	r.Equal("tier=app;tier=infra", checkRun.Annotations[wfTypes.AnnotationSkipStepSelector])
+
+	run := newRun("restart-by-selector")
+	run.Status.Finished = true
+	run.Status.ContextBackend = &corev1.ObjectReference{Name: "restart-by-selector-context"}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "restart-by-selector-context"},
+		Data:       map[string]string{"vars": ""},
+	}
+	r.NoError(cli.Create(ctx, run))
+	r.NoError(cli.Create(ctx, cm))
+	defer func() {
+		r.NoError(cli.Delete(ctx, run))
+		r.NoError(cli.Delete(ctx, cm))
+	}()
+	r.NoError(RestartStepsBySelector(ctx, cli, run, infra))
+	checkRun = &v1alpha1.WorkflowRun{}
+	r.NoError(cli.Get(ctx, client.ObjectKey{Name: run.Name}, checkRun))
+	r.False(checkRun.Status.Finished)
+	r.Equal(1, len(checkRun.Status.Steps))
+	r.Equal("group", checkRun.Status.Steps[0].Name)
+
+	stepStatus, _, err := CleanStatusOfSteps(run.Spec.WorkflowSpec.Steps, newRun("clean").Status.Steps, nil, []string{"app"})
+	r.NoError(err)
+	r.Equal(2, len(stepStatus))
+	r.Equal(v1alpha1.WorkflowStepPhaseRunning, stepStatus[1].Phase)
+	r.Equal(1, len(stepStatus[1].SubStepsStatus))
+	r.Equal("other", stepStatus[1].SubStepsStatus[0].Name)
+}
+
 func TestRollbackWorkflowRun(t *testing.T) {
 	r := require.New(t)
 	operator := NewWorkflowRunOperator(cli, nil, nil)
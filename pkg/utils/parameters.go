@@ -0,0 +1,211 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"unicode/utf8"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+// ApplyParameters applies the defaults of the omitted workflow parameters to the context of the run and validates
+// the parameters in the context, the errors are reported with the paths of the parameters under the path of the
+// context. The parameters with conditions are applied after the others in order, so that their conditions can
+// depend on the defaults of the others.
+func ApplyParameters(params []v1alpha1.WorkflowParameter, values map[string]interface{}, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	var conditional []v1alpha1.WorkflowParameter
+	for _, param := range params {
+		if param.If != "" {
+			conditional = append(conditional, param)
+			continue
+		}
+		errs = append(errs, applyParameter(param, values, path.Child(param.Name))...)
+	}
+	for _, param := range conditional {
+		enabled, err := evalParameterCondition(param.If, values)
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Child(param.Name), param.If, fmt.Sprintf("failed to evaluate the condition of the parameter: %v", err)))
+			continue
+		}
+		if enabled {
+			errs = append(errs, applyParameter(param, values, path.Child(param.Name))...)
+		}
+	}
+	return errs
+}
+
+// ApplyRunParameters applies the parameters of the workflow to the context of the run, the defaults are set in the
+// context of the run, and the invalid parameters are returned as the errors of the fields
+func ApplyRunParameters(run *v1alpha1.WorkflowRun, params []v1alpha1.WorkflowParameter) (field.ErrorList, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	values := make(map[string]interface{})
+	if run.Spec.Context != nil && len(run.Spec.Context.Raw) > 0 {
+		if err := json.Unmarshal(run.Spec.Context.Raw, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse the context: %w", err)
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+	}
+	errs := ApplyParameters(params, values, field.NewPath("spec", "context"))
+	if len(values) == 0 {
+		return errs, nil
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	run.Spec.Context = &runtime.RawExtension{Raw: raw}
+	return errs, nil
+}
+
+// evalParameterCondition evaluates the condition of the parameter with the context, the condition referencing an
+// omitted parameter is false
+func evalParameterCondition(expr string, values map[string]interface{}) (bool, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return false, err
+	}
+	v := cuecontext.New().CompileString(fmt.Sprintf("context: %s\ncondition: %s", b, expr))
+	if v.Err() != nil {
+		return false, v.Err()
+	}
+	condition := v.LookupPath(cue.ParsePath("condition"))
+	enabled, err := condition.Bool()
+	if err != nil {
+		if !condition.IsConcrete() {
+			return false, nil
+		}
+		return false, err
+	}
+	return enabled, nil
+}
+
+func applyParameter(param v1alpha1.WorkflowParameter, values map[string]interface{}, path *field.Path) field.ErrorList {
+	value, ok := values[param.Name]
+	if !ok || value == nil {
+		switch {
+		case param.Default != nil:
+			if err := json.Unmarshal(param.Default.Raw, &value); err != nil {
+				return field.ErrorList{field.Invalid(path, string(param.Default.Raw), fmt.Sprintf("invalid default of the parameter: %v", err))}
+			}
+			// the default is validated as well, so that the invalid default of the workflow is caught
+			values[param.Name] = value
+		case param.Required:
+			return field.ErrorList{field.Required(path, fmt.Sprintf("parameter %s is required", param.Name))}
+		default:
+			return nil
+		}
+	}
+	return validateParameter(param, value, path)
+}
+
+func validateParameter(param v1alpha1.WorkflowParameter, value interface{}, path *field.Path) field.ErrorList {
+	if !isParameterType(param.Type, value) {
+		return field.ErrorList{field.TypeInvalid(path, value, fmt.Sprintf("must be of type %s", param.Type))}
+	}
+	var errs field.ErrorList
+	if len(param.Enum) > 0 {
+		var allowed []string
+		matched := false
+		for _, raw := range param.Enum {
+			var v interface{}
+			if err := json.Unmarshal(raw.Raw, &v); err != nil {
+				allowed = append(allowed, string(raw.Raw))
+				continue
+			}
+			if reflect.DeepEqual(v, value) {
+				matched = true
+				break
+			}
+			allowed = append(allowed, fmt.Sprint(v))
+		}
+		if !matched {
+			errs = append(errs, field.NotSupported(path, value, allowed))
+		}
+	}
+	if s, ok := value.(string); ok && param.Pattern != "" {
+		re, err := regexp.Compile(param.Pattern)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(path, param.Pattern, fmt.Sprintf("invalid pattern of the parameter: %v", err)))
+		case !re.MatchString(s):
+			errs = append(errs, field.Invalid(path, value, fmt.Sprintf("must match the pattern %s", param.Pattern)))
+		}
+	}
+	if param.Minimum == nil && param.Maximum == nil {
+		return errs
+	}
+	var size float64
+	subject := "the value"
+	switch v := value.(type) {
+	case float64:
+		size = v
+	case string:
+		size, subject = float64(utf8.RuneCountInString(v)), "the length"
+	case []interface{}:
+		size, subject = float64(len(v)), "the length"
+	default:
+		return errs
+	}
+	if param.Minimum != nil && size < float64(*param.Minimum) {
+		errs = append(errs, field.Invalid(path, value, fmt.Sprintf("%s must be greater than or equal to %d", subject, *param.Minimum)))
+	}
+	if param.Maximum != nil && size > float64(*param.Maximum) {
+		errs = append(errs, field.Invalid(path, value, fmt.Sprintf("%s must be less than or equal to %d", subject, *param.Maximum)))
+	}
+	return errs
+}
+
+// isParameterType checks the type of the value decoded from JSON, the value of any type matches the empty type
+func isParameterType(typ v1alpha1.ParameterType, value interface{}) bool {
+	switch typ {
+	case v1alpha1.ParameterTypeString:
+		_, ok := value.(string)
+		return ok
+	case v1alpha1.ParameterTypeNumber:
+		_, ok := value.(float64)
+		return ok
+	case v1alpha1.ParameterTypeInteger:
+		v, ok := value.(float64)
+		return ok && v == math.Trunc(v)
+	case v1alpha1.ParameterTypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case v1alpha1.ParameterTypeObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case v1alpha1.ParameterTypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	default:
+		return true
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func TestApplyRunParameters(t *testing.T) {
+	params := []v1alpha1.WorkflowParameter{
+		{Name: "env", Type: v1alpha1.ParameterTypeString, Required: true, Enum: []apiextensionsv1.JSON{{Raw: []byte(`"dev"`)}, {Raw: []byte(`"prod"`)}}},
+		{Name: "replicas", Type: v1alpha1.ParameterTypeInteger, Default: &apiextensionsv1.JSON{Raw: []byte(`1`)}, Minimum: pointer.Int64(1), Maximum: pointer.Int64(10)},
+		{Name: "image", Type: v1alpha1.ParameterTypeString, Pattern: `^[a-z0-9./-]+:[a-z0-9.-]+$`, Maximum: pointer.Int64(32)},
+		{Name: "regions", Type: v1alpha1.ParameterTypeArray, Minimum: pointer.Int64(1)},
+		{Name: "approver", Type: v1alpha1.ParameterTypeString, Required: true, If: `context.env == "prod"`},
+		{Name: "tls", Type: v1alpha1.ParameterTypeBoolean, Default: &apiextensionsv1.JSON{Raw: []byte(`true`)}, If: `context.replicas > 1`},
+		{Name: "cert", Type: v1alpha1.ParameterTypeString, Required: true, If: `context.tls`},
+	}
+	testCases := map[string]struct {
+		context string
+		errs    []string
+		applied string
+	}{
+		"defaults": {
+			context: `{"env":"dev","extra":"kept"}`,
+			applied: `{"env":"dev","extra":"kept","replicas":1}`,
+		},
+		"conditional": {
+			context: `{"env":"prod","replicas":3,"approver":"alice","cert":"tls-cert"}`,
+			applied: `{"env":"prod","replicas":3,"approver":"alice","tls":true,"cert":"tls-cert"}`,
+		},
+		"invalid": {
+			context: `{"env":"staging","replicas":0.5,"image":"nginx","regions":[]}`,
+			errs: []string{
+				`spec.context.env: Unsupported value: "staging": supported values: "dev", "prod"`,
+				`spec.context.replicas: Invalid value: 0.5: must be of type integer`,
+				`spec.context.image: Invalid value: "nginx": must match the pattern ^[a-z0-9./-]+:[a-z0-9.-]+$`,
+				`spec.context.regions: Invalid value: []interface {}{}: the length must be greater than or equal to 1`,
+			},
+		},
+		"required": {
+			context: `{"env":"prod","replicas":11,"tls":false}`,
+			errs: []string{
+				`spec.context.replicas: Invalid value: 11: the value must be less than or equal to 10`,
+				`spec.context.approver: Required value: parameter approver is required`,
+			},
+		},
+		"empty": {
+			errs: []string{`spec.context.env: Required value: parameter env is required`},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			run := &v1alpha1.WorkflowRun{}
+			if tc.context != "" {
+				run.Spec.Context = &runtime.RawExtension{Raw: []byte(tc.context)}
+			}
+			errs, err := ApplyRunParameters(run, params)
+			r.NoError(err)
+			var messages []string
+			for _, e := range errs {
+				messages = append(messages, e.Error())
+			}
+			r.Equal(tc.errs, messages)
+			if tc.applied != "" {
+				r.JSONEq(tc.applied, string(run.Spec.Context.Raw))
+			}
+		})
+	}
+
+	r := require.New(t)
+	// the invalid condition is reported with the parameter
+	errs, err := ApplyRunParameters(&v1alpha1.WorkflowRun{}, []v1alpha1.WorkflowParameter{{Name: "debug", If: `context.env ==`}})
+	r.NoError(err)
+	r.Len(errs, 1)
+	r.Contains(errs[0].Error(), "failed to evaluate the condition of the parameter")
+	// the context is not set if there's nothing to apply
+	run := &v1alpha1.WorkflowRun{}
+	errs, err = ApplyRunParameters(run, []v1alpha1.WorkflowParameter{{Name: "debug", Type: v1alpha1.ParameterTypeBoolean}})
+	r.NoError(err)
+	r.Empty(errs)
+	r.Nil(run.Spec.Context)
+}
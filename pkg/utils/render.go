@@ -0,0 +1,275 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/parser"
+	"github.com/pkg/errors"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/cue/model"
+)
+
+// templateMarker marks the step fields rendered by the cue string interpolation, e.g. `deploy-\(context.env)`
+const templateMarker = `\(`
+
+// renderedField is the field to evaluate the rendered string
+const renderedField = "rendered"
+
+// renderedNameRegexp is the format of the rendered step names
+var renderedNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?$`)
+
+// RenderSteps renders the name, type and dependsOn of the steps that use the cue string interpolation into a copy of
+// the steps, the context of the workflow run and the properties of the step can be referenced by `context` and
+// `parameter`. A dependsOn that is a single interpolation may resolve to a list of step names, e.g.
+// `\([for r in parameter.regions {"deploy-\(r)"}])`, and the rendered dependencies must be the names of the steps.
+// The rendered types are checked by checkType if it's not nil.
+func RenderSteps(name, namespace string, runContext map[string]interface{}, steps []v1alpha1.WorkflowStep, checkType func(typ string) error) ([]v1alpha1.WorkflowStep, error) {
+	if !hasTemplatedSteps(steps) {
+		return steps, nil
+	}
+	contextData := make(map[string]interface{})
+	for k, v := range runContext {
+		contextData[k] = v
+	}
+	contextData[model.ContextName] = name
+	contextData[model.ContextNamespace] = namespace
+	contextJSON, err := json.Marshal(contextData)
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal the context to render the steps")
+	}
+
+	rendered := make([]v1alpha1.WorkflowStep, len(steps))
+	names := make(map[string]struct{})
+	// renderedDeps are the rendered dependencies keyed by the rendered names of the steps
+	renderedDeps := make(map[string][]string)
+	for i := range steps {
+		step := steps[i].DeepCopy()
+		deps, err := renderStep(&step.WorkflowStepBase, string(contextJSON), checkType)
+		if err != nil {
+			return nil, err
+		}
+		renderedDeps[step.Name] = deps
+		for j := range step.SubSteps {
+			deps, err := renderStep(&step.SubSteps[j], string(contextJSON), checkType)
+			if err != nil {
+				return nil, err
+			}
+			renderedDeps[step.SubSteps[j].Name] = deps
+		}
+		for _, name := range append([]string{step.Name}, subStepNames(step)...) {
+			if _, ok := names[name]; ok {
+				return nil, fmt.Errorf("duplicated step name %s after rendering", name)
+			}
+			names[name] = struct{}{}
+		}
+		rendered[i] = *step
+	}
+	for name, deps := range renderedDeps {
+		for _, dep := range deps {
+			if _, ok := names[dep]; !ok {
+				return nil, fmt.Errorf("the rendered dependency %s of step %s is not a step", dep, name)
+			}
+		}
+	}
+	return rendered, nil
+}
+
+// renderStep renders the templated fields of the step, it returns the rendered dependencies of the step
+func renderStep(step *v1alpha1.WorkflowStepBase, contextJSON string, checkType func(typ string) error) ([]string, error) {
+	parameter := "{}"
+	if step.Properties != nil && len(step.Properties.Raw) > 0 {
+		parameter = string(step.Properties.Raw)
+	}
+	render := func(field, s string) (string, bool, error) {
+		if !strings.Contains(s, templateMarker) {
+			return s, false, nil
+		}
+		template := fmt.Sprintf("context: %s\nparameter: %s\n%s: %s", contextJSON, parameter, renderedField, quoteTemplate(s))
+		rendered, err := cuecontext.New().CompileString(template).LookupPath(cue.ParsePath(renderedField)).String()
+		if err != nil {
+			return "", false, errors.WithMessagef(err, "render the %s %q of step %s", field, s, step.Name)
+		}
+		return rendered, true, nil
+	}
+
+	name, renderedName, err := render("name", step.Name)
+	if err != nil {
+		return nil, err
+	}
+	if renderedName && !renderedNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid rendered name %q of step %s, the name must consist of alphanumeric characters, '-', '_' or '.'", name, step.Name)
+	}
+	typ, renderedType, err := render("type", step.Type)
+	if err != nil {
+		return nil, err
+	}
+	if renderedType && checkType != nil {
+		if err := checkType(typ); err != nil {
+			return nil, errors.WithMessagef(err, "unknown rendered type %q of step %s", typ, step.Name)
+		}
+	}
+	var deps, renderedDeps []string
+	for _, dep := range step.DependsOn {
+		if expr, ok := dependsOnExpression(dep); ok {
+			names, err := renderDependsOnList(expr, contextJSON, parameter)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "render the dependsOn %q of step %s", dep, step.Name)
+			}
+			deps = append(deps, names...)
+			renderedDeps = append(renderedDeps, names...)
+			continue
+		}
+		rendered, ok, err := render("dependsOn", dep)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, rendered)
+		if ok {
+			renderedDeps = append(renderedDeps, rendered)
+		}
+	}
+	step.Name, step.Type, step.DependsOn = name, typ, deps
+	return renderedDeps, nil
+}
+
+// quoteTemplate quotes the templated field as a cue string, the literal parts are escaped and the interpolations
+// are kept as they are, e.g. `a"b\c-\(context["env"])` is quoted as `"a\"b\\c-\(context["env"])"`
+func quoteTemplate(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	literal := func(s string) {
+		quoted := strconv.Quote(s)
+		b.WriteString(quoted[1 : len(quoted)-1])
+	}
+	for {
+		i := strings.Index(s, templateMarker)
+		if i < 0 {
+			literal(s)
+			break
+		}
+		literal(s[:i])
+		end := interpolationEnd(s, i+len(templateMarker))
+		if end < 0 {
+			// the unclosed interpolation is left to the cue compiler to report
+			b.WriteString(s[i:])
+			break
+		}
+		b.WriteString(s[i:end])
+		s = s[end:]
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// interpolationEnd returns the index after the parenthesis that closes the interpolation whose expression starts at
+// start, the parentheses in the string literals of the expression are skipped. It returns -1 if it's not closed.
+func interpolationEnd(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			// skip the string literal, the nested interpolations are balanced in it
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// dependsOnExpression returns the expression of the dependsOn that is a single interpolation, e.g.
+// `\(parameter.upstreams)`, which may resolve to a list of step names
+func dependsOnExpression(dep string) (string, bool) {
+	expr, ok := strings.CutPrefix(dep, templateMarker)
+	if !ok {
+		return "", false
+	}
+	if expr, ok = strings.CutSuffix(expr, ")"); !ok {
+		return "", false
+	}
+	// e.g. `\(context.env)-\(context.region)` is not a single interpolation
+	if _, err := parser.ParseExpr("", expr); err != nil {
+		return "", false
+	}
+	return expr, true
+}
+
+// renderDependsOnList evaluates the expression of the dependsOn to a step name or a list of step names
+func renderDependsOnList(expr, contextJSON, parameter string) ([]string, error) {
+	template := fmt.Sprintf("context: %s\nparameter: %s\n%s: %s", contextJSON, parameter, renderedField, expr)
+	v := cuecontext.New().CompileString(template).LookupPath(cue.ParsePath(renderedField))
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if name, err := v.String(); err == nil {
+		return []string{name}, nil
+	}
+	var names []string
+	if err := v.Decode(&names); err != nil {
+		return nil, errors.New("the dependsOn must be resolved to a step name or a list of step names")
+	}
+	return names, nil
+}
+
+// hasTemplatedSteps returns whether the name, type or dependsOn of any step uses the cue string interpolation
+func hasTemplatedSteps(steps []v1alpha1.WorkflowStep) bool {
+	isTemplated := func(step v1alpha1.WorkflowStepBase) bool {
+		for _, dep := range step.DependsOn {
+			if strings.Contains(dep, templateMarker) {
+				return true
+			}
+		}
+		return strings.Contains(step.Name, templateMarker) || strings.Contains(step.Type, templateMarker)
+	}
+	for _, step := range steps {
+		if isTemplated(step.WorkflowStepBase) {
+			return true
+		}
+		for _, sub := range step.SubSteps {
+			if isTemplated(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func subStepNames(step *v1alpha1.WorkflowStep) []string {
+	var names []string
+	for _, sub := range step.SubSteps {
+		names = append(names, sub.Name)
+	}
+	return names
+}
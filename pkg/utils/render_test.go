@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func TestRenderSteps(t *testing.T) {
+	r := require.New(t)
+	steps := []v1alpha1.WorkflowStep{
+		{
+			WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name: `deploy-\(context["env"])`,
+				Type: `\(parameter.kind)`,
+				// the literal parts are escaped, and the parentheses in the strings of the interpolation are skipped
+				DependsOn:  []string{`\(parameter.upstreams[")"])d`},
+				Properties: &runtime.RawExtension{Raw: []byte(`{"kind":"apply","upstreams":{")":"buil"}}`)},
+			},
+		},
+		{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "build", Type: "apply"}},
+	}
+	var checked []string
+	rendered, err := RenderSteps("run", "default", map[string]interface{}{"env": "prod"}, steps, func(typ string) error {
+		checked = append(checked, typ)
+		return nil
+	})
+	r.NoError(err)
+	r.Equal("deploy-prod", rendered[0].Name)
+	r.Equal("apply", rendered[0].Type)
+	r.Equal([]string{"build"}, rendered[0].DependsOn)
+	r.Equal([]string{"apply"}, checked)
+	r.Equal(`deploy-\(context["env"])`, steps[0].Name)
+	r.Equal(`\(parameter.kind)`, steps[0].Type)
+
+	_, err = RenderSteps("run", "default", map[string]interface{}{"env": "prod"}, steps, func(typ string) error {
+		return fmt.Errorf("%s not found", typ)
+	})
+	r.Error(err)
+	r.Contains(err.Error(), `unknown rendered type "apply"`)
+
+	for s, expected := range map[string]string{
+		`a"b\c-\(context.env)`:                  `"a\"b\\c-\(context.env)"`,
+		"line\n\\(context.env)":                 `"line\n\(context.env)"`,
+		`\([for e in x {"deploy-\(e)"}])-tail"`: `"\([for e in x {"deploy-\(e)"}])-tail\""`,
+		`unclosed-\(context.env`:                `"unclosed-\(context.env"`,
+	} {
+		r.Equal(expected, quoteTemplate(s))
+	}
+}
+
+func TestRestartFromRenderedStep(t *testing.T) {
+	r := require.New(t)
+	run := &v1alpha1.WorkflowRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "default"},
+		Spec: v1alpha1.WorkflowRunSpec{
+			Context: &runtime.RawExtension{Raw: []byte(`{"env":"dev"}`)},
+			WorkflowSpec: &v1alpha1.WorkflowSpec{
+				Steps: []v1alpha1.WorkflowStep{
+					{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+						Name:    `deploy-\(context.env)`,
+						Outputs: v1alpha1.StepOutputs{{Name: "endpoint"}},
+					}},
+					{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+						Name:      "notify",
+						DependsOn: []string{`deploy-\(context.env)`},
+					}},
+				},
+			},
+		},
+		Status: v1alpha1.WorkflowRunStatus{
+			// the context frozen in the status takes precedence over the spec
+			Context: &runtime.RawExtension{Raw: []byte(`{"env":"prod"}`)},
+			Mode:    v1alpha1.WorkflowExecuteMode{Steps: v1alpha1.WorkflowModeDAG},
+			Steps: []v1alpha1.WorkflowStepStatus{
+				{StepStatus: v1alpha1.StepStatus{Name: "deploy-prod", Phase: v1alpha1.WorkflowStepPhaseFailed}},
+				{StepStatus: v1alpha1.StepStatus{Name: "notify", Phase: v1alpha1.WorkflowStepPhaseSkipped}},
+			},
+		},
+	}
+	steps, err := getWorkflowSteps(context.Background(), nil, run)
+	r.NoError(err)
+	r.Equal("deploy-prod", steps[0].Name)
+	r.Equal([]string{"deploy-prod"}, steps[1].DependsOn)
+	r.Equal(`deploy-\(context.env)`, run.Spec.WorkflowSpec.Steps[0].Name)
+
+	cm := &corev1.ConfigMap{Data: map[string]string{"vars": `{"endpoint": "prod.example.com", "other": "kept"}`}}
+	status, cm, err := CleanStatusFromStep(steps, run.Status.Steps, run.Status.Mode, cm, "deploy-prod")
+	r.NoError(err)
+	r.Empty(status)
+	r.NotContains(cm.Data["vars"], "endpoint")
+	r.Contains(cm.Data["vars"], "kept")
+}
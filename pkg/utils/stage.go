@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// MaxStageRunNameLength is the max length of the name of the stage run, the name of the context backend of the run
+// is prefixed by "workflow-" and suffixed by "-context" and must be a DNS subdomain
+const MaxStageRunNameLength = validation.DNS1123SubdomainMaxLength - len("workflow--context")
+
+// StageRunName returns the name of the run of the stage
+func StageRunName(runName, stageName string) string {
+	return fmt.Sprintf("%s-%s", runName, stageName)
+}
+
+// ValidateStageRunName validates the name of the run of the stage, the errors are returned as the messages
+func ValidateStageRunName(name string) []string {
+	if len(name) > MaxStageRunNameLength {
+		return []string{fmt.Sprintf("the name of the stage run %s must be no more than %d characters", name, MaxStageRunNameLength)}
+	}
+	return validation.IsDNS1123Subdomain(name)
+}
+
+// LabelValue returns the value of the label for the name, the name longer than the limit of the label values is
+// truncated with the hash of it appended, so that the different names are still distinguished
+func LabelValue(name string) string {
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:])[:16]
+	return strings.TrimRight(name[:validation.LabelValueMaxLength-len(suffix)], "-_.") + suffix
+}
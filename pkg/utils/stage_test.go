@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestStageRunName(t *testing.T) {
+	r := require.New(t)
+	name := StageRunName("release", "build")
+	r.Equal("release-build", name)
+	r.Empty(ValidateStageRunName(name))
+	r.Equal([]string{"the name of the stage run " + strings.Repeat("a", 240) + "-build must be no more than 236 characters"},
+		ValidateStageRunName(StageRunName(strings.Repeat("a", 240), "build")))
+	r.NotEmpty(ValidateStageRunName(StageRunName("Release", "build")))
+}
+
+func TestLabelValue(t *testing.T) {
+	r := require.New(t)
+	r.Equal("release", LabelValue("release"))
+	long := strings.Repeat("a", 60) + "-b-" + strings.Repeat("c", 100)
+	value := LabelValue(long)
+	r.Len(value, validation.LabelValueMaxLength)
+	r.Empty(validation.IsValidLabelValue(value))
+	r.NotEqual(value, LabelValue(long+"d"))
+	r.Equal(value, LabelValue(long))
+}
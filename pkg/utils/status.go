@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+// ArchiveStepStatus keeps the full status of the finished steps and sub steps in the workflow context, so that the
+// status can be pruned from the run and hydrated on demand. Only the changed records are written.
+func ArchiveStepStatus(wfCtx wfContext.Context, status *v1alpha1.WorkflowRunStatus) error {
+	archive := func(ss v1alpha1.StepStatus) error {
+		if !types.IsStepFinish(ss.Phase, ss.Reason) || isPrunedStepStatus(ss) {
+			return nil
+		}
+		b, err := json.Marshal(ss)
+		if err != nil {
+			return errors.WithMessagef(err, "marshal the status of step %s", ss.Name)
+		}
+		if wfCtx.GetMutableValue(types.ContextPrefixStepStatus, ss.ID) != string(b) {
+			wfCtx.SetMutableValue(string(b), types.ContextPrefixStepStatus, ss.ID)
+		}
+		return nil
+	}
+	for _, step := range status.Steps {
+		if err := archive(step.StepStatus); err != nil {
+			return err
+		}
+		for _, sub := range step.SubStepsStatus {
+			if err := archive(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PruneStatus prunes the finished steps and sub steps in the status to their id, name, phase and reason. The step
+// group is pruned once it's finished, the full status is restored from the archive by HydrateStatus.
+func PruneStatus(status *v1alpha1.WorkflowRunStatus) {
+	prune := func(ss v1alpha1.StepStatus) v1alpha1.StepStatus {
+		if !types.IsStepFinish(ss.Phase, ss.Reason) {
+			return ss
+		}
+		return v1alpha1.StepStatus{ID: ss.ID, Name: ss.Name, Phase: ss.Phase, Reason: ss.Reason}
+	}
+	for i, step := range status.Steps {
+		if !types.IsStepFinish(step.Phase, step.Reason) {
+			continue
+		}
+		status.Steps[i].StepStatus = prune(step.StepStatus)
+		for j, sub := range step.SubStepsStatus {
+			status.Steps[i].SubStepsStatus[j] = prune(sub)
+		}
+	}
+}
+
+// HydrateStatus restores the full status of the pruned steps and sub steps of the run from the archive in its
+// workflow context. The steps that are not pruned or not archived are kept as is.
+func HydrateStatus(ctx context.Context, wr *v1alpha1.WorkflowRun) error {
+	if wr.Status.ContextBackend == nil || !hasPrunedStepStatus(wr.Status.Steps) {
+		return nil
+	}
+	wfCtx, err := wfContext.LoadContext(ctx, wr.Namespace, wr.Name, wr.Status.ContextBackend.Name)
+	if err != nil {
+		return errors.WithMessage(err, "load context")
+	}
+	hydrate := func(ss *v1alpha1.StepStatus) error {
+		if !isPrunedStepStatus(*ss) {
+			return nil
+		}
+		data := wfCtx.GetMutableValue(types.ContextPrefixStepStatus, ss.ID)
+		if data == "" {
+			return nil
+		}
+		archived := v1alpha1.StepStatus{}
+		if err := json.Unmarshal([]byte(data), &archived); err != nil {
+			return errors.WithMessagef(err, "unmarshal the archived status of step %s", ss.Name)
+		}
+		// the archived status is stale if the step is finished again with another result
+		if archived.ID == ss.ID && archived.Phase == ss.Phase && archived.Reason == ss.Reason {
+			*ss = archived
+		}
+		return nil
+	}
+	for i := range wr.Status.Steps {
+		step := &wr.Status.Steps[i]
+		if err := hydrate(&step.StepStatus); err != nil {
+			return err
+		}
+		for j := range step.SubStepsStatus {
+			if err := hydrate(&step.SubStepsStatus[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasPrunedStepStatus(steps []v1alpha1.WorkflowStepStatus) bool {
+	for _, step := range steps {
+		if isPrunedStepStatus(step.StepStatus) {
+			return true
+		}
+		for _, sub := range step.SubStepsStatus {
+			if isPrunedStepStatus(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPrunedStepStatus checks if the finished step only has the fields kept by the pruning
+func isPrunedStepStatus(ss v1alpha1.StepStatus) bool {
+	return types.IsStepFinish(ss.Phase, ss.Reason) && reflect.DeepEqual(ss, v1alpha1.StepStatus{ID: ss.ID, Name: ss.Name, Phase: ss.Phase, Reason: ss.Reason})
+}
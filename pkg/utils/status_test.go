@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	wfContext "github.com/kubevela/workflow/pkg/context"
+	"github.com/kubevela/workflow/pkg/types"
+)
+
+func TestPruneAndHydrateStatus(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	finished := func(id, name string, phase v1alpha1.WorkflowStepPhase, reason string) v1alpha1.StepStatus {
+		return v1alpha1.StepStatus{
+			ID:               id,
+			Name:             name,
+			Type:             "apply",
+			Phase:            phase,
+			Reason:           reason,
+			Message:          "the message of " + name,
+			FirstExecuteTime: now,
+			LastExecuteTime:  now,
+		}
+	}
+	running := v1alpha1.StepStatus{ID: "s3", Name: "step3", Type: "suspend", Phase: v1alpha1.WorkflowStepPhaseRunning, Message: "waiting", FirstExecuteTime: now}
+	wr := &v1alpha1.WorkflowRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "prune-run", Namespace: "default"},
+		Status: v1alpha1.WorkflowRunStatus{
+			Steps: []v1alpha1.WorkflowStepStatus{
+				{StepStatus: finished("s1", "step1", v1alpha1.WorkflowStepPhaseSucceeded, "")},
+				{
+					StepStatus: finished("s2", "group", v1alpha1.WorkflowStepPhaseFailed, types.StatusReasonFailedAfterRetries),
+					SubStepsStatus: []v1alpha1.StepStatus{
+						finished("s2-1", "sub1", v1alpha1.WorkflowStepPhaseSucceeded, ""),
+						finished("s2-2", "sub2", v1alpha1.WorkflowStepPhaseFailed, types.StatusReasonFailedAfterRetries),
+					},
+				},
+				{StepStatus: running},
+			},
+		},
+	}
+	full := wr.Status.DeepCopy()
+
+	wfCtx, err := wfContext.NewContext(ctx, wr.Namespace, wr.Name, nil)
+	r.NoError(err)
+	wr.Status.ContextBackend = wfCtx.StoreRef()
+	r.NoError(ArchiveStepStatus(wfCtx, &wr.Status))
+	r.NoError(wfCtx.Commit(ctx))
+	r.Equal("", wfCtx.GetMutableValue(types.ContextPrefixStepStatus, "s3"))
+
+	// nothing to hydrate if the status is not pruned
+	r.NoError(HydrateStatus(ctx, wr))
+	r.Equal(full.Steps, wr.Status.Steps)
+
+	PruneStatus(&wr.Status)
+	r.Equal(v1alpha1.StepStatus{ID: "s1", Name: "step1", Phase: v1alpha1.WorkflowStepPhaseSucceeded}, wr.Status.Steps[0].StepStatus)
+	r.Equal(v1alpha1.StepStatus{ID: "s2-2", Name: "sub2", Phase: v1alpha1.WorkflowStepPhaseFailed, Reason: types.StatusReasonFailedAfterRetries}, wr.Status.Steps[1].SubStepsStatus[1])
+	r.Equal(running, wr.Status.Steps[2].StepStatus)
+
+	r.NoError(HydrateStatus(ctx, wr))
+	r.Equal(full.Steps, wr.Status.Steps)
+
+	// the stale archive is not restored if the step is finished again with another result
+	PruneStatus(&wr.Status)
+	wr.Status.Steps[0].Phase = v1alpha1.WorkflowStepPhaseSkipped
+	r.NoError(HydrateStatus(ctx, wr))
+	r.Equal(v1alpha1.StepStatus{ID: "s1", Name: "step1", Phase: v1alpha1.WorkflowStepPhaseSkipped}, wr.Status.Steps[0].StepStatus)
+	r.Equal(full.Steps[1], wr.Status.Steps[1])
+
+	wr.Status.ContextBackend.Name = "not-found"
+	r.Error(HydrateStatus(ctx, wr))
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+// watchRetryInterval is the interval to wait before re-establishing the watch of the workflow run
+var watchRetryInterval = time.Second
+
+// WatchRun watches the workflow run and emits the snapshots of its status when it changes.
+// The channel is closed when the run finishes, the run is deleted or ctx is canceled.
+// The watch is re-established internally if it's closed by the server.
+func WatchRun(ctx context.Context, cli client.WithWatch, name, namespace string) (<-chan v1alpha1.WorkflowRunStatus, error) {
+	run := &v1alpha1.WorkflowRun{}
+	if err := cli.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, run); err != nil {
+		return nil, err
+	}
+	ch := make(chan v1alpha1.WorkflowRunStatus)
+	w := &runWatcher{cli: cli, name: name, namespace: namespace, ch: ch}
+	go w.run(ctx, run)
+	return ch, nil
+}
+
+type runWatcher struct {
+	cli       client.WithWatch
+	name      string
+	namespace string
+	ch        chan v1alpha1.WorkflowRunStatus
+	last      *v1alpha1.WorkflowRunStatus
+}
+
+func (w *runWatcher) run(ctx context.Context, run *v1alpha1.WorkflowRun) {
+	defer close(w.ch)
+	for {
+		if !w.emit(ctx, run) || run.Status.Finished {
+			return
+		}
+		var done bool
+		run, done = w.watch(ctx, run.ResourceVersion)
+		if done {
+			return
+		}
+		if run != nil {
+			continue
+		}
+		// the watch is closed, wait and get the latest run to catch up the missed changes
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryInterval):
+		}
+		run = &v1alpha1.WorkflowRun{}
+		if err := w.cli.Get(ctx, client.ObjectKey{Name: w.name, Namespace: w.namespace}, run); err != nil {
+			if kerrors.IsNotFound(err) || ctx.Err() != nil {
+				return
+			}
+			klog.Errorf("failed to get workflow run %s/%s: %v", w.namespace, w.name, err)
+			run.Status = *w.last
+		}
+	}
+}
+
+// emit sends the status of the run if it's changed, returns false if ctx is canceled
+func (w *runWatcher) emit(ctx context.Context, run *v1alpha1.WorkflowRun) bool {
+	if w.last != nil && equality.Semantic.DeepEqual(*w.last, run.Status) {
+		return true
+	}
+	status := run.Status.DeepCopy()
+	select {
+	case <-ctx.Done():
+		return false
+	case w.ch <- *status:
+		w.last = status
+		return true
+	}
+}
+
+// watch watches the run from the resource version until its status changes, returns nil run if the watch is closed,
+// and returns done if the run is deleted or ctx is canceled
+func (w *runWatcher) watch(ctx context.Context, resourceVersion string) (*v1alpha1.WorkflowRun, bool) {
+	watcher, err := w.cli.Watch(ctx, &v1alpha1.WorkflowRunList{}, client.InNamespace(w.namespace), &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", w.name),
+		Raw:           &metav1.ListOptions{ResourceVersion: resourceVersion},
+	})
+	if err != nil {
+		klog.Errorf("failed to watch workflow run %s/%s: %v", w.namespace, w.name, err)
+		return nil, ctx.Err() != nil
+	}
+	defer watcher.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, true
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil, ctx.Err() != nil
+			}
+			switch event.Type {
+			case watch.Deleted:
+				if run, ok := event.Object.(*v1alpha1.WorkflowRun); ok && run.Name == w.name {
+					return nil, true
+				}
+			case watch.Added, watch.Modified:
+				if run, ok := event.Object.(*v1alpha1.WorkflowRun); ok && run.Name == w.name {
+					if w.last == nil || !equality.Semantic.DeepEqual(*w.last, run.Status) {
+						return run, false
+					}
+				}
+			case watch.Error:
+				return nil, false
+			}
+		}
+	}
+}
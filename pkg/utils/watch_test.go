@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func TestWatchRun(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	watchCli := cli.(client.WithWatch)
+
+	_, err := WatchRun(ctx, watchCli, "not-found", "default")
+	r.Error(err)
+
+	next := func(ch <-chan v1alpha1.WorkflowRunStatus) (v1alpha1.WorkflowRunStatus, bool) {
+		select {
+		case status, ok := <-ch:
+			return status, ok
+		case <-time.After(5 * time.Second):
+			r.FailNow("timeout waiting for the status")
+		}
+		return v1alpha1.WorkflowRunStatus{}, false
+	}
+	update := func(name string, fn func(run *v1alpha1.WorkflowRun)) {
+		run := &v1alpha1.WorkflowRun{}
+		r.NoError(cli.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, run))
+		fn(run)
+		r.NoError(cli.Update(ctx, run))
+	}
+
+	run := &v1alpha1.WorkflowRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "watch", Namespace: "default"},
+		Status:     v1alpha1.WorkflowRunStatus{Phase: v1alpha1.WorkflowStateInitializing},
+	}
+	r.NoError(cli.Create(ctx, run))
+	ch, err := WatchRun(ctx, watchCli, "watch", "default")
+	r.NoError(err)
+	status, ok := next(ch)
+	r.True(ok)
+	r.Equal(v1alpha1.WorkflowStateInitializing, status.Phase)
+
+	// the change out of status is not emitted
+	update("watch", func(run *v1alpha1.WorkflowRun) { run.Labels = map[string]string{"test": "test"} })
+	update("watch", func(run *v1alpha1.WorkflowRun) { run.Status.Phase = v1alpha1.WorkflowStateExecuting })
+	status, ok = next(ch)
+	r.True(ok)
+	r.Equal(v1alpha1.WorkflowStateExecuting, status.Phase)
+
+	update("watch", func(run *v1alpha1.WorkflowRun) {
+		run.Status.Phase = v1alpha1.WorkflowStateSucceeded
+		run.Status.Finished = true
+	})
+	status, ok = next(ch)
+	r.True(ok)
+	r.Equal(v1alpha1.WorkflowStateSucceeded, status.Phase)
+	r.True(status.Finished)
+	_, ok = next(ch)
+	r.False(ok)
+
+	// the channel is closed when ctx is canceled
+	cancelCtx, cancel := context.WithCancel(ctx)
+	run = &v1alpha1.WorkflowRun{ObjectMeta: metav1.ObjectMeta{Name: "watch-cancel", Namespace: "default"}}
+	r.NoError(cli.Create(ctx, run))
+	ch, err = WatchRun(cancelCtx, watchCli, "watch-cancel", "default")
+	r.NoError(err)
+	_, ok = next(ch)
+	r.True(ok)
+	cancel()
+	_, ok = next(ch)
+	r.False(ok)
+
+	// the channel is closed when the run is deleted
+	run = &v1alpha1.WorkflowRun{ObjectMeta: metav1.ObjectMeta{Name: "watch-delete", Namespace: "default"}}
+	r.NoError(cli.Create(ctx, run))
+	ch, err = WatchRun(ctx, watchCli, "watch-delete", "default")
+	r.NoError(err)
+	_, ok = next(ch)
+	r.True(ok)
+	r.NoError(cli.Delete(ctx, run))
+	_, ok = next(ch)
+	r.False(ok)
+}
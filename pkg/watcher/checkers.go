@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubevela/workflow/pkg/providers/metrics"
+)
+
+const (
+	// TypePrometheus checks the result of the prometheus query
+	TypePrometheus = "prometheus"
+	// TypeHTTP checks the status code of the http request
+	TypeHTTP = "http"
+)
+
+// PrometheusProperties is the properties of the prometheus watcher
+type PrometheusProperties struct {
+	// MetricEndpoint is the address of the prometheus
+	MetricEndpoint string `json:"metricEndpoint"`
+	// Query is the query of the signal, the result must be a scalar or a vector with only one sample
+	Query string `json:"query"`
+	// Condition is the healthy condition of the query result, e.g. `< 0.05`, the signal is breached if it's not met
+	Condition string `json:"condition"`
+}
+
+type prometheusChecker struct{}
+
+// Check queries the prometheus and breaches if the result doesn't meet the healthy condition
+func (c *prometheusChecker) Check(ctx context.Context, properties *runtime.RawExtension) (bool, string, error) {
+	props := PrometheusProperties{}
+	if err := unmarshalProperties(properties, &props); err != nil {
+		return false, "", err
+	}
+	value, err := metrics.QueryValue(ctx, props.MetricEndpoint, props.Query)
+	if err != nil {
+		return false, "", err
+	}
+	healthy, err := metrics.MatchCondition(value, props.Condition)
+	if err != nil {
+		return false, "", err
+	}
+	if !healthy {
+		return true, fmt.Sprintf("the query result %s doesn't meet the healthy condition %s", value, props.Condition), nil
+	}
+	return false, fmt.Sprintf("the query result %s meets the healthy condition %s", value, props.Condition), nil
+}
+
+// HTTPProperties is the properties of the http watcher
+type HTTPProperties struct {
+	// URL is the url of the request
+	URL string `json:"url"`
+	// Method is the method of the request, the default is GET
+	Method string `json:"method,omitempty"`
+	// ExpectedStatus is the expected status code of the response, the default is 200
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+}
+
+type httpChecker struct{}
+
+// Check sends the request and breaches if the request fails or the status code is not the expected one
+func (c *httpChecker) Check(ctx context.Context, properties *runtime.RawExtension) (bool, string, error) {
+	props := HTTPProperties{Method: http.MethodGet, ExpectedStatus: http.StatusOK}
+	if err := unmarshalProperties(properties, &props); err != nil {
+		return false, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, props.Method, props.URL, nil)
+	if err != nil {
+		return false, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the unreachable endpoint is unhealthy
+		return true, fmt.Sprintf("failed to request %s: %s", props.URL, err.Error()), nil
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != props.ExpectedStatus {
+		return true, fmt.Sprintf("the status code of %s is %d, expected %d", props.URL, resp.StatusCode, props.ExpectedStatus), nil
+	}
+	return false, fmt.Sprintf("the status code of %s is %d", props.URL, resp.StatusCode), nil
+}
+
+func unmarshalProperties(properties *runtime.RawExtension, v interface{}) error {
+	if properties == nil || len(properties.Raw) == 0 {
+		return fmt.Errorf("empty properties")
+	}
+	if err := json.Unmarshal(properties.Raw, v); err != nil {
+		return fmt.Errorf("invalid properties: %w", err)
+	}
+	return nil
+}
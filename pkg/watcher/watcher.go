@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+const (
+	// DefaultInterval is the default interval between the checks of the watcher
+	DefaultInterval = 30 * time.Second
+	// DefaultThreshold is the default number of the consecutive breaches before the action is taken
+	DefaultThreshold = 1
+)
+
+// CheckTimeout is the timeout of each check of the watchers
+var CheckTimeout = 10 * time.Second
+
+// Checker checks the signal of the watcher
+type Checker interface {
+	// Check returns true if the signal is breached, with the message describing the signal. The error is returned
+	// if the signal can't be checked, which is not counted as a breach.
+	Check(ctx context.Context, properties *runtime.RawExtension) (bool, string, error)
+}
+
+var (
+	checkersMu sync.RWMutex
+	checkers   = map[string]Checker{
+		TypePrometheus: &prometheusChecker{},
+		TypeHTTP:       &httpChecker{},
+	}
+)
+
+// RegisterChecker registers the checker of the type, the existing checker of the type is replaced
+func RegisterChecker(typ string, checker Checker) {
+	checkersMu.Lock()
+	defer checkersMu.Unlock()
+	checkers[typ] = checker
+}
+
+// GetChecker gets the checker of the type
+func GetChecker(typ string) (Checker, error) {
+	checkersMu.RLock()
+	defer checkersMu.RUnlock()
+	checker, ok := checkers[typ]
+	if !ok {
+		return nil, fmt.Errorf("watcher type %s is not supported", typ)
+	}
+	return checker, nil
+}
+
+// Result is the result of the watchers of the run
+type Result struct {
+	// Breached is the watcher whose breaches reach the threshold, it's nil if there is none
+	Breached *v1alpha1.RunWatcher
+	// Message describes the breached signal
+	Message string
+	// RequeueAfter is the duration until the next check of the watchers, it's zero if there are no watchers
+	RequeueAfter time.Duration
+}
+
+// Watch runs the checks of the watchers that are due and records the results in the status of the run. The
+// breaches of the watcher are reset once it's returned as breached, so the action is taken again only if the
+// signal is still breached after the threshold.
+func Watch(ctx context.Context, run *v1alpha1.WorkflowRun, now time.Time) Result {
+	result := Result{}
+	for i := range run.Spec.Watchers {
+		w := run.Spec.Watchers[i]
+		status := getStatus(run, w.Name)
+		interval := GetInterval(w)
+		if next := status.LastCheckTime.Add(interval); !status.LastCheckTime.IsZero() && now.Before(next) {
+			result.requeueAfter(next.Sub(now))
+			continue
+		}
+		result.requeueAfter(interval)
+		status.LastCheckTime = metav1.NewTime(now)
+		breached, message, err := check(ctx, w)
+		switch {
+		case err != nil:
+			status.Message = fmt.Sprintf("failed to check: %s", err.Error())
+			continue
+		case breached:
+			status.Breaches++
+		default:
+			status.Breaches = 0
+		}
+		status.Message = message
+		threshold := w.Threshold
+		if threshold <= 0 {
+			threshold = DefaultThreshold
+		}
+		if status.Breaches >= threshold && result.Breached == nil {
+			result.Breached = &w
+			result.Message = fmt.Sprintf("watcher %s is breached %d times: %s", w.Name, status.Breaches, message)
+			status.Breaches = 0
+		}
+	}
+	return result
+}
+
+// GetInterval returns the interval between the checks of the watcher
+func GetInterval(w v1alpha1.RunWatcher) time.Duration {
+	if w.Interval == "" {
+		return DefaultInterval
+	}
+	interval, err := time.ParseDuration(w.Interval)
+	if err != nil || interval <= 0 {
+		return DefaultInterval
+	}
+	return interval
+}
+
+func check(ctx context.Context, w v1alpha1.RunWatcher) (bool, string, error) {
+	checker, err := GetChecker(w.Type)
+	if err != nil {
+		return false, "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+	return checker.Check(ctx, w.Properties)
+}
+
+func getStatus(run *v1alpha1.WorkflowRun, name string) *v1alpha1.WatcherStatus {
+	for i := range run.Status.Watchers {
+		if run.Status.Watchers[i].Name == name {
+			return &run.Status.Watchers[i]
+		}
+	}
+	run.Status.Watchers = append(run.Status.Watchers, v1alpha1.WatcherStatus{Name: name})
+	return &run.Status.Watchers[len(run.Status.Watchers)-1]
+}
+
+func (r *Result) requeueAfter(d time.Duration) {
+	if r.RequeueAfter == 0 || d < r.RequeueAfter {
+		r.RequeueAfter = d
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+type fakeChecker struct {
+	results []bool
+	err     error
+}
+
+func (c *fakeChecker) Check(_ context.Context, _ *runtime.RawExtension) (bool, string, error) {
+	if c.err != nil {
+		return false, "", c.err
+	}
+	breached := c.results[0]
+	c.results = c.results[1:]
+	return breached, fmt.Sprintf("breached: %t", breached), nil
+}
+
+func TestWatch(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	checker := &fakeChecker{results: []bool{true, false, true, true, true}}
+	RegisterChecker("fake", checker)
+	run := &v1alpha1.WorkflowRun{Spec: v1alpha1.WorkflowRunSpec{Watchers: []v1alpha1.RunWatcher{{
+		Name:      "error-rate",
+		Type:      "fake",
+		Interval:  "10s",
+		Threshold: 2,
+		Action:    v1alpha1.WatcherActionTerminate,
+	}}}}
+	now := time.Now()
+
+	result := Watch(ctx, run, now)
+	r.Nil(result.Breached)
+	r.Equal(10*time.Second, result.RequeueAfter)
+	r.Equal(1, run.Status.Watchers[0].Breaches)
+	r.Equal("breached: true", run.Status.Watchers[0].Message)
+
+	// the watcher is not checked until the interval is passed
+	result = Watch(ctx, run, now.Add(4*time.Second))
+	r.Nil(result.Breached)
+	r.Equal(6*time.Second, result.RequeueAfter)
+	r.Equal(1, run.Status.Watchers[0].Breaches)
+
+	// the breaches are consecutive
+	Watch(ctx, run, now.Add(10*time.Second))
+	r.Equal(0, run.Status.Watchers[0].Breaches)
+	Watch(ctx, run, now.Add(20*time.Second))
+	r.Equal(1, run.Status.Watchers[0].Breaches)
+	result = Watch(ctx, run, now.Add(30*time.Second))
+	r.NotNil(result.Breached)
+	r.Equal("error-rate", result.Breached.Name)
+	r.Equal("watcher error-rate is breached 2 times: breached: true", result.Message)
+	r.Equal(0, run.Status.Watchers[0].Breaches)
+
+	// the failed check is not a breach
+	checker.err = errors.New("connection refused")
+	result = Watch(ctx, run, now.Add(40*time.Second))
+	r.Nil(result.Breached)
+	r.Equal("failed to check: connection refused", run.Status.Watchers[0].Message)
+
+	run.Spec.Watchers[0].Type = "unknown"
+	Watch(ctx, run, now.Add(50*time.Second))
+	r.Equal("failed to check: watcher type unknown is not supported", run.Status.Watchers[0].Message)
+	r.Len(run.Status.Watchers, 1)
+}
+
+func TestHTTPChecker(t *testing.T) {
+	r := require.New(t)
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	checker, err := GetChecker(TypeHTTP)
+	r.NoError(err)
+	properties := &runtime.RawExtension{Raw: []byte(fmt.Sprintf(`{"url":"%s"}`, srv.URL))}
+
+	breached, _, err := checker.Check(context.Background(), properties)
+	r.NoError(err)
+	r.False(breached)
+
+	status = http.StatusServiceUnavailable
+	breached, message, err := checker.Check(context.Background(), properties)
+	r.NoError(err)
+	r.True(breached)
+	r.Equal(fmt.Sprintf("the status code of %s is 503, expected 200", srv.URL), message)
+
+	_, _, err = checker.Check(context.Background(), nil)
+	r.Error(err)
+}
+
+func TestPrometheusChecker(t *testing.T) {
+	r := require.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1678701380.73,"0.1"]}]}}`))
+	}))
+	defer srv.Close()
+	checker, err := GetChecker(TypePrometheus)
+	r.NoError(err)
+
+	breached, message, err := checker.Check(context.Background(), &runtime.RawExtension{
+		Raw: []byte(fmt.Sprintf(`{"metricEndpoint":"%s","query":"error_rate","condition":"< 0.05"}`, srv.URL)),
+	})
+	r.NoError(err)
+	r.True(breached)
+	r.Equal("the query result 0.1 doesn't meet the healthy condition < 0.05", message)
+
+	breached, _, err = checker.Check(context.Background(), &runtime.RawExtension{
+		Raw: []byte(fmt.Sprintf(`{"metricEndpoint":"%s","query":"error_rate","condition":"< 0.5"}`, srv.URL)),
+	})
+	r.NoError(err)
+	r.False(breached)
+}
@@ -21,6 +21,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
 
 	"github.com/kubevela/workflow/controllers"
+	"github.com/kubevela/workflow/pkg/webhook/v1alpha1/approval"
 	"github.com/kubevela/workflow/pkg/webhook/v1alpha1/workflowrun"
 )
 
@@ -28,6 +29,7 @@ import (
 func Register(mgr manager.Manager, args controllers.Args) {
 	workflowrun.RegisterValidatingHandler(mgr, args)
 	workflowrun.RegisterMutatingHandler(mgr)
+	approval.RegisterMutatingHandler(mgr)
 
 	server := mgr.GetWebhookServer()
 	server.Register("/convert", &conversion.Webhook{})
@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+// MutatingHandler sets the approver of the approval from the user of the request, so the approval gates can't be
+// approved by impersonating their approvers
+type MutatingHandler struct {
+	Decoder *admission.Decoder
+}
+
+var _ admission.Handler = &MutatingHandler{}
+
+// Handle mutate approval
+func (h *MutatingHandler) Handle(_ context.Context, req admission.Request) admission.Response {
+	approval := &v1alpha1.Approval{}
+	if err := h.Decoder.Decode(req, approval); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	user, requested := req.UserInfo.Username, approval.Spec.Approver
+	if req.Operation == admissionv1.Update {
+		old := &v1alpha1.Approval{}
+		if err := h.Decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if requested == old.Spec.Approver {
+			requested = ""
+		}
+		// the approver is kept if the decision is not changed, e.g. the labels are updated by the others
+		approval.Spec.Approver, approval.Spec.ApproverGroups = old.Spec.Approver, old.Spec.ApproverGroups
+		if requested == "" && reflect.DeepEqual(approval.Spec, old.Spec) {
+			return patchResponse(req, approval)
+		}
+	}
+	if requested != "" && requested != user {
+		return admission.Denied(fmt.Sprintf("the approver %s is not the user %s of the request", requested, user))
+	}
+	approval.Spec.Approver, approval.Spec.ApproverGroups = user, req.UserInfo.Groups
+	return patchResponse(req, approval)
+}
+
+func patchResponse(req admission.Request, approval *v1alpha1.Approval) admission.Response {
+	bs, err := json.Marshal(approval)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.AdmissionRequest.Object.Raw, bs)
+}
+
+var _ admission.DecoderInjector = &MutatingHandler{}
+
+// InjectDecoder .
+func (h *MutatingHandler) InjectDecoder(d *admission.Decoder) error {
+	h.Decoder = d
+	return nil
+}
+
+// RegisterMutatingHandler will register approval mutation handler to the webhook
+func RegisterMutatingHandler(mgr manager.Manager) {
+	server := mgr.GetWebhookServer()
+	server.Register("/mutating-core-oam-dev-v1alpha1-approvals", &webhook.Admission{Handler: &MutatingHandler{}})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+)
+
+func TestMutatingHandler(t *testing.T) {
+	r := require.New(t)
+	scheme := runtime.NewScheme()
+	r.NoError(v1alpha1.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	r.NoError(err)
+	handler := &MutatingHandler{}
+	r.NoError(handler.InjectDecoder(decoder))
+
+	raw := func(spec v1alpha1.ApprovalSpec) runtime.RawExtension {
+		b, err := json.Marshal(&v1alpha1.Approval{
+			TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: v1alpha1.ApprovalKind},
+			Spec:     spec,
+		})
+		r.NoError(err)
+		return runtime.RawExtension{Raw: b}
+	}
+	handle := func(operation admissionv1.Operation, spec v1alpha1.ApprovalSpec, old *v1alpha1.ApprovalSpec) admission.Response {
+		req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: operation,
+			Object:    raw(spec),
+			UserInfo:  authenticationv1.UserInfo{Username: "alice", Groups: []string{"security", "system:authenticated"}},
+		}}
+		if old != nil {
+			req.OldObject = raw(*old)
+		}
+		return handler.Handle(context.Background(), req)
+	}
+	stamped := []jsonpatch.JsonPatchOperation{
+		{Operation: "add", Path: "/spec/approver", Value: "alice"},
+		{Operation: "add", Path: "/spec/approverGroups", Value: []interface{}{"security", "system:authenticated"}},
+	}
+
+	spec := v1alpha1.ApprovalSpec{WorkflowRun: "run", Step: "approve", Gate: "security", Decision: v1alpha1.ApprovalDecisionApproved}
+	resp := handle(admissionv1.Create, spec, nil)
+	r.True(resp.Allowed)
+	r.ElementsMatch(stamped, resp.Patches)
+
+	spoofed := spec
+	spoofed.Approver = "bob"
+	resp = handle(admissionv1.Create, spoofed, nil)
+	r.False(resp.Allowed)
+	r.Equal(metav1.StatusReason("the approver bob is not the user alice of the request"), resp.Result.Reason)
+
+	// the decision made by another user is stamped with the user of the update
+	old := spec
+	old.Decision, old.Approver, old.ApproverGroups = "", "carol", []string{"platform"}
+	resp = handle(admissionv1.Update, spec, &old)
+	r.True(resp.Allowed)
+	r.ElementsMatch([]jsonpatch.JsonPatchOperation{
+		{Operation: "add", Path: "/spec/approver", Value: "alice"},
+		{Operation: "add", Path: "/spec/approverGroups", Value: []interface{}{"security", "system:authenticated"}},
+	}, resp.Patches)
+	spoofed.Decision = ""
+	resp = handle(admissionv1.Update, spoofed, &old)
+	r.False(resp.Allowed)
+
+	// the approver is kept if the spec is not changed
+	old.Decision = spec.Decision
+	unchanged := old
+	unchanged.Approver, unchanged.ApproverGroups = "", nil
+	resp = handle(admissionv1.Update, unchanged, &old)
+	r.True(resp.Allowed)
+	r.ElementsMatch([]jsonpatch.JsonPatchOperation{
+		{Operation: "add", Path: "/spec/approver", Value: "carol"},
+		{Operation: "add", Path: "/spec/approverGroups", Value: []interface{}{"platform"}},
+	}, resp.Patches)
+}
@@ -22,20 +22,35 @@ import (
 	"fmt"
 	"net/http"
 
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/utils"
 )
 
 // MutatingHandler adding user info to application annotations
 type MutatingHandler struct {
+	Client  client.Client
 	Decoder *admission.Decoder
 }
 
 var _ admission.Handler = &MutatingHandler{}
 
+var _ inject.Client = &MutatingHandler{}
+
+// InjectClient injects the client into the MutatingHandler
+func (h *MutatingHandler) InjectClient(c client.Client) error {
+	if h.Client != nil {
+		return nil
+	}
+	h.Client = c
+	return nil
+}
+
 // Handle mutate application
 func (h *MutatingHandler) Handle(ctx context.Context, req admission.Request) admission.Response { //nolint:revive,unused
 	wr := &v1alpha1.WorkflowRun{}
@@ -54,6 +69,16 @@ func (h *MutatingHandler) Handle(ctx context.Context, req admission.Request) adm
 			}
 		}
 	}
+	if wr.Spec.WorkflowSpec == nil && wr.Spec.WorkflowRef != "" && h.Client != nil {
+		// the defaults of the omitted parameters are applied, the invalid parameters are rejected by the validating
+		// webhook, as well as the workflow that is not found
+		w := &v1alpha1.Workflow{}
+		if err := h.Client.Get(ctx, client.ObjectKey{Namespace: wr.Namespace, Name: wr.Spec.WorkflowRef}, w); err == nil {
+			if _, err := utils.ApplyRunParameters(wr, w.Parameters); err != nil {
+				return admission.Errored(http.StatusBadRequest, err)
+			}
+		}
+	}
 	bs, err := json.Marshal(wr)
 	if err != nil {
 		return admission.Errored(http.StatusInternalServerError, err)
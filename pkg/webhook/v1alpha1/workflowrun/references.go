@@ -0,0 +1,204 @@
+/*
+Copyright 2022 The KubeVela Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workflowrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/literal"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/cue/model"
+	"github.com/kubevela/workflow/pkg/hooks"
+	"github.com/kubevela/workflow/pkg/tasks/custom"
+)
+
+const (
+	// scopeInputs is the scope of the inputs of the step in the if expression, keyed by the `from` of the inputs
+	scopeInputs = "inputs"
+	// scopeParameter is the scope of the properties of the step
+	scopeParameter = "parameter"
+	// scopeOutput is the scope of the outputs of the step in the status message
+	scopeOutput = "output"
+	// interpolationMarker marks the step fields rendered by the cue string interpolation
+	interpolationMarker = `\(`
+)
+
+// scopes are the declared keys of the scopes referenced in the expressions of the step, the references to the
+// other scopes, e.g. `context`, are not checked
+type scopes map[string]map[string]bool
+
+// ValidateReferences validates the references of the expressions in the step into the inputs, outputs and
+// parameter. The references to the undeclared keys are rejected, and the references that can't be analyzed
+// statically are returned as warnings, e.g. `inputs[name]` or the inputs that are not the outputs of any step.
+// The inputs from `shared.<name>` must be declared in the shared inputs of the run.
+func (h *ValidatingHandler) ValidateReferences(path *field.Path, step v1alpha1.WorkflowStepBase, outputs, shared map[string]bool) (field.ErrorList, []string) {
+	var errs field.ErrorList
+	var warnings []string
+	parameter := map[string]bool{}
+	if step.Properties != nil && len(step.Properties.Raw) > 0 {
+		properties := map[string]interface{}{}
+		if err := json.Unmarshal(step.Properties.Raw, &properties); err != nil {
+			// the properties of other types can't be referenced by keys
+			parameter = nil
+		}
+		for k := range properties {
+			parameter[k] = true
+		}
+	}
+	inputs := map[string]bool{}
+	for _, input := range step.Inputs {
+		inputs[input.From] = true
+	}
+	stepOutputs := map[string]bool{}
+	for _, output := range step.Outputs {
+		stepOutputs[output.Name] = true
+		// the sensitive output is redacted in the debug dumps by replacing the field it's read from
+		if output.Sensitive && cue.ParsePath(output.ValueFrom).Err() != nil {
+			errs = append(errs, field.Invalid(path.Child("outputs", "valueFrom"), output.ValueFrom, fmt.Sprintf("step %s: the sensitive output %s must be read from a field", step.Name, output.Name)))
+		}
+		for j, stage := range output.Pipeline {
+			stagePath := path.Child("outputs", "pipeline").Index(j)
+			if (stage.Transform == "") == (stage.Expression == "") {
+				errs = append(errs, field.Invalid(stagePath, hooks.StageName(stage), fmt.Sprintf("step %s: the stage %d of the pipeline of output %s must set either the transform or the expression", step.Name, j, output.Name)))
+				continue
+			}
+			if stage.Expression != "" {
+				if _, err := parser.ParseExpr("-", stage.Expression); err != nil {
+					errs = append(errs, field.Invalid(stagePath.Child("expression"), stage.Expression, fmt.Sprintf("step %s: the stage %d of the pipeline of output %s is invalid: %s", step.Name, j, output.Name, err.Error())))
+				}
+			}
+		}
+	}
+
+	check := func(child, expr string, s scopes) {
+		undeclared, dynamic, err := checkReferences(expr, s)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("step %s: the %s %q can't be analyzed: %s", step.Name, child, expr, err.Error()))
+			return
+		}
+		for _, ref := range undeclared {
+			errs = append(errs, field.Invalid(path.Child(child), expr, fmt.Sprintf("step %s: the reference %s is not declared", step.Name, ref)))
+		}
+		for _, ref := range dynamic {
+			warnings = append(warnings, fmt.Sprintf("step %s: the reference %s in the %s can't be checked statically", step.Name, ref, child))
+		}
+	}
+	if step.If != "" && step.If != "always" {
+		check("if", step.If, scopes{scopeInputs: inputs, scopeParameter: parameter})
+	}
+	if step.PreCondition != "" {
+		check("preCondition", step.PreCondition, scopes{scopeInputs: inputs, scopeParameter: parameter})
+	}
+	for _, expr := range custom.StatusMessageExpressions(step.StatusMessage) {
+		check("statusMessage", expr, scopes{scopeOutput: stepOutputs})
+	}
+	for child, values := range map[string][]string{"name": {step.Name}, "type": {step.Type}, "dependsOn": step.DependsOn} {
+		for _, v := range values {
+			// the dependsOn of a single interpolation may be resolved to a list of step names
+			if expr, ok := strings.CutPrefix(v, interpolationMarker); ok && child == "dependsOn" && strings.HasSuffix(expr, ")") {
+				if _, err := parser.ParseExpr("", strings.TrimSuffix(expr, ")")); err == nil {
+					check(child, strings.TrimSuffix(expr, ")"), scopes{scopeParameter: parameter})
+					continue
+				}
+			}
+			if strings.Contains(v, interpolationMarker) {
+				check(child, `"`+strings.ReplaceAll(v, `"`, `\"`)+`"`, scopes{scopeParameter: parameter})
+			}
+		}
+	}
+	for _, input := range step.Inputs {
+		if previous, ok := strings.CutPrefix(input.From, hooks.PreviousOutputPrefix); ok {
+			if name, _, _ := strings.Cut(previous, "."); !stepOutputs[name] {
+				errs = append(errs, field.Invalid(path.Child("inputs", "from"), input.From, fmt.Sprintf("step %s: the output %s is not declared in the step", step.Name, name)))
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(input.From, hooks.SharedInputsKey+"."); ok {
+			if name, _, _ = strings.Cut(name, "."); !shared[name] {
+				errs = append(errs, field.Invalid(path.Child("inputs", "from"), input.From, fmt.Sprintf("step %s: the shared input %s is not declared in the run", step.Name, name)))
+			}
+			continue
+		}
+		// the variables in the context may be set by the context of the run or the templates of the steps,
+		// and the inputs from the step context, e.g. `context.stepName`, are not checked
+		if name, _, _ := strings.Cut(input.From, "."); !outputs[name] && name != model.ContextFieldName {
+			warnings = append(warnings, fmt.Sprintf("step %s: the input %s is not the output of any step", step.Name, input.From))
+		}
+	}
+	return errs, warnings
+}
+
+// checkReferences parses the cue expression and checks its references into the scopes, it returns the references
+// to the undeclared keys and the references that can't be analyzed statically, e.g. `inputs[name]`
+func checkReferences(expr string, s scopes) ([]string, []string, error) {
+	node, err := parser.ParseExpr("", expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	var undeclared, dynamic []string
+	lookup := func(x ast.Expr) (string, map[string]bool, bool) {
+		ident, ok := x.(*ast.Ident)
+		if !ok {
+			return "", nil, false
+		}
+		keys, ok := s[ident.Name]
+		return ident.Name, keys, ok
+	}
+	ast.Walk(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			scope, keys, ok := lookup(n.X)
+			if !ok {
+				return true
+			}
+			name, _, err := ast.LabelName(n.Sel)
+			if err != nil {
+				dynamic = append(dynamic, fmt.Sprintf("%s.(...)", scope))
+			} else if keys != nil && !keys[name] {
+				undeclared = append(undeclared, fmt.Sprintf("%s.%s", scope, name))
+			}
+			return false
+		case *ast.IndexExpr:
+			scope, keys, ok := lookup(n.X)
+			if !ok {
+				return true
+			}
+			lit, ok := n.Index.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				dynamic = append(dynamic, fmt.Sprintf("%s[...]", scope))
+				return false
+			}
+			name, err := literal.Unquote(lit.Value)
+			if err != nil {
+				dynamic = append(dynamic, fmt.Sprintf("%s[%s]", scope, lit.Value))
+			} else if keys != nil && !keys[name] {
+				undeclared = append(undeclared, fmt.Sprintf("%s[%s]", scope, lit.Value))
+			}
+			return false
+		}
+		return true
+	}, nil)
+	return undeclared, dynamic, nil
+}
@@ -84,7 +84,7 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(err).ToNot(HaveOccurred())
 	Expect(k8sClient).ToNot(BeNil())
 
-	handler = &ValidatingHandler{}
+	handler = &ValidatingHandler{SystemDefinitionNamespace: "vela-system"}
 
 	decoder, err = admission.NewDecoder(testScheme)
 	Expect(err).Should(BeNil())
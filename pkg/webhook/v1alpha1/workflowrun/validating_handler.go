@@ -20,8 +20,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
 	admissionv1 "k8s.io/api/admission/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -30,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/generator"
 	"github.com/kubevela/workflow/pkg/types"
 
 	"github.com/kubevela/workflow/controllers"
@@ -42,6 +45,9 @@ type ValidatingHandler struct {
 	Client client.Client
 	// Decoder decodes objects
 	Decoder *admission.Decoder
+	// SystemDefinitionNamespace is the namespace of the system step definitions, the step types are also looked up in
+	// it besides the namespace of the workflow run
+	SystemDefinitionNamespace string
 }
 
 var _ inject.Client = &ValidatingHandler{}
@@ -66,12 +72,16 @@ func (h *ValidatingHandler) InjectDecoder(d *admission.Decoder) error {
 	return nil
 }
 
-func mergeErrors(errs field.ErrorList) error {
-	s := ""
-	for _, err := range errs {
-		s += fmt.Sprintf("field \"%s\": %s error encountered, %s. ", err.Field, err.Type, err.Detail)
-	}
-	return fmt.Errorf(s)
+// invalidResponse denies the run with the structured errors, each error is reported as a cause in the details of
+// the status with the path of the field, so that the clients can show all the issues at once
+func invalidResponse(wr *v1alpha1.WorkflowRun, errs field.ErrorList, warnings []string) admission.Response {
+	status := kerrors.NewInvalid(v1alpha1.WorkflowRunGroupVersionKind.GroupKind(), wr.Name, errs).ErrStatus
+	// http.StatusUnprocessableEntity will NOT report any error descriptions
+	// to the client, use generic http.StatusBadRequest instead.
+	status.Code = http.StatusBadRequest
+	return admission.Response{
+		AdmissionResponse: admissionv1.AdmissionResponse{Allowed: false, Result: &status},
+	}.WithWarnings(warnings...)
 }
 
 // Handle validate Application Spec here
@@ -81,27 +91,39 @@ func (h *ValidatingHandler) Handle(ctx context.Context, req admission.Request) a
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 	ctx = types.SetNamespaceInCtx(ctx, wr.Namespace)
+	var warnings []string
 	switch req.Operation {
 	case admissionv1.Create:
-		if allErrs := h.ValidateWorkflow(ctx, wr); len(allErrs) > 0 {
-			// http.StatusUnprocessableEntity will NOT report any error descriptions
-			// to the client, use generic http.StatusBadRequest instead.
-			return admission.Errored(http.StatusBadRequest, mergeErrors(allErrs))
+		allErrs, ws := h.ValidateWorkflow(ctx, wr)
+		if len(allErrs) > 0 {
+			return invalidResponse(wr, allErrs, ws)
+		}
+		warnings = ws
+		if req.DryRun != nil && *req.DryRun {
+			// the summary of the execution plan is returned in the warnings of the dry run to review before creating
+			// the run, the values are left out since the warnings are not protected as the run
+			plan, err := generator.Plan(ctx, h.Client, wr, types.StepGeneratorOptions{})
+			if err != nil {
+				return invalidResponse(wr, field.ErrorList{field.Invalid(field.NewPath("spec"), wr.Name, fmt.Sprintf("failed to plan the workflowrun: %v", err))}, warnings)
+			}
+			warnings = append(warnings, strings.Split(strings.TrimSuffix(plan.Summary(), "\n"), "\n")...)
 		}
 	case admissionv1.Update:
 		if wr.ObjectMeta.DeletionTimestamp.IsZero() {
-			if allErrs := h.ValidateWorkflow(ctx, wr); len(allErrs) > 0 {
-				return admission.Errored(http.StatusBadRequest, mergeErrors(allErrs))
+			allErrs, ws := h.ValidateWorkflow(ctx, wr)
+			if len(allErrs) > 0 {
+				return invalidResponse(wr, allErrs, ws)
 			}
+			warnings = ws
 		}
 	default:
 		// Do nothing for DELETE and CONNECT
 	}
-	return admission.ValidationResponse(true, "")
+	return admission.ValidationResponse(true, "").WithWarnings(warnings...)
 }
 
 // RegisterValidatingHandler will register application validate handler to the webhook
-func RegisterValidatingHandler(mgr manager.Manager, _ controllers.Args) {
+func RegisterValidatingHandler(mgr manager.Manager, args controllers.Args) {
 	server := mgr.GetWebhookServer()
-	server.Register("/validating-core-oam-dev-v1alpha1-workflowruns", &webhook.Admission{Handler: &ValidatingHandler{}})
+	server.Register("/validating-core-oam-dev-v1alpha1-workflowruns", &webhook.Admission{Handler: &ValidatingHandler{SystemDefinitionNamespace: args.SystemDefinitionNamespace}})
 }
@@ -17,12 +17,22 @@ limitations under the License.
 package workflowrun
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"gomodules.xyz/jsonpatch/v2"
 	admissionv1 "k8s.io/api/admission/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kubevela/workflow/api/v1alpha1"
 )
 
 var _ = Describe("Test WorkflowRun Validator", func() {
@@ -111,6 +121,19 @@ var _ = Describe("Test WorkflowRun Validator", func() {
 		}
 		resp = handler.Handle(ctx, req)
 		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test duplicated finalizer and main step name in workflow")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend"}],"onFailure":[{"name":"step1","type":"suspend"}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
 	})
 
 	It("Test WorkflowRun Validator workflow step invalid timeout [error]", func() {
@@ -141,4 +164,899 @@ var _ = Describe("Test WorkflowRun Validator", func() {
 		Expect(resp.Allowed).Should(BeTrue())
 	})
 
+	It("Test WorkflowRun Validator workflow step operation timeout", func() {
+		validate := func(step string) admission.Response {
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[` + step + `]}}}`),
+					},
+				},
+			}
+			return handler.Handle(ctx, req)
+		}
+		By("test valid operation timeout")
+		Expect(validate(`{"name":"step1","type":"suspend","timeout":"5m","operationTimeout":"30s"}`).Allowed).Should(BeTrue())
+		Expect(validate(`{"name":"step1","type":"suspend","operationTimeout":"30s"}`).Allowed).Should(BeTrue())
+
+		By("test invalid operation timeout")
+		Expect(validate(`{"name":"step1","type":"suspend","operationTimeout":"test"}`).Allowed).Should(BeFalse())
+
+		By("test operation timeout longer than the step timeout")
+		resp := validate(`{"name":"step1","type":"suspend","timeout":"30s","operationTimeout":"1m"}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("operation timeout must be shorter than the step timeout 30s"))
+	})
+
+	It("Test WorkflowRun Validator workflow step execution window", func() {
+		validate := func(window string) admission.Response {
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","executionWindow":` + window + `}]}}}`),
+					},
+				},
+			}
+			return handler.Handle(ctx, req)
+		}
+		By("test valid execution window")
+		Expect(validate(`{"timezone":"Asia/Shanghai","ranges":[{"days":["Sat","sunday"],"start":"22:00","end":"02:00"}]}`).Allowed).Should(BeTrue())
+		Expect(validate(`{"ranges":[{"start":"09:00","end":"17:30"}]}`).Allowed).Should(BeTrue())
+
+		By("test invalid execution window")
+		resp := validate(`{"timezone":"Mars/Olympus","ranges":[{"start":"09:00","end":"17:00"}]}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("invalid time zone Mars/Olympus"))
+		resp = validate(`{"ranges":[{"start":"9am","end":"17:00"}]}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("invalid time \"9am\""))
+		resp = validate(`{"ranges":[{"days":["Someday"],"start":"09:00","end":"17:00"}]}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("invalid day \"Someday\""))
+		Expect(validate(`{"ranges":[]}`).Allowed).Should(BeFalse())
+	})
+
+	It("Test WorkflowRun Validator shared inputs", func() {
+		validate := func(spec string) admission.Response {
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":` + spec + `}`),
+					},
+				},
+			}
+			return handler.Handle(ctx, req)
+		}
+		By("test valid shared inputs")
+		Expect(validate(`{"shared":[{"name":"region","configMapRef":{"name":"settings","key":"region"}}],"workflowSpec":{"steps":[{"name":"step1","type":"suspend","inputs":[{"from":"shared.region","parameterKey":"region"}]}]}}`).Allowed).Should(BeTrue())
+
+		By("test the reference to the undeclared shared input")
+		resp := validate(`{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","inputs":[{"from":"shared.region","parameterKey":"region"}]}]}}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("the shared input region is not declared in the run"))
+
+		By("test invalid shared inputs")
+		resp = validate(`{"shared":[{"name":"region"}],"workflowSpec":{"steps":[{"name":"step1","type":"suspend"}]}}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("the config map to read the shared input from can not be empty"))
+		resp = validate(`{"shared":[{"name":"region","configMapRef":{"name":"settings"}},{"name":"region","configMapRef":{"name":"settings"}}],"workflowSpec":{"steps":[{"name":"step1","type":"suspend"}]}}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("Duplicate value"))
+		resp = validate(`{"shared":[{"name":"region","configMapRef":{"name":"settings"}}],"workflowSpec":{"steps":[{"name":"step1","type":"suspend","outputs":[{"name":"shared","valueFrom":"output"}]}]}}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("the output shared of the steps conflicts with the shared inputs"))
+	})
+
+	It("Test WorkflowRun Validator watchers", func() {
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"watchers":[{"name":"error-rate","type":"prometheus"},{"name":"error-rate","type":"prometheus","interval":"0s"},{"type":"prometheus","threshold":-1}],"workflowSpec":{"steps":[{"name":"step1","type":"suspend"}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring(`spec.watchers[1].name: Duplicate value: "error-rate"`))
+		Expect(resp.Result.Message).Should(ContainSubstring(`spec.watchers[1].interval: Invalid value: "0s"`))
+		Expect(resp.Result.Message).Should(ContainSubstring("spec.watchers[2].name: Required value: empty watcher name"))
+		Expect(resp.Result.Message).Should(ContainSubstring("spec.watchers[2].threshold: Invalid value: -1"))
+	})
+
+	It("Test WorkflowRun Validator workflow step depends on condition", func() {
+		By("test valid depends on condition")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend"},{"name":"step2","type":"suspend"},{"name":"step3","type":"suspend","dependsOnCondition":{"anyOf":[{"step":"step1"},{"allOf":[{"step":"step2"}]}]}}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test depends on condition with unknown step")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend"},{"name":"step3","type":"suspend","dependsOnCondition":{"anyOf":[{"step":"step1"},{"step":"not-exist"}]}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test depends on condition with multiple fields")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend"},{"name":"step3","type":"suspend","dependsOnCondition":{"step":"step1","anyOf":[{"step":"step1"}]}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test depends on condition with empty group")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend"},{"name":"step3","type":"suspend","dependsOnCondition":{"allOf":[]}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test depends on condition ignoring failure")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend"},{"name":"step3","type":"suspend","dependsOnCondition":{"step":"step1","ignoreFailure":true}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test ignoring failure of group")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend"},{"name":"step3","type":"suspend","dependsOnCondition":{"anyOf":[{"step":"step1"}],"ignoreFailure":true}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+	})
+
+	It("Test WorkflowRun Validator workflow step periodic", func() {
+		By("test valid periodic step")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","periodic":{"interval":"30s"}}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test periodic step with invalid interval")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","periodic":{"interval":"0s"}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test periodic step with timeout")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","timeout":"1m","periodic":{"interval":"30s"}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+	})
+
+	It("Test WorkflowRun Validator workflow sub steps timeout", func() {
+		By("test valid sub steps timeout")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"group","type":"step-group","subStepsTimeout":"1m","subSteps":[{"name":"sub1","type":"suspend","timeout":"30s"}]}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test invalid timeout of sub step")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"group","type":"step-group","subSteps":[{"name":"sub1","type":"suspend","timeout":"test"}]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test invalid sub steps timeout")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"group","type":"step-group","subStepsTimeout":"test","subSteps":[{"name":"sub1","type":"suspend"}]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test sub steps timeout out of step group")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","subStepsTimeout":"1m"}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+	})
+
+	It("Test WorkflowRun Validator workflow step lock", func() {
+		By("test steps with the same lock")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","lock":"db"},{"name":"group","type":"step-group","subSteps":[{"name":"sub1","type":"suspend","lock":"db"}]}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test sub step with the lock of step group")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"group","type":"step-group","lock":"db","subSteps":[{"name":"sub1","type":"suspend","lock":"db"}]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("sub step sub1 can't declare a lock in the locked step group group"))
+
+		By("test sub step with another lock in the locked step group")
+		req.Object.Raw = []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"group1","type":"step-group","lock":"l1","subSteps":[{"name":"sub1","type":"suspend","lock":"l2"}]},{"name":"group2","type":"step-group","lock":"l2","subSteps":[{"name":"sub2","type":"suspend","lock":"l1"}]}]}}}`)
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("sub step sub1 can't declare a lock in the locked step group group1"))
+		Expect(resp.Result.Message).Should(ContainSubstring("sub step sub2 can't declare a lock in the locked step group group2"))
+
+		By("test generated sub steps with a lock in the locked step group")
+		req.Object.Raw = []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"check","type":"suspend","outputs":[{"name":"items","valueFrom":"output"}]},{"name":"group","type":"step-group","lock":"l1","generator":{"from":"items","template":{"name":"fix","type":"suspend","lock":"l2"}}}]}}}`)
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("the generated sub steps can't declare a lock in the locked step group group"))
+	})
+
+	It("Test WorkflowRun Validator completion webhook", func() {
+		By("test valid completion webhook")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"completionWebhook":{"url":"https://example.com/hook","secretRef":{"name":"hook","key":"token"},"maxAttempts":3},"workflowSpec":{"steps":[{"name":"step1","type":"suspend"}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test invalid completion webhook")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"completionWebhook":{"url":"ftp://example.com","secretRef":{"name":"hook"},"maxAttempts":-1},"workflowSpec":{"steps":[{"name":"step1","type":"suspend"}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("invalid url"))
+		Expect(resp.Result.Message).Should(ContainSubstring("the name and key of the secret can not be empty"))
+		Expect(resp.Result.Message).Should(ContainSubstring("maxAttempts can not be negative"))
+	})
+
+	It("Test WorkflowRun Validator sensitive outputs", func() {
+		By("test sensitive output read from a field")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","outputs":[{"name":"token","valueFrom":"output.token","sensitive":true}]}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test sensitive output read by a script")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","outputs":[{"name":"token","valueFrom":"output.token + \"-suffix\"","sensitive":true}]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("the sensitive output token must be read from a field"))
+
+		By("test invalid output pipeline")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","outputs":[{"name":"token","valueFrom":"output.token","pipeline":[{"transform":"base64Decode","expression":"value"},{"name":"extract","expression":"value.data["}]}]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("the stage 0 of the pipeline of output token must set either the transform or the expression"))
+		Expect(resp.Result.Message).Should(ContainSubstring("the stage 1 of the pipeline of output token is invalid"))
+	})
+
+	It("Test WorkflowRun Validator step group generator", func() {
+		By("test valid generator")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"check","type":"suspend","outputs":[{"name":"failures","valueFrom":"output.failures"}]},{"name":"remediate","type":"step-group","generator":{"from":"failures","template":{"name":"fix","type":"suspend"},"tolerance":"10%"}},{"name":"report","type":"suspend","inputs":[{"from":"remediate.results","parameterKey":"results"}]}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test invalid generator")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","generator":{"from":"","template":{"name":"fix"},"tolerance":"150%"}},{"name":"group","type":"step-group","generator":{"from":"failures","template":{"name":"fix","type":"step-group"}},"subSteps":[{"name":"sub1","type":"suspend"}]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("generator can only be set in step group"))
+		Expect(resp.Result.Message).Should(ContainSubstring("the output array to generate the sub steps from can not be empty"))
+		Expect(resp.Result.Message).Should(ContainSubstring("the name and type of the template can not be empty"))
+		Expect(resp.Result.Message).Should(ContainSubstring("generator can not be set in step group with sub steps"))
+		Expect(resp.Result.Message).Should(ContainSubstring("the generated sub steps can not be step groups"))
+		Expect(resp.Result.Message).Should(ContainSubstring("tolerance must be a non-negative number or a percentage between 0% and 100%"))
+	})
+
+	It("Test WorkflowRun Validator atomic step group", func() {
+		By("test valid atomic step group")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"group","type":"step-group","atomic":true,"subSteps":[{"name":"sub1","type":"suspend"},{"name":"sub2","type":"suspend"}]}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test atomic step that is not a step group")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","atomic":true}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("atomic can only be set in step group"))
+	})
+
+	It("Test WorkflowRun Validator approval gates", func() {
+		validate := func(steps string) admission.Response {
+			return handler.Handle(ctx, admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":` + steps + `}}}`),
+					},
+				},
+			})
+		}
+		By("test valid approval gates")
+		resp := validate(`[{"name":"approve","type":"suspend","approvalGates":[{"name":"security","approvers":["alice","bob"],"quorum":2},{"name":"platform"}]}]`)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test approval gates in the step that is not suspend")
+		resp = validate(`[{"name":"step1","type":"step-group","approvalGates":[{"name":"security"}]}]`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("approval gates can only be set in suspend step"))
+
+		By("test duplicated approval gates")
+		resp = validate(`[{"name":"approve","type":"suspend","approvalGates":[{"name":"security"},{"name":"security"}]}]`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("Duplicate value"))
+
+		By("test unreachable quorum")
+		resp = validate(`[{"name":"approve","type":"suspend","approvalGates":[{"name":"security","approvers":["alice"],"quorum":2}]}]`)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("quorum must not exceed the number of the approvers 1"))
+	})
+
+	It("Test WorkflowRun Validator detect changes", func() {
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"render","type":"suspend","detectChanges":true,"outputs":[{"name":"config","valueFrom":"output"}]}]}}}`),
+				},
+			},
+		}
+		By("test the inline steps that always change")
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(ContainElement(ContainSubstring("step render detects the changes of its outputs, but the run doesn't refer to a workflow")))
+
+		By("test the step without outputs")
+		req.Object.Raw = []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"render","type":"suspend","detectChanges":true}]}}}`)
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("detectChanges requires the outputs of the step"))
+	})
+
+	It("Test WorkflowRun Validator step group switch", func() {
+		By("test valid switch")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"deploy","type":"step-group","switch":{"value":"context.env","cases":[{"value":"dev","steps":["deploy-dev"]},{"value":"prod","steps":["deploy-prod"]}],"default":["notify"]},"subSteps":[{"name":"deploy-dev","type":"suspend"},{"name":"deploy-prod","type":"suspend"},{"name":"notify","type":"suspend"}]}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(BeEmpty())
+
+		By("test switch without default")
+		req.Object.Raw = []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"deploy","type":"step-group","switch":{"value":"context.env","cases":[{"value":"dev","steps":["deploy-dev"]}]},"subSteps":[{"name":"deploy-dev","type":"suspend"}]}]}}}`)
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(ContainElement(ContainSubstring("the switch has no default")))
+
+		By("test invalid switch")
+		req.Object.Raw = []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","switch":{"value":"","cases":[]}},{"name":"group","type":"step-group","switch":{"value":"context.env","cases":[{"value":"dev","steps":["deploy-dev"]},{"value":"dev","steps":["not-exist"]}],"default":[]},"subSteps":[{"name":"deploy-dev","type":"suspend"},{"name":"deploy-prod","type":"suspend"}]}]}}}`)
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("switch can only be set in step group"))
+		Expect(resp.Result.Message).Should(ContainSubstring("switch can only be set in step group with sub steps"))
+		Expect(resp.Result.Message).Should(ContainSubstring("the value to select the case by can not be empty"))
+		Expect(resp.Result.Message).Should(ContainSubstring(`spec.workflowSpec.steps[1].switch.cases[1].value: Duplicate value: "dev"`))
+		Expect(resp.Result.Message).Should(ContainSubstring("not-exist is not a sub step of step group group"))
+		Expect(resp.Result.Message).Should(ContainSubstring("sub step deploy-prod is not in any case or the default"))
+	})
+
+	It("Test WorkflowRun Validator workflow step service account", func() {
+		By("test valid service account")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample","namespace":"default"},"spec":{"workflowSpec":{"steps":[{"name":"group","type":"step-group","serviceAccount":"deployer","subSteps":[{"name":"sub1","type":"suspend","serviceAccount":"deployer"}]}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test invalid service account")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample","namespace":"default"},"spec":{"workflowSpec":{"steps":[{"name":"group","type":"step-group","subSteps":[{"name":"sub1","type":"suspend","serviceAccount":"Invalid_SA"}]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+	})
+
+	It("Test WorkflowRun Validator workflow step references", func() {
+		By("test valid references")
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","outputs":[{"name":"message","valueFrom":"context.name"}]},{"name":"step2-\\(parameter.suffix)","type":"suspend","properties":{"suffix":"a"},"inputs":[{"from":"message","parameterKey":"msg"}],"if":"inputs.message == \"hello\" && parameter.suffix == \"a\"","outputs":[{"name":"result","valueFrom":"context.name"}],"statusMessage":"result is {{ output.result }}"}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(BeEmpty())
+
+		By("test undeclared input in if")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","outputs":[{"name":"message","valueFrom":"context.name"}]},{"name":"step2","type":"suspend","inputs":[{"from":"message"}],"if":"inputs.other == \"hello\""}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test undeclared input in precondition")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","outputs":[{"name":"message","valueFrom":"context.name"}]},{"name":"step2","type":"suspend","inputs":[{"from":"message"}],"preCondition":"inputs.other != _|_"}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("spec.workflowSpec.steps[1].preCondition"))
+
+		By("test undeclared output in status message")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","outputs":[{"name":"message","valueFrom":"context.name"}],"statusMessage":"{{ output[\"result\"] }}"}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test undeclared parameter in templated name")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step-\\(parameter.suffix)","type":"suspend","properties":{"prefix":"a"}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test undeclared parameter in the dependsOn resolved to a list")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"deploy-a","type":"suspend"},{"name":"join","type":"suspend","properties":{"envs":["a"]},"dependsOn":["\\([for e in parameter.regions {\"deploy-\\(e)\"}])"]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Message).Should(ContainSubstring("the reference parameter.regions is not declared"))
+
+		By("test undeclared previous output")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","inputs":[{"from":"self.previous.message"}]}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+
+		By("test references that can't be checked statically")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","inputs":[{"from":"workspace.name"}],"if":"inputs[context.name] == \"hello\""}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(HaveLen(2))
+	})
+
+	It("Test WorkflowRun Validator structured errors", func() {
+		By("test the custom step type defined by the definition in the system namespace")
+		definition := &unstructured.Unstructured{}
+		definition.SetGroupVersionKind(workflowStepDefinitionGVK)
+		definition.SetName("deploy")
+		definition.SetNamespace("vela-system")
+		Expect(unstructured.SetNestedField(definition.Object, "parameter: {}", "spec", "schematic", "cue", "template")).Should(Succeed())
+		Expect(k8sClient.Create(ctx, definition)).Should(Succeed())
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample","namespace":"default"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"deploy"},{"name":"step2","type":"suspend","dependsOn":["step1"]}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test all the errors are reported with the paths of the fields")
+		req = admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample","namespace":"default"},"spec":{"workflowSpec":{"steps":[{"name":"step1","type":"suspend","dependsOn":["step2"]},{"name":"step2","type":"suspend","dependsOn":["step1"],"timeout":"1x"},{"name":"step1","type":"not-found"},{"name":"group","type":"step-group","subSteps":[{"name":"","type":"suspend"}]}],"onFailure":[{"name":"cleanup","type":"deploy-\\(parameter.env)","properties":{"env":"prod"}}]}}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Code).Should(Equal(int32(http.StatusBadRequest)))
+		Expect(resp.Result.Reason).Should(Equal(metav1.StatusReasonInvalid))
+		Expect(resp.Result.Details.Kind).Should(Equal("WorkflowRun"))
+		var causes []string
+		for _, cause := range resp.Result.Details.Causes {
+			causes = append(causes, fmt.Sprintf("%s %s", cause.Type, cause.Field))
+		}
+		Expect(causes).Should(ConsistOf(
+			"FieldValueInvalid spec.workflowSpec.steps[1].timeout",
+			"FieldValueDuplicate spec.workflowSpec.steps[2].name",
+			"FieldValueNotFound spec.workflowSpec.steps[2].type",
+			"FieldValueRequired spec.workflowSpec.steps[3].subSteps[0].name",
+			"FieldValueInvalid spec.workflowSpec.steps[1].dependsOn",
+		))
+		Expect(resp.Result.Message).Should(ContainSubstring("dependency cycle step1 -> step2 -> step1"))
+
+		By("test the unknown step type is a warning if it's skipped or pending")
+		for policy, warning := range map[string]string{
+			"Skip":    "the step type not-found is not found, the step will be skipped",
+			"Pending": "the step type not-found is not found, the step will be pending until the type is registered",
+		} {
+			req = admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+					Object: runtime.RawExtension{
+						Raw: []byte(fmt.Sprintf(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-sample","namespace":"default"},"spec":{"unknownStepTypePolicy":"%s","workflowSpec":{"steps":[{"name":"step1","type":"not-found"}]}}}`, policy)),
+					},
+				},
+			}
+			resp = handler.Handle(ctx, req)
+			Expect(resp.Allowed).Should(BeTrue())
+			Expect(resp.Warnings).Should(Equal([]string{warning}))
+		}
+	})
+
+	It("Test WorkflowRun Validator workflow parameters", func() {
+		workflow := &v1alpha1.Workflow{
+			ObjectMeta: metav1.ObjectMeta{Name: "parameterized", Namespace: "default"},
+			Parameters: []v1alpha1.WorkflowParameter{
+				{Name: "env", Type: v1alpha1.ParameterTypeString, Required: true, Enum: []apiextensionsv1.JSON{{Raw: []byte(`"dev"`)}, {Raw: []byte(`"prod"`)}}},
+				{Name: "replicas", Type: v1alpha1.ParameterTypeInteger, Default: &apiextensionsv1.JSON{Raw: []byte(`1`)}, Maximum: pointer.Int64(10)},
+				{Name: "approver", Type: v1alpha1.ParameterTypeString, Required: true, If: `context.env == "prod"`},
+			},
+			WorkflowSpec: v1alpha1.WorkflowSpec{Steps: []v1alpha1.WorkflowStep{{WorkflowStepBase: v1alpha1.WorkflowStepBase{Name: "step1", Type: "suspend"}}}},
+		}
+		Expect(k8sClient.Create(ctx, workflow)).Should(Succeed())
+		request := func(context string) admission.Request {
+			return admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+					Object: runtime.RawExtension{
+						Raw: []byte(fmt.Sprintf(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-parameters","namespace":"default"},"spec":{"workflowRef":"parameterized","context":%s}}`, context)),
+					},
+				},
+			}
+		}
+		resp := handler.Handle(ctx, request(`{"env":"dev"}`))
+		Expect(resp.Allowed).Should(BeTrue())
+
+		By("test the invalid parameters are rejected with the paths of the parameters")
+		resp = handler.Handle(ctx, request(`{"env":"prod","replicas":20}`))
+		Expect(resp.Allowed).Should(BeFalse())
+		var causes []string
+		for _, cause := range resp.Result.Details.Causes {
+			causes = append(causes, fmt.Sprintf("%s %s", cause.Type, cause.Field))
+		}
+		Expect(causes).Should(ConsistOf(
+			"FieldValueInvalid spec.context.replicas",
+			"FieldValueRequired spec.context.approver",
+		))
+
+		By("test the defaults are applied by the mutating webhook")
+		mutatingHandler := &MutatingHandler{}
+		Expect(mutatingHandler.InjectClient(k8sClient)).Should(BeNil())
+		Expect(mutatingHandler.InjectDecoder(decoder)).Should(BeNil())
+		resp = mutatingHandler.Handle(ctx, request(`{"env":"dev"}`))
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Patches).Should(ContainElement(jsonpatch.JsonPatchOperation{
+			Operation: "add",
+			Path:      "/spec/context/replicas",
+			Value:     float64(1),
+		}))
+	})
+
+	It("Test WorkflowRun Validator stages", func() {
+		workflow := &v1alpha1.Workflow{
+			ObjectMeta: metav1.ObjectMeta{Name: "stage-build", Namespace: "default"},
+			WorkflowSpec: v1alpha1.WorkflowSpec{Steps: []v1alpha1.WorkflowStep{{WorkflowStepBase: v1alpha1.WorkflowStepBase{
+				Name:    "step1",
+				Type:    "suspend",
+				Outputs: v1alpha1.StepOutputs{{Name: "image", ValueFrom: "context.name"}},
+			}}}},
+		}
+		Expect(k8sClient.Create(ctx, workflow)).Should(Succeed())
+		validate := func(spec string) admission.Response {
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+					Object: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-stages","namespace":"default"},"spec":` + spec + `}`),
+					},
+				},
+			}
+			return handler.Handle(ctx, req)
+		}
+		By("test valid stages")
+		resp := validate(`{"stages":[{"name":"build","workflowRef":"stage-build","outputs":["image"]},{"name":"deploy","workflowRef":"stage-build"}]}`)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(BeEmpty())
+
+		By("test the undeclared output is warned")
+		resp = validate(`{"stages":[{"name":"build","workflowRef":"stage-build","outputs":["digest"]}]}`)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(ContainElement("the output digest of the stage build is not declared by the steps of the workflow stage-build"))
+
+		By("test invalid stages")
+		resp = validate(`{"workflowRef":"stage-build","stages":[{"name":"build","workflowRef":"stage-build"},{"name":"build","workflowRef":"not-found"},{"name":"Deploy","workflowRef":"stage-build"}]}`)
+		Expect(resp.Allowed).Should(BeFalse())
+		var causes []string
+		for _, cause := range resp.Result.Details.Causes {
+			causes = append(causes, fmt.Sprintf("%s %s", cause.Type, cause.Field))
+		}
+		Expect(causes).Should(ConsistOf(
+			"FieldValueForbidden spec.workflowRef",
+			"FieldValueDuplicate spec.stages[1].name",
+			"FieldValueInvalid spec.stages[1].workflowRef",
+			"FieldValueInvalid spec.stages[2].name",
+		))
+
+		By("test the name of the stage run is too long")
+		long := strings.Repeat("w", 200)
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"` + long + `","namespace":"default"},"spec":{"stages":[{"name":"build","workflowRef":"stage-build"},{"name":"` + strings.Repeat("d", 40) + `","workflowRef":"stage-build"}]}}`),
+				},
+			},
+		}
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeFalse())
+		Expect(resp.Result.Details.Causes).Should(HaveLen(1))
+		Expect(resp.Result.Details.Causes[0].Field).Should(Equal("spec.stages[1].name"))
+		Expect(resp.Result.Message).Should(ContainSubstring("must be no more than 236 characters"))
+	})
+
+	It("Test WorkflowRun Validator dry run plan", func() {
+		dryRun := true
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				DryRun:    &dryRun,
+				Resource:  metav1.GroupVersionResource{Group: "core.oam.dev", Version: "v1alpha1", Resource: "workflowruns"},
+				Object: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"core.oam.dev/v1alpha1","kind":"WorkflowRun","metadata":{"name":"wr-plan","namespace":"default"},"spec":{"context":{"password":"secret"},"workflowSpec":{"steps":[{"name":"step1","type":"suspend"},{"name":"step2","type":"suspend","properties":{"duration":"3s"}}]}}}`),
+				},
+			},
+		}
+		resp := handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(Equal([]string{
+			"WorkflowRun default/wr-plan (mode: StepByStep, sub steps mode: DAG)",
+			"├── [1] step1 (suspend)",
+			"└── [2] step2 (suspend)",
+		}))
+
+		By("test the plan is not returned without dry run")
+		req.DryRun = nil
+		resp = handler.Handle(ctx, req)
+		Expect(resp.Allowed).Should(BeTrue())
+		Expect(resp.Warnings).Should(BeEmpty())
+	})
 })
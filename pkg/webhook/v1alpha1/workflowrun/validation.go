@@ -19,62 +19,678 @@ package workflowrun
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/kubevela/workflow/api/v1alpha1"
+	"github.com/kubevela/workflow/pkg/hooks"
+	providertypes "github.com/kubevela/workflow/pkg/providers/types"
+	"github.com/kubevela/workflow/pkg/tasks"
+	"github.com/kubevela/workflow/pkg/types"
+	"github.com/kubevela/workflow/pkg/utils"
+	"github.com/kubevela/workflow/pkg/watcher"
 )
 
-// ValidateWorkflow validates the Application workflow
-func (h *ValidatingHandler) ValidateWorkflow(ctx context.Context, wr *v1alpha1.WorkflowRun) field.ErrorList {
+// workflowStepDefinitionGVK is the kind of the definitions of the custom step types
+var workflowStepDefinitionGVK = schema.GroupVersionKind{Group: "core.oam.dev", Version: "v1beta1", Kind: "WorkflowStepDefinition"}
+
+// ValidateWorkflow validates the Application workflow, the warnings are the issues that don't reject the workflow.
+// All the issues are accumulated with the paths of the fields, so that they can be fixed at once.
+func (h *ValidatingHandler) ValidateWorkflow(ctx context.Context, wr *v1alpha1.WorkflowRun) (field.ErrorList, []string) {
 	var errs field.ErrorList
-	var steps []v1alpha1.WorkflowStep
+	var warnings []string
+	if len(wr.Spec.Stages) > 0 {
+		errs, warnings = h.ValidateStages(ctx, wr)
+		if wr.Spec.CompletionWebhook != nil {
+			errs = append(errs, h.ValidateCompletionWebhook(wr.Spec.CompletionWebhook)...)
+		}
+		return errs, warnings
+	}
+	var spec v1alpha1.WorkflowSpec
+	specPath := field.NewPath("spec", "workflowSpec")
 	if wr.Spec.WorkflowSpec != nil {
-		steps = wr.Spec.WorkflowSpec.Steps
+		spec = *wr.Spec.WorkflowSpec
 	} else {
 		w := &v1alpha1.Workflow{}
 		if err := h.Client.Get(ctx, client.ObjectKey{Namespace: wr.Namespace, Name: wr.Spec.WorkflowRef}, w); err != nil {
 			errs = append(errs, field.Invalid(field.NewPath("spec", "workflowRef"), wr.Spec.WorkflowRef, fmt.Sprintf("failed to get workflow ref: %v", err)))
-			return errs
+			return errs, nil
 		}
-		steps = w.Steps
+		spec = w.WorkflowSpec
+		// the steps are inlined at the top level of the referenced workflow
+		specPath = nil
+		errs = append(errs, h.ValidateParameters(wr, w.Parameters)...)
 	}
+	lists := []struct {
+		path  *field.Path
+		steps []v1alpha1.WorkflowStep
+	}{
+		{path: specPath.Child("steps"), steps: spec.Steps},
+		{path: specPath.Child("onComplete"), steps: spec.OnComplete},
+		{path: specPath.Child("onSuccess"), steps: spec.OnSuccess},
+		{path: specPath.Child("onFailure"), steps: spec.OnFailure},
+	}
+	// the names of the finalizer steps must be unique among the main steps as well
 	stepName := make(map[string]interface{})
-	for _, step := range steps {
-		if step.Name == "" {
-			errs = append(errs, field.Invalid(field.NewPath("spec", "workflowSpec", "steps", "name"), step.Name, "empty step name"))
+	checkName := func(path *field.Path, name string) {
+		if name == "" {
+			errs = append(errs, field.Required(path.Child("name"), "empty step name"))
 		}
-		if _, ok := stepName[step.Name]; ok {
-			errs = append(errs, field.Invalid(field.NewPath("spec", "workflowSpec", "steps"), step.Name, "duplicated step name"))
+		if _, ok := stepName[name]; ok {
+			errs = append(errs, field.Duplicate(path.Child("name"), name))
 		}
-		stepName[step.Name] = nil
+		stepName[name] = nil
+	}
+	checkStep := func(path *field.Path, step v1alpha1.WorkflowStepBase) {
+		stepTypeErrs, stepTypeWarnings := h.ValidateStepType(ctx, path.Child("type"), wr.Namespace, step.Type, wr.Spec.UnknownStepTypePolicy)
+		errs = append(errs, stepTypeErrs...)
+		warnings = append(warnings, stepTypeWarnings...)
 		if step.Timeout != "" {
-			errs = append(errs, h.ValidateTimeout(step.Name, step.Timeout)...)
+			errs = append(errs, h.ValidateTimeout(path.Child("timeout"), step.Timeout)...)
+		}
+		if step.OperationTimeout != "" {
+			errs = append(errs, h.ValidateOperationTimeout(path.Child("operationTimeout"), step)...)
 		}
-		for _, sub := range step.SubSteps {
-			if sub.Name == "" {
-				errs = append(errs, field.Invalid(field.NewPath("spec", "workflowSpec", "steps", "subSteps", "name"), sub.Name, "empty step name"))
+		if step.ExecutionWindow != nil {
+			errs = append(errs, h.ValidateExecutionWindow(path.Child("executionWindow"), step.ExecutionWindow)...)
+		}
+		if step.ServiceAccount != "" {
+			errs = append(errs, h.ValidateServiceAccount(ctx, path.Child("serviceAccount"), wr.Namespace, step)...)
+		}
+		if len(step.ApprovalGates) > 0 {
+			errs = append(errs, h.ValidateApprovalGates(path.Child("approvalGates"), step)...)
+		}
+		if step.DetectChanges {
+			if len(step.Outputs) == 0 {
+				errs = append(errs, field.Invalid(path.Child("detectChanges"), step.DetectChanges, "detectChanges requires the outputs of the step"))
+			} else if wr.Spec.WorkflowRef == "" {
+				warnings = append(warnings, fmt.Sprintf("step %s detects the changes of its outputs, but the run doesn't refer to a workflow, so the outputs are always changed", step.Name))
+			}
+		}
+	}
+	for _, list := range lists {
+		for i, step := range list.steps {
+			path := list.path.Index(i)
+			checkName(path, step.Name)
+			checkStep(path, step.WorkflowStepBase)
+			if step.Periodic != nil {
+				errs = append(errs, h.ValidatePeriodic(path, step)...)
 			}
-			if _, ok := stepName[sub.Name]; ok {
-				errs = append(errs, field.Invalid(field.NewPath("spec", "workflowSpec", "steps", "subSteps"), sub.Name, "duplicated step name"))
+			for j, sub := range step.SubSteps {
+				subPath := path.Child("subSteps").Index(j)
+				checkName(subPath, sub.Name)
+				checkStep(subPath, sub)
+				if sub.Lock != "" && step.Lock != "" {
+					// the lock of the step group is held until the sub steps are finished, so a sub step waiting for
+					// another lock would hold two locks at once, which can deadlock with the other locked groups
+					errs = append(errs, field.Invalid(subPath.Child("lock"), sub.Lock, fmt.Sprintf("sub step %s can't declare a lock in the locked step group %s", sub.Name, step.Name)))
+				}
 			}
-			stepName[sub.Name] = nil
-			if step.Timeout != "" {
-				errs = append(errs, h.ValidateTimeout(step.Name, step.Timeout)...)
+			if len(step.SubSteps) > 0 {
+				errs = append(errs, h.ValidateDependencies(path.Child("subSteps"), step.SubSteps)...)
 			}
+			if step.SubStepsTimeout != "" {
+				errs = append(errs, h.ValidateSubStepsTimeout(path, step)...)
+			}
+			if step.Switch != nil {
+				switchErrs, switchWarnings := h.ValidateSwitch(path, step)
+				errs = append(errs, switchErrs...)
+				warnings = append(warnings, switchWarnings...)
+			}
+			if step.Atomic && step.Type != types.WorkflowStepTypeStepGroup {
+				errs = append(errs, field.Invalid(path.Child("atomic"), step.Atomic, "atomic can only be set in step group"))
+			}
+			if step.Generator != nil {
+				errs = append(errs, h.ValidateGenerator(path, step)...)
+				if templateType := step.Generator.Template.Type; templateType != "" {
+					stepTypeErrs, stepTypeWarnings := h.ValidateStepType(ctx, path.Child("generator", "template", "type"), wr.Namespace, templateType, wr.Spec.UnknownStepTypePolicy)
+					errs = append(errs, stepTypeErrs...)
+					warnings = append(warnings, stepTypeWarnings...)
+				}
+			}
+		}
+		var steps []v1alpha1.WorkflowStepBase
+		for _, step := range list.steps {
+			steps = append(steps, step.WorkflowStepBase)
+		}
+		errs = append(errs, h.ValidateDependencies(list.path, steps)...)
+	}
+	outputs := map[string]bool{}
+	for _, list := range lists {
+		for _, step := range list.steps {
+			for _, output := range step.Outputs {
+				outputs[output.Name] = true
+			}
+			// the aggregated outputs of the sub steps are set under the name of the step group
+			if len(step.SubSteps) > 0 || step.Generator != nil {
+				outputs[step.Name] = true
+			}
+			for _, sub := range step.SubSteps {
+				for _, output := range sub.Outputs {
+					outputs[output.Name] = true
+				}
+			}
+		}
+	}
+	sharedErrs, shared := h.ValidateSharedInputs(wr.Spec.Shared, outputs)
+	errs = append(errs, sharedErrs...)
+	for _, list := range lists {
+		for i, step := range list.steps {
+			path := list.path.Index(i)
+			refErrs, refWarnings := h.ValidateReferences(path, step.WorkflowStepBase, outputs, shared)
+			errs = append(errs, refErrs...)
+			warnings = append(warnings, refWarnings...)
+			if step.DependsOnCondition != nil {
+				errs = append(errs, h.ValidateDependsOnCondition(path.Child("dependsOnCondition"), step.DependsOnCondition, stepName)...)
+			}
+			for j, sub := range step.SubSteps {
+				subPath := path.Child("subSteps").Index(j)
+				refErrs, refWarnings := h.ValidateReferences(subPath, sub, outputs, shared)
+				errs = append(errs, refErrs...)
+				warnings = append(warnings, refWarnings...)
+				if sub.DependsOnCondition != nil {
+					errs = append(errs, h.ValidateDependsOnCondition(subPath.Child("dependsOnCondition"), sub.DependsOnCondition, stepName)...)
+				}
+			}
+		}
+	}
+	errs = append(errs, h.ValidateWatchers(wr.Spec.Watchers)...)
+	if wr.Spec.CompletionWebhook != nil {
+		errs = append(errs, h.ValidateCompletionWebhook(wr.Spec.CompletionWebhook)...)
+	}
+	return errs, warnings
+}
+
+// ValidateParameters validates the parameters of the referenced workflow in the context of the run, the defaults
+// are applied to a copy of the run since they're set by the mutating webhook
+func (h *ValidatingHandler) ValidateParameters(wr *v1alpha1.WorkflowRun, params []v1alpha1.WorkflowParameter) field.ErrorList {
+	errs, err := utils.ApplyRunParameters(wr.DeepCopy(), params)
+	if err != nil {
+		return field.ErrorList{field.Invalid(field.NewPath("spec", "context"), string(wr.Spec.Context.Raw), err.Error())}
+	}
+	return errs
+}
+
+// ValidateStages validates the stages of the run, every stage refers to an existing workflow whose parameters are
+// satisfied by the context of the run. The outputs handed off by a stage are expected to be declared by the steps of
+// its workflow, it's warned otherwise since they can be set by the init vars as well.
+func (h *ValidatingHandler) ValidateStages(ctx context.Context, wr *v1alpha1.WorkflowRun) (field.ErrorList, []string) {
+	var errs field.ErrorList
+	var warnings []string
+	// the run with stages has no steps of its own
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{name: "workflowSpec", set: wr.Spec.WorkflowSpec != nil},
+		{name: "workflowRef", set: wr.Spec.WorkflowRef != ""},
+		{name: "shared", set: len(wr.Spec.Shared) > 0},
+		{name: "watchers", set: len(wr.Spec.Watchers) > 0},
+	} {
+		if f.set {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", f.name), fmt.Sprintf("%s can't be set with the stages", f.name)))
+		}
+	}
+	names := make(map[string]bool)
+	for i, stage := range wr.Spec.Stages {
+		path := field.NewPath("spec", "stages").Index(i)
+		switch {
+		case stage.Name == "":
+			errs = append(errs, field.Required(path.Child("name"), "empty stage name"))
+		case names[stage.Name]:
+			errs = append(errs, field.Duplicate(path.Child("name"), stage.Name))
+		default:
+			// the stage is run as a WorkflowRun named after the run and the stage
+			msgs := validation.IsDNS1123Label(stage.Name)
+			if len(msgs) == 0 {
+				msgs = utils.ValidateStageRunName(utils.StageRunName(wr.Name, stage.Name))
+			}
+			for _, msg := range msgs {
+				errs = append(errs, field.Invalid(path.Child("name"), stage.Name, msg))
+			}
+		}
+		names[stage.Name] = true
+		if stage.WorkflowRef == "" {
+			errs = append(errs, field.Required(path.Child("workflowRef"), "the workflow of the stage can not be empty"))
+			continue
+		}
+		w := &v1alpha1.Workflow{}
+		if err := h.Client.Get(ctx, client.ObjectKey{Namespace: wr.Namespace, Name: stage.WorkflowRef}, w); err != nil {
+			errs = append(errs, field.Invalid(path.Child("workflowRef"), stage.WorkflowRef, fmt.Sprintf("failed to get workflow ref: %v", err)))
+			continue
+		}
+		errs = append(errs, h.ValidateParameters(wr, w.Parameters)...)
+		declared := make(map[string]bool)
+		for _, steps := range [][]v1alpha1.WorkflowStep{w.Steps, w.OnComplete, w.OnSuccess, w.OnFailure} {
+			for _, step := range steps {
+				for _, output := range step.Outputs {
+					declared[output.Name] = true
+				}
+				for _, sub := range step.SubSteps {
+					for _, output := range sub.Outputs {
+						declared[output.Name] = true
+					}
+				}
+			}
+		}
+		for j, output := range stage.Outputs {
+			if output == "" {
+				errs = append(errs, field.Required(path.Child("outputs").Index(j), "empty output name"))
+				continue
+			}
+			if !declared[output] {
+				warnings = append(warnings, fmt.Sprintf("the output %s of the stage %s is not declared by the steps of the workflow %s", output, stage.Name, stage.WorkflowRef))
+			}
+		}
+	}
+	return errs, warnings
+}
+
+// ValidateStepType validates that the type of the step is built in or defined by the WorkflowStepDefinition in the
+// namespace of the run or the system namespace. The type rendered by the string interpolation can't be checked.
+// The unknown type is only a warning if the run skips the step or keeps it pending by the unknownStepTypePolicy, since
+// the definition may be registered after the run is created.
+func (h *ValidatingHandler) ValidateStepType(ctx context.Context, path *field.Path, namespace, stepType string, policy v1alpha1.UnknownStepTypePolicy) (field.ErrorList, []string) {
+	if stepType == "" {
+		return field.ErrorList{field.Required(path, "empty step type")}, nil
+	}
+	if strings.Contains(stepType, interpolationMarker) {
+		return nil, nil
+	}
+	for _, info := range tasks.ListStepTypes() {
+		if info.Name == stepType {
+			return nil, nil
+		}
+	}
+	namespaces := []string{namespace}
+	if h.SystemDefinitionNamespace != "" && h.SystemDefinitionNamespace != namespace {
+		namespaces = append(namespaces, h.SystemDefinitionNamespace)
+	}
+	for _, ns := range namespaces {
+		definition := &unstructured.Unstructured{}
+		definition.SetGroupVersionKind(workflowStepDefinitionGVK)
+		err := h.Client.Get(ctx, client.ObjectKey{Namespace: ns, Name: stepType}, definition)
+		if err == nil {
+			return nil, nil
+		}
+		if !kerrors.IsNotFound(err) {
+			// the definitions may not be installed, e.g. the CRD is missing, so the type is not rejected
+			return nil, []string{fmt.Sprintf("the step type %s can't be checked: %s", stepType, err.Error())}
+		}
+	}
+	switch policy {
+	case v1alpha1.UnknownStepTypePolicySkip:
+		return nil, []string{fmt.Sprintf("the step type %s is not found, the step will be skipped", stepType)}
+	case v1alpha1.UnknownStepTypePolicyPending:
+		return nil, []string{fmt.Sprintf("the step type %s is not found, the step will be pending until the type is registered", stepType)}
+	default:
+		return field.ErrorList{field.NotFound(path, stepType)}, nil
+	}
+}
+
+// ValidateDependencies validates that the dependencies of the steps declared by dependsOn and dependsOnCondition
+// don't form a cycle, the steps would never be executed otherwise
+func (h *ValidatingHandler) ValidateDependencies(path *field.Path, steps []v1alpha1.WorkflowStepBase) field.ErrorList {
+	var errs field.ErrorList
+	index := make(map[string]int)
+	for i, step := range steps {
+		// the duplicated names are rejected separately
+		if _, ok := index[step.Name]; !ok {
+			index[step.Name] = i
+		}
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make([]int, len(steps))
+	var stack []string
+	var visit func(i int)
+	visit = func(i int) {
+		states[i] = visiting
+		stack = append(stack, steps[i].Name)
+		for _, dep := range dependenciesOf(steps[i]) {
+			j, ok := index[dep]
+			if !ok {
+				continue
+			}
+			switch states[j] {
+			case unvisited:
+				visit(j)
+			case visiting:
+				var cycle []string
+				for k := len(stack) - 1; k >= 0; k-- {
+					if stack[k] == dep {
+						cycle = append(append(cycle, stack[k:]...), dep)
+						break
+					}
+				}
+				errs = append(errs, field.Invalid(path.Index(i).Child("dependsOn"), dep, fmt.Sprintf("dependency cycle %s", strings.Join(cycle, " -> "))))
+			}
+		}
+		stack = stack[:len(stack)-1]
+		states[i] = visited
+	}
+	for i := range steps {
+		if states[i] == unvisited {
+			visit(i)
+		}
+	}
+	return errs
+}
+
+// dependenciesOf returns the names of the steps that the step depends on
+func dependenciesOf(step v1alpha1.WorkflowStepBase) []string {
+	deps := append([]string{}, step.DependsOn...)
+	var walk func(condition *v1alpha1.DependsOnCondition)
+	walk = func(condition *v1alpha1.DependsOnCondition) {
+		if condition == nil {
+			return
+		}
+		if condition.Step != "" {
+			deps = append(deps, condition.Step)
+		}
+		for i := range condition.AllOf {
+			walk(&condition.AllOf[i])
+		}
+		for i := range condition.AnyOf {
+			walk(&condition.AnyOf[i])
+		}
+	}
+	walk(step.DependsOnCondition)
+	return deps
+}
+
+// ValidateSharedInputs validates the names and the sources of the shared inputs of the run, it returns the names of
+// the valid shared inputs. The steps can't declare the output named as the shared inputs since they're read from it.
+func (h *ValidatingHandler) ValidateSharedInputs(inputs []v1alpha1.SharedInput, outputs map[string]bool) (field.ErrorList, map[string]bool) {
+	var errs field.ErrorList
+	names := make(map[string]bool)
+	for i, input := range inputs {
+		path := field.NewPath("spec", "shared").Index(i)
+		switch {
+		case input.Name == "":
+			errs = append(errs, field.Required(path.Child("name"), "empty shared input name"))
+		case strings.Contains(input.Name, "."):
+			errs = append(errs, field.Invalid(path.Child("name"), input.Name, "the name of the shared input can't contain dots"))
+		case names[input.Name]:
+			errs = append(errs, field.Duplicate(path.Child("name"), input.Name))
+		}
+		names[input.Name] = true
+		if input.ConfigMapRef == nil || input.ConfigMapRef.Name == "" {
+			errs = append(errs, field.Required(path.Child("configMapRef"), "the config map to read the shared input from can not be empty"))
+		}
+	}
+	if len(inputs) > 0 && outputs[hooks.SharedInputsKey] {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "shared"), hooks.SharedInputsKey, fmt.Sprintf("the output %s of the steps conflicts with the shared inputs", hooks.SharedInputsKey)))
+	}
+	return errs, names
+}
+
+// ValidateCompletionWebhook validates the url, secret and attempts of the completion webhook
+func (h *ValidatingHandler) ValidateCompletionWebhook(webhook *v1alpha1.CompletionWebhook) field.ErrorList {
+	var errs field.ErrorList
+	path := field.NewPath("spec", "completionWebhook")
+	if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, field.Invalid(path.Child("url"), webhook.URL, "invalid url, please use the http or https url"))
+	}
+	if ref := webhook.SecretRef; ref != nil && (ref.Name == "" || ref.Key == "") {
+		errs = append(errs, field.Invalid(path.Child("secretRef"), ref, "the name and key of the secret can not be empty"))
+	}
+	if webhook.MaxAttempts < 0 {
+		errs = append(errs, field.Invalid(path.Child("maxAttempts"), webhook.MaxAttempts, "maxAttempts can not be negative"))
+	}
+	return errs
+}
+
+// ValidateWatchers validates the names, types and intervals of the watchers of the run
+func (h *ValidatingHandler) ValidateWatchers(watchers []v1alpha1.RunWatcher) field.ErrorList {
+	var errs field.ErrorList
+	names := make(map[string]bool)
+	for i, w := range watchers {
+		path := field.NewPath("spec", "watchers").Index(i)
+		switch {
+		case w.Name == "":
+			errs = append(errs, field.Required(path.Child("name"), "empty watcher name"))
+		case names[w.Name]:
+			errs = append(errs, field.Duplicate(path.Child("name"), w.Name))
+		}
+		names[w.Name] = true
+		if _, err := watcher.GetChecker(w.Type); err != nil {
+			errs = append(errs, field.Invalid(path.Child("type"), w.Type, err.Error()))
+		}
+		if w.Interval != "" {
+			if interval, err := time.ParseDuration(w.Interval); err != nil || interval <= 0 {
+				errs = append(errs, field.Invalid(path.Child("interval"), w.Interval, "invalid interval, please use the format of interval like 30s, 1m or 1h"))
+			}
+		}
+		if w.Threshold < 0 {
+			errs = append(errs, field.Invalid(path.Child("threshold"), w.Threshold, "threshold can not be negative"))
+		}
+	}
+	return errs
+}
+
+// ValidateDependsOnCondition validates the structure of the grouped dependency of steps
+func (h *ValidatingHandler) ValidateDependsOnCondition(path *field.Path, condition *v1alpha1.DependsOnCondition, stepName map[string]interface{}) field.ErrorList {
+	var errs field.ErrorList
+	set := 0
+	if condition.Step != "" {
+		set++
+		if _, ok := stepName[condition.Step]; !ok {
+			errs = append(errs, field.Invalid(path.Child("step"), condition.Step, "step not found"))
+		}
+	}
+	if condition.AllOf != nil {
+		set++
+		if len(condition.AllOf) == 0 {
+			errs = append(errs, field.Invalid(path.Child("allOf"), condition.AllOf, "empty condition group"))
+		}
+		for i := range condition.AllOf {
+			errs = append(errs, h.ValidateDependsOnCondition(path.Child("allOf").Index(i), &condition.AllOf[i], stepName)...)
+		}
+	}
+	if condition.AnyOf != nil {
+		set++
+		if len(condition.AnyOf) == 0 {
+			errs = append(errs, field.Invalid(path.Child("anyOf"), condition.AnyOf, "empty condition group"))
+		}
+		for i := range condition.AnyOf {
+			errs = append(errs, h.ValidateDependsOnCondition(path.Child("anyOf").Index(i), &condition.AnyOf[i], stepName)...)
+		}
+	}
+	if set != 1 {
+		errs = append(errs, field.Invalid(path, condition, "only one of step, allOf and anyOf can be set"))
+	}
+	if condition.IgnoreFailure && condition.Step == "" {
+		errs = append(errs, field.Invalid(path.Child("ignoreFailure"), condition.IgnoreFailure, "ignoreFailure can only be set with step"))
+	}
+	return errs
+}
+
+// ValidatePeriodic validates the periodic execution of the step in the path
+func (h *ValidatingHandler) ValidatePeriodic(path *field.Path, step v1alpha1.WorkflowStep) field.ErrorList {
+	var errs field.ErrorList
+	if interval, err := time.ParseDuration(step.Periodic.Interval); err != nil || interval <= 0 {
+		errs = append(errs, field.Invalid(path.Child("periodic", "interval"), step.Periodic.Interval, "invalid interval, please use the format of interval like 30s, 1m or 1h"))
+	}
+	if step.Timeout != "" {
+		errs = append(errs, field.Invalid(path.Child("timeout"), step.Timeout, "periodic step can not set timeout"))
+	}
+	return errs
+}
+
+// ValidateSubStepsTimeout validates the timeout of sub steps in the step group in the path
+func (h *ValidatingHandler) ValidateSubStepsTimeout(path *field.Path, step v1alpha1.WorkflowStep) field.ErrorList {
+	var errs field.ErrorList
+	path = path.Child("subStepsTimeout")
+	if step.Type != types.WorkflowStepTypeStepGroup {
+		errs = append(errs, field.Invalid(path, step.SubStepsTimeout, "sub steps timeout can only be set in step group"))
+	}
+	if _, err := time.ParseDuration(step.SubStepsTimeout); err != nil {
+		errs = append(errs, field.Invalid(path, step.SubStepsTimeout, "invalid timeout, please use the format of timeout like 1s, 1m, 1h or 1d"))
+	}
+	return errs
+}
+
+// ValidateGenerator validates the generator of the step group in the path
+func (h *ValidatingHandler) ValidateGenerator(path *field.Path, step v1alpha1.WorkflowStep) field.ErrorList {
+	var errs field.ErrorList
+	path = path.Child("generator")
+	if step.Type != types.WorkflowStepTypeStepGroup {
+		errs = append(errs, field.Invalid(path, step.Name, "generator can only be set in step group"))
+	}
+	if len(step.SubSteps) > 0 {
+		errs = append(errs, field.Invalid(path, step.Name, "generator can not be set in step group with sub steps"))
+	}
+	if step.Generator.From == "" {
+		errs = append(errs, field.Required(path.Child("from"), "the output array to generate the sub steps from can not be empty"))
+	}
+	if step.Generator.Template.Name == "" || step.Generator.Template.Type == "" {
+		errs = append(errs, field.Required(path.Child("template"), "the name and type of the template can not be empty"))
+	}
+	if step.Generator.Template.Type == types.WorkflowStepTypeStepGroup {
+		errs = append(errs, field.Invalid(path.Child("template", "type"), step.Generator.Template.Type, "the generated sub steps can not be step groups"))
+	}
+	if step.Generator.Template.Lock != "" && step.Lock != "" {
+		errs = append(errs, field.Invalid(path.Child("template", "lock"), step.Generator.Template.Lock, fmt.Sprintf("the generated sub steps can't declare a lock in the locked step group %s", step.Name)))
+	}
+	if tolerance := step.Generator.Tolerance; tolerance != nil {
+		v, err := intstr.GetScaledValueFromIntOrPercent(tolerance, 100, false)
+		switch {
+		case err != nil:
+			errs = append(errs, field.Invalid(path.Child("tolerance"), tolerance.String(), err.Error()))
+		case v < 0 || (tolerance.Type == intstr.String && v > 100):
+			errs = append(errs, field.Invalid(path.Child("tolerance"), tolerance.String(), "tolerance must be a non-negative number or a percentage between 0% and 100%"))
+		}
+	}
+	return errs
+}
+
+// ValidateSwitch validates the switch of the step group in the path, every sub step must be in a case or the default.
+// It warns if there's no default since the group fails once no case matches the value.
+func (h *ValidatingHandler) ValidateSwitch(path *field.Path, step v1alpha1.WorkflowStep) (field.ErrorList, []string) {
+	var errs field.ErrorList
+	var warnings []string
+	path = path.Child("switch")
+	if step.Type != types.WorkflowStepTypeStepGroup {
+		errs = append(errs, field.Invalid(path, step.Name, "switch can only be set in step group"))
+	}
+	if len(step.SubSteps) == 0 {
+		errs = append(errs, field.Invalid(path, step.Name, "switch can only be set in step group with sub steps"))
+	}
+	if step.Switch.Value == "" {
+		errs = append(errs, field.Required(path.Child("value"), "the value to select the case by can not be empty"))
+	}
+	subSteps := make(map[string]bool)
+	for _, sub := range step.SubSteps {
+		subSteps[sub.Name] = false
+	}
+	checkSteps := func(path *field.Path, names []string) {
+		for _, name := range names {
+			if _, ok := subSteps[name]; !ok {
+				errs = append(errs, field.Invalid(path, name, fmt.Sprintf("%s is not a sub step of step group %s", name, step.Name)))
+				continue
+			}
+			subSteps[name] = true
+		}
+	}
+	values := make(map[string]bool)
+	for i, c := range step.Switch.Cases {
+		if values[c.Value] {
+			errs = append(errs, field.Duplicate(path.Child("cases").Index(i).Child("value"), c.Value))
+		}
+		values[c.Value] = true
+		checkSteps(path.Child("cases").Index(i).Child("steps"), c.Steps)
+	}
+	checkSteps(path.Child("default"), step.Switch.Default)
+	for _, sub := range step.SubSteps {
+		if !subSteps[sub.Name] {
+			errs = append(errs, field.Invalid(path, sub.Name, fmt.Sprintf("sub step %s is not in any case or the default", sub.Name)))
+		}
+	}
+	if step.Switch.Default == nil {
+		warnings = append(warnings, fmt.Sprintf("step %s: the switch has no default, the step group fails if no case matches the value", step.Name))
+	}
+	return errs, warnings
+}
+
+// ValidateServiceAccount validates the service account of the step and whether the controller is allowed to impersonate it
+func (h *ValidatingHandler) ValidateServiceAccount(ctx context.Context, path *field.Path, namespace string, step v1alpha1.WorkflowStepBase) field.ErrorList {
+	var errs field.ErrorList
+	if msgs := validation.IsDNS1123Subdomain(step.ServiceAccount); len(msgs) > 0 {
+		errs = append(errs, field.Invalid(path, step.ServiceAccount, strings.Join(msgs, ", ")))
+		return errs
+	}
+	if err := providertypes.CheckImpersonatePermission(ctx, h.Client, namespace, step.ServiceAccount); err != nil {
+		errs = append(errs, field.Forbidden(path, fmt.Sprintf("step %s: %s", step.Name, err.Error())))
+	}
+	return errs
+}
+
+// ValidateOperationTimeout validates the operation timeout of the step, it should be shorter than the step timeout
+// so that the timed out execution can be retried
+func (h *ValidatingHandler) ValidateOperationTimeout(path *field.Path, step v1alpha1.WorkflowStepBase) field.ErrorList {
+	timeout, err := time.ParseDuration(step.OperationTimeout)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, step.OperationTimeout, "invalid timeout, please use the format of timeout like 1s, 1m, 1h or 1d")}
+	}
+	if stepTimeout, err := time.ParseDuration(step.Timeout); err == nil && timeout >= stepTimeout {
+		return field.ErrorList{field.Invalid(path, step.OperationTimeout, fmt.Sprintf("operation timeout must be shorter than the step timeout %s", step.Timeout))}
+	}
+	return nil
+}
+
+// ValidateExecutionWindow validates the time zone and the time ranges of the execution window of the step
+func (h *ValidatingHandler) ValidateExecutionWindow(path *field.Path, window *v1alpha1.ExecutionWindow) field.ErrorList {
+	if _, err := types.InExecutionWindow(window, time.Time{}); err != nil {
+		return field.ErrorList{field.Invalid(path, types.FormatExecutionWindow(window), err.Error())}
+	}
+	return nil
+}
+
+// ValidateApprovalGates validates that the approval gates are set in the suspend step with the unique names, and
+// their quorums can be reached by their approvers
+func (h *ValidatingHandler) ValidateApprovalGates(path *field.Path, step v1alpha1.WorkflowStepBase) field.ErrorList {
+	if step.Type != types.WorkflowStepTypeSuspend {
+		return field.ErrorList{field.Invalid(path, len(step.ApprovalGates), "approval gates can only be set in suspend step")}
+	}
+	var errs field.ErrorList
+	names := make(map[string]bool)
+	for i, gate := range step.ApprovalGates {
+		gatePath := path.Index(i)
+		switch {
+		case gate.Name == "":
+			errs = append(errs, field.Required(gatePath.Child("name"), "the name of the approval gate is required"))
+		case names[gate.Name]:
+			errs = append(errs, field.Duplicate(gatePath.Child("name"), gate.Name))
+		}
+		names[gate.Name] = true
+		if gate.Quorum < 0 {
+			errs = append(errs, field.Invalid(gatePath.Child("quorum"), gate.Quorum, "quorum must not be negative"))
+		} else if len(gate.Approvers) > 0 && gate.Quorum > len(gate.Approvers) {
+			errs = append(errs, field.Invalid(gatePath.Child("quorum"), gate.Quorum, fmt.Sprintf("quorum must not exceed the number of the approvers %d", len(gate.Approvers))))
 		}
 	}
 	return errs
 }
 
 // ValidateTimeout validates the timeout of steps
-func (h *ValidatingHandler) ValidateTimeout(name, timeout string) field.ErrorList {
+func (h *ValidatingHandler) ValidateTimeout(path *field.Path, timeout string) field.ErrorList {
 	var errs field.ErrorList
 	_, err := time.ParseDuration(timeout)
 	if err != nil {
-		errs = append(errs, field.Invalid(field.NewPath("spec", "workflowSpec", "steps", "timeout"), name, "invalid timeout, please use the format of timeout like 1s, 1m, 1h or 1d"))
+		errs = append(errs, field.Invalid(path, timeout, "invalid timeout, please use the format of timeout like 1s, 1m, 1h or 1d"))
 	}
 	return errs
 }